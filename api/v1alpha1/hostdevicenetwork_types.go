@@ -26,12 +26,18 @@ const (
 
 // HostDeviceNetworkSpec defines the desired state of HostDeviceNetwork
 type HostDeviceNetworkSpec struct {
-	// Namespace of the NetworkAttachmentDefinition custom resource
+	// Namespace of the NetworkAttachmentDefinition custom resource, defaults to default
 	NetworkNamespace string `json:"networkNamespace,omitempty"`
-	// Host device resource pool name
+	// Host device resource pool name, qualified with the nvidia.com/ prefix if unqualified
 	ResourceName string `json:"resourceName,omitempty"`
+	// NodePool is the name of a node pool of the SR-IOV device plugin of the NicClusterPolicy, the resource name
+	// suffix of the pool is appended to the resource name
+	// +optional
+	NodePool string `json:"nodePool,omitempty"`
 	// IPAM configuration to be used for this network
 	IPAM string `json:"ipam,omitempty"`
+	// CNIVersion of the CNI config of the NetworkAttachmentDefinition, defaults to 0.3.1
+	CNIVersion string `json:"cniVersion,omitempty"`
 }
 
 // HostDeviceNetworkStatus defines the observed state of HostDeviceNetwork
@@ -45,6 +51,14 @@ type HostDeviceNetworkStatus struct {
 	Reason string `json:"reason,omitempty"`
 	// AppliedStates provide a finer view of the observed state
 	AppliedStates []AppliedState `json:"appliedStates,omitempty"`
+	// Conditions report warnings which do not prevent the network from being applied, e.g CNI config keys which
+	// are not supported by the deployed CNI plugins version
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// AttachedPods is the number of pods which are not terminated and select the network attachment definition in
+	// their network attachment annotation, only reported if the operator counts attached pods
+	// +optional
+	AttachedPods *int32 `json:"attachedPods,omitempty"`
 }
 
 // +kubebuilder:object:root=true
@@ -52,6 +66,7 @@ type HostDeviceNetworkStatus struct {
 // +kubebuilder:subresource:status
 // +kubebuilder:resource:scope=Cluster
 // +kubebuilder:printcolumn:name="Status",type=string,JSONPath=`.status.state`,priority=0
+// +kubebuilder:printcolumn:name="Attached Pods",type=integer,JSONPath=`.status.attachedPods`,priority=1
 // +kubebuilder:printcolumn:name="Age",type=string,JSONPath=`.metadata.creationTimestamp`,priority=0
 
 // HostDeviceNetwork is the Schema for the hostdevicenetworks API
@@ -0,0 +1,48 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"strings"
+
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+const (
+	// HostDeviceNetworkDefaultNetworkNamespace is the default namespace of the NetworkAttachmentDefinition
+	HostDeviceNetworkDefaultNetworkNamespace = "default"
+	// HostDeviceNetworkDefaultCNIVersion is the default CNI version of the NetworkAttachmentDefinition CNI config
+	HostDeviceNetworkDefaultCNIVersion = "0.3.1"
+	// HostDeviceNetworkResourceNamePrefix is the prefix of the host device resource pool names
+	HostDeviceNetworkResourceNamePrefix = "nvidia.com/"
+)
+
+var _ admission.Defaulter = &HostDeviceNetwork{}
+
+// Default sets the unset optional fields of the HostDeviceNetwork to their defaults and qualifies the resource name
+// with the resource name prefix, so the stored resource is fully specified. Default is idempotent.
+func (r *HostDeviceNetwork) Default() {
+	if r.Spec.NetworkNamespace == "" {
+		r.Spec.NetworkNamespace = HostDeviceNetworkDefaultNetworkNamespace
+	}
+	if r.Spec.CNIVersion == "" {
+		r.Spec.CNIVersion = HostDeviceNetworkDefaultCNIVersion
+	}
+	if r.Spec.ResourceName != "" && !strings.HasPrefix(r.Spec.ResourceName, HostDeviceNetworkResourceNamePrefix) {
+		r.Spec.ResourceName = HostDeviceNetworkResourceNamePrefix + r.Spec.ResourceName
+	}
+}
@@ -48,6 +48,15 @@ type ImageSpec struct {
 	// +optional
 	// +kubebuilder:default:={}
 	ImagePullSecrets []string `json:"imagePullSecrets"`
+	// ImagePullSecretsFrom is the name of a ServiceAccount in the operator resources namespace whose
+	// imagePullSecrets are added to the component pods
+	// +optional
+	ImagePullSecretsFrom string `json:"imagePullSecretsFrom,omitempty"`
+	// ManifestVersion pins the version of the manifests the component is rendered from, e.g v1, to stage an
+	// upgrade. The latest manifest version is used if not set.
+	// +optional
+	// +kubebuilder:validation:Pattern=`^v[0-9]+$`
+	ManifestVersion string `json:"manifestVersion,omitempty"`
 }
 
 type PodProbeSpec struct {
@@ -65,6 +74,78 @@ type OFEDDriverSpec struct {
 	LivenessProbe *PodProbeSpec `json:"livenessProbe,omitempty"`
 	// Pod readiness probe settings
 	ReadinessProbe *PodProbeSpec `json:"readinessProbe,omitempty"`
+	// Kernel module parameters applied on all nodes when OFED driver modules are loaded
+	// +optional
+	ModuleParams []KernelModuleParamsSpec `json:"moduleParams,omitempty"`
+	// Kernel module parameters overrides applied on groups of nodes, when a node matches several overrides
+	// the last one takes precedence
+	// +optional
+	ModuleParamsOverrides []KernelModuleParamsOverrideSpec `json:"moduleParamsOverrides,omitempty"`
+	// DNS configuration of the OFED driver Pod, e.g to resolve internal package repositories used when building
+	// the driver. Nameservers must be IP addresses.
+	// +optional
+	DNSConfig *v1.PodDNSConfig `json:"dnsConfig,omitempty"`
+	// Compute resources of the OFED driver container. Requests exceeding the allocatable resources of all eligible
+	// nodes are reported with a Warning condition
+	// +optional
+	Resources *v1.ResourceRequirements `json:"resources,omitempty"`
+	// Kernel versions, as reported by the feature.node.kubernetes.io/kernel-version.full node label, for which
+	// precompiled OFED driver images are available. The precompiled driver image of a kernel is deployed on the nodes
+	// running it, the driver is built from source on all the nodes if not set
+	// +optional
+	PrecompiledKernels []KernelVersion `json:"precompiledKernels,omitempty"`
+	// PrecompiledFallbackToSource builds the driver from source on the nodes running a kernel without a precompiled
+	// driver image, the driver is not deployed on these nodes if not set. Only used with PrecompiledKernels
+	// +optional
+	PrecompiledFallbackToSource bool `json:"precompiledFallbackToSource,omitempty"`
+	// MetricsExporter configures a sidecar of the OFED driver Pods exposing the RDMA counters of the nodes to
+	// Prometheus
+	// +optional
+	MetricsExporter *OFEDMetricsExporterSpec `json:"metricsExporter,omitempty"`
+}
+
+// OFEDMetricsExporterSpec describes the metrics exporter sidecar of the OFED driver Pods, it reads the RDMA counters
+// of the node from /sys and exposes them on a port of the host network
+type OFEDMetricsExporterSpec struct {
+	// Enabled indicates if the metrics exporter sidecar needs to be deployed
+	// +optional
+	// +kubebuilder:default:=false
+	Enabled bool `json:"enabled,omitempty"`
+	// Image information for the metrics exporter container
+	ImageSpec `json:""`
+	// Port of the host network the metrics are exposed on
+	// +optional
+	// +kubebuilder:default:=9800
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	Port int32 `json:"port,omitempty"`
+	// ServiceMonitor indicates if a Prometheus Operator ServiceMonitor scraping the metrics exporter needs to be
+	// deployed, it is skipped if the ServiceMonitor API is not present in the cluster
+	// +optional
+	// +kubebuilder:default:=false
+	ServiceMonitor bool `json:"serviceMonitor,omitempty"`
+}
+
+// KernelVersion is a full kernel version, e.g 5.4.0-42-generic
+// +kubebuilder:validation:MaxLength=63
+// +kubebuilder:validation:Pattern=`^[a-zA-Z0-9]([a-zA-Z0-9._-]*[a-zA-Z0-9])?$`
+type KernelVersion string
+
+// KernelModuleParamsSpec describes the parameters of a kernel module, rendered as a modprobe options line
+type KernelModuleParamsSpec struct {
+	// Kernel module name, e.g mlx5_core
+	// +kubebuilder:validation:Pattern=`^[a-zA-Z0-9_]+$`
+	Module string `json:"module"`
+	// Module parameters keyed by parameter name
+	Params map[string]string `json:"params"`
+}
+
+// KernelModuleParamsOverrideSpec describes kernel module parameters applied on a group of nodes
+type KernelModuleParamsOverrideSpec struct {
+	// Labels of the nodes the override applies to
+	NodeSelector map[string]string `json:"nodeSelector"`
+	// Kernel module parameters merged over the parameters applied on all nodes
+	ModuleParams []KernelModuleParamsSpec `json:"moduleParams"`
 }
 
 // NVPeerDriverSpec describes configuration options for NV Peer Memory driver
@@ -75,14 +156,217 @@ type NVPeerDriverSpec struct {
 	GPUDriverSourcePath string `json:"gpuDriverSourcePath,omitempty"`
 }
 
+// DevicePluginHealthCheckSpec describes configuration options for the device plugin gRPC health service.
+// The readiness probe uses the Kubernetes gRPC probe which requires Kubernetes v1.24 or newer, the device plugin
+// image must serve the gRPC health checking protocol on Port.
+type DevicePluginHealthCheckSpec struct {
+	// Enabled indicates if the device plugin gRPC health service is used for the readiness probe
+	// +optional
+	// +kubebuilder:default:=false
+	Enabled bool `json:"enabled,omitempty"`
+	// Port the gRPC health service listens on. Device plugins run with host network so the port is bound on the
+	// node and must not be used by any other host network process. Defaults are 9101 for the SR-IOV device plugin
+	// and 9102 for the RDMA shared device plugin: they differ so both plugins may run on the same node and they do not
+	// overlap kubelet, kube-proxy or node-exporter ports. Set Port explicitly if the default is taken on the nodes.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	Port int `json:"port,omitempty"`
+	// PortName is the name of the container port the gRPC health service port is declared as, Services and
+	// ServiceMonitors select the port by this name. Defaults to health.
+	// +optional
+	// +kubebuilder:validation:MaxLength=15
+	PortName string `json:"portName,omitempty"`
+	// Service is the gRPC health service name checked by the probe, overall server health is checked if not set
+	// +optional
+	Service string `json:"service,omitempty"`
+	// Pod readiness probe settings
+	// +optional
+	ReadinessProbe *PodProbeSpec `json:"readinessProbe,omitempty"`
+}
+
+// DevicePluginSocketMigrationSpec describes configuration options for removing sockets left in the kubelet device
+// plugins directory by legacy device plugin versions, which may block the device plugin from registering after an
+// upgrade.
+type DevicePluginSocketMigrationSpec struct {
+	// Enabled indicates if an init container removing known legacy device plugin sockets is deployed. The sockets
+	// are only removed if the device plugin version no longer uses them.
+	// +optional
+	// +kubebuilder:default:=false
+	Enabled bool `json:"enabled,omitempty"`
+}
+
+// DevicePluginRegistrationCheckSpec describes a liveness probe which restarts the device plugin container when the
+// device plugin is no longer registered with the kubelet, e.g when it missed a kubelet restart
+type DevicePluginRegistrationCheckSpec struct {
+	// Enabled indicates if the registration check liveness probe is rendered on the device plugin container
+	// +optional
+	// +kubebuilder:default:=false
+	Enabled bool `json:"enabled,omitempty"`
+	// Pod liveness probe settings
+	// +optional
+	LivenessProbe *PodProbeSpec `json:"livenessProbe,omitempty"`
+}
+
+// DevicePluginScratchVolumeSpec describes a memory-backed scratch volume of the device plugin, e.g for sockets
+type DevicePluginScratchVolumeSpec struct {
+	// MountPath is the absolute path the volume is mounted at in the device plugin container
+	MountPath string `json:"mountPath"`
+	// SizeLimit of the volume, e.g "64Mi". The volume is backed by tmpfs, its content counts against the memory of
+	// the device plugin container. The volume is limited by the memory of the node if not set
+	// +optional
+	SizeLimit string `json:"sizeLimit,omitempty"`
+}
+
+// DevicePluginCPUSpec describes the CPU configuration of the device plugin container, e.g to avoid over-parallelizing
+// the device plugin on nodes with many cores
+type DevicePluginCPUSpec struct {
+	// GOMAXPROCS limits the number of threads executing Go code simultaneously in the device plugin, rendered as the
+	// GOMAXPROCS environment variable. The Go runtime default, the number of CPUs of the node, is kept if not set
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	GOMAXPROCS int `json:"gomaxprocs,omitempty"`
+	// StaticPlacement requests exclusive CPUs for the device plugin from the static policy of the kubelet CPU
+	// manager, not requested if not set
+	// +optional
+	StaticPlacement *DevicePluginStaticCPUPlacementSpec `json:"staticPlacement,omitempty"`
+}
+
+// DevicePluginStaticCPUPlacementSpec describes the resources of the device plugin containers placed on exclusive CPUs
+// by the static policy of the kubelet CPU manager. The policy only applies to containers of Guaranteed Pods
+// requesting an integer number of CPUs, the resources are rendered as both requests and limits of the containers.
+type DevicePluginStaticCPUPlacementSpec struct {
+	// CPUs is the integer number of exclusive CPUs of the device plugin container, e.g "1"
+	CPUs string `json:"cpus"`
+	// Memory of the device plugin container, e.g "64Mi", Guaranteed Pods must request memory as well
+	Memory string `json:"memory"`
+}
+
 // DevicePluginSpec describes configuration options for device plugin
 type DevicePluginSpec struct {
 	// Image information for device plugin
 	ImageSpec `json:""`
 	// Device plugin configuration
 	Config string `json:"config"`
+	// Device plugin gRPC health service configuration
+	// +optional
+	HealthCheck *DevicePluginHealthCheckSpec `json:"healthCheck,omitempty"`
+	// Legacy device plugin socket migration configuration
+	// +optional
+	SocketMigration *DevicePluginSocketMigrationSpec `json:"socketMigration,omitempty"`
+	// Kubelet registration check configuration, restarts the device plugin if it is not registered with the kubelet
+	// +optional
+	RegistrationCheck *DevicePluginRegistrationCheckSpec `json:"registrationCheck,omitempty"`
+	// Link layer of the nodes the device plugin is deployed on, selected by the network.nvidia.com/link-layer node
+	// label. The device plugin is deployed on nodes of any link layer if not set
+	// +kubebuilder:validation:Enum={"infiniband", "ethernet"}
+	// +optional
+	LinkLayer string `json:"linkLayer,omitempty"`
+	// Kernel config options required by the device plugin, e.g CONFIG_INFINIBAND. The device plugin is not deployed
+	// on nodes where the network.nvidia.com/kernel-features node annotation does not list all of them
+	// +optional
+	RequiredKernelFeatures []KernelFeature `json:"requiredKernelFeatures,omitempty"`
+	// Memory-backed scratch volume mounted in the device plugin container, not deployed if not set
+	// +optional
+	ScratchVolume *DevicePluginScratchVolumeSpec `json:"scratchVolume,omitempty"`
+	// ShareProcessNamespace of the containers of the device plugin Pod, not set in the Pod spec if not set
+	// +optional
+	ShareProcessNamespace *bool `json:"shareProcessNamespace,omitempty"`
+	// CPU configuration of the device plugin container
+	// +optional
+	CPU *DevicePluginCPUSpec `json:"cpu,omitempty"`
+	// Node pools advertising the resources of the device plugin config under pool specific resource names, each pool
+	// is deployed with its own device plugin config and DaemonSet. Nodes which are not part of a pool are deployed
+	// with the resource names of the device plugin config
+	// +optional
+	NodePools []DevicePluginNodePoolSpec `json:"nodePools,omitempty"`
+	// TLS certificate provisioned by the operator for the device plugin
+	// +optional
+	TLS *DevicePluginTLSSpec `json:"tls,omitempty"`
+	// Resource name aliases advertising the devices of a resource of the device plugin config under additional
+	// names, e.g while pods migrate from one resource name to another
+	// +optional
+	ResourceNameAliases []DevicePluginResourceNameAlias `json:"resourceNameAliases,omitempty"`
+	// EvictionProtection annotates the device plugin Pods so the cluster autoscaler and the descheduler do not evict
+	// them, enabled if not set
+	// +optional
+	EvictionProtection *bool `json:"evictionProtection,omitempty"`
+	// HostReservedVFs of the PFs selected by the device plugin config which are kept for the host and not advertised,
+	// only supported by the SR-IOV device plugin
+	// +optional
+	HostReservedVFs *DevicePluginHostReservedVFsSpec `json:"hostReservedVFs,omitempty"`
+	// DeriveGPUTolerations adds tolerations of the taints of the eligible nodes labeled nvidia.com/gpu.present to the
+	// device plugin Pods, e.g for GPUDirect on tainted GPU nodes
+	// +optional
+	DeriveGPUTolerations bool `json:"deriveGPUTolerations,omitempty"`
+}
+
+// DevicePluginHostReservedVFsSpec describes the VFs of each PF selected by the pfNames selectors of the SR-IOV device
+// plugin config which are reserved for the host. Either Count or VFs is set.
+type DevicePluginHostReservedVFsSpec struct {
+	// Count of VFs reserved for the host, the first Count VFs of each PF are reserved
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	Count int `json:"count,omitempty"`
+	// VFs lists the indexes of the VFs reserved for the host
+	// +optional
+	VFs []int `json:"vfs,omitempty"`
+	// TotalVFs is the number of VFs of each PF, the reservation must leave at least one VF to advertise
+	// +kubebuilder:validation:Minimum=1
+	TotalVFs int `json:"totalVFs"`
+}
+
+// DevicePluginResourceNameAlias advertises the devices of a resource of the device plugin config under an additional
+// resource name. The devices are counted under both names, a device allocated under one name is still reported as
+// allocatable under the other.
+type DevicePluginResourceNameAlias struct {
+	// ResourceName of the resource of the device plugin config, e.g "hostdev"
+	ResourceName string `json:"resourceName"`
+	// Alias the devices of the resource are advertised under as well, e.g "hostdev_legacy"
+	// +kubebuilder:validation:Pattern=`^[a-zA-Z0-9_]+$`
+	Alias string `json:"alias"`
 }
 
+// DevicePluginTLSSpec describes a self-signed TLS certificate provisioned and rotated by the operator in a Secret
+// mounted in the device plugin container. The device plugin Pods are rolled when the certificate is rotated.
+type DevicePluginTLSSpec struct {
+	// Enabled indicates if the certificate Secret is provisioned and mounted in the device plugin container
+	// +optional
+	// +kubebuilder:default:=false
+	Enabled bool `json:"enabled,omitempty"`
+	// Validity of the certificate, e.g "8760h". Defaults to 8760h.
+	// +optional
+	Validity string `json:"validity,omitempty"`
+	// RotationWindow is the time before the certificate expires at which it is rotated, e.g "720h", it must be
+	// shorter than Validity. Defaults to 720h.
+	// +optional
+	RotationWindow string `json:"rotationWindow,omitempty"`
+	// MountPath is the absolute path the certificate Secret is mounted at in the device plugin container, the
+	// certificate and its key are mounted as tls.crt and tls.key. Defaults to /etc/device-plugin/tls.
+	// +optional
+	MountPath string `json:"mountPath,omitempty"`
+}
+
+// DevicePluginNodePoolSpec describes a pool of nodes the device plugin advertises its resources on under pool specific
+// resource names, e.g rdma_a and rdma_b for the rdma resource of two pools
+type DevicePluginNodePoolSpec struct {
+	// Name of the node pool, appended to the names of the device plugin objects of the pool
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	// +kubebuilder:validation:MaxLength=40
+	Name string `json:"name"`
+	// NodeSelector selects the nodes of the pool by their labels, a node selected by several pools is part of the
+	// first of them
+	// +kubebuilder:validation:MinProperties=1
+	NodeSelector map[string]string `json:"nodeSelector"`
+	// ResourceNameSuffix is appended to the name of each resource of the device plugin config, e.g "_a"
+	// +kubebuilder:validation:Pattern=`^[a-zA-Z0-9_]+$`
+	ResourceNameSuffix string `json:"resourceNameSuffix"`
+}
+
+// KernelFeature is a kernel config option, e.g CONFIG_INFINIBAND
+// +kubebuilder:validation:Pattern=`^CONFIG_[A-Z0-9_]+$`
+type KernelFeature string
+
 // MultusSpec describes configuration options for Multus CNI
 type MultusSpec struct {
 	// Image information for device plugin
@@ -92,14 +376,110 @@ type MultusSpec struct {
 	Config string `json:"config,omitempty"`
 }
 
+// WhereaboutsSpec describes configuration options for whereabouts IPAM CNI
+type WhereaboutsSpec struct {
+	// Image information for whereabouts
+	ImageSpec `json:""`
+	// Cron expression of the IP reconciler schedule which releases IP addresses allocated to deleted Pods,
+	// defaults to "*/5 * * * *". If empty, the IP reconciler is not deployed.
+	// +optional
+	ReconcilerSchedule *string `json:"reconcilerSchedule,omitempty"`
+	// IP pools rendered as whereabouts IPPools
+	// +optional
+	IPPools []WhereaboutsIPPoolSpec `json:"ipPools,omitempty"`
+}
+
+// WhereaboutsIPPoolSpec describes a whereabouts IPPool
+type WhereaboutsIPPoolSpec struct {
+	// Range of the pool in CIDR notation, e.g 192.168.2.0/24
+	Range string `json:"range"`
+}
+
 // SecondaryNetwork describes configuration options for secondary network
 type SecondaryNetworkSpec struct {
 	// Image and configuration information for multus
 	Multus *MultusSpec `json:"multus,omitempty"`
 	// Image information for CNI plugins
 	CniPlugins *ImageSpec `json:"cniPlugins,omitempty"`
-	// Image information for IPAM plugin
-	IpamPlugin *ImageSpec `json:"ipamPlugin,omitempty"`
+	// Image and configuration information for IPAM plugin
+	IpamPlugin *WhereaboutsSpec `json:"ipamPlugin,omitempty"`
+}
+
+// NodeFeatureRuleSpec describes configuration for the NFD NodeFeatureRule labeling nodes with Mellanox NICs
+type NodeFeatureRuleSpec struct {
+	// Enabled indicates if the NodeFeatureRule needs to be deployed, it requires the NFD NodeFeatureRule API
+	// +optional
+	// +kubebuilder:default:=false
+	Enabled bool `json:"enabled,omitempty"`
+}
+
+// ResourceQuotaSpec describes the ResourceQuota bounding the resources consumed by the Pods in the operator
+// resources namespace
+type ResourceQuotaSpec struct {
+	// Hard is the set of enforced hard limits for each named resource, e.g requests.cpu or limits.memory
+	Hard v1.ResourceList `json:"hard"`
+}
+
+// PriorityClassSpec describes the PriorityClass referenced by the critical Pods of the operator: the OFED driver,
+// the device plugins and the NV peer memory driver
+type PriorityClassSpec struct {
+	// Name of the PriorityClass
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`
+	Name string `json:"name"`
+	// Value of the PriorityClass created by the operator, values above one billion are reserved for system classes
+	// +optional
+	// +kubebuilder:validation:Maximum=1000000000
+	Value int32 `json:"value,omitempty"`
+	// Existing indicates the PriorityClass already exists in the cluster, it is then only referenced by the Pods
+	// and not created by the operator
+	// +optional
+	// +kubebuilder:default:=false
+	Existing bool `json:"existing,omitempty"`
+}
+
+// RenderDefaultsSpec describes the values used to render the node specific manifests when the matching node
+// attribute is missing or empty, e.g a node which was not labeled by NFD with its OS name
+type RenderDefaultsSpec struct {
+	// CPUArch used if the cpu-arch attribute of the node is missing, e.g amd64
+	// +optional
+	CPUArch string `json:"cpuArch,omitempty"`
+	// OSName used if the os-name attribute of the node is missing, e.g ubuntu
+	// +optional
+	OSName string `json:"osName,omitempty"`
+	// OSVer used if the os-version attribute of the node is missing, e.g 20.04
+	// +optional
+	OSVer string `json:"osVersion,omitempty"`
+}
+
+// ExternalRenderDataSpec references a ConfigMap or a Secret in the operator resources namespace whose keys are merged
+// into the render data of the manifests under Prefix, for values which are not modeled in NicClusterPolicy, e.g an
+// UFM endpoint. Exactly one of ConfigMap and Secret must be set.
+type ExternalRenderDataSpec struct {
+	// Prefix the keys are rendered under, e.g the key endpoint of the prefix ufm is rendered with
+	// {{ .RuntimeSpec.External.ufm.endpoint }}
+	// +kubebuilder:validation:Pattern=`^[a-zA-Z][a-zA-Z0-9_]*$`
+	Prefix string `json:"prefix"`
+	// ConfigMap is the name of the ConfigMap holding the values
+	// +optional
+	ConfigMap string `json:"configMap,omitempty"`
+	// Secret is the name of the Secret holding the values, the values are redacted in logs
+	// +optional
+	Secret string `json:"secret,omitempty"`
+}
+
+// ValidatingWebhookSpec describes the ValidatingWebhookConfiguration of the operator webhook server. The operator
+// manages the certificate of the webhook server and the caBundle of the configuration.
+type ValidatingWebhookSpec struct {
+	// ServiceName of the Service exposing the operator webhook server
+	ServiceName string `json:"serviceName"`
+	// ServiceNamespace of the Service exposing the operator webhook server, the Secret holding the certificate of the
+	// webhook server is created in this namespace
+	ServiceNamespace string `json:"serviceNamespace"`
+	// FailurePolicy of the webhooks, Ignore admits requests if the webhook server is not reachable
+	// +optional
+	// +kubebuilder:default:=Ignore
+	// +kubebuilder:validation:Enum={"Ignore", "Fail"}
+	FailurePolicy string `json:"failurePolicy,omitempty"`
 }
 
 // PSPSpec describes configuration for PodSecurityPolicies to apply for all Pods
@@ -110,6 +490,19 @@ type PSPSpec struct {
 	Enabled bool `json:"enabled,omitempty"`
 }
 
+// PSASpec describes configuration for Pod Security Admission labels applied on the operator resources namespace
+type PSASpec struct {
+	// Enabled indicates if Pod Security Admission labels needs to be applied on the operator resources namespace
+	// +optional
+	// +kubebuilder:default:=false
+	Enabled bool `json:"enabled,omitempty"`
+	// Level is the Pod Security Standard level applied for the enforce, audit and warn modes
+	// +optional
+	// +kubebuilder:default:=privileged
+	// +kubebuilder:validation:Enum={"privileged", "baseline", "restricted"}
+	Level string `json:"level,omitempty"`
+}
+
 // NicClusterPolicySpec defines the desired state of NicClusterPolicy
 type NicClusterPolicySpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
@@ -122,6 +515,33 @@ type NicClusterPolicySpec struct {
 	SriovDevicePlugin      *DevicePluginSpec     `json:"sriovDevicePlugin,omitempty"`
 	SecondaryNetwork       *SecondaryNetworkSpec `json:"secondaryNetwork,omitempty"`
 	PSP                    *PSPSpec              `json:"psp,omitempty"`
+	PSA                    *PSASpec              `json:"psa,omitempty"`
+	// NodeFeatureRule configures rendering of an NFD NodeFeatureRule which labels nodes with Mellanox NICs
+	// +optional
+	NodeFeatureRule *NodeFeatureRuleSpec `json:"nodeFeatureRule,omitempty"`
+	// ResourceQuota configures rendering of a ResourceQuota in the operator resources namespace
+	// +optional
+	ResourceQuota *ResourceQuotaSpec `json:"resourceQuota,omitempty"`
+	// PriorityClass configures the PriorityClass referenced by the critical Pods of the operator, the
+	// system-node-critical PriorityClass is referenced if not set
+	// +optional
+	PriorityClass *PriorityClassSpec `json:"priorityClass,omitempty"`
+	// RenderDefaults configures the values used to render the node specific manifests when the node attributes
+	// are missing, a node attribute takes precedence over its default
+	// +optional
+	RenderDefaults *RenderDefaultsSpec `json:"renderDefaults,omitempty"`
+	// ValidatingWebhook configures rendering of the ValidatingWebhookConfiguration of the operator webhook server
+	// +optional
+	ValidatingWebhook *ValidatingWebhookSpec `json:"validatingWebhook,omitempty"`
+	// FeatureGates toggles optional and experimental operator behaviors. Gate names are UpperCamelCase, describe
+	// the behavior they enable (e.g "OFEDDriverHostNetwork") and are prefixed with the component they affect.
+	// A gate which is not set keeps its default value.
+	// +optional
+	FeatureGates map[string]bool `json:"featureGates,omitempty"`
+	// ExternalRenderData merges the keys of ConfigMaps and Secrets into the render data of the manifests, the
+	// referenced objects are watched and resolved on every sync
+	// +optional
+	ExternalRenderData []ExternalRenderDataSpec `json:"externalRenderData,omitempty"`
 }
 
 // AppliedState defines a finer-grained view of the observed state of NicClusterPolicy
@@ -129,8 +549,66 @@ type AppliedState struct {
 	Name string `json:"name"`
 	// +kubebuilder:validation:Enum={"ready", "notReady", "ignore", "error"}
 	State State `json:"state"`
+	// Message contains the error reported by the state, if any
+	Message string `json:"message,omitempty"`
+	// Hint suggests an action to resolve the error reported in Message
+	Hint string `json:"hint,omitempty"`
+	// SkippedNodes lists nodes which were skipped by the state
+	SkippedNodes []string `json:"skippedNodes,omitempty"`
+	// Workloads reports the readiness of the DaemonSets and Deployments applied by the state
+	Workloads []WorkloadStatus `json:"workloads,omitempty"`
+	// NodeModes reports the mode the state is deployed in on each node, e.g whether the OFED driver is precompiled
+	// or built from source
+	NodeModes []NodeMode `json:"nodeModes,omitempty"`
+	// OSGroups reports the eligible nodes of the state grouped by OS distribution, the state renders a DaemonSet
+	// per OS distribution
+	OSGroups []OSGroup `json:"osGroups,omitempty"`
+}
+
+// NodeMode reports the mode a state is deployed in on a node
+type NodeMode struct {
+	// Node name
+	Node string `json:"node"`
+	// Mode of the state on the node
+	Mode string `json:"mode"`
+}
+
+// OSGroup reports the eligible nodes of a state running the same OS distribution
+type OSGroup struct {
+	// OSName is the ID of the OS distribution, e.g ubuntu
+	OSName string `json:"osName"`
+	// OSVersion is the version of the OS distribution, e.g 20.04
+	OSVersion string `json:"osVersion"`
+	// Nodes running the OS distribution
+	Nodes []string `json:"nodes"`
 }
 
+// WorkloadStatus reports the readiness of a workload object normalized across workload kinds
+type WorkloadStatus struct {
+	// Kind of the workload object, DaemonSet or Deployment
+	Kind string `json:"kind"`
+	// Name of the workload object
+	Name string `json:"name"`
+	// Ready is the number of ready pods of a DaemonSet or available replicas of a Deployment
+	Ready int32 `json:"ready"`
+	// Desired is the number of scheduled pods of a DaemonSet or replicas of a Deployment
+	Desired int32 `json:"desired"`
+	// ReadyPercent is the percentage of ready pods out of the desired pods, 0 if no pod is desired
+	ReadyPercent int32 `json:"readyPercent"`
+}
+
+const (
+	// ConditionTypeWarning is the type of the NicClusterPolicy and HostDeviceNetwork status condition reporting
+	// warnings
+	ConditionTypeWarning = "Warning"
+	// ConditionTypeMaintenance is the type of the NicClusterPolicy status condition reporting that transient API
+	// errors are tolerated, e.g during a control plane upgrade
+	ConditionTypeMaintenance = "Maintenance"
+	// ConditionTypeNoEligibleNodes is the type of the NicClusterPolicy status condition reporting the states which
+	// found no nodes matching their node filter, and therefore have nothing to deploy
+	ConditionTypeNoEligibleNodes = "NoEligibleNodes"
+)
+
 // NicClusterPolicyStatus defines the observed state of NicClusterPolicy
 type NicClusterPolicyStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
@@ -141,8 +619,20 @@ type NicClusterPolicyStatus struct {
 	State State `json:"state"`
 	// Informative string in case the observed state is error
 	Reason string `json:"reason,omitempty"`
+	// ObservedGeneration is the generation of the NicClusterPolicy spec of the last reconcile which applied all
+	// states successfully
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
 	// AppliedStates provide a finer view of the observed state
 	AppliedStates []AppliedState `json:"appliedStates,omitempty"`
+	// Conditions report warnings which do not prevent the states from being applied, maintenance mode and states
+	// which found no eligible nodes
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// InstallCompleteTime is the time all the enabled states of the NicClusterPolicy were first ready, the
+	// InstallComplete Event is recorded once when it is set
+	// +optional
+	InstallCompleteTime *metav1.Time `json:"installCompleteTime,omitempty"`
 }
 
 // +kubebuilder:object:root=true
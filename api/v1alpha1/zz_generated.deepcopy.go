@@ -23,12 +23,35 @@ package v1alpha1
 
 import (
 	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *AppliedState) DeepCopyInto(out *AppliedState) {
 	*out = *in
+	if in.SkippedNodes != nil {
+		in, out := &in.SkippedNodes, &out.SkippedNodes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Workloads != nil {
+		in, out := &in.Workloads, &out.Workloads
+		*out = make([]WorkloadStatus, len(*in))
+		copy(*out, *in)
+	}
+	if in.NodeModes != nil {
+		in, out := &in.NodeModes, &out.NodeModes
+		*out = make([]NodeMode, len(*in))
+		copy(*out, *in)
+	}
+	if in.OSGroups != nil {
+		in, out := &in.OSGroups, &out.OSGroups
+		*out = make([]OSGroup, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AppliedState.
@@ -41,10 +64,219 @@ func (in *AppliedState) DeepCopy() *AppliedState {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DevicePluginCPUSpec) DeepCopyInto(out *DevicePluginCPUSpec) {
+	*out = *in
+	if in.StaticPlacement != nil {
+		in, out := &in.StaticPlacement, &out.StaticPlacement
+		*out = new(DevicePluginStaticCPUPlacementSpec)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DevicePluginCPUSpec.
+func (in *DevicePluginCPUSpec) DeepCopy() *DevicePluginCPUSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(DevicePluginCPUSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DevicePluginHealthCheckSpec) DeepCopyInto(out *DevicePluginHealthCheckSpec) {
+	*out = *in
+	if in.ReadinessProbe != nil {
+		in, out := &in.ReadinessProbe, &out.ReadinessProbe
+		*out = new(PodProbeSpec)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DevicePluginHealthCheckSpec.
+func (in *DevicePluginHealthCheckSpec) DeepCopy() *DevicePluginHealthCheckSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(DevicePluginHealthCheckSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DevicePluginHostReservedVFsSpec) DeepCopyInto(out *DevicePluginHostReservedVFsSpec) {
+	*out = *in
+	if in.VFs != nil {
+		in, out := &in.VFs, &out.VFs
+		*out = make([]int, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DevicePluginHostReservedVFsSpec.
+func (in *DevicePluginHostReservedVFsSpec) DeepCopy() *DevicePluginHostReservedVFsSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(DevicePluginHostReservedVFsSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DevicePluginNodePoolSpec) DeepCopyInto(out *DevicePluginNodePoolSpec) {
+	*out = *in
+	if in.NodeSelector != nil {
+		in, out := &in.NodeSelector, &out.NodeSelector
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DevicePluginNodePoolSpec.
+func (in *DevicePluginNodePoolSpec) DeepCopy() *DevicePluginNodePoolSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(DevicePluginNodePoolSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DevicePluginRegistrationCheckSpec) DeepCopyInto(out *DevicePluginRegistrationCheckSpec) {
+	*out = *in
+	if in.LivenessProbe != nil {
+		in, out := &in.LivenessProbe, &out.LivenessProbe
+		*out = new(PodProbeSpec)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DevicePluginRegistrationCheckSpec.
+func (in *DevicePluginRegistrationCheckSpec) DeepCopy() *DevicePluginRegistrationCheckSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(DevicePluginRegistrationCheckSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DevicePluginResourceNameAlias) DeepCopyInto(out *DevicePluginResourceNameAlias) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DevicePluginResourceNameAlias.
+func (in *DevicePluginResourceNameAlias) DeepCopy() *DevicePluginResourceNameAlias {
+	if in == nil {
+		return nil
+	}
+	out := new(DevicePluginResourceNameAlias)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DevicePluginScratchVolumeSpec) DeepCopyInto(out *DevicePluginScratchVolumeSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DevicePluginScratchVolumeSpec.
+func (in *DevicePluginScratchVolumeSpec) DeepCopy() *DevicePluginScratchVolumeSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(DevicePluginScratchVolumeSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DevicePluginSocketMigrationSpec) DeepCopyInto(out *DevicePluginSocketMigrationSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DevicePluginSocketMigrationSpec.
+func (in *DevicePluginSocketMigrationSpec) DeepCopy() *DevicePluginSocketMigrationSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(DevicePluginSocketMigrationSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DevicePluginSpec) DeepCopyInto(out *DevicePluginSpec) {
 	*out = *in
 	in.ImageSpec.DeepCopyInto(&out.ImageSpec)
+	if in.HealthCheck != nil {
+		in, out := &in.HealthCheck, &out.HealthCheck
+		*out = new(DevicePluginHealthCheckSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SocketMigration != nil {
+		in, out := &in.SocketMigration, &out.SocketMigration
+		*out = new(DevicePluginSocketMigrationSpec)
+		**out = **in
+	}
+	if in.RegistrationCheck != nil {
+		in, out := &in.RegistrationCheck, &out.RegistrationCheck
+		*out = new(DevicePluginRegistrationCheckSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RequiredKernelFeatures != nil {
+		in, out := &in.RequiredKernelFeatures, &out.RequiredKernelFeatures
+		*out = make([]KernelFeature, len(*in))
+		copy(*out, *in)
+	}
+	if in.ScratchVolume != nil {
+		in, out := &in.ScratchVolume, &out.ScratchVolume
+		*out = new(DevicePluginScratchVolumeSpec)
+		**out = **in
+	}
+	if in.ShareProcessNamespace != nil {
+		in, out := &in.ShareProcessNamespace, &out.ShareProcessNamespace
+		*out = new(bool)
+		**out = **in
+	}
+	if in.CPU != nil {
+		in, out := &in.CPU, &out.CPU
+		*out = new(DevicePluginCPUSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.NodePools != nil {
+		in, out := &in.NodePools, &out.NodePools
+		*out = make([]DevicePluginNodePoolSpec, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.TLS != nil {
+		in, out := &in.TLS, &out.TLS
+		*out = new(DevicePluginTLSSpec)
+		**out = **in
+	}
+	if in.ResourceNameAliases != nil {
+		in, out := &in.ResourceNameAliases, &out.ResourceNameAliases
+		*out = make([]DevicePluginResourceNameAlias, len(*in))
+		copy(*out, *in)
+	}
+	if in.EvictionProtection != nil {
+		in, out := &in.EvictionProtection, &out.EvictionProtection
+		*out = new(bool)
+		**out = **in
+	}
+	if in.HostReservedVFs != nil {
+		in, out := &in.HostReservedVFs, &out.HostReservedVFs
+		*out = new(DevicePluginHostReservedVFsSpec)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DevicePluginSpec.
@@ -57,6 +289,51 @@ func (in *DevicePluginSpec) DeepCopy() *DevicePluginSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DevicePluginStaticCPUPlacementSpec) DeepCopyInto(out *DevicePluginStaticCPUPlacementSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DevicePluginStaticCPUPlacementSpec.
+func (in *DevicePluginStaticCPUPlacementSpec) DeepCopy() *DevicePluginStaticCPUPlacementSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(DevicePluginStaticCPUPlacementSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DevicePluginTLSSpec) DeepCopyInto(out *DevicePluginTLSSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DevicePluginTLSSpec.
+func (in *DevicePluginTLSSpec) DeepCopy() *DevicePluginTLSSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(DevicePluginTLSSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExternalRenderDataSpec) DeepCopyInto(out *ExternalRenderDataSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExternalRenderDataSpec.
+func (in *ExternalRenderDataSpec) DeepCopy() *ExternalRenderDataSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ExternalRenderDataSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *HostDeviceNetwork) DeepCopyInto(out *HostDeviceNetwork) {
 	*out = *in
@@ -137,7 +414,21 @@ func (in *HostDeviceNetworkStatus) DeepCopyInto(out *HostDeviceNetworkStatus) {
 	if in.AppliedStates != nil {
 		in, out := &in.AppliedStates, &out.AppliedStates
 		*out = make([]AppliedState, len(*in))
-		copy(*out, *in)
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.AttachedPods != nil {
+		in, out := &in.AttachedPods, &out.AttachedPods
+		*out = new(int32)
+		**out = **in
 	}
 }
 
@@ -171,6 +462,57 @@ func (in *ImageSpec) DeepCopy() *ImageSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KernelModuleParamsOverrideSpec) DeepCopyInto(out *KernelModuleParamsOverrideSpec) {
+	*out = *in
+	if in.NodeSelector != nil {
+		in, out := &in.NodeSelector, &out.NodeSelector
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.ModuleParams != nil {
+		in, out := &in.ModuleParams, &out.ModuleParams
+		*out = make([]KernelModuleParamsSpec, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KernelModuleParamsOverrideSpec.
+func (in *KernelModuleParamsOverrideSpec) DeepCopy() *KernelModuleParamsOverrideSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(KernelModuleParamsOverrideSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KernelModuleParamsSpec) DeepCopyInto(out *KernelModuleParamsSpec) {
+	*out = *in
+	if in.Params != nil {
+		in, out := &in.Params, &out.Params
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KernelModuleParamsSpec.
+func (in *KernelModuleParamsSpec) DeepCopy() *KernelModuleParamsSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(KernelModuleParamsSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *MacvlanNetwork) DeepCopyInto(out *MacvlanNetwork) {
 	*out = *in
@@ -389,6 +731,48 @@ func (in *NicClusterPolicySpec) DeepCopyInto(out *NicClusterPolicySpec) {
 		*out = new(PSPSpec)
 		**out = **in
 	}
+	if in.PSA != nil {
+		in, out := &in.PSA, &out.PSA
+		*out = new(PSASpec)
+		**out = **in
+	}
+	if in.NodeFeatureRule != nil {
+		in, out := &in.NodeFeatureRule, &out.NodeFeatureRule
+		*out = new(NodeFeatureRuleSpec)
+		**out = **in
+	}
+	if in.ResourceQuota != nil {
+		in, out := &in.ResourceQuota, &out.ResourceQuota
+		*out = new(ResourceQuotaSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.PriorityClass != nil {
+		in, out := &in.PriorityClass, &out.PriorityClass
+		*out = new(PriorityClassSpec)
+		**out = **in
+	}
+	if in.RenderDefaults != nil {
+		in, out := &in.RenderDefaults, &out.RenderDefaults
+		*out = new(RenderDefaultsSpec)
+		**out = **in
+	}
+	if in.ValidatingWebhook != nil {
+		in, out := &in.ValidatingWebhook, &out.ValidatingWebhook
+		*out = new(ValidatingWebhookSpec)
+		**out = **in
+	}
+	if in.FeatureGates != nil {
+		in, out := &in.FeatureGates, &out.FeatureGates
+		*out = make(map[string]bool, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.ExternalRenderData != nil {
+		in, out := &in.ExternalRenderData, &out.ExternalRenderData
+		*out = make([]ExternalRenderDataSpec, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NicClusterPolicySpec.
@@ -407,7 +791,20 @@ func (in *NicClusterPolicyStatus) DeepCopyInto(out *NicClusterPolicyStatus) {
 	if in.AppliedStates != nil {
 		in, out := &in.AppliedStates, &out.AppliedStates
 		*out = make([]AppliedState, len(*in))
-		copy(*out, *in)
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.InstallCompleteTime != nil {
+		in, out := &in.InstallCompleteTime, &out.InstallCompleteTime
+		*out = (*in).DeepCopy()
 	}
 }
 
@@ -421,6 +818,36 @@ func (in *NicClusterPolicyStatus) DeepCopy() *NicClusterPolicyStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NodeFeatureRuleSpec) DeepCopyInto(out *NodeFeatureRuleSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NodeFeatureRuleSpec.
+func (in *NodeFeatureRuleSpec) DeepCopy() *NodeFeatureRuleSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(NodeFeatureRuleSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NodeMode) DeepCopyInto(out *NodeMode) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NodeMode.
+func (in *NodeMode) DeepCopy() *NodeMode {
+	if in == nil {
+		return nil
+	}
+	out := new(NodeMode)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *OFEDDriverSpec) DeepCopyInto(out *OFEDDriverSpec) {
 	*out = *in
@@ -440,6 +867,40 @@ func (in *OFEDDriverSpec) DeepCopyInto(out *OFEDDriverSpec) {
 		*out = new(PodProbeSpec)
 		**out = **in
 	}
+	if in.ModuleParams != nil {
+		in, out := &in.ModuleParams, &out.ModuleParams
+		*out = make([]KernelModuleParamsSpec, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.ModuleParamsOverrides != nil {
+		in, out := &in.ModuleParamsOverrides, &out.ModuleParamsOverrides
+		*out = make([]KernelModuleParamsOverrideSpec, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.DNSConfig != nil {
+		in, out := &in.DNSConfig, &out.DNSConfig
+		*out = new(v1.PodDNSConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Resources != nil {
+		in, out := &in.Resources, &out.Resources
+		*out = new(v1.ResourceRequirements)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.PrecompiledKernels != nil {
+		in, out := &in.PrecompiledKernels, &out.PrecompiledKernels
+		*out = make([]KernelVersion, len(*in))
+		copy(*out, *in)
+	}
+	if in.MetricsExporter != nil {
+		in, out := &in.MetricsExporter, &out.MetricsExporter
+		*out = new(OFEDMetricsExporterSpec)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OFEDDriverSpec.
@@ -452,6 +913,57 @@ func (in *OFEDDriverSpec) DeepCopy() *OFEDDriverSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OFEDMetricsExporterSpec) DeepCopyInto(out *OFEDMetricsExporterSpec) {
+	*out = *in
+	in.ImageSpec.DeepCopyInto(&out.ImageSpec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OFEDMetricsExporterSpec.
+func (in *OFEDMetricsExporterSpec) DeepCopy() *OFEDMetricsExporterSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(OFEDMetricsExporterSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OSGroup) DeepCopyInto(out *OSGroup) {
+	*out = *in
+	if in.Nodes != nil {
+		in, out := &in.Nodes, &out.Nodes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OSGroup.
+func (in *OSGroup) DeepCopy() *OSGroup {
+	if in == nil {
+		return nil
+	}
+	out := new(OSGroup)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PSASpec) DeepCopyInto(out *PSASpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PSASpec.
+func (in *PSASpec) DeepCopy() *PSASpec {
+	if in == nil {
+		return nil
+	}
+	out := new(PSASpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PSPSpec) DeepCopyInto(out *PSPSpec) {
 	*out = *in
@@ -482,6 +994,58 @@ func (in *PodProbeSpec) DeepCopy() *PodProbeSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PriorityClassSpec) DeepCopyInto(out *PriorityClassSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PriorityClassSpec.
+func (in *PriorityClassSpec) DeepCopy() *PriorityClassSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(PriorityClassSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RenderDefaultsSpec) DeepCopyInto(out *RenderDefaultsSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RenderDefaultsSpec.
+func (in *RenderDefaultsSpec) DeepCopy() *RenderDefaultsSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(RenderDefaultsSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ResourceQuotaSpec) DeepCopyInto(out *ResourceQuotaSpec) {
+	*out = *in
+	if in.Hard != nil {
+		in, out := &in.Hard, &out.Hard
+		*out = make(v1.ResourceList, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val.DeepCopy()
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ResourceQuotaSpec.
+func (in *ResourceQuotaSpec) DeepCopy() *ResourceQuotaSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ResourceQuotaSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SecondaryNetworkSpec) DeepCopyInto(out *SecondaryNetworkSpec) {
 	*out = *in
@@ -497,7 +1061,7 @@ func (in *SecondaryNetworkSpec) DeepCopyInto(out *SecondaryNetworkSpec) {
 	}
 	if in.IpamPlugin != nil {
 		in, out := &in.IpamPlugin, &out.IpamPlugin
-		*out = new(ImageSpec)
+		*out = new(WhereaboutsSpec)
 		(*in).DeepCopyInto(*out)
 	}
 }
@@ -511,3 +1075,74 @@ func (in *SecondaryNetworkSpec) DeepCopy() *SecondaryNetworkSpec {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ValidatingWebhookSpec) DeepCopyInto(out *ValidatingWebhookSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ValidatingWebhookSpec.
+func (in *ValidatingWebhookSpec) DeepCopy() *ValidatingWebhookSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ValidatingWebhookSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WhereaboutsIPPoolSpec) DeepCopyInto(out *WhereaboutsIPPoolSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WhereaboutsIPPoolSpec.
+func (in *WhereaboutsIPPoolSpec) DeepCopy() *WhereaboutsIPPoolSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(WhereaboutsIPPoolSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WhereaboutsSpec) DeepCopyInto(out *WhereaboutsSpec) {
+	*out = *in
+	in.ImageSpec.DeepCopyInto(&out.ImageSpec)
+	if in.ReconcilerSchedule != nil {
+		in, out := &in.ReconcilerSchedule, &out.ReconcilerSchedule
+		*out = new(string)
+		**out = **in
+	}
+	if in.IPPools != nil {
+		in, out := &in.IPPools, &out.IPPools
+		*out = make([]WhereaboutsIPPoolSpec, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WhereaboutsSpec.
+func (in *WhereaboutsSpec) DeepCopy() *WhereaboutsSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(WhereaboutsSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WorkloadStatus) DeepCopyInto(out *WorkloadStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WorkloadStatus.
+func (in *WorkloadStatus) DeepCopy() *WorkloadStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(WorkloadStatus)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -17,25 +17,36 @@ package controllers //nolint:dupl
 
 import (
 	"context"
+	"encoding/json"
+	"strings"
 	"time"
 
 	netattdefv1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/types"
 
 	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel/attribute"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	ctrlbuilder "sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	mellanoxcomv1alpha1 "github.com/Mellanox/network-operator/api/v1alpha1"
-	"github.com/Mellanox/network-operator/pkg/config"
 	"github.com/Mellanox/network-operator/pkg/consts"
+	"github.com/Mellanox/network-operator/pkg/nodeinfo"
 	"github.com/Mellanox/network-operator/pkg/state"
+	"github.com/Mellanox/network-operator/pkg/tracing"
 	"github.com/Mellanox/network-operator/pkg/utils"
+	"github.com/Mellanox/network-operator/pkg/validation"
 )
 
 // HostDeviceNetworkReconciler reconciles a HostDeviceNetwork object
@@ -43,18 +54,37 @@ type HostDeviceNetworkReconciler struct {
 	client.Client
 	Log    logr.Logger
 	Scheme *runtime.Scheme
+	// Recorder records the Events of the states and of the deprecated fields, no Events are recorded if not set
+	Recorder record.EventRecorder
+	// AdaptiveRequeue scales the requeue delay of resources which are not ready with the depth of the reconcile queue
+	AdaptiveRequeue bool
+	// AttachedPodsInterval is the interval of the refresh of the number of pods attached to a ready
+	// HostDeviceNetwork, attached pods are not counted if not set
+	AttachedPodsInterval time.Duration
+	// WatchSourceFilter selects the watch sources of the states registered by the controller, all the watch sources
+	// are registered if not set
+	WatchSourceFilter *state.WatchSourceFilter
 
 	stateManager state.Manager
+	// queue is the reconcile queue of the controller, its depth scales the requeue delay with adaptive requeue
+	queue *reconcileQueue
 }
 
 // +kubebuilder:rbac:groups=mellanox.com,resources=hostdevicenetworks,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=mellanox.com,resources=hostdevicenetworks/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups="",resources=pods,verbs=list;watch
+// +kubebuilder:rbac:groups="",resources=nodes,verbs=list;watch
 // +kubebuilder:rbac:groups=k8s.cni.cncf.io,resources=*,verbs=*
+// +kubebuilder:rbac:groups=networking.k8s.io,resources=networkpolicies,verbs=get;list;watch;create;update;patch;delete
 
 //nolint:dupl
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
 func (r *HostDeviceNetworkReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	ctx, span := tracing.StartSpan(ctx, "HostDeviceNetwork.Reconcile", attribute.String("name", req.Name),
+		attribute.String("namespace", req.Namespace))
+	defer span.End()
+
 	reqLogger := r.Log.WithValues("hostdevicenetwork", req.NamespacedName)
 	reqLogger.Info("Reconciling HostDeviceNetwork")
 
@@ -72,7 +102,16 @@ func (r *HostDeviceNetworkReconciler) Reconcile(ctx context.Context, req ctrl.Re
 		return reconcile.Result{}, err
 	}
 
-	managerStatus, err := r.stateManager.SyncState(instance, nil)
+	if err := validation.Validate(mellanoxcomv1alpha1.HostDeviceNetworkCRDName, instance); err != nil {
+		// Resources admitted while the webhook server was not reachable are rejected on reconcile
+		reqLogger.Info("Invalid HostDeviceNetwork", "error", err)
+		instance.Status.State = mellanoxcomv1alpha1.StateError
+		instance.Status.Reason = err.Error()
+		return reconcile.Result{}, r.Status().Update(context.TODO(), instance)
+	}
+
+	syncCtx := state.WithSyncPhaseTimer(withEventRecorder(ctx, r.Recorder), observeSyncPhase)
+	managerStatus, err := r.stateManager.SyncState(syncCtx, instance, r.getInfoCatalog(ctx))
 	r.updateCrStatus(instance, managerStatus)
 	if err != nil {
 		return reconcile.Result{}, err
@@ -80,13 +119,36 @@ func (r *HostDeviceNetworkReconciler) Reconcile(ctx context.Context, req ctrl.Re
 
 	if managerStatus.Status != state.SyncStateReady {
 		return reconcile.Result{
-			RequeueAfter: time.Duration(config.FromEnv().Controller.RequeueTimeSeconds) * time.Second,
+			RequeueAfter: getRequeueDelay(r.queue, r.AdaptiveRequeue),
 		}, nil
 	}
 
+	if r.AttachedPodsInterval > 0 {
+		// Pods are not watched, the number of attached pods is refreshed periodically
+		return reconcile.Result{RequeueAfter: r.AttachedPodsInterval}, nil
+	}
+
 	return ctrl.Result{}, nil
 }
 
+// getInfoCatalog returns a catalog providing the information of the Mellanox NIC nodes, which the state checks for
+// allocatable devices of the resource referenced by the HostDeviceNetwork
+func (r *HostDeviceNetworkReconciler) getInfoCatalog(ctx context.Context) state.InfoCatalog {
+	sc := state.NewInfoCatalog()
+	nodeList := &corev1.NodeList{}
+	if err := r.List(ctx, nodeList, nodeinfo.MellanoxNICListOptions...); err != nil {
+		r.Log.V(consts.LogLevelError).Info("Error occurred on LIST nodes request from API server.", "error:", err)
+		sc.Add(state.InfoTypeNodeInfo, nodeinfo.NewFailedProvider(err))
+		return sc
+	}
+	nodes := make([]*corev1.Node, len(nodeList.Items))
+	for i := range nodes {
+		nodes[i] = &nodeList.Items[i]
+	}
+	sc.Add(state.InfoTypeNodeInfo, nodeinfo.NewProvider(nodes))
+	return sc
+}
+
 //nolint:dupl
 func (r *HostDeviceNetworkReconciler) updateCrStatus(cr *mellanoxcomv1alpha1.HostDeviceNetwork, status state.Results) {
 NextResult:
@@ -105,6 +167,8 @@ NextResult:
 	}
 	// Update global State
 	cr.Status.State = mellanoxcomv1alpha1.State(status.Status)
+	deprecations := lintDeprecatedFields(r.Recorder, mellanoxcomv1alpha1.HostDeviceNetworkCRDName, cr, r.Log)
+	setWarningCondition(&cr.Status.Conditions, cr.Generation, status, deprecations)
 
 	if cr.Status.State == state.SyncStateReady {
 		netAttachDef := &netattdefv1.NetworkAttachmentDefinition{}
@@ -119,6 +183,17 @@ NextResult:
 		} else {
 			cr.Status.HostDeviceNetworkAttachmentDef = utils.GetNetworkAttachmentDefLink(netAttachDef)
 		}
+
+		if r.AttachedPodsInterval > 0 {
+			pods := &corev1.PodList{}
+			if err := r.List(context.TODO(), pods); err != nil {
+				r.Log.V(consts.LogLevelError).Info("Can not list pods attached to the network", "error:", err)
+			} else {
+				attached := countAttachedPods(pods.Items,
+					types.NamespacedName{Namespace: cr.Spec.NetworkNamespace, Name: cr.Name})
+				cr.Status.AttachedPods = &attached
+			}
+		}
 	}
 
 	// send status update request to k8s API
@@ -130,11 +205,69 @@ NextResult:
 	}
 }
 
+// countAttachedPods returns the number of pods which are not terminated and select the network in their network
+// attachment annotation, pods with an invalid annotation are not counted
+func countAttachedPods(pods []corev1.Pod, network types.NamespacedName) int32 {
+	var attached int32
+	for i := range pods {
+		pod := &pods[i]
+		if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		networks, err := getPodNetworks(pod)
+		if err != nil {
+			continue
+		}
+		for _, selected := range networks {
+			if selected == network {
+				attached++
+				break
+			}
+		}
+	}
+	return attached
+}
+
+// getPodNetworks returns the networks selected by the network attachment annotation of the pod, either a JSON list
+// of network selection elements or a comma separated list of "namespace/name@interface". Networks selected without
+// namespace are in the namespace of the pod.
+func getPodNetworks(pod *corev1.Pod) ([]types.NamespacedName, error) {
+	annotation := strings.TrimSpace(pod.Annotations[netattdefv1.NetworkAttachmentAnnot])
+	if annotation == "" {
+		return nil, nil
+	}
+	var elements []netattdefv1.NetworkSelectionElement
+	if strings.HasPrefix(annotation, "[") {
+		if err := json.Unmarshal([]byte(annotation), &elements); err != nil {
+			return nil, err
+		}
+	} else {
+		for _, item := range strings.Split(annotation, ",") {
+			element := netattdefv1.NetworkSelectionElement{Name: strings.TrimSpace(item)}
+			if i := strings.Index(element.Name, "/"); i >= 0 {
+				element.Namespace, element.Name = element.Name[:i], element.Name[i+1:]
+			}
+			element.Name = strings.SplitN(element.Name, "@", 2)[0]
+			elements = append(elements, element)
+		}
+	}
+	networks := make([]types.NamespacedName, 0, len(elements))
+	for _, element := range elements {
+		namespace := element.Namespace
+		if namespace == "" {
+			namespace = pod.Namespace
+		}
+		networks = append(networks, types.NamespacedName{Namespace: namespace, Name: element.Name})
+	}
+	return networks, nil
+}
+
 //nolint:dupl
 // SetupWithManager sets up the controller with the Manager.
 func (r *HostDeviceNetworkReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	// Create state manager
-	stateManager, err := state.NewManager(mellanoxcomv1alpha1.HostDeviceNetworkCRDName, mgr.GetClient(), mgr.GetScheme())
+	stateManager, err := state.NewManager(mellanoxcomv1alpha1.HostDeviceNetworkCRDName,
+		state.NewStaticClientProvider(mgr.GetClient()), mgr.GetScheme())
 	if err != nil {
 		// Error creating stateManager
 		r.Log.V(consts.LogLevelError).Info("Error creating state manager.", "error:", err)
@@ -142,13 +275,26 @@ func (r *HostDeviceNetworkReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	}
 	r.stateManager = stateManager
 
+	r.queue = &reconcileQueue{}
 	builder := ctrl.NewControllerManagedBy(mgr).
 		For(&mellanoxcomv1alpha1.HostDeviceNetwork{}).
 		// Watch for changes to primary resource HostDeviceNetwork
-		Watches(&source.Kind{Type: &mellanoxcomv1alpha1.HostDeviceNetwork{}}, &handler.EnqueueRequestForObject{})
+		Watches(&source.Kind{Type: &mellanoxcomv1alpha1.HostDeviceNetwork{}}, &handler.EnqueueRequestForObject{}).
+		// Capture the reconcile queue to read its depth
+		Watches(r.queue, &handler.EnqueueRequestForObject{}).
+		// Requeue all the HostDeviceNetworks when the allocatable devices of a node change, to clear or report
+		// the warning of networks without available devices
+		Watches(&source.Kind{Type: &corev1.Node{}},
+			handler.EnqueueRequestsFromMapFunc(r.getHostDeviceNetworkRequests),
+			ctrlbuilder.WithPredicates(predicate.Funcs{
+				UpdateFunc: func(e event.UpdateEvent) bool {
+					return !equality.Semantic.DeepEqual(e.ObjectOld.(*corev1.Node).Status.Allocatable,
+						e.ObjectNew.(*corev1.Node).Status.Allocatable)
+				},
+			}))
 
 	// Watch for changes to secondary resource DaemonSet and requeue the owner HostDeviceNetwork
-	ws := stateManager.GetWatchSources()
+	ws := r.WatchSourceFilter.Filter(stateManager.GetWatchSources())
 	r.Log.V(consts.LogLevelInfo).Info("Watch Sources", "Kind:", ws)
 	for i := range ws {
 		builder = builder.Watches(ws[i], &handler.EnqueueRequestForOwner{
@@ -159,3 +305,18 @@ func (r *HostDeviceNetworkReconciler) SetupWithManager(mgr ctrl.Manager) error {
 
 	return builder.Complete(r)
 }
+
+// getHostDeviceNetworkRequests returns the reconcile requests of all the HostDeviceNetworks
+func (r *HostDeviceNetworkReconciler) getHostDeviceNetworkRequests(client.Object) []reconcile.Request {
+	networks := &mellanoxcomv1alpha1.HostDeviceNetworkList{}
+	if err := r.List(context.TODO(), networks); err != nil {
+		r.Log.V(consts.LogLevelError).Info("Failed to list HostDeviceNetworks", "error:", err)
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(networks.Items))
+	for i := range networks.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{
+			Namespace: networks.Items[i].Namespace, Name: networks.Items[i].Name}})
+	}
+	return requests
+}
@@ -18,8 +18,20 @@ package controllers
 
 import (
 	goctx "context"
+	"os"
 
+	netattdefv1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/cache/informertest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
@@ -27,8 +39,27 @@ import (
 	. "github.com/onsi/gomega"
 
 	mellanoxv1alpha1 "github.com/Mellanox/network-operator/api/v1alpha1"
+	"github.com/Mellanox/network-operator/pkg/state"
 )
 
+// unservedKindsCache is a fake informer cache which, like the informer cache, fails to get the informer of a kind
+// which is not served by the API server
+type unservedKindsCache struct {
+	*informertest.FakeInformers
+	mapper meta.RESTMapper
+}
+
+func (c *unservedKindsCache) GetInformer(ctx goctx.Context, obj client.Object) (cache.Informer, error) {
+	gvk, err := apiutil.GVKForObject(obj, c.Scheme)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := c.mapper.RESTMapping(gvk.GroupKind(), gvk.Version); err != nil {
+		return nil, err
+	}
+	return c.FakeInformers.GetInformer(ctx, obj)
+}
+
 var _ = Describe("HostDeviceNetwork Controller", func() {
 
 	Context("When HostDeviceNetwork CR is created", func() {
@@ -91,4 +122,103 @@ var _ = Describe("HostDeviceNetwork Controller", func() {
 
 		})
 	})
+
+	Context("When pods attach to the HostDeviceNetwork", func() {
+		newPod := func(namespace, name, networks string, phase corev1.PodPhase) corev1.Pod {
+			return corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace:   namespace,
+					Name:        name,
+					Annotations: map[string]string{netattdefv1.NetworkAttachmentAnnot: networks},
+				},
+				Status: corev1.PodStatus{Phase: phase},
+			}
+		}
+
+		It("should count the pods selecting the network", func() {
+			network := types.NamespacedName{Namespace: "tenant", Name: "hostdev-net"}
+			pods := []corev1.Pod{
+				newPod("tenant", "same-namespace", "hostdev-net", corev1.PodRunning),
+				newPod("other", "with-namespace", "tenant/hostdev-net@net1", corev1.PodRunning),
+				newPod("other", "in-list", "macvlan-net, tenant/hostdev-net", corev1.PodPending),
+				newPod("other", "json", `[{"name": "hostdev-net", "namespace": "tenant"}]`, corev1.PodRunning),
+				newPod("tenant", "twice", "hostdev-net@net1,hostdev-net@net2", corev1.PodRunning),
+				newPod("other", "other-namespace", "hostdev-net", corev1.PodRunning),
+				newPod("tenant", "other-network", "macvlan-net", corev1.PodRunning),
+				newPod("tenant", "terminated", "hostdev-net", corev1.PodSucceeded),
+				newPod("tenant", "invalid", `[{"name": `, corev1.PodRunning),
+				newPod("tenant", "no-annotation", "", corev1.PodRunning),
+			}
+			Expect(countAttachedPods(pods, network)).To(Equal(int32(5)))
+		})
+	})
+
+	Context("When the NetworkAttachmentDefinition API is not served", func() {
+		var (
+			wd         string
+			testScheme *runtime.Scheme
+			mapper     *meta.DefaultRESTMapper
+			mgr        ctrl.Manager
+		)
+
+		BeforeEach(func() {
+			// the states load their manifests relative to the working directory
+			var err error
+			wd, err = os.Getwd()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(os.Chdir("..")).To(Succeed())
+
+			testScheme = runtime.NewScheme()
+			Expect(clientgoscheme.AddToScheme(testScheme)).To(Succeed())
+			Expect(mellanoxv1alpha1.AddToScheme(testScheme)).To(Succeed())
+			Expect(netattdefv1.AddToScheme(testScheme)).To(Succeed())
+			mapper = meta.NewDefaultRESTMapper(nil)
+			mapper.Add(mellanoxv1alpha1.GroupVersion.WithKind("HostDeviceNetwork"), meta.RESTScopeRoot)
+			mgr, err = ctrl.NewManager(&rest.Config{Host: "http://127.0.0.1:1"}, ctrl.Options{
+				Scheme:             testScheme,
+				MetricsBindAddress: "0",
+				MapperProvider:     func(*rest.Config) (meta.RESTMapper, error) { return mapper, nil },
+				NewCache: func(*rest.Config, cache.Options) (cache.Cache, error) {
+					return &unservedKindsCache{
+						FakeInformers: &informertest.FakeInformers{Scheme: testScheme},
+						mapper:        mapper,
+					}, nil
+				},
+			})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			Expect(os.Chdir(wd)).To(Succeed())
+		})
+
+		startManager := func(reconciler *HostDeviceNetworkReconciler) (goctx.CancelFunc, chan error) {
+			reconciler.Client = mgr.GetClient()
+			reconciler.Log = ctrl.Log.WithName("controllers").WithName("HostDeviceNetwork")
+			reconciler.Scheme = testScheme
+			Expect(reconciler.SetupWithManager(mgr)).To(Succeed())
+			ctx, cancel := goctx.WithCancel(goctx.Background())
+			errs := make(chan error, 1)
+			go func() {
+				errs <- mgr.Start(ctx)
+			}()
+			return cancel, errs
+		}
+
+		It("Should not watch NetworkAttachmentDefinitions and still start the controller", func() {
+			cancel, errs := startManager(&HostDeviceNetworkReconciler{
+				WatchSourceFilter: state.NewWatchSourceFilter(mapper, testScheme, nil),
+			})
+			Consistently(errs, "1s").ShouldNot(Receive())
+			cancel()
+			Eventually(errs, "5s").Should(Receive(BeNil()))
+		})
+		It("Should fail to start the controller if all the watch sources are registered", func() {
+			cancel, errs := startManager(&HostDeviceNetworkReconciler{})
+			defer cancel()
+			var err error
+			Eventually(errs, "5s").Should(Receive(&err))
+			Expect(err).To(MatchError(ContainSubstring("NetworkAttachmentDefinition")))
+		})
+	})
 })
@@ -18,12 +18,13 @@ package controllers //nolint:dupl
 
 import (
 	"context"
-	"time"
 
 	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel/attribute"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
@@ -33,10 +34,11 @@ import (
 	netattdefv1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
 
 	mellanoxcomv1alpha1 "github.com/Mellanox/network-operator/api/v1alpha1"
-	"github.com/Mellanox/network-operator/pkg/config"
 	"github.com/Mellanox/network-operator/pkg/consts"
 	"github.com/Mellanox/network-operator/pkg/state"
+	"github.com/Mellanox/network-operator/pkg/tracing"
 	"github.com/Mellanox/network-operator/pkg/utils"
+	"github.com/Mellanox/network-operator/pkg/validation"
 )
 
 // MacvlanNetworkReconciler reconciles a MacvlanNetwork object
@@ -44,8 +46,17 @@ type MacvlanNetworkReconciler struct {
 	client.Client
 	Log    logr.Logger
 	Scheme *runtime.Scheme
+	// Recorder records the Events of the states, no Events are recorded if not set
+	Recorder record.EventRecorder
+	// AdaptiveRequeue scales the requeue delay of resources which are not ready with the depth of the reconcile queue
+	AdaptiveRequeue bool
+	// WatchSourceFilter selects the watch sources of the states registered by the controller, all the watch sources
+	// are registered if not set
+	WatchSourceFilter *state.WatchSourceFilter
 
 	stateManager state.Manager
+	// queue is the reconcile queue of the controller, its depth scales the requeue delay with adaptive requeue
+	queue *reconcileQueue
 }
 
 // +kubebuilder:rbac:groups=mellanox.com,resources=macvlannetworks,verbs=get;list;watch;create;update;patch;delete
@@ -57,6 +68,10 @@ type MacvlanNetworkReconciler struct {
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
 func (r *MacvlanNetworkReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	ctx, span := tracing.StartSpan(ctx, "MacvlanNetwork.Reconcile", attribute.String("name", req.Name),
+		attribute.String("namespace", req.Namespace))
+	defer span.End()
+
 	reqLogger := r.Log.WithValues("macvlannetwork", req.NamespacedName)
 	reqLogger.Info("Reconciling MacvlanNetwork")
 
@@ -74,7 +89,16 @@ func (r *MacvlanNetworkReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 		return reconcile.Result{}, err
 	}
 
-	managerStatus, err := r.stateManager.SyncState(instance, nil)
+	if err := validation.Validate(mellanoxcomv1alpha1.MacvlanNetworkCRDName, instance); err != nil {
+		// Resources admitted while the webhook server was not reachable are rejected on reconcile
+		reqLogger.Info("Invalid MacvlanNetwork", "error", err)
+		instance.Status.State = mellanoxcomv1alpha1.StateError
+		instance.Status.Reason = err.Error()
+		return reconcile.Result{}, r.Status().Update(context.TODO(), instance)
+	}
+
+	syncCtx := state.WithSyncPhaseTimer(withEventRecorder(ctx, r.Recorder), observeSyncPhase)
+	managerStatus, err := r.stateManager.SyncState(syncCtx, instance, nil)
 	r.updateCrStatus(instance, managerStatus, err)
 	if err != nil {
 		return reconcile.Result{}, err
@@ -82,7 +106,7 @@ func (r *MacvlanNetworkReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 
 	if managerStatus.Status != state.SyncStateReady {
 		return reconcile.Result{
-			RequeueAfter: time.Duration(config.FromEnv().Controller.RequeueTimeSeconds) * time.Second,
+			RequeueAfter: getRequeueDelay(r.queue, r.AdaptiveRequeue),
 		}, nil
 	}
 
@@ -120,11 +144,12 @@ func (r *MacvlanNetworkReconciler) updateCrStatus(cr *mellanoxcomv1alpha1.Macvla
 	}
 }
 
-// SetupWithManager sets up the controller with the Manager.
 //nolint:dupl
+// SetupWithManager sets up the controller with the Manager.
 func (r *MacvlanNetworkReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	// Create state manager
-	stateManager, err := state.NewManager(mellanoxcomv1alpha1.MacvlanNetworkCRDName, mgr.GetClient(), mgr.GetScheme())
+	stateManager, err := state.NewManager(mellanoxcomv1alpha1.MacvlanNetworkCRDName,
+		state.NewStaticClientProvider(mgr.GetClient()), mgr.GetScheme())
 	if err != nil {
 		// Error creating stateManager
 		r.Log.V(consts.LogLevelError).Info("Error creating state manager.", "error:", err)
@@ -132,13 +157,16 @@ func (r *MacvlanNetworkReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	}
 	r.stateManager = stateManager
 
+	r.queue = &reconcileQueue{}
 	builder := ctrl.NewControllerManagedBy(mgr).
 		For(&mellanoxcomv1alpha1.MacvlanNetwork{}).
 		// Watch for changes to primary resource MacvlanNetwork
-		Watches(&source.Kind{Type: &mellanoxcomv1alpha1.MacvlanNetwork{}}, &handler.EnqueueRequestForObject{})
+		Watches(&source.Kind{Type: &mellanoxcomv1alpha1.MacvlanNetwork{}}, &handler.EnqueueRequestForObject{}).
+		// Capture the reconcile queue to read its depth
+		Watches(r.queue, &handler.EnqueueRequestForObject{})
 
 	// Watch for changes to secondary resource DaemonSet and requeue the owner MacvlanNetwork
-	ws := stateManager.GetWatchSources()
+	ws := r.WatchSourceFilter.Filter(stateManager.GetWatchSources())
 	r.Log.V(consts.LogLevelInfo).Info("Watch Sources", "Kind:", ws)
 	for i := range ws {
 		builder = builder.Watches(ws[i], &handler.EnqueueRequestForOwner{
@@ -19,18 +19,27 @@ package controllers
 import (
 	"context"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
 	corev1 "k8s.io/api/core/v1"
 	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	ctrlbuilder "sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	"sigs.k8s.io/controller-runtime/pkg/source"
 
@@ -39,15 +48,68 @@ import (
 	"github.com/Mellanox/network-operator/pkg/consts"
 	"github.com/Mellanox/network-operator/pkg/nodeinfo"
 	"github.com/Mellanox/network-operator/pkg/state"
+	"github.com/Mellanox/network-operator/pkg/tracing"
+	"github.com/Mellanox/network-operator/pkg/validation"
 )
 
+// maxMaintenanceRequeueDelay is the maximal delay between reconcile requests while transient API errors are tolerated
+const maxMaintenanceRequeueDelay = 5 * time.Minute
+
 // NicClusterPolicyReconciler reconciles a NicClusterPolicy object
 type NicClusterPolicyReconciler struct {
 	client.Client
 	Log    logr.Logger
 	Scheme *runtime.Scheme
+	// ClientProvider provides the client states use to reconcile the NicClusterPolicy,
+	// the manager client is used if not set
+	ClientProvider state.ClientProvider
+	// PolicySelector selects the NicClusterPolicies reconciled by the controller, others are ignored.
+	// All NicClusterPolicies are reconciled if not set
+	PolicySelector labels.Selector
+	// Recorder records the Events of the states and of the deprecated fields, no Events are recorded if not set
+	Recorder record.EventRecorder
+	// ResourceLimitsMode controls whether rendered containers must have resource limits, permissive if not set
+	ResourceLimitsMode state.ResourceLimitsMode
+	// SyncCache skips the Sync of states whose inputs did not change since their last ready Sync, states are
+	// synced on every reconcile if not set
+	SyncCache *state.SyncCache
+	// ReconcileSkip skips the reconcile of a ready NicClusterPolicy whose generation was already reconciled, unless
+	// an object watched by the states changed since the last full reconcile
+	ReconcileSkip bool
+	// AdaptiveRequeue scales the requeue delay of resources which are not ready with the depth of the reconcile queue
+	AdaptiveRequeue bool
+	// StatusConfigMapNamespace is the namespace of the ConfigMap summarizing the NicClusterPolicy status, the
+	// ConfigMap is not written if not set
+	StatusConfigMapNamespace string
+	// ReconcileReportTarget is the file or http(s) endpoint the JSON reconcile report is written to after each full
+	// reconcile, no report is written if not set
+	ReconcileReportTarget string
+	// WatchSourceFilter selects the watch sources of the states registered by the controller, all the watch sources
+	// are registered if not set
+	WatchSourceFilter *state.WatchSourceFilter
+	// PruneOnDelete deletes the objects labeled as owned by the operator and controlled by the NicClusterPolicy once
+	// it is deleted
+	PruneOnDelete bool
+	// StateRateLimits throttle the Sync of the states keyed by state name, states are not throttled if not set
+	StateRateLimits map[string]state.StateRateLimit
+	// PolicyScopes are the scopes of the NicClusterPolicies, keyed by policy name, reconciled in addition to the
+	// NicClusterPolicy with the predefined name. Their device plugins are confined to the nodes and namespace of
+	// their scope. Only the NicClusterPolicy with the predefined name is reconciled if not set
+	PolicyScopes map[string]state.PolicyScope
+	// RenderWorkers is the number of node groups rendered concurrently by a state, node groups are rendered serially
+	// if lower than 2
+	RenderWorkers int
 
 	stateManager state.Manager
+	// queue is the reconcile queue of the controller, its depth scales the requeue delay with adaptive requeue
+	queue *reconcileQueue
+	// resourcesCache caches the ConfigMaps and Secrets of the operator resources namespace, the external render data
+	// sources are read from it if set
+	resourcesCache cache.Cache
+	// watchSources are the sources of the objects watched by the states
+	watchSources []*source.Kind
+	// watched records the inputs observed by the last full reconcile
+	watched watchedObjects
 }
 
 //nolint
@@ -58,21 +120,29 @@ type NicClusterPolicyReconciler struct {
 // +kubebuilder:rbac:groups=policy,resources=podsecuritypolicies,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=events.k8s.io,resources=events,verbs=create;patch;update
 // +kubebuilder:rbac:groups="",resources=namespaces;serviceaccounts;pods;pods/status;services;services/finalizers;endpoints,verbs=get;list;watch;create;update;patch;delete
-// +kubebuilder:rbac:groups="",resources=persistentvolumeclaims;events;configmaps;secrets,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups="",resources=persistentvolumeclaims;events;configmaps;secrets;resourcequotas,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups="",resources=nodes,verbs=get;list;watch;update;patch
 // +kubebuilder:rbac:groups="",resources=pods,verbs=list
 // +kubebuilder:rbac:groups=apps,resources=deployments;daemonsets;replicasets;statefulsets,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=apps,resources=deployments/finalizers,verbs=update
-// +kubebuilder:rbac:groups=monitoring.coreos.com,resources=servicemonitors,verbs=get;list;watch;create
+// +kubebuilder:rbac:groups=monitoring.coreos.com,resources=servicemonitors,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=apiextensions.k8s.io,resources=customresourcedefinitions,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=whereabouts.cni.cncf.io,resources=ippools,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=whereabouts.cni.cncf.io,resources=overlappingrangeipreservations,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=coordination.k8s.io,resources=leases,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=batch,resources=cronjobs,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=nfd.k8s-sigs.io,resources=nodefeaturerules,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=scheduling.k8s.io,resources=priorityclasses,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=admissionregistration.k8s.io,resources=mutatingwebhookconfigurations,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=admissionregistration.k8s.io,resources=validatingwebhookconfigurations,verbs=get;list;watch;create;update;patch;delete
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
 func (r *NicClusterPolicyReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	ctx, span := tracing.StartSpan(ctx, "NicClusterPolicy.Reconcile", attribute.String("name", req.Name),
+		attribute.String("namespace", req.Namespace))
+	defer span.End()
+
 	reqLogger := r.Log.WithValues("nicclusterpolicy", req.NamespacedName)
 	reqLogger.V(consts.LogLevelInfo).Info("Reconciling NicClusterPolicy")
 
@@ -84,6 +154,9 @@ func (r *NicClusterPolicyReconciler) Reconcile(ctx context.Context, req ctrl.Req
 			// Request object not found, could have been deleted after reconcile request.
 			// Owned objects are automatically garbage collected. For additional cleanup logic use finalizers.
 			// Return and don't requeue
+			if r.PruneOnDelete && req.Name == consts.NicClusterPolicyResourceName {
+				return reconcile.Result{}, r.prune(ctx, req.Name, reqLogger)
+			}
 			return reconcile.Result{}, nil
 		}
 		// Error reading the object - requeue the request.
@@ -91,59 +164,222 @@ func (r *NicClusterPolicyReconciler) Reconcile(ctx context.Context, req ctrl.Req
 		return reconcile.Result{}, err
 	}
 
-	if req.Name != consts.NicClusterPolicyResourceName {
+	if !r.isSelected(instance) {
+		// Owned objects of a NicClusterPolicy which is not selected may still trigger a reconcile
+		reqLogger.V(consts.LogLevelDebug).Info("NicClusterPolicy does not match policy selector, ignoring",
+			"selector", r.PolicySelector.String())
+		return reconcile.Result{}, nil
+	}
+
+	_, scoped := r.PolicyScopes[req.Name]
+	if req.Name != consts.NicClusterPolicyResourceName && !scoped {
 		err := r.handleUnsupportedInstance(instance, req, reqLogger)
 		return reconcile.Result{}, err
 	}
+	if scoped {
+		if err := state.ValidateScopedPolicy(instance); err != nil {
+			return reconcile.Result{}, r.handleInvalidInstance(instance, err, reqLogger)
+		}
+	}
+
+	if err := validation.Validate(mellanoxv1alpha1.NicClusterPolicyCRDName, instance); err != nil {
+		// Resources admitted while the webhook server was not reachable are rejected on reconcile
+		return reconcile.Result{}, r.handleInvalidInstance(instance, err, reqLogger)
+	}
+
+	var externalRenderDataReader client.Reader = r.Client
+	if r.resourcesCache != nil {
+		externalRenderDataReader = r.resourcesCache
+	}
+	externalRenderData, err := state.ResolveExternalRenderData(ctx, externalRenderDataReader, instance)
+	if err != nil {
+		reqLogger.V(consts.LogLevelWarning).Info("Failed to resolve external render data", "error:", err)
+		return r.handleUnresolvedReference(ctx, instance, err, reqLogger)
+	}
 
-	// Create a new State service catalog
-	sc := state.NewInfoCatalog()
-	if instance.Spec.OFEDDriver != nil || instance.Spec.NVPeerDriver != nil ||
-		instance.Spec.RdmaSharedDevicePlugin != nil || instance.Spec.SriovDevicePlugin != nil {
-		// Create node infoProvider and add to the service catalog
-		reqLogger.V(consts.LogLevelInfo).Info("Creating Node info provider")
-		nodeList := &corev1.NodeList{}
-		err = r.List(context.TODO(), nodeList, nodeinfo.MellanoxNICListOptions...)
+	// The states must restore the objects they watch once changed, the reconcile is skipped and the cached results
+	// of the states are reused only while the observed inputs do not change
+	// The watched objects and the cached results are recorded for the NicClusterPolicy with the predefined name only,
+	// scoped NicClusterPolicies are always fully reconciled
+	syncCache := r.SyncCache
+	if scoped {
+		syncCache = nil
+	}
+	var watched, observed string
+	if !scoped && (r.SyncCache != nil || r.ReconcileSkip) {
+		watched, observed, err = r.getObservedFingerprint(ctx, externalRenderData)
 		if err != nil {
-			// Failed to get node list
-			reqLogger.V(consts.LogLevelError).Info("Error occurred on LIST nodes request from API server.", "error:", err)
-			return reconcile.Result{}, err
+			reqLogger.V(consts.LogLevelWarning).Info("Failed to fingerprint the watched objects, syncing all states",
+				"error:", err)
+			syncCache = nil
 		}
-		nodePtrList := make([]*corev1.Node, len(nodeList.Items))
-		nodeNames := make([]*string, len(nodeList.Items))
-		for i := range nodePtrList {
-			nodePtrList[i] = &nodeList.Items[i]
-			nodeNames[i] = &nodeList.Items[i].Name
-		}
-		reqLogger.V(consts.LogLevelDebug).Info("Node info provider with", "Nodes:", nodeNames)
-		infoProvider := nodeinfo.NewProvider(nodePtrList)
-		sc.Add(state.InfoTypeNodeInfo, infoProvider)
 	}
+	if r.isReconciled(instance, observed) {
+		reqLogger.V(consts.LogLevelDebug).Info("NicClusterPolicy generation already reconciled, skipping sync",
+			"generation", instance.Generation)
+		// the status is up to date, only refresh the metrics derived from it
+		setWorkloadReadyMetrics(instance)
+		return ctrl.Result{}, nil
+	}
+
+	// Resolve image pull secrets referenced through ServiceAccounts on a copy and create the State service catalog
+	syncInstance, sc, err := state.PrepareSync(ctx, r.Client, instance, externalRenderData)
+	if err != nil {
+		reqLogger.V(consts.LogLevelWarning).Info("Failed to resolve image pull secrets", "error:", err)
+		// the referenced ServiceAccount is not watched, check again later
+		return r.handleUnresolvedReference(ctx, instance, err, reqLogger)
+	}
+
 	// Create manager
-	managerStatus, err := r.stateManager.SyncState(instance, sc)
+	syncCtx := state.WithResourceLimitsMode(withEventRecorder(ctx, r.Recorder),
+		r.ResourceLimitsMode)
+	syncCtx = state.WithSyncCache(syncCtx, syncCache, watched)
+	syncCtx = state.WithSyncPhaseTimer(syncCtx, observeSyncPhase)
+	syncCtx = state.WithPolicyScopes(syncCtx, instance.Name, r.PolicyScopes)
+	syncCtx = state.WithRenderWorkers(syncCtx, r.RenderWorkers)
+	if !scoped {
+		r.watched.startSync(observed)
+	}
+	syncStart := time.Now()
+	managerStatus, err := r.stateManager.SyncState(syncCtx, syncInstance, sc)
 
 	if err != nil {
 		reqLogger.V(consts.LogLevelWarning).Info("Error occurred while syncing states", "error:", err)
 	}
 
+	// Tolerate transient API errors, e.g during a control plane upgrade, instead of flipping states to error
+	managerStatus, tolerated := state.TolerateTransientErrors(managerStatus, getAppliedStates(instance))
+	setMaintenanceCondition(instance, tolerated)
+	if err == nil && managerStatus.Status == state.SyncStateReady {
+		instance.Status.ObservedGeneration = instance.Generation
+	}
+	if r.ReconcileReportTarget != "" {
+		report := state.NewReconcileReport(instance.Name, syncStart, managerStatus)
+		err = state.WriteReconcileReport(ctx, r.ReconcileReportTarget, report)
+		if err != nil {
+			reqLogger.V(consts.LogLevelError).Info("Failed to write reconcile report", "error:", err)
+		}
+	}
+
 	r.updateCrStatus(instance, managerStatus)
+	resyncAfter := managerStatus.ResyncAfter()
+	if scoped {
+		// the status ConfigMap and the OFED node labels are those of the NicClusterPolicy with the predefined name
+		return r.getRequeueResult(managerStatus, tolerated, instance, resyncAfter), nil
+	}
+	r.watched.resyncAfter(resyncAfter)
+
+	if r.StatusConfigMapNamespace != "" {
+		err = updateStatusConfigMap(ctx, r.Client, r.Scheme, r.StatusConfigMapNamespace, instance)
+		if err != nil {
+			reqLogger.V(consts.LogLevelError).Info("Failed to update status ConfigMap", "error:", err)
+		}
+	}
 
 	err = r.updateNodeLabels(instance)
 	if err != nil {
 		return reconcile.Result{}, err
 	}
+	return r.getRequeueResult(managerStatus, tolerated, instance, resyncAfter), nil
+}
+
+// getRequeueResult returns the result of the reconcile of cr according to the status of its states
+func (r *NicClusterPolicyReconciler) getRequeueResult(managerStatus state.Results, tolerated map[string]error,
+	cr *mellanoxv1alpha1.NicClusterPolicy, resyncAfter time.Duration) ctrl.Result {
+
+	if len(tolerated) != 0 {
+		return reconcile.Result{RequeueAfter: getMaintenanceRequeueDelay(cr)}
+	}
 
 	if managerStatus.Status != state.SyncStateReady {
 		return reconcile.Result{
-			RequeueAfter: time.Duration(config.FromEnv().Controller.RequeueTimeSeconds) * time.Second,
-		}, nil
+			RequeueAfter: getRequeueDelay(r.queue, r.AdaptiveRequeue),
+		}
+	}
+
+	// ready states may still need to be synced again later, e.g to rotate a certificate
+	return ctrl.Result{RequeueAfter: resyncAfter}
+}
+
+// prune deletes the objects labeled as owned by the operator and controlled by the deleted NicClusterPolicy name
+// without waiting for the garbage collector. Objects controlled by other custom resources, e.g the
+// NetworkAttachmentDefinitions of HostDeviceNetworks or the objects of scoped NicClusterPolicies, are kept.
+func (r *NicClusterPolicyReconciler) prune(ctx context.Context, name string, reqLogger logr.Logger) error {
+	kinds, err := state.GetManifestKinds(config.FromEnv().State.ManifestBaseDir)
+	if err != nil {
+		return errors.Wrap(err, "failed to get the kinds of the objects to prune")
+	}
+	deleted, err := state.Prune(withEventRecorder(ctx, r.Recorder), r.Client,
+		state.PruneOptions{Confirm: true, Kinds: kinds, ControlledBy: &metav1.OwnerReference{
+			APIVersion: mellanoxv1alpha1.GroupVersion.String(),
+			Kind:       mellanoxv1alpha1.NicClusterPolicyCRDName,
+			Name:       name,
+		}})
+	if err != nil {
+		return errors.Wrap(err, "failed to prune objects of the deleted NicClusterPolicy")
+	}
+	reqLogger.V(consts.LogLevelInfo).Info("Pruned objects of the deleted NicClusterPolicy", "objects", deleted)
+	return nil
+}
+
+// getAppliedStates returns the status of the applied states keyed by state name
+func getAppliedStates(cr *mellanoxv1alpha1.NicClusterPolicy) map[string]state.SyncState {
+	appliedStates := make(map[string]state.SyncState, len(cr.Status.AppliedStates))
+	for _, appliedState := range cr.Status.AppliedStates {
+		appliedStates[appliedState.Name] = state.SyncState(appliedState.State)
+	}
+	return appliedStates
+}
+
+// setMaintenanceCondition sets the Maintenance condition while transient API errors are tolerated, the condition
+// is removed once states sync without transient API errors
+func setMaintenanceCondition(cr *mellanoxv1alpha1.NicClusterPolicy, tolerated map[string]error) {
+	if len(tolerated) == 0 {
+		removeStatusCondition(&cr.Status.Conditions, mellanoxv1alpha1.ConditionTypeMaintenance)
+		return
 	}
+	messages := make([]string, 0, len(tolerated))
+	for stateName, err := range tolerated {
+		messages = append(messages, fmt.Sprintf("%s: %s", stateName, err.Error()))
+	}
+	sort.Strings(messages)
+	meta.SetStatusCondition(&cr.Status.Conditions, metav1.Condition{
+		Type:               mellanoxv1alpha1.ConditionTypeMaintenance,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: cr.Generation,
+		Reason:             "TransientAPIErrors",
+		Message:            "Tolerating transient API errors until the API server is stable: " + strings.Join(messages, "; "),
+	})
+}
 
-	return ctrl.Result{}, nil
+// removeStatusCondition removes the condition of conditionType from conditions, if any. The meta helper panics on
+// empty conditions in the vendored apimachinery version.
+func removeStatusCondition(conditions *[]metav1.Condition, conditionType string) {
+	if meta.FindStatusCondition(*conditions, conditionType) == nil {
+		return
+	}
+	meta.RemoveStatusCondition(conditions, conditionType)
+}
+
+// getMaintenanceRequeueDelay backs off reconcile requests while in maintenance, the delay grows with the time spent
+// in maintenance, from the controller requeue time up to maxMaintenanceRequeueDelay
+func getMaintenanceRequeueDelay(cr *mellanoxv1alpha1.NicClusterPolicy) time.Duration {
+	delay := time.Duration(config.FromEnv().Controller.RequeueTimeSeconds) * time.Second
+	if cond := meta.FindStatusCondition(cr.Status.Conditions, mellanoxv1alpha1.ConditionTypeMaintenance); cond != nil {
+		if inMaintenance := time.Since(cond.LastTransitionTime.Time); inMaintenance > delay {
+			delay = inMaintenance
+		}
+	}
+	if delay > maxMaintenanceRequeueDelay {
+		delay = maxMaintenanceRequeueDelay
+	}
+	return delay
 }
 
 // updateNodeLabels updates nodes labels to mark device plugins should wait for OFED pod
 // Set nvidia.com/ofed.wait=false if OFED is not deployed.
+// Nodes where the OFED pod verified the OFED kernel modules are loaded, with its readiness probe, are annotated with
+// the OFED driver version, device plugins are only deployed on annotated nodes.
 func (r *NicClusterPolicyReconciler) updateNodeLabels(cr *mellanoxv1alpha1.NicClusterPolicy) error {
 	if cr.Spec.OFEDDriver != nil {
 		pods := &corev1.PodList{}
@@ -152,12 +388,15 @@ func (r *NicClusterPolicyReconciler) updateNodeLabels(cr *mellanoxv1alpha1.NicCl
 		for i := range pods.Items {
 			pod := pods.Items[i]
 			labelValue := "true"
+			modulesLoaded := "null"
 			// We assume that OFED pod contains only one container to simplify the logic.
 			// We can revisit this logic in the future if needed
 			if len(pod.Status.ContainerStatuses) != 0 && pod.Status.ContainerStatuses[0].Ready {
 				labelValue = "false"
+				modulesLoaded = fmt.Sprintf("%q", cr.Spec.OFEDDriver.Version)
 			}
-			patch := []byte(fmt.Sprintf(`{"metadata":{"labels":{"%s":"%s"}}}`, nodeinfo.NodeLabelWaitOFED, labelValue))
+			patch := []byte(fmt.Sprintf(`{"metadata":{"labels":{"%s":"%s"},"annotations":{"%s":%s}}}`,
+				nodeinfo.NodeLabelWaitOFED, labelValue, nodeinfo.NodeAnnotationOFEDModulesLoaded, modulesLoaded))
 			err := r.Client.Patch(context.TODO(), &corev1.Node{
 				ObjectMeta: metav1.ObjectMeta{
 					Name: pod.Spec.NodeName,
@@ -193,19 +432,33 @@ func (r *NicClusterPolicyReconciler) updateCrStatus(cr *mellanoxv1alpha1.NicClus
 NextResult:
 	for _, stateStatus := range status.StatesStatus {
 		// basically iterate over results and add/update crStatus.AppliedStates
+		appliedState := mellanoxv1alpha1.AppliedState{
+			Name:         stateStatus.StateName,
+			State:        mellanoxv1alpha1.State(stateStatus.Status),
+			Hint:         state.GetRemediationHint(stateStatus.ErrInfo),
+			SkippedNodes: stateStatus.SkippedNodes,
+			Workloads:    getWorkloadStatuses(stateStatus.Workloads),
+			NodeModes:    getNodeModes(stateStatus.NodeModes),
+			OSGroups:     getOSGroups(stateStatus.OSGroups),
+		}
+		if stateStatus.ErrInfo != nil {
+			appliedState.Message = stateStatus.ErrInfo.Error()
+		}
 		for i := range cr.Status.AppliedStates {
 			if cr.Status.AppliedStates[i].Name == stateStatus.StateName {
-				cr.Status.AppliedStates[i].State = mellanoxv1alpha1.State(stateStatus.Status)
+				cr.Status.AppliedStates[i] = appliedState
 				continue NextResult
 			}
 		}
-		cr.Status.AppliedStates = append(cr.Status.AppliedStates, mellanoxv1alpha1.AppliedState{
-			Name:  stateStatus.StateName,
-			State: mellanoxv1alpha1.State(stateStatus.Status),
-		})
+		cr.Status.AppliedStates = append(cr.Status.AppliedStates, appliedState)
 	}
 	// Update global State
 	cr.Status.State = mellanoxv1alpha1.State(status.Status)
+	deprecations := lintDeprecatedFields(r.Recorder, mellanoxv1alpha1.NicClusterPolicyCRDName, cr, r.Log)
+	setWarningCondition(&cr.Status.Conditions, cr.Generation, status, deprecations)
+	setNoEligibleNodesCondition(&cr.Status.Conditions, cr.Generation, status)
+	setWorkloadReadyMetrics(cr)
+	r.setInstallComplete(cr, status)
 
 	// send status update request to k8s API
 	r.Log.V(consts.LogLevelInfo).Info(
@@ -216,6 +469,120 @@ NextResult:
 	}
 }
 
+// setInstallComplete records the time all the enabled states of cr are first ready in its status along with the
+// InstallComplete Event, later reconciles where the states are ready again do not record it
+func (r *NicClusterPolicyReconciler) setInstallComplete(cr *mellanoxv1alpha1.NicClusterPolicy, status state.Results) {
+	if status.Status != state.SyncStateReady || cr.Status.InstallCompleteTime != nil {
+		return
+	}
+	now := metav1.Now()
+	cr.Status.InstallCompleteTime = &now
+	if r.Recorder != nil {
+		r.Recorder.Event(cr, corev1.EventTypeNormal, state.EventReasonInstallComplete, "All enabled states are ready")
+	}
+}
+
+// getNodeModes returns the modes reported by a state sorted by node name
+func getNodeModes(modes map[string]string) []mellanoxv1alpha1.NodeMode {
+	if len(modes) == 0 {
+		return nil
+	}
+	nodeModes := make([]mellanoxv1alpha1.NodeMode, 0, len(modes))
+	for node, mode := range modes {
+		nodeModes = append(nodeModes, mellanoxv1alpha1.NodeMode{Node: node, Mode: mode})
+	}
+	sort.Slice(nodeModes, func(i, j int) bool { return nodeModes[i].Node < nodeModes[j].Node })
+	return nodeModes
+}
+
+// getOSGroups returns the OS distributions of the nodes reported by a state
+func getOSGroups(groups []state.OSGroup) []mellanoxv1alpha1.OSGroup {
+	if len(groups) == 0 {
+		return nil
+	}
+	osGroups := make([]mellanoxv1alpha1.OSGroup, 0, len(groups))
+	for _, group := range groups {
+		osGroups = append(osGroups, mellanoxv1alpha1.OSGroup{
+			OSName: group.OSName, OSVersion: group.OSVer, Nodes: group.Nodes})
+	}
+	return osGroups
+}
+
+// withEventRecorder returns a context recording the Events of the states with recorder, ctx is returned as is if
+// recorder is not set
+func withEventRecorder(ctx context.Context, recorder record.EventRecorder) context.Context {
+	if recorder == nil {
+		return ctx
+	}
+	return state.WithEventRecorder(ctx, recorder)
+}
+
+// lintDeprecatedFields records a Warning Event on obj, a custom resource of the given kind, for each deprecated field
+// it uses and returns the warnings. No Events are recorded if recorder is not set.
+func lintDeprecatedFields(recorder record.EventRecorder, kind string, obj runtime.Object, log logr.Logger) []string {
+	deprecations, err := validation.Deprecations(kind, obj)
+	if err != nil {
+		log.V(consts.LogLevelWarning).Info("Failed to check deprecated fields", "error:", err)
+		return nil
+	}
+	if recorder != nil {
+		for _, deprecation := range deprecations {
+			recorder.Event(obj, corev1.EventTypeWarning, validation.EventReasonDeprecatedField, deprecation)
+		}
+	}
+	return deprecations
+}
+
+// setWarningCondition sets the Warning condition with the deprecated fields used by the custom resource and the
+// warnings reported by the states, the condition is removed if there are no warnings
+func setWarningCondition(conditions *[]metav1.Condition, generation int64, status state.Results,
+	deprecations []string) {
+	warnings := append([]string{}, deprecations...)
+	for _, stateStatus := range status.StatesStatus {
+		for _, warning := range stateStatus.Warnings {
+			warnings = append(warnings, fmt.Sprintf("%s: %s", stateStatus.StateName, warning))
+		}
+	}
+	if len(warnings) == 0 {
+		removeStatusCondition(conditions, mellanoxv1alpha1.ConditionTypeWarning)
+		return
+	}
+	reason := "StatesReportedWarnings"
+	if len(warnings) == len(deprecations) {
+		reason = "DeprecatedFieldsUsed"
+	}
+	meta.SetStatusCondition(conditions, metav1.Condition{
+		Type:               mellanoxv1alpha1.ConditionTypeWarning,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: generation,
+		Reason:             reason,
+		Message:            strings.Join(warnings, "; "),
+	})
+}
+
+// setNoEligibleNodesCondition sets the NoEligibleNodes condition with the node filters of the states which found no
+// nodes matching them, the condition is removed once all the states find eligible nodes
+func setNoEligibleNodesCondition(conditions *[]metav1.Condition, generation int64, status state.Results) {
+	var filters []string
+	for _, stateStatus := range status.StatesStatus {
+		if stateStatus.NoEligibleNodesFilter != "" {
+			filters = append(filters, fmt.Sprintf("%s: %s", stateStatus.StateName, stateStatus.NoEligibleNodesFilter))
+		}
+	}
+	if len(filters) == 0 {
+		removeStatusCondition(conditions, mellanoxv1alpha1.ConditionTypeNoEligibleNodes)
+		return
+	}
+	sort.Strings(filters)
+	meta.SetStatusCondition(conditions, metav1.Condition{
+		Type:               mellanoxv1alpha1.ConditionTypeNoEligibleNodes,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: generation,
+		Reason:             "NoNodesMatchFilter",
+		Message:            "no nodes match the node filter of " + strings.Join(filters, "; "),
+	})
+}
+
 func (r *NicClusterPolicyReconciler) handleUnsupportedInstance(instance *mellanoxv1alpha1.NicClusterPolicy,
 	request reconcile.Request, reqLogger logr.Logger) error {
 	reqLogger.V(consts.LogLevelWarning).Info("unsupported NicClusterPolicy instance", "instance name:", request.Name)
@@ -234,11 +601,47 @@ func (r *NicClusterPolicyReconciler) handleUnsupportedInstance(instance *mellano
 	return err
 }
 
+func (r *NicClusterPolicyReconciler) handleInvalidInstance(instance *mellanoxv1alpha1.NicClusterPolicy,
+	validationErr error, reqLogger logr.Logger) error {
+	reqLogger.V(consts.LogLevelWarning).Info("invalid NicClusterPolicy instance", "error:", validationErr)
+
+	instance.Status.State = mellanoxv1alpha1.StateError
+	instance.Status.Reason = validationErr.Error()
+
+	err := r.Status().Update(context.TODO(), instance)
+	if err != nil {
+		r.Log.V(consts.LogLevelError).Info("Failed to update CR status", "error:", err)
+	}
+
+	return err
+}
+
+// handleUnresolvedReference sets the CR state to error when an object referenced by the CR could not be resolved,
+// the reconcile is requeued to check again later
+func (r *NicClusterPolicyReconciler) handleUnresolvedReference(ctx context.Context,
+	instance *mellanoxv1alpha1.NicClusterPolicy, resolveErr error, reqLogger logr.Logger) (ctrl.Result, error) {
+	instance.Status.State = mellanoxv1alpha1.StateError
+	instance.Status.Reason = resolveErr.Error()
+	if err := r.Status().Update(ctx, instance); err != nil {
+		reqLogger.V(consts.LogLevelError).Info("Failed to update CR status", "error:", err)
+		return reconcile.Result{}, err
+	}
+	return reconcile.Result{RequeueAfter: getRequeueDelay(r.queue, r.AdaptiveRequeue)}, nil
+}
+
 // SetupWithManager sets up the controller with the Manager.
 //nolint:dupl
 func (r *NicClusterPolicyReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if r.ClientProvider == nil {
+		r.ClientProvider = state.NewStaticClientProvider(mgr.GetClient())
+	}
 	// Create state manager
-	stateManager, err := state.NewManager(mellanoxv1alpha1.NicClusterPolicyCRDName, mgr.GetClient(), mgr.GetScheme())
+	var opts []state.ManagerOption
+	if len(r.StateRateLimits) != 0 {
+		opts = append(opts, state.WithStateRateLimits(r.StateRateLimits))
+	}
+	stateManager, err := state.NewManager(mellanoxv1alpha1.NicClusterPolicyCRDName, r.ClientProvider,
+		mgr.GetScheme(), opts...)
 	if err != nil {
 		// Error creating stateManager
 		r.Log.V(consts.LogLevelError).Info("Error creating state manager.", "error:", err)
@@ -246,14 +649,21 @@ func (r *NicClusterPolicyReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	}
 	r.stateManager = stateManager
 
+	// Ignore NicClusterPolicies which do not match the policy selector
+	selectedPolicies := ctrlbuilder.WithPredicates(predicate.NewPredicateFuncs(r.isSelected))
+	r.queue = &reconcileQueue{}
 	builder := ctrl.NewControllerManagedBy(mgr).
-		For(&mellanoxv1alpha1.NicClusterPolicy{}).
+		For(&mellanoxv1alpha1.NicClusterPolicy{}, selectedPolicies).
 		// Watch for changes to primary resource NicClusterPolicy
-		Watches(&source.Kind{Type: &mellanoxv1alpha1.NicClusterPolicy{}}, &handler.EnqueueRequestForObject{})
+		Watches(&source.Kind{Type: &mellanoxv1alpha1.NicClusterPolicy{}}, &handler.EnqueueRequestForObject{},
+			selectedPolicies).
+		// Capture the reconcile queue to read its depth
+		Watches(r.queue, &handler.EnqueueRequestForObject{})
 
 	// Watch for changes to secondary resource DaemonSet and requeue the owner NicClusterPolicy
-	ws := stateManager.GetWatchSources()
+	ws := r.WatchSourceFilter.Filter(stateManager.GetWatchSources())
 	r.Log.V(consts.LogLevelInfo).Info("Watch Sources", "Kind:", ws)
+	r.watchSources = ws
 	for i := range ws {
 		builder = builder.Watches(ws[i], &handler.EnqueueRequestForOwner{
 			IsController: true,
@@ -261,5 +671,43 @@ func (r *NicClusterPolicyReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		})
 	}
 
+	// Watch for changes to the external render data sources and requeue the NicClusterPolicy referencing them. The
+	// sources are in the operator resources namespace, only its ConfigMaps and Secrets are cached rather than those
+	// of the whole cluster
+	r.resourcesCache, err = cache.New(mgr.GetConfig(), cache.Options{
+		Scheme:    mgr.GetScheme(),
+		Mapper:    mgr.GetRESTMapper(),
+		Namespace: consts.NetworkOperatorResourceNamespace,
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to create the cache of the operator resources namespace")
+	}
+	if err := mgr.Add(r.resourcesCache); err != nil {
+		return errors.Wrap(err, "failed to add the cache of the operator resources namespace")
+	}
+	externalRenderDataHandler := handler.EnqueueRequestsFromMapFunc(r.getExternalRenderDataRequests)
+	builder = builder.
+		Watches(source.NewKindWithCache(&corev1.ConfigMap{}, r.resourcesCache), externalRenderDataHandler).
+		Watches(source.NewKindWithCache(&corev1.Secret{}, r.resourcesCache), externalRenderDataHandler)
+
 	return builder.Complete(r)
 }
+
+// getExternalRenderDataRequests returns the reconcile request of the NicClusterPolicy if it references the ConfigMap
+// or Secret as external render data
+func (r *NicClusterPolicyReconciler) getExternalRenderDataRequests(obj client.Object) []reconcile.Request {
+	instance := &mellanoxv1alpha1.NicClusterPolicy{}
+	err := r.Get(context.TODO(), types.NamespacedName{Name: consts.NicClusterPolicyResourceName}, instance)
+	if err != nil || !r.isSelected(instance) || !state.IsExternalRenderDataSource(instance, obj) {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: instance.Name}}}
+}
+
+// isSelected checks if the NicClusterPolicy matches the policy selector
+func (r *NicClusterPolicyReconciler) isSelected(obj client.Object) bool {
+	if r.PolicySelector == nil {
+		return true
+	}
+	return r.PolicySelector.Matches(labels.Set(obj.GetLabels()))
+}
@@ -0,0 +1,325 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	goctx "context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	mellanoxv1alpha1 "github.com/Mellanox/network-operator/api/v1alpha1"
+	"github.com/Mellanox/network-operator/pkg/consts"
+	"github.com/Mellanox/network-operator/pkg/nodeinfo"
+	"github.com/Mellanox/network-operator/pkg/state"
+	"github.com/Mellanox/network-operator/pkg/validation"
+)
+
+// countingManager is a state.Manager reporting all states ready and counting its SyncState invocations
+type countingManager struct {
+	syncs int
+}
+
+func (m *countingManager) GetWatchSources() []*source.Kind {
+	return nil
+}
+
+func (m *countingManager) SyncState(goctx.Context, interface{}, state.InfoCatalog) (state.Results, error) {
+	m.syncs++
+	return state.Results{Status: state.SyncStateReady}, nil
+}
+
+var _ = Describe("NicClusterPolicy Controller", func() {
+
+	Context("When a policy selector is set", func() {
+		var (
+			cr         *mellanoxv1alpha1.NicClusterPolicy
+			reconciler *NicClusterPolicyReconciler
+		)
+
+		BeforeEach(func() {
+			cr = &mellanoxv1alpha1.NicClusterPolicy{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   consts.NicClusterPolicyResourceName,
+					Labels: map[string]string{"instance": "other"},
+				},
+			}
+			testScheme := runtime.NewScheme()
+			Expect(mellanoxv1alpha1.AddToScheme(testScheme)).To(Succeed())
+			selector, err := labels.Parse("instance=test")
+			Expect(err).NotTo(HaveOccurred())
+			reconciler = &NicClusterPolicyReconciler{
+				Client:         fake.NewClientBuilder().WithScheme(testScheme).WithObjects(cr).Build(),
+				Log:            ctrl.Log.WithName("controllers").WithName("NicClusterPolicy"),
+				Scheme:         testScheme,
+				PolicySelector: selector,
+				// no state manager, reconciling the NicClusterPolicy would panic
+			}
+		})
+
+		It("should not reconcile a non-matching NicClusterPolicy", func() {
+			result, err := reconciler.Reconcile(goctx.TODO(),
+				ctrl.Request{NamespacedName: types.NamespacedName{Name: cr.Name}})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result).To(Equal(ctrl.Result{}))
+
+			found := &mellanoxv1alpha1.NicClusterPolicy{}
+			Expect(reconciler.Get(goctx.TODO(), types.NamespacedName{Name: cr.Name}, found)).To(Succeed())
+			Expect(found.Status.State).To(BeEmpty())
+		})
+
+		It("should filter events of non-matching NicClusterPolicies", func() {
+			selected := predicate.NewPredicateFuncs(reconciler.isSelected)
+			Expect(selected.Create(event.CreateEvent{Object: cr})).To(BeFalse())
+
+			cr.Labels["instance"] = "test"
+			Expect(selected.Create(event.CreateEvent{Object: cr})).To(BeTrue())
+		})
+
+		It("should select all NicClusterPolicies when selector is not set", func() {
+			reconciler.PolicySelector = nil
+			Expect(reconciler.isSelected(cr)).To(BeTrue())
+		})
+	})
+
+	Context("When states find no eligible nodes", func() {
+		It("should set the NoEligibleNodes condition and clear it once eligible nodes are found", func() {
+			var conditions []metav1.Condition
+			setNoEligibleNodesCondition(&conditions, 1, state.Results{StatesStatus: []state.Result{
+				{StateName: "state-OFED", Status: state.SyncStateNotReady,
+					NoEligibleNodesFilter: nodeinfo.NodeLabelMlnxNIC + "=true"},
+				{StateName: "state-multus-cni", Status: state.SyncStateReady},
+			}})
+			cond := meta.FindStatusCondition(conditions, mellanoxv1alpha1.ConditionTypeNoEligibleNodes)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.Status).To(Equal(metav1.ConditionTrue))
+			Expect(cond.Message).To(ContainSubstring("state-OFED: " + nodeinfo.NodeLabelMlnxNIC + "=true"))
+
+			setNoEligibleNodesCondition(&conditions, 1, state.Results{StatesStatus: []state.Result{
+				{StateName: "state-OFED", Status: state.SyncStateReady},
+				{StateName: "state-multus-cni", Status: state.SyncStateReady},
+			}})
+			Expect(meta.FindStatusCondition(conditions, mellanoxv1alpha1.ConditionTypeNoEligibleNodes)).To(BeNil())
+		})
+		It("should not fail when clearing the condition of a status without conditions", func() {
+			var conditions []metav1.Condition
+			setNoEligibleNodesCondition(&conditions, 1, state.Results{StatesStatus: []state.Result{
+				{StateName: "state-OFED", Status: state.SyncStateReady},
+			}})
+			Expect(conditions).To(BeEmpty())
+		})
+	})
+
+	Context("When reconcile skip is enabled", func() {
+		var (
+			cr         *mellanoxv1alpha1.NicClusterPolicy
+			reconciler *NicClusterPolicyReconciler
+			manager    *countingManager
+			ds         *appsv1.DaemonSet
+		)
+
+		BeforeEach(func() {
+			cr = &mellanoxv1alpha1.NicClusterPolicy{
+				ObjectMeta: metav1.ObjectMeta{Name: consts.NicClusterPolicyResourceName, Generation: 1, UID: "uid"},
+			}
+			isController := true
+			ds = &appsv1.DaemonSet{ObjectMeta: metav1.ObjectMeta{
+				Name:      "ds",
+				Namespace: consts.NetworkOperatorResourceNamespace,
+				Labels:    map[string]string{consts.NetworkOperatorOwnedLabel: "true"},
+				OwnerReferences: []metav1.OwnerReference{{
+					APIVersion: mellanoxv1alpha1.GroupVersion.String(),
+					Kind:       mellanoxv1alpha1.NicClusterPolicyCRDName,
+					Name:       cr.Name,
+					UID:        cr.UID,
+					Controller: &isController,
+				}},
+			}}
+			testScheme := runtime.NewScheme()
+			Expect(clientgoscheme.AddToScheme(testScheme)).To(Succeed())
+			Expect(mellanoxv1alpha1.AddToScheme(testScheme)).To(Succeed())
+			manager = &countingManager{}
+			reconciler = &NicClusterPolicyReconciler{
+				Client:        fake.NewClientBuilder().WithScheme(testScheme).WithObjects(cr, ds).Build(),
+				Log:           ctrl.Log.WithName("controllers").WithName("NicClusterPolicy"),
+				Scheme:        testScheme,
+				ReconcileSkip: true,
+				stateManager:  manager,
+				watchSources:  []*source.Kind{{Type: &appsv1.DaemonSet{}}},
+			}
+		})
+
+		reconcileCR := func() *mellanoxv1alpha1.NicClusterPolicy {
+			_, err := reconciler.Reconcile(goctx.TODO(),
+				ctrl.Request{NamespacedName: types.NamespacedName{Name: cr.Name}})
+			Expect(err).NotTo(HaveOccurred())
+			found := &mellanoxv1alpha1.NicClusterPolicy{}
+			Expect(reconciler.Get(goctx.TODO(), types.NamespacedName{Name: cr.Name}, found)).To(Succeed())
+			return found
+		}
+
+		It("should skip the sync of states when nothing changed since the last full reconcile", func() {
+			found := reconcileCR()
+			Expect(manager.syncs).To(Equal(1))
+			Expect(found.Status.ObservedGeneration).To(BeEquivalentTo(1))
+
+			reconcileCR()
+			Expect(manager.syncs).To(Equal(1))
+		})
+		It("should sync the states when a watched object changed", func() {
+			reconcileCR()
+			Expect(reconciler.Get(goctx.TODO(), client.ObjectKeyFromObject(ds), ds)).To(Succeed())
+			ds.Spec.MinReadySeconds = 10
+			Expect(reconciler.Update(goctx.TODO(), ds)).To(Succeed())
+			reconcileCR()
+			Expect(manager.syncs).To(Equal(2))
+		})
+		It("should sync the states when the generation changed", func() {
+			found := reconcileCR()
+			found.Generation = 2
+			Expect(reconciler.Update(goctx.TODO(), found)).To(Succeed())
+			found = reconcileCR()
+			Expect(manager.syncs).To(Equal(2))
+			Expect(found.Status.ObservedGeneration).To(BeEquivalentTo(2))
+		})
+		It("should sync the states on every reconcile when disabled", func() {
+			reconciler.ReconcileSkip = false
+			reconcileCR()
+			reconcileCR()
+			Expect(manager.syncs).To(Equal(2))
+		})
+	})
+
+	Context("When the NicClusterPolicy sets mutually exclusive fields", func() {
+		It("should report the validation error in the status without syncing the states", func() {
+			cr := &mellanoxv1alpha1.NicClusterPolicy{
+				ObjectMeta: metav1.ObjectMeta{Name: consts.NicClusterPolicyResourceName},
+				Spec: mellanoxv1alpha1.NicClusterPolicySpec{
+					PSP: &mellanoxv1alpha1.PSPSpec{Enabled: true},
+					PSA: &mellanoxv1alpha1.PSASpec{Enabled: true},
+				},
+			}
+			testScheme := runtime.NewScheme()
+			Expect(mellanoxv1alpha1.AddToScheme(testScheme)).To(Succeed())
+			reconciler := &NicClusterPolicyReconciler{
+				Client: fake.NewClientBuilder().WithScheme(testScheme).WithObjects(cr).Build(),
+				Log:    ctrl.Log.WithName("controllers").WithName("NicClusterPolicy"),
+				Scheme: testScheme,
+				// no state manager, reconciling the NicClusterPolicy would panic
+			}
+
+			result, err := reconciler.Reconcile(goctx.TODO(),
+				ctrl.Request{NamespacedName: types.NamespacedName{Name: cr.Name}})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result).To(Equal(ctrl.Result{}))
+
+			found := &mellanoxv1alpha1.NicClusterPolicy{}
+			Expect(reconciler.Get(goctx.TODO(), types.NamespacedName{Name: cr.Name}, found)).To(Succeed())
+			Expect(found.Status.State).To(BeEquivalentTo(mellanoxv1alpha1.StateError))
+			Expect(found.Status.Reason).To(Equal(
+				validation.Validate(mellanoxv1alpha1.NicClusterPolicyCRDName, cr).Error()))
+		})
+	})
+
+	Context("When the NicClusterPolicy uses a deprecated field", func() {
+		It("should set the Warning condition and record a Warning Event naming the replacement", func() {
+			cr := &mellanoxv1alpha1.NicClusterPolicy{
+				ObjectMeta: metav1.ObjectMeta{Name: consts.NicClusterPolicyResourceName, Generation: 1},
+				Spec: mellanoxv1alpha1.NicClusterPolicySpec{
+					PSP: &mellanoxv1alpha1.PSPSpec{Enabled: true},
+				},
+			}
+			testScheme := runtime.NewScheme()
+			Expect(clientgoscheme.AddToScheme(testScheme)).To(Succeed())
+			Expect(mellanoxv1alpha1.AddToScheme(testScheme)).To(Succeed())
+			recorder := record.NewFakeRecorder(10)
+			reconciler := &NicClusterPolicyReconciler{
+				Client:       fake.NewClientBuilder().WithScheme(testScheme).WithObjects(cr).Build(),
+				Log:          ctrl.Log.WithName("controllers").WithName("NicClusterPolicy"),
+				Scheme:       testScheme,
+				Recorder:     recorder,
+				stateManager: &countingManager{},
+			}
+
+			_, err := reconciler.Reconcile(goctx.TODO(),
+				ctrl.Request{NamespacedName: types.NamespacedName{Name: cr.Name}})
+			Expect(err).NotTo(HaveOccurred())
+
+			found := &mellanoxv1alpha1.NicClusterPolicy{}
+			Expect(reconciler.Get(goctx.TODO(), types.NamespacedName{Name: cr.Name}, found)).To(Succeed())
+			cond := meta.FindStatusCondition(found.Status.Conditions, mellanoxv1alpha1.ConditionTypeWarning)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.Reason).To(Equal("DeprecatedFieldsUsed"))
+			Expect(cond.Message).To(Equal(
+				"spec.psp.enabled is deprecated and will be removed, use spec.psa.enabled instead"))
+			Expect(recorder.Events).To(Receive(Equal("Warning " + validation.EventReasonDeprecatedField +
+				" spec.psp.enabled is deprecated and will be removed, use spec.psa.enabled instead")))
+		})
+	})
+
+	Context("When all the states are first ready", func() {
+		It("should record the InstallComplete Event once", func() {
+			cr := &mellanoxv1alpha1.NicClusterPolicy{
+				ObjectMeta: metav1.ObjectMeta{Name: consts.NicClusterPolicyResourceName, Generation: 1},
+			}
+			testScheme := runtime.NewScheme()
+			Expect(clientgoscheme.AddToScheme(testScheme)).To(Succeed())
+			Expect(mellanoxv1alpha1.AddToScheme(testScheme)).To(Succeed())
+			recorder := record.NewFakeRecorder(10)
+			reconciler := &NicClusterPolicyReconciler{
+				Client:       fake.NewClientBuilder().WithScheme(testScheme).WithObjects(cr).Build(),
+				Log:          ctrl.Log.WithName("controllers").WithName("NicClusterPolicy"),
+				Scheme:       testScheme,
+				Recorder:     recorder,
+				stateManager: &countingManager{},
+			}
+			reconcile := func() *mellanoxv1alpha1.NicClusterPolicy {
+				_, err := reconciler.Reconcile(goctx.TODO(),
+					ctrl.Request{NamespacedName: types.NamespacedName{Name: cr.Name}})
+				Expect(err).NotTo(HaveOccurred())
+				found := &mellanoxv1alpha1.NicClusterPolicy{}
+				Expect(reconciler.Get(goctx.TODO(), types.NamespacedName{Name: cr.Name}, found)).To(Succeed())
+				return found
+			}
+
+			found := reconcile()
+			Expect(found.Status.InstallCompleteTime).NotTo(BeNil())
+			installCompleteTime := found.Status.InstallCompleteTime
+			Expect(recorder.Events).To(Receive(Equal("Normal " + state.EventReasonInstallComplete +
+				" All enabled states are ready")))
+
+			found = reconcile()
+			Expect(found.Status.InstallCompleteTime).To(Equal(installCompleteTime))
+			Expect(recorder.Events).NotTo(Receive())
+		})
+	})
+})
@@ -0,0 +1,152 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+
+	mellanoxv1alpha1 "github.com/Mellanox/network-operator/api/v1alpha1"
+	"github.com/Mellanox/network-operator/pkg/consts"
+	"github.com/Mellanox/network-operator/pkg/state"
+)
+
+// watchedObjects records the fingerprint of the objects watched by the states and of the external render data
+// observed at the start of the last full reconcile. The zero value reports a change, so the first reconcile after the
+// operator starts is a full reconcile.
+type watchedObjects struct {
+	mu          sync.Mutex
+	fingerprint string
+	// resyncAt is the time from which a full reconcile is due as requested by the states, e.g to rotate a
+	// certificate, zero if not requested
+	resyncAt time.Time
+}
+
+// startSync records the fingerprint observed at the start of a full reconcile
+func (w *watchedObjects) startSync(fingerprint string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.fingerprint = fingerprint
+	w.resyncAt = time.Time{}
+}
+
+// resyncAfter records that a full reconcile is due after resyncAfter, none is due if it is zero
+func (w *watchedObjects) resyncAfter(resyncAfter time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.resyncAt = time.Time{}
+	if resyncAfter > 0 {
+		w.resyncAt = time.Now().Add(resyncAfter)
+	}
+}
+
+// isUnchanged checks that fingerprint was observed at the start of the last full reconcile and no full reconcile
+// is due since
+func (w *watchedObjects) isUnchanged(fingerprint string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return fingerprint != "" && w.fingerprint == fingerprint && (w.resyncAt.IsZero() || time.Now().Before(w.resyncAt))
+}
+
+// isReconciled checks if the reconcile of cr can be skipped: the states were all applied successfully for its
+// generation and neither the objects watched by the states nor the external render data changed since, as reported
+// by fingerprint
+func (r *NicClusterPolicyReconciler) isReconciled(cr *mellanoxv1alpha1.NicClusterPolicy, fingerprint string) bool {
+	return r.ReconcileSkip &&
+		cr.Status.State == mellanoxv1alpha1.StateReady &&
+		cr.Status.ObservedGeneration == cr.Generation &&
+		r.watched.isUnchanged(fingerprint)
+}
+
+// getWatchedFingerprint returns a hash of the objects watched by the states which changes when an object controlled
+// by a NicClusterPolicy is added, changed or removed. The objects are listed from the cache of the watch sources.
+func (r *NicClusterPolicyReconciler) getWatchedFingerprint(ctx context.Context) (string, error) {
+	var entries []string
+	for _, ws := range r.watchSources {
+		gvk, err := apiutil.GVKForObject(ws.Type, r.Scheme)
+		if err != nil {
+			return "", err
+		}
+		listGVK := gvk.GroupVersion().WithKind(gvk.Kind + "List")
+		var list client.ObjectList
+		if _, ok := ws.Type.(*unstructured.Unstructured); ok {
+			ul := &unstructured.UnstructuredList{}
+			ul.SetGroupVersionKind(listGVK)
+			list = ul
+		} else {
+			obj, err := r.Scheme.New(listGVK)
+			if err != nil {
+				return "", err
+			}
+			if list, ok = obj.(client.ObjectList); !ok {
+				return "", errors.Errorf("unexpected list type %T of %s", obj, gvk.Kind)
+			}
+		}
+		if err := r.List(ctx, list, client.MatchingLabels{consts.NetworkOperatorOwnedLabel: "true"}); err != nil {
+			return "", errors.Wrapf(err, "failed to list %s", gvk.Kind)
+		}
+		items, err := meta.ExtractList(list)
+		if err != nil {
+			return "", err
+		}
+		for _, item := range items {
+			obj, ok := item.(client.Object)
+			if !ok {
+				continue
+			}
+			owner := metav1.GetControllerOf(obj)
+			if owner == nil || owner.Kind != mellanoxv1alpha1.NicClusterPolicyCRDName {
+				continue
+			}
+			entries = append(entries, fmt.Sprintf("%s %s/%s %s",
+				gvk.Kind, obj.GetNamespace(), obj.GetName(), obj.GetResourceVersion()))
+		}
+	}
+	sort.Strings(entries)
+	h := sha256.New()
+	for _, entry := range entries {
+		h.Write([]byte(entry + "\n"))
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// getObservedFingerprint returns the fingerprint of the objects watched by the states, and the fingerprint of the
+// inputs observed by the reconcile: the watched objects and the external render data
+func (r *NicClusterPolicyReconciler) getObservedFingerprint(
+	ctx context.Context, externalRenderData state.ExternalRenderData) (watched, observed string, err error) {
+	watched, err = r.getWatchedFingerprint(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	renderData, err := externalRenderData.Fingerprint()
+	if err != nil {
+		return "", "", err
+	}
+	return watched, watched + "/" + renderData, nil
+}
@@ -0,0 +1,96 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	"github.com/Mellanox/network-operator/pkg/config"
+)
+
+const (
+	// requeueQueueDepthStep is the number of queued reconcile requests doubling the requeue delay
+	requeueQueueDepthStep = 10
+	// maxRequeueDelayFactor bounds the adaptive requeue delay to a multiple of the controller requeue time
+	maxRequeueDelayFactor = 8
+)
+
+// reconcileQueue is a source which emits no events, it captures the reconcile queue of the controller watching it
+// to read the queue depth. The depth is exposed by the controller-runtime workqueue_depth metric.
+type reconcileQueue struct {
+	mu    sync.RWMutex
+	queue workqueue.RateLimitingInterface
+}
+
+// Start implements source.Source, it is called by the controller with its reconcile queue
+func (q *reconcileQueue) Start(
+	_ context.Context, _ handler.EventHandler, queue workqueue.RateLimitingInterface, _ ...predicate.Predicate) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.queue = queue
+	return nil
+}
+
+// Depth returns the number of reconcile requests waiting in the queue, false if the controller is not started
+func (q *reconcileQueue) Depth() (int, bool) {
+	if q == nil {
+		return 0, false
+	}
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.queue == nil {
+		return 0, false
+	}
+	return q.queue.Len(), true
+}
+
+// getRequeueDelay returns the requeue delay of a resource which is not ready reconciled by the controller of queue.
+// With adaptive requeue the controller requeue time is scaled with the depth of the reconcile queue.
+func getRequeueDelay(queue *reconcileQueue, adaptive bool) time.Duration {
+	delay := time.Duration(config.FromEnv().Controller.RequeueTimeSeconds) * time.Second
+	if !adaptive {
+		return delay
+	}
+	depth, ok := queue.Depth()
+	if !ok {
+		return delay
+	}
+	return adaptRequeueDelay(delay, depth)
+}
+
+// adaptRequeueDelay halves the delay when the reconcile queue is empty and doubles it for every
+// requeueQueueDepthStep queued requests, up to maxRequeueDelayFactor times the delay
+func adaptRequeueDelay(delay time.Duration, depth int) time.Duration {
+	if depth == 0 {
+		return delay / 2
+	}
+	maxDelay := delay * maxRequeueDelayFactor
+	adapted := delay
+	for i := 0; i < depth/requeueQueueDepthStep && adapted < maxDelay; i++ {
+		adapted *= 2
+	}
+	if adapted > maxDelay {
+		adapted = maxDelay
+	}
+	return adapted
+}
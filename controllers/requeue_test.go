@@ -0,0 +1,73 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"k8s.io/client-go/util/workqueue"
+
+	"github.com/Mellanox/network-operator/pkg/config"
+)
+
+var _ = Describe("Requeue delay", func() {
+	var (
+		delay time.Duration
+		queue *reconcileQueue
+	)
+
+	BeforeEach(func() {
+		delay = time.Duration(config.FromEnv().Controller.RequeueTimeSeconds) * time.Second
+		queue = &reconcileQueue{}
+		Expect(queue.Start(context.Background(), nil,
+			workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()))).To(Succeed())
+	})
+
+	enqueue := func(n int) {
+		for i := 0; i < n; i++ {
+			queue.queue.Add(i)
+		}
+	}
+
+	It("should lengthen the requeue delay when the queue is deep", func() {
+		enqueue(5)
+		shallow := getRequeueDelay(queue, true)
+		enqueue(30)
+		deep := getRequeueDelay(queue, true)
+		Expect(shallow).To(Equal(delay))
+		Expect(deep).To(Equal(8 * delay))
+	})
+
+	It("should shorten the requeue delay when the queue is empty", func() {
+		Expect(getRequeueDelay(queue, true)).To(Equal(delay / 2))
+	})
+
+	It("should bound the requeue delay", func() {
+		Expect(adaptRequeueDelay(delay, 1000)).To(Equal(maxRequeueDelayFactor * delay))
+		Expect(adaptRequeueDelay(delay, 10)).To(Equal(2 * delay))
+	})
+
+	It("should keep the requeue delay if adaptive requeue is disabled or the controller is not started", func() {
+		enqueue(35)
+		Expect(getRequeueDelay(queue, false)).To(Equal(delay))
+		Expect(getRequeueDelay(nil, true)).To(Equal(delay))
+		Expect(getRequeueDelay(&reconcileQueue{}, true)).To(Equal(delay))
+	})
+})
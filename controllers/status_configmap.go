@@ -0,0 +1,83 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	mellanoxv1alpha1 "github.com/Mellanox/network-operator/api/v1alpha1"
+	"github.com/Mellanox/network-operator/pkg/consts"
+)
+
+const (
+	// statusConfigMapName is the name of the ConfigMap summarizing the status of the NicClusterPolicy
+	statusConfigMapName = "network-operator-status"
+	// statusConfigMapStateKey is the key of the global state of the NicClusterPolicy in the status ConfigMap
+	statusConfigMapStateKey = "state"
+	// statusConfigMapMessageSuffix is appended to a state name to form the key of the state message
+	statusConfigMapMessageSuffix = ".message"
+)
+
+// getStatusConfigMapData returns the status ConfigMap data summarizing the status of cr: the global state, the state
+// of each applied state keyed by its name and the message of each applied state having one keyed by its name with
+// the ".message" suffix
+func getStatusConfigMapData(cr *mellanoxv1alpha1.NicClusterPolicy) map[string]string {
+	data := map[string]string{statusConfigMapStateKey: string(cr.Status.State)}
+	for _, appliedState := range cr.Status.AppliedStates {
+		data[appliedState.Name] = string(appliedState.State)
+		if appliedState.Message != "" {
+			data[appliedState.Name+statusConfigMapMessageSuffix] = appliedState.Message
+		}
+	}
+	return data
+}
+
+// updateStatusConfigMap creates or updates the status ConfigMap of cr in namespace, for clusters where the status
+// of the NicClusterPolicy is consumed without access to the custom resource, e.g by dashboards and alerting
+func updateStatusConfigMap(ctx context.Context, c client.Client, scheme *runtime.Scheme, namespace string,
+	cr *mellanoxv1alpha1.NicClusterPolicy) error {
+	cm := &corev1.ConfigMap{}
+	err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: statusConfigMapName}, cm)
+	if err != nil && !apiErrors.IsNotFound(err) {
+		return errors.Wrap(err, "failed to get status ConfigMap")
+	}
+	exists := err == nil
+
+	cm.Name = statusConfigMapName
+	cm.Namespace = namespace
+	if cm.Labels == nil {
+		cm.Labels = map[string]string{}
+	}
+	cm.Labels[consts.NetworkOperatorOwnedLabel] = "true"
+	cm.Data = getStatusConfigMapData(cr)
+	// the ConfigMap is garbage collected along with the NicClusterPolicy
+	if err := controllerutil.SetControllerReference(cr, cm, scheme); err != nil {
+		return errors.Wrap(err, "failed to set controller reference for status ConfigMap")
+	}
+	if exists {
+		return errors.Wrap(c.Update(ctx, cm), "failed to update status ConfigMap")
+	}
+	return errors.Wrap(c.Create(ctx, cm), "failed to create status ConfigMap")
+}
@@ -0,0 +1,95 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	mellanoxv1alpha1 "github.com/Mellanox/network-operator/api/v1alpha1"
+	"github.com/Mellanox/network-operator/pkg/consts"
+)
+
+var _ = Describe("Status ConfigMap", func() {
+	const namespace = "network-operator"
+	var (
+		c      client.Client
+		scheme *runtime.Scheme
+		cr     *mellanoxv1alpha1.NicClusterPolicy
+	)
+
+	BeforeEach(func() {
+		scheme = runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(mellanoxv1alpha1.AddToScheme(scheme)).To(Succeed())
+		c = fake.NewClientBuilder().WithScheme(scheme).Build()
+		cr = &mellanoxv1alpha1.NicClusterPolicy{}
+		cr.Name = consts.NicClusterPolicyResourceName
+		cr.UID = "uid"
+		cr.Status = mellanoxv1alpha1.NicClusterPolicyStatus{
+			State: mellanoxv1alpha1.StateNotReady,
+			AppliedStates: []mellanoxv1alpha1.AppliedState{
+				{Name: "state-OFED", State: mellanoxv1alpha1.StateReady},
+				{Name: "state-SRIOV-device-plugin", State: mellanoxv1alpha1.StateError, Message: "failed to render"},
+			},
+		}
+	})
+
+	getStatusConfigMap := func() *corev1.ConfigMap {
+		cm := &corev1.ConfigMap{}
+		Expect(c.Get(context.TODO(), types.NamespacedName{Namespace: namespace, Name: statusConfigMapName},
+			cm)).To(Succeed())
+		return cm
+	}
+
+	It("should write the aggregate status of the NicClusterPolicy", func() {
+		Expect(updateStatusConfigMap(context.TODO(), c, scheme, namespace, cr)).To(Succeed())
+
+		cm := getStatusConfigMap()
+		Expect(cm.Data).To(Equal(map[string]string{
+			"state":                             "notReady",
+			"state-OFED":                        "ready",
+			"state-SRIOV-device-plugin":         "error",
+			"state-SRIOV-device-plugin.message": "failed to render",
+		}))
+		Expect(cm.Labels).To(HaveKeyWithValue(consts.NetworkOperatorOwnedLabel, "true"))
+		Expect(cm.OwnerReferences).To(HaveLen(1))
+		Expect(cm.OwnerReferences[0].Name).To(Equal(cr.Name))
+	})
+
+	It("should update the ConfigMap on each reconcile", func() {
+		Expect(updateStatusConfigMap(context.TODO(), c, scheme, namespace, cr)).To(Succeed())
+		cr.Status.State = mellanoxv1alpha1.StateReady
+		cr.Status.AppliedStates[1] = mellanoxv1alpha1.AppliedState{
+			Name: "state-SRIOV-device-plugin", State: mellanoxv1alpha1.StateReady}
+		Expect(updateStatusConfigMap(context.TODO(), c, scheme, namespace, cr)).To(Succeed())
+
+		Expect(getStatusConfigMap().Data).To(Equal(map[string]string{
+			"state":                     "ready",
+			"state-OFED":                "ready",
+			"state-SRIOV-device-plugin": "ready",
+		}))
+	})
+})
@@ -0,0 +1,42 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// syncPhaseDuration is the duration of the phases of the state syncs, e.g rendering the objects of a state or
+// applying them, to find whether rendering or API calls dominate the reconcile time
+var syncPhaseDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "network_operator_state_sync_phase_duration_seconds",
+	Help:    "Duration of a phase of the Sync of a state: nodeinfo, render, apply or status-check",
+	Buckets: prometheus.ExponentialBuckets(0.001, 4, 8),
+}, []string{"state", "phase"})
+
+func init() {
+	metrics.Registry.MustRegister(syncPhaseDuration)
+}
+
+// observeSyncPhase records the duration of a phase of the Sync of a state, it is the state.SyncPhaseTimer of the
+// reconcilers
+func observeSyncPhase(stateName, phase string, duration time.Duration) {
+	syncPhaseDuration.WithLabelValues(stateName, phase).Observe(duration.Seconds())
+}
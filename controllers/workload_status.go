@@ -0,0 +1,68 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	mellanoxv1alpha1 "github.com/Mellanox/network-operator/api/v1alpha1"
+	"github.com/Mellanox/network-operator/pkg/state"
+)
+
+// workloadReadyRatio is the fraction of ready pods of the workload objects applied by the NicClusterPolicy states,
+// normalized across workload kinds
+var workloadReadyRatio = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "network_operator_workload_ready_ratio",
+	Help: "Fraction of ready pods of a DaemonSet or available replicas of a Deployment applied by a " +
+		"NicClusterPolicy state, 0 if no pod is desired",
+}, []string{"state", "kind", "name"})
+
+func init() {
+	metrics.Registry.MustRegister(workloadReadyRatio)
+}
+
+// getWorkloadStatuses returns the status of the workload objects reported by a state
+func getWorkloadStatuses(workloads []state.WorkloadReadiness) []mellanoxv1alpha1.WorkloadStatus {
+	if len(workloads) == 0 {
+		return nil
+	}
+	statuses := make([]mellanoxv1alpha1.WorkloadStatus, 0, len(workloads))
+	for _, workload := range workloads {
+		statuses = append(statuses, mellanoxv1alpha1.WorkloadStatus{
+			Kind:         workload.Kind,
+			Name:         workload.Name,
+			Ready:        workload.Ready,
+			Desired:      workload.Desired,
+			ReadyPercent: int32(workload.Fraction() * 100),
+		})
+	}
+	return statuses
+}
+
+// setWorkloadReadyMetrics sets the ready ratio of the workload objects reported in the applied states of cr, the
+// ratio of workload objects which are no longer reported is removed
+func setWorkloadReadyMetrics(cr *mellanoxv1alpha1.NicClusterPolicy) {
+	workloadReadyRatio.Reset()
+	for _, appliedState := range cr.Status.AppliedStates {
+		for _, workload := range appliedState.Workloads {
+			readiness := state.WorkloadReadiness{Ready: workload.Ready, Desired: workload.Desired}
+			workloadReadyRatio.WithLabelValues(appliedState.Name, workload.Kind, workload.Name).Set(
+				readiness.Fraction())
+		}
+	}
+}
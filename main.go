@@ -17,23 +17,36 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
 	netattdefv1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
 	mellanoxcomv1alpha1 "github.com/Mellanox/network-operator/api/v1alpha1"
 	"github.com/Mellanox/network-operator/controllers"
+	"github.com/Mellanox/network-operator/pkg/config"
+	"github.com/Mellanox/network-operator/pkg/consts"
+	"github.com/Mellanox/network-operator/pkg/debug"
+	"github.com/Mellanox/network-operator/pkg/state"
+	"github.com/Mellanox/network-operator/pkg/tracing"
+	"github.com/Mellanox/network-operator/pkg/validation"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -51,14 +64,85 @@ func init() {
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "diff" {
+		os.Exit(runDiff(os.Args[2:]))
+	}
+
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var enableTracing bool
+	var policySelector string
+	var enableDebugEndpoint bool
+	var resourceLimitsMode string
+	var enableSyncCache bool
+	var enableReconcileSkip bool
+	var enableWebhook bool
+	var enableAdaptiveRequeue bool
+	var statusConfigMapNamespace string
+	var reconcileReportTarget string
+	var watchDisabledKinds string
+	var enablePruneOnDelete bool
+	var stateRateLimits string
+	var policyScopes string
+	var renderWorkers uint
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.BoolVar(&enableTracing, "enable-tracing", config.FromEnv().Tracing.Enabled,
+		"Export OpenTelemetry traces of reconcile operations to the OTLP collector "+
+			"set in OTEL_EXPORTER_OTLP_ENDPOINT environment variable.")
+	flag.StringVar(&policySelector, "nic-cluster-policy-selector", config.FromEnv().Controller.NicClusterPolicySelector,
+		"Label selector of the NicClusterPolicies reconciled by the operator, others are ignored. "+
+			"All NicClusterPolicies are reconciled if empty.")
+	flag.BoolVar(&enableDebugEndpoint, "enable-debug-endpoint", config.FromEnv().Debug.EndpointEnabled,
+		"Serve the effective operator configuration on the metrics endpoint under /debug/config. "+
+			"Requests must provide the bearer token set in DEBUG_ENDPOINT_TOKEN environment variable.")
+	flag.StringVar(&resourceLimitsMode, "resource-limits-mode", config.FromEnv().State.ResourceLimitsMode,
+		"Whether rendered containers must have resource limits: \"strict\" fails the sync of states rendering "+
+			"containers without limits, \"permissive\" allows them.")
+	flag.BoolVar(&enableSyncCache, "enable-sync-cache", config.FromEnv().Controller.SyncCacheEnabled,
+		"Skip the Sync of NicClusterPolicy states whose inputs, the NicClusterPolicy spec and the nodes, did not "+
+			"change since their last ready Sync, unless an object watched by the states changed.")
+	flag.BoolVar(&enableReconcileSkip, "enable-reconcile-skip", config.FromEnv().Controller.ReconcileSkipEnabled,
+		"Skip the reconcile of a ready NicClusterPolicy whose generation, reported in its status.observedGeneration, "+
+			"was already reconciled, unless an object watched by the states changed since the last full reconcile.")
+	flag.BoolVar(&enableAdaptiveRequeue, "enable-adaptive-requeue", config.FromEnv().Controller.AdaptiveRequeueEnabled,
+		"Scale the requeue time of resources which are not ready with the depth of the reconcile queue: halved "+
+			"when the queue is empty and doubled for every 10 queued requests, up to 8 times the requeue time.")
+	flag.BoolVar(&enableWebhook, "enable-webhook", config.FromEnv().Controller.WebhookEnabled,
+		"Serve the validating and defaulting webhooks of the custom resources on port 9443. The webhook server certificate "+
+			"must be mounted in the webhook server certificate directory.")
+	flag.StringVar(&statusConfigMapNamespace, "status-configmap-namespace",
+		config.FromEnv().Controller.StatusConfigMapNamespace,
+		"Namespace of the network-operator-status ConfigMap summarizing the NicClusterPolicy status, updated on "+
+			"each reconcile. The ConfigMap is not written if empty.")
+	flag.StringVar(&reconcileReportTarget, "reconcile-report-target", config.FromEnv().Controller.ReconcileReportTarget,
+		"File or http(s) endpoint the JSON reconcile report, with the status, applied and pruned object counts, "+
+			"duration and warnings of each state, is written to after each full reconcile of a NicClusterPolicy. "+
+			"No report is written if empty.")
+	flag.StringVar(&watchDisabledKinds, "watch-disabled-kinds",
+		strings.Join(config.FromEnv().Controller.WatchDisabledKinds, ","),
+		"Comma separated kinds the states must not watch, e.g kinds the operator is not allowed to watch, as kind "+
+			"names or kinds qualified by their group, e.g IPPool.whereabouts.cni.cncf.io. Kinds which are not served "+
+			"by the API server are never watched.")
+	flag.BoolVar(&enablePruneOnDelete, "enable-prune-on-delete", config.FromEnv().Controller.PruneOnDeleteEnabled,
+		"Delete the objects labeled as owned by the operator, of the kinds of the manifests, controlled by the "+
+			"NicClusterPolicy once it is deleted, without waiting for the garbage collector.")
+	flag.StringVar(&stateRateLimits, "state-rate-limits", strings.Join(config.FromEnv().State.StateRateLimits, ","),
+		"Comma separated Sync rate limits of the NicClusterPolicy states as <state name>=<rate>:<burst>, rate is "+
+			"the number of Sync invocations per second, e.g state-OFED=0.1:1. A throttled state is reported not "+
+			"ready. States without a rate limit are not throttled.")
+	flag.UintVar(&renderWorkers, "render-workers", config.FromEnv().State.RenderWorkers,
+		"Number of node groups, e.g the OFED drivers of each OS distribution and kernel, rendered concurrently by "+
+			"a state. Node groups are rendered serially if lower than 2.")
+	flag.StringVar(&policyScopes, "policy-scopes", strings.Join(config.FromEnv().State.PolicyScopes, ","),
+		"Comma separated scopes of the NicClusterPolicies reconciled in addition to nic-cluster-policy as "+
+			"<policy name>=<namespace>:<node label>=<value>, e.g tenant-a=tenant-a:example.com/tenant=a. The device "+
+			"plugins of a scoped NicClusterPolicy are deployed in the namespace of its scope on the nodes with its "+
+			"label, those of nic-cluster-policy on the nodes which are not part of any scope.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -67,6 +151,16 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
+	shutdownTracing := func(context.Context) error { return nil }
+	if enableTracing {
+		var err error
+		shutdownTracing, err = tracing.Setup(context.Background(), config.FromEnv().Tracing)
+		if err != nil {
+			setupLog.Error(err, "unable to set up tracing")
+			os.Exit(1)
+		}
+	}
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:                 scheme,
 		MetricsBindAddress:     metricsAddr,
@@ -80,32 +174,105 @@ func main() {
 		os.Exit(1)
 	}
 
+	var nicClusterPolicySelector labels.Selector
+	if policySelector != "" {
+		nicClusterPolicySelector, err = labels.Parse(policySelector)
+		if err != nil {
+			setupLog.Error(err, "invalid NicClusterPolicy selector", "selector", policySelector)
+			os.Exit(1)
+		}
+	}
+
+	limitsMode, err := state.ParseResourceLimitsMode(resourceLimitsMode)
+	if err != nil {
+		setupLog.Error(err, "invalid resource limits mode")
+		os.Exit(1)
+	}
+
+	rateLimits, err := state.ParseStateRateLimits(strings.Split(stateRateLimits, ","))
+	if err != nil {
+		setupLog.Error(err, "invalid state rate limits")
+		os.Exit(1)
+	}
+
+	scopes, err := state.ParsePolicyScopes(strings.Split(policyScopes, ","))
+	if err != nil {
+		setupLog.Error(err, "invalid policy scopes")
+		os.Exit(1)
+	}
+
+	var syncCache *state.SyncCache
+	if enableSyncCache {
+		syncCache = state.NewSyncCache()
+	}
+
+	watchSourceFilter := state.NewWatchSourceFilter(mgr.GetRESTMapper(), mgr.GetScheme(),
+		strings.Split(watchDisabledKinds, ","))
+
 	if err = (&controllers.NicClusterPolicyReconciler{
-		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("NicClusterPolicy"),
-		Scheme: mgr.GetScheme(),
+		Client:                   mgr.GetClient(),
+		Log:                      ctrl.Log.WithName("controllers").WithName("NicClusterPolicy"),
+		Scheme:                   mgr.GetScheme(),
+		PolicySelector:           nicClusterPolicySelector,
+		Recorder:                 mgr.GetEventRecorderFor("network-operator"),
+		ResourceLimitsMode:       limitsMode,
+		SyncCache:                syncCache,
+		ReconcileSkip:            enableReconcileSkip,
+		AdaptiveRequeue:          enableAdaptiveRequeue,
+		StatusConfigMapNamespace: statusConfigMapNamespace,
+		ReconcileReportTarget:    reconcileReportTarget,
+		WatchSourceFilter:        watchSourceFilter,
+		PruneOnDelete:            enablePruneOnDelete,
+		StateRateLimits:          rateLimits,
+		PolicyScopes:             scopes,
+		RenderWorkers:            int(renderWorkers),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "NicClusterPolicy")
 		os.Exit(1)
 	}
 	if err = (&controllers.MacvlanNetworkReconciler{
-		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("MacvlanNetwork"),
-		Scheme: mgr.GetScheme(),
+		Client:            mgr.GetClient(),
+		Log:               ctrl.Log.WithName("controllers").WithName("MacvlanNetwork"),
+		Scheme:            mgr.GetScheme(),
+		Recorder:          mgr.GetEventRecorderFor("network-operator"),
+		AdaptiveRequeue:   enableAdaptiveRequeue,
+		WatchSourceFilter: watchSourceFilter,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "MacvlanNetwork")
 		os.Exit(1)
 	}
 	if err = (&controllers.HostDeviceNetworkReconciler{
-		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("HostDeviceNetwork"),
-		Scheme: mgr.GetScheme(),
+		Client:          mgr.GetClient(),
+		Log:             ctrl.Log.WithName("controllers").WithName("HostDeviceNetwork"),
+		Scheme:          mgr.GetScheme(),
+		Recorder:        mgr.GetEventRecorderFor("network-operator"),
+		AdaptiveRequeue: enableAdaptiveRequeue,
+		AttachedPodsInterval: time.Duration(
+			config.FromEnv().Controller.AttachedPodsIntervalSeconds) * time.Second,
+		WatchSourceFilter: watchSourceFilter,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "HostDeviceNetwork")
 		os.Exit(1)
 	}
 	// +kubebuilder:scaffold:builder
 
+	if enableWebhook {
+		validation.RegisterWebhooks(mgr.GetWebhookServer())
+	}
+
+	if enableDebugEndpoint {
+		if config.FromEnv().Debug.Token == "" {
+			setupLog.Error(nil, "debug endpoint requires DEBUG_ENDPOINT_TOKEN to be set")
+			os.Exit(1)
+		}
+		err = mgr.AddMetricsExtraHandler(debug.ConfigPath,
+			debug.NewConfigHandler(mgr.GetClient(), config.FromEnv(), config.FromEnv().Debug.Token))
+		if err != nil {
+			setupLog.Error(err, "unable to set up debug endpoint")
+			os.Exit(1)
+		}
+	}
+
 	if err := mgr.AddHealthzCheck("health", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up health check")
 		os.Exit(1)
@@ -120,4 +287,67 @@ func main() {
 		setupLog.Error(err, "problem running manager")
 		os.Exit(1)
 	}
+	if err := shutdownTracing(context.Background()); err != nil {
+		setupLog.Error(err, "failed to flush traces")
+	}
+}
+
+// runDiff prints the changes a Sync of the NicClusterPolicy would apply to the cluster without applying them, one
+// block per object, and returns the exit code: 0 if the cluster is in sync, 1 if it is not and 2 on failure
+func runDiff(args []string) int {
+	diffFlags := flag.NewFlagSet("diff", flag.ExitOnError)
+	name := diffFlags.String("name", consts.NicClusterPolicyResourceName, "Name of the NicClusterPolicy to diff.")
+	showSecretData := diffFlags.Bool("show-secret-data", false,
+		"Print the values of the data of Secrets, they are redacted by default.")
+	_ = diffFlags.Parse(args)
+
+	c, err := client.New(ctrl.GetConfigOrDie(), client.Options{Scheme: scheme})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "failed to create client:", err)
+		return 2
+	}
+	ctx := context.Background()
+	cr := &mellanoxcomv1alpha1.NicClusterPolicy{}
+	if err := c.Get(ctx, types.NamespacedName{Name: *name}, cr); err != nil {
+		fmt.Fprintln(os.Stderr, "failed to get NicClusterPolicy:", err)
+		return 2
+	}
+
+	// the objects are rendered from the CR as prepared for a reconcile
+	externalRenderData, err := state.ResolveExternalRenderData(ctx, c, cr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "failed to resolve external render data:", err)
+		return 2
+	}
+	syncCR, sc, err := state.PrepareSync(ctx, c, cr, externalRenderData)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "failed to prepare NicClusterPolicy:", err)
+		return 2
+	}
+
+	diffs, err := state.Diff(ctx, c, scheme, mellanoxcomv1alpha1.NicClusterPolicyCRDName, syncCR, sc,
+		state.DiffOptions{ShowSecretData: *showSecretData})
+	for _, diff := range diffs {
+		fmt.Println(diff)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "failed to diff NicClusterPolicy:", err)
+		return 2
+	}
+	if snapshotNamespace := config.FromEnv().State.HostDeviceNetworkConfigSnapshotNamespace; snapshotNamespace != "" {
+		var snapshotDiffs []state.ObjectDiff
+		snapshotDiffs, err = state.DiffCNIConfigSnapshot(ctx, c, snapshotNamespace)
+		for _, diff := range snapshotDiffs {
+			fmt.Println(diff)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "failed to diff HostDeviceNetwork CNI config snapshot:", err)
+			return 2
+		}
+		diffs = append(diffs, snapshotDiffs...)
+	}
+	if len(diffs) != 0 {
+		return 1
+	}
+	return 0
 }
@@ -29,11 +29,49 @@ var operatorConfig *OperatorConfig
 type OperatorConfig struct {
 	State      StateConfig
 	Controller ControllerConfig
+	Tracing    TracingConfig
+	Debug      DebugConfig
 }
 
 // state related configurations
 type StateConfig struct {
 	ManifestBaseDir string `env:"STATE_MANIFEST_BASE_DIR" envDefault:"./manifests"`
+	// Maximum number of NetworkAttachmentDefinitions created from HostDeviceNetworks per namespace, 0 is unlimited
+	HostDeviceNetworkNamespaceQuota uint `env:"HOST_DEVICE_NETWORK_NAMESPACE_QUOTA" envDefault:"0"`
+	// Render a default deny NetworkPolicy and a NetworkPolicy allowing the traffic required by the operator in the
+	// namespaces of the NetworkAttachmentDefinitions created from HostDeviceNetworks
+	HostDeviceNetworkPolicyEnabled bool `env:"HOST_DEVICE_NETWORK_POLICY_ENABLED" envDefault:"false"`
+	// Namespaces allowed by the NetworkPolicy rendered with HostDeviceNetworkPolicyEnabled in addition to the
+	// operator namespaces
+	HostDeviceNetworkPolicyNamespaces []string `env:"HOST_DEVICE_NETWORK_POLICY_NAMESPACES" envDefault:"" envSeparator:","`
+	// Fail the sync of HostDeviceNetworks whose CNI plugin type is not installed by the CNI plugins deployed by the
+	// NicClusterPolicy, a warning is reported otherwise
+	HostDeviceNetworkCNITypeStrict bool `env:"HOST_DEVICE_NETWORK_CNI_TYPE_STRICT" envDefault:"false"`
+	// Fail the sync of the device plugins whose version is known to be incompatible with the OFED driver version of
+	// the NicClusterPolicy, a warning is reported otherwise
+	OFEDCompatibilityStrict bool `env:"OFED_COMPATIBILITY_STRICT" envDefault:"false"`
+	// File of the OFED driver compatibility matrix, e.g mounted from a ConfigMap, the matrix shipped in the manifest
+	// base dir is used if empty
+	OFEDCompatibilityMatrixFile string `env:"OFED_COMPATIBILITY_MATRIX_FILE" envDefault:""`
+	// Namespace of the ConfigMap snapshotting the CNI config last applied for each HostDeviceNetwork, the snapshot is
+	// not written if empty
+	HostDeviceNetworkConfigSnapshotNamespace string `env:"HOST_DEVICE_NETWORK_CONFIG_SNAPSHOT_NAMESPACE" envDefault:""`
+	// Whether rendered containers must have resource limits: "strict" fails the sync of states rendering containers
+	// without limits, "permissive" allows them
+	ResourceLimitsMode string `env:"RESOURCE_LIMITS_MODE" envDefault:"permissive"`
+	// Keys of the taints marking nodes under maintenance, pods which are not ready on these nodes are excluded from
+	// the readiness of DaemonSets. Nodes are not considered under maintenance if empty
+	MaintenanceTaints []string `env:"MAINTENANCE_TAINTS" envDefault:"node.kubernetes.io/unschedulable" envSeparator:","`
+	// Sync rate limits of the NicClusterPolicy states as <state name>=<rate>:<burst> entries, rate is the number of
+	// Sync invocations per second. States without a rate limit are not throttled
+	StateRateLimits []string `env:"STATE_RATE_LIMITS" envDefault:"" envSeparator:","`
+	// Scopes of the NicClusterPolicies reconciled in addition to the NicClusterPolicy with the predefined name as
+	// <policy name>=<namespace>:<node label>=<value> entries, their device plugins are confined to the namespace and
+	// nodes of their scope
+	PolicyScopes []string `env:"POLICY_SCOPES" envDefault:"" envSeparator:","`
+	// Number of node groups, e.g the OFED drivers of each OS distribution and kernel, rendered concurrently by a
+	// state. Node groups are rendered serially if lower than 2
+	RenderWorkers uint `env:"RENDER_WORKERS" envDefault:"1"`
 }
 
 // Controller related configurations
@@ -41,6 +79,48 @@ type ControllerConfig struct {
 	//nolint:stylecheck
 	// Request requeue time(seconds) in case the system still needs to be reconciled
 	RequeueTimeSeconds uint `env:"CONTROLLER_REQUEST_REQUEUE_SECONDS" envDefault:"5"`
+	// Label selector of the NicClusterPolicies reconciled by the operator, all are reconciled if empty
+	NicClusterPolicySelector string `env:"NIC_CLUSTER_POLICY_SELECTOR" envDefault:""`
+	// Skip the Sync of NicClusterPolicy states whose inputs did not change since their last ready Sync
+	SyncCacheEnabled bool `env:"SYNC_CACHE_ENABLED" envDefault:"false"`
+	// Skip the reconcile of a ready NicClusterPolicy whose generation was reconciled, unless a watched object changed
+	ReconcileSkipEnabled bool `env:"RECONCILE_SKIP_ENABLED" envDefault:"false"`
+	// Scale the requeue time of resources which are not ready with the depth of the reconcile queue
+	AdaptiveRequeueEnabled bool `env:"ADAPTIVE_REQUEUE_ENABLED" envDefault:"false"`
+	// Interval of the refresh of the number of pods attached to HostDeviceNetworks, 0 disables the count
+	AttachedPodsIntervalSeconds uint `env:"HOST_DEVICE_NETWORK_ATTACHED_PODS_INTERVAL" envDefault:"0"`
+	// Serve the validating and defaulting webhooks of the custom resources, requires the webhook server certificate
+	// to be mounted
+	WebhookEnabled bool `env:"WEBHOOK_ENABLED" envDefault:"false"`
+	// Namespace of the ConfigMap summarizing the NicClusterPolicy status, the ConfigMap is not written if empty
+	StatusConfigMapNamespace string `env:"STATUS_CONFIGMAP_NAMESPACE" envDefault:""`
+	// Kinds the states must not watch, e.g kinds the operator is not allowed to watch, as kind names or kinds
+	// qualified by their group. Kinds which are not served by the API server are never watched
+	WatchDisabledKinds []string `env:"WATCH_DISABLED_KINDS" envDefault:"" envSeparator:","`
+	// Delete the objects labeled as owned by the operator, of the kinds of the manifests, controlled by the
+	// NicClusterPolicy once it is deleted
+	PruneOnDeleteEnabled bool `env:"PRUNE_ON_DELETE_ENABLED" envDefault:"false"`
+	// File or http(s) endpoint the JSON reconcile report is written to after each full reconcile, no report is
+	// written if empty
+	ReconcileReportTarget string `env:"RECONCILE_REPORT_TARGET" envDefault:""`
+}
+
+// Tracing related configurations
+type TracingConfig struct {
+	// Export OpenTelemetry traces of reconcile operations
+	Enabled bool `env:"TRACING_ENABLED" envDefault:"false"`
+	// OTLP gRPC collector endpoint (host:port) traces are exported to
+	Endpoint string `env:"OTEL_EXPORTER_OTLP_ENDPOINT" envDefault:"localhost:4317"`
+	// Disable transport security when connecting to the collector
+	Insecure bool `env:"TRACING_INSECURE" envDefault:"false"`
+}
+
+// Debug endpoint related configurations
+type DebugConfig struct {
+	// Serve the effective operator configuration on the metrics endpoint under /debug/config
+	EndpointEnabled bool `env:"DEBUG_ENDPOINT_ENABLED" envDefault:"false"`
+	// Bearer token required to access the debug endpoint
+	Token string `env:"DEBUG_ENDPOINT_TOKEN" envDefault:""`
 }
 
 func FromEnv() *OperatorConfig {
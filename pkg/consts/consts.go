@@ -31,6 +31,9 @@ const (
 const (
 	NetworkOperatorResourceNamespace = "nvidia-network-operator-resources"
 	NicClusterPolicyResourceName     = "nic-cluster-policy"
+	NetworkOperatorOwnedLabel        = "network.nvidia.com/operator.owned"
+	SourceGenerationAnnotation       = "network.nvidia.com/operator.source-generation"
+	PruneAnnotation                  = "network.nvidia.com/prune"
 )
 
 const (
@@ -17,6 +17,8 @@ limitations under the License.
 package nodeinfo
 
 import (
+	"strings"
+
 	"github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
@@ -37,6 +39,29 @@ const (
 	NodeLabelNvGPU            = "nvidia.com/gpu.present"
 	NodeLabelWaitOFED         = "network.nvidia.com/operator.mofed.wait"
 	NodeLabelCudaVersionMajor = "nvidia.com/cuda.driver.major"
+	NodeLabelLinkLayer        = "network.nvidia.com/link-layer"
+)
+
+// Link layers of the NodeLabelLinkLayer label
+const (
+	LinkLayerInfiniBand = "infiniband"
+	LinkLayerEthernet   = "ethernet"
+)
+
+// Node annotations used by nodeinfo package
+const (
+	// NodeAnnotationDevicePluginManagedBy is set on nodes where device plugins are managed by another instance,
+	// e.g during migration to or from another deployment of the device plugins
+	NodeAnnotationDevicePluginManagedBy = "network.nvidia.com/device-plugin.managed-by"
+	// DevicePluginManagedByNetworkOperator is the NodeAnnotationDevicePluginManagedBy value of nodes where
+	// device plugins are managed by network operator
+	DevicePluginManagedByNetworkOperator = "network-operator"
+	// NodeAnnotationOFEDModulesLoaded is set on nodes where the OFED DaemonSet pod verified the OFED kernel modules
+	// are loaded, the value is the version of the OFED driver
+	NodeAnnotationOFEDModulesLoaded = "network.nvidia.com/operator.mofed.modules-loaded"
+	// NodeAnnotationKernelFeatures is set by node feature discovery to the comma separated list of the kernel
+	// config options enabled on the node, e.g CONFIG_INFINIBAND,CONFIG_MLX5_CORE
+	NodeAnnotationKernelFeatures = "network.nvidia.com/kernel-features"
 )
 
 type AttributeType int
@@ -50,6 +75,8 @@ const (
 	AttrTypeOSVer
 	// optional attrs
 	AttrTypeCudaVersionMajor
+	AttrTypeLinkLayer
+	AttrTypeKernelVerFull
 
 	OptionalAttrsStart = AttrTypeCudaVersionMajor
 )
@@ -65,6 +92,10 @@ var attrToLabel = []string{
 	NodeLabelOSVer,
 	// AttrTypeCudaVersionMajor
 	NodeLabelCudaVersionMajor,
+	// AttrTypeLinkLayer
+	NodeLabelLinkLayer,
+	// AttrTypeKernelVerFull
+	NodeLabelKernelVerFull,
 }
 
 // NodeAttributes provides attributes of a specific node
@@ -73,6 +104,12 @@ type NodeAttributes struct {
 	Name string
 	// Node Attributes
 	Attributes map[AttributeType]string
+	// Resources of the node available for scheduling
+	Allocatable corev1.ResourceList
+	// KernelFeatures enabled on the node, nil if the node is not annotated with its kernel features
+	KernelFeatures map[string]bool
+	// Taints of the node
+	Taints []corev1.Taint
 }
 
 // fromLabel adds a new attribute of type attrT to NodeAttributes by extracting value of selectedLabel
@@ -90,8 +127,13 @@ func (a *NodeAttributes) fromLabel(attrT AttributeType, nodeLabels map[string]st
 // newNodeAttributes creates a new NodeAttributes
 func newNodeAttributes(node *corev1.Node) NodeAttributes {
 	attr := NodeAttributes{
-		Name:       node.GetName(),
-		Attributes: make(map[AttributeType]string),
+		Name:        node.GetName(),
+		Attributes:  make(map[AttributeType]string),
+		Allocatable: node.Status.Allocatable,
+		Taints:      node.Spec.Taints,
+	}
+	if features, ok := node.GetAnnotations()[NodeAnnotationKernelFeatures]; ok {
+		attr.KernelFeatures = parseKernelFeatures(features)
 	}
 	var err error
 
@@ -105,3 +147,14 @@ func newNodeAttributes(node *corev1.Node) NodeAttributes {
 	}
 	return attr
 }
+
+// parseKernelFeatures parses the comma separated kernel features of the NodeAnnotationKernelFeatures annotation
+func parseKernelFeatures(features string) map[string]bool {
+	parsed := make(map[string]bool)
+	for _, feature := range strings.Split(features, ",") {
+		if feature = strings.TrimSpace(feature); feature != "" {
+			parsed[feature] = true
+		}
+	}
+	return parsed
+}
@@ -68,6 +68,28 @@ var _ = Describe("NodeAttributes tests", func() {
 		})
 	})
 
+	Context("Create NodeAttributes from node with link layer label", func() {
+		It("Should return NodeAttributes with the link layer attribute", func() {
+			testNode.Labels[NodeLabelLinkLayer] = LinkLayerInfiniBand
+			attr := newNodeAttributes(&testNode)
+			Expect(attr.Attributes[AttrTypeLinkLayer]).To(Equal(LinkLayerInfiniBand))
+		})
+	})
+
+	Context("Create NodeAttributes from node with kernel features annotation", func() {
+		It("Should return NodeAttributes with the kernel features", func() {
+			testNode.Annotations = map[string]string{
+				NodeAnnotationKernelFeatures: "CONFIG_INFINIBAND, CONFIG_MLX5_CORE,",
+			}
+			attr := newNodeAttributes(&testNode)
+			Expect(attr.KernelFeatures).To(Equal(map[string]bool{"CONFIG_INFINIBAND": true, "CONFIG_MLX5_CORE": true}))
+		})
+		It("Should return NodeAttributes without kernel features if not annotated", func() {
+			attr := newNodeAttributes(&testNode)
+			Expect(attr.KernelFeatures).To(BeNil())
+		})
+	})
+
 	Context("Create NodeAttributes with no labels", func() {
 		It("Should return NodeAttributes with no attributes", func() {
 			attr := newNodeAttributes(&testNode)
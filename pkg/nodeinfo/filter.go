@@ -16,7 +16,10 @@ limitations under the License.
 
 package nodeinfo
 
-import corev1 "k8s.io/api/core/v1"
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
 
 // A Filter applies a filter on a list of Nodes
 type Filter interface {
@@ -141,3 +144,53 @@ func (b *NodeLabelNoValFilterBuilder) Reset() *NodeLabelNoValFilterBuilder {
 	b.filter = newNodeLabelNoValFilter()
 	return b
 }
+
+// A node annotation filter which matches nodes where the annotation is set to a value other than the given value,
+// and optionally nodes where the annotation is not set.
+// use NewNodeAnnotationMismatchFilter or NewNodeAnnotationNotEqualFilter to create instances
+type nodeAnnotationMismatchFilter struct {
+	key, val     string
+	matchMissing bool
+}
+
+// Apply Filter on Nodes
+func (f *nodeAnnotationMismatchFilter) Apply(nodes []*corev1.Node) (filtered []*corev1.Node) {
+	for _, node := range nodes {
+		val, ok := node.GetAnnotations()[f.key]
+		if (ok && val != f.val) || (!ok && f.matchMissing) {
+			filtered = append(filtered, node)
+		}
+	}
+	return filtered
+}
+
+// NewNodeAnnotationMismatchFilter returns a Filter which matches nodes annotated with key set to a value other than val
+func NewNodeAnnotationMismatchFilter(key, val string) Filter {
+	return &nodeAnnotationMismatchFilter{key: key, val: val}
+}
+
+// NewNodeAnnotationNotEqualFilter returns a Filter which matches nodes where the annotation key is not set to val,
+// including nodes without the annotation
+func NewNodeAnnotationNotEqualFilter(key, val string) Filter {
+	return &nodeAnnotationMismatchFilter{key: key, val: val, matchMissing: true}
+}
+
+// A node label selector filter. use NewNodeLabelSelectorFilter to create instances
+type nodeLabelSelectorFilter struct {
+	selector labels.Selector
+}
+
+// Apply Filter on Nodes
+func (f *nodeLabelSelectorFilter) Apply(nodes []*corev1.Node) (filtered []*corev1.Node) {
+	for _, node := range nodes {
+		if f.selector.Matches(labels.Set(node.GetLabels())) {
+			filtered = append(filtered, node)
+		}
+	}
+	return filtered
+}
+
+// NewNodeLabelSelectorFilter returns a Filter which matches nodes whose labels match selector
+func NewNodeLabelSelectorFilter(selector labels.Selector) Filter {
+	return &nodeLabelSelectorFilter{selector: selector}
+}
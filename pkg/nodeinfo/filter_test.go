@@ -134,4 +134,35 @@ var _ = Describe("NodeAttributes tests", func() {
 			Expect(filteredNodes).To(BeEmpty())
 		})
 	})
+
+	Context("Filter by annotation value mismatch", func() {
+		It("Should only return nodes annotated with another value", func() {
+			annotatedNodes := []*corev1.Node{
+				{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}},
+				{ObjectMeta: metav1.ObjectMeta{Name: "node-2",
+					Annotations: map[string]string{NodeAnnotationDevicePluginManagedBy: "other"}}},
+				{ObjectMeta: metav1.ObjectMeta{Name: "node-3",
+					Annotations: map[string]string{NodeAnnotationDevicePluginManagedBy: DevicePluginManagedByNetworkOperator}}},
+			}
+			filter := NewNodeAnnotationMismatchFilter(
+				NodeAnnotationDevicePluginManagedBy, DevicePluginManagedByNetworkOperator)
+			filteredNodes := filter.Apply(annotatedNodes)
+			Expect(len(filteredNodes)).To(Equal(1))
+			Expect(filteredNodes[0].Name).To(Equal("node-2"))
+		})
+		It("Should return nodes annotated with another value or not annotated", func() {
+			annotatedNodes := []*corev1.Node{
+				{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}},
+				{ObjectMeta: metav1.ObjectMeta{Name: "node-2",
+					Annotations: map[string]string{NodeAnnotationOFEDModulesLoaded: "5.4-1.0.3.0"}}},
+				{ObjectMeta: metav1.ObjectMeta{Name: "node-3",
+					Annotations: map[string]string{NodeAnnotationOFEDModulesLoaded: "5.5-1.0.3.2"}}},
+			}
+			filter := NewNodeAnnotationNotEqualFilter(NodeAnnotationOFEDModulesLoaded, "5.5-1.0.3.2")
+			filteredNodes := filter.Apply(annotatedNodes)
+			Expect(len(filteredNodes)).To(Equal(2))
+			Expect(filteredNodes[0].Name).To(Equal("node-1"))
+			Expect(filteredNodes[1].Name).To(Equal("node-2"))
+		})
+	})
 })
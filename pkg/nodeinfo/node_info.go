@@ -22,6 +22,11 @@ package nodeinfo
 */
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+
 	corev1 "k8s.io/api/core/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
@@ -34,6 +39,30 @@ var MellanoxNICListOptions = []client.ListOption{
 type Provider interface {
 	// GetNodesAttributes retrieves node attributes for nodes matching the filter criteria
 	GetNodesAttributes(filters ...Filter) []NodeAttributes
+	// Err returns the error which occurred while listing the nodes, nil if the nodes were listed
+	Err() error
+	// Fingerprint returns a hash of the nodes which changes when a node is added or removed, or when the labels,
+	// annotations, taints or allocatable resources of a node change. It is empty if the nodes could not be listed.
+	Fingerprint() string
+}
+
+// ListError is the error of a failed node listing, which is distinct from listing no nodes
+type ListError struct {
+	Err error
+}
+
+func (e *ListError) Error() string {
+	return "failed to list nodes: " + e.Err.Error()
+}
+
+// Cause returns the error which caused the node listing to fail
+func (e *ListError) Cause() error {
+	return e.Err
+}
+
+// Unwrap returns the error which caused the node listing to fail
+func (e *ListError) Unwrap() error {
+	return e.Err
 }
 
 // NewProvider creates a new Provider object
@@ -41,9 +70,38 @@ func NewProvider(nodeList []*corev1.Node) Provider {
 	return &provider{nodes: nodeList}
 }
 
+// NewFailedProvider creates a new Provider object for a failed node listing, the provider has no nodes and
+// its Err method returns a *ListError wrapping err
+func NewFailedProvider(err error) Provider {
+	return &provider{err: &ListError{Err: err}}
+}
+
+// NewFilteredProvider creates a new Provider object providing the nodes of p which match filters, the filters are
+// applied before the filters passed to GetNodesAttributes
+func NewFilteredProvider(p Provider, filters ...Filter) Provider {
+	return &filteredProvider{Provider: p, filters: filters}
+}
+
+// filteredProvider is an implementation of the Provider interface restricting the nodes of another Provider
+type filteredProvider struct {
+	Provider
+	filters []Filter
+}
+
+// GetNodesAttributes retrieves node attributes for nodes matching the filters of the provider and filters
+func (p *filteredProvider) GetNodesAttributes(filters ...Filter) []NodeAttributes {
+	return p.Provider.GetNodesAttributes(append(append([]Filter{}, p.filters...), filters...)...)
+}
+
 // provider is an implementation of the Provider interface
 type provider struct {
 	nodes []*corev1.Node
+	err   error
+}
+
+// Err returns the error which occurred while listing the nodes, nil if the nodes were listed
+func (p *provider) Err() error {
+	return p.err
 }
 
 // GetNodesAttributes retrieves node attributes for nodes matching the filter criteria
@@ -57,3 +115,36 @@ func (p *provider) GetNodesAttributes(filters ...Filter) (attrs []NodeAttributes
 	}
 	return attrs
 }
+
+// Fingerprint returns a hash of the nodes which changes when a node is added or removed, or when the labels,
+// annotations, taints or allocatable resources of a node change. It is empty if the nodes could not be listed.
+func (p *provider) Fingerprint() string {
+	if p.err != nil {
+		return ""
+	}
+	type nodeFingerprint struct {
+		Name        string
+		Labels      map[string]string
+		Annotations map[string]string
+		Allocatable corev1.ResourceList
+		Taints      []corev1.Taint
+	}
+	nodes := make([]nodeFingerprint, 0, len(p.nodes))
+	for _, node := range p.nodes {
+		nodes = append(nodes, nodeFingerprint{
+			Name:        node.Name,
+			Labels:      node.Labels,
+			Annotations: node.Annotations,
+			Allocatable: node.Status.Allocatable,
+			Taints:      node.Spec.Taints,
+		})
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Name < nodes[j].Name })
+	// maps are encoded with sorted keys, the encoding is stable
+	data, err := json.Marshal(nodes)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
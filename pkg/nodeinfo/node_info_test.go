@@ -17,6 +17,8 @@ limitations under the License.
 package nodeinfo
 
 import (
+	"errors"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	corev1 "k8s.io/api/core/v1"
@@ -103,4 +105,48 @@ var _ = Describe("nodeinfo Provider tests", func() {
 			Expect(len(attrs)).To(Equal(0))
 		})
 	})
+
+	Context("Failed node listing", func() {
+		It("Should return the listing error and no nodes", func() {
+			listErr := errors.New("connection refused")
+			provider := NewFailedProvider(listErr)
+
+			Expect(provider.GetNodesAttributes()).To(BeEmpty())
+			var nodeListErr *ListError
+			Expect(errors.As(provider.Err(), &nodeListErr)).To(BeTrue())
+			Expect(errors.Is(provider.Err(), listErr)).To(BeTrue())
+			Expect(NewProvider([]*corev1.Node{}).Err()).NotTo(HaveOccurred())
+		})
+	})
+
+	Context("Nodes fingerprint", func() {
+		newNode := func(name string, labels map[string]string) *corev1.Node {
+			return &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+		}
+
+		It("Should not depend on the order of the nodes", func() {
+			node1 := newNode("node-1", map[string]string{NodeLabelMlnxNIC: "true"})
+			node2 := newNode("node-2", map[string]string{NodeLabelMlnxNIC: "true"})
+			Expect(NewProvider([]*corev1.Node{node1, node2}).Fingerprint()).To(
+				Equal(NewProvider([]*corev1.Node{node2, node1}).Fingerprint()))
+		})
+		It("Should change when a node label changes or a node is added", func() {
+			node1 := newNode("node-1", map[string]string{NodeLabelMlnxNIC: "true"})
+			fingerprint := NewProvider([]*corev1.Node{node1}).Fingerprint()
+			Expect(fingerprint).NotTo(BeEmpty())
+
+			Expect(NewProvider([]*corev1.Node{node1, newNode("node-2", nil)}).Fingerprint()).NotTo(Equal(fingerprint))
+			node1.Labels[NodeLabelLinkLayer] = LinkLayerEthernet
+			Expect(NewProvider([]*corev1.Node{node1}).Fingerprint()).NotTo(Equal(fingerprint))
+		})
+		It("Should change when a node taint changes", func() {
+			node1 := newNode("node-1", map[string]string{NodeLabelMlnxNIC: "true"})
+			fingerprint := NewProvider([]*corev1.Node{node1}).Fingerprint()
+			node1.Spec.Taints = []corev1.Taint{{Key: "nvidia.com/gpu", Effect: corev1.TaintEffectNoSchedule}}
+			Expect(NewProvider([]*corev1.Node{node1}).Fingerprint()).NotTo(Equal(fingerprint))
+		})
+		It("Should be empty for a failed node listing", func() {
+			Expect(NewFailedProvider(errors.New("connection refused")).Fingerprint()).To(BeEmpty())
+		})
+	})
 })
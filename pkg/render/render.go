@@ -40,6 +40,11 @@ import (
 
 var ManifestFileSuffix = []string{"yaml", "yml", "json"}
 
+// PartialsFileName is the name, without suffix, of the manifest file holding the templates shared by the other
+// manifest files, e.g common labels. The templates are defined with `define` and included with `template`, the
+// partials file itself renders no object.
+const PartialsFileName = "_partials"
+
 // Renderer renders k8s objects from a manifest source dir and TemplatingData used by the templating engine
 type Renderer interface {
 	// RenderObjects renders kubernetes objects using provided TemplatingData
@@ -68,12 +73,20 @@ type textTemplateRenderer struct {
 	files []string
 }
 
-// RenderObjects renders kubernetes objects utilizing the provided TemplatingData.
+// RenderObjects renders kubernetes objects utilizing the provided TemplatingData. All the files are parsed into a
+// single template set so each file can include the templates defined in the partials file.
 func (r *textTemplateRenderer) RenderObjects(data *TemplatingData) ([]*unstructured.Unstructured, error) {
 	objs := []*unstructured.Unstructured{}
 
+	tmpl, err := r.parseFiles(data)
+	if err != nil {
+		return nil, err
+	}
 	for _, file := range r.files {
-		out, err := r.renderFile(file, data)
+		if isPartialsFile(file) {
+			continue
+		}
+		out, err := r.renderFile(tmpl, file, data)
 		if err != nil {
 			return nil, err
 		}
@@ -82,6 +95,12 @@ func (r *textTemplateRenderer) RenderObjects(data *TemplatingData) ([]*unstructu
 	return objs, nil
 }
 
+// isPartialsFile checks if filePath is a partials file, its templates are only rendered when included
+func isPartialsFile(filePath string) bool {
+	base := path.Base(filePath)
+	return strings.TrimSuffix(base, path.Ext(base)) == PartialsFileName
+}
+
 func indent(spaces int, v string) string {
 	pad := strings.Repeat(" ", spaces)
 	return pad + strings.Replace(v, "\n", "\n"+pad, -1)
@@ -97,16 +116,10 @@ func nindentPrefix(spaces int, prefix, v string) string {
 	return strings.Replace(nindent(spaces, prefix+v), " ", "", len(prefix))
 }
 
-// renderFile renders a single file to a list of k8s unstructured objects
-func (r *textTemplateRenderer) renderFile(filePath string, data *TemplatingData) ([]*unstructured.Unstructured, error) {
-	// Read file
-	txt, err := ioutil.ReadFile(filePath)
-	if err != nil {
-		return nil, errors.Wrapf(err, "failed to read manifest file %s", filePath)
-	}
-
-	// Create a new template
-	tmpl := template.New(path.Base(filePath)).Option("missingkey=error")
+// parseFiles parses the files into a single template set, each file is parsed as a template named after its path
+func (r *textTemplateRenderer) parseFiles(data *TemplatingData) (*template.Template, error) {
+	// Create a new template, fail on missing map keys instead of rendering "<no value>"
+	tmpl := template.New("").Option("missingkey=error")
 	tmpl.Funcs(template.FuncMap{
 		"yaml": func(obj interface{}) (string, error) {
 			yamlBytes, err := yamlConverter.Marshal(obj)
@@ -121,12 +134,24 @@ func (r *textTemplateRenderer) renderFile(filePath string, data *TemplatingData)
 		tmpl.Funcs(data.Funcs)
 	}
 
-	if _, err := tmpl.Parse(string(txt)); err != nil {
-		return nil, errors.Wrapf(err, "failed to parse manifest file %s", filePath)
+	for _, filePath := range r.files {
+		txt, err := ioutil.ReadFile(filePath)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read manifest file %s", filePath)
+		}
+		if _, err := tmpl.New(filePath).Parse(string(txt)); err != nil {
+			return nil, errors.Wrapf(err, "failed to parse manifest file %s", filePath)
+		}
 	}
+	return tmpl, nil
+}
+
+// renderFile renders a single file parsed in tmpl to a list of k8s unstructured objects
+func (r *textTemplateRenderer) renderFile(
+	tmpl *template.Template, filePath string, data *TemplatingData) ([]*unstructured.Unstructured, error) {
 	rendered := bytes.Buffer{}
 
-	if err := tmpl.Execute(&rendered, data.Data); err != nil {
+	if err := tmpl.ExecuteTemplate(&rendered, filePath, data.Data); err != nil {
 		return nil, errors.Wrapf(err, "failed to render manifest %s", filePath)
 	}
 
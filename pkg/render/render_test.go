@@ -104,6 +104,16 @@ var _ = Describe("Test Renderer via API", func() {
 		})
 	})
 
+	Context("Render objects from template referencing a missing key", func() {
+		It("Should fail instead of rendering <no value>", func() {
+			r := render.NewRenderer(getFilesFromDir(filepath.Join(manifestsTestDir, "missingKeyManifests")))
+			objs, err := r.RenderObjects(&render.TemplatingData{Data: map[string]string{"Foo": "foo"}})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring(`map has no entry for key "Missing"`))
+			Expect(objs).To(BeNil())
+		})
+	})
+
 	Context("Render objects from valid manifests dir", func() {
 		It("Should return objects in order as appear in the directory lexicographically", func() {
 			r := render.NewRenderer(getFilesFromDir(filepath.Join(manifestsTestDir, "manifests")))
@@ -123,4 +133,23 @@ var _ = Describe("Test Renderer via API", func() {
 			checkRenderedUnstructured(objs, t.Data.(*templateData))
 		})
 	})
+
+	Context("Render objects from templates including partials", func() {
+		It("Should render the included partials and no object from the partials file", func() {
+			r := render.NewRenderer(getFilesFromDir(filepath.Join(manifestsTestDir, "partialsManifests")))
+			objs, err := r.RenderObjects(t)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(len(objs)).To(Equal(2))
+			checkRenderedUnstructured(objs, t.Data.(*templateData))
+			for _, obj := range objs {
+				Expect(obj.GetLabels()).To(Equal(map[string]string{"app": "foo"}))
+			}
+		})
+		It("Should fail to include an undefined partial", func() {
+			r := render.NewRenderer([]string{filepath.Join(manifestsTestDir, "partialsManifests", "0001_obj.yaml")})
+			objs, err := r.RenderObjects(t)
+			Expect(err).To(HaveOccurred())
+			Expect(objs).To(BeNil())
+		})
+	})
 })
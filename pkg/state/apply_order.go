@@ -0,0 +1,56 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"sort"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// applyOrderHint selects the objects of a state which are applied ahead of its other objects, an empty Name selects
+// all the objects of Kind
+type applyOrderHint struct {
+	Kind string
+	Name string
+}
+
+// matches checks if the hint selects obj
+func (h applyOrderHint) matches(obj *unstructured.Unstructured) bool {
+	return obj.GetKind() == h.Kind && (h.Name == "" || obj.GetName() == h.Name)
+}
+
+// orderObjects returns objs in the order they are applied in. Objects selected by hints are applied first, ordered
+// by the first hint selecting them, the other objects keep their default order which follows the manifest files.
+// objs is returned as is if there are no hints.
+func orderObjects(objs []*unstructured.Unstructured, hints []applyOrderHint) []*unstructured.Unstructured {
+	if len(hints) == 0 {
+		return objs
+	}
+	rank := func(obj *unstructured.Unstructured) int {
+		for i, hint := range hints {
+			if hint.matches(obj) {
+				return i
+			}
+		}
+		return len(hints)
+	}
+	ordered := make([]*unstructured.Unstructured, len(objs))
+	copy(ordered, objs)
+	sort.SliceStable(ordered, func(i, j int) bool { return rank(ordered[i]) < rank(ordered[j]) })
+	return ordered
+}
@@ -0,0 +1,92 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// createOrderClient records the order objects are created in
+type createOrderClient struct {
+	client.Client
+	created []string
+}
+
+func (c *createOrderClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	c.created = append(c.created, obj.GetObjectKind().GroupVersionKind().Kind+"/"+obj.GetName())
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+var _ = Describe("Apply order tests", func() {
+	newObj := func(apiVersion, kind, name string) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{}
+		obj.SetAPIVersion(apiVersion)
+		obj.SetKind(kind)
+		obj.SetName(name)
+		obj.SetNamespace("default")
+		return obj
+	}
+	names := func(objs []*unstructured.Unstructured) []string {
+		result := make([]string, 0, len(objs))
+		for _, obj := range objs {
+			result = append(result, obj.GetKind()+"/"+obj.GetName())
+		}
+		return result
+	}
+
+	var objs []*unstructured.Unstructured
+
+	BeforeEach(func() {
+		objs = []*unstructured.Unstructured{
+			newObj("v1", "ServiceAccount", "sa"),
+			newObj("apps/v1", "DaemonSet", "ds"),
+			newObj("v1", "ConfigMap", "cm-a"),
+			newObj("v1", "ConfigMap", "cm-b"),
+		}
+	})
+
+	It("Should keep the default order without hints", func() {
+		Expect(names(orderObjects(objs, nil))).To(Equal(
+			[]string{"ServiceAccount/sa", "DaemonSet/ds", "ConfigMap/cm-a", "ConfigMap/cm-b"}))
+	})
+	It("Should order objects selected by hints first in hint order", func() {
+		ordered := orderObjects(objs, []applyOrderHint{{Kind: "ConfigMap", Name: "cm-b"}, {Kind: "ConfigMap"}})
+		Expect(names(ordered)).To(Equal(
+			[]string{"ConfigMap/cm-b", "ConfigMap/cm-a", "ServiceAccount/sa", "DaemonSet/ds"}))
+		Expect(names(objs)).To(Equal(
+			[]string{"ServiceAccount/sa", "DaemonSet/ds", "ConfigMap/cm-a", "ConfigMap/cm-b"}))
+	})
+	It("Should apply the objects of a state in the order of its hints", func() {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		c := &createOrderClient{Client: fake.NewClientBuilder().WithScheme(scheme).Build()}
+		s := stateSkel{name: "test", scheme: scheme, applyOrder: []applyOrderHint{{Kind: "ConfigMap"}}}
+		Expect(s.createOrUpdateObjs(context.Background(), c,
+			func(obj *unstructured.Unstructured) error { return nil }, objs)).To(Succeed())
+		Expect(c.created).To(Equal(
+			[]string{"ConfigMap/cm-a", "ConfigMap/cm-b", "ServiceAccount/sa", "DaemonSet/ds"}))
+	})
+})
@@ -0,0 +1,44 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ClientProvider provides the kubernetes API client used by states to reconcile a custom resource.
+// States also update the custom resource through the provided client, e.g the MacvlanNetwork state records the
+// namespace of its NetworkAttachmentDefinition in an annotation, it must therefore be a client of the cluster the
+// custom resource exists on.
+type ClientProvider interface {
+	// GetClient returns the client used to reconcile the custom resource
+	GetClient(customResource interface{}) (client.Client, error)
+}
+
+// NewStaticClientProvider creates a ClientProvider which provides the same client for all custom resources
+func NewStaticClientProvider(k8sAPIClient client.Client) ClientProvider {
+	return &staticClientProvider{client: k8sAPIClient}
+}
+
+type staticClientProvider struct {
+	client client.Client
+}
+
+// GetClient returns the client used to reconcile the custom resource
+func (p *staticClientProvider) GetClient(_ interface{}) (client.Client, error) {
+	return p.client, nil
+}
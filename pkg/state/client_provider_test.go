@@ -0,0 +1,87 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	appsv1 "k8s.io/api/apps/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	mellanoxv1alpha1 "github.com/Mellanox/network-operator/api/v1alpha1"
+	"github.com/Mellanox/network-operator/pkg/consts"
+)
+
+var _ = Describe("Client provider tests", func() {
+	var (
+		s              *runtime.Scheme
+		otherClient    client.Client
+		selectedClient client.Client
+		provider       ClientProvider
+		cr             *mellanoxv1alpha1.NicClusterPolicy
+	)
+
+	BeforeEach(func() {
+		s = runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(s)).To(Succeed())
+		Expect(mellanoxv1alpha1.AddToScheme(s)).To(Succeed())
+		otherClient = fake.NewClientBuilder().WithScheme(s).Build()
+		selectedClient = fake.NewClientBuilder().WithScheme(s).Build()
+		provider = NewStaticClientProvider(selectedClient)
+
+		cr = &mellanoxv1alpha1.NicClusterPolicy{}
+		cr.Name = consts.NicClusterPolicyResourceName
+		cr.Spec.SecondaryNetwork = &mellanoxv1alpha1.SecondaryNetworkSpec{
+			Multus: &mellanoxv1alpha1.MultusSpec{
+				ImageSpec: mellanoxv1alpha1.ImageSpec{
+					Image:      "multus",
+					Repository: "repository",
+					Version:    "v0.0",
+				},
+			},
+		}
+	})
+
+	getDaemonSet := func(c client.Client) (*appsv1.DaemonSet, error) {
+		ds := &appsv1.DaemonSet{}
+		err := c.Get(context.TODO(),
+			types.NamespacedName{Name: "kube-multus-ds", Namespace: consts.NetworkOperatorResourceNamespace}, ds)
+		return ds, err
+	}
+
+	It("Should apply state objects with the client selected by the provider", func() {
+		multusState, err := NewStateMultusCNI(provider, s, "../../manifests/stage-multus-cni")
+		Expect(err).NotTo(HaveOccurred())
+
+		syncState, err := multusState.Sync(context.Background(), cr, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(syncState).To(Equal(SyncState(SyncStateNotReady)))
+
+		_, err = getDaemonSet(selectedClient)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = getDaemonSet(otherClient)
+		Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+	})
+})
@@ -0,0 +1,158 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/version"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	mellanoxv1alpha1 "github.com/Mellanox/network-operator/api/v1alpha1"
+	"github.com/Mellanox/network-operator/pkg/consts"
+)
+
+// hostDeviceConfigKeys maps the keys of the host-device CNI plugin config to the first CNI plugins version
+// supporting them
+var hostDeviceConfigKeys = map[string]*version.Version{
+	"cniVersion":    version.MustParseGeneric("0.7.0"),
+	"name":          version.MustParseGeneric("0.7.0"),
+	"type":          version.MustParseGeneric("0.7.0"),
+	"ipam":          version.MustParseGeneric("0.7.0"),
+	"device":        version.MustParseGeneric("0.7.0"),
+	"hwaddr":        version.MustParseGeneric("0.7.0"),
+	"kernelpath":    version.MustParseGeneric("0.7.0"),
+	"pciBusID":      version.MustParseGeneric("0.7.0"),
+	"capabilities":  version.MustParseGeneric("0.8.0"),
+	"runtimeConfig": version.MustParseGeneric("0.8.6"),
+}
+
+// cniPluginsBinaries maps the plugin binaries installed in the CNI bin dir by the CNI plugins to the first CNI plugins
+// version providing them
+var cniPluginsBinaries = map[string]*version.Version{
+	"bandwidth":   version.MustParseGeneric("0.7.0"),
+	"bridge":      version.MustParseGeneric("0.7.0"),
+	"dhcp":        version.MustParseGeneric("0.7.0"),
+	"flannel":     version.MustParseGeneric("0.7.0"),
+	"host-device": version.MustParseGeneric("0.7.0"),
+	"host-local":  version.MustParseGeneric("0.7.0"),
+	"ipvlan":      version.MustParseGeneric("0.7.0"),
+	"loopback":    version.MustParseGeneric("0.7.0"),
+	"macvlan":     version.MustParseGeneric("0.7.0"),
+	"portmap":     version.MustParseGeneric("0.7.0"),
+	"ptp":         version.MustParseGeneric("0.7.0"),
+	"static":      version.MustParseGeneric("0.7.0"),
+	"tuning":      version.MustParseGeneric("0.7.0"),
+	"vlan":        version.MustParseGeneric("0.7.0"),
+	"firewall":    version.MustParseGeneric("0.8.0"),
+	"sbr":         version.MustParseGeneric("0.8.0"),
+	"vrf":         version.MustParseGeneric("0.9.0"),
+}
+
+// getCNIPluginsVersion returns the CNI plugins version deployed by the cni-plugins state of the NicClusterPolicy,
+// an empty string is returned if the CNI plugins are not deployed by the operator.
+func getCNIPluginsVersion(ctx context.Context, c client.Client) string {
+	cr := &mellanoxv1alpha1.NicClusterPolicy{}
+	if err := c.Get(ctx, types.NamespacedName{Name: consts.NicClusterPolicyResourceName}, cr); err != nil {
+		log.V(consts.LogLevelDebug).Info("Unable to get NicClusterPolicy", "error:", err)
+		return ""
+	}
+	if cr.Spec.SecondaryNetwork == nil || cr.Spec.SecondaryNetwork.CniPlugins == nil {
+		return ""
+	}
+	return cr.Spec.SecondaryNetwork.CniPlugins.Version
+}
+
+// getUnsupportedCNIConfigKeys returns a warning for each key of the CNI config which is not supported by the CNI
+// plugins version, supportedKeys maps the keys known to the plugin to the first version supporting them.
+// Configs are not checked if the version can not be parsed, e.g an image digest.
+func getUnsupportedCNIConfigKeys(
+	cniConfig, pluginsVersion string, supportedKeys map[string]*version.Version) []string {
+	ver, err := version.ParseGeneric(pluginsVersion)
+	if err != nil {
+		log.V(consts.LogLevelDebug).Info("Skipping CNI config validation, unable to parse CNI plugins version",
+			"version", pluginsVersion)
+		return nil
+	}
+	config := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(cniConfig), &config); err != nil {
+		return []string{fmt.Sprintf("failed to parse CNI config: %v", err)}
+	}
+
+	keys := make([]string, 0, len(config))
+	for key := range config {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var warnings []string
+	for _, key := range keys {
+		since, ok := supportedKeys[key]
+		if !ok {
+			warnings = append(warnings, fmt.Sprintf("CNI config key %q is not supported by CNI plugins %s",
+				key, pluginsVersion))
+			continue
+		}
+		if ver.LessThan(since) {
+			warnings = append(warnings, fmt.Sprintf("CNI config key %q requires CNI plugins %s or newer, "+
+				"installed version is %s", key, since, pluginsVersion))
+		}
+	}
+	return warnings
+}
+
+// getUnavailableCNITypes returns a warning for each plugin type of the CNI config, including the plugins of a config
+// list, whose binary is not installed by the CNI plugins version. Types are only checked against the version providing
+// them if the version can be parsed. Configs which can not be parsed are reported by getUnsupportedCNIConfigKeys.
+func getUnavailableCNITypes(cniConfig, pluginsVersion string) []string {
+	config := struct {
+		Type    string `json:"type"`
+		Plugins []struct {
+			Type string `json:"type"`
+		} `json:"plugins"`
+	}{}
+	if err := json.Unmarshal([]byte(cniConfig), &config); err != nil {
+		return nil
+	}
+	types := []string{config.Type}
+	for _, plugin := range config.Plugins {
+		types = append(types, plugin.Type)
+	}
+
+	ver, verErr := version.ParseGeneric(pluginsVersion)
+	var warnings []string
+	for _, cniType := range types {
+		if cniType == "" {
+			continue
+		}
+		since, ok := cniPluginsBinaries[cniType]
+		if !ok {
+			warnings = append(warnings, fmt.Sprintf("CNI type %q is not provided by CNI plugins %s",
+				cniType, pluginsVersion))
+			continue
+		}
+		if verErr == nil && ver.LessThan(since) {
+			warnings = append(warnings, fmt.Sprintf("CNI type %q requires CNI plugins %s or newer, "+
+				"installed version is %s", cniType, since, pluginsVersion))
+		}
+	}
+	return warnings
+}
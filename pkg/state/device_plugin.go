@@ -0,0 +1,547 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/version"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	mellanoxv1alpha1 "github.com/Mellanox/network-operator/api/v1alpha1"
+	"github.com/Mellanox/network-operator/pkg/consts"
+	"github.com/Mellanox/network-operator/pkg/nodeinfo"
+)
+
+// Default gRPC health service ports, device plugins run with host network so each plugin gets a distinct port which
+// does not overlap kubelet (10248, 10250), kube-proxy (10249, 10256) or node-exporter (9100) ports.
+const (
+	sriovDpDefaultHealthPort  = 9101
+	sharedDpDefaultHealthPort = 9102
+)
+
+// Labels of the nodes a device plugin must not be deployed on, the device plugin DaemonSet excludes the labeled nodes
+// with a constant node affinity term so the Pod template, and the device plugin Pods, are left unchanged when the
+// skipped nodes change
+const (
+	sriovDpSkipNodeLabel  = "network.nvidia.com/operator.sriov-device-plugin.skip"
+	sharedDpSkipNodeLabel = "network.nvidia.com/operator.rdma-shared-device-plugin.skip"
+)
+
+// dpHealthPortDefaultName is the default name of the container port the gRPC health service listens on
+const dpHealthPortDefaultName = "health"
+
+// Default readiness probe settings used when the health service is enabled without explicit probe settings
+const (
+	dpHealthProbeDefaultInitialDelaySeconds = 10
+	dpHealthProbeDefaultPeriodSeconds       = 30
+)
+
+// Default liveness probe settings of the kubelet registration check, the initial delay leaves the device plugin time to
+// register after it starts
+const (
+	dpRegistrationProbeDefaultInitialDelaySeconds = 60
+	dpRegistrationProbeDefaultPeriodSeconds       = 30
+)
+
+// dpRegistrationCheckScript exits with an error if the device plugin is not registered with the kubelet. The kubelet
+// removes the sockets of the device plugins from the device plugins directory when it restarts, a device plugin
+// which did not re-register is left without a socket newer than the kubelet socket. The sockets of the device plugin
+// are looked up from the socket file descriptors of the device plugin process, which is PID 1 of the container.
+const dpRegistrationCheckScript = `dir=/var/lib/kubelet/device-plugins
+for inode in $(ls -l /proc/1/fd | sed -n 's/.*socket:\[\([0-9]*\)\]$/\1/p'); do
+  for sock in $(awk -v inode="$inode" -v dir="$dir/" '$7 == inode && index($8, dir) == 1 {print $8}' /proc/net/unix); do
+    [ -S "$sock" ] && [ ! "$dir/kubelet.sock" -nt "$sock" ] && exit 0
+  done
+done
+echo "device plugin is not registered with the kubelet"
+exit 1
+`
+
+// legacyDevicePluginSockets describes sockets which legacy device plugin versions create in the kubelet device
+// plugins directory
+type legacyDevicePluginSockets struct {
+	// sockets are file names in the kubelet device plugins directory
+	sockets []string
+	// sinceVersion is the first device plugin version which no longer uses the sockets
+	sinceVersion *version.Version
+}
+
+// Known sockets of legacy device plugin versions
+var (
+	sriovDpLegacySockets = legacyDevicePluginSockets{
+		sockets:      []string{"sriovNet.sock"},
+		sinceVersion: version.MustParseGeneric("3.0.0"),
+	}
+	sharedDpLegacySockets = legacyDevicePluginSockets{
+		sockets:      []string{"rdma-hca.sock"},
+		sinceVersion: version.MustParseGeneric("1.0.0"),
+	}
+)
+
+// Orders of the steps of the device plugin init container chain
+const (
+	dpInitOrderOFEDValidation  = 10
+	dpInitOrderSocketMigration = 20
+)
+
+// getDevicePluginInitContainers returns the init containers of a device plugin in the order they run: waiting for the
+// OFED driver modules when the OFED driver is deployed, then removing the legacy sockets, if any. socketVolume is the
+// name of the volume of the kubelet directory in the device plugin Pod.
+func getDevicePluginInitContainers(spec *mellanoxv1alpha1.DevicePluginSpec, waitOFED bool, legacySockets []string,
+	socketVolume string) ([]v1.Container, error) {
+	image := fmt.Sprintf("%s/%s:%s", spec.Repository, spec.Image, spec.Version)
+	var steps []initContainerStep
+	if waitOFED {
+		steps = append(steps, initContainerStep{
+			Order: dpInitOrderOFEDValidation,
+			Container: v1.Container{
+				Name:            "ofed-driver-validation",
+				Image:           image,
+				ImagePullPolicy: v1.PullIfNotPresent,
+				Command:         []string{"sh", "-c"},
+				Args: []string{
+					"until lsmod | grep mlx5_core; do echo waiting for OFED drivers to be loaded; sleep 30; done"},
+			},
+		})
+	}
+	if len(legacySockets) != 0 {
+		steps = append(steps, initContainerStep{
+			Order: dpInitOrderSocketMigration,
+			Container: v1.Container{
+				Name:            "device-plugin-socket-migration",
+				Image:           image,
+				ImagePullPolicy: v1.PullIfNotPresent,
+				Command:         []string{"sh", "-c"},
+				Args: []string{fmt.Sprintf("for sock in %s; do rm -fv /var/lib/kubelet/device-plugins/$sock; done",
+					strings.Join(legacySockets, " "))},
+				VolumeMounts: []v1.VolumeMount{{Name: socketVolume, MountPath: "/var/lib/kubelet/"}},
+			},
+		})
+	}
+	return chainInitContainers(steps)
+}
+
+// getDevicePluginLegacySockets returns the legacy sockets to be removed before the device plugin starts, nil is
+// returned if socket migration is not enabled. The sockets are only returned if the device plugin version no longer
+// uses them so the active socket is never removed, versions which can not be parsed are not migrated.
+func getDevicePluginLegacySockets(spec *mellanoxv1alpha1.DevicePluginSpec, legacy legacyDevicePluginSockets) []string {
+	if spec.SocketMigration == nil || !spec.SocketMigration.Enabled {
+		return nil
+	}
+	ver, err := version.ParseGeneric(spec.Version)
+	if err != nil {
+		log.V(consts.LogLevelWarning).Info("Skipping legacy socket migration, unable to parse device plugin version",
+			"version", spec.Version)
+		return nil
+	}
+	if ver.LessThan(legacy.sinceVersion) {
+		log.V(consts.LogLevelInfo).Info("Skipping legacy socket migration, device plugin version uses legacy sockets",
+			"version", spec.Version)
+		return nil
+	}
+	return legacy.sockets
+}
+
+// devicePluginScratchVolume is the render data of the memory-backed scratch volume of a device plugin
+type devicePluginScratchVolume struct {
+	MountPath string
+	// SizeLimit of the volume, not limited if empty
+	SizeLimit string
+}
+
+// getDevicePluginScratchVolume validates the scratch volume of the device plugin and returns its render data, nil is
+// returned if the scratch volume is not set.
+func getDevicePluginScratchVolume(spec *mellanoxv1alpha1.DevicePluginSpec) (*devicePluginScratchVolume, error) {
+	if spec.ScratchVolume == nil {
+		return nil, nil
+	}
+	mountPath := spec.ScratchVolume.MountPath
+	if !path.IsAbs(mountPath) || path.Clean(mountPath) != strings.TrimSuffix(mountPath, "/") {
+		return nil, errors.Errorf("invalid scratch volume mount path %q, must be an absolute path", mountPath)
+	}
+	volume := &devicePluginScratchVolume{MountPath: mountPath}
+	if spec.ScratchVolume.SizeLimit != "" {
+		sizeLimit, err := resource.ParseQuantity(spec.ScratchVolume.SizeLimit)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid scratch volume size limit")
+		}
+		if sizeLimit.Sign() <= 0 {
+			return nil, errors.Errorf("invalid scratch volume size limit %s, size limit must be positive",
+				spec.ScratchVolume.SizeLimit)
+		}
+		volume.SizeLimit = sizeLimit.String()
+	}
+	return volume, nil
+}
+
+// devicePluginCPU is the render data of the CPU configuration of a device plugin
+type devicePluginCPU struct {
+	// GOMAXPROCS of the device plugin, the Go runtime default is kept if 0
+	GOMAXPROCS int
+	// Resources of the device plugin containers placed on exclusive CPUs, not rendered if nil
+	Resources *v1.ResourceRequirements
+}
+
+// getDevicePluginCPU validates the CPU configuration of the device plugin and returns its render data, nil is returned
+// if the CPU configuration is not set. The static CPU manager policy only places containers of Guaranteed Pods which
+// request an integer number of CPUs on exclusive CPUs, the resources are therefore both requested and limited.
+func getDevicePluginCPU(spec *mellanoxv1alpha1.DevicePluginSpec) (*devicePluginCPU, error) {
+	if spec.CPU == nil {
+		return nil, nil
+	}
+	if spec.CPU.GOMAXPROCS < 0 {
+		return nil, errors.Errorf("invalid GOMAXPROCS %d, GOMAXPROCS must be positive", spec.CPU.GOMAXPROCS)
+	}
+	cpu := &devicePluginCPU{GOMAXPROCS: spec.CPU.GOMAXPROCS}
+	placement := spec.CPU.StaticPlacement
+	if placement == nil {
+		return cpu, nil
+	}
+	cpus, err := resource.ParseQuantity(placement.CPUs)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid static placement CPUs")
+	}
+	if cpus.Sign() <= 0 || cpus.MilliValue()%1000 != 0 {
+		return nil, errors.Errorf("invalid static placement CPUs %s, the static CPU manager policy requires a "+
+			"positive integer number of CPUs", placement.CPUs)
+	}
+	memory, err := resource.ParseQuantity(placement.Memory)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid static placement memory")
+	}
+	if memory.Sign() <= 0 {
+		return nil, errors.Errorf("invalid static placement memory %s, memory must be positive", placement.Memory)
+	}
+	resources := v1.ResourceList{v1.ResourceCPU: cpus, v1.ResourceMemory: memory}
+	cpu.Resources = &v1.ResourceRequirements{Requests: resources, Limits: resources.DeepCopy()}
+	return cpu, nil
+}
+
+// setDevicePluginInitContainersResources sets the resources of the device plugin containers placed on exclusive CPUs
+// on the init containers as well, a Pod is only Guaranteed if all of its containers request their limits
+func setDevicePluginInitContainersResources(initContainers []v1.Container, cpu *devicePluginCPU) {
+	if cpu == nil || cpu.Resources == nil {
+		return
+	}
+	for i := range initContainers {
+		initContainers[i].Resources = *cpu.Resources.DeepCopy()
+	}
+}
+
+// getDevicePluginHealthCheck returns the device plugin gRPC health service configuration with defaults applied,
+// nil is returned if the health service is not enabled. The port is declared as a named container port.
+func getDevicePluginHealthCheck(
+	spec *mellanoxv1alpha1.DevicePluginSpec, defaultPort int) (*mellanoxv1alpha1.DevicePluginHealthCheckSpec, error) {
+	if spec.HealthCheck == nil || !spec.HealthCheck.Enabled {
+		return nil, nil
+	}
+
+	healthCheck := spec.HealthCheck.DeepCopy()
+	if healthCheck.Port == 0 {
+		healthCheck.Port = defaultPort
+	}
+	if errs := validation.IsValidPortNum(healthCheck.Port); len(errs) != 0 {
+		return nil, errors.Errorf("invalid health check port %d: %s", healthCheck.Port, strings.Join(errs, ", "))
+	}
+	if healthCheck.PortName == "" {
+		healthCheck.PortName = dpHealthPortDefaultName
+	}
+	if errs := validation.IsValidPortName(healthCheck.PortName); len(errs) != 0 {
+		return nil, errors.Errorf("invalid health check port name %s: %s", healthCheck.PortName,
+			strings.Join(errs, ", "))
+	}
+	if healthCheck.ReadinessProbe == nil {
+		healthCheck.ReadinessProbe = &mellanoxv1alpha1.PodProbeSpec{
+			InitialDelaySeconds: dpHealthProbeDefaultInitialDelaySeconds,
+			PeriodSeconds:       dpHealthProbeDefaultPeriodSeconds,
+		}
+	}
+	return healthCheck, nil
+}
+
+// devicePluginSkippedNodes tracks the nodes where a device plugin state defers to a device plugin managed by
+// another instance
+type devicePluginSkippedNodes struct {
+	skippedNodes []string
+}
+
+// SkippedNodes returns the nodes skipped by the last Sync invocation
+func (d *devicePluginSkippedNodes) SkippedNodes() []string {
+	return d.skippedNodes
+}
+
+// getNodesManagedByOtherInstance returns the names of nodes with Mellanox NICs which are annotated as having
+// their device plugins managed by another instance
+func getNodesManagedByOtherInstance(nodeInfo nodeinfo.Provider) []string {
+	attrs := nodeInfo.GetNodesAttributes(
+		nodeinfo.NewNodeLabelFilterBuilder().WithLabel(nodeinfo.NodeLabelMlnxNIC, "true").Build(),
+		nodeinfo.NewNodeAnnotationMismatchFilter(
+			nodeinfo.NodeAnnotationDevicePluginManagedBy, nodeinfo.DevicePluginManagedByNetworkOperator))
+	nodes := make([]string, 0, len(attrs))
+	for _, attr := range attrs {
+		nodes = append(nodes, attr.Name)
+	}
+	return nodes
+}
+
+// getNodesWithoutVerifiedOFED returns the names of nodes with Mellanox NICs where the OFED DaemonSet did not verify
+// yet that the OFED kernel modules of the deployed driver version are loaded, nil if OFED is not deployed
+func getNodesWithoutVerifiedOFED(cr *mellanoxv1alpha1.NicClusterPolicy, nodeInfo nodeinfo.Provider) []string {
+	if cr.Spec.OFEDDriver == nil {
+		return nil
+	}
+	attrs := nodeInfo.GetNodesAttributes(
+		nodeinfo.NewNodeLabelFilterBuilder().WithLabel(nodeinfo.NodeLabelMlnxNIC, "true").Build(),
+		nodeinfo.NewNodeAnnotationNotEqualFilter(nodeinfo.NodeAnnotationOFEDModulesLoaded, cr.Spec.OFEDDriver.Version))
+	nodes := make([]string, 0, len(attrs))
+	for _, attr := range attrs {
+		nodes = append(nodes, attr.Name)
+	}
+	return nodes
+}
+
+// getNodesWithOtherLinkLayer returns the names of nodes with Mellanox NICs which are not labeled with the link layer
+// of the device plugin, nil if the device plugin link layer is not set
+func getNodesWithOtherLinkLayer(spec *mellanoxv1alpha1.DevicePluginSpec, nodeInfo nodeinfo.Provider) []string {
+	if spec.LinkLayer == "" {
+		return nil
+	}
+	attrs := nodeInfo.GetNodesAttributes(
+		nodeinfo.NewNodeLabelFilterBuilder().WithLabel(nodeinfo.NodeLabelMlnxNIC, "true").Build())
+	nodes := make([]string, 0, len(attrs))
+	for _, attr := range attrs {
+		if attr.Attributes[nodeinfo.AttrTypeLinkLayer] != spec.LinkLayer {
+			nodes = append(nodes, attr.Name)
+		}
+	}
+	return nodes
+}
+
+// getNodesMissingKernelFeatures returns the names of nodes with Mellanox NICs which lack kernel features required by
+// the device plugin, along with a warning per node listing the missing features. Nodes which are not annotated with
+// their kernel features are reported as lacking all of them. nil is returned if no kernel features are required.
+func getNodesMissingKernelFeatures(
+	spec *mellanoxv1alpha1.DevicePluginSpec, nodeInfo nodeinfo.Provider) (nodes, warnings []string) {
+	if len(spec.RequiredKernelFeatures) == 0 {
+		return nil, nil
+	}
+	attrs := nodeInfo.GetNodesAttributes(
+		nodeinfo.NewNodeLabelFilterBuilder().WithLabel(nodeinfo.NodeLabelMlnxNIC, "true").Build())
+	for _, attr := range attrs {
+		if attr.KernelFeatures == nil {
+			nodes = append(nodes, attr.Name)
+			warnings = append(warnings, fmt.Sprintf("node %s does not report its kernel features with the %s annotation",
+				attr.Name, nodeinfo.NodeAnnotationKernelFeatures))
+			continue
+		}
+		var missing []string
+		for _, feature := range spec.RequiredKernelFeatures {
+			if !attr.KernelFeatures[string(feature)] {
+				missing = append(missing, string(feature))
+			}
+		}
+		if len(missing) != 0 {
+			nodes = append(nodes, attr.Name)
+			warnings = append(warnings, fmt.Sprintf("node %s lacks required kernel features: %s",
+				attr.Name, strings.Join(missing, ", ")))
+		}
+	}
+	return nodes, warnings
+}
+
+// getDevicePluginSkippedNodes returns the nodes a device plugin must not be deployed on: nodes where the device
+// plugin is managed by another instance, nodes of another link layer than the device plugin link layer and nodes
+// lacking kernel features required by the device plugin. The warnings report the kernel features missing on the
+// skipped nodes. Nodes where the OFED kernel modules are not verified loaded yet are not skipped, the device plugin
+// DaemonSet selects the nodes labeled as no longer waiting for OFED.
+func getDevicePluginSkippedNodes(
+	spec *mellanoxv1alpha1.DevicePluginSpec, nodeInfo nodeinfo.Provider) (skippedNodes, warnings []string) {
+	skippedNodes = getNodesManagedByOtherInstance(nodeInfo)
+	if len(skippedNodes) != 0 {
+		log.V(consts.LogLevelInfo).Info("Skipping nodes where device plugin is managed by another instance",
+			"nodes", skippedNodes)
+	}
+	otherLinkLayer := getNodesWithOtherLinkLayer(spec, nodeInfo)
+	if len(otherLinkLayer) != 0 {
+		log.V(consts.LogLevelInfo).Info("Skipping nodes of another link layer than the device plugin link layer",
+			"linkLayer", spec.LinkLayer, "nodes", otherLinkLayer)
+	}
+	missingFeatures, warnings := getNodesMissingKernelFeatures(spec, nodeInfo)
+	if len(missingFeatures) != 0 {
+		log.V(consts.LogLevelInfo).Info("Skipping nodes lacking kernel features required by the device plugin",
+			"kernelFeatures", spec.RequiredKernelFeatures, "nodes", missingFeatures)
+	}
+	skipped := make(map[string]bool, len(skippedNodes))
+	for _, node := range skippedNodes {
+		skipped[node] = true
+	}
+	for _, nodes := range [][]string{otherLinkLayer, missingFeatures} {
+		for _, node := range nodes {
+			if !skipped[node] {
+				skipped[node] = true
+				skippedNodes = append(skippedNodes, node)
+			}
+		}
+	}
+	return skippedNodes, warnings
+}
+
+// labelSkippedNodes labels the skipped nodes with label and removes label from the nodes which are no longer skipped
+func labelSkippedNodes(ctx context.Context, c client.Client, label string, skippedNodes []string) error {
+	values := make(map[string]string, len(skippedNodes))
+	for _, node := range skippedNodes {
+		values[node] = "true"
+	}
+	return labelNodes(ctx, c, label, values)
+}
+
+// labelNodes sets label of the nodes to their value in values, keyed by node name, and removes label from the other
+// nodes of the device plugin scope of ctx
+func labelNodes(ctx context.Context, c client.Client, label string, values map[string]string) error {
+	nodes := &v1.NodeList{}
+	if err := c.List(ctx, nodes, client.HasLabels{label}); err != nil {
+		return errors.Wrapf(err, "failed to list nodes labeled with %s", label)
+	}
+	scope := getDevicePluginScope(ctx).getNodeSelector()
+	labeled := make(map[string]string, len(nodes.Items))
+	for i := range nodes.Items {
+		node := &nodes.Items[i]
+		if !scope.Matches(labels.Set(node.Labels)) {
+			// the label of the nodes of other scopes is set by the device plugins of their NicClusterPolicy
+			continue
+		}
+		if _, ok := values[node.Name]; !ok {
+			if err := patchNodeLabel(ctx, c, node.Name, label, nil); err != nil {
+				return err
+			}
+			continue
+		}
+		labeled[node.Name] = node.Labels[label]
+	}
+	names := make([]string, 0, len(values))
+	for node := range values {
+		names = append(names, node)
+	}
+	sort.Strings(names)
+	for _, node := range names {
+		value := values[node]
+		if current, ok := labeled[node]; ok && current == value {
+			continue
+		}
+		if err := patchNodeLabel(ctx, c, node, label, &value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// patchNodeLabel sets label of the node to value, the label is removed if value is nil
+func patchNodeLabel(ctx context.Context, c client.Client, nodeName, label string, value *string) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{"labels": map[string]*string{label: value}}})
+	if err != nil {
+		return errors.Wrap(err, "failed to encode node label patch")
+	}
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: nodeName}}
+	if err := c.Patch(ctx, node, client.RawPatch(types.MergePatchType, patch)); err != nil {
+		return errors.Wrapf(err, "failed to update label %s of node %s", label, nodeName)
+	}
+	return nil
+}
+
+// excludeSkippedNodesAffinity returns a copy of affinity which in addition excludes the nodes labeled with label
+func excludeSkippedNodesAffinity(affinity *v1.NodeAffinity, label string) *v1.NodeAffinity {
+	return excludeLabelValuesAffinity(affinity, label, []string{"true"})
+}
+
+// excludeLabelValuesAffinity returns a copy of affinity which in addition excludes nodes labeled with key set to
+// one of values
+func excludeLabelValuesAffinity(affinity *v1.NodeAffinity, key string, values []string) *v1.NodeAffinity {
+	if len(values) == 0 {
+		return affinity
+	}
+	exclude := v1.NodeSelectorRequirement{
+		Key:      key,
+		Operator: v1.NodeSelectorOpNotIn,
+		Values:   values,
+	}
+	return constrainNodeAffinity(affinity, func(term *v1.NodeSelectorTerm) {
+		term.MatchExpressions = append(term.MatchExpressions, exclude)
+	})
+}
+
+// constrainNodeAffinity returns a copy of affinity with constrain applied to each of its required node selector
+// terms, a single term is added if affinity has none
+func constrainNodeAffinity(affinity *v1.NodeAffinity, constrain func(term *v1.NodeSelectorTerm)) *v1.NodeAffinity {
+	result := &v1.NodeAffinity{}
+	if affinity != nil {
+		result = affinity.DeepCopy()
+	}
+	if result.RequiredDuringSchedulingIgnoredDuringExecution == nil ||
+		len(result.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms) == 0 {
+		result.RequiredDuringSchedulingIgnoredDuringExecution = &v1.NodeSelector{
+			NodeSelectorTerms: []v1.NodeSelectorTerm{{}},
+		}
+	}
+	// Node selector terms are ORed, constrain each of the terms
+	terms := result.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+	for i := range terms {
+		constrain(&terms[i])
+	}
+	return result
+}
+
+// isDevicePluginEvictionProtected checks if the device plugin Pods are annotated so the cluster autoscaler and the
+// descheduler do not evict them, e.g when scaling down or rebalancing nodes. The Pods are protected unless disabled.
+func isDevicePluginEvictionProtected(spec *mellanoxv1alpha1.DevicePluginSpec) bool {
+	return spec.EvictionProtection == nil || *spec.EvictionProtection
+}
+
+// getDevicePluginRegistrationCheck returns the liveness probe which restarts the device plugin container when the
+// device plugin is not registered with the kubelet, nil is returned if the registration check is not enabled.
+func getDevicePluginRegistrationCheck(spec *mellanoxv1alpha1.DevicePluginSpec) *v1.Probe {
+	if spec.RegistrationCheck == nil || !spec.RegistrationCheck.Enabled {
+		return nil
+	}
+	probeSpec := mellanoxv1alpha1.PodProbeSpec{
+		InitialDelaySeconds: dpRegistrationProbeDefaultInitialDelaySeconds,
+		PeriodSeconds:       dpRegistrationProbeDefaultPeriodSeconds,
+	}
+	if spec.RegistrationCheck.LivenessProbe != nil {
+		probeSpec = *spec.RegistrationCheck.LivenessProbe
+	}
+	return &v1.Probe{
+		Handler: v1.Handler{
+			Exec: &v1.ExecAction{Command: []string{"sh", "-c", dpRegistrationCheckScript}},
+		},
+		InitialDelaySeconds: int32(probeSpec.InitialDelaySeconds),
+		PeriodSeconds:       int32(probeSpec.PeriodSeconds),
+	}
+}
@@ -0,0 +1,277 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+
+	"github.com/pkg/errors"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	mellanoxv1alpha1 "github.com/Mellanox/network-operator/api/v1alpha1"
+	"github.com/Mellanox/network-operator/pkg/consts"
+	"github.com/Mellanox/network-operator/pkg/nodeinfo"
+)
+
+// Labels of the nodes of the device plugin node pools and of the device plugin objects of the pools, the value is the
+// name of the pool. The DaemonSet of a pool selects the nodes labeled with its name and the default DaemonSet excludes
+// the labeled nodes with constant node affinity terms, so the Pod templates are left unchanged when the nodes of the
+// pools change.
+const (
+	sriovDpNodePoolLabel  = "network.nvidia.com/operator.sriov-device-plugin.pool"
+	sharedDpNodePoolLabel = "network.nvidia.com/operator.rdma-shared-device-plugin.pool"
+)
+
+// Keys of the list of resources in the device plugin configs
+const (
+	sriovDpResourceListKey  = "resourceList"
+	sharedDpResourceListKey = "configList"
+)
+
+// dpResourceNameSuffixRegex matches valid resource name suffixes, device plugins only accept alphanumeric characters
+// and underscores in resource names
+var dpResourceNameSuffixRegex = regexp.MustCompile(`^[a-zA-Z0-9_]+$`)
+
+// devicePluginNodePool is the render data of the device plugin config and DaemonSet of a node pool
+type devicePluginNodePool struct {
+	// Name of the pool, empty for the nodes which are not part of a pool
+	Name string
+	// NameSuffix of the device plugin objects of the pool, empty for the nodes which are not part of a pool
+	NameSuffix string
+	// Config of the device plugin with the resource names of the pool
+	Config       string
+	NodeAffinity *v1.NodeAffinity
+}
+
+// getDevicePluginNodePools returns the render data of the device plugin deployed on the nodes which are not part of a
+// node pool followed by the render data of each node pool of spec, along with the pool of the nodes which are part of
+// a pool keyed by node name. affinity is the node affinity of the device plugin without the node pools. The resource
+// name aliases of spec are added to the config of every pool.
+func getDevicePluginNodePools(spec *mellanoxv1alpha1.DevicePluginSpec, affinity *v1.NodeAffinity,
+	nodeInfo nodeinfo.Provider, poolLabel, resourceListKey string) ([]devicePluginNodePool, map[string]string, error) {
+	config, err := getHostReservedConfig(spec.Config, resourceListKey, spec.HostReservedVFs)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "invalid host reserved VFs")
+	}
+	config, err = getAliasedConfig(config, resourceListKey, spec.ResourceNameAliases)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "invalid device plugin resource name aliases")
+	}
+	defaultPool := devicePluginNodePool{Config: config, NodeAffinity: affinity}
+	if len(spec.NodePools) == 0 {
+		return []devicePluginNodePool{defaultPool}, nil, nil
+	}
+	defaultPool.NodeAffinity = constrainNodeAffinity(affinity, func(term *v1.NodeSelectorTerm) {
+		term.MatchExpressions = append(term.MatchExpressions,
+			v1.NodeSelectorRequirement{Key: poolLabel, Operator: v1.NodeSelectorOpDoesNotExist})
+	})
+	pools := []devicePluginNodePool{defaultPool}
+	nodePools := make(map[string]string)
+	for i := range spec.NodePools {
+		poolSpec := &spec.NodePools[i]
+		if err := validateDevicePluginNodePool(poolSpec, pools); err != nil {
+			return nil, nil, err
+		}
+		poolConfig, err := getNodePoolConfig(config, resourceListKey, poolSpec.ResourceNameSuffix)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "invalid device plugin config of node pool %s", poolSpec.Name)
+		}
+		include := v1.NodeSelectorRequirement{
+			Key:      poolLabel,
+			Operator: v1.NodeSelectorOpIn,
+			Values:   []string{poolSpec.Name},
+		}
+		pools = append(pools, devicePluginNodePool{
+			Name:       poolSpec.Name,
+			NameSuffix: "-" + poolSpec.Name,
+			Config:     poolConfig,
+			NodeAffinity: constrainNodeAffinity(affinity, func(term *v1.NodeSelectorTerm) {
+				term.MatchExpressions = append(term.MatchExpressions, include)
+			}),
+		})
+
+		filter := nodeinfo.NewNodeLabelFilterBuilder().WithLabel(nodeinfo.NodeLabelMlnxNIC, "true")
+		for key, value := range poolSpec.NodeSelector {
+			filter.WithLabel(key, value)
+		}
+		for _, attr := range nodeInfo.GetNodesAttributes(filter.Build()) {
+			if _, ok := nodePools[attr.Name]; !ok {
+				nodePools[attr.Name] = poolSpec.Name
+			}
+		}
+	}
+	return pools, nodePools, nil
+}
+
+// validateDevicePluginNodePool checks that the node pool spec is valid and its name is not used by pools
+func validateDevicePluginNodePool(
+	spec *mellanoxv1alpha1.DevicePluginNodePoolSpec, pools []devicePluginNodePool) error {
+	if errs := validation.IsDNS1123Label(spec.Name); len(errs) != 0 {
+		return errors.Errorf("invalid node pool name %q: %v", spec.Name, errs)
+	}
+	for _, pool := range pools {
+		if pool.Name == spec.Name {
+			return errors.Errorf("duplicate node pool name %q", spec.Name)
+		}
+	}
+	if len(spec.NodeSelector) == 0 {
+		return errors.Errorf("node pool %s has no node selector", spec.Name)
+	}
+	if !dpResourceNameSuffixRegex.MatchString(spec.ResourceNameSuffix) {
+		return errors.Errorf("invalid resource name suffix %q of node pool %s, must only contain alphanumeric "+
+			"characters and underscores", spec.ResourceNameSuffix, spec.Name)
+	}
+	return nil
+}
+
+// getNodePoolConfig returns the device plugin config with suffix appended to the name of each resource listed under
+// resourceListKey
+func getNodePoolConfig(config, resourceListKey, suffix string) (string, error) {
+	return updateDevicePluginResources(config, resourceListKey,
+		func(resources []map[string]interface{}) ([]map[string]interface{}, error) {
+			for _, resource := range resources {
+				resource["resourceName"] = resource["resourceName"].(string) + suffix
+			}
+			return resources, nil
+		})
+}
+
+// getAliasedConfig returns the device plugin config with a copy of each resource listed under resourceListKey which
+// has aliases, named after each of its aliases. The copies select the same devices as the aliased resource.
+func getAliasedConfig(config, resourceListKey string,
+	aliases []mellanoxv1alpha1.DevicePluginResourceNameAlias) (string, error) {
+	if len(aliases) == 0 {
+		return config, nil
+	}
+	return updateDevicePluginResources(config, resourceListKey,
+		func(resources []map[string]interface{}) ([]map[string]interface{}, error) {
+			byName := make(map[string]map[string]interface{}, len(resources))
+			for _, resource := range resources {
+				byName[resource["resourceName"].(string)] = resource
+			}
+			for _, alias := range aliases {
+				if !dpResourceNameSuffixRegex.MatchString(alias.Alias) {
+					return nil, errors.Errorf("invalid resource name alias %q, must only contain alphanumeric "+
+						"characters and underscores", alias.Alias)
+				}
+				if _, ok := byName[alias.Alias]; ok {
+					return nil, errors.Errorf("resource name alias %s is already a resource name", alias.Alias)
+				}
+				resource, ok := byName[alias.ResourceName]
+				if !ok {
+					return nil, errors.Errorf("aliased resource %s is not in the device plugin config",
+						alias.ResourceName)
+				}
+				aliased := make(map[string]interface{}, len(resource))
+				for key, value := range resource {
+					aliased[key] = value
+				}
+				aliased["resourceName"] = alias.Alias
+				byName[alias.Alias] = aliased
+				resources = append(resources, aliased)
+			}
+			return resources, nil
+		})
+}
+
+// updateDevicePluginResources returns the device plugin config with the resources listed under resourceListKey
+// replaced by the resources returned by update, the resources passed to update all have a resourceName
+func updateDevicePluginResources(config, resourceListKey string,
+	update func([]map[string]interface{}) ([]map[string]interface{}, error)) (string, error) {
+	parsed := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(config), &parsed); err != nil {
+		return "", errors.Wrap(err, "failed to parse device plugin config")
+	}
+	list, ok := parsed[resourceListKey].([]interface{})
+	if !ok {
+		return "", errors.Errorf("device plugin config has no %s", resourceListKey)
+	}
+	resources := make([]map[string]interface{}, 0, len(list))
+	for _, r := range list {
+		resource, ok := r.(map[string]interface{})
+		if !ok {
+			return "", errors.Errorf("invalid %s entry %v", resourceListKey, r)
+		}
+		if name, _ := resource["resourceName"].(string); name == "" {
+			return "", errors.Errorf("%s entry without a resourceName", resourceListKey)
+		}
+		resources = append(resources, resource)
+	}
+	resources, err := update(resources)
+	if err != nil {
+		return "", err
+	}
+	parsed[resourceListKey] = resources
+	data, err := json.Marshal(parsed)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to encode device plugin config")
+	}
+	return string(data), nil
+}
+
+// deleteStaleNodePools deletes the device plugin objects of the node pools of cr, labeled with poolLabel, which are not
+// rendered anymore, e.g once a pool is removed from the device plugin spec
+func deleteStaleNodePools(ctx context.Context, c client.Client, cr *mellanoxv1alpha1.NicClusterPolicy,
+	poolLabel string, objs []*unstructured.Unstructured) error {
+	rendered := make(map[string]bool, len(objs))
+	for _, obj := range objs {
+		rendered[obj.GetKind()+"/"+obj.GetName()] = true
+	}
+	lists := map[string]client.ObjectList{"DaemonSet": &appsv1.DaemonSetList{}, "ConfigMap": &v1.ConfigMapList{}}
+	// DaemonSets are deleted before the ConfigMaps they mount
+	for _, kind := range []string{"DaemonSet", "ConfigMap"} {
+		list := lists[kind]
+		err := c.List(ctx, list, client.InNamespace(getDevicePluginScope(ctx).getNamespace()),
+			client.HasLabels{poolLabel})
+		if err != nil {
+			return errors.Wrapf(err, "failed to list node pool %ss", kind)
+		}
+		items, err := meta.ExtractList(list)
+		if err != nil {
+			return errors.Wrapf(err, "failed to extract node pool %ss", kind)
+		}
+		for _, item := range items {
+			obj := item.(client.Object)
+			owner := metav1.GetControllerOf(obj)
+			if rendered[kind+"/"+obj.GetName()] || owner == nil || owner.UID != cr.UID {
+				continue
+			}
+			log.V(consts.LogLevelInfo).Info("Deleting node pool object which is no longer rendered",
+				"Kind:", kind, "Namespace:", obj.GetNamespace(), "Name:", obj.GetName())
+			err := c.Delete(ctx, obj, client.PropagationPolicy(metav1.DeletePropagationBackground))
+			if k8serrors.IsNotFound(err) {
+				continue
+			}
+			if err != nil {
+				return errors.Wrapf(err, "failed to delete node pool %s %s", kind, obj.GetName())
+			}
+			recordEvent(ctx, obj, v1.EventTypeNormal, EventReasonObjectDeleted, "Deleted node pool %s %s",
+				kind, obj.GetName())
+			countPrunedObject(ctx)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	mellanoxv1alpha1 "github.com/Mellanox/network-operator/api/v1alpha1"
+)
+
+// sriovDpPfNamesSelector is the selector of the SR-IOV device plugin config listing PF names, a PF name may be
+// followed by the VF ranges of the PF to advertise, e.g "ens1f0#0-3,6"
+const sriovDpPfNamesSelector = "pfNames"
+
+// getHostReservedConfig returns the device plugin config with the VFs reserved for the host removed from the VF
+// ranges of the pfNames selectors of its resources. The config is returned as is if no VF is reserved.
+func getHostReservedConfig(config, resourceListKey string,
+	reserved *mellanoxv1alpha1.DevicePluginHostReservedVFsSpec) (string, error) {
+	if reserved == nil {
+		return config, nil
+	}
+	if resourceListKey != sriovDpResourceListKey {
+		return "", errors.New("host reserved VFs are only supported by the SR-IOV device plugin")
+	}
+	reservedVFs, err := getHostReservedVFs(reserved)
+	if err != nil {
+		return "", err
+	}
+	return updateDevicePluginResources(config, resourceListKey,
+		func(resources []map[string]interface{}) ([]map[string]interface{}, error) {
+			for _, resource := range resources {
+				if err := reserveSelectorsVFs(resource, reservedVFs, reserved.TotalVFs); err != nil {
+					return nil, errors.Wrapf(err, "resource %s", resource["resourceName"])
+				}
+			}
+			return resources, nil
+		})
+}
+
+// getHostReservedVFs returns the set of the VF indexes reserved for the host, the reservation is validated against
+// the total number of VFs of a PF
+func getHostReservedVFs(reserved *mellanoxv1alpha1.DevicePluginHostReservedVFsSpec) (map[int]bool, error) {
+	if reserved.TotalVFs < 1 || reserved.Count < 0 {
+		return nil, errors.Errorf("invalid count %d or total VFs %d", reserved.Count, reserved.TotalVFs)
+	}
+	if (reserved.Count == 0) == (len(reserved.VFs) == 0) {
+		return nil, errors.New("exactly one of count and vfs must be set")
+	}
+	vfs := make(map[int]bool)
+	for i := 0; i < reserved.Count; i++ {
+		vfs[i] = true
+	}
+	for _, vf := range reserved.VFs {
+		if vf < 0 || vf >= reserved.TotalVFs {
+			return nil, errors.Errorf("reserved VF %d is out of the %d VFs of a PF", vf, reserved.TotalVFs)
+		}
+		vfs[vf] = true
+	}
+	if len(vfs) >= reserved.TotalVFs {
+		return nil, errors.Errorf("%d reserved VFs do not leave any of the %d VFs of a PF to the device plugin",
+			len(vfs), reserved.TotalVFs)
+	}
+	return vfs, nil
+}
+
+// reserveSelectorsVFs removes the reserved VFs from the pfNames selectors of the resource, the selectors are either
+// a single selectors object or a list of them
+func reserveSelectorsVFs(resource map[string]interface{}, reservedVFs map[int]bool, totalVFs int) error {
+	var selectorsList []interface{}
+	switch selectors := resource["selectors"].(type) {
+	case map[string]interface{}:
+		selectorsList = []interface{}{selectors}
+	case []interface{}:
+		selectorsList = selectors
+	}
+	found := false
+	for _, s := range selectorsList {
+		selectors, ok := s.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		pfNames, ok := selectors[sriovDpPfNamesSelector].([]interface{})
+		if !ok {
+			continue
+		}
+		found = true
+		for i, pfName := range pfNames {
+			name, ok := pfName.(string)
+			if !ok {
+				return errors.Errorf("invalid %s entry %v", sriovDpPfNamesSelector, pfName)
+			}
+			reservedName, err := reservePfNameVFs(name, reservedVFs, totalVFs)
+			if err != nil {
+				return err
+			}
+			pfNames[i] = reservedName
+		}
+	}
+	if !found {
+		return errors.Errorf("host reserved VFs require a %s selector", sriovDpPfNamesSelector)
+	}
+	return nil
+}
+
+// reservePfNameVFs returns the pfNames selector entry with the VF ranges of the PF set to its VFs which are not
+// reserved, all the VFs of the PF are considered if the entry has no VF ranges
+func reservePfNameVFs(pfName string, reservedVFs map[int]bool, totalVFs int) (string, error) {
+	name, ranges := pfName, ""
+	if i := strings.Index(pfName, "#"); i >= 0 {
+		name, ranges = pfName[:i], pfName[i+1:]
+	}
+	var vfs []int
+	if ranges == "" {
+		for vf := 0; vf < totalVFs; vf++ {
+			vfs = append(vfs, vf)
+		}
+	} else {
+		var err error
+		if vfs, err = parseVFRanges(ranges, totalVFs); err != nil {
+			return "", errors.Wrapf(err, "invalid VF ranges of %s", pfName)
+		}
+	}
+	var advertised []int
+	for _, vf := range vfs {
+		if !reservedVFs[vf] {
+			advertised = append(advertised, vf)
+		}
+	}
+	if len(advertised) == 0 {
+		return "", errors.Errorf("all the VFs of %s are reserved for the host", pfName)
+	}
+	return name + "#" + formatVFRanges(advertised), nil
+}
+
+// parseVFRanges returns the sorted VF indexes of comma separated VF ranges, e.g "0-3,6"
+func parseVFRanges(ranges string, totalVFs int) ([]int, error) {
+	set := make(map[int]bool)
+	for _, r := range strings.Split(ranges, ",") {
+		bounds := strings.SplitN(r, "-", 2)
+		first, err := strconv.Atoi(strings.TrimSpace(bounds[0]))
+		if err != nil {
+			return nil, errors.Errorf("invalid VF range %q", r)
+		}
+		last := first
+		if len(bounds) == 2 {
+			if last, err = strconv.Atoi(strings.TrimSpace(bounds[1])); err != nil {
+				return nil, errors.Errorf("invalid VF range %q", r)
+			}
+		}
+		if first < 0 || first > last || last >= totalVFs {
+			return nil, errors.Errorf("VF range %q is out of the %d VFs of a PF", r, totalVFs)
+		}
+		for vf := first; vf <= last; vf++ {
+			set[vf] = true
+		}
+	}
+	vfs := make([]int, 0, len(set))
+	for vf := range set {
+		vfs = append(vfs, vf)
+	}
+	sort.Ints(vfs)
+	return vfs, nil
+}
+
+// formatVFRanges returns the comma separated VF ranges of the sorted VF indexes, e.g "0-3,6"
+func formatVFRanges(vfs []int) string {
+	var ranges []string
+	for i := 0; i < len(vfs); {
+		j := i
+		for j+1 < len(vfs) && vfs[j+1] == vfs[j]+1 {
+			j++
+		}
+		if i == j {
+			ranges = append(ranges, strconv.Itoa(vfs[i]))
+		} else {
+			ranges = append(ranges, fmt.Sprintf("%d-%d", vfs[i], vfs[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(ranges, ",")
+}
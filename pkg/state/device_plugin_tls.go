@@ -0,0 +1,185 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	mellanoxv1alpha1 "github.com/Mellanox/network-operator/api/v1alpha1"
+	"github.com/Mellanox/network-operator/pkg/consts"
+)
+
+// Defaults of the device plugin TLS certificate
+const (
+	dpTLSDefaultValidity       = 365 * 24 * time.Hour
+	dpTLSDefaultRotationWindow = 30 * 24 * time.Hour
+	dpTLSDefaultMountPath      = "/etc/device-plugin/tls"
+)
+
+// Names of the device plugin TLS certificate Secrets
+const (
+	sriovDpTLSSecretName  = "sriov-device-plugin-tls"
+	sharedDpTLSSecretName = "rdma-shared-dp-tls"
+)
+
+// devicePluginTLSCert is the render data of the device plugin TLS certificate Secret mounted in the device plugin
+// container
+type devicePluginTLSCert struct {
+	SecretName string
+	MountPath  string
+	// Hash of the certificate, rendered as a Pod template annotation so the device plugin Pods are rolled when the
+	// certificate is rotated
+	Hash string
+}
+
+// stateResync is embedded by States which must be synced again after some time even if they are ready, e.g to
+// rotate a certificate
+type stateResync struct {
+	resyncAfter time.Duration
+}
+
+// ResyncAfter returns the time after which the State must be synced again as reported by the last Sync invocation,
+// zero if the State does not need to be synced again
+func (r *stateResync) ResyncAfter() time.Duration {
+	return r.resyncAfter
+}
+
+// getDevicePluginTLSWindow returns the validity and the rotation window of the device plugin TLS certificate
+func getDevicePluginTLSWindow(spec *mellanoxv1alpha1.DevicePluginTLSSpec) (validity, window time.Duration, err error) {
+	validity, window = dpTLSDefaultValidity, dpTLSDefaultRotationWindow
+	if spec.Validity != "" {
+		if validity, err = time.ParseDuration(spec.Validity); err != nil || validity <= 0 {
+			return 0, 0, errors.Errorf("invalid device plugin TLS certificate validity %q", spec.Validity)
+		}
+	}
+	if spec.RotationWindow != "" {
+		if window, err = time.ParseDuration(spec.RotationWindow); err != nil || window < 0 {
+			return 0, 0, errors.Errorf("invalid device plugin TLS certificate rotation window %q", spec.RotationWindow)
+		}
+	}
+	if window >= validity {
+		return 0, 0, errors.Errorf("device plugin TLS certificate rotation window %s must be shorter than its "+
+			"validity %s", window, validity)
+	}
+	return validity, window, nil
+}
+
+// reconcileDevicePluginTLSCert creates the TLS certificate Secret of the device plugin of cr named secretName, and
+// rotates the certificate once now is within the rotation window before it expires. It returns the render data of the
+// Secret, nil if TLS is not enabled for the device plugin, along with the time until the certificate is rotated.
+// The Secret is left as is once TLS is disabled, it is garbage collected along with cr.
+func reconcileDevicePluginTLSCert(ctx context.Context, c client.Client, scheme *runtime.Scheme,
+	cr *mellanoxv1alpha1.NicClusterPolicy, spec *mellanoxv1alpha1.DevicePluginSpec, secretName string,
+	now time.Time) (*devicePluginTLSCert, time.Duration, error) {
+	if spec.TLS == nil || !spec.TLS.Enabled {
+		return nil, 0, nil
+	}
+	validity, window, err := getDevicePluginTLSWindow(spec.TLS)
+	if err != nil {
+		return nil, 0, err
+	}
+	mountPath := spec.TLS.MountPath
+	if mountPath == "" {
+		mountPath = dpTLSDefaultMountPath
+	}
+	if !filepath.IsAbs(mountPath) {
+		return nil, 0, errors.Errorf("device plugin TLS certificate mount path %q is not absolute", mountPath)
+	}
+
+	secret := &v1.Secret{}
+	namespace := getDevicePluginScope(ctx).getNamespace()
+	err = c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: secretName}, secret)
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return nil, 0, errors.Wrapf(err, "failed to get TLS certificate Secret %s", secretName)
+	}
+	exists := err == nil
+
+	var notAfter time.Time
+	cert, err := parseCertificate(secret.Data[v1.TLSCertKey])
+	if err == nil {
+		notAfter = cert.NotAfter
+	}
+	if !exists || err != nil || !now.Before(notAfter.Add(-window)) {
+		certPEM, keyPEM, err := newDevicePluginCert(secretName, now, validity)
+		if err != nil {
+			return nil, 0, err
+		}
+		secret.Name = secretName
+		secret.Namespace = namespace
+		secret.Type = v1.SecretTypeTLS
+		secret.Data = map[string][]byte{v1.TLSCertKey: certPEM, v1.TLSPrivateKeyKey: keyPEM}
+		if secret.Labels == nil {
+			secret.Labels = map[string]string{}
+		}
+		secret.Labels[consts.NetworkOperatorOwnedLabel] = "true"
+		// the Secret is garbage collected along with the NicClusterPolicy
+		if err := controllerutil.SetControllerReference(cr, secret, scheme); err != nil {
+			return nil, 0, errors.Wrap(err, "failed to set controller reference for TLS certificate Secret")
+		}
+		if exists {
+			err = c.Update(ctx, secret)
+		} else {
+			err = c.Create(ctx, secret)
+		}
+		if err != nil {
+			return nil, 0, errors.Wrapf(err, "failed to apply TLS certificate Secret %s", secretName)
+		}
+		if exists {
+			recordEvent(ctx, secret, v1.EventTypeNormal, EventReasonCertificateRotated,
+				"Rotated TLS certificate of Secret %s, the device plugin Pods are rolled", secretName)
+		}
+		notAfter = now.Add(validity)
+	}
+
+	hash := sha256.Sum256(secret.Data[v1.TLSCertKey])
+	return &devicePluginTLSCert{
+		SecretName: secretName,
+		MountPath:  mountPath,
+		Hash:       hex.EncodeToString(hash[:])[:16],
+	}, notAfter.Add(-window).Sub(now), nil
+}
+
+// newDevicePluginCert generates a PEM encoded self-signed certificate for commonName, valid from now for validity,
+// and its PEM encoded key
+func newDevicePluginCert(commonName string, now time.Time, validity time.Duration) ([]byte, []byte, error) {
+	cert, key, err := createCertificate(&x509.Certificate{
+		Subject:     pkix.Name{CommonName: commonName},
+		DNSNames:    []string{commonName},
+		NotBefore:   now.Add(-time.Hour),
+		NotAfter:    now.Add(validity),
+		KeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}, nil, nil)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to generate device plugin TLS certificate")
+	}
+	return encodeCertAndKey(cert, key)
+}
@@ -0,0 +1,99 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	mellanoxv1alpha1 "github.com/Mellanox/network-operator/api/v1alpha1"
+	"github.com/Mellanox/network-operator/pkg/nodeinfo"
+)
+
+// devicePluginStaticTolerations are the tolerations rendered in the device plugin manifests, taints they tolerate are
+// not tolerated again
+var devicePluginStaticTolerations = []v1.Toleration{
+	{Key: "node-role.kubernetes.io/master", Operator: v1.TolerationOpExists, Effect: v1.TaintEffectNoSchedule},
+	{Key: "nvidia.com/gpu", Operator: v1.TolerationOpExists, Effect: v1.TaintEffectNoSchedule},
+}
+
+// daemonSetTolerationsPrefix is the prefix of the keys of the taints tolerated by DaemonSet Pods or which must not be
+// tolerated, e.g node.kubernetes.io/unschedulable marking the nodes under maintenance
+const daemonSetTolerationsPrefix = "node.kubernetes.io/"
+
+// getDevicePluginGPUTolerations returns the tolerations of the taints of the eligible GPU nodes, the nodes labeled
+// nvidia.com/gpu.present with an NVIDIA NIC, if the device plugin derives them. The tolerations are deduplicated and
+// sorted so the rendered Pod template is stable. A warning is returned for each taint which can not be tolerated.
+func getDevicePluginGPUTolerations(spec *mellanoxv1alpha1.DevicePluginSpec,
+	nodeInfo nodeinfo.Provider) (tolerations []v1.Toleration, warnings []string) {
+	if !spec.DeriveGPUTolerations {
+		return nil, nil
+	}
+	seen := make(map[v1.Toleration]bool)
+	filter := nodeinfo.NewNodeLabelFilterBuilder().
+		WithLabel(nodeinfo.NodeLabelMlnxNIC, "true").
+		WithLabel(nodeinfo.NodeLabelNvGPU, "true").
+		Build()
+	for _, attr := range nodeInfo.GetNodesAttributes(filter) {
+		for i := range attr.Taints {
+			taint := &attr.Taints[i]
+			if strings.HasPrefix(taint.Key, daemonSetTolerationsPrefix) || isStaticallyTolerated(taint) {
+				continue
+			}
+			if errs := validation.IsQualifiedName(taint.Key); len(errs) != 0 {
+				warnings = append(warnings, fmt.Sprintf("taint %s of node %s can not be tolerated: %s",
+					taint.Key, attr.Name, strings.Join(errs, ", ")))
+				continue
+			}
+			toleration := v1.Toleration{Key: taint.Key, Operator: v1.TolerationOpExists, Effect: taint.Effect}
+			if taint.Value != "" {
+				toleration.Operator = v1.TolerationOpEqual
+				toleration.Value = taint.Value
+			}
+			if seen[toleration] {
+				continue
+			}
+			seen[toleration] = true
+			tolerations = append(tolerations, toleration)
+		}
+	}
+	sort.Slice(tolerations, func(i, j int) bool {
+		a, b := tolerations[i], tolerations[j]
+		if a.Key != b.Key {
+			return a.Key < b.Key
+		}
+		if a.Value != b.Value {
+			return a.Value < b.Value
+		}
+		return a.Effect < b.Effect
+	})
+	return tolerations, warnings
+}
+
+// isStaticallyTolerated checks if taint is tolerated by the tolerations rendered in the device plugin manifests
+func isStaticallyTolerated(taint *v1.Taint) bool {
+	for i := range devicePluginStaticTolerations {
+		if devicePluginStaticTolerations[i].ToleratesTaint(taint) {
+			return true
+		}
+	}
+	return false
+}
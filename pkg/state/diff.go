@@ -0,0 +1,354 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	netattdefv1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	mellanoxv1alpha1 "github.com/Mellanox/network-operator/api/v1alpha1"
+)
+
+// ObjectDiff is the change a Sync would apply to an object of the cluster
+type ObjectDiff struct {
+	// Object identified as "Kind namespace/name"
+	Object string
+	// Created is true if the object does not exist in the cluster
+	Created bool
+	// Deleted is true if the object would be deleted
+	Deleted bool
+	// Changes of the fields of an existing object, formatted as "path: live -> desired"
+	Changes []string
+}
+
+// String formats the diff of the object, one line per change
+func (d ObjectDiff) String() string {
+	var b strings.Builder
+	b.WriteString(d.Object)
+	switch {
+	case d.Created:
+		b.WriteString("\n  + created")
+	case d.Deleted:
+		b.WriteString("\n  - deleted")
+	}
+	for _, change := range d.Changes {
+		b.WriteString("\n  ~ " + change)
+	}
+	return b.String()
+}
+
+// DiffOptions controls the behavior of Diff
+type DiffOptions struct {
+	// ShowSecretData prints the values of the data and stringData fields of Secrets, they are redacted otherwise
+	ShowSecretData bool
+}
+
+// Diff syncs the custom resource of the given kind without applying any change to the cluster and returns the
+// objects a Sync would create, update or delete. Objects are read from the cluster with c, objects which are in sync
+// are not returned. Unlike a Sync, which stops at the first state group which is not ready, every state is rendered
+// and compared. The diffs of the states are returned along with the errors of the states which failed.
+func Diff(ctx context.Context, c client.Client, scheme *runtime.Scheme, crdKind string, customResource interface{},
+	infoCatalog InfoCatalog, opts DiffOptions) ([]ObjectDiff, error) {
+	dc := &diffClient{Client: c, showSecretData: opts.ShowSecretData}
+	stateGroups, err := newStates(crdKind, NewStaticClientProvider(dc), scheme)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create states")
+	}
+	err = diffStates(ctx, &stateManager{stateGroups: stateGroups}, customResource, infoCatalog)
+	return dc.diffs, err
+}
+
+// DiffCNIConfigSnapshot compares the CNI config of the NetworkAttachmentDefinition of each HostDeviceNetwork with the
+// config last applied for it in the snapshot ConfigMap in namespace, see HostDeviceNetworkConfigSnapshotName, and
+// returns the NetworkAttachmentDefinitions which drifted from the snapshot. Configs which only differ in formatting
+// are in sync. HostDeviceNetworks which no longer exist are skipped, nothing is returned without snapshot.
+func DiffCNIConfigSnapshot(ctx context.Context, c client.Reader, namespace string) ([]ObjectDiff, error) {
+	cm := &corev1.ConfigMap{}
+	err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: HostDeviceNetworkConfigSnapshotName}, cm)
+	if k8serrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get CNI config snapshot ConfigMap")
+	}
+
+	names := make([]string, 0, len(cm.Data))
+	for name := range cm.Data {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var diffs []ObjectDiff
+	for _, name := range names {
+		cr := &mellanoxv1alpha1.HostDeviceNetwork{}
+		err := c.Get(ctx, types.NamespacedName{Name: name}, cr)
+		if k8serrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return diffs, errors.Wrapf(err, "failed to get HostDeviceNetwork %s", name)
+		}
+		netAttDef := &unstructured.Unstructured{}
+		netAttDef.SetGroupVersionKind(netattdefv1.SchemeGroupVersion.WithKind("NetworkAttachmentDefinition"))
+		netAttDef.SetNamespace(cr.Spec.NetworkNamespace)
+		if netAttDef.GetNamespace() == "" {
+			netAttDef.SetNamespace(mellanoxv1alpha1.HostDeviceNetworkDefaultNetworkNamespace)
+		}
+		netAttDef.SetName(name)
+		err = c.Get(ctx, types.NamespacedName{Namespace: netAttDef.GetNamespace(), Name: name}, netAttDef)
+		if k8serrors.IsNotFound(err) {
+			diffs = append(diffs, ObjectDiff{Object: objectID(netAttDef), Created: true})
+			continue
+		}
+		if err != nil {
+			return diffs, errors.Wrapf(err, "failed to get NetworkAttachmentDefinition of HostDeviceNetwork %s", name)
+		}
+		config, found, _ := unstructured.NestedString(netAttDef.Object, "spec", "config")
+		if found && (config == cm.Data[name] || isSameJSON(config, cm.Data[name])) {
+			continue
+		}
+		var live interface{}
+		if found {
+			live = config
+		}
+		diffs = append(diffs, ObjectDiff{Object: objectID(netAttDef),
+			Changes: []string{formatChange("spec.config", live, cm.Data[name], false)}})
+	}
+	return diffs, nil
+}
+
+// diffStates syncs every state of smgr, whether the states of the previous groups are ready or not, and returns the
+// errors of the states which failed
+func diffStates(
+	ctx context.Context, smgr *stateManager, customResource interface{}, infoCatalog InfoCatalog) error {
+	ctx = smgr.syncContext(ctx, customResource, infoCatalog)
+	var errs []string
+	for i := range smgr.stateGroups {
+		for _, result := range smgr.stateGroups[i].Sync(ctx, customResource, infoCatalog) {
+			if result.ErrInfo != nil {
+				errs = append(errs, fmt.Sprintf("%s: %v", result.StateName, result.ErrInfo))
+			}
+		}
+	}
+	if len(errs) != 0 {
+		sort.Strings(errs)
+		return errors.Errorf("failed to diff states: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// diffClient records the changes of the writes of the states instead of applying them, reads are served by the
+// wrapped client
+type diffClient struct {
+	client.Client
+	diffs []ObjectDiff
+	// showSecretData prints the values of the data of Secrets instead of redacting them
+	showSecretData bool
+}
+
+// Create records the object as created if it does not exist, an AlreadyExists error is returned otherwise so the
+// state updates it as it would in a Sync
+func (c *diffClient) Create(ctx context.Context, obj client.Object, _ ...client.CreateOption) error {
+	desired, err := toUnstructured(obj)
+	if err != nil {
+		return err
+	}
+	_, err = c.getLive(ctx, desired)
+	if k8serrors.IsNotFound(err) {
+		c.diffs = append(c.diffs, ObjectDiff{Object: objectID(desired), Created: true})
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	gvk := desired.GroupVersionKind()
+	return k8serrors.NewAlreadyExists(schema.GroupResource{Group: gvk.Group, Resource: gvk.Kind}, desired.GetName())
+}
+
+// Update records the fields of the object which differ from the cluster
+func (c *diffClient) Update(ctx context.Context, obj client.Object, _ ...client.UpdateOption) error {
+	return c.recordChanges(ctx, obj)
+}
+
+// Patch records the fields of the patched object which differ from the cluster
+func (c *diffClient) Patch(ctx context.Context, obj client.Object, _ client.Patch, _ ...client.PatchOption) error {
+	return c.recordChanges(ctx, obj)
+}
+
+// Delete records the object as deleted
+func (c *diffClient) Delete(_ context.Context, obj client.Object, _ ...client.DeleteOption) error {
+	deleted, err := toUnstructured(obj)
+	if err != nil {
+		return err
+	}
+	c.diffs = append(c.diffs, ObjectDiff{Object: objectID(deleted), Deleted: true})
+	return nil
+}
+
+func (c *diffClient) recordChanges(ctx context.Context, obj client.Object) error {
+	desired, err := toUnstructured(obj)
+	if err != nil {
+		return err
+	}
+	live, err := c.getLive(ctx, desired)
+	if err != nil {
+		return err
+	}
+	if changes := diffObjects(desired, live, !c.showSecretData); len(changes) != 0 {
+		c.diffs = append(c.diffs, ObjectDiff{Object: objectID(desired), Changes: changes})
+	}
+	return nil
+}
+
+func (c *diffClient) getLive(
+	ctx context.Context, desired *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	live := &unstructured.Unstructured{}
+	live.SetGroupVersionKind(desired.GroupVersionKind())
+	err := c.Get(ctx, client.ObjectKey{Namespace: desired.GetNamespace(), Name: desired.GetName()}, live)
+	return live, err
+}
+
+// toUnstructured returns obj as an Unstructured object, objects of the states are usually Unstructured already
+func toUnstructured(obj client.Object) (*unstructured.Unstructured, error) {
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		return u, nil
+	}
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to convert object")
+	}
+	u := &unstructured.Unstructured{Object: content}
+	u.SetGroupVersionKind(obj.GetObjectKind().GroupVersionKind())
+	return u, nil
+}
+
+func objectID(obj *unstructured.Unstructured) string {
+	return fmt.Sprintf("%s %s/%s", obj.GetKind(), obj.GetNamespace(), obj.GetName())
+}
+
+// diffObjects returns the changes of the fields set in the desired object which differ from the live object. Fields
+// only set in the live object, e.g defaulted by the API server, and the status are not compared. The values of the
+// data of Secrets are redacted if redactSecretData is set, changed fields are still reported.
+func diffObjects(desired, live *unstructured.Unstructured, redactSecretData bool) []string {
+	canonical := desired.DeepCopy()
+	unstructured.RemoveNestedField(canonical.Object, "metadata", "resourceVersion")
+	unstructured.RemoveNestedField(canonical.Object, "status")
+	redacted := func(string) bool { return false }
+	if redactSecretData && desired.GroupVersionKind().GroupKind() == (schema.GroupKind{Kind: "Secret"}) {
+		redacted = isSecretDataPath
+	}
+	return diffFields("", canonical.Object, live.Object, redacted)
+}
+
+// isSecretDataPath checks if path is the path of the data of a Secret
+func isSecretDataPath(path string) bool {
+	for _, field := range []string{"data", "stringData"} {
+		if path == field || strings.HasPrefix(path, field+".") {
+			return true
+		}
+	}
+	return false
+}
+
+func diffFields(path string, desired, live interface{}, redacted func(path string) bool) []string {
+	switch d := desired.(type) {
+	case nil:
+		return nil
+	case map[string]interface{}:
+		l, ok := live.(map[string]interface{})
+		if !ok {
+			if len(d) == 0 && live == nil {
+				return nil
+			}
+			return []string{formatChange(path, live, desired, redacted(path))}
+		}
+		keys := make([]string, 0, len(d))
+		for k := range d {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		var changes []string
+		for _, k := range keys {
+			fieldPath := k
+			if path != "" {
+				fieldPath = path + "." + k
+			}
+			changes = append(changes, diffFields(fieldPath, d[k], l[k], redacted)...)
+		}
+		return changes
+	case []interface{}:
+		l, ok := live.([]interface{})
+		if !ok || len(l) != len(d) {
+			if len(d) == 0 && live == nil {
+				return nil
+			}
+			return []string{formatChange(path, live, desired, redacted(path))}
+		}
+		var changes []string
+		for i := range d {
+			changes = append(changes, diffFields(fmt.Sprintf("%s[%d]", path, i), d[i], l[i], redacted)...)
+		}
+		return changes
+	default:
+		// Numbers may be decoded as int64 or float64, compare their formatted values
+		if live == nil || fmt.Sprint(desired) != fmt.Sprint(live) {
+			return []string{formatChange(path, live, desired, redacted(path))}
+		}
+		return nil
+	}
+}
+
+// redactedValue replaces the redacted values of the changes
+const redactedValue = "<redacted>"
+
+func formatChange(path string, live, desired interface{}, redacted bool) string {
+	if redacted {
+		return fmt.Sprintf("%s: %s -> %s", path, redactValue(live), redactValue(desired))
+	}
+	return fmt.Sprintf("%s: %s -> %s", path, formatValue(live), formatValue(desired))
+}
+
+// redactValue formats value as redacted, unset values are not redacted
+func redactValue(value interface{}) string {
+	if value == nil {
+		return formatValue(value)
+	}
+	return redactedValue
+}
+
+func formatValue(value interface{}) string {
+	if value == nil {
+		return "<unset>"
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
@@ -0,0 +1,188 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	netattdefv1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	corev1 "k8s.io/api/core/v1"
+	schedulingv1 "k8s.io/api/scheduling/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	mellanoxv1alpha1 "github.com/Mellanox/network-operator/api/v1alpha1"
+)
+
+var _ = Describe("Diff tests", func() {
+	const priorityClassName = "nvidia-network-critical"
+	var (
+		cr        *mellanoxv1alpha1.NicClusterPolicy
+		k8sClient client.Client
+		scheme    *runtime.Scheme
+	)
+
+	syncWith := func(c client.Client) {
+		priorityClassState, err := NewStatePriorityClass(
+			NewStaticClientProvider(c), scheme, "../../manifests/stage-priority-class")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = priorityClassState.Sync(context.Background(), cr, nil)
+		Expect(err).NotTo(HaveOccurred())
+	}
+	diff := func() []ObjectDiff {
+		dc := &diffClient{Client: k8sClient}
+		syncWith(dc)
+		return dc.diffs
+	}
+
+	BeforeEach(func() {
+		scheme = runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(mellanoxv1alpha1.AddToScheme(scheme)).To(Succeed())
+		k8sClient = fake.NewClientBuilder().WithScheme(scheme).Build()
+		cr = &mellanoxv1alpha1.NicClusterPolicy{}
+		cr.Name = "nic-cluster-policy"
+		cr.Spec.PriorityClass = &mellanoxv1alpha1.PriorityClassSpec{Name: priorityClassName, Value: 1000000}
+	})
+
+	It("Should report objects which do not exist as created", func() {
+		Expect(diff()).To(Equal([]ObjectDiff{{Object: "PriorityClass /" + priorityClassName, Created: true}}))
+		priorityClass := &schedulingv1.PriorityClass{}
+		Expect(k8sClient.Get(context.TODO(), types.NamespacedName{Name: priorityClassName}, priorityClass)).NotTo(
+			Succeed())
+	})
+
+	It("Should report nothing when the cluster is in sync", func() {
+		syncWith(k8sClient)
+		Expect(diff()).To(BeEmpty())
+	})
+
+	It("Should report the changed fields without applying them", func() {
+		syncWith(k8sClient)
+		cr.Spec.PriorityClass.Value = 2000
+		diffs := diff()
+		Expect(diffs).To(Equal([]ObjectDiff{{
+			Object:  "PriorityClass /" + priorityClassName,
+			Changes: []string{"value: 1000000 -> 2000"},
+		}}))
+		Expect(diffs[0].String()).To(Equal("PriorityClass /" + priorityClassName + "\n  ~ value: 1000000 -> 2000"))
+
+		priorityClass := &schedulingv1.PriorityClass{}
+		Expect(k8sClient.Get(context.TODO(), types.NamespacedName{Name: priorityClassName}, priorityClass)).To(
+			Succeed())
+		Expect(priorityClass.Value).To(Equal(int32(1000000)))
+	})
+
+	It("Should ignore fields only set in the live object", func() {
+		desired := &unstructured.Unstructured{Object: map[string]interface{}{
+			"metadata": map[string]interface{}{"name": "test", "resourceVersion": "1"},
+			"data":     map[string]interface{}{"key": "value"},
+		}}
+		live := &unstructured.Unstructured{Object: map[string]interface{}{
+			"metadata": map[string]interface{}{"name": "test", "resourceVersion": "2", "uid": "uid"},
+			"data":     map[string]interface{}{"key": "value"},
+		}}
+		Expect(diffObjects(desired, live, true)).To(BeEmpty())
+
+		live.Object["data"] = map[string]interface{}{"key": "other"}
+		Expect(diffObjects(desired, live, true)).To(Equal([]string{`data.key: "other" -> "value"`}))
+	})
+
+	It("Should redact the data of Secrets by default", func() {
+		desired := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Secret",
+			"metadata":   map[string]interface{}{"name": "test"},
+			"data":       map[string]interface{}{"key": "c2VjcmV0", "added": "c2VjcmV0"},
+			"stringData": map[string]interface{}{"password": "secret"},
+		}}
+		live := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Secret",
+			"metadata":   map[string]interface{}{"name": "test"},
+			"data":       map[string]interface{}{"key": "b3RoZXI="},
+		}}
+		Expect(diffObjects(desired, live, true)).To(Equal([]string{
+			"data.added: <unset> -> <redacted>",
+			"data.key: <redacted> -> <redacted>",
+			"stringData: <unset> -> <redacted>",
+		}))
+		Expect(diffObjects(desired, live, false)).To(ContainElement(`data.key: "b3RoZXI=" -> "c2VjcmV0"`))
+	})
+
+	It("Should diff the states of every group whether the previous groups are ready or not", func() {
+		notReady := &fakeState{name: "not-ready", syncState: SyncStateNotReady}
+		next := &fakeState{name: "next", syncState: SyncStateReady}
+		smgr := &stateManager{stateGroups: []Group{NewStateGroup([]State{notReady}), NewStateGroup([]State{next})}}
+		Expect(diffStates(context.Background(), smgr, cr, nil)).To(Succeed())
+		Expect(notReady.syncCount).To(Equal(1))
+		Expect(next.syncCount).To(Equal(1))
+	})
+
+	It("Should report the NetworkAttachmentDefinitions which drifted from the CNI config snapshot", func() {
+		const snapshotNamespace = "nvidia-network-operator"
+		Expect(netattdefv1.AddToScheme(scheme)).To(Succeed())
+		newHostDeviceNetwork := func(name string) *mellanoxv1alpha1.HostDeviceNetwork {
+			cr := &mellanoxv1alpha1.HostDeviceNetwork{ObjectMeta: metav1.ObjectMeta{Name: name}}
+			cr.Spec.NetworkNamespace = "default"
+			return cr
+		}
+		newNetAttDef := func(name, config string) *netattdefv1.NetworkAttachmentDefinition {
+			return &netattdefv1.NetworkAttachmentDefinition{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+				Spec:       netattdefv1.NetworkAttachmentDefinitionSpec{Config: config},
+			}
+		}
+		k8sClient = fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+			&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: HostDeviceNetworkConfigSnapshotName, Namespace: snapshotNamespace},
+				Data: map[string]string{
+					"in-sync": `{"type":"host-device","name":"in-sync"}`,
+					"drifted": `{"type":"host-device","name":"drifted"}`,
+					"missing": `{"type":"host-device","name":"missing"}`,
+					"deleted": `{"type":"host-device","name":"deleted"}`,
+				},
+			},
+			newHostDeviceNetwork("in-sync"), newHostDeviceNetwork("drifted"), newHostDeviceNetwork("missing"),
+			newNetAttDef("in-sync", `{"name": "in-sync", "type": "host-device"}`),
+			newNetAttDef("drifted", `{"type":"host-device","name":"edited"}`),
+		).Build()
+
+		diffs, err := DiffCNIConfigSnapshot(context.Background(), k8sClient, snapshotNamespace)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(diffs).To(Equal([]ObjectDiff{
+			{Object: "NetworkAttachmentDefinition default/drifted", Changes: []string{
+				`spec.config: "{\"type\":\"host-device\",\"name\":\"edited\"}" -> ` +
+					`"{\"type\":\"host-device\",\"name\":\"drifted\"}"`}},
+			{Object: "NetworkAttachmentDefinition default/missing", Created: true},
+		}))
+	})
+
+	It("Should report nothing without CNI config snapshot", func() {
+		diffs, err := DiffCNIConfigSnapshot(context.Background(), k8sClient, "nvidia-network-operator")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(diffs).To(BeEmpty())
+	})
+})
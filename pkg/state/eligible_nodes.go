@@ -0,0 +1,64 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Mellanox/network-operator/pkg/consts"
+	"github.com/Mellanox/network-operator/pkg/nodeinfo"
+)
+
+// stateNoEligibleNodes tracks the node filter which matched no nodes in the last Sync invocation of a state
+type stateNoEligibleNodes struct {
+	noEligibleNodesFilter string
+}
+
+// NoEligibleNodesFilter returns the node filter which matched no nodes in the last Sync invocation, empty if
+// eligible nodes were found or the state did not look for them
+func (n *stateNoEligibleNodes) NoEligibleNodesFilter() string {
+	return n.noEligibleNodesFilter
+}
+
+// getEligibleNodes returns the attributes of the nodes with all the labels, the labels are recorded as the node
+// filter which matched no nodes if no node has them
+func (n *stateNoEligibleNodes) getEligibleNodes(
+	nodeInfo nodeinfo.Provider, labels map[string]string) []nodeinfo.NodeAttributes {
+	builder := nodeinfo.NewNodeLabelFilterBuilder()
+	for key, val := range labels {
+		builder.WithLabel(key, val)
+	}
+	attrs := nodeInfo.GetNodesAttributes(builder.Build())
+	n.noEligibleNodesFilter = ""
+	if len(attrs) == 0 {
+		n.noEligibleNodesFilter = describeNodeLabels(labels)
+		log.V(consts.LogLevelInfo).Info("No eligible nodes found in the cluster", "filter", n.noEligibleNodesFilter)
+	}
+	return attrs
+}
+
+// describeNodeLabels returns the labels as a label selector, e.g "a=true,b=true"
+func describeNodeLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for key, val := range labels {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", key, val))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
@@ -0,0 +1,93 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+)
+
+// Reasons of the Events recorded for the outcome of state syncs and for the objects applied or pruned by the states.
+// The reasons are stable so monitoring can alert on them.
+const (
+	// EventReasonStateSynced is recorded on the custom resource when a state is synced and ready
+	EventReasonStateSynced = "StateSynced"
+	// EventReasonStateNotReady is recorded on the custom resource when a state is synced but not ready yet
+	EventReasonStateNotReady = "StateNotReady"
+	// EventReasonStateError is recorded on the custom resource when a state fails to sync
+	EventReasonStateError = "StateError"
+	// EventReasonObjectApplied is recorded on an object created or changed by a state
+	EventReasonObjectApplied = "ObjectApplied"
+	// EventReasonObjectPruned is recorded on an object deleted by Prune
+	EventReasonObjectPruned = "ObjectPruned"
+	// EventReasonObjectDeleted is recorded on an object deleted by a state as it is no longer rendered
+	EventReasonObjectDeleted = "ObjectDeleted"
+	// EventReasonObjectStuckDeleting is recorded on an object which is not updated by a state as it is Terminating
+	EventReasonObjectStuckDeleting = "ObjectStuckDeleting"
+	// EventReasonConfigDriftOverwritten is recorded on a NetworkAttachmentDefinition whose CNI config was changed
+	// manually and is overwritten by a state
+	EventReasonConfigDriftOverwritten = "ConfigDriftOverwritten"
+	// EventReasonCertificateRotated is recorded on a TLS certificate Secret whose certificate is rotated by a state
+	EventReasonCertificateRotated = "CertificateRotated"
+	// EventReasonInstallComplete is recorded once on the custom resource when all its enabled states are first ready
+	EventReasonInstallComplete = "InstallComplete"
+)
+
+type eventRecorderKey struct{}
+
+type eventObjectKey struct{}
+
+// WithEventRecorder returns a context recording the Events of the states with recorder, no Events are recorded if
+// the context does not hold a recorder
+func WithEventRecorder(ctx context.Context, recorder record.EventRecorder) context.Context {
+	return context.WithValue(ctx, eventRecorderKey{}, recorder)
+}
+
+// withEventObject returns a context recording the custom resource the states are synced for, the state Events are
+// recorded on it
+func withEventObject(ctx context.Context, obj runtime.Object) context.Context {
+	return context.WithValue(ctx, eventObjectKey{}, obj)
+}
+
+// recordEvent records an Event on obj with the recorder of the context
+func recordEvent(ctx context.Context, obj runtime.Object, eventType, reason, messageFmt string, args ...interface{}) {
+	recorder, ok := ctx.Value(eventRecorderKey{}).(record.EventRecorder)
+	if !ok || recorder == nil || obj == nil {
+		return
+	}
+	recorder.Eventf(obj, eventType, reason, messageFmt, args...)
+}
+
+// recordStateEvent records the outcome of a state sync on the custom resource the states are synced for, ignored
+// states are not recorded
+func recordStateEvent(ctx context.Context, stateName string, status SyncState, err error) {
+	obj, _ := ctx.Value(eventObjectKey{}).(runtime.Object)
+	switch {
+	case err != nil:
+		recordEvent(ctx, obj, corev1.EventTypeWarning, EventReasonStateError, "State %s failed to sync: %v",
+			stateName, err)
+	case status == SyncStateError:
+		recordEvent(ctx, obj, corev1.EventTypeWarning, EventReasonStateError, "State %s failed to sync", stateName)
+	case status == SyncStateNotReady:
+		recordEvent(ctx, obj, corev1.EventTypeNormal, EventReasonStateNotReady, "State %s is not ready", stateName)
+	case status == SyncStateReady:
+		recordEvent(ctx, obj, corev1.EventTypeNormal, EventReasonStateSynced, "State %s is ready", stateName)
+	}
+}
@@ -0,0 +1,115 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/pkg/errors"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	mellanoxv1alpha1 "github.com/Mellanox/network-operator/api/v1alpha1"
+	"github.com/Mellanox/network-operator/pkg/consts"
+)
+
+var _ = Describe("Events tests", func() {
+	var (
+		recorder *record.FakeRecorder
+		ctx      context.Context
+		cr       *mellanoxv1alpha1.NicClusterPolicy
+	)
+
+	BeforeEach(func() {
+		recorder = record.NewFakeRecorder(10)
+		ctx = WithEventRecorder(context.Background(), recorder)
+		cr = &mellanoxv1alpha1.NicClusterPolicy{}
+		cr.SetName(consts.NicClusterPolicyResourceName)
+	})
+
+	recordedEvents := func() []string {
+		close(recorder.Events)
+		events := []string{}
+		for event := range recorder.Events {
+			events = append(events, event)
+		}
+		return events
+	}
+
+	It("Should record the outcome of each state on the custom resource", func() {
+		manager := &stateManager{stateGroups: []Group{NewStateGroup([]State{
+			&fakeState{name: "ready", syncState: SyncStateReady},
+			&fakeState{name: "not-ready", syncState: SyncStateNotReady},
+			&fakeState{name: "ignored", syncState: SyncStateIgnore},
+			&fakeState{name: "failed", syncState: SyncStateNotReady, syncErr: errors.New("boom")},
+		})}}
+
+		// the error of the failed state is not returned if the not ready state is checked first
+		_, _ = manager.SyncState(ctx, cr, nil)
+		Expect(recordedEvents()).To(ConsistOf(
+			"Normal StateSynced State ready is ready",
+			"Normal StateNotReady State not-ready is not ready",
+			"Warning StateError State failed failed to sync: boom",
+		))
+	})
+	It("Should not record Events without a recorder", func() {
+		manager := &stateManager{stateGroups: []Group{NewStateGroup([]State{
+			&fakeState{name: "ready", syncState: SyncStateReady},
+		})}}
+
+		_, err := manager.SyncState(context.Background(), cr, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(recordedEvents()).To(BeEmpty())
+	})
+	It("Should record the objects created by a state", func() {
+		k8sClient := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+		obj := &unstructured.Unstructured{}
+		obj.SetAPIVersion("v1")
+		obj.SetKind("ConfigMap")
+		obj.SetNamespace("default")
+		obj.SetName("test")
+		state := &fakeRenderingState{
+			stateSkel: stateSkel{name: "test", clientProvider: NewStaticClientProvider(k8sClient)},
+			objs:      []*unstructured.Unstructured{obj},
+		}
+
+		_, err := state.Sync(ctx, cr, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(recordedEvents()).To(ConsistOf("Normal ObjectApplied Created by state test"))
+	})
+	It("Should record the objects deleted by Prune", func() {
+		k8sClient := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+			&appsv1.DaemonSet{ObjectMeta: metav1.ObjectMeta{
+				Name:      "owned-ds",
+				Namespace: consts.NetworkOperatorResourceNamespace,
+				Labels:    map[string]string{consts.NetworkOperatorOwnedLabel: "true"}}},
+		).Build()
+
+		_, err := Prune(ctx, k8sClient, PruneOptions{
+			Confirm: true, Kinds: []schema.GroupVersionKind{{Group: "apps", Version: "v1", Kind: "DaemonSet"}}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(recordedEvents()).To(ConsistOf("Normal ObjectPruned Pruned by the operator"))
+	})
+})
@@ -0,0 +1,158 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	mellanoxv1alpha1 "github.com/Mellanox/network-operator/api/v1alpha1"
+	"github.com/Mellanox/network-operator/pkg/consts"
+)
+
+// redactedRenderValue replaces the values of external render data Secrets in logs
+const redactedRenderValue = "<redacted>"
+
+// ExternalRenderData holds the values of the external render data sources of NicClusterPolicy keyed by prefix, the
+// values of a prefix are a map keyed by the ConfigMap or Secret keys. Manifests render a value with
+// {{ .RuntimeSpec.External.<prefix>.<key> }}.
+type ExternalRenderData map[string]interface{}
+
+// secretRenderValues are the values of an external render data Secret, they are rendered as is by the manifests but
+// redacted when marshaled to JSON, as done when logging the render data
+type secretRenderValues map[string]string
+
+// MarshalJSON marshals the keys of the Secret with redacted values
+func (v secretRenderValues) MarshalJSON() ([]byte, error) {
+	redacted := make(map[string]string, len(v))
+	for key := range v {
+		redacted[key] = redactedRenderValue
+	}
+	return json.Marshal(redacted)
+}
+
+// ResolveExternalRenderData gets the ConfigMaps and Secrets referenced by the external render data of NicClusterPolicy
+// from the operator resources namespace, nil is returned if no external render data is referenced.
+func ResolveExternalRenderData(ctx context.Context, c client.Reader,
+	cr *mellanoxv1alpha1.NicClusterPolicy) (ExternalRenderData, error) {
+	if len(cr.Spec.ExternalRenderData) == 0 {
+		return nil, nil
+	}
+	data := make(ExternalRenderData, len(cr.Spec.ExternalRenderData))
+	for _, source := range cr.Spec.ExternalRenderData {
+		if _, ok := data[source.Prefix]; ok {
+			return nil, errors.Errorf("duplicate external render data prefix %s", source.Prefix)
+		}
+		if (source.ConfigMap == "") == (source.Secret == "") {
+			return nil, errors.Errorf("external render data %s must reference exactly one of a ConfigMap and a Secret",
+				source.Prefix)
+		}
+		if source.ConfigMap != "" {
+			cm := &corev1.ConfigMap{}
+			if err := getExternalRenderDataSource(ctx, c, "ConfigMap", source.ConfigMap, cm); err != nil {
+				return nil, err
+			}
+			values := make(map[string]string, len(cm.Data))
+			for key, value := range cm.Data {
+				values[key] = value
+			}
+			data[source.Prefix] = values
+			continue
+		}
+		secret := &corev1.Secret{}
+		if err := getExternalRenderDataSource(ctx, c, "Secret", source.Secret, secret); err != nil {
+			return nil, err
+		}
+		values := make(secretRenderValues, len(secret.Data))
+		for key, value := range secret.Data {
+			values[key] = string(value)
+		}
+		data[source.Prefix] = values
+	}
+	return data, nil
+}
+
+// getExternalRenderDataSource gets an external render data source from the operator resources namespace
+func getExternalRenderDataSource(ctx context.Context, c client.Reader, kind, name string, obj client.Object) error {
+	key := types.NamespacedName{Namespace: consts.NetworkOperatorResourceNamespace, Name: name}
+	if err := c.Get(ctx, key, obj); err != nil {
+		if apierrors.IsNotFound(err) {
+			return errors.Errorf("%s %s referenced by externalRenderData not found", kind, key)
+		}
+		return errors.Wrapf(err, "failed to get %s %s referenced by externalRenderData", kind, key)
+	}
+	return nil
+}
+
+// IsExternalRenderDataSource checks if the ConfigMap or Secret is referenced by the external render data of
+// NicClusterPolicy
+func IsExternalRenderDataSource(cr *mellanoxv1alpha1.NicClusterPolicy, obj client.Object) bool {
+	if obj.GetNamespace() != consts.NetworkOperatorResourceNamespace {
+		return false
+	}
+	for _, source := range cr.Spec.ExternalRenderData {
+		switch obj.(type) {
+		case *corev1.ConfigMap:
+			if source.ConfigMap == obj.GetName() {
+				return true
+			}
+		case *corev1.Secret:
+			if source.Secret == obj.GetName() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Fingerprint returns a hash of the external render data which changes when a value changes
+func (d ExternalRenderData) Fingerprint() (string, error) {
+	h := sha256.New()
+	if err := d.writeTo(h); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// writeTo writes the external render data, Secret values included, to h
+func (d ExternalRenderData) writeTo(h hash.Hash) error {
+	values := make(map[string]map[string]string, len(d))
+	for prefix, v := range d {
+		switch v := v.(type) {
+		case map[string]string:
+			values[prefix] = v
+		case secretRenderValues:
+			// converted to a plain map so the values are not redacted
+			values[prefix] = map[string]string(v)
+		}
+	}
+	data, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+	h.Write(data)
+	return nil
+}
@@ -0,0 +1,114 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	mellanoxv1alpha1 "github.com/Mellanox/network-operator/api/v1alpha1"
+	"github.com/Mellanox/network-operator/pkg/consts"
+	"github.com/Mellanox/network-operator/pkg/render"
+	"github.com/Mellanox/network-operator/pkg/utils"
+)
+
+var _ = Describe("External render data tests", func() {
+	var k8sClient client.Client
+	var cr *mellanoxv1alpha1.NicClusterPolicy
+
+	BeforeEach(func() {
+		k8sClient = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+			&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "ufm-config", Namespace: consts.NetworkOperatorResourceNamespace},
+				Data:       map[string]string{"endpoint": "https://ufm.example.com"},
+			},
+			&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "ufm-auth", Namespace: consts.NetworkOperatorResourceNamespace},
+				Data:       map[string][]byte{"token": []byte("s3cr3t")},
+			},
+		).Build()
+		cr = &mellanoxv1alpha1.NicClusterPolicy{}
+		cr.Spec.ExternalRenderData = []mellanoxv1alpha1.ExternalRenderDataSpec{
+			{Prefix: "ufm", ConfigMap: "ufm-config"},
+			{Prefix: "ufmAuth", Secret: "ufm-auth"},
+		}
+	})
+
+	It("Should render the values of the referenced ConfigMaps and Secrets", func() {
+		data, err := ResolveExternalRenderData(context.Background(), k8sClient, cr)
+		Expect(err).NotTo(HaveOccurred())
+
+		files, err := utils.GetFilesWithSuffix("testdata/external-render-data", render.ManifestFileSuffix...)
+		Expect(err).NotTo(HaveOccurred())
+		renderData := &struct{ RuntimeSpec *runtimeSpec }{
+			RuntimeSpec: &runtimeSpec{Namespace: consts.NetworkOperatorResourceNamespace, External: data},
+		}
+		objs, err := render.NewRenderer(files).RenderObjects(&render.TemplatingData{Data: renderData})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(objs).To(HaveLen(1))
+		Expect(objs[0].Object["data"]).To(Equal(map[string]interface{}{
+			"endpoint": "https://ufm.example.com",
+			"token":    "s3cr3t",
+		}))
+	})
+	It("Should redact Secret values when marshaled for logging", func() {
+		data, err := ResolveExternalRenderData(context.Background(), k8sClient, cr)
+		Expect(err).NotTo(HaveOccurred())
+		logged, err := json.Marshal(data)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(logged)).To(ContainSubstring("https://ufm.example.com"))
+		Expect(string(logged)).NotTo(ContainSubstring("s3cr3t"))
+	})
+	It("Should change the sync input hash when a Secret value changes", func() {
+		data, err := ResolveExternalRenderData(context.Background(), k8sClient, cr)
+		Expect(err).NotTo(HaveOccurred())
+		before := sha256.New()
+		Expect(data.writeTo(before)).To(Succeed())
+		data["ufmAuth"].(secretRenderValues)["token"] = "changed"
+		after := sha256.New()
+		Expect(data.writeTo(after)).To(Succeed())
+		Expect(after.Sum(nil)).NotTo(Equal(before.Sum(nil)))
+	})
+	It("Should fail if a referenced object does not exist", func() {
+		cr.Spec.ExternalRenderData[1].Secret = "missing"
+		_, err := ResolveExternalRenderData(context.Background(), k8sClient, cr)
+		Expect(err).To(MatchError(
+			"Secret nvidia-network-operator-resources/missing referenced by externalRenderData not found"))
+	})
+	It("Should fail on duplicate prefixes", func() {
+		cr.Spec.ExternalRenderData[1].Prefix = "ufm"
+		_, err := ResolveExternalRenderData(context.Background(), k8sClient, cr)
+		Expect(err).To(HaveOccurred())
+	})
+	It("Should match the referenced objects only", func() {
+		cm := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "ufm-config", Namespace: consts.NetworkOperatorResourceNamespace}}
+		Expect(IsExternalRenderDataSource(cr, cm)).To(BeTrue())
+		cm.Name = "ufm-auth"
+		Expect(IsExternalRenderDataSource(cr, cm)).To(BeFalse())
+	})
+})
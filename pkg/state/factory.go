@@ -22,7 +22,6 @@ import (
 
 	"github.com/pkg/errors"
 	"k8s.io/apimachinery/pkg/runtime"
-	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	mellanoxv1alpha1 "github.com/Mellanox/network-operator/api/v1alpha1"
 	"github.com/Mellanox/network-operator/pkg/config"
@@ -30,8 +29,9 @@ import (
 )
 
 // NewStateManager creates a state.Manager for the given CRD Kind
-func NewManager(crdKind string, k8sAPIClient client.Client, scheme *runtime.Scheme) (Manager, error) {
-	stateGroups, err := newStates(crdKind, k8sAPIClient, scheme)
+func NewManager(crdKind string, clientProvider ClientProvider, scheme *runtime.Scheme,
+	opts ...ManagerOption) (Manager, error) {
+	stateGroups, err := newStates(crdKind, clientProvider, scheme)
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to create state manager")
 	}
@@ -46,21 +46,25 @@ func NewManager(crdKind string, k8sAPIClient client.Client, scheme *runtime.Sche
 		log.V(consts.LogLevelDebug).Info("Creating a new State manager with", "states:", stateNames)
 	}
 
-	return &stateManager{
-		stateGroups: stateGroups,
-		client:      k8sAPIClient,
-	}, nil
+	smgr := &stateManager{
+		stateGroups:    stateGroups,
+		clientProvider: clientProvider,
+	}
+	for _, opt := range opts {
+		opt(smgr)
+	}
+	return smgr, nil
 }
 
 // newStates creates States that compose a State manager
-func newStates(crdKind string, k8sAPIClient client.Client, scheme *runtime.Scheme) ([]Group, error) {
+func newStates(crdKind string, clientProvider ClientProvider, scheme *runtime.Scheme) ([]Group, error) {
 	switch crdKind {
 	case mellanoxv1alpha1.NicClusterPolicyCRDName:
-		return newNicClusterPolicyStates(k8sAPIClient, scheme)
+		return newNicClusterPolicyStates(clientProvider, scheme)
 	case mellanoxv1alpha1.MacvlanNetworkCRDName:
-		return newMacvlanNetworkStates(k8sAPIClient, scheme)
+		return newMacvlanNetworkStates(clientProvider, scheme)
 	case mellanoxv1alpha1.HostDeviceNetworkCRDName:
-		return newHostDeviceNetworkStates(k8sAPIClient, scheme)
+		return newHostDeviceNetworkStates(clientProvider, scheme)
 	default:
 		break
 	}
@@ -68,52 +72,79 @@ func newStates(crdKind string, k8sAPIClient client.Client, scheme *runtime.Schem
 }
 
 // newNicClusterPolicyStates creates states that reconcile NicClusterPolicy CRD
-func newNicClusterPolicyStates(k8sAPIClient client.Client, scheme *runtime.Scheme) ([]Group, error) {
+func newNicClusterPolicyStates(clientProvider ClientProvider, scheme *runtime.Scheme) ([]Group, error) {
 	manifestBaseDir := config.FromEnv().State.ManifestBaseDir
 	ofedState, err := NewStateOFED(
-		k8sAPIClient, scheme, filepath.Join(manifestBaseDir, "stage-ofed-driver"))
+		clientProvider, scheme, filepath.Join(manifestBaseDir, "stage-ofed-driver"))
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to create OFED driver State")
 	}
 
 	sharedDpState, err := NewStateSharedDp(
-		k8sAPIClient, scheme, filepath.Join(manifestBaseDir, "stage-rdma-device-plugin"))
+		clientProvider, scheme, filepath.Join(manifestBaseDir, "stage-rdma-device-plugin"))
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to create Shared Device plugin State")
 	}
 	sriovDpState, err := NewStateSriovDp(
-		k8sAPIClient, scheme, filepath.Join(manifestBaseDir, "stage-sriov-device-plugin"))
+		clientProvider, scheme, filepath.Join(manifestBaseDir, "stage-sriov-device-plugin"))
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to create SR-IOV Device plugin State")
 	}
 	nvPeerMemState, err := NewStateNVPeer(
-		k8sAPIClient, scheme, filepath.Join(manifestBaseDir, "stage-nv-peer-mem-driver"))
+		clientProvider, scheme, filepath.Join(manifestBaseDir, "stage-nv-peer-mem-driver"))
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to create NV peer memory driver State")
 	}
 	multusState, err := NewStateMultusCNI(
-		k8sAPIClient, scheme, filepath.Join(manifestBaseDir, "stage-multus-cni"))
+		clientProvider, scheme, filepath.Join(manifestBaseDir, "stage-multus-cni"))
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to create Multus CNI State")
 	}
 	cniPluginsState, err := NewStateCNIPlugins(
-		k8sAPIClient, scheme, filepath.Join(manifestBaseDir, "stage-container-networking-plugins"))
+		clientProvider, scheme, filepath.Join(manifestBaseDir, "stage-container-networking-plugins"))
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to create Container Networking CNI Plugins State")
 	}
 	whereaboutState, err := NewStateWhereaboutsCNI(
-		k8sAPIClient, scheme, filepath.Join(manifestBaseDir, "stage-whereabouts-cni"))
+		clientProvider, scheme, filepath.Join(manifestBaseDir, "stage-whereabouts-cni"))
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to create Whereabouts CNI State")
 	}
 	podSecurityPolicyState, err := NewStatePodSecurityPolicy(
-		k8sAPIClient, scheme, filepath.Join(manifestBaseDir, "stage-pod-security-policy"))
+		clientProvider, scheme, filepath.Join(manifestBaseDir, "stage-pod-security-policy"))
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to create Pod Security Policy State")
 	}
+	podSecurityAdmissionState, err := NewStatePodSecurityAdmission(clientProvider, scheme)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create Pod Security Admission State")
+	}
+	nodeFeatureRuleState, err := NewStateNodeFeatureRule(
+		clientProvider, scheme, filepath.Join(manifestBaseDir, "stage-node-feature-rule"))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create NodeFeatureRule State")
+	}
+	resourceQuotaState, err := NewStateResourceQuota(
+		clientProvider, scheme, filepath.Join(manifestBaseDir, "stage-resource-quota"))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create ResourceQuota State")
+	}
+	// PriorityClass state is in the first group so the PriorityClass is created before the Pods referencing it
+	priorityClassState, err := NewStatePriorityClass(
+		clientProvider, scheme, filepath.Join(manifestBaseDir, "stage-priority-class"))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create PriorityClass State")
+	}
+	validatingWebhookState, err := NewStateValidatingWebhook(
+		clientProvider, scheme, filepath.Join(manifestBaseDir, "stage-validating-webhook"))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create ValidatingWebhook State")
+	}
 
 	return []Group{
-		NewStateGroup([]State{podSecurityPolicyState}),
+		NewStateGroup([]State{
+			podSecurityPolicyState, podSecurityAdmissionState, nodeFeatureRuleState, resourceQuotaState,
+			priorityClassState, validatingWebhookState}),
 		NewStateGroup([]State{multusState, cniPluginsState, whereaboutState}),
 		NewStateGroup([]State{ofedState}),
 		NewStateGroup([]State{sriovDpState}),
@@ -122,11 +153,11 @@ func newNicClusterPolicyStates(k8sAPIClient client.Client, scheme *runtime.Schem
 }
 
 // newMacvlanNetworkStates creates states that reconcile MacvlanNetwork CRD
-func newMacvlanNetworkStates(k8sAPIClient client.Client, scheme *runtime.Scheme) ([]Group, error) {
+func newMacvlanNetworkStates(clientProvider ClientProvider, scheme *runtime.Scheme) ([]Group, error) {
 	manifestBaseDir := config.FromEnv().State.ManifestBaseDir
 
 	macvlanNetworkState, err := NewStateMacvlanNetwork(
-		k8sAPIClient, scheme, filepath.Join(manifestBaseDir, "stage-macvlan-network"))
+		clientProvider, scheme, filepath.Join(manifestBaseDir, "stage-macvlan-network"))
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to create MacvlanNetwork CRD State")
 	}
@@ -136,11 +167,11 @@ func newMacvlanNetworkStates(k8sAPIClient client.Client, scheme *runtime.Scheme)
 }
 
 // newHostDeviceNetworkStates creates states that reconcile HostDeviceNetwork CRD
-func newHostDeviceNetworkStates(k8sAPIClient client.Client, scheme *runtime.Scheme) ([]Group, error) {
+func newHostDeviceNetworkStates(clientProvider ClientProvider, scheme *runtime.Scheme) ([]Group, error) {
 	manifestBaseDir := config.FromEnv().State.ManifestBaseDir
 
 	hostdeviceNetworkState, err := NewStateHostDeviceNetwork(
-		k8sAPIClient, scheme, filepath.Join(manifestBaseDir, "stage-hostdevice-network"))
+		clientProvider, scheme, filepath.Join(manifestBaseDir, "stage-hostdevice-network"))
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to create HostDeviceNetwork CRD State")
 	}
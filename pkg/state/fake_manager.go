@@ -17,6 +17,8 @@ limitations under the License.
 package state
 
 import (
+	"context"
+
 	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
@@ -31,7 +33,8 @@ func (m *fakeMananger) GetWatchSources() []*source.Kind {
 }
 
 // SyncState reconciles the state of the system for the custom resource
-func (m *fakeMananger) SyncState(customResource interface{}, infoCatalog InfoCatalog) (Results, error) {
+func (m *fakeMananger) SyncState(
+	ctx context.Context, customResource interface{}, infoCatalog InfoCatalog) (Results, error) {
 	return Results{
 		Status:       SyncStateNotReady,
 		StatesStatus: nil,
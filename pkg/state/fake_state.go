@@ -17,6 +17,9 @@ limitations under the License.
 package state
 
 import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
@@ -24,6 +27,9 @@ type fakeState struct {
 	name, description string
 	watchResources    map[string]*source.Kind
 	syncState         SyncState
+	syncErr           error
+	// syncCount is the number of Sync invocations
+	syncCount int
 }
 
 // Name provides the State name
@@ -38,11 +44,43 @@ func (s *fakeState) Description() string {
 
 // Sync attempt to get the system to match the desired state which State represent.
 // a sync operation must be relatively short and must not block the execution thread.
-func (s *fakeState) Sync(customResource interface{}, infoCatalog InfoCatalog) (SyncState, error) {
-	return s.syncState, nil
+func (s *fakeState) Sync(
+	ctx context.Context, customResource interface{}, infoCatalog InfoCatalog) (SyncState, error) {
+	s.syncCount++
+	return s.syncState, s.syncErr
 }
 
 // Get a map of source kinds that should be watched for the state keyed by the source kind name
 func (s *fakeState) GetWatchSources() map[string]*source.Kind {
 	return s.watchResources
 }
+
+// fakeRenderingState applies a fixed set of objects
+type fakeRenderingState struct {
+	stateSkel
+	objs []*unstructured.Unstructured
+}
+
+// Sync attempt to get the system to match the desired state which State represent.
+// a sync operation must be relatively short and must not block the execution thread.
+func (s *fakeRenderingState) Sync(
+	ctx context.Context, customResource interface{}, infoCatalog InfoCatalog) (SyncState, error) {
+	k8sClient, err := s.getClient(customResource)
+	if err != nil {
+		return SyncStateNotReady, err
+	}
+	objs := make([]*unstructured.Unstructured, 0, len(s.objs))
+	for _, obj := range s.objs {
+		objs = append(objs, obj.DeepCopy())
+	}
+	err = s.createOrUpdateObjs(ctx, k8sClient, func(obj *unstructured.Unstructured) error { return nil }, objs)
+	if err != nil {
+		return SyncStateNotReady, err
+	}
+	return SyncStateReady, nil
+}
+
+// Get a map of source kinds that should be watched for the state keyed by the source kind name
+func (s *fakeRenderingState) GetWatchSources() map[string]*source.Kind {
+	return map[string]*source.Kind{}
+}
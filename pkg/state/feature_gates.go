@@ -0,0 +1,31 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+// featureGates holds the feature gates declared on the NicClusterPolicy, keyed by gate name.
+// It is exposed to templates through runtimeSpec, e.g:
+//
+//	{{ if .RuntimeSpec.FeatureGates.Enabled "OFEDDriverHostNetwork" false }} ... {{ end }}
+type featureGates map[string]bool
+
+// Enabled returns the value of the named gate, defaultValue is returned if the gate is not declared
+func (f featureGates) Enabled(name string, defaultValue bool) bool {
+	if val, ok := f[name]; ok {
+		return val
+	}
+	return defaultValue
+}
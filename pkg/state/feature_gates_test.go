@@ -0,0 +1,65 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	mellanoxv1alpha1 "github.com/Mellanox/network-operator/api/v1alpha1"
+	"github.com/Mellanox/network-operator/pkg/consts"
+	"github.com/Mellanox/network-operator/pkg/render"
+	"github.com/Mellanox/network-operator/pkg/utils"
+)
+
+var _ = Describe("Feature gates tests", func() {
+	Context("Enabled", func() {
+		It("Should return the gate value if declared", func() {
+			gates := featureGates{"Enabled": true, "Disabled": false}
+			Expect(gates.Enabled("Enabled", false)).To(BeTrue())
+			Expect(gates.Enabled("Disabled", true)).To(BeFalse())
+		})
+		It("Should return the default value if not declared", func() {
+			var gates featureGates
+			Expect(gates.Enabled("Unknown", true)).To(BeTrue())
+			Expect(gates.Enabled("Unknown", false)).To(BeFalse())
+		})
+	})
+
+	Context("Rendering", func() {
+		renderGate := func(cr *mellanoxv1alpha1.NicClusterPolicy) string {
+			files, err := utils.GetFilesWithSuffix("testdata/feature-gates", render.ManifestFileSuffix...)
+			Expect(err).NotTo(HaveOccurred())
+			data := &struct{ RuntimeSpec *runtimeSpec }{
+				RuntimeSpec: &runtimeSpec{Namespace: consts.NetworkOperatorResourceNamespace, FeatureGates: cr.Spec.FeatureGates},
+			}
+			objs, err := render.NewRenderer(files).RenderObjects(&render.TemplatingData{Data: data})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(len(objs)).To(Equal(1))
+			return objs[0].Object["data"].(map[string]interface{})["gate"].(string)
+		}
+
+		It("Should toggle rendered output according to the gate declared on the CR", func() {
+			cr := &mellanoxv1alpha1.NicClusterPolicy{}
+			Expect(renderGate(cr)).To(Equal("disabled"))
+			cr.Spec.FeatureGates = map[string]bool{"TestGate": true}
+			Expect(renderGate(cr)).To(Equal("enabled"))
+			cr.Spec.FeatureGates["TestGate"] = false
+			Expect(renderGate(cr)).To(Equal("disabled"))
+		})
+	})
+})
@@ -17,7 +17,14 @@ limitations under the License.
 package state
 
 import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+
 	"github.com/Mellanox/network-operator/pkg/consts"
+	"github.com/Mellanox/network-operator/pkg/tracing"
 )
 
 // Group Represents a set of disjoint States that are Synced (Reconciled) together
@@ -35,17 +42,75 @@ func NewStateGroup(states []State) Group {
 }
 
 // SyncGroup sync and update status for a list of states
-func (sg *Group) Sync(customResource interface{}, infoCatalog InfoCatalog) (results []Result) {
+func (sg *Group) Sync(ctx context.Context, customResource interface{}, infoCatalog InfoCatalog) (results []Result) {
 	// sync and update status for the list of states
 	for i := range sg.states {
 		log.V(consts.LogLevelInfo).Info(
 			"Sync State", "Name:", sg.states[i].Name(), "Description:", sg.states[i].Description())
-		status, err := sg.states[i].Sync(customResource, infoCatalog)
-		sg.results[&sg.states[i]] = Result{
-			StateName: sg.states[i].Name(),
-			Status:    status,
-			ErrInfo:   err,
+		if isThrottled(ctx, sg.states[i].Name()) {
+			// the state is synced again on a later reconcile, once its rate limit allows it
+			log.V(consts.LogLevelInfo).Info("Skipping State, Sync rate limit exceeded", "Name:", sg.states[i].Name())
+			sg.results[&sg.states[i]] = Result{StateName: sg.states[i].Name(), Status: SyncStateNotReady}
+			continue
+		}
+		if result, ok := getCachedResult(ctx, sg.states[i].Name()); ok {
+			log.V(consts.LogLevelDebug).Info("Skipping State, inputs did not change since last ready Sync",
+				"Name:", sg.states[i].Name())
+			// the result of the last Sync is reused, no object was applied or pruned
+			result.AppliedObjects, result.PrunedObjects, result.Duration = 0, 0, 0
+			sg.results[&sg.states[i]] = result
+			continue
+		}
+		if consumer, ok := sg.states[i].(externalRenderDataConsumer); ok && infoCatalog != nil {
+			consumer.setExternalRenderData(infoCatalog.GetExternalRenderData())
+		}
+		if reporter, ok := sg.states[i].(workloadReadinessReporter); ok {
+			reporter.resetWorkloadReadiness()
+		}
+		stateCtx, span := tracing.StartSpan(ctx, "State.Sync", attribute.String("state", sg.states[i].Name()))
+		stateCtx = withSyncPhases(stateCtx, sg.states[i].Name())
+		stateCtx, counts := withObjectCounts(stateCtx)
+		start := time.Now()
+		status, err := sg.states[i].Sync(stateCtx, customResource, infoCatalog)
+		duration := time.Since(start)
+		if isMissingResourceLimitsError(err) {
+			// the rendered objects must be fixed, retrying the sync does not help
+			status = SyncStateError
+		}
+		span.SetAttributes(attribute.String("status", string(status)))
+		tracing.EndSpan(span, err)
+		recordStateEvent(ctx, sg.states[i].Name(), status, err)
+		result := Result{
+			StateName:      sg.states[i].Name(),
+			Status:         status,
+			ErrInfo:        err,
+			AppliedObjects: int(atomic.LoadInt64(&counts.applied)),
+			PrunedObjects:  int(atomic.LoadInt64(&counts.pruned)),
+			Duration:       duration,
+		}
+		if reporter, ok := sg.states[i].(skippedNodesReporter); ok {
+			result.SkippedNodes = reporter.SkippedNodes()
+		}
+		if reporter, ok := sg.states[i].(warningsReporter); ok {
+			result.Warnings = reporter.Warnings()
+		}
+		if reporter, ok := sg.states[i].(noEligibleNodesReporter); ok {
+			result.NoEligibleNodesFilter = reporter.NoEligibleNodesFilter()
+		}
+		if reporter, ok := sg.states[i].(workloadReadinessReporter); ok {
+			result.Workloads = reporter.WorkloadReadiness()
+		}
+		if reporter, ok := sg.states[i].(nodeModesReporter); ok {
+			result.NodeModes = reporter.NodeModes()
+		}
+		if reporter, ok := sg.states[i].(osGroupsReporter); ok {
+			result.OSGroups = reporter.OSGroups()
+		}
+		if reporter, ok := sg.states[i].(resyncReporter); ok {
+			result.ResyncAfter = reporter.ResyncAfter()
 		}
+		cacheResult(ctx, result)
+		sg.results[&sg.states[i]] = result
 	}
 	results = sg.Results()
 	log.V(consts.LogLevelDebug).Info("syncGroup", "results:", results)
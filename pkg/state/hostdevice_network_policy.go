@@ -0,0 +1,101 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	mellanoxv1alpha1 "github.com/Mellanox/network-operator/api/v1alpha1"
+	"github.com/Mellanox/network-operator/pkg/consts"
+)
+
+const networkPolicyKind = "NetworkPolicy"
+
+// hostDeviceNetworkPolicy is the render data of the NetworkPolicies of the namespace of a HostDeviceNetwork
+type hostDeviceNetworkPolicy struct {
+	// AllowedNamespaces traffic is allowed from and to
+	AllowedNamespaces []string
+}
+
+// getHostDeviceNetworkPolicy returns the render data of the NetworkPolicies allowing traffic from and to the
+// operator namespace and namespaces, nil if the NetworkPolicies are not rendered
+func getHostDeviceNetworkPolicy(enabled bool, namespaces []string) *hostDeviceNetworkPolicy {
+	if !enabled {
+		return nil
+	}
+	policy := &hostDeviceNetworkPolicy{AllowedNamespaces: []string{consts.NetworkOperatorResourceNamespace}}
+	seen := map[string]bool{consts.NetworkOperatorResourceNamespace: true}
+	for _, namespace := range namespaces {
+		if namespace != "" && !seen[namespace] {
+			seen[namespace] = true
+			policy.AllowedNamespaces = append(policy.AllowedNamespaces, namespace)
+		}
+	}
+	return policy
+}
+
+// claimNetworkPolicies adds cr to the owners of the NetworkPolicies in objs. The NetworkPolicies of a namespace are
+// shared by the HostDeviceNetworks targeting it and deleted once all of them are deleted. If any of the
+// NetworkPolicies exists and is not managed by the operator, none is applied in the namespace: they are removed from
+// the returned objects and a warning is returned.
+func (s *stateHostDeviceNetwork) claimNetworkPolicies(ctx context.Context, c client.Client,
+	cr *mellanoxv1alpha1.HostDeviceNetwork, objs []*unstructured.Unstructured) (
+	[]*unstructured.Unstructured, string, error) {
+	claimed := make([]*unstructured.Unstructured, 0, len(objs))
+	for _, obj := range objs {
+		if obj.GetKind() != networkPolicyKind {
+			claimed = append(claimed, obj)
+			continue
+		}
+		current := obj.DeepCopy()
+		err := c.Get(ctx, client.ObjectKeyFromObject(current), current)
+		if err != nil && !k8serrors.IsNotFound(err) {
+			return nil, "", errors.Wrapf(err, "failed to get NetworkPolicy %s", obj.GetName())
+		}
+		if err == nil {
+			if current.GetLabels()[consts.NetworkOperatorOwnedLabel] != "true" {
+				return removeKind(objs, networkPolicyKind), fmt.Sprintf(
+					"NetworkPolicy %s/%s is not managed by the operator, NetworkPolicies are not applied in "+
+						"namespace %s", obj.GetNamespace(), obj.GetName(), obj.GetNamespace()), nil
+			}
+			obj.SetOwnerReferences(current.GetOwnerReferences())
+		}
+		if err := controllerutil.SetOwnerReference(cr, obj, s.scheme); err != nil {
+			return nil, "", errors.Wrap(err, "failed to set owner reference for NetworkPolicy")
+		}
+		claimed = append(claimed, obj)
+	}
+	return claimed, "", nil
+}
+
+// removeKind returns objs without the objects of kind
+func removeKind(objs []*unstructured.Unstructured, kind string) []*unstructured.Unstructured {
+	result := make([]*unstructured.Unstructured, 0, len(objs))
+	for _, obj := range objs {
+		if obj.GetKind() != kind {
+			result = append(result, obj)
+		}
+	}
+	return result
+}
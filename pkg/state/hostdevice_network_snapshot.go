@@ -0,0 +1,63 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// HostDeviceNetworkConfigSnapshotName is the name of the ConfigMap snapshotting the CNI config last applied for each
+// HostDeviceNetwork, keyed by HostDeviceNetwork name, for drift tooling to diff the live configs against
+const HostDeviceNetworkConfigSnapshotName = "host-device-network-cni-config-snapshot"
+
+// updateCNIConfigSnapshot sets the CNI config of netAttDef, applied for the HostDeviceNetwork name, in the snapshot
+// ConfigMap in namespace. The ConfigMap is not owned by the HostDeviceNetworks, so the last applied configs are kept
+// when they are changed or deleted. It is not labeled as owned by the operator either, so it is never pruned.
+func updateCNIConfigSnapshot(ctx context.Context, c client.Client, namespace, name string,
+	netAttDef *unstructured.Unstructured) error {
+	config, _, err := unstructured.NestedString(netAttDef.Object, "spec", "config")
+	if err != nil {
+		return errors.Wrap(err, "failed to get CNI config")
+	}
+	cm := &corev1.ConfigMap{}
+	err = c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: HostDeviceNetworkConfigSnapshotName}, cm)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return errors.Wrap(err, "failed to get CNI config snapshot ConfigMap")
+	}
+	exists := err == nil
+	if exists && cm.Data[name] == config {
+		return nil
+	}
+
+	cm.Name = HostDeviceNetworkConfigSnapshotName
+	cm.Namespace = namespace
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	cm.Data[name] = config
+	if exists {
+		return errors.Wrap(c.Update(ctx, cm), "failed to update CNI config snapshot ConfigMap")
+	}
+	return errors.Wrap(c.Create(ctx, cm), "failed to create CNI config snapshot ConfigMap")
+}
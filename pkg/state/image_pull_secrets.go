@@ -0,0 +1,97 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	mellanoxv1alpha1 "github.com/Mellanox/network-operator/api/v1alpha1"
+	"github.com/Mellanox/network-operator/pkg/consts"
+)
+
+// getImageSpecs returns the image specs of the components enabled in NicClusterPolicy
+func getImageSpecs(cr *mellanoxv1alpha1.NicClusterPolicy) []*mellanoxv1alpha1.ImageSpec {
+	var specs []*mellanoxv1alpha1.ImageSpec
+	if cr.Spec.OFEDDriver != nil {
+		specs = append(specs, &cr.Spec.OFEDDriver.ImageSpec)
+		if exporter := cr.Spec.OFEDDriver.MetricsExporter; exporter != nil && exporter.Enabled {
+			specs = append(specs, &exporter.ImageSpec)
+		}
+	}
+	if cr.Spec.NVPeerDriver != nil {
+		specs = append(specs, &cr.Spec.NVPeerDriver.ImageSpec)
+	}
+	if cr.Spec.RdmaSharedDevicePlugin != nil {
+		specs = append(specs, &cr.Spec.RdmaSharedDevicePlugin.ImageSpec)
+	}
+	if cr.Spec.SriovDevicePlugin != nil {
+		specs = append(specs, &cr.Spec.SriovDevicePlugin.ImageSpec)
+	}
+	if cr.Spec.SecondaryNetwork != nil {
+		if cr.Spec.SecondaryNetwork.CniPlugins != nil {
+			specs = append(specs, cr.Spec.SecondaryNetwork.CniPlugins)
+		}
+		if cr.Spec.SecondaryNetwork.Multus != nil {
+			specs = append(specs, &cr.Spec.SecondaryNetwork.Multus.ImageSpec)
+		}
+		if cr.Spec.SecondaryNetwork.IpamPlugin != nil {
+			specs = append(specs, &cr.Spec.SecondaryNetwork.IpamPlugin.ImageSpec)
+		}
+	}
+	return specs
+}
+
+// ResolveImagePullSecrets adds the imagePullSecrets of the ServiceAccounts referenced by imagePullSecretsFrom to
+// the imagePullSecrets of the components. The CR is modified in place, callers should pass a copy to keep the
+// resolved secrets out of the stored spec.
+func ResolveImagePullSecrets(ctx context.Context, c client.Client, cr *mellanoxv1alpha1.NicClusterPolicy) error {
+	for _, spec := range getImageSpecs(cr) {
+		if spec.ImagePullSecretsFrom == "" {
+			continue
+		}
+		sa := &corev1.ServiceAccount{}
+		key := types.NamespacedName{Namespace: consts.NetworkOperatorResourceNamespace, Name: spec.ImagePullSecretsFrom}
+		if err := c.Get(ctx, key, sa); err != nil {
+			if apierrors.IsNotFound(err) {
+				return errors.Errorf("ServiceAccount %s referenced by imagePullSecretsFrom of image %s not found",
+					key, spec.Image)
+			}
+			return errors.Wrapf(err, "failed to get ServiceAccount %s referenced by imagePullSecretsFrom", key)
+		}
+		for _, secret := range sa.ImagePullSecrets {
+			if !containsString(spec.ImagePullSecrets, secret.Name) {
+				spec.ImagePullSecrets = append(spec.ImagePullSecrets, secret.Name)
+			}
+		}
+	}
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
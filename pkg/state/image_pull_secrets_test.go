@@ -0,0 +1,65 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	mellanoxv1alpha1 "github.com/Mellanox/network-operator/api/v1alpha1"
+	"github.com/Mellanox/network-operator/pkg/consts"
+)
+
+var _ = Describe("Image pull secrets tests", func() {
+	var k8sClient client.Client
+	var cr *mellanoxv1alpha1.NicClusterPolicy
+
+	BeforeEach(func() {
+		k8sClient = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+			&corev1.ServiceAccount{
+				ObjectMeta:       metav1.ObjectMeta{Name: "registry-sa", Namespace: consts.NetworkOperatorResourceNamespace},
+				ImagePullSecrets: []corev1.LocalObjectReference{{Name: "secret-a"}, {Name: "secret-b"}},
+			},
+		).Build()
+		cr = &mellanoxv1alpha1.NicClusterPolicy{}
+		cr.Spec.OFEDDriver = &mellanoxv1alpha1.OFEDDriverSpec{ImageSpec: mellanoxv1alpha1.ImageSpec{
+			Image: "mofed", ImagePullSecrets: []string{"secret-a"}, ImagePullSecretsFrom: "registry-sa"}}
+		cr.Spec.RdmaSharedDevicePlugin = &mellanoxv1alpha1.DevicePluginSpec{ImageSpec: mellanoxv1alpha1.ImageSpec{
+			Image: "k8s-rdma-shared-dev-plugin", ImagePullSecrets: []string{"secret-c"}}}
+	})
+
+	It("Should add the secrets of the referenced ServiceAccount", func() {
+		Expect(ResolveImagePullSecrets(context.Background(), k8sClient, cr)).To(Succeed())
+		Expect(cr.Spec.OFEDDriver.ImagePullSecrets).To(Equal([]string{"secret-a", "secret-b"}))
+		Expect(cr.Spec.RdmaSharedDevicePlugin.ImagePullSecrets).To(Equal([]string{"secret-c"}))
+	})
+	It("Should fail if the referenced ServiceAccount does not exist", func() {
+		cr.Spec.RdmaSharedDevicePlugin.ImagePullSecretsFrom = "missing-sa"
+		err := ResolveImagePullSecrets(context.Background(), k8sClient, cr)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("missing-sa referenced by imagePullSecretsFrom"))
+		Expect(err.Error()).To(ContainSubstring("not found"))
+	})
+})
@@ -17,6 +17,8 @@ limitations under the License.
 package state
 
 import (
+	"github.com/pkg/errors"
+
 	"github.com/Mellanox/network-operator/pkg/nodeinfo"
 )
 
@@ -24,6 +26,7 @@ type InfoType uint
 
 const (
 	InfoTypeNodeInfo = iota
+	InfoTypeExternalRenderData
 )
 
 func NewInfoCatalog() InfoCatalog {
@@ -41,6 +44,8 @@ type InfoCatalog interface {
 	Add(InfoType, InfoSource)
 	// GetNodeInfoProvider returns a reference nodeinfo.Provider from catalog or nil if provider does not exist
 	GetNodeInfoProvider() nodeinfo.Provider
+	// GetExternalRenderData returns the external render data from catalog or nil if it does not exist
+	GetExternalRenderData() ExternalRenderData
 }
 
 type infoCatalog struct {
@@ -58,3 +63,25 @@ func (sc *infoCatalog) GetNodeInfoProvider() nodeinfo.Provider {
 	}
 	return infoSource.(nodeinfo.Provider)
 }
+
+func (sc *infoCatalog) GetExternalRenderData() ExternalRenderData {
+	infoSource, ok := sc.infoSources[InfoTypeExternalRenderData]
+	if !ok {
+		return nil
+	}
+	return infoSource.(ExternalRenderData)
+}
+
+// getNodeInfo returns the node information provider from the catalog, an error is returned if the catalog does not
+// provide node information or if the nodes could not be listed, which is distinct from listing no nodes. The node
+// listing error is kept as the cause so it is classified by IsTransientAPIError.
+func getNodeInfo(infoCatalog InfoCatalog) (nodeinfo.Provider, error) {
+	nodeInfo := infoCatalog.GetNodeInfoProvider()
+	if nodeInfo == nil {
+		return nil, errors.New("unexpected state, catalog does not provide node information")
+	}
+	if err := nodeInfo.Err(); err != nil {
+		return nil, errors.Wrap(err, "node information is unavailable")
+	}
+	return nodeInfo, nil
+}
@@ -0,0 +1,62 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// initContainerStep is a step of an init container chain, e.g waiting for the OFED driver before registering a
+// device plugin
+type initContainerStep struct {
+	// Order of the step in the chain, steps run in ascending order and must have distinct orders
+	Order int
+	// Container run by the step
+	Container v1.Container
+}
+
+// chainInitContainers validates the steps of an init container chain and returns their containers in the order the
+// steps must run, kubelet runs the init containers of a Pod one after the other in the order they are listed
+func chainInitContainers(steps []initContainerStep) ([]v1.Container, error) {
+	sorted := make([]initContainerStep, len(steps))
+	copy(sorted, steps)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Order < sorted[j].Order })
+
+	names := make(map[string]bool, len(sorted))
+	containers := make([]v1.Container, 0, len(sorted))
+	for i, step := range sorted {
+		name := step.Container.Name
+		if errs := validation.IsDNS1123Label(name); len(errs) != 0 {
+			return nil, errors.Errorf("invalid init container name %q: %s", name, strings.Join(errs, ", "))
+		}
+		if names[name] {
+			return nil, errors.Errorf("duplicate init container name %s", name)
+		}
+		names[name] = true
+		if i > 0 && sorted[i-1].Order == step.Order {
+			return nil, errors.Errorf("init containers %s and %s have the same order %d, the order of the steps "+
+				"is ambiguous", sorted[i-1].Container.Name, name, step.Order)
+		}
+		containers = append(containers, step.Container)
+	}
+	return containers, nil
+}
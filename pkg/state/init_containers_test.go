@@ -0,0 +1,63 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+var _ = Describe("Init container chain tests", func() {
+	step := func(order int, name string) initContainerStep {
+		return initContainerStep{Order: order, Container: v1.Container{Name: name, Image: "image"}}
+	}
+	names := func(containers []v1.Container) []string {
+		result := make([]string, 0, len(containers))
+		for _, c := range containers {
+			result = append(result, c.Name)
+		}
+		return result
+	}
+
+	It("Should order the init containers by step order", func() {
+		containers, err := chainInitContainers([]initContainerStep{
+			step(30, "register"), step(10, "build"), step(20, "load")})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(names(containers)).To(Equal([]string{"build", "load", "register"}))
+	})
+	It("Should return no init containers for an empty chain", func() {
+		containers, err := chainInitContainers(nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(containers).To(BeEmpty())
+	})
+	It("Should fail on steps with the same order", func() {
+		_, err := chainInitContainers([]initContainerStep{step(10, "build"), step(10, "load")})
+		Expect(err).To(HaveOccurred())
+	})
+	It("Should fail on duplicate names", func() {
+		_, err := chainInitContainers([]initContainerStep{step(10, "build"), step(20, "build")})
+		Expect(err).To(HaveOccurred())
+	})
+	It("Should fail on invalid names", func() {
+		for _, name := range []string{"", "Build", "build_modules", "-build"} {
+			_, err := chainInitContainers([]initContainerStep{step(10, name)})
+			Expect(err).To(HaveOccurred())
+		}
+	})
+})
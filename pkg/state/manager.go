@@ -17,10 +17,15 @@ limitations under the License.
 package state
 
 import (
-	"sigs.k8s.io/controller-runtime/pkg/client"
+	"context"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	"github.com/Mellanox/network-operator/pkg/consts"
+	"github.com/Mellanox/network-operator/pkg/tracing"
 )
 
 // StateManager manages a collection of states and handles transitions from State to State.
@@ -31,7 +36,7 @@ type Manager interface {
 	// SyncState reconciles the state of the system and returns a list of status of the applied states
 	// InfoCatalog is provided to optionally provide a State additional information sources required for it to perform
 	// the Sync operation.
-	SyncState(customResource interface{}, infoCatalog InfoCatalog) (Results, error)
+	SyncState(ctx context.Context, customResource interface{}, infoCatalog InfoCatalog) (Results, error)
 }
 
 // Represent a Result of a single State.Sync() invocation
@@ -40,6 +45,26 @@ type Result struct {
 	Status    SyncState
 	// if SyncStateError then ErrInfo will contain additional error information
 	ErrInfo error
+	// Nodes skipped by the State, if any
+	SkippedNodes []string
+	// Warnings reported by the State, if any
+	Warnings []string
+	// Node filter which matched no nodes, if the State found no eligible nodes
+	NoEligibleNodesFilter string
+	// Readiness of the workload objects applied by the State, if any
+	Workloads []WorkloadReadiness
+	// Mode the State is deployed in keyed by node name, if the State reports it
+	NodeModes map[string]string
+	// Eligible nodes grouped by OS distribution, if the State reports them
+	OSGroups []OSGroup
+	// Time after which the State must be synced again even if it is ready, zero if it does not need to be
+	ResyncAfter time.Duration
+	// Number of objects created or changed by the Sync of the State
+	AppliedObjects int
+	// Number of objects deleted by the Sync of the State as they are no longer rendered
+	PrunedObjects int
+	// Duration of the Sync of the State, zero if the Sync was skipped
+	Duration time.Duration
 }
 
 // Represent the Results of a collection of State.Sync() invocations, Status reflects the global status of all states.
@@ -49,9 +74,24 @@ type Results struct {
 	StatesStatus []Result
 }
 
+// ResyncAfter returns the shortest time after which one of the States must be synced again even if it is ready, zero
+// if none of them needs to be
+func (r *Results) ResyncAfter() time.Duration {
+	var resyncAfter time.Duration
+	for i := range r.StatesStatus {
+		after := r.StatesStatus[i].ResyncAfter
+		if after > 0 && (resyncAfter == 0 || after < resyncAfter) {
+			resyncAfter = after
+		}
+	}
+	return resyncAfter
+}
+
 type stateManager struct {
-	stateGroups []Group
-	client      client.Client
+	stateGroups    []Group
+	clientProvider ClientProvider
+	// rateLimiters throttle the Sync of the states, if set
+	rateLimiters *stateRateLimiters
 }
 
 func (smgr *stateManager) GetWatchSources() []*source.Kind {
@@ -79,7 +119,37 @@ func (smgr *stateManager) GetWatchSources() []*source.Kind {
 }
 
 // SyncState attempts to reconcile the system by invoking Sync on each of the states
-func (smgr *stateManager) SyncState(customResource interface{}, infoCatalog InfoCatalog) (Results, error) {
+func (smgr *stateManager) SyncState(
+	ctx context.Context, customResource interface{}, infoCatalog InfoCatalog) (Results, error) {
+	ctx, span := tracing.StartSpan(ctx, "StateManager.SyncState")
+	ctx = smgr.syncContext(ctx, customResource, infoCatalog)
+	results, err := smgr.syncStateGroups(ctx, customResource, infoCatalog)
+	tracing.EndSpan(span, err)
+	return results, err
+}
+
+// syncContext returns the context the states of the custom resource are synced with
+func (smgr *stateManager) syncContext(
+	ctx context.Context, customResource interface{}, infoCatalog InfoCatalog) context.Context {
+	// Detect objects rendered by more than one state
+	ctx = withRenderedObjects(ctx)
+	// Annotate applied objects with the generation of the custom resource they are rendered from
+	if obj, ok := customResource.(metav1.Object); ok {
+		ctx = withSourceGeneration(ctx, obj.GetGeneration())
+	}
+	// Record the state Events on the custom resource
+	if obj, ok := customResource.(runtime.Object); ok {
+		ctx = withEventObject(ctx, obj)
+	}
+	// Throttle the Sync of the rate limited states
+	ctx = withStateRateLimiters(ctx, smgr.rateLimiters)
+	// Skip the Sync of states whose inputs did not change, if the sync cache is enabled
+	ctx = withSyncInputs(ctx, customResource, infoCatalog)
+	return ctx
+}
+
+func (smgr *stateManager) syncStateGroups(
+	ctx context.Context, customResource interface{}, infoCatalog InfoCatalog) (Results, error) {
 	// Sync groups of states, transition from one group to the other when a group finishes
 	log.V(consts.LogLevelInfo).Info("Syncing system state")
 	managerResult := Results{
@@ -89,7 +159,7 @@ func (smgr *stateManager) SyncState(customResource interface{}, infoCatalog Info
 
 	for i, stateGroup := range smgr.stateGroups {
 		log.V(consts.LogLevelInfo).Info("Sync State group", "index", i)
-		results := stateGroup.Sync(customResource, infoCatalog)
+		results := stateGroup.Sync(ctx, customResource, infoCatalog)
 		managerResult.StatesStatus = append(managerResult.StatesStatus, results...)
 
 		done, err := stateGroup.SyncDone()
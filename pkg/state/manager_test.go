@@ -17,9 +17,23 @@ limitations under the License.
 package state
 
 import (
+	"context"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 
+	mellanoxv1alpha1 "github.com/Mellanox/network-operator/api/v1alpha1"
+	"github.com/Mellanox/network-operator/pkg/consts"
 	"github.com/Mellanox/network-operator/pkg/testing/mocks"
 )
 
@@ -37,10 +51,10 @@ var _ = Describe("Manager tests", func() {
 			}
 			client := mocks.ControllerRutimeClient{}
 			manager := &stateManager{
-				stateGroups: stateGroups,
-				client:      &client,
+				stateGroups:    stateGroups,
+				clientProvider: NewStaticClientProvider(&client),
 			}
-			results, err := manager.SyncState(nil, nil)
+			results, err := manager.SyncState(context.Background(), nil, nil)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(results.Status).To(Equal(SyncState(SyncStateReady)))
 			Expect(results.StatesStatus[0].StateName).To(Equal("test"))
@@ -62,10 +76,10 @@ var _ = Describe("Manager tests", func() {
 			}
 			client := mocks.ControllerRutimeClient{}
 			manager := &stateManager{
-				stateGroups: stateGroups,
-				client:      &client,
+				stateGroups:    stateGroups,
+				clientProvider: NewStaticClientProvider(&client),
 			}
-			results, err := manager.SyncState(nil, nil)
+			results, err := manager.SyncState(context.Background(), nil, nil)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(results.Status).To(Equal(SyncState(SyncStateNotReady)))
 			Expect(results.StatesStatus[0].StateName).To(Equal("test not ready"))
@@ -74,4 +88,138 @@ var _ = Describe("Manager tests", func() {
 			Expect(results.StatesStatus[1].Status).To(Equal(SyncState(SyncStateReady)))
 		})
 	})
+
+	Context("Conflicting states", func() {
+		var clientProvider ClientProvider
+
+		BeforeEach(func() {
+			clientProvider = NewStaticClientProvider(fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).Build())
+		})
+
+		newRenderingState := func(name string, objs ...*unstructured.Unstructured) State {
+			return &fakeRenderingState{
+				stateSkel: stateSkel{name: name, description: name + " description", clientProvider: clientProvider},
+				objs:      objs,
+			}
+		}
+		newConfigMap := func(name string) *unstructured.Unstructured {
+			obj := &unstructured.Unstructured{}
+			obj.SetAPIVersion("v1")
+			obj.SetKind("ConfigMap")
+			obj.SetNamespace("default")
+			obj.SetName(name)
+			return obj
+		}
+
+		It("Should report objects rendered by two states", func() {
+			manager := &stateManager{
+				stateGroups: []Group{
+					NewStateGroup([]State{newRenderingState("first", newConfigMap("shared"))}),
+					NewStateGroup([]State{newRenderingState("second", newConfigMap("other"), newConfigMap("shared"))}),
+				},
+				clientProvider: clientProvider,
+			}
+			results, err := manager.SyncState(context.Background(), nil, nil)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("conflict: ConfigMap default/shared is rendered by both first and second states"))
+			Expect(results.Status).To(Equal(SyncState(SyncStateNotReady)))
+		})
+
+		It("Should not report objects rendered by a single state", func() {
+			manager := &stateManager{
+				stateGroups: []Group{
+					NewStateGroup([]State{newRenderingState("first", newConfigMap("a"), newConfigMap("b"))}),
+				},
+				clientProvider: clientProvider,
+			}
+			results, err := manager.SyncState(context.Background(), nil, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(results.Status).To(Equal(SyncState(SyncStateReady)))
+		})
+	})
+
+	Context("Source generation", func() {
+		It("Should annotate applied objects with the generation of the custom resource", func() {
+			k8sClient := fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).Build()
+			obj := &unstructured.Unstructured{}
+			obj.SetAPIVersion("v1")
+			obj.SetKind("ConfigMap")
+			obj.SetNamespace("default")
+			obj.SetName("test")
+			manager := &stateManager{
+				stateGroups: []Group{NewStateGroup([]State{&fakeRenderingState{
+					stateSkel: stateSkel{name: "test", clientProvider: NewStaticClientProvider(k8sClient)},
+					objs:      []*unstructured.Unstructured{obj},
+				}})},
+				clientProvider: NewStaticClientProvider(k8sClient),
+			}
+			cr := &mellanoxv1alpha1.NicClusterPolicy{}
+			cr.SetName(consts.NicClusterPolicyResourceName)
+			cr.SetGeneration(3)
+
+			_, err := manager.SyncState(context.Background(), cr, nil)
+			Expect(err).NotTo(HaveOccurred())
+			cm := &corev1.ConfigMap{}
+			Expect(k8sClient.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "test"},
+				cm)).To(Succeed())
+			Expect(cm.Annotations).To(HaveKeyWithValue(consts.SourceGenerationAnnotation, "3"))
+
+			cr.SetGeneration(4)
+			_, err = manager.SyncState(context.Background(), cr, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "test"},
+				cm)).To(Succeed())
+			Expect(cm.Annotations).To(HaveKeyWithValue(consts.SourceGenerationAnnotation, "4"))
+		})
+	})
+
+	Context("Tracing", func() {
+		var exporter *tracetest.InMemoryExporter
+		var prevProvider trace.TracerProvider
+
+		BeforeEach(func() {
+			prevProvider = otel.GetTracerProvider()
+			exporter = tracetest.NewInMemoryExporter()
+			otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+		})
+
+		AfterEach(func() {
+			otel.SetTracerProvider(prevProvider)
+		})
+
+		It("Should create a span per state", func() {
+			stateGroups := []Group{
+				NewStateGroup([]State{&fakeState{name: "first", syncState: SyncStateReady}}),
+				NewStateGroup([]State{&fakeState{name: "second", syncState: SyncStateNotReady}}),
+			}
+			client := mocks.ControllerRutimeClient{}
+			manager := &stateManager{
+				stateGroups:    stateGroups,
+				clientProvider: NewStaticClientProvider(&client),
+			}
+			_, err := manager.SyncState(context.Background(), nil, nil)
+			Expect(err).NotTo(HaveOccurred())
+
+			var root *sdktrace.SpanSnapshot
+			stateSpans := map[string]*sdktrace.SpanSnapshot{}
+			for _, span := range exporter.GetSpans() {
+				switch span.Name {
+				case "StateManager.SyncState":
+					root = span
+				case "State.Sync":
+					for _, attr := range span.Attributes {
+						if attr.Key == attribute.Key("state") {
+							stateSpans[attr.Value.AsString()] = span
+						}
+					}
+				}
+			}
+			Expect(root).NotTo(BeNil())
+			Expect(stateSpans).To(HaveLen(2))
+			for _, name := range []string{"first", "second"} {
+				Expect(stateSpans).To(HaveKey(name))
+				Expect(stateSpans[name].Parent.SpanID()).To(Equal(root.SpanContext.SpanID()))
+			}
+		})
+	})
 })
@@ -0,0 +1,85 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+
+	"github.com/pkg/errors"
+
+	"github.com/Mellanox/network-operator/pkg/render"
+	"github.com/Mellanox/network-operator/pkg/utils"
+)
+
+// manifestVersionDirRegex matches the subdirectories of versioned manifest dirs, e.g v1, v2
+var manifestVersionDirRegex = regexp.MustCompile(`^v([0-9]+)$`)
+
+// newManifestRenderers creates the renderers of a state manifest dir. A versioned manifest dir holds each manifest
+// version in a subdirectory named after it, e.g v1 and v2, the latest version being the highest one. The renderer
+// of the latest version is returned along with the renderers of all versions keyed by version, which is empty
+// if the manifest dir is not versioned.
+func newManifestRenderers(manifestDir string) (render.Renderer, map[string]render.Renderer, error) {
+	entries, err := ioutil.ReadDir(manifestDir)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to read manifest dir")
+	}
+
+	versions := make(map[string]render.Renderer)
+	var latest render.Renderer
+	latestVersion := -1
+	for _, entry := range entries {
+		match := manifestVersionDirRegex.FindStringSubmatch(entry.Name())
+		if !entry.IsDir() || match == nil {
+			continue
+		}
+		files, err := utils.GetFilesWithSuffix(filepath.Join(manifestDir, entry.Name()), render.ManifestFileSuffix...)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "failed to get files from manifest dir")
+		}
+		renderer := render.NewRenderer(files)
+		versions[entry.Name()] = renderer
+		if version, _ := strconv.Atoi(match[1]); version > latestVersion {
+			latest = renderer
+			latestVersion = version
+		}
+	}
+	if latest != nil {
+		return latest, versions, nil
+	}
+
+	files, err := utils.GetFilesWithSuffix(manifestDir, render.ManifestFileSuffix...)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to get files from manifest dir")
+	}
+	return render.NewRenderer(files), versions, nil
+}
+
+// getRenderer returns the renderer of the given manifest version, the latest version is used if version is empty.
+// An error is returned if the manifest version does not exist.
+func (s *stateSkel) getRenderer(version string) (render.Renderer, error) {
+	if version == "" {
+		return s.renderer, nil
+	}
+	renderer, ok := s.manifestVersions[version]
+	if !ok {
+		return nil, errors.Errorf("manifest version %s does not exist for %s", version, s.name)
+	}
+	return renderer, nil
+}
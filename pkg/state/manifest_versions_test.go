@@ -0,0 +1,66 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/Mellanox/network-operator/pkg/consts"
+	"github.com/Mellanox/network-operator/pkg/render"
+)
+
+var _ = Describe("Manifest versions tests", func() {
+	var skel stateSkel
+
+	BeforeEach(func() {
+		renderer, manifestVersions, err := newManifestRenderers("testdata/manifest-versions")
+		Expect(err).NotTo(HaveOccurred())
+		skel = stateSkel{name: "state-test", renderer: renderer, manifestVersions: manifestVersions}
+	})
+
+	renderVersion := func(version string) string {
+		renderer, err := skel.getRenderer(version)
+		Expect(err).NotTo(HaveOccurred())
+		data := &struct{ RuntimeSpec *runtimeSpec }{
+			RuntimeSpec: &runtimeSpec{Namespace: consts.NetworkOperatorResourceNamespace},
+		}
+		objs, err := renderer.RenderObjects(&render.TemplatingData{Data: data})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(len(objs)).To(Equal(1))
+		return objs[0].Object["data"].(map[string]interface{})["manifestVersion"].(string)
+	}
+
+	It("Should render the latest manifest version by default", func() {
+		Expect(skel.manifestVersions).To(HaveLen(2))
+		Expect(renderVersion("")).To(Equal("v2"))
+	})
+	It("Should render the pinned manifest version", func() {
+		Expect(renderVersion("v1")).To(Equal("v1"))
+		Expect(renderVersion("v2")).To(Equal("v2"))
+	})
+	It("Should fail if the pinned manifest version does not exist", func() {
+		_, err := skel.getRenderer("v3")
+		Expect(err).To(MatchError("manifest version v3 does not exist for state-test"))
+	})
+	It("Should render manifest dirs which are not versioned", func() {
+		renderer, manifestVersions, err := newManifestRenderers("testdata/feature-gates")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(manifestVersions).To(BeEmpty())
+		Expect(renderer).NotTo(BeNil())
+	})
+})
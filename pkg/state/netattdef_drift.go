@@ -0,0 +1,61 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/Mellanox/network-operator/pkg/consts"
+)
+
+// reconcileNetAttDefConfig compares the CNI config of the live NetworkAttachmentDefinition with the rendered one. A
+// live config which is semantically equal is kept as is, so a config which only differs in formatting does not
+// trigger an update. A live config which drifted from the rendered one, e.g by a manual edit, is overwritten by the
+// update of the object and a Warning Event is recorded on it.
+func reconcileNetAttDefConfig(ctx context.Context, current, desired *unstructured.Unstructured) {
+	currentConfig, _, _ := unstructured.NestedString(current.Object, "spec", "config")
+	desiredConfig, found, _ := unstructured.NestedString(desired.Object, "spec", "config")
+	if !found || currentConfig == desiredConfig {
+		return
+	}
+	if isSameJSON(currentConfig, desiredConfig) {
+		_ = unstructured.SetNestedField(desired.Object, currentConfig, "spec", "config")
+		return
+	}
+	log.V(consts.LogLevelWarning).Info("CNI config of NetworkAttachmentDefinition drifted, overwriting it",
+		"Namespace:", current.GetNamespace(), "Name:", current.GetName())
+	recordEvent(ctx, current, corev1.EventTypeWarning, EventReasonConfigDriftOverwritten,
+		"CNI config was changed manually, the change was overwritten by the config rendered from the spec")
+}
+
+// isSameJSON checks if a and b are semantically equal JSON documents, documents which are not valid JSON are not
+// considered equal
+func isSameJSON(a, b string) bool {
+	var aValue, bValue interface{}
+	if err := json.Unmarshal([]byte(a), &aValue); err != nil {
+		return false
+	}
+	if err := json.Unmarshal([]byte(b), &bValue); err != nil {
+		return false
+	}
+	return reflect.DeepEqual(aValue, bValue)
+}
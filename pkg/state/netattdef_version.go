@@ -0,0 +1,86 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	netAttDefGroup   = "k8s.cni.cncf.io"
+	netAttDefKind    = "NetworkAttachmentDefinition"
+	netAttDefCRDName = "network-attachment-definitions.k8s.cni.cncf.io"
+)
+
+// supportedNetAttDefVersions are the NetworkAttachmentDefinition API versions the operator can apply its rendered
+// objects with, by order of preference
+var supportedNetAttDefVersions = []string{"v1"}
+
+// getNetAttDefVersion returns the preferred supported NetworkAttachmentDefinition API version served by the cluster.
+// The most preferred version is returned if the CRD does not exist, e.g when it is deployed by the NicClusterPolicy.
+func getNetAttDefVersion(ctx context.Context, c client.Client) (string, error) {
+	crd := &unstructured.Unstructured{}
+	crd.SetGroupVersionKind(schema.GroupVersionKind{
+		Group: "apiextensions.k8s.io", Version: "v1", Kind: "CustomResourceDefinition"})
+	err := c.Get(ctx, types.NamespacedName{Name: netAttDefCRDName}, crd)
+	if k8serrors.IsNotFound(err) {
+		return supportedNetAttDefVersions[0], nil
+	}
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get NetworkAttachmentDefinition CRD")
+	}
+	versions, _, err := unstructured.NestedSlice(crd.Object, "spec", "versions")
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get NetworkAttachmentDefinition CRD versions")
+	}
+
+	served := make(map[string]bool)
+	for _, v := range versions {
+		version, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _, _ := unstructured.NestedString(version, "name")
+		isServed, _, _ := unstructured.NestedBool(version, "served")
+		served[name] = isServed
+	}
+	for _, version := range supportedNetAttDefVersions {
+		if served[version] {
+			return version, nil
+		}
+	}
+	return "", errors.Errorf("none of the supported NetworkAttachmentDefinition versions %v is served by the cluster",
+		supportedNetAttDefVersions)
+}
+
+// setNetAttDefVersion sets the API version of a rendered NetworkAttachmentDefinition to a version served by the
+// cluster
+func setNetAttDefVersion(ctx context.Context, c client.Client, netAttDef *unstructured.Unstructured) error {
+	version, err := getNetAttDefVersion(ctx, c)
+	if err != nil {
+		return err
+	}
+	netAttDef.SetAPIVersion(schema.GroupVersion{Group: netAttDefGroup, Version: version}.String())
+	return nil
+}
@@ -0,0 +1,88 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("NetworkAttachmentDefinition version tests", func() {
+	var prevSupportedVersions []string
+
+	BeforeEach(func() {
+		prevSupportedVersions = supportedNetAttDefVersions
+		// simulate an operator supporting a newer API version in addition to v1
+		supportedNetAttDefVersions = []string{"v2", "v1"}
+	})
+	AfterEach(func() {
+		supportedNetAttDefVersions = prevSupportedVersions
+	})
+
+	newNetAttDefCRD := func(served map[string]bool) *unstructured.Unstructured {
+		crd := &unstructured.Unstructured{}
+		crd.SetAPIVersion("apiextensions.k8s.io/v1")
+		crd.SetKind("CustomResourceDefinition")
+		crd.SetName(netAttDefCRDName)
+		versions := []interface{}{}
+		for name, isServed := range served {
+			versions = append(versions, map[string]interface{}{"name": name, "served": isServed})
+		}
+		Expect(unstructured.SetNestedSlice(crd.Object, versions, "spec", "versions")).To(Succeed())
+		return crd
+	}
+	newClient := func(objs ...client.Object) client.Client {
+		return fake.NewClientBuilder().WithScheme(runtime.NewScheme()).WithObjects(objs...).Build()
+	}
+
+	It("Should select the preferred served version across a version change", func() {
+		k8sClient := newClient(newNetAttDefCRD(map[string]bool{"v1": true}))
+		version, err := getNetAttDefVersion(context.Background(), k8sClient)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(version).To(Equal("v1"))
+
+		// the CRD is upgraded to serve v2 and to stop serving v1
+		crd := newNetAttDefCRD(map[string]bool{"v1": false, "v2": true})
+		existing := &unstructured.Unstructured{}
+		existing.SetGroupVersionKind(crd.GroupVersionKind())
+		Expect(k8sClient.Get(context.Background(), client.ObjectKeyFromObject(crd), existing)).To(Succeed())
+		crd.SetResourceVersion(existing.GetResourceVersion())
+		Expect(k8sClient.Update(context.Background(), crd)).To(Succeed())
+
+		netAttDef := &unstructured.Unstructured{}
+		netAttDef.SetAPIVersion("k8s.cni.cncf.io/v1")
+		netAttDef.SetKind("NetworkAttachmentDefinition")
+		Expect(setNetAttDefVersion(context.Background(), k8sClient, netAttDef)).To(Succeed())
+		Expect(netAttDef.GetAPIVersion()).To(Equal("k8s.cni.cncf.io/v2"))
+	})
+	It("Should select the most preferred version when the CRD does not exist", func() {
+		version, err := getNetAttDefVersion(context.Background(), newClient())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(version).To(Equal("v2"))
+	})
+	It("Should fail when no supported version is served", func() {
+		_, err := getNetAttDefVersion(context.Background(), newClient(newNetAttDefCRD(map[string]bool{"v3": true})))
+		Expect(err).To(HaveOccurred())
+	})
+})
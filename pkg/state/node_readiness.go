@@ -0,0 +1,144 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strconv"
+
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Annotations of the nodes with the readiness of the DaemonSet Pods of a state on the node, "true" once all the Pods
+// on the node are ready and "false" otherwise. Nodes without Pods of the state are not annotated.
+const (
+	sriovDpReadyAnnotation  = "network.nvidia.com/sriov-ready"
+	sharedDpReadyAnnotation = "network.nvidia.com/rdma-shared-ready"
+	ofedReadyAnnotation     = "network.nvidia.com/ofed-ready"
+)
+
+// annotateNodeReadiness annotates the nodes running Pods of the DaemonSets in objs with annotation set to the
+// readiness of the Pods on the node, and removes annotation from the nodes which no longer run any of the Pods. Only
+// the nodes matching nodeSelector are annotated.
+func annotateNodeReadiness(ctx context.Context, c client.Client, annotation string, nodeSelector labels.Selector,
+	objs []*unstructured.Unstructured) error {
+	values, err := getNodeReadiness(ctx, c, objs)
+	if err != nil {
+		return err
+	}
+	return annotateNodes(ctx, c, annotation, nodeSelector, values)
+}
+
+// getNodeReadiness returns the readiness of the Pods of the DaemonSets in objs keyed by the name of their node, a node
+// is ready once all its Pods are ready. Terminating Pods are ignored, they are leaving the node.
+func getNodeReadiness(ctx context.Context, c client.Client,
+	objs []*unstructured.Unstructured) (map[string]string, error) {
+	ready := make(map[string]bool)
+	for _, obj := range objs {
+		if obj.GetKind() != "DaemonSet" {
+			continue
+		}
+		selector, found, err := unstructured.NestedStringMap(obj.Object, "spec", "selector", "matchLabels")
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid selector of DaemonSet %s", obj.GetName())
+		}
+		if !found || len(selector) == 0 {
+			continue
+		}
+		pods := &v1.PodList{}
+		if err := c.List(ctx, pods, client.InNamespace(obj.GetNamespace()), client.MatchingLabels(selector)); err != nil {
+			return nil, errors.Wrapf(err, "failed to list Pods of DaemonSet %s", obj.GetName())
+		}
+		for i := range pods.Items {
+			pod := &pods.Items[i]
+			if pod.Spec.NodeName == "" || pod.DeletionTimestamp != nil {
+				continue
+			}
+			nodeReady, ok := ready[pod.Spec.NodeName]
+			ready[pod.Spec.NodeName] = isPodReady(pod) && (nodeReady || !ok)
+		}
+	}
+	values := make(map[string]string, len(ready))
+	for node, nodeReady := range ready {
+		values[node] = strconv.FormatBool(nodeReady)
+	}
+	return values, nil
+}
+
+// annotateNodes sets annotation of the nodes matching nodeSelector to their value in values, keyed by node name, and
+// removes annotation from the other nodes matching nodeSelector
+func annotateNodes(ctx context.Context, c client.Client, annotation string, nodeSelector labels.Selector,
+	values map[string]string) error {
+	// annotations can not be selected, all the nodes matching nodeSelector are listed
+	nodes := &v1.NodeList{}
+	if err := c.List(ctx, nodes, client.MatchingLabelsSelector{Selector: nodeSelector}); err != nil {
+		return errors.Wrapf(err, "failed to list nodes to update annotation %s", annotation)
+	}
+	annotated := make(map[string]string, len(nodes.Items))
+	for i := range nodes.Items {
+		node := &nodes.Items[i]
+		current, ok := node.Annotations[annotation]
+		if _, desired := values[node.Name]; !desired {
+			if ok {
+				if err := patchNodeAnnotation(ctx, c, node.Name, annotation, nil); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if ok {
+			annotated[node.Name] = current
+		}
+	}
+	names := make([]string, 0, len(values))
+	for node := range values {
+		names = append(names, node)
+	}
+	sort.Strings(names)
+	for _, node := range names {
+		value := values[node]
+		if current, ok := annotated[node]; ok && current == value {
+			continue
+		}
+		if err := patchNodeAnnotation(ctx, c, node, annotation, &value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// patchNodeAnnotation sets annotation of the node to value, the annotation is removed if value is nil
+func patchNodeAnnotation(ctx context.Context, c client.Client, nodeName, annotation string, value *string) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{"annotations": map[string]*string{annotation: value}}})
+	if err != nil {
+		return errors.Wrap(err, "failed to encode node annotation patch")
+	}
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: nodeName}}
+	if err := c.Patch(ctx, node, client.RawPatch(types.MergePatchType, patch)); err != nil {
+		return errors.Wrapf(err, "failed to update annotation %s of node %s", annotation, nodeName)
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Node readiness annotation tests", func() {
+	var k8sClient client.Client
+	ds := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "DaemonSet",
+		"metadata":   map[string]interface{}{"name": "ds", "namespace": "default"},
+		"spec": map[string]interface{}{
+			"selector": map[string]interface{}{"matchLabels": map[string]interface{}{"app": "ds"}},
+		},
+	}}
+
+	newNode := func(name string, annotations map[string]string) *corev1.Node {
+		node := &corev1.Node{}
+		node.Name = name
+		node.Annotations = annotations
+		return node
+	}
+	newPod := func(name, nodeName string, ready corev1.ConditionStatus) *corev1.Pod {
+		pod := &corev1.Pod{}
+		pod.Name = name
+		pod.Namespace = "default"
+		pod.Labels = map[string]string{"app": "ds"}
+		pod.Spec.NodeName = nodeName
+		pod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: ready}}
+		return pod
+	}
+	annotate := func() {
+		Expect(annotateNodeReadiness(context.Background(), k8sClient, sriovDpReadyAnnotation, labels.Everything(),
+			[]*unstructured.Unstructured{ds})).To(Succeed())
+	}
+	expectAnnotations := func(expected map[string]string) {
+		for _, name := range []string{"node1", "node2", "node3"} {
+			node := &corev1.Node{}
+			Expect(k8sClient.Get(context.Background(), types.NamespacedName{Name: name}, node)).To(Succeed())
+			if value, ok := expected[name]; ok {
+				Expect(node.Annotations).To(HaveKeyWithValue(sriovDpReadyAnnotation, value))
+			} else {
+				Expect(node.Annotations).NotTo(HaveKey(sriovDpReadyAnnotation))
+			}
+		}
+	}
+
+	BeforeEach(func() {
+		k8sClient = fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithObjects(
+			newNode("node1", nil),
+			newNode("node2", nil),
+			newNode("node3", map[string]string{sriovDpReadyAnnotation: "true", "other": "value"}),
+			newPod("pod1", "node1", corev1.ConditionTrue),
+			newPod("pod2", "node2", corev1.ConditionFalse),
+		).Build()
+	})
+
+	It("Should annotate the nodes with the readiness of their Pods and clear nodes without Pods", func() {
+		annotate()
+		expectAnnotations(map[string]string{"node1": "true", "node2": "false"})
+
+		node := &corev1.Node{}
+		Expect(k8sClient.Get(context.Background(), types.NamespacedName{Name: "node3"}, node)).To(Succeed())
+		Expect(node.Annotations).To(HaveKeyWithValue("other", "value"))
+	})
+	It("Should update the annotation once the Pod readiness changes", func() {
+		annotate()
+		Expect(k8sClient.Update(context.Background(), newPod("pod2", "node2", corev1.ConditionTrue))).To(Succeed())
+		Expect(k8sClient.Update(context.Background(), newPod("pod1", "node1", corev1.ConditionFalse))).To(Succeed())
+		annotate()
+		expectAnnotations(map[string]string{"node1": "false", "node2": "true"})
+	})
+	It("Should not report a node ready unless all its Pods are ready", func() {
+		Expect(k8sClient.Create(context.Background(), newPod("pod3", "node1", corev1.ConditionFalse))).To(Succeed())
+		annotate()
+		expectAnnotations(map[string]string{"node1": "false", "node2": "false"})
+	})
+	It("Should remove the annotation once the Pod leaves the node", func() {
+		annotate()
+		Expect(k8sClient.Delete(context.Background(), newPod("pod2", "node2", ""))).To(Succeed())
+		annotate()
+		expectAnnotations(map[string]string{"node1": "true"})
+	})
+})
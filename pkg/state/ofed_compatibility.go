@@ -0,0 +1,163 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/version"
+	"sigs.k8s.io/yaml"
+
+	mellanoxv1alpha1 "github.com/Mellanox/network-operator/api/v1alpha1"
+	"github.com/Mellanox/network-operator/pkg/config"
+	"github.com/Mellanox/network-operator/pkg/consts"
+)
+
+// Device plugins of the OFED driver compatibility matrix, named after their NicClusterPolicy spec fields
+const (
+	compatibilitySriovDevicePlugin  = "sriovDevicePlugin"
+	compatibilitySharedDevicePlugin = "rdmaSharedDevicePlugin"
+)
+
+// ofedCompatibilityMatrixFileName is the file of the OFED driver compatibility matrix in the manifest base dir
+const ofedCompatibilityMatrixFileName = "ofed-compatibility-matrix.yaml"
+
+// ofedDevicePluginIncompatibility is an entry of the OFED driver compatibility matrix, OFED driver versions within
+// [OFEDMin, OFEDMax) are known to be incompatible with versions of DevicePlugin within [DevicePluginMin,
+// DevicePluginMax). An empty bound leaves the range unbounded on that side.
+type ofedDevicePluginIncompatibility struct {
+	DevicePlugin    string `json:"devicePlugin"`
+	OFEDMin         string `json:"ofedMin,omitempty"`
+	OFEDMax         string `json:"ofedMax,omitempty"`
+	DevicePluginMin string `json:"devicePluginMin,omitempty"`
+	DevicePluginMax string `json:"devicePluginMax,omitempty"`
+	// Recommendation reported along with the incompatibility
+	Recommendation string `json:"recommendation"`
+	// Source is the release notes documenting the incompatibility
+	Source string `json:"source"`
+}
+
+// ofedCompatibilityMatrix is the content of the OFED driver compatibility matrix file
+type ofedCompatibilityMatrix struct {
+	Incompatibilities []ofedDevicePluginIncompatibility `json:"incompatibilities"`
+}
+
+// getOFEDCompatibilityMatrix loads the OFED driver compatibility matrix of the device plugins from the file of
+// OFED_COMPATIBILITY_MATRIX_FILE, or from the file shipped in the manifest base dir if not set
+func getOFEDCompatibilityMatrix() ([]ofedDevicePluginIncompatibility, error) {
+	stateConfig := config.FromEnv().State
+	file := stateConfig.OFEDCompatibilityMatrixFile
+	if file == "" {
+		file = filepath.Join(stateConfig.ManifestBaseDir, ofedCompatibilityMatrixFileName)
+	}
+	return loadOFEDCompatibilityMatrix(file)
+}
+
+// loadOFEDCompatibilityMatrix loads the OFED driver compatibility matrix from file, the matrix is empty if file does
+// not exist. Entries must have a recommendation, a source and valid version bounds.
+func loadOFEDCompatibilityMatrix(file string) ([]ofedDevicePluginIncompatibility, error) {
+	content, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		log.V(consts.LogLevelInfo).Info("OFED driver compatibility matrix not found, versions are not checked",
+			"file", file)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read OFED driver compatibility matrix")
+	}
+	matrix := &ofedCompatibilityMatrix{}
+	if err := yaml.UnmarshalStrict(content, matrix); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse OFED driver compatibility matrix %s", file)
+	}
+	for i := range matrix.Incompatibilities {
+		entry := &matrix.Incompatibilities[i]
+		if entry.DevicePlugin != compatibilitySriovDevicePlugin && entry.DevicePlugin != compatibilitySharedDevicePlugin {
+			return nil, errors.Errorf("invalid device plugin %q of OFED driver compatibility matrix entry %d",
+				entry.DevicePlugin, i)
+		}
+		if entry.Recommendation == "" || entry.Source == "" {
+			return nil, errors.Errorf("OFED driver compatibility matrix entry %d must have a recommendation and a "+
+				"source", i)
+		}
+		for _, bound := range []string{entry.OFEDMin, entry.OFEDMax, entry.DevicePluginMin, entry.DevicePluginMax} {
+			if _, err := version.ParseGeneric(bound); bound != "" && err != nil {
+				return nil, errors.Wrapf(err, "invalid version bound of OFED driver compatibility matrix entry %d", i)
+			}
+		}
+	}
+	return matrix.Incompatibilities, nil
+}
+
+// checkOFEDCompatibility returns a warning for each entry of the compatibility matrix matching the OFED driver
+// version of the NicClusterPolicy and the version of the device plugin. An error is returned instead if strict.
+// Versions which can not be parsed, e.g image digests, and drivers not deployed by the operator are not checked.
+func checkOFEDCompatibility(cr *mellanoxv1alpha1.NicClusterPolicy, matrix []ofedDevicePluginIncompatibility,
+	devicePlugin, devicePluginVersion string, strict bool) ([]string, error) {
+	if cr.Spec.OFEDDriver == nil || len(matrix) == 0 {
+		return nil, nil
+	}
+	ofedVersion, err := parseOFEDVersion(cr.Spec.OFEDDriver.Version)
+	if err != nil {
+		log.V(consts.LogLevelDebug).Info("Skipping OFED driver compatibility check, unable to parse OFED version",
+			"version", cr.Spec.OFEDDriver.Version)
+		return nil, nil
+	}
+	dpVersion, err := version.ParseGeneric(devicePluginVersion)
+	if err != nil {
+		log.V(consts.LogLevelDebug).Info("Skipping OFED driver compatibility check, unable to parse device plugin "+
+			"version", "version", devicePluginVersion)
+		return nil, nil
+	}
+
+	var warnings []string
+	for i := range matrix {
+		entry := &matrix[i]
+		if entry.DevicePlugin != devicePlugin ||
+			!versionInRange(ofedVersion, entry.OFEDMin, entry.OFEDMax) ||
+			!versionInRange(dpVersion, entry.DevicePluginMin, entry.DevicePluginMax) {
+			continue
+		}
+		warnings = append(warnings, fmt.Sprintf("OFED driver %s is incompatible with %s %s: %s",
+			cr.Spec.OFEDDriver.Version, devicePlugin, devicePluginVersion, entry.Recommendation))
+	}
+	if strict && len(warnings) != 0 {
+		return nil, errors.New(strings.Join(warnings, "; "))
+	}
+	return warnings, nil
+}
+
+// parseOFEDVersion parses OFED driver versions such as 5.4-1.0.3.0, the release is compared as additional
+// version components
+func parseOFEDVersion(ofedVersion string) (*version.Version, error) {
+	return version.ParseGeneric(strings.Replace(ofedVersion, "-", ".", 1))
+}
+
+// versionInRange returns true if ver is within [min, max), an empty bound leaves the range unbounded on that side
+func versionInRange(ver *version.Version, min, max string) bool {
+	if min != "" && ver.LessThan(version.MustParseGeneric(min)) {
+		return false
+	}
+	if max != "" && !ver.LessThan(version.MustParseGeneric(max)) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,89 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("OFED driver compatibility matrix tests", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "ofed-compatibility")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	writeMatrix := func(content string) string {
+		file := filepath.Join(dir, ofedCompatibilityMatrixFileName)
+		Expect(ioutil.WriteFile(file, []byte(content), 0600)).To(Succeed())
+		return file
+	}
+
+	It("Should load the matrix shipped with the manifests", func() {
+		matrix, err := loadOFEDCompatibilityMatrix(filepath.Join("../../manifests", ofedCompatibilityMatrixFileName))
+		Expect(err).NotTo(HaveOccurred())
+		for _, entry := range matrix {
+			Expect(entry.Source).NotTo(BeEmpty())
+		}
+	})
+	It("Should load the entries of a matrix file", func() {
+		matrix, err := loadOFEDCompatibilityMatrix(writeMatrix(`
+incompatibilities:
+- devicePlugin: sriovDevicePlugin
+  ofedMax: "5.4"
+  devicePluginMin: "3.5.0"
+  recommendation: upgrade the OFED driver
+  source: https://example.com/release-notes
+`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(matrix).To(Equal([]ofedDevicePluginIncompatibility{{
+			DevicePlugin:    compatibilitySriovDevicePlugin,
+			OFEDMax:         "5.4",
+			DevicePluginMin: "3.5.0",
+			Recommendation:  "upgrade the OFED driver",
+			Source:          "https://example.com/release-notes",
+		}}))
+	})
+	It("Should leave the matrix empty if the file does not exist", func() {
+		matrix, err := loadOFEDCompatibilityMatrix(filepath.Join(dir, "missing.yaml"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(matrix).To(BeEmpty())
+	})
+	It("Should reject invalid entries", func() {
+		for _, entry := range []string{
+			"devicePlugin: ofedDriver\n  recommendation: r\n  source: s",
+			"devicePlugin: sriovDevicePlugin\n  recommendation: r",
+			"devicePlugin: sriovDevicePlugin\n  source: s",
+			"devicePlugin: sriovDevicePlugin\n  ofedMin: latest\n  recommendation: r\n  source: s",
+			"devicePlugin: sriovDevicePlugin\n  unknown: field\n  recommendation: r\n  source: s",
+		} {
+			_, err := loadOFEDCompatibilityMatrix(writeMatrix("incompatibilities:\n- " + entry + "\n"))
+			Expect(err).To(HaveOccurred(), "entry: %s", entry)
+		}
+	})
+})
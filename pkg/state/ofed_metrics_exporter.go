@@ -0,0 +1,96 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	mellanoxv1alpha1 "github.com/Mellanox/network-operator/api/v1alpha1"
+	"github.com/Mellanox/network-operator/pkg/consts"
+)
+
+const (
+	// ofedMetricsExporterDefaultPort is the port the metrics exporter sidecar listens on if not set
+	ofedMetricsExporterDefaultPort = 9800
+	// serviceMonitorKind is the kind of the Prometheus Operator ServiceMonitor scraping the metrics exporter
+	serviceMonitorKind = "ServiceMonitor"
+	// serviceMonitorCRDName is the name of the Prometheus Operator ServiceMonitor CRD
+	serviceMonitorCRDName = "servicemonitors.monitoring.coreos.com"
+)
+
+// getOFEDMetricsExporter returns the metrics exporter sidecar of the OFED driver Pods with its defaults set, nil is
+// returned if it is not enabled
+func getOFEDMetricsExporter(spec *mellanoxv1alpha1.OFEDDriverSpec) *mellanoxv1alpha1.OFEDMetricsExporterSpec {
+	if spec.MetricsExporter == nil || !spec.MetricsExporter.Enabled {
+		return nil
+	}
+	exporter := spec.MetricsExporter.DeepCopy()
+	if exporter.Port == 0 {
+		exporter.Port = ofedMetricsExporterDefaultPort
+	}
+	return exporter
+}
+
+// skipServiceMonitor removes the ServiceMonitor from objs if the Prometheus Operator ServiceMonitor API is not present
+// in the cluster, the metrics exporter is still deployed and can be scraped by other means
+func skipServiceMonitor(
+	ctx context.Context, c client.Client, objs []*unstructured.Unstructured) ([]*unstructured.Unstructured, error) {
+	filtered := make([]*unstructured.Unstructured, 0, len(objs))
+	var exists *bool
+	for _, obj := range objs {
+		if obj.GetKind() != serviceMonitorKind {
+			filtered = append(filtered, obj)
+			continue
+		}
+		if exists == nil {
+			present, err := isServiceMonitorAPIPresent(ctx, c)
+			if err != nil {
+				return nil, err
+			}
+			exists = &present
+		}
+		if !*exists {
+			log.V(consts.LogLevelWarning).Info("ServiceMonitor API is not present in the cluster, skipping",
+				"CRD:", serviceMonitorCRDName, "Name:", obj.GetName())
+			continue
+		}
+		filtered = append(filtered, obj)
+	}
+	return filtered, nil
+}
+
+// isServiceMonitorAPIPresent checks if the Prometheus Operator ServiceMonitor CRD exists in the cluster
+func isServiceMonitorAPIPresent(ctx context.Context, c client.Client) (bool, error) {
+	crd := &unstructured.Unstructured{}
+	crd.SetGroupVersionKind(schema.GroupVersionKind{
+		Group: "apiextensions.k8s.io", Version: "v1", Kind: "CustomResourceDefinition"})
+	err := c.Get(ctx, types.NamespacedName{Name: serviceMonitorCRDName}, crd)
+	if k8serrors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Wrap(err, "failed to get ServiceMonitor CRD")
+	}
+	return true, nil
+}
@@ -0,0 +1,135 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	mellanoxv1alpha1 "github.com/Mellanox/network-operator/api/v1alpha1"
+	"github.com/Mellanox/network-operator/pkg/nodeinfo"
+)
+
+// ofedModprobeDefaultConfig is the modprobe configuration used on nodes which do not match any override,
+// nodes matching an override use the <node name>.conf configuration.
+const ofedModprobeDefaultConfig = "default.conf"
+
+var (
+	moduleNameRegex       = regexp.MustCompile(`^[a-zA-Z0-9_]+$`)
+	moduleParamValueRegex = regexp.MustCompile(`^[a-zA-Z0-9_.,:/+-]+$`)
+)
+
+// getOFEDModprobeConfig returns the modprobe configuration files keyed by file name, nil is returned if no
+// kernel module parameters are set.
+func getOFEDModprobeConfig(
+	spec *mellanoxv1alpha1.OFEDDriverSpec, nodeInfo nodeinfo.Provider) (map[string]string, error) {
+	if len(spec.ModuleParams) == 0 && len(spec.ModuleParamsOverrides) == 0 {
+		return nil, nil
+	}
+	if err := validateModuleParams(spec.ModuleParams); err != nil {
+		return nil, err
+	}
+
+	config := map[string]string{ofedModprobeDefaultConfig: renderModprobeConfig(spec.ModuleParams)}
+	nodeParams := make(map[string][]mellanoxv1alpha1.KernelModuleParamsSpec)
+	for i := range spec.ModuleParamsOverrides {
+		override := &spec.ModuleParamsOverrides[i]
+		if err := validateModuleParams(override.ModuleParams); err != nil {
+			return nil, errors.Wrapf(err, "invalid kernel module parameters override %d", i)
+		}
+		filterBuilder := nodeinfo.NewNodeLabelFilterBuilder().WithLabel(nodeinfo.NodeLabelMlnxNIC, "true")
+		for k, v := range override.NodeSelector {
+			filterBuilder.WithLabel(k, v)
+		}
+		for _, attrs := range nodeInfo.GetNodesAttributes(filterBuilder.Build()) {
+			base, ok := nodeParams[attrs.Name]
+			if !ok {
+				base = spec.ModuleParams
+			}
+			nodeParams[attrs.Name] = mergeModuleParams(base, override.ModuleParams)
+		}
+	}
+	for node, params := range nodeParams {
+		config[node+".conf"] = renderModprobeConfig(params)
+	}
+	return config, nil
+}
+
+// validateModuleParams checks kernel module names and parameters are valid modprobe options
+func validateModuleParams(params []mellanoxv1alpha1.KernelModuleParamsSpec) error {
+	for _, p := range params {
+		if !moduleNameRegex.MatchString(p.Module) {
+			return errors.Errorf("invalid kernel module name %q", p.Module)
+		}
+		for name, val := range p.Params {
+			if !moduleNameRegex.MatchString(name) {
+				return errors.Errorf("invalid parameter name %q for kernel module %s", name, p.Module)
+			}
+			if !moduleParamValueRegex.MatchString(val) {
+				return errors.Errorf("invalid value %q for parameter %s of kernel module %s", val, name, p.Module)
+			}
+		}
+	}
+	return nil
+}
+
+// mergeModuleParams returns base kernel module parameters with the parameters of overrides merged over them
+func mergeModuleParams(
+	base, overrides []mellanoxv1alpha1.KernelModuleParamsSpec) []mellanoxv1alpha1.KernelModuleParamsSpec {
+	merged := make([]mellanoxv1alpha1.KernelModuleParamsSpec, 0, len(base)+len(overrides))
+	index := make(map[string]int)
+	for _, params := range [][]mellanoxv1alpha1.KernelModuleParamsSpec{base, overrides} {
+		for _, p := range params {
+			i, ok := index[p.Module]
+			if !ok {
+				i = len(merged)
+				index[p.Module] = i
+				merged = append(merged, mellanoxv1alpha1.KernelModuleParamsSpec{
+					Module: p.Module, Params: make(map[string]string)})
+			}
+			for k, v := range p.Params {
+				merged[i].Params[k] = v
+			}
+		}
+	}
+	return merged
+}
+
+// renderModprobeConfig renders an options line per kernel module, parameters are sorted by name
+func renderModprobeConfig(params []mellanoxv1alpha1.KernelModuleParamsSpec) string {
+	sb := strings.Builder{}
+	for _, p := range params {
+		if len(p.Params) == 0 {
+			continue
+		}
+		names := make([]string, 0, len(p.Params))
+		for name := range p.Params {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		sb.WriteString("options " + p.Module)
+		for _, name := range names {
+			sb.WriteString(" " + name + "=" + p.Params[name])
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
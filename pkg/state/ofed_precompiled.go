@@ -0,0 +1,154 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	mellanoxv1alpha1 "github.com/Mellanox/network-operator/api/v1alpha1"
+	"github.com/Mellanox/network-operator/pkg/nodeinfo"
+)
+
+// Modes the OFED driver is deployed in on a node
+const (
+	ofedNodeModePrecompiled = "precompiled"
+	ofedNodeModeSource      = "source"
+)
+
+// ofedDriver is an OFED driver DaemonSet rendered by the OFED state
+type ofedDriver struct {
+	// Name of the driver, used for the DaemonSet name and app label
+	Name string
+	// Tag of the driver image
+	ImageTag string
+	// Kernel version of the nodes the precompiled driver is deployed on, empty for the driver built from source
+	KernelVersion string
+	// OS distribution of the nodes the driver is deployed on
+	OSName       string
+	OSVer        string
+	NodeAffinity *v1.NodeAffinity
+}
+
+// ofedDrivers are the OFED drivers to render for the eligible nodes
+type ofedDrivers struct {
+	drivers []ofedDriver
+	// mode of each node the driver is deployed on keyed by node name
+	nodeModes map[string]string
+	// nodes the driver is not deployed on as no precompiled image is available for their kernel
+	skippedNodes []string
+	warnings     []string
+}
+
+// getOFEDDrivers returns the OFED drivers to render for the eligible nodes attrs. A single driver built from source
+// is rendered unless precompiled kernels are set, in which case a precompiled driver is rendered for each of the
+// precompiled kernels running on the nodes and the driver built from source is only rendered on the remaining nodes
+// if falling back to source is enabled.
+func getOFEDDrivers(spec *mellanoxv1alpha1.OFEDDriverSpec, affinity *v1.NodeAffinity,
+	osName, osVer, cpuArch string, attrs []nodeinfo.NodeAttributes) ofedDrivers {
+	sourceName := fmt.Sprintf("mofed-%s%s", osName, osVer)
+	source := ofedDriver{
+		Name:         sourceName,
+		ImageTag:     fmt.Sprintf("%s%s-%s", osName, osVer, cpuArch),
+		OSName:       osName,
+		OSVer:        osVer,
+		NodeAffinity: affinity,
+	}
+	result := ofedDrivers{nodeModes: make(map[string]string, len(attrs))}
+	if len(spec.PrecompiledKernels) == 0 {
+		for _, attr := range attrs {
+			result.nodeModes[attr.Name] = ofedNodeModeSource
+		}
+		result.drivers = []ofedDriver{source}
+		return result
+	}
+
+	precompiled := make(map[string]bool, len(spec.PrecompiledKernels))
+	kernels := make([]string, 0, len(spec.PrecompiledKernels))
+	for _, kernel := range spec.PrecompiledKernels {
+		if !precompiled[string(kernel)] {
+			precompiled[string(kernel)] = true
+			kernels = append(kernels, string(kernel))
+		}
+	}
+	nodeKernels := make(map[string]bool)
+	missing := make(map[string][]string)
+	for _, attr := range attrs {
+		kernel := attr.Attributes[nodeinfo.AttrTypeKernelVerFull]
+		switch {
+		case precompiled[kernel]:
+			nodeKernels[kernel] = true
+			result.nodeModes[attr.Name] = ofedNodeModePrecompiled
+		case spec.PrecompiledFallbackToSource:
+			result.nodeModes[attr.Name] = ofedNodeModeSource
+		default:
+			missing[kernel] = append(missing[kernel], attr.Name)
+			result.skippedNodes = append(result.skippedNodes, attr.Name)
+		}
+	}
+
+	for _, kernel := range kernels {
+		if !nodeKernels[kernel] {
+			continue
+		}
+		result.drivers = append(result.drivers, ofedDriver{
+			Name:          getOFEDPrecompiledDriverName(sourceName, kernel),
+			ImageTag:      fmt.Sprintf("%s-%s%s-%s", kernel, osName, osVer, cpuArch),
+			KernelVersion: kernel,
+			OSName:        osName,
+			OSVer:         osVer,
+			NodeAffinity:  affinity,
+		})
+	}
+	if spec.PrecompiledFallbackToSource {
+		// nodes running a precompiled kernel are handled by the precompiled drivers
+		source.NodeAffinity = excludeLabelValuesAffinity(affinity, nodeinfo.NodeLabelKernelVerFull, kernels)
+		result.drivers = append(result.drivers, source)
+	}
+
+	missingKernels := make([]string, 0, len(missing))
+	for kernel := range missing {
+		missingKernels = append(missingKernels, kernel)
+	}
+	sort.Strings(missingKernels)
+	for _, kernel := range missingKernels {
+		result.warnings = append(result.warnings, fmt.Sprintf(
+			"no precompiled OFED driver image for kernel %q, the driver is not deployed on nodes %s, "+
+				"set precompiledFallbackToSource to build the driver from source",
+			kernel, strings.Join(missing[kernel], ", ")))
+	}
+	sort.Strings(result.skippedNodes)
+	return result
+}
+
+// getOFEDPrecompiledDriverName returns the name of the precompiled driver of kernel. The name is used as a label
+// value, it is shortened with a hash of the kernel version if it exceeds the label value length limit.
+func getOFEDPrecompiledDriverName(sourceName, kernel string) string {
+	name := sourceName + "-" + strings.ReplaceAll(strings.ToLower(kernel), "_", "-")
+	if len(name) <= validation.LabelValueMaxLength {
+		return name
+	}
+	sum := sha256.Sum256([]byte(kernel))
+	suffix := "-" + hex.EncodeToString(sum[:])[:8]
+	return strings.TrimRight(name[:validation.LabelValueMaxLength-len(suffix)], "-.") + suffix
+}
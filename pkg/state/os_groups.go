@@ -0,0 +1,84 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"sort"
+
+	mellanoxv1alpha1 "github.com/Mellanox/network-operator/api/v1alpha1"
+	"github.com/Mellanox/network-operator/pkg/nodeinfo"
+)
+
+// OSGroup is a group of the eligible nodes of a State running the same OS distribution
+type OSGroup struct {
+	OSName string
+	OSVer  string
+	// Nodes of the group sorted by name
+	Nodes []string
+}
+
+// nodeOSGroup is a group of eligible nodes running the same OS distribution along with their attributes, the
+// attributes of the group are the attributes of its first node
+type nodeOSGroup struct {
+	OSGroup
+	CPUArch string
+	attrs   []nodeinfo.NodeAttributes
+}
+
+// groupNodesByOS groups the eligible nodes attrs by OS distribution, the groups are sorted by OS name and version.
+// Missing node attributes are set from defaults. All the nodes are grouped with the OS distribution of the first node
+// if perOS is false.
+func (s *stateSkel) groupNodesByOS(attrs []nodeinfo.NodeAttributes, defaults *mellanoxv1alpha1.RenderDefaultsSpec,
+	perOS bool) ([]nodeOSGroup, error) {
+	var groups []nodeOSGroup
+	// index of the group of each OS name and version
+	index := make(map[[2]string]int)
+	for i := range attrs {
+		if !perOS && len(groups) != 0 {
+			groups[0].Nodes = append(groups[0].Nodes, attrs[i].Name)
+			groups[0].attrs = append(groups[0].attrs, attrs[i])
+			continue
+		}
+		nodeAttrs, err := s.getAttributesWithDefaults(attrs[i], defaults,
+			nodeinfo.AttrTypeCPUArch, nodeinfo.AttrTypeOSName, nodeinfo.AttrTypeOSVer)
+		if err != nil {
+			return nil, err
+		}
+		osName, osVer := nodeAttrs.Attributes[nodeinfo.AttrTypeOSName], nodeAttrs.Attributes[nodeinfo.AttrTypeOSVer]
+		j, ok := index[[2]string{osName, osVer}]
+		if !ok {
+			j = len(groups)
+			index[[2]string{osName, osVer}] = j
+			groups = append(groups, nodeOSGroup{
+				OSGroup: OSGroup{OSName: osName, OSVer: osVer},
+				CPUArch: nodeAttrs.Attributes[nodeinfo.AttrTypeCPUArch],
+			})
+		}
+		groups[j].Nodes = append(groups[j].Nodes, attrs[i].Name)
+		groups[j].attrs = append(groups[j].attrs, attrs[i])
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].OSName != groups[j].OSName {
+			return groups[i].OSName < groups[j].OSName
+		}
+		return groups[i].OSVer < groups[j].OSVer
+	})
+	for i := range groups {
+		sort.Strings(groups[i].Nodes)
+	}
+	return groups, nil
+}
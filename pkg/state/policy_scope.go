@@ -0,0 +1,247 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	mellanoxv1alpha1 "github.com/Mellanox/network-operator/api/v1alpha1"
+	"github.com/Mellanox/network-operator/pkg/consts"
+	"github.com/Mellanox/network-operator/pkg/nodeinfo"
+)
+
+// PolicyScope confines the device plugins of a NicClusterPolicy to the nodes labeled with NodeLabel set to
+// NodeLabelValue and to Namespace, so the device plugins of NicClusterPolicies of different tenants do not conflict
+type PolicyScope struct {
+	// Namespace of the objects of the device plugins
+	Namespace string
+	// NodeLabel and NodeLabelValue select the nodes of the scope
+	NodeLabel      string
+	NodeLabelValue string
+}
+
+// ParsePolicyScopes parses NicClusterPolicy scopes keyed by policy name from entries formatted as
+// <policy name>=<namespace>:<node label>=<value>, e.g tenant-a=tenant-a:example.com/tenant=a. The scopes must not
+// share a namespace, nor the operator namespace, or a node label value. Empty entries are ignored.
+func ParsePolicyScopes(entries []string) (map[string]PolicyScope, error) {
+	scopes := make(map[string]PolicyScope)
+	namespaces := map[string]bool{consts.NetworkOperatorResourceNamespace: true}
+	nodeLabels := make(map[string]bool)
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, scope, ok := parsePolicyScope(entry)
+		if !ok {
+			return nil, errors.Errorf("invalid policy scope %q, expected <policy name>=<namespace>:<label>=<value>",
+				entry)
+		}
+		if name == consts.NicClusterPolicyResourceName {
+			return nil, errors.Errorf("invalid policy scope %q, NicClusterPolicy %s can not be scoped", entry, name)
+		}
+		if _, ok := scopes[name]; ok {
+			return nil, errors.Errorf("duplicate scope of NicClusterPolicy %s", name)
+		}
+		if errs := validation.IsDNS1123Label(scope.Namespace); len(errs) != 0 {
+			return nil, errors.Errorf("invalid namespace of policy scope %q: %s", entry, strings.Join(errs, ", "))
+		}
+		if errs := validation.IsQualifiedName(scope.NodeLabel); len(errs) != 0 {
+			return nil, errors.Errorf("invalid node label of policy scope %q: %s", entry, strings.Join(errs, ", "))
+		}
+		if errs := validation.IsValidLabelValue(scope.NodeLabelValue); len(errs) != 0 {
+			return nil, errors.Errorf("invalid node label value of policy scope %q: %s", entry,
+				strings.Join(errs, ", "))
+		}
+		if namespaces[scope.Namespace] {
+			return nil, errors.Errorf("namespace %s of policy scope %q is not exclusive", scope.Namespace, entry)
+		}
+		if nodeLabels[scope.NodeLabel+"="+scope.NodeLabelValue] {
+			return nil, errors.Errorf("node label %s=%s of policy scope %q is not exclusive", scope.NodeLabel,
+				scope.NodeLabelValue, entry)
+		}
+		namespaces[scope.Namespace] = true
+		nodeLabels[scope.NodeLabel+"="+scope.NodeLabelValue] = true
+		scopes[name] = scope
+	}
+	return scopes, nil
+}
+
+// parsePolicyScope parses the policy name and scope of entry, ok is false if entry is malformed
+func parsePolicyScope(entry string) (name string, scope PolicyScope, ok bool) {
+	parts := strings.SplitN(entry, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return "", PolicyScope{}, false
+	}
+	name = parts[0]
+	parts = strings.SplitN(parts[1], ":", 2)
+	if len(parts) != 2 {
+		return "", PolicyScope{}, false
+	}
+	scope.Namespace = parts[0]
+	parts = strings.SplitN(parts[1], "=", 2)
+	if len(parts) != 2 {
+		return "", PolicyScope{}, false
+	}
+	scope.NodeLabel, scope.NodeLabelValue = parts[0], parts[1]
+	return name, scope, true
+}
+
+// ValidateScopedPolicy checks that the scoped NicClusterPolicy cr only deploys device plugins, the other components
+// are shared by the nodes of all the scopes and are deployed by the unscoped NicClusterPolicy
+func ValidateScopedPolicy(cr *mellanoxv1alpha1.NicClusterPolicy) error {
+	var unscoped []string
+	for field, set := range map[string]bool{
+		"ofedDriver":        cr.Spec.OFEDDriver != nil,
+		"nvPeerDriver":      cr.Spec.NVPeerDriver != nil,
+		"secondaryNetwork":  cr.Spec.SecondaryNetwork != nil,
+		"psp":               cr.Spec.PSP != nil,
+		"psa":               cr.Spec.PSA != nil,
+		"nodeFeatureRule":   cr.Spec.NodeFeatureRule != nil,
+		"resourceQuota":     cr.Spec.ResourceQuota != nil,
+		"priorityClass":     cr.Spec.PriorityClass != nil,
+		"validatingWebhook": cr.Spec.ValidatingWebhook != nil,
+	} {
+		if set {
+			unscoped = append(unscoped, field)
+		}
+	}
+	if len(unscoped) == 0 {
+		return nil
+	}
+	sort.Strings(unscoped)
+	return errors.Errorf("scoped NicClusterPolicy %s only deploys device plugins, unsupported fields: %s", cr.Name,
+		strings.Join(unscoped, ", "))
+}
+
+type policyScopeKey struct{}
+
+// policyScopeContext is the context value of the scopes of the NicClusterPolicies
+type policyScopeContext struct {
+	// policyName is the name of the reconciled NicClusterPolicy
+	policyName string
+	scopes     map[string]PolicyScope
+}
+
+// WithPolicyScopes returns a context confining the device plugins of the reconciled NicClusterPolicy named
+// policyName to its scope in scopes, keyed by policy name. The device plugins of a NicClusterPolicy without scope are
+// deployed on the nodes which are not part of any scope. ctx is returned as is if scopes is empty.
+func WithPolicyScopes(ctx context.Context, policyName string, scopes map[string]PolicyScope) context.Context {
+	if len(scopes) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, policyScopeKey{}, policyScopeContext{policyName: policyName, scopes: scopes})
+}
+
+// devicePluginScope is the scope of the device plugins of the reconciled NicClusterPolicy, the zero value is the
+// scope of a NicClusterPolicy when no scopes are configured
+type devicePluginScope struct {
+	namespace string
+	// requirements select the nodes of the scope
+	requirements []v1.NodeSelectorRequirement
+}
+
+// getDevicePluginScope returns the scope of the device plugins of the NicClusterPolicy reconciled with ctx
+func getDevicePluginScope(ctx context.Context) devicePluginScope {
+	scopeCtx, ok := ctx.Value(policyScopeKey{}).(policyScopeContext)
+	if !ok {
+		return devicePluginScope{}
+	}
+	if scope, ok := scopeCtx.scopes[scopeCtx.policyName]; ok {
+		return devicePluginScope{
+			namespace: scope.Namespace,
+			requirements: []v1.NodeSelectorRequirement{{
+				Key: scope.NodeLabel, Operator: v1.NodeSelectorOpIn, Values: []string{scope.NodeLabelValue}}},
+		}
+	}
+	// the nodes of all the scopes are excluded, sorted by policy name for a stable rendering
+	names := make([]string, 0, len(scopeCtx.scopes))
+	for name := range scopeCtx.scopes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	scope := devicePluginScope{}
+	for _, name := range names {
+		scope.requirements = append(scope.requirements, v1.NodeSelectorRequirement{
+			Key:      scopeCtx.scopes[name].NodeLabel,
+			Operator: v1.NodeSelectorOpNotIn,
+			Values:   []string{scopeCtx.scopes[name].NodeLabelValue},
+		})
+	}
+	return scope
+}
+
+// getNamespace returns the namespace of the device plugin objects
+func (s devicePluginScope) getNamespace() string {
+	if s.namespace == "" {
+		return consts.NetworkOperatorResourceNamespace
+	}
+	return s.namespace
+}
+
+// getClusterObjectName returns the name of the cluster scoped object of the device plugins named name, suffixed with
+// the namespace of the scope so the cluster scoped objects of the scopes do not conflict
+func (s devicePluginScope) getClusterObjectName(name string) string {
+	if s.namespace == "" {
+		return name
+	}
+	return name + "-" + s.namespace
+}
+
+// getNodeSelector returns the selector of the nodes of the scope
+func (s devicePluginScope) getNodeSelector() labels.Selector {
+	selector := labels.NewSelector()
+	for _, requirement := range s.requirements {
+		op := selection.In
+		if requirement.Operator == v1.NodeSelectorOpNotIn {
+			op = selection.NotIn
+		}
+		// the requirements of the scopes are validated by ParsePolicyScopes
+		r, err := labels.NewRequirement(requirement.Key, op, requirement.Values)
+		if err != nil {
+			continue
+		}
+		selector = selector.Add(*r)
+	}
+	return selector
+}
+
+// getNodeInfo returns the nodes of nodeInfo which are part of the scope
+func (s devicePluginScope) getNodeInfo(nodeInfo nodeinfo.Provider) nodeinfo.Provider {
+	if len(s.requirements) == 0 {
+		return nodeInfo
+	}
+	return nodeinfo.NewFilteredProvider(nodeInfo, nodeinfo.NewNodeLabelSelectorFilter(s.getNodeSelector()))
+}
+
+// getNodeAffinity returns a copy of affinity which in addition only selects the nodes of the scope
+func (s devicePluginScope) getNodeAffinity(affinity *v1.NodeAffinity) *v1.NodeAffinity {
+	if len(s.requirements) == 0 {
+		return affinity
+	}
+	return constrainNodeAffinity(affinity, func(term *v1.NodeSelectorTerm) {
+		term.MatchExpressions = append(term.MatchExpressions, s.requirements...)
+	})
+}
@@ -0,0 +1,232 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	mellanoxv1alpha1 "github.com/Mellanox/network-operator/api/v1alpha1"
+	"github.com/Mellanox/network-operator/pkg/consts"
+	"github.com/Mellanox/network-operator/pkg/nodeinfo"
+	"github.com/Mellanox/network-operator/pkg/render"
+	"github.com/Mellanox/network-operator/pkg/utils"
+)
+
+var _ = Describe("Policy scope tests", func() {
+	Context("Parse policy scopes", func() {
+		It("Should parse the scopes keyed by policy name", func() {
+			scopes, err := ParsePolicyScopes([]string{"tenant-a=tenant-a:example.com/tenant=a", " ",
+				"tenant-b=tenant-b:example.com/tenant=b"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(scopes).To(Equal(map[string]PolicyScope{
+				"tenant-a": {Namespace: "tenant-a", NodeLabel: "example.com/tenant", NodeLabelValue: "a"},
+				"tenant-b": {Namespace: "tenant-b", NodeLabel: "example.com/tenant", NodeLabelValue: "b"},
+			}))
+		})
+		It("Should fail on malformed or conflicting scopes", func() {
+			for _, entries := range [][]string{
+				{"tenant-a"},
+				{"tenant-a=tenant-a"},
+				{"tenant-a=tenant-a:tenant"},
+				{"tenant-a=Tenant_A:tenant=a"},
+				{consts.NicClusterPolicyResourceName + "=tenant-a:tenant=a"},
+				{"tenant-a=" + consts.NetworkOperatorResourceNamespace + ":tenant=a"},
+				{"tenant-a=tenant-a:tenant=a", "tenant-b=tenant-a:tenant=b"},
+				{"tenant-a=tenant-a:tenant=a", "tenant-b=tenant-b:tenant=a"},
+				{"tenant-a=tenant-a:tenant=a", "tenant-a=tenant-b:tenant=b"},
+			} {
+				_, err := ParsePolicyScopes(entries)
+				Expect(err).To(HaveOccurred(), "entries: %v", entries)
+			}
+		})
+		It("Should only allow device plugins in a scoped policy", func() {
+			cr := &mellanoxv1alpha1.NicClusterPolicy{}
+			cr.Name = "tenant-a"
+			cr.Spec.SriovDevicePlugin = &mellanoxv1alpha1.DevicePluginSpec{}
+			Expect(ValidateScopedPolicy(cr)).To(Succeed())
+			cr.Spec.OFEDDriver = &mellanoxv1alpha1.OFEDDriverSpec{}
+			cr.Spec.SecondaryNetwork = &mellanoxv1alpha1.SecondaryNetworkSpec{}
+			err := ValidateScopedPolicy(cr)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(HaveSuffix("unsupported fields: ofedDriver, secondaryNetwork"))
+		})
+	})
+
+	Context("Scoped device plugins", func() {
+		var (
+			k8sClient client.Client
+			scheme    *runtime.Scheme
+			catalog   InfoCatalog
+			scopes    map[string]PolicyScope
+		)
+
+		newNode := func(name string, nodeLabels map[string]string) *corev1.Node {
+			node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{
+				nodeinfo.NodeLabelMlnxNIC:  "true",
+				nodeinfo.NodeLabelHostname: name,
+				nodeinfo.NodeLabelCPUArch:  "amd64",
+				nodeinfo.NodeLabelOSName:   "ubuntu",
+				nodeinfo.NodeLabelOSVer:    "20.04",
+			}}}
+			for key, value := range nodeLabels {
+				node.Labels[key] = value
+			}
+			return node
+		}
+		syncPolicy := func(name string) {
+			files, err := utils.GetFilesWithSuffix("../../manifests/stage-rdma-device-plugin",
+				render.ManifestFileSuffix...)
+			Expect(err).NotTo(HaveOccurred())
+			sharedDpState := &stateSharedDp{stateSkel: stateSkel{
+				name:           "state-RDMA-device-plugin",
+				clientProvider: NewStaticClientProvider(k8sClient),
+				scheme:         scheme,
+				renderer:       render.NewRenderer(files),
+			}}
+			cr := &mellanoxv1alpha1.NicClusterPolicy{}
+			cr.Name = name
+			cr.UID = types.UID("uid-" + name)
+			cr.Spec.RdmaSharedDevicePlugin = &mellanoxv1alpha1.DevicePluginSpec{
+				ImageSpec: mellanoxv1alpha1.ImageSpec{Image: "image", Repository: "repository", Version: "v1.3.2"},
+				Config:    `{"configList":[]}`,
+			}
+			ctx := WithPolicyScopes(context.Background(), name, scopes)
+			_, err = sharedDpState.Sync(ctx, cr, catalog)
+			Expect(err).NotTo(HaveOccurred())
+		}
+		getDaemonSet := func(namespace string) *appsv1.DaemonSet {
+			ds := &appsv1.DaemonSet{}
+			Expect(k8sClient.Get(context.Background(),
+				types.NamespacedName{Namespace: namespace, Name: "rdma-shared-dp-ds"}, ds)).To(Succeed())
+			return ds
+		}
+		getNodeRequirements := func(ds *appsv1.DaemonSet) []corev1.NodeSelectorRequirement {
+			affinity := ds.Spec.Template.Spec.Affinity
+			Expect(affinity).NotTo(BeNil())
+			terms := affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+			Expect(terms).To(HaveLen(1))
+			return terms[0].MatchExpressions
+		}
+
+		BeforeEach(func() {
+			var err error
+			scopes, err = ParsePolicyScopes([]string{"tenant-a=tenant-a:example.com/tenant=a",
+				"tenant-b=tenant-b:example.com/tenant=b"})
+			Expect(err).NotTo(HaveOccurred())
+			scheme = runtime.NewScheme()
+			Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+			Expect(mellanoxv1alpha1.AddToScheme(scheme)).To(Succeed())
+			nodes := []*corev1.Node{
+				newNode("node-a", map[string]string{"example.com/tenant": "a"}),
+				newNode("node-b", map[string]string{"example.com/tenant": "b", sharedDpSkipNodeLabel: "true"}),
+				newNode("node-c", nil),
+			}
+			k8sClient = fake.NewClientBuilder().WithScheme(scheme).WithObjects(nodes[0], nodes[1], nodes[2]).Build()
+			catalog = NewInfoCatalog()
+			catalog.Add(InfoTypeNodeInfo, nodeinfo.NewProvider(nodes))
+		})
+
+		It("Should deploy the device plugins of scoped policies to disjoint nodes and namespaces", func() {
+			syncPolicy("tenant-a")
+			syncPolicy("tenant-b")
+			syncPolicy(consts.NicClusterPolicyResourceName)
+
+			dsA := getDaemonSet("tenant-a")
+			Expect(metav1.GetControllerOf(dsA).Name).To(Equal("tenant-a"))
+			Expect(getNodeRequirements(dsA)).To(ContainElement(corev1.NodeSelectorRequirement{
+				Key: "example.com/tenant", Operator: corev1.NodeSelectorOpIn, Values: []string{"a"}}))
+
+			dsB := getDaemonSet("tenant-b")
+			Expect(metav1.GetControllerOf(dsB).Name).To(Equal("tenant-b"))
+			Expect(getNodeRequirements(dsB)).To(ContainElement(corev1.NodeSelectorRequirement{
+				Key: "example.com/tenant", Operator: corev1.NodeSelectorOpIn, Values: []string{"b"}}))
+
+			ds := getDaemonSet(consts.NetworkOperatorResourceNamespace)
+			Expect(metav1.GetControllerOf(ds).Name).To(Equal(consts.NicClusterPolicyResourceName))
+			Expect(getNodeRequirements(ds)).To(ContainElements(
+				corev1.NodeSelectorRequirement{
+					Key: "example.com/tenant", Operator: corev1.NodeSelectorOpNotIn, Values: []string{"a"}},
+				corev1.NodeSelectorRequirement{
+					Key: "example.com/tenant", Operator: corev1.NodeSelectorOpNotIn, Values: []string{"b"}},
+			))
+		})
+		It("Should not update the node labels of other scopes", func() {
+			syncPolicy("tenant-a")
+			syncPolicy(consts.NicClusterPolicyResourceName)
+
+			node := &corev1.Node{}
+			Expect(k8sClient.Get(context.Background(), types.NamespacedName{Name: "node-b"}, node)).To(Succeed())
+			Expect(node.Labels).To(HaveKeyWithValue(sharedDpSkipNodeLabel, "true"))
+		})
+		It("Should render the OpenShift SecurityContextConstraints of each scope", func() {
+			files, err := utils.GetFilesWithSuffix("../../manifests/stage-rdma-device-plugin",
+				render.ManifestFileSuffix...)
+			Expect(err).NotTo(HaveOccurred())
+			nodeInfo := nodeinfo.NewProvider([]*corev1.Node{
+				newNode("node-a", map[string]string{"example.com/tenant": "a", nodeinfo.NodeLabelOSName: "rhcos"}),
+				newNode("node-c", map[string]string{nodeinfo.NodeLabelOSName: "rhcos"}),
+			})
+			getSCC := func(name string) (sccName string, users []interface{}) {
+				sharedDpState := &stateSharedDp{stateSkel: stateSkel{renderer: render.NewRenderer(files)}}
+				sharedDpState.scope = getDevicePluginScope(WithPolicyScopes(context.Background(), name, scopes))
+				cr := &mellanoxv1alpha1.NicClusterPolicy{}
+				cr.Name = name
+				cr.Spec.RdmaSharedDevicePlugin = &mellanoxv1alpha1.DevicePluginSpec{
+					ImageSpec: mellanoxv1alpha1.ImageSpec{Image: "image", Repository: "repository", Version: "v1.3.2"},
+					Config:    `{"configList":[]}`,
+				}
+				objs, err := sharedDpState.getManifestObjects(cr, sharedDpState.scope.getNodeInfo(nodeInfo))
+				Expect(err).NotTo(HaveOccurred())
+				for _, obj := range objs {
+					if obj.GetKind() == "SecurityContextConstraints" {
+						return obj.GetName(), obj.Object["users"].([]interface{})
+					}
+				}
+				Fail("SecurityContextConstraints not rendered")
+				return "", nil
+			}
+
+			name, users := getSCC("tenant-a")
+			Expect(name).To(Equal("rdma-shared-tenant-a"))
+			Expect(users).To(Equal([]interface{}{"system:serviceaccount:tenant-a:rdma-shared"}))
+
+			name, users = getSCC(consts.NicClusterPolicyResourceName)
+			Expect(name).To(Equal("rdma-shared"))
+			Expect(users).To(Equal([]interface{}{
+				"system:serviceaccount:" + consts.NetworkOperatorResourceNamespace + ":rdma-shared"}))
+		})
+		It("Should not scope the device plugins without scopes", func() {
+			scopes = nil
+			syncPolicy(consts.NicClusterPolicyResourceName)
+			ds := getDaemonSet(consts.NetworkOperatorResourceNamespace)
+			for _, requirement := range getNodeRequirements(ds) {
+				Expect(requirement.Key).NotTo(Equal("example.com/tenant"))
+			}
+		})
+	})
+})
@@ -0,0 +1,171 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/Mellanox/network-operator/pkg/consts"
+	"github.com/Mellanox/network-operator/pkg/render"
+	"github.com/Mellanox/network-operator/pkg/utils"
+)
+
+var (
+	manifestAPIVersionRe = regexp.MustCompile(`(?m)^apiVersion:\s*"?([^"\s]+)"?\s*$`)
+	manifestKindRe       = regexp.MustCompile(`(?m)^kind:\s*"?([^"\s]+)"?\s*$`)
+	manifestSeparatorRe  = regexp.MustCompile(`(?m)^---\s*$`)
+)
+
+// GetManifestKinds returns the kinds of the objects in the manifests under manifestDir, i.e the kinds of the objects
+// the states render. CustomResourceDefinitions are left out as deleting them would delete all of their custom
+// resources.
+func GetManifestKinds(manifestDir string) ([]schema.GroupVersionKind, error) {
+	files, err := utils.GetFilesWithSuffix(manifestDir, render.ManifestFileSuffix...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list manifests")
+	}
+	seen := make(map[schema.GroupVersionKind]bool)
+	kinds := []schema.GroupVersionKind{}
+	for _, file := range files {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read manifest %s", file)
+		}
+		for _, doc := range manifestSeparatorRe.Split(string(content), -1) {
+			apiVersion := manifestAPIVersionRe.FindStringSubmatch(doc)
+			kind := manifestKindRe.FindStringSubmatch(doc)
+			if apiVersion == nil || kind == nil || kind[1] == "CustomResourceDefinition" ||
+				strings.Contains(apiVersion[1], "{{") || strings.Contains(kind[1], "{{") {
+				continue
+			}
+			gv, err := schema.ParseGroupVersion(apiVersion[1])
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid apiVersion in manifest %s", file)
+			}
+			gvk := gv.WithKind(kind[1])
+			if !seen[gvk] {
+				seen[gvk] = true
+				kinds = append(kinds, gvk)
+			}
+		}
+	}
+	sort.Slice(kinds, func(i, j int) bool { return kinds[i].String() < kinds[j].String() })
+	return kinds, nil
+}
+
+// PruneOptions controls the behavior of Prune
+type PruneOptions struct {
+	// Confirm must be set for Prune to delete objects, it guards against accidental invocations
+	Confirm bool
+	// Kinds of the objects to delete, e.g as returned by GetManifestKinds
+	Kinds []schema.GroupVersionKind
+	// ControlledBy restricts Prune to the objects whose controller reference has the API group, kind and name of
+	// ControlledBy, and its UID if set, e.g the objects of a deleted NicClusterPolicy. Objects controlled by other
+	// custom resources, e.g HostDeviceNetworks, or without controller reference are kept.
+	ControlledBy *metav1.OwnerReference
+}
+
+// isControlledBy returns true if the controller reference of obj matches ref, see PruneOptions.ControlledBy
+func isControlledBy(obj metav1.Object, ref *metav1.OwnerReference) bool {
+	controller := metav1.GetControllerOf(obj)
+	if controller == nil {
+		return false
+	}
+	controllerGV, err := schema.ParseGroupVersion(controller.APIVersion)
+	if err != nil {
+		return false
+	}
+	refGV, err := schema.ParseGroupVersion(ref.APIVersion)
+	if err != nil {
+		return false
+	}
+	return controllerGV.Group == refGV.Group && controller.Kind == ref.Kind && controller.Name == ref.Name &&
+		(ref.UID == "" || controller.UID == ref.UID)
+}
+
+// Prune deletes every object labeled with the operator owned label, of the kinds of PruneOptions.Kinds, and returns
+// the deleted objects identified as "Kind namespace/name". It is intended to be used for a clean uninstall or a reset
+// of the cluster and is idempotent: objects which no longer exist are ignored.
+// Objects annotated with the prune annotation set to "false" are kept, as well as the objects not controlled by
+// PruneOptions.ControlledBy if set.
+// Prune refuses to run without PruneOptions.Confirm or while states are being synced.
+func Prune(ctx context.Context, c client.Client, opts PruneOptions) ([]string, error) {
+	if !opts.Confirm {
+		return nil, errors.New("prune was not confirmed")
+	}
+	if _, ok := ctx.Value(renderedObjectsKey{}).(renderedObjects); ok {
+		return nil, errors.New("prune must not run during reconcile")
+	}
+
+	deleted := []string{}
+	for _, gvk := range opts.Kinds {
+		list := &unstructured.UnstructuredList{}
+		list.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+		err := c.List(ctx, list, client.MatchingLabels{consts.NetworkOperatorOwnedLabel: "true"})
+		if meta.IsNoMatchError(err) || runtime.IsNotRegisteredError(err) {
+			// Kind is not served by the cluster, e.g SecurityContextConstraints on non OpenShift clusters
+			log.V(consts.LogLevelDebug).Info("Skipping kind not available in the cluster", "Kind:", gvk.Kind)
+			continue
+		}
+		if err != nil {
+			return deleted, errors.Wrapf(err, "failed to list %s objects", gvk.Kind)
+		}
+
+		for i := range list.Items {
+			obj := &list.Items[i]
+			id := fmt.Sprintf("%s %s/%s", gvk.Kind, obj.GetNamespace(), obj.GetName())
+			if opts.ControlledBy != nil && !isControlledBy(obj, opts.ControlledBy) {
+				log.V(consts.LogLevelDebug).Info("Skipping object of another controller", "Kind:", gvk.Kind,
+					"Namespace:", obj.GetNamespace(), "Name:", obj.GetName())
+				continue
+			}
+			if obj.GetAnnotations()[consts.PruneAnnotation] == "false" {
+				log.V(consts.LogLevelInfo).Info("Skipping object excluded from pruning", "Kind:", gvk.Kind,
+					"Namespace:", obj.GetNamespace(), "Name:", obj.GetName())
+				continue
+			}
+			log.V(consts.LogLevelInfo).Info("Pruning object", "Kind:", gvk.Kind,
+				"Namespace:", obj.GetNamespace(), "Name:", obj.GetName())
+			err := c.Delete(ctx, obj, client.PropagationPolicy(metav1.DeletePropagationBackground))
+			if k8serrors.IsNotFound(err) {
+				continue
+			}
+			if err != nil {
+				return deleted, errors.Wrapf(err, "failed to delete %s", id)
+			}
+			recordEvent(ctx, obj, corev1.EventTypeNormal, EventReasonObjectPruned, "Pruned by the operator")
+			deleted = append(deleted, id)
+		}
+	}
+	sort.Strings(deleted)
+	return deleted, nil
+}
@@ -0,0 +1,144 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/Mellanox/network-operator/pkg/consts"
+)
+
+var _ = Describe("Prune tests", func() {
+	var k8sClient client.Client
+
+	ownedLabels := map[string]string{consts.NetworkOperatorOwnedLabel: "true"}
+	kinds := []schema.GroupVersionKind{
+		{Group: "apps", Version: "v1", Kind: "DaemonSet"},
+		{Group: "", Version: "v1", Kind: "ConfigMap"},
+	}
+
+	BeforeEach(func() {
+		k8sClient = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+			&appsv1.DaemonSet{ObjectMeta: metav1.ObjectMeta{
+				Name: "owned-ds", Namespace: consts.NetworkOperatorResourceNamespace, Labels: ownedLabels}},
+			&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+				Name: "owned-cm", Namespace: consts.NetworkOperatorResourceNamespace, Labels: ownedLabels}},
+			&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+				Name: "user-cm", Namespace: consts.NetworkOperatorResourceNamespace}},
+			&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+				Name: "kept-cm", Namespace: consts.NetworkOperatorResourceNamespace, Labels: ownedLabels,
+				Annotations: map[string]string{consts.PruneAnnotation: "false"}}},
+		).Build()
+	})
+
+	exists := func(obj client.Object, name string) bool {
+		err := k8sClient.Get(context.TODO(),
+			types.NamespacedName{Name: name, Namespace: consts.NetworkOperatorResourceNamespace}, obj)
+		if k8serrors.IsNotFound(err) {
+			return false
+		}
+		Expect(err).NotTo(HaveOccurred())
+		return true
+	}
+
+	It("Should delete labeled objects and ignore unlabeled ones", func() {
+		deleted, err := Prune(context.Background(), k8sClient, PruneOptions{Confirm: true, Kinds: kinds})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deleted).To(Equal([]string{
+			"ConfigMap nvidia-network-operator-resources/owned-cm",
+			"DaemonSet nvidia-network-operator-resources/owned-ds",
+		}))
+		Expect(exists(&appsv1.DaemonSet{}, "owned-ds")).To(BeFalse())
+		Expect(exists(&corev1.ConfigMap{}, "owned-cm")).To(BeFalse())
+		Expect(exists(&corev1.ConfigMap{}, "user-cm")).To(BeTrue())
+	})
+	It("Should keep labeled objects excluded from pruning", func() {
+		deleted, err := Prune(context.Background(), k8sClient, PruneOptions{Confirm: true, Kinds: kinds})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deleted).NotTo(ContainElement("ConfigMap nvidia-network-operator-resources/kept-cm"))
+		Expect(exists(&corev1.ConfigMap{}, "kept-cm")).To(BeTrue())
+		Expect(exists(&corev1.ConfigMap{}, "owned-cm")).To(BeFalse())
+	})
+	It("Should be idempotent", func() {
+		_, err := Prune(context.Background(), k8sClient, PruneOptions{Confirm: true, Kinds: kinds})
+		Expect(err).NotTo(HaveOccurred())
+		deleted, err := Prune(context.Background(), k8sClient, PruneOptions{Confirm: true, Kinds: kinds})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deleted).To(BeEmpty())
+	})
+	It("Should not delete objects if not confirmed", func() {
+		_, err := Prune(context.Background(), k8sClient, PruneOptions{})
+		Expect(err).To(HaveOccurred())
+		Expect(exists(&appsv1.DaemonSet{}, "owned-ds")).To(BeTrue())
+	})
+	It("Should not delete objects during reconcile", func() {
+		_, err := Prune(withRenderedObjects(context.Background()), k8sClient, PruneOptions{Confirm: true, Kinds: kinds})
+		Expect(err).To(HaveOccurred())
+		Expect(exists(&appsv1.DaemonSet{}, "owned-ds")).To(BeTrue())
+	})
+	It("Should only delete the objects controlled by the given custom resource", func() {
+		controllerRef := func(kind, name string) []metav1.OwnerReference {
+			return []metav1.OwnerReference{{APIVersion: "mellanox.com/v1alpha1", Kind: kind, Name: name,
+				UID: types.UID(name), Controller: &[]bool{true}[0]}}
+		}
+		for name, owners := range map[string][]metav1.OwnerReference{
+			"policy-cm":       controllerRef("NicClusterPolicy", consts.NicClusterPolicyResourceName),
+			"scoped-cm":       controllerRef("NicClusterPolicy", "scoped-policy"),
+			"hostdevice-cm":   controllerRef("HostDeviceNetwork", consts.NicClusterPolicyResourceName),
+			"uncontrolled-cm": nil,
+		} {
+			Expect(k8sClient.Create(context.Background(), &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+				Name: name, Namespace: consts.NetworkOperatorResourceNamespace, Labels: ownedLabels,
+				OwnerReferences: owners}})).To(Succeed())
+		}
+
+		deleted, err := Prune(context.Background(), k8sClient, PruneOptions{Confirm: true, Kinds: kinds,
+			ControlledBy: &metav1.OwnerReference{APIVersion: "mellanox.com/v1alpha1", Kind: "NicClusterPolicy",
+				Name: consts.NicClusterPolicyResourceName}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deleted).To(Equal([]string{"ConfigMap nvidia-network-operator-resources/policy-cm"}))
+		Expect(exists(&corev1.ConfigMap{}, "scoped-cm")).To(BeTrue())
+		Expect(exists(&corev1.ConfigMap{}, "hostdevice-cm")).To(BeTrue())
+		Expect(exists(&corev1.ConfigMap{}, "uncontrolled-cm")).To(BeTrue())
+		Expect(exists(&appsv1.DaemonSet{}, "owned-ds")).To(BeTrue())
+	})
+	It("Should derive the kinds to prune from the manifests", func() {
+		manifestKinds, err := GetManifestKinds("../../manifests")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(manifestKinds).To(ContainElements(
+			schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "DaemonSet"},
+			schema.GroupVersionKind{Group: "whereabouts.cni.cncf.io", Version: "v1alpha1", Kind: "IPPool"},
+			schema.GroupVersionKind{Group: "networking.k8s.io", Version: "v1", Kind: "NetworkPolicy"},
+		))
+		for _, kind := range manifestKinds {
+			Expect(kind.Kind).NotTo(Equal("CustomResourceDefinition"))
+		}
+	})
+})
@@ -0,0 +1,127 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"golang.org/x/time/rate"
+)
+
+type stateRateLimitersKey struct{}
+
+// StateRateLimit is the token bucket rate limit of the Sync of a state
+type StateRateLimit struct {
+	// Rate is the number of Sync invocations per second
+	Rate float64
+	// Burst is the number of Sync invocations allowed at once
+	Burst int
+}
+
+// ParseStateRateLimits parses state rate limits from entries formatted as <state name>=<rate>:<burst>, e.g
+// state-OFED=0.1:1, empty entries are ignored
+func ParseStateRateLimits(entries []string) (map[string]StateRateLimit, error) {
+	limits := make(map[string]StateRateLimit, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, limit := splitPair(entry, "=")
+		rateValue, burstValue := splitPair(limit, ":")
+		if name == "" || rateValue == "" || burstValue == "" {
+			return nil, errors.Errorf("invalid state rate limit %q, expected <state name>=<rate>:<burst>", entry)
+		}
+		r, err := strconv.ParseFloat(rateValue, 64)
+		if err != nil || r <= 0 {
+			return nil, errors.Errorf("invalid rate of state rate limit %q, must be a positive number", entry)
+		}
+		burst, err := strconv.Atoi(burstValue)
+		if err != nil || burst < 1 {
+			return nil, errors.Errorf("invalid burst of state rate limit %q, must be a positive integer", entry)
+		}
+		limits[name] = StateRateLimit{Rate: r, Burst: burst}
+	}
+	return limits, nil
+}
+
+// splitPair splits s around the first sep, value is empty if s does not contain sep
+func splitPair(s, sep string) (key, value string) {
+	parts := strings.SplitN(s, sep, 2)
+	if len(parts) != 2 {
+		return parts[0], ""
+	}
+	return parts[0], parts[1]
+}
+
+// ManagerOption configures a state Manager
+type ManagerOption func(*stateManager)
+
+// WithStateRateLimits throttles the Sync of each state independently according to limits keyed by state name, so a
+// state failing repeatedly does not monopolize the reconcile capacity. States without a limit are not throttled.
+func WithStateRateLimits(limits map[string]StateRateLimit) ManagerOption {
+	return func(smgr *stateManager) {
+		smgr.rateLimiters = newStateRateLimiters(limits)
+	}
+}
+
+// stateRateLimiters holds the token bucket of the rate limited states keyed by state name
+type stateRateLimiters struct {
+	mu       sync.Mutex
+	limiters map[string]*rate.Limiter
+}
+
+func newStateRateLimiters(limits map[string]StateRateLimit) *stateRateLimiters {
+	limiters := make(map[string]*rate.Limiter, len(limits))
+	for name, limit := range limits {
+		limiters[name] = rate.NewLimiter(rate.Limit(limit.Rate), limit.Burst)
+	}
+	return &stateRateLimiters{limiters: limiters}
+}
+
+// allow reports whether stateName may be synced now, a token of its bucket is consumed if so
+func (l *stateRateLimiters) allow(stateName string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	limiter, ok := l.limiters[stateName]
+	if !ok {
+		return true
+	}
+	return limiter.Allow()
+}
+
+// withStateRateLimiters returns a context throttling the Sync of the states with limiters, ctx is returned as is if
+// limiters is not set
+func withStateRateLimiters(ctx context.Context, limiters *stateRateLimiters) context.Context {
+	if limiters == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, stateRateLimitersKey{}, limiters)
+}
+
+// isThrottled checks if the Sync of stateName exceeds its rate limit
+func isThrottled(ctx context.Context, stateName string) bool {
+	limiters, ok := ctx.Value(stateRateLimitersKey{}).(*stateRateLimiters)
+	if !ok {
+		return false
+	}
+	return !limiters.allow(stateName)
+}
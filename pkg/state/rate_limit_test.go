@@ -0,0 +1,85 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("State rate limits tests", func() {
+	It("Should throttle the Sync of a state to its configured rate", func() {
+		limited := &fakeState{name: "limited", syncState: SyncStateNotReady}
+		unlimited := &fakeState{name: "unlimited", syncState: SyncStateReady}
+		manager := &stateManager{stateGroups: []Group{NewStateGroup([]State{limited, unlimited})}}
+		// a single token which is not refilled during the test
+		WithStateRateLimits(map[string]StateRateLimit{"limited": {Rate: 0.001, Burst: 1}})(manager)
+
+		var results Results
+		for i := 0; i < 3; i++ {
+			var err error
+			results, err = manager.SyncState(context.Background(), nil, nil)
+			Expect(err).NotTo(HaveOccurred())
+		}
+		Expect(limited.syncCount).To(Equal(1))
+		Expect(unlimited.syncCount).To(Equal(3))
+		Expect(results.StatesStatus).To(ContainElement(Result{StateName: "limited", Status: SyncStateNotReady}))
+	})
+	It("Should not throttle states without rate limits", func() {
+		state := &fakeState{name: "state", syncState: SyncStateReady}
+		manager := &stateManager{stateGroups: []Group{NewStateGroup([]State{state})}}
+		WithStateRateLimits(map[string]StateRateLimit{"other": {Rate: 0.001, Burst: 1}})(manager)
+
+		for i := 0; i < 3; i++ {
+			results, err := manager.SyncState(context.Background(), nil, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(results.Status).To(Equal(SyncState(SyncStateReady)))
+		}
+		Expect(state.syncCount).To(Equal(3))
+	})
+	It("Should report a throttled state as not ready", func() {
+		limited := &fakeState{name: "limited", syncState: SyncStateReady}
+		manager := &stateManager{stateGroups: []Group{NewStateGroup([]State{limited})}}
+		WithStateRateLimits(map[string]StateRateLimit{"limited": {Rate: 0.001, Burst: 1}})(manager)
+
+		results, err := manager.SyncState(context.Background(), nil, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(results.Status).To(Equal(SyncState(SyncStateReady)))
+
+		results, err = manager.SyncState(context.Background(), nil, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(limited.syncCount).To(Equal(1))
+		// the state was ready, a throttled Sync must not be reported as ready so the resource is requeued
+		Expect(results.Status).To(Equal(SyncState(SyncStateNotReady)))
+		Expect(results.StatesStatus).To(ConsistOf(Result{StateName: "limited", Status: SyncStateNotReady}))
+	})
+	It("Should parse state rate limits", func() {
+		limits, err := ParseStateRateLimits([]string{"state-OFED=0.1:1", " state-SRIOV-device-plugin=2:5 ", ""})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(limits).To(Equal(map[string]StateRateLimit{
+			"state-OFED":                {Rate: 0.1, Burst: 1},
+			"state-SRIOV-device-plugin": {Rate: 2, Burst: 5},
+		}))
+		for _, entry := range []string{"state-OFED", "state-OFED=0.1", "=1:1", "state-OFED=0:1", "state-OFED=1:0",
+			"state-OFED=x:1"} {
+			_, err := ParseStateRateLimits([]string{entry})
+			Expect(err).To(HaveOccurred(), entry)
+		}
+	})
+})
@@ -0,0 +1,331 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/Mellanox/network-operator/pkg/config"
+	"github.com/Mellanox/network-operator/pkg/consts"
+)
+
+const (
+	readinessQuorumAllStr    = "all"
+	readinessQuorumAnyStr    = "any"
+	readinessQuorumPrefixStr = "quorum:"
+)
+
+// readinessQuorum is the number of ready pods required for a workload object to be considered ready.
+// The zero value requires all pods of the object to be ready.
+type readinessQuorum struct {
+	// minReady is the number of ready pods required, 0 means all pods
+	minReady int32
+}
+
+var (
+	// readinessQuorumAll requires all pods to be ready, e.g a device plugin should be ready on all eligible nodes
+	readinessQuorumAll = readinessQuorum{}
+	// readinessQuorumAny requires at least one ready pod
+	readinessQuorumAny = readinessQuorum{minReady: 1}
+)
+
+// parseReadinessQuorum parses a readiness quorum in one of the forms: "all", "any" or "quorum:N" where N > 0
+func parseReadinessQuorum(quorum string) (readinessQuorum, error) {
+	switch {
+	case quorum == readinessQuorumAllStr:
+		return readinessQuorumAll, nil
+	case quorum == readinessQuorumAnyStr:
+		return readinessQuorumAny, nil
+	case strings.HasPrefix(quorum, readinessQuorumPrefixStr):
+		n, err := strconv.ParseInt(strings.TrimPrefix(quorum, readinessQuorumPrefixStr), 10, 32)
+		if err != nil || n <= 0 {
+			return readinessQuorum{}, errors.Errorf("invalid readiness quorum %q, N must be a positive integer", quorum)
+		}
+		return readinessQuorum{minReady: int32(n)}, nil
+	}
+	return readinessQuorum{}, errors.Errorf(
+		"invalid readiness quorum %q, expected one of: all, any, quorum:N", quorum)
+}
+
+// String returns the readiness quorum in the form accepted by parseReadinessQuorum
+func (q readinessQuorum) String() string {
+	switch q.minReady {
+	case 0:
+		return readinessQuorumAllStr
+	case 1:
+		return readinessQuorumAnyStr
+	}
+	return fmt.Sprintf("%s%d", readinessQuorumPrefixStr, q.minReady)
+}
+
+// isMet checks if the number of ready pods satisfies the quorum. A quorum larger than the desired number of pods
+// requires all pods to be ready.
+func (q readinessQuorum) isMet(ready, desired int32) bool {
+	required := desired
+	if q.minReady != 0 && q.minReady < desired {
+		required = q.minReady
+	}
+	return ready >= required
+}
+
+// readinessEvaluator checks if an object retrieved from the cluster with c is ready according to the readiness
+// quorum. Evaluators of objects which do not manage pods replicas ignore the quorum.
+type readinessEvaluator func(c client.Client, obj *unstructured.Unstructured, quorum readinessQuorum) (bool, error)
+
+// getMaintenanceTaintKeys returns the keys of the taints marking nodes under maintenance, e.g cordoned nodes
+var getMaintenanceTaintKeys = func() []string {
+	return config.FromEnv().State.MaintenanceTaints
+}
+
+// readinessEvaluators holds the readiness evaluator of each kind, objects of kinds which are not registered are
+// considered ready once they exist.
+var readinessEvaluators = map[schema.GroupKind]readinessEvaluator{
+	{Group: appsv1.GroupName, Kind: "DaemonSet"}:  isDaemonSetReady,
+	{Group: appsv1.GroupName, Kind: "Deployment"}: isDeploymentReady,
+	{Group: batchv1.GroupName, Kind: "Job"}:       isJobReady,
+}
+
+// WorkloadReadiness is the readiness of a workload object normalized across workload kinds, Ready out of Desired is
+// the number of ready pods of a DaemonSet out of its scheduled pods or the available replicas of a Deployment out of
+// its replicas
+type WorkloadReadiness struct {
+	Kind    string
+	Name    string
+	Ready   int32
+	Desired int32
+}
+
+// Fraction returns the fraction of ready pods of the workload object, 0 if no pod is desired
+func (w WorkloadReadiness) Fraction() float64 {
+	if w.Desired <= 0 {
+		return 0
+	}
+	return float64(w.Ready) / float64(w.Desired)
+}
+
+// workloadReadinessGetter returns the readiness of a workload object retrieved from the cluster
+type workloadReadinessGetter func(obj *unstructured.Unstructured) (WorkloadReadiness, error)
+
+// workloadReadinessGetters holds the readiness getter of each workload kind, the readiness of objects of other kinds
+// is not summarized
+var workloadReadinessGetters = map[schema.GroupKind]workloadReadinessGetter{
+	{Group: appsv1.GroupName, Kind: "DaemonSet"}:  getDaemonSetReadiness,
+	{Group: appsv1.GroupName, Kind: "Deployment"}: getDeploymentReadiness,
+}
+
+// getDaemonSetReadiness returns the ready pods of a daemonset out of its scheduled pods
+func getDaemonSetReadiness(uds *unstructured.Unstructured) (WorkloadReadiness, error) {
+	ds := &appsv1.DaemonSet{}
+	if err := fromUnstructured(uds, ds); err != nil {
+		return WorkloadReadiness{}, err
+	}
+	return WorkloadReadiness{
+		Kind: "DaemonSet", Name: ds.Name, Ready: ds.Status.NumberReady, Desired: ds.Status.DesiredNumberScheduled}, nil
+}
+
+// getDeploymentReadiness returns the available replicas of a deployment out of its replicas
+func getDeploymentReadiness(udp *unstructured.Unstructured) (WorkloadReadiness, error) {
+	dp := &appsv1.Deployment{}
+	if err := fromUnstructured(udp, dp); err != nil {
+		return WorkloadReadiness{}, err
+	}
+	replicas := int32(1)
+	if dp.Spec.Replicas != nil {
+		replicas = *dp.Spec.Replicas
+	}
+	return WorkloadReadiness{
+		Kind: "Deployment", Name: dp.Name, Ready: dp.Status.AvailableReplicas, Desired: replicas}, nil
+}
+
+// fromUnstructured converts an unstructured object to a typed object
+func fromUnstructured(obj *unstructured.Unstructured, into interface{}) error {
+	buf, err := obj.MarshalJSON()
+	if err != nil {
+		return errors.Wrapf(err, "failed to marshall unstructured %s object", obj.GetKind())
+	}
+	if err = json.Unmarshal(buf, into); err != nil {
+		return errors.Wrapf(err, "failed to unmarshall to %s object", obj.GetKind())
+	}
+	return nil
+}
+
+// isUnderMaintenance checks if node has a taint with one of taintKeys
+func isUnderMaintenance(node *corev1.Node, taintKeys []string) bool {
+	for _, taint := range node.Spec.Taints {
+		for _, key := range taintKeys {
+			if taint.Key == key {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isPodReady checks if the Ready condition of pod is true
+func isPodReady(pod *corev1.Pod) bool {
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == corev1.PodReady {
+			return cond.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// getMaintenanceUnavailablePods returns the number of pods of ds which are not ready on nodes under maintenance,
+// nodes tainted with one of taintKeys
+func getMaintenanceUnavailablePods(c client.Client, ds *appsv1.DaemonSet, taintKeys []string) (int32, error) {
+	if ds.Spec.Selector == nil {
+		return 0, nil
+	}
+	pods := &corev1.PodList{}
+	if err := c.List(context.TODO(), pods, client.InNamespace(ds.Namespace),
+		client.MatchingLabels(ds.Spec.Selector.MatchLabels)); err != nil {
+		return 0, errors.Wrap(err, "failed to list daemonset pods")
+	}
+	underMaintenance := make(map[string]bool)
+	var unavailable int32
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.Spec.NodeName == "" || isPodReady(pod) {
+			continue
+		}
+		maintenance, ok := underMaintenance[pod.Spec.NodeName]
+		if !ok {
+			node := &corev1.Node{}
+			if err := c.Get(context.TODO(), types.NamespacedName{Name: pod.Spec.NodeName}, node); err != nil {
+				if k8serrors.IsNotFound(err) {
+					continue
+				}
+				return 0, errors.Wrap(err, "failed to get node")
+			}
+			maintenance = isUnderMaintenance(node, taintKeys)
+			underMaintenance[pod.Spec.NodeName] = maintenance
+		}
+		if maintenance {
+			unavailable++
+		}
+	}
+	return unavailable, nil
+}
+
+// isDaemonSetReady checks if the quorum of daemonset pods is available. Pods which are not ready on nodes under
+// maintenance are excluded from the desired pods, so a planned maintenance does not make the daemonset not ready.
+func isDaemonSetReady(c client.Client, uds *unstructured.Unstructured, quorum readinessQuorum) (bool, error) {
+	ds := &appsv1.DaemonSet{}
+	if err := fromUnstructured(uds, ds); err != nil {
+		return false, err
+	}
+	desired := ds.Status.DesiredNumberScheduled
+	if taintKeys := getMaintenanceTaintKeys(); len(taintKeys) != 0 && desired != 0 {
+		unavailable, err := getMaintenanceUnavailablePods(c, ds, taintKeys)
+		if err != nil {
+			return false, err
+		}
+		if unavailable != 0 {
+			log.V(consts.LogLevelInfo).Info("Excluding pods on nodes under maintenance from readiness",
+				"daemonset", ds.Name, "pods", unavailable)
+		}
+		desired -= unavailable
+	}
+
+	log.V(consts.LogLevelDebug).Info(
+		"Check daemonset state",
+		"DesiredNodes:", ds.Status.DesiredNumberScheduled,
+		"CurrentNodes:", ds.Status.CurrentNumberScheduled,
+		"PodsAvailable:", ds.Status.NumberAvailable,
+		"PodsUnavailable:", ds.Status.NumberUnavailable,
+		"PodsReady:", ds.Status.NumberReady,
+		"Conditions:", ds.Status.Conditions,
+		"Quorum:", quorum.String())
+	// Note(adrianc): We check for DesiredNumberScheduled!=0 as we expect to have at least one node that would need
+	// to have DaemonSet Pods deployed onto it. DesiredNumberScheduled == 0 then indicates that this field was not yet
+	// updated by the DaemonSet controller
+	// TODO: Check if we can use another field maybe to indicate it was processed by the DaemonSet controller.
+	if ds.Status.DesiredNumberScheduled != 0 && quorum.isMet(ds.Status.NumberAvailable, desired) {
+		return true, nil
+	}
+	return false, nil
+}
+
+// isDeploymentReady checks if deployment rolled out and the quorum of its replicas is updated and available
+func isDeploymentReady(_ client.Client, udp *unstructured.Unstructured, quorum readinessQuorum) (bool, error) {
+	dp := &appsv1.Deployment{}
+	if err := fromUnstructured(udp, dp); err != nil {
+		return false, err
+	}
+
+	replicas := int32(1)
+	if dp.Spec.Replicas != nil {
+		replicas = *dp.Spec.Replicas
+	}
+	log.V(consts.LogLevelDebug).Info(
+		"Check deployment state",
+		"Replicas:", replicas,
+		"UpdatedReplicas:", dp.Status.UpdatedReplicas,
+		"AvailableReplicas:", dp.Status.AvailableReplicas,
+		"Generation:", dp.Generation,
+		"ObservedGeneration:", dp.Status.ObservedGeneration,
+		"Quorum:", quorum.String())
+	// Status is stale until the deployment controller observes the latest generation of the spec
+	if dp.Status.ObservedGeneration < dp.Generation {
+		return false, nil
+	}
+	if quorum.isMet(dp.Status.UpdatedReplicas, replicas) && quorum.isMet(dp.Status.AvailableReplicas, replicas) {
+		return true, nil
+	}
+	return false, nil
+}
+
+// isJobReady checks if job completed successfully, an error is returned if the job failed
+func isJobReady(_ client.Client, ujob *unstructured.Unstructured, _ readinessQuorum) (bool, error) {
+	job := &batchv1.Job{}
+	if err := fromUnstructured(ujob, job); err != nil {
+		return false, err
+	}
+
+	log.V(consts.LogLevelDebug).Info(
+		"Check job state",
+		"Succeeded:", job.Status.Succeeded,
+		"Failed:", job.Status.Failed,
+		"Conditions:", job.Status.Conditions)
+	for _, cond := range job.Status.Conditions {
+		if cond.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch cond.Type {
+		case batchv1.JobComplete:
+			return true, nil
+		case batchv1.JobFailed:
+			return false, errors.Errorf("job %s/%s failed: %s", job.Namespace, job.Name, cond.Message)
+		}
+	}
+	return false, nil
+}
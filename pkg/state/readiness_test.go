@@ -0,0 +1,296 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Readiness evaluators tests", func() {
+	var k8sClient client.Client
+
+	BeforeEach(func() {
+		k8sClient = fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).Build()
+	})
+
+	toUnstructured := func(obj runtime.Object) *unstructured.Unstructured {
+		content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+		Expect(err).NotTo(HaveOccurred())
+		return &unstructured.Unstructured{Object: content}
+	}
+	evaluateWithQuorum := func(obj runtime.Object, gk schema.GroupKind, quorum readinessQuorum) (bool, error) {
+		isReady, ok := readinessEvaluators[gk]
+		Expect(ok).To(BeTrue())
+		return isReady(k8sClient, toUnstructured(obj), quorum)
+	}
+	evaluate := func(obj runtime.Object, gk schema.GroupKind) (bool, error) {
+		return evaluateWithQuorum(obj, gk, readinessQuorumAll)
+	}
+	mustParseQuorum := func(quorum string) readinessQuorum {
+		q, err := parseReadinessQuorum(quorum)
+		Expect(err).NotTo(HaveOccurred())
+		return q
+	}
+
+	Context("Readiness quorum", func() {
+		It("Should parse valid quorums", func() {
+			Expect(mustParseQuorum("all")).To(Equal(readinessQuorumAll))
+			Expect(mustParseQuorum("any")).To(Equal(readinessQuorumAny))
+			Expect(mustParseQuorum("quorum:3")).To(Equal(readinessQuorum{minReady: 3}))
+			Expect(mustParseQuorum("quorum:3").String()).To(Equal("quorum:3"))
+		})
+		It("Should fail to parse invalid quorums", func() {
+			for _, quorum := range []string{"", "most", "quorum:", "quorum:0", "quorum:-1", "quorum:a"} {
+				_, err := parseReadinessQuorum(quorum)
+				Expect(err).To(HaveOccurred(), quorum)
+			}
+		})
+	})
+
+	Context("DaemonSet", func() {
+		dsGK := schema.GroupKind{Group: "apps", Kind: "DaemonSet"}
+		var ds *appsv1.DaemonSet
+
+		BeforeEach(func() {
+			ds = &appsv1.DaemonSet{}
+			ds.Status = appsv1.DaemonSetStatus{DesiredNumberScheduled: 4, NumberAvailable: 2}
+		})
+
+		It("Should not be ready with quorum all when some pods are unavailable", func() {
+			ready, err := evaluateWithQuorum(ds, dsGK, mustParseQuorum("all"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ready).To(BeFalse())
+			ds.Status.NumberAvailable = 4
+			ready, err = evaluateWithQuorum(ds, dsGK, mustParseQuorum("all"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ready).To(BeTrue())
+		})
+		It("Should be ready with quorum any when a pod is available", func() {
+			ready, err := evaluateWithQuorum(ds, dsGK, mustParseQuorum("any"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ready).To(BeTrue())
+			ds.Status.NumberAvailable = 0
+			ready, err = evaluateWithQuorum(ds, dsGK, mustParseQuorum("any"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ready).To(BeFalse())
+		})
+		It("Should be ready with quorum N when N pods are available", func() {
+			ready, err := evaluateWithQuorum(ds, dsGK, mustParseQuorum("quorum:2"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ready).To(BeTrue())
+			ready, err = evaluateWithQuorum(ds, dsGK, mustParseQuorum("quorum:3"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ready).To(BeFalse())
+		})
+		It("Should require all pods with quorum N larger than desired pods", func() {
+			ds.Status.NumberAvailable = 4
+			ready, err := evaluateWithQuorum(ds, dsGK, mustParseQuorum("quorum:10"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ready).To(BeTrue())
+		})
+		Context("Nodes under maintenance", func() {
+			const maintenanceTaint = "example.com/maintenance"
+			var restoreTaintKeys func() []string
+
+			newNode := func(name string, taints ...corev1.Taint) *corev1.Node {
+				node := &corev1.Node{}
+				node.Name = name
+				node.Spec.Taints = taints
+				return node
+			}
+			newPod := func(name, nodeName string, ready corev1.ConditionStatus) *corev1.Pod {
+				pod := &corev1.Pod{}
+				pod.Name = name
+				pod.Namespace = "default"
+				pod.Labels = map[string]string{"app": "ds"}
+				pod.Spec.NodeName = nodeName
+				pod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: ready}}
+				return pod
+			}
+
+			BeforeEach(func() {
+				restoreTaintKeys = getMaintenanceTaintKeys
+				getMaintenanceTaintKeys = func() []string { return []string{maintenanceTaint} }
+				ds.Name = "ds"
+				ds.Namespace = "default"
+				ds.Spec.Selector = &metav1.LabelSelector{MatchLabels: map[string]string{"app": "ds"}}
+				ds.Status = appsv1.DaemonSetStatus{DesiredNumberScheduled: 3, NumberAvailable: 2}
+				k8sClient = fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithObjects(
+					newNode("node1"),
+					newNode("node2"),
+					newNode("node3", corev1.Taint{Key: maintenanceTaint, Effect: corev1.TaintEffectNoSchedule}),
+					newPod("pod1", "node1", corev1.ConditionTrue),
+					newPod("pod2", "node2", corev1.ConditionTrue),
+					newPod("pod3", "node3", corev1.ConditionFalse),
+				).Build()
+			})
+
+			AfterEach(func() {
+				getMaintenanceTaintKeys = restoreTaintKeys
+			})
+
+			It("Should exclude a pod which is not ready on a node under maintenance", func() {
+				ready, err := evaluate(ds, dsGK)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(ready).To(BeTrue())
+			})
+			It("Should not exclude a pod which is not ready on a node which is not under maintenance", func() {
+				Expect(k8sClient.Update(context.TODO(), newNode("node3"))).To(Succeed())
+				ready, err := evaluate(ds, dsGK)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(ready).To(BeFalse())
+			})
+			It("Should not exclude pods when no maintenance taint is set", func() {
+				getMaintenanceTaintKeys = func() []string { return nil }
+				ready, err := evaluate(ds, dsGK)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(ready).To(BeFalse())
+			})
+		})
+		It("Should not be ready before pods are scheduled", func() {
+			ds.Status = appsv1.DaemonSetStatus{}
+			ready, err := evaluateWithQuorum(ds, dsGK, mustParseQuorum("any"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ready).To(BeFalse())
+		})
+	})
+
+	Context("Deployment", func() {
+		deploymentGK := schema.GroupKind{Group: "apps", Kind: "Deployment"}
+		var dp *appsv1.Deployment
+
+		BeforeEach(func() {
+			replicas := int32(2)
+			dp = &appsv1.Deployment{}
+			dp.SetGeneration(2)
+			dp.Spec.Replicas = &replicas
+			dp.Status = appsv1.DeploymentStatus{
+				ObservedGeneration: 2,
+				UpdatedReplicas:    2,
+				AvailableReplicas:  2,
+			}
+		})
+
+		It("Should be ready when all replicas are updated and available", func() {
+			ready, err := evaluate(dp, deploymentGK)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ready).To(BeTrue())
+		})
+		It("Should not be ready when replicas are unavailable", func() {
+			dp.Status.AvailableReplicas = 1
+			ready, err := evaluate(dp, deploymentGK)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ready).To(BeFalse())
+		})
+		It("Should be ready with quorum N when N replicas are updated and available", func() {
+			dp.Status.AvailableReplicas = 1
+			ready, err := evaluateWithQuorum(dp, deploymentGK, mustParseQuorum("quorum:1"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ready).To(BeTrue())
+			dp.Status.UpdatedReplicas = 0
+			ready, err = evaluateWithQuorum(dp, deploymentGK, mustParseQuorum("any"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ready).To(BeFalse())
+		})
+		It("Should not be ready when latest generation was not observed", func() {
+			dp.SetGeneration(3)
+			ready, err := evaluate(dp, deploymentGK)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ready).To(BeFalse())
+		})
+	})
+
+	Context("Unified workload readiness", func() {
+		getReadiness := func(obj runtime.Object, kind string) WorkloadReadiness {
+			get, ok := workloadReadinessGetters[schema.GroupKind{Group: "apps", Kind: kind}]
+			Expect(ok).To(BeTrue())
+			readiness, err := get(toUnstructured(obj))
+			Expect(err).NotTo(HaveOccurred())
+			return readiness
+		}
+
+		It("Should compute the ready fraction of a DaemonSet from its ready pods", func() {
+			ds := &appsv1.DaemonSet{ObjectMeta: metav1.ObjectMeta{Name: "test-ds"}}
+			ds.Status = appsv1.DaemonSetStatus{DesiredNumberScheduled: 4, NumberReady: 3, NumberAvailable: 2}
+			readiness := getReadiness(ds, "DaemonSet")
+			Expect(readiness).To(Equal(WorkloadReadiness{Kind: "DaemonSet", Name: "test-ds", Ready: 3, Desired: 4}))
+			Expect(readiness.Fraction()).To(Equal(0.75))
+		})
+		It("Should compute the ready fraction of a Deployment from its available replicas", func() {
+			replicas := int32(2)
+			dp := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "test-dp"}}
+			dp.Spec.Replicas = &replicas
+			dp.Status = appsv1.DeploymentStatus{ReadyReplicas: 2, AvailableReplicas: 1}
+			readiness := getReadiness(dp, "Deployment")
+			Expect(readiness).To(Equal(WorkloadReadiness{Kind: "Deployment", Name: "test-dp", Ready: 1, Desired: 2}))
+			Expect(readiness.Fraction()).To(Equal(0.5))
+
+			dp.Spec.Replicas = nil
+			dp.Status.AvailableReplicas = 1
+			Expect(getReadiness(dp, "Deployment").Fraction()).To(Equal(1.0))
+		})
+		It("Should report a zero fraction when no pod is desired", func() {
+			ds := &appsv1.DaemonSet{ObjectMeta: metav1.ObjectMeta{Name: "test-ds"}}
+			Expect(getReadiness(ds, "DaemonSet").Fraction()).To(BeZero())
+		})
+	})
+
+	Context("Job", func() {
+		jobGK := schema.GroupKind{Group: "batch", Kind: "Job"}
+		var job *batchv1.Job
+
+		BeforeEach(func() {
+			job = &batchv1.Job{}
+			job.SetName("test-job")
+			job.SetNamespace("default")
+		})
+
+		It("Should be ready when job completed", func() {
+			job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+			ready, err := evaluate(job, jobGK)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ready).To(BeTrue())
+		})
+		It("Should not be ready when job is running", func() {
+			job.Status.Active = 1
+			ready, err := evaluate(job, jobGK)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ready).To(BeFalse())
+		})
+		It("Should return error when job failed", func() {
+			job.Status.Conditions = []batchv1.JobCondition{
+				{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Message: "BackoffLimitExceeded"}}
+			ready, err := evaluate(job, jobGK)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("default/test-job"))
+			Expect(ready).To(BeFalse())
+		})
+	})
+})
@@ -0,0 +1,173 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ReconcileReportSchemaVersion is the version of the schema of the reconcile report, it changes whenever a field is
+// renamed or removed
+const ReconcileReportSchemaVersion = "v1"
+
+// reconcileReportTimeout bounds the POST of a reconcile report to an endpoint
+const reconcileReportTimeout = 10 * time.Second
+
+// ReconcileReport is the machine readable report of a full reconcile of a custom resource
+type ReconcileReport struct {
+	SchemaVersion string `json:"schemaVersion"`
+	// Name of the reconciled custom resource
+	Name string `json:"name"`
+	// Status of the reconcile, the global status of the states
+	Status SyncState `json:"status"`
+	// StartTime of the reconcile, in RFC 3339 format
+	StartTime       time.Time `json:"startTime"`
+	DurationSeconds float64   `json:"durationSeconds"`
+	// States are the reports of the states sorted by name
+	States []StateReport `json:"states"`
+}
+
+// StateReport is the report of the Sync of a state in a reconcile report
+type StateReport struct {
+	Name   string    `json:"name"`
+	Status SyncState `json:"status"`
+	// Error of the Sync, if any
+	Error string `json:"error,omitempty"`
+	// AppliedObjects is the number of objects created or changed by the Sync
+	AppliedObjects int `json:"appliedObjects"`
+	// PrunedObjects is the number of objects deleted by the Sync as they are no longer rendered
+	PrunedObjects   int      `json:"prunedObjects"`
+	DurationSeconds float64  `json:"durationSeconds"`
+	Warnings        []string `json:"warnings,omitempty"`
+}
+
+type objectCountsKey struct{}
+
+// objectCounts counts the objects applied and pruned by the Sync of a state, objects may be applied concurrently
+type objectCounts struct {
+	applied int64
+	pruned  int64
+}
+
+// withObjectCounts returns a context counting the objects applied and pruned by the Sync of a state
+func withObjectCounts(ctx context.Context) (context.Context, *objectCounts) {
+	counts := &objectCounts{}
+	return context.WithValue(ctx, objectCountsKey{}, counts), counts
+}
+
+// countAppliedObject counts an object created or changed by the Sync of the state of the context
+func countAppliedObject(ctx context.Context) {
+	if counts, ok := ctx.Value(objectCountsKey{}).(*objectCounts); ok {
+		atomic.AddInt64(&counts.applied, 1)
+	}
+}
+
+// countPrunedObject counts an object deleted by the Sync of the state of the context
+func countPrunedObject(ctx context.Context) {
+	if counts, ok := ctx.Value(objectCountsKey{}).(*objectCounts); ok {
+		atomic.AddInt64(&counts.pruned, 1)
+	}
+}
+
+// NewReconcileReport returns the report of the reconcile of the custom resource name started at start, with the
+// results of the Sync of its states
+func NewReconcileReport(name string, start time.Time, results Results) *ReconcileReport {
+	report := &ReconcileReport{
+		SchemaVersion:   ReconcileReportSchemaVersion,
+		Name:            name,
+		Status:          results.Status,
+		StartTime:       start.UTC(),
+		DurationSeconds: time.Since(start).Seconds(),
+		States:          make([]StateReport, 0, len(results.StatesStatus)),
+	}
+	for i := range results.StatesStatus {
+		result := &results.StatesStatus[i]
+		stateReport := StateReport{
+			Name:            result.StateName,
+			Status:          result.Status,
+			AppliedObjects:  result.AppliedObjects,
+			PrunedObjects:   result.PrunedObjects,
+			DurationSeconds: result.Duration.Seconds(),
+			Warnings:        result.Warnings,
+		}
+		if result.ErrInfo != nil {
+			stateReport.Error = result.ErrInfo.Error()
+		}
+		report.States = append(report.States, stateReport)
+	}
+	sort.Slice(report.States, func(i, j int) bool { return report.States[i].Name < report.States[j].Name })
+	return report
+}
+
+// WriteReconcileReport writes the report as JSON to target, POSTed if target is an http or https URL, written to the
+// target file otherwise. The file is replaced atomically so readers never see a partial report.
+func WriteReconcileReport(ctx context.Context, target string, report *ReconcileReport) error {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode reconcile report")
+	}
+	if strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://") {
+		return postReconcileReport(ctx, target, data)
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(target), filepath.Base(target)+".tmp")
+	if err != nil {
+		return errors.Wrap(err, "failed to create reconcile report file")
+	}
+	// the temporary file is gone once renamed to target, its removal only cleans up after a failed write
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to write reconcile report file")
+	}
+	return errors.Wrap(os.Rename(tmp.Name(), target), "failed to replace reconcile report file")
+}
+
+// postReconcileReport POSTs the JSON encoded report to url
+func postReconcileReport(ctx context.Context, url string, data []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, reconcileReportTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return errors.Wrap(err, "failed to create reconcile report request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "failed to post reconcile report")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return errors.Errorf("failed to post reconcile report: %s", resp.Status)
+	}
+	return nil
+}
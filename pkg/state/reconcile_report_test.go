@@ -0,0 +1,169 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	mellanoxv1alpha1 "github.com/Mellanox/network-operator/api/v1alpha1"
+	"github.com/Mellanox/network-operator/pkg/consts"
+)
+
+var _ = Describe("Reconcile report tests", func() {
+	var (
+		k8sClient client.Client
+		cr        *mellanoxv1alpha1.NicClusterPolicy
+		dir       string
+	)
+
+	newConfigMap := func(name string) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{}
+		obj.SetAPIVersion("v1")
+		obj.SetKind("ConfigMap")
+		obj.SetNamespace("default")
+		obj.SetName(name)
+		return obj
+	}
+
+	BeforeEach(func() {
+		k8sClient = fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).Build()
+		cr = &mellanoxv1alpha1.NicClusterPolicy{}
+		cr.SetName(consts.NicClusterPolicyResourceName)
+		cr.SetUID("cr-uid")
+		var err error
+		dir, err = ioutil.TempDir("", "reconcile-report")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	It("Should report the objects applied by each state of a reconcile", func() {
+		clientProvider := NewStaticClientProvider(k8sClient)
+		manager := &stateManager{
+			stateGroups: []Group{
+				NewStateGroup([]State{&fakeRenderingState{
+					stateSkel: stateSkel{name: "second", clientProvider: clientProvider},
+					objs:      []*unstructured.Unstructured{newConfigMap("c")},
+				}}),
+				NewStateGroup([]State{&fakeRenderingState{
+					stateSkel: stateSkel{name: "first", clientProvider: clientProvider},
+					objs:      []*unstructured.Unstructured{newConfigMap("a"), newConfigMap("b")},
+				}}),
+			},
+			clientProvider: clientProvider,
+		}
+		ctx := WithSyncCache(context.Background(), NewSyncCache(), "watched")
+		target := filepath.Join(dir, "report.json")
+
+		start := time.Now()
+		results, err := manager.SyncState(ctx, cr, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(WriteReconcileReport(ctx, target, NewReconcileReport(cr.Name, start, results))).To(Succeed())
+
+		data, err := ioutil.ReadFile(target)
+		Expect(err).NotTo(HaveOccurred())
+		raw := make(map[string]interface{})
+		Expect(json.Unmarshal(data, &raw)).To(Succeed())
+		Expect(raw).To(HaveKeyWithValue("schemaVersion", ReconcileReportSchemaVersion))
+		Expect(raw).To(HaveKeyWithValue("name", consts.NicClusterPolicyResourceName))
+		Expect(raw).To(HaveKeyWithValue("status", SyncStateReady))
+		Expect(raw).To(HaveKey("startTime"))
+		Expect(raw).To(HaveKey("durationSeconds"))
+		Expect(raw["states"]).To(HaveLen(2))
+		Expect(raw["states"].([]interface{})[0]).To(And(
+			HaveKeyWithValue("name", "first"),
+			HaveKeyWithValue("status", SyncStateReady),
+			HaveKeyWithValue("appliedObjects", BeNumerically("==", 2)),
+			HaveKeyWithValue("prunedObjects", BeNumerically("==", 0)),
+			HaveKey("durationSeconds"),
+			Not(HaveKey("error")),
+		))
+
+		report := &ReconcileReport{}
+		Expect(json.Unmarshal(data, report)).To(Succeed())
+		Expect(report.States[0].Name).To(Equal("first"))
+		Expect(report.States[0].AppliedObjects).To(Equal(2))
+		Expect(report.States[1].Name).To(Equal("second"))
+		Expect(report.States[1].AppliedObjects).To(Equal(1))
+
+		// the states are skipped by the sync cache as nothing changed
+		results, err = manager.SyncState(ctx, cr, nil)
+		Expect(err).NotTo(HaveOccurred())
+		report = NewReconcileReport(cr.Name, time.Now(), results)
+		Expect(report.Status).To(Equal(SyncState(SyncStateReady)))
+		for _, stateReport := range report.States {
+			Expect(stateReport.AppliedObjects).To(BeZero())
+			Expect(stateReport.DurationSeconds).To(BeZero())
+		}
+	})
+
+	It("Should report the objects pruned by a state", func() {
+		stale := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+			Name:      "sriovdp-config-stale",
+			Namespace: consts.NetworkOperatorResourceNamespace,
+			Labels:    map[string]string{sriovDpNodePoolLabel: "stale"},
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(cr,
+				mellanoxv1alpha1.GroupVersion.WithKind("NicClusterPolicy"))},
+		}}
+		Expect(k8sClient.Create(context.Background(), stale)).To(Succeed())
+
+		ctx, counts := withObjectCounts(context.Background())
+		Expect(deleteStaleNodePools(ctx, k8sClient, cr, sriovDpNodePoolLabel, nil)).To(Succeed())
+		Expect(counts.pruned).To(Equal(int64(1)))
+		Expect(counts.applied).To(BeZero())
+	})
+
+	It("Should report the error of a state", func() {
+		syncErr := errors.New("failed to create/update objects")
+		results := Results{
+			Status: SyncStateNotReady,
+			StatesStatus: []Result{{
+				StateName: "failed",
+				Status:    SyncStateError,
+				ErrInfo:   syncErr,
+				Warnings:  []string{"warning"},
+				Duration:  time.Second,
+			}},
+		}
+		report := NewReconcileReport(cr.Name, time.Now(), results)
+		Expect(report.SchemaVersion).To(Equal(ReconcileReportSchemaVersion))
+		Expect(report.States).To(Equal([]StateReport{{
+			Name:            "failed",
+			Status:          SyncStateError,
+			Error:           syncErr.Error(),
+			DurationSeconds: 1,
+			Warnings:        []string{"warning"},
+		}}))
+	})
+})
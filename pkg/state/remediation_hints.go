@@ -0,0 +1,76 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"regexp"
+)
+
+// remediationHint maps a known failure signature to a suggested user action
+type remediationHint struct {
+	signature *regexp.Regexp
+	hint      string
+}
+
+// remediationHints is the list of known failure signatures, the first matching signature wins so more specific
+// signatures must precede generic ones. To add a new hint, append an entry to this list.
+var remediationHints = []remediationHint{
+	{
+		signature: regexp.MustCompile(`ImagePullBackOff|ErrImagePull`),
+		hint: "Failed to pull image, check that the image repository, name and version are correct and that " +
+			"imagePullSecrets grant access to the registry",
+	},
+	{
+		signature: regexp.MustCompile(`is stuck deleting`),
+		hint: "Object is Terminating, check that the controllers owning its finalizers are running or remove the " +
+			"finalizers, the operator recreates the object once it is deleted",
+	},
+	{
+		signature: regexp.MustCompile(`no matches for kind "NetworkAttachmentDefinition"`),
+		hint: "NetworkAttachmentDefinition CRD is missing, install Multus CNI or enable secondaryNetwork.multus " +
+			"in NicClusterPolicy",
+	},
+	{
+		signature: regexp.MustCompile(`no matches for kind`),
+		hint:      "CRD is missing, install the component which provides the resource kind",
+	},
+	{
+		signature: regexp.MustCompile(`failed to list nodes`),
+		hint: "Failed to list nodes, the operator retries automatically. If the failure persists, check the API " +
+			"server health and that the operator service account is allowed to list nodes",
+	},
+	{
+		signature: regexp.MustCompile(`mandatory node attribute does not exist|no eligible nodes`),
+		hint: "No eligible nodes found, check that Node Feature Discovery is deployed and that nodes with " +
+			"Mellanox NICs are labeled with feature.node.kubernetes.io/pci-15b3.present=true",
+	},
+}
+
+// GetRemediationHint returns a suggested action to resolve err, an empty string is returned if err is nil or
+// does not match any known failure signature
+func GetRemediationHint(err error) string {
+	if err == nil {
+		return ""
+	}
+	msg := err.Error()
+	for _, h := range remediationHints {
+		if h.signature.MatchString(msg) {
+			return h.hint
+		}
+	}
+	return ""
+}
@@ -0,0 +1,43 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var _ = Describe("Remediation hints tests", func() {
+	It("Should return hint for missing NetworkAttachmentDefinition CRD", func() {
+		err := errors.Wrap(&meta.NoKindMatchError{
+			GroupKind:        schema.GroupKind{Group: "k8s.cni.cncf.io", Kind: "NetworkAttachmentDefinition"},
+			SearchedVersions: []string{"v1"},
+		}, "failed to create/update objects")
+		Expect(GetRemediationHint(err)).To(ContainSubstring("install Multus CNI"))
+	})
+	It("Should return hint for image pull failures", func() {
+		err := errors.New("container mofed-container is waiting: ImagePullBackOff")
+		Expect(GetRemediationHint(err)).To(ContainSubstring("imagePullSecrets"))
+	})
+	It("Should return empty hint for unknown failures and nil error", func() {
+		Expect(GetRemediationHint(errors.New("unknown failure"))).To(BeEmpty())
+		Expect(GetRemediationHint(nil)).To(BeEmpty())
+	})
+})
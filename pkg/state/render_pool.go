@@ -0,0 +1,97 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"context"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/Mellanox/network-operator/pkg/render"
+)
+
+type renderWorkersKey struct{}
+
+// WithRenderWorkers returns a context rendering the node groups of the states, e.g the OFED driver of each OS
+// distribution and kernel, with up to workers concurrent renders. Node groups are rendered serially if the context
+// does not set workers or if workers is lower than 2.
+func WithRenderWorkers(ctx context.Context, workers int) context.Context {
+	return context.WithValue(ctx, renderWorkersKey{}, workers)
+}
+
+// getRenderWorkers returns the number of concurrent node group renders of the context
+func getRenderWorkers(ctx context.Context) int {
+	workers, ok := ctx.Value(renderWorkersKey{}).(int)
+	if !ok || workers < 1 {
+		return 1
+	}
+	return workers
+}
+
+// renderNodeGroups renders the objects of each node group with its render data in groups, with up to workers
+// concurrent renders. The objects are aggregated in the order of groups, and in the order of the manifests within a
+// group, so the output does not depend on the number of workers. An object rendered for several groups, e.g an object
+// shared by all the node groups, is only kept the first time it is rendered. The error of the first failing group is
+// returned.
+func renderNodeGroups(renderer render.Renderer, groups []interface{},
+	workers int) ([]*unstructured.Unstructured, error) {
+	results := make([][]*unstructured.Unstructured, len(groups))
+	errs := make([]error, len(groups))
+	if workers > len(groups) {
+		workers = len(groups)
+	}
+	if workers <= 1 {
+		for i := range groups {
+			results[i], errs[i] = renderer.RenderObjects(&render.TemplatingData{Data: groups[i]})
+		}
+	} else {
+		indexes := make(chan int)
+		var wg sync.WaitGroup
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range indexes {
+					results[i], errs[i] = renderer.RenderObjects(&render.TemplatingData{Data: groups[i]})
+				}
+			}()
+		}
+		for i := range groups {
+			indexes <- i
+		}
+		close(indexes)
+		wg.Wait()
+	}
+
+	objs := []*unstructured.Unstructured{}
+	seen := make(map[string]bool)
+	for i := range results {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		for _, obj := range results[i] {
+			key := obj.GroupVersionKind().GroupKind().String() + "/" + obj.GetNamespace() + "/" + obj.GetName()
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			objs = append(objs, obj)
+		}
+	}
+	return objs, nil
+}
@@ -0,0 +1,109 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"context"
+	"fmt"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	mellanoxv1alpha1 "github.com/Mellanox/network-operator/api/v1alpha1"
+	"github.com/Mellanox/network-operator/pkg/nodeinfo"
+	"github.com/Mellanox/network-operator/pkg/render"
+	"github.com/Mellanox/network-operator/pkg/testing/mocks"
+	"github.com/Mellanox/network-operator/pkg/utils"
+)
+
+var _ = Describe("Render pool tests", func() {
+	var (
+		ofedState stateOFED
+		cr        *mellanoxv1alpha1.NicClusterPolicy
+		nodeInfo  nodeinfo.Provider
+	)
+
+	BeforeEach(func() {
+		files, err := utils.GetFilesWithSuffix("../../manifests/stage-ofed-driver", render.ManifestFileSuffix...)
+		Expect(err).NotTo(HaveOccurred())
+		ofedState = stateOFED{stateSkel: stateSkel{
+			name:           stateOFEDName,
+			clientProvider: NewStaticClientProvider(&mocks.ControllerRutimeClient{}),
+			scheme:         runtime.NewScheme(),
+			renderer:       render.NewRenderer(files),
+		}}
+		cr = &mellanoxv1alpha1.NicClusterPolicy{}
+		cr.Spec.OFEDDriver = &mellanoxv1alpha1.OFEDDriverSpec{
+			ImageSpec: mellanoxv1alpha1.ImageSpec{Image: "mofed", Repository: "repository", Version: "5.5"},
+			ModuleParams: []mellanoxv1alpha1.KernelModuleParamsSpec{
+				{Module: "mlx5_core", Params: map[string]string{"prof_sel": "2"}},
+			},
+			PrecompiledKernels:          []mellanoxv1alpha1.KernelVersion{"5.4.0-42-generic", "5.15.0-1-generic"},
+			PrecompiledFallbackToSource: true,
+		}
+		var nodes []*corev1.Node
+		for i, osDist := range [][2]string{{"ubuntu", "20.04"}, {"rhel", "8.6"}, {"rhcos", "4.10"}, {"ubuntu", "22.04"}} {
+			for j, kernel := range []string{"5.4.0-42-generic", "5.15.0-1-generic", "5.19.0-1-generic"} {
+				name := fmt.Sprintf("node-%d-%d", i, j)
+				nodes = append(nodes, &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{
+					nodeinfo.NodeLabelMlnxNIC:       "true",
+					nodeinfo.NodeLabelHostname:      name,
+					nodeinfo.NodeLabelCPUArch:       "amd64",
+					nodeinfo.NodeLabelOSName:        osDist[0],
+					nodeinfo.NodeLabelOSVer:         osDist[1],
+					nodeinfo.NodeLabelKernelVerFull: kernel,
+				}}})
+			}
+		}
+		nodeInfo = nodeinfo.NewProvider(nodes)
+	})
+
+	It("Should render the node groups concurrently in the order they are rendered serially", func() {
+		ofedState.renderWorkers = getRenderWorkers(context.Background())
+		serial, err := ofedState.getManifestObjects(cr, nodeInfo)
+		Expect(err).NotTo(HaveOccurred())
+		// 3 drivers of each of the 4 OS distributions
+		Expect(serial).To(HaveLen(12 + 5))
+
+		for _, workers := range []int{2, 4, 32} {
+			ofedState.renderWorkers = getRenderWorkers(WithRenderWorkers(context.Background(), workers))
+			Expect(ofedState.renderWorkers).To(Equal(workers))
+			concurrent, err := ofedState.getManifestObjects(cr, nodeInfo)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(concurrent).To(Equal(serial), "workers: %d", workers)
+		}
+	})
+	It("Should keep the objects shared by the node groups once", func() {
+		objs, err := ofedState.getManifestObjects(cr, nodeInfo)
+		Expect(err).NotTo(HaveOccurred())
+		seen := make(map[string]bool)
+		for _, obj := range objs {
+			key := obj.GetKind() + "/" + obj.GetName()
+			Expect(seen).NotTo(HaveKey(key))
+			seen[key] = true
+		}
+		Expect(seen).To(HaveKey("ConfigMap/ofed-modprobe-config"))
+		Expect(seen).To(HaveKey("ServiceAccount/ofed-driver"))
+	})
+	It("Should render the node groups serially by default", func() {
+		Expect(getRenderWorkers(context.Background())).To(Equal(1))
+		Expect(getRenderWorkers(WithRenderWorkers(context.Background(), 0))).To(Equal(1))
+	})
+})
@@ -0,0 +1,50 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+type renderedObjectsKey struct{}
+
+// renderedObjects tracks which state applied an object during a single reconcile, keyed by object identity
+type renderedObjects map[string]string
+
+// withRenderedObjects returns a context which tracks the objects applied by states
+func withRenderedObjects(ctx context.Context) context.Context {
+	return context.WithValue(ctx, renderedObjectsKey{}, renderedObjects{})
+}
+
+// claimObject records that obj is applied by stateName. An error is returned if obj was already applied by
+// another state during the reconcile, as both states would otherwise keep overriding each other's changes.
+func claimObject(ctx context.Context, stateName string, obj *unstructured.Unstructured) error {
+	objects, ok := ctx.Value(renderedObjectsKey{}).(renderedObjects)
+	if !ok {
+		return nil
+	}
+	id := fmt.Sprintf("%s %s/%s", obj.GroupVersionKind().GroupKind().String(), obj.GetNamespace(), obj.GetName())
+	if owner, ok := objects[id]; ok && owner != stateName {
+		return errors.Errorf("conflict: %s is rendered by both %s and %s states", id, owner, stateName)
+	}
+	objects[id] = stateName
+	return nil
+}
@@ -0,0 +1,113 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// ResourceLimitsMode controls whether the containers rendered by the states must have resource limits
+type ResourceLimitsMode string
+
+const (
+	// ResourceLimitsModePermissive allows rendered containers without resource limits
+	ResourceLimitsModePermissive ResourceLimitsMode = "permissive"
+	// ResourceLimitsModeStrict fails the sync of states rendering a container without resource limits
+	ResourceLimitsModeStrict ResourceLimitsMode = "strict"
+)
+
+// podSpecPaths are the paths of the pod specs in the rendered objects
+var podSpecPaths = [][]string{
+	{"spec", "template", "spec"},
+	{"spec", "jobTemplate", "spec", "template", "spec"},
+}
+
+// ParseResourceLimitsMode parses a ResourceLimitsMode, an empty mode is permissive
+func ParseResourceLimitsMode(mode string) (ResourceLimitsMode, error) {
+	switch ResourceLimitsMode(mode) {
+	case "", ResourceLimitsModePermissive:
+		return ResourceLimitsModePermissive, nil
+	case ResourceLimitsModeStrict:
+		return ResourceLimitsModeStrict, nil
+	}
+	return "", errors.Errorf("invalid resource limits mode %q, expected %q or %q",
+		mode, ResourceLimitsModePermissive, ResourceLimitsModeStrict)
+}
+
+type resourceLimitsModeKey struct{}
+
+// WithResourceLimitsMode returns a context recording the resource limits mode the states are synced with, the mode
+// is permissive if the context does not record it
+func WithResourceLimitsMode(ctx context.Context, mode ResourceLimitsMode) context.Context {
+	return context.WithValue(ctx, resourceLimitsModeKey{}, mode)
+}
+
+// missingResourceLimitsError is returned when rendered containers lack resource limits in strict mode
+type missingResourceLimitsError struct {
+	containers []string
+}
+
+func (e *missingResourceLimitsError) Error() string {
+	return "containers without resource limits are not allowed: " + strings.Join(e.containers, ", ")
+}
+
+// isMissingResourceLimitsError checks if err is caused by rendered containers lacking resource limits
+func isMissingResourceLimitsError(err error) bool {
+	_, ok := errors.Cause(err).(*missingResourceLimitsError)
+	return ok
+}
+
+// checkResourceLimits returns an error if the context is in strict mode and a container, or an init container, of
+// objs has no resource limits
+func checkResourceLimits(ctx context.Context, objs []*unstructured.Unstructured) error {
+	if mode, _ := ctx.Value(resourceLimitsModeKey{}).(ResourceLimitsMode); mode != ResourceLimitsModeStrict {
+		return nil
+	}
+	var missing []string
+	for _, obj := range objs {
+		for _, path := range podSpecPaths {
+			podSpec, found, err := unstructured.NestedMap(obj.Object, path...)
+			if err != nil || !found {
+				continue
+			}
+			for _, field := range []string{"initContainers", "containers"} {
+				containers, _, _ := unstructured.NestedSlice(podSpec, field)
+				for _, c := range containers {
+					container, ok := c.(map[string]interface{})
+					if !ok {
+						continue
+					}
+					limits, _, _ := unstructured.NestedMap(container, "resources", "limits")
+					if len(limits) == 0 {
+						name, _, _ := unstructured.NestedString(container, "name")
+						missing = append(missing, fmt.Sprintf("%s %s/%s container %s",
+							obj.GetKind(), obj.GetNamespace(), obj.GetName(), name))
+					}
+				}
+			}
+		}
+	}
+	if len(missing) != 0 {
+		return &missingResourceLimitsError{containers: missing}
+	}
+	return nil
+}
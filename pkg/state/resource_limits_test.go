@@ -0,0 +1,82 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	appsv1 "k8s.io/api/apps/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Resource limits tests", func() {
+	var (
+		k8sClient client.Client
+		group     Group
+	)
+
+	BeforeEach(func() {
+		k8sClient = fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+		ds := &unstructured.Unstructured{}
+		ds.SetAPIVersion("apps/v1")
+		ds.SetKind("DaemonSet")
+		ds.SetNamespace("default")
+		ds.SetName("limitless")
+		Expect(unstructured.SetNestedSlice(ds.Object, []interface{}{
+			map[string]interface{}{"name": "main", "image": "image"},
+		}, "spec", "template", "spec", "containers")).To(Succeed())
+		group = NewStateGroup([]State{&fakeRenderingState{
+			stateSkel: stateSkel{name: "test", clientProvider: NewStaticClientProvider(k8sClient)},
+			objs:      []*unstructured.Unstructured{ds},
+		}})
+	})
+
+	getDaemonSet := func() error {
+		return k8sClient.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "limitless"},
+			&appsv1.DaemonSet{})
+	}
+
+	It("Should fail the sync of a container without limits in strict mode", func() {
+		results := group.Sync(WithResourceLimitsMode(context.Background(), ResourceLimitsModeStrict), nil, nil)
+		Expect(results).To(HaveLen(1))
+		Expect(results[0].Status).To(Equal(SyncState(SyncStateError)))
+		Expect(results[0].ErrInfo).To(MatchError(
+			"containers without resource limits are not allowed: DaemonSet default/limitless container main"))
+		Expect(k8serrors.IsNotFound(getDaemonSet())).To(BeTrue())
+	})
+	It("Should apply a container without limits in permissive mode", func() {
+		results := group.Sync(WithResourceLimitsMode(context.Background(), ResourceLimitsModePermissive), nil, nil)
+		Expect(results).To(HaveLen(1))
+		Expect(results[0].Status).To(Equal(SyncState(SyncStateReady)))
+		Expect(getDaemonSet()).To(Succeed())
+	})
+	It("Should parse the resource limits mode", func() {
+		mode, err := ParseResourceLimitsMode("")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(mode).To(Equal(ResourceLimitsModePermissive))
+		_, err = ParseResourceLimitsMode("enforcing")
+		Expect(err).To(HaveOccurred())
+	})
+})
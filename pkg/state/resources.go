@@ -0,0 +1,81 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"fmt"
+	"sort"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/Mellanox/network-operator/pkg/nodeinfo"
+)
+
+// stateWarnings tracks the warnings reported by the last Sync invocation of a state
+type stateWarnings struct {
+	warnings []string
+}
+
+// Warnings returns the warnings reported by the last Sync invocation
+func (w *stateWarnings) Warnings() []string {
+	return w.warnings
+}
+
+// getUnschedulableRequests returns a warning for each resource request which exceeds the allocatable resources
+// of all the eligible nodes, as pods with such requests would stay pending. Requests default to limits,
+// as they do for containers.
+func getUnschedulableRequests(resources *v1.ResourceRequirements, attrs []nodeinfo.NodeAttributes) []string {
+	if resources == nil || len(attrs) == 0 {
+		return nil
+	}
+	requests := v1.ResourceList{}
+	for name, quantity := range resources.Limits {
+		requests[name] = quantity
+	}
+	for name, quantity := range resources.Requests {
+		requests[name] = quantity
+	}
+
+	names := make([]string, 0, len(requests))
+	for name := range requests {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+
+	var warnings []string
+	for _, name := range names {
+		request := requests[v1.ResourceName(name)]
+		var maxAllocatable *resource.Quantity
+		for _, attr := range attrs {
+			allocatable, ok := attr.Allocatable[v1.ResourceName(name)]
+			if ok && (maxAllocatable == nil || allocatable.Cmp(*maxAllocatable) > 0) {
+				maxAllocatable = &allocatable
+			}
+		}
+		switch {
+		case maxAllocatable == nil:
+			warnings = append(warnings, fmt.Sprintf(
+				"requested %s %s is not allocatable on any eligible node", name, request.String()))
+		case request.Cmp(*maxAllocatable) > 0:
+			warnings = append(warnings, fmt.Sprintf(
+				"requested %s %s exceeds the maximum allocatable %s of eligible nodes",
+				name, request.String(), maxAllocatable.String()))
+		}
+	}
+	return warnings
+}
@@ -0,0 +1,48 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"context"
+	"strconv"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/Mellanox/network-operator/pkg/consts"
+)
+
+type sourceGenerationKey struct{}
+
+// withSourceGeneration returns a context recording the generation of the custom resource the states are synced for
+func withSourceGeneration(ctx context.Context, generation int64) context.Context {
+	return context.WithValue(ctx, sourceGenerationKey{}, generation)
+}
+
+// setSourceGeneration annotates obj with the generation of the custom resource it is rendered from, to correlate
+// an applied object with a revision of the custom resource. obj is left unchanged if the context does not record it.
+func setSourceGeneration(ctx context.Context, obj *unstructured.Unstructured) {
+	generation, ok := ctx.Value(sourceGenerationKey{}).(int64)
+	if !ok {
+		return
+	}
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[consts.SourceGenerationAnnotation] = strconv.FormatInt(generation, 10)
+	obj.SetAnnotations(annotations)
+}
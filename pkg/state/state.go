@@ -17,6 +17,9 @@ limitations under the License.
 package state
 
 import (
+	"context"
+	"time"
+
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/source"
 )
@@ -47,7 +50,56 @@ type State interface {
 	// a sync operation must be relatively short and must not block the execution thread.
 	// InfoCatalog is provided to optionally provide a State additional infoSources required for it to perform
 	// the Sync operation.
-	Sync(customResource interface{}, infoCatalog InfoCatalog) (SyncState, error)
+	Sync(ctx context.Context, customResource interface{}, infoCatalog InfoCatalog) (SyncState, error)
 	// Get a map of source kinds that should be watched for the state keyed by the source kind name
 	GetWatchSources() map[string]*source.Kind
 }
+
+// skippedNodesReporter is implemented by States which may skip nodes, SkippedNodes returns the nodes skipped by the
+// last Sync invocation
+type skippedNodesReporter interface {
+	SkippedNodes() []string
+}
+
+// warningsReporter is implemented by States which may report warnings that do not prevent the State from being
+// applied, Warnings returns the warnings reported by the last Sync invocation
+type warningsReporter interface {
+	Warnings() []string
+}
+
+// noEligibleNodesReporter is implemented by States which are deployed on the nodes matching a node filter,
+// NoEligibleNodesFilter returns the filter if it matched no nodes in the last Sync invocation
+type noEligibleNodesReporter interface {
+	NoEligibleNodesFilter() string
+}
+
+// nodeModesReporter is implemented by States which may be deployed in different modes on different nodes,
+// NodeModes returns the mode of each node keyed by node name in the last Sync invocation
+type nodeModesReporter interface {
+	NodeModes() map[string]string
+}
+
+// osGroupsReporter is implemented by States rendering a DaemonSet per OS distribution of their eligible nodes,
+// OSGroups returns the eligible nodes grouped by OS distribution in the last Sync invocation
+type osGroupsReporter interface {
+	OSGroups() []OSGroup
+}
+
+// resyncReporter is implemented by States which may need to be synced again after some time even if they are ready,
+// ResyncAfter returns the time reported by the last Sync invocation, zero if the State does not need to be
+type resyncReporter interface {
+	ResyncAfter() time.Duration
+}
+
+// workloadReadinessReporter is implemented by States checking the readiness of the workload objects they apply,
+// WorkloadReadiness returns the readiness of the workload objects checked by the last Sync invocation
+type workloadReadinessReporter interface {
+	WorkloadReadiness() []WorkloadReadiness
+	resetWorkloadReadiness()
+}
+
+// externalRenderDataConsumer is implemented by States rendering manifests with the external render data of the
+// info catalog, setExternalRenderData sets the data for the next Sync invocation
+type externalRenderDataConsumer interface {
+	setExternalRenderData(data ExternalRenderData)
+}
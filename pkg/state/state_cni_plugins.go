@@ -17,39 +17,38 @@ limitations under the License.
 package state
 
 import (
+	"context"
+
 	"github.com/pkg/errors"
 	appsv1 "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
-	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	mellanoxv1alpha1 "github.com/Mellanox/network-operator/api/v1alpha1"
 	"github.com/Mellanox/network-operator/pkg/consts"
 	"github.com/Mellanox/network-operator/pkg/render"
-	"github.com/Mellanox/network-operator/pkg/utils"
 )
 
 const stateCNIPluginsName = "stage-container-networking-plugins"
 const stateCNIPluginsDescription = "Container Networking CNI Plugins deployed in the cluster"
 
 // NewStateCNIPlugins creates a new state for secondary container networking CNI plugins
-func NewStateCNIPlugins(k8sAPIClient client.Client, scheme *runtime.Scheme, manifestDir string) (State, error) {
-	files, err := utils.GetFilesWithSuffix(manifestDir, render.ManifestFileSuffix...)
+func NewStateCNIPlugins(clientProvider ClientProvider, scheme *runtime.Scheme, manifestDir string) (State, error) {
+	renderer, manifestVersions, err := newManifestRenderers(manifestDir)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to get files from manifest dir")
+		return nil, err
 	}
-
-	renderer := render.NewRenderer(files)
 	return &stateCNIPlugins{
 		stateSkel: stateSkel{
-			name:        stateCNIPluginsName,
-			description: stateCNIPluginsDescription,
-			client:      k8sAPIClient,
-			scheme:      scheme,
-			renderer:    renderer,
+			name:             stateCNIPluginsName,
+			description:      stateCNIPluginsDescription,
+			clientProvider:   clientProvider,
+			scheme:           scheme,
+			renderer:         renderer,
+			manifestVersions: manifestVersions,
 		}}, nil
 }
 
@@ -66,7 +65,8 @@ type CNIPluginsManifestRenderData struct {
 // Sync attempt to get the system to match the desired state which State represent.
 // a sync operation must be relatively short and must not block the execution thread.
 //nolint:dupl
-func (s *stateCNIPlugins) Sync(customResource interface{}, infoCatalog InfoCatalog) (SyncState, error) {
+func (s *stateCNIPlugins) Sync(
+	ctx context.Context, customResource interface{}, infoCatalog InfoCatalog) (SyncState, error) {
 	cr := customResource.(*mellanoxv1alpha1.NicClusterPolicy)
 	log.V(consts.LogLevelInfo).Info(
 		"Sync Custom resource", "State:", s.name, "Name:", cr.Name, "Namespace:", cr.Namespace)
@@ -88,8 +88,13 @@ func (s *stateCNIPlugins) Sync(customResource interface{}, infoCatalog InfoCatal
 		return SyncStateNotReady, nil
 	}
 
+	k8sClient, err := s.getClient(cr)
+	if err != nil {
+		return SyncStateNotReady, err
+	}
+
 	// Create objects if they dont exist, Update objects if they do exist
-	err = s.createOrUpdateObjs(func(obj *unstructured.Unstructured) error {
+	err = s.createOrUpdateObjs(ctx, k8sClient, func(obj *unstructured.Unstructured) error {
 		if err := controllerutil.SetControllerReference(cr, obj, s.scheme); err != nil {
 			return errors.Wrap(err, "failed to set controller reference for object")
 		}
@@ -99,7 +104,7 @@ func (s *stateCNIPlugins) Sync(customResource interface{}, infoCatalog InfoCatal
 		return SyncStateNotReady, errors.Wrap(err, "failed to create/update objects")
 	}
 	// Check objects status
-	syncState, err := s.getSyncState(objs)
+	syncState, err := s.getSyncState(ctx, k8sClient, objs)
 	if err != nil {
 		return SyncStateNotReady, errors.Wrap(err, "failed to get sync state")
 	}
@@ -119,12 +124,18 @@ func (s *stateCNIPlugins) getManifestObjects(
 		CrSpec:       cr.Spec.SecondaryNetwork.CniPlugins,
 		NodeAffinity: cr.Spec.NodeAffinity,
 		RuntimeSpec: &runtimeSpec{
-			Namespace: consts.NetworkOperatorResourceNamespace,
+			Namespace:    consts.NetworkOperatorResourceNamespace,
+			FeatureGates: cr.Spec.FeatureGates,
+			External:     s.externalRenderData,
 		},
 	}
 	// render objects
 	log.V(consts.LogLevelDebug).Info("Rendering objects", "data:", renderData)
-	objs, err := s.renderer.RenderObjects(&render.TemplatingData{Data: renderData})
+	renderer, err := s.getRenderer(cr.Spec.SecondaryNetwork.CniPlugins.ManifestVersion)
+	if err != nil {
+		return nil, err
+	}
+	objs, err := renderer.RenderObjects(&render.TemplatingData{Data: renderData})
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to render objects")
 	}
@@ -17,17 +17,23 @@ limitations under the License.
 package state //nolint:dupl
 
 import (
+	"context"
+	"fmt"
 	"strings"
 
 	netattdefv1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
 	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	mellanoxv1alpha1 "github.com/Mellanox/network-operator/api/v1alpha1"
+	"github.com/Mellanox/network-operator/pkg/config"
 	"github.com/Mellanox/network-operator/pkg/consts"
 	"github.com/Mellanox/network-operator/pkg/render"
 	"github.com/Mellanox/network-operator/pkg/utils"
@@ -36,11 +42,14 @@ import (
 const (
 	stateHostDeviceNetworkName        = "state-host-device-network"
 	stateHostDeviceNetworkDescription = "Host Device net-attach-def CR deployed in cluster"
-	resourceNamePrefix                = "nvidia.com/"
+	// netAttDefResourceNameAnnotation is the annotation of a NetworkAttachmentDefinition with the resource name of
+	// the devices allocated to the pods attached to the network
+	netAttDefResourceNameAnnotation = "k8s.v1.cni.cncf.io/resourceName"
 )
 
 // NewStateHostDeviceNetwork creates a new state for HostDeviceNetwork CR
-func NewStateHostDeviceNetwork(k8sAPIClient client.Client, scheme *runtime.Scheme, manifestDir string) (State, error) {
+func NewStateHostDeviceNetwork(
+	clientProvider ClientProvider, scheme *runtime.Scheme, manifestDir string) (State, error) {
 	files, err := utils.GetFilesWithSuffix(manifestDir, render.ManifestFileSuffix...)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to get files from manifest dir")
@@ -49,16 +58,34 @@ func NewStateHostDeviceNetwork(k8sAPIClient client.Client, scheme *runtime.Schem
 	renderer := render.NewRenderer(files)
 	return &stateHostDeviceNetwork{
 		stateSkel: stateSkel{
-			name:        stateHostDeviceNetworkName,
-			description: stateHostDeviceNetworkDescription,
-			client:      k8sAPIClient,
-			scheme:      scheme,
-			renderer:    renderer,
-		}}, nil
+			name:           stateHostDeviceNetworkName,
+			description:    stateHostDeviceNetworkDescription,
+			clientProvider: clientProvider,
+			scheme:         scheme,
+			renderer:       renderer,
+		},
+		namespaceQuota: config.FromEnv().State.HostDeviceNetworkNamespaceQuota,
+		networkPolicy: getHostDeviceNetworkPolicy(config.FromEnv().State.HostDeviceNetworkPolicyEnabled,
+			config.FromEnv().State.HostDeviceNetworkPolicyNamespaces),
+		cniTypeStrict:     config.FromEnv().State.HostDeviceNetworkCNITypeStrict,
+		snapshotNamespace: config.FromEnv().State.HostDeviceNetworkConfigSnapshotNamespace,
+	}, nil
 }
 
 type stateHostDeviceNetwork struct {
 	stateSkel
+	stateWarnings
+	// namespaceQuota is the maximum number of NetworkAttachmentDefinitions created from HostDeviceNetworks
+	// per namespace, 0 is unlimited
+	namespaceQuota uint
+	// networkPolicy rendered in the namespaces of the NetworkAttachmentDefinitions, nil if not rendered
+	networkPolicy *hostDeviceNetworkPolicy
+	// cniTypeStrict fails the sync of HostDeviceNetworks whose CNI plugin type is not installed by the CNI plugins
+	// deployed by the NicClusterPolicy instead of reporting a warning
+	cniTypeStrict bool
+	// snapshotNamespace is the namespace of the ConfigMap snapshotting the last applied CNI configs, the snapshot is
+	// not written if empty
+	snapshotNamespace string
 }
 
 type HostDeviceManifestRenderData struct {
@@ -66,16 +93,29 @@ type HostDeviceManifestRenderData struct {
 	CrSpec                mellanoxv1alpha1.HostDeviceNetworkSpec
 	RuntimeSpec           *runtimeSpec
 	ResourceName          string
+	NetworkPolicy         *hostDeviceNetworkPolicy
 }
 
 // Sync attempt to get the system to match the desired state which State represent.
 // a sync operation must be relatively short and must not block the execution thread.
-func (s *stateHostDeviceNetwork) Sync(customResource interface{}, _ InfoCatalog) (SyncState, error) {
+func (s *stateHostDeviceNetwork) Sync(
+	ctx context.Context, customResource interface{}, infoCatalog InfoCatalog) (SyncState, error) {
 	cr := customResource.(*mellanoxv1alpha1.HostDeviceNetwork)
 	log.V(consts.LogLevelInfo).Info(
 		"Sync Custom resource", "State:", s.name, "Name:", cr.Name, "Namespace:", cr.Namespace)
+	s.warnings = nil
+
+	k8sClient, err := s.getClient(cr)
+	if err != nil {
+		return SyncStateNotReady, err
+	}
+
+	resourceNameSuffix, err := getNodePoolResourceNameSuffix(ctx, k8sClient, cr.Spec.NodePool)
+	if err != nil {
+		return SyncStateError, err
+	}
 
-	objs, err := s.getManifestObjects(cr)
+	objs, err := s.getManifestObjects(cr, resourceNameSuffix)
 	if err != nil {
 		return SyncStateError, errors.Wrap(err, "failed to render HostDeviceNetwork")
 	}
@@ -89,7 +129,41 @@ func (s *stateHostDeviceNetwork) Sync(customResource interface{}, _ InfoCatalog)
 		return SyncStateError, errors.Wrap(err, "no NetworkAttachmentDefinition object found")
 	}
 
-	err = s.createOrUpdateObjs(func(obj *unstructured.Unstructured) error {
+	if err := setNetAttDefVersion(ctx, k8sClient, netAttDef); err != nil {
+		return SyncStateNotReady, err
+	}
+
+	if err := s.checkNamespaceQuota(ctx, k8sClient, netAttDef); err != nil {
+		return SyncStateError, err
+	}
+
+	s.warnings, err = s.validateCNIConfig(ctx, k8sClient, netAttDef)
+	if err != nil {
+		return SyncStateError, err
+	}
+	for _, warning := range s.warnings {
+		log.V(consts.LogLevelWarning).Info("HostDeviceNetwork CNI config may be rejected", "reason:", warning)
+	}
+
+	if warning := s.getUnavailableVFsWarning(ctx, infoCatalog, netAttDef); warning != "" {
+		log.V(consts.LogLevelWarning).Info("HostDeviceNetwork can not be attached to pods", "reason:", warning)
+		s.warnings = append(s.warnings, warning)
+	}
+
+	objs, warning, err := s.claimNetworkPolicies(ctx, k8sClient, cr, objs)
+	if err != nil {
+		return SyncStateNotReady, err
+	}
+	if warning != "" {
+		log.V(consts.LogLevelWarning).Info("Skipping NetworkPolicies", "reason:", warning)
+		s.warnings = append(s.warnings, warning)
+	}
+
+	err = s.createOrUpdateObjs(ctx, k8sClient, func(obj *unstructured.Unstructured) error {
+		if obj.GetKind() == networkPolicyKind {
+			// NetworkPolicies are shared by the HostDeviceNetworks of a namespace, see claimNetworkPolicies
+			return nil
+		}
 		if err := controllerutil.SetControllerReference(cr, obj, s.scheme); err != nil {
 			return errors.Wrap(err, "failed to set controller reference for object")
 		}
@@ -101,13 +175,20 @@ func (s *stateHostDeviceNetwork) Sync(customResource interface{}, _ InfoCatalog)
 	}
 
 	// Check objects status
-	syncState, err := s.getSyncState(objs)
+	syncState, err := s.getSyncState(ctx, k8sClient, objs)
 	if err != nil {
 		return SyncStateNotReady, errors.Wrap(err, "failed to get sync state")
 	}
 
+	// the snapshot records the CNI config once it is applied
+	if s.snapshotNamespace != "" && syncState == SyncStateReady {
+		if err := updateCNIConfigSnapshot(ctx, k8sClient, s.snapshotNamespace, cr.Name, netAttDef); err != nil {
+			return SyncStateNotReady, err
+		}
+	}
+
 	// Get NetworkAttachmentDefinition SelfLink
-	if err := s.getObj(netAttDef); err != nil {
+	if err := s.getObj(k8sClient, netAttDef); err != nil {
 		return SyncStateError, errors.Wrap(err, "failed to get NetworkAttachmentDefinition")
 	}
 
@@ -122,12 +203,111 @@ func (s *stateHostDeviceNetwork) GetWatchSources() map[string]*source.Kind {
 	return wr
 }
 
-func (s *stateHostDeviceNetwork) getManifestObjects(
-	cr *mellanoxv1alpha1.HostDeviceNetwork) ([]*unstructured.Unstructured, error) {
-	resourceName := cr.Spec.ResourceName
-	if !strings.HasPrefix(resourceName, resourceNamePrefix) {
-		resourceName = resourceNamePrefix + resourceName
+// checkNamespaceQuota checks that creating netAttDef does not exceed the quota of NetworkAttachmentDefinitions
+// created from HostDeviceNetworks in its namespace. Usage is tracked by listing the operator owned
+// NetworkAttachmentDefinitions of the namespace, updating an existing one is always allowed.
+func (s *stateHostDeviceNetwork) checkNamespaceQuota(
+	ctx context.Context, c client.Client, netAttDef *unstructured.Unstructured) error {
+	if s.namespaceQuota == 0 {
+		return nil
+	}
+	netAttDefList := &unstructured.UnstructuredList{}
+	netAttDefList.SetGroupVersionKind(netAttDef.GroupVersionKind().GroupVersion().WithKind(
+		"NetworkAttachmentDefinitionList"))
+	err := c.List(ctx, netAttDefList, client.InNamespace(netAttDef.GetNamespace()),
+		client.MatchingLabels{consts.NetworkOperatorOwnedLabel: "true"})
+	if err != nil {
+		return errors.Wrap(err, "failed to list NetworkAttachmentDefinitions")
+	}
+
+	var used uint
+	for i := range netAttDefList.Items {
+		owner := metav1.GetControllerOf(&netAttDefList.Items[i])
+		if owner == nil || owner.Kind != mellanoxv1alpha1.HostDeviceNetworkCRDName {
+			continue
+		}
+		if netAttDefList.Items[i].GetName() == netAttDef.GetName() {
+			return nil
+		}
+		used++
+	}
+	if used >= s.namespaceQuota {
+		return errors.Errorf("HostDeviceNetwork quota exceeded: namespace %s already has %d of %d allowed "+
+			"NetworkAttachmentDefinitions", netAttDef.GetNamespace(), used, s.namespaceQuota)
+	}
+	return nil
+}
+
+// validateCNIConfig checks the CNI config of netAttDef against the capabilities of the CNI plugins version deployed
+// by the NicClusterPolicy, a warning is returned for each key not supported by the deployed version and for each
+// plugin type whose binary is not installed by the deployed version. Unavailable plugin types are returned as an error
+// instead if the state is strict about CNI types.
+func (s *stateHostDeviceNetwork) validateCNIConfig(
+	ctx context.Context, c client.Client, netAttDef *unstructured.Unstructured) ([]string, error) {
+	pluginsVersion := getCNIPluginsVersion(ctx, c)
+	if pluginsVersion == "" {
+		return nil, nil
+	}
+	cniConfig, _, err := unstructured.NestedString(netAttDef.Object, "spec", "config")
+	if err != nil {
+		return []string{fmt.Sprintf("failed to get CNI config: %v", err)}, nil
+	}
+	warnings := getUnsupportedCNIConfigKeys(cniConfig, pluginsVersion, hostDeviceConfigKeys)
+	unavailable := getUnavailableCNITypes(cniConfig, pluginsVersion)
+	if len(unavailable) != 0 && s.cniTypeStrict {
+		return nil, errors.Errorf("unavailable CNI plugin: %s", strings.Join(unavailable, ", "))
+	}
+	return append(warnings, unavailable...), nil
+}
+
+// getUnavailableVFsWarning returns a warning if no node has allocatable devices of the resource referenced by
+// netAttDef, as pods attached to the network would stay pending. The nodes are not checked if infoCatalog does not
+// provide node information.
+func (s *stateHostDeviceNetwork) getUnavailableVFsWarning(
+	ctx context.Context, infoCatalog InfoCatalog, netAttDef *unstructured.Unstructured) string {
+	if infoCatalog == nil {
+		return ""
+	}
+	nodeInfo, err := s.getNodeInfo(ctx, infoCatalog)
+	if err != nil {
+		log.V(consts.LogLevelWarning).Info("Skipping VFs availability check", "reason:", err.Error())
+		return ""
+	}
+	resourceName := netAttDef.GetAnnotations()[netAttDefResourceNameAnnotation]
+	for _, attrs := range nodeInfo.GetNodesAttributes() {
+		if allocatable, ok := attrs.Allocatable[corev1.ResourceName(resourceName)]; ok && !allocatable.IsZero() {
+			return ""
+		}
+	}
+	return fmt.Sprintf("no VFs of resource %s are available on any node", resourceName)
+}
+
+// getNodePoolResourceNameSuffix returns the resource name suffix of the SR-IOV device plugin node pool of the
+// NicClusterPolicy named nodePool, an empty string is returned if nodePool is empty
+func getNodePoolResourceNameSuffix(ctx context.Context, c client.Client, nodePool string) (string, error) {
+	if nodePool == "" {
+		return "", nil
+	}
+	cr := &mellanoxv1alpha1.NicClusterPolicy{}
+	if err := c.Get(ctx, types.NamespacedName{Name: consts.NicClusterPolicyResourceName}, cr); err != nil {
+		return "", errors.Wrapf(err, "failed to get NicClusterPolicy of node pool %s", nodePool)
+	}
+	if cr.Spec.SriovDevicePlugin != nil {
+		for _, pool := range cr.Spec.SriovDevicePlugin.NodePools {
+			if pool.Name == nodePool {
+				return pool.ResourceNameSuffix, nil
+			}
+		}
 	}
+	return "", errors.Errorf("node pool %s is not a node pool of the SR-IOV device plugin", nodePool)
+}
+
+// getManifestObjects renders the objects of cr, resourceNameSuffix is appended to the resource name of cr
+func (s *stateHostDeviceNetwork) getManifestObjects(
+	cr *mellanoxv1alpha1.HostDeviceNetwork, resourceNameSuffix string) ([]*unstructured.Unstructured, error) {
+	// Resources admitted while the defaulting webhook was not reachable are defaulted on render
+	cr = cr.DeepCopy()
+	cr.Default()
 
 	renderData := &HostDeviceManifestRenderData{
 		HostDeviceNetworkName: cr.Name,
@@ -135,7 +315,8 @@ func (s *stateHostDeviceNetwork) getManifestObjects(
 		RuntimeSpec: &runtimeSpec{
 			Namespace: consts.NetworkOperatorResourceNamespace,
 		},
-		ResourceName: resourceName,
+		ResourceName:  cr.Spec.ResourceName + resourceNameSuffix,
+		NetworkPolicy: s.networkPolicy,
 	}
 
 	// render objects
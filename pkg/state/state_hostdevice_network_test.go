@@ -17,15 +17,31 @@ limitations under the License.
 package state
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
 	"strings"
 
+	netattdefv1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 
 	mellanoxv1alpha1 "github.com/Mellanox/network-operator/api/v1alpha1"
+	"github.com/Mellanox/network-operator/pkg/consts"
+	"github.com/Mellanox/network-operator/pkg/nodeinfo"
 	"github.com/Mellanox/network-operator/pkg/render"
 	"github.com/Mellanox/network-operator/pkg/testing/mocks"
 	"github.com/Mellanox/network-operator/pkg/utils"
@@ -35,8 +51,8 @@ func checkResourceNameAnnotation(obj *unstructured.Unstructured) {
 	annotations := obj.Object["metadata"].(map[string]interface{})["annotations"].(map[string]interface{})
 	resourceName := annotations["k8s.v1.cni.cncf.io/resourceName"].(string)
 
-	Expect(HavePrefix(resourceName, resourceNamePrefix))
-	Expect(strings.Count(resourceName, resourceNamePrefix)).To(Equal(1))
+	Expect(HavePrefix(resourceName, mellanoxv1alpha1.HostDeviceNetworkResourceNamePrefix))
+	Expect(strings.Count(resourceName, mellanoxv1alpha1.HostDeviceNetworkResourceNamePrefix)).To(Equal(1))
 }
 
 func checkRenderedNetAttachDef(obj *unstructured.Unstructured, namespace, name, ipam string) {
@@ -62,11 +78,11 @@ var _ = Describe("HostDevice Network Stage rendering tests", func() {
 			stateName := "state-host-device-network"
 			sriovDpState := stateHostDeviceNetwork{
 				stateSkel: stateSkel{
-					name:        stateName,
-					description: "Host Device net-attach-def CR deployed in cluster",
-					client:      &client,
-					scheme:      scheme,
-					renderer:    renderer,
+					name:           stateName,
+					description:    "Host Device net-attach-def CR deployed in cluster",
+					clientProvider: NewStaticClientProvider(&client),
+					scheme:         scheme,
+					renderer:       renderer,
 				},
 			}
 
@@ -84,7 +100,7 @@ var _ = Describe("HostDevice Network Stage rendering tests", func() {
 			cr := &mellanoxv1alpha1.HostDeviceNetwork{}
 			cr.Name = name
 			cr.Spec = *spec
-			objs, err := sriovDpState.getManifestObjects(cr)
+			objs, err := sriovDpState.getManifestObjects(cr, "")
 
 			Expect(err).NotTo(HaveOccurred())
 			Expect(len(objs)).To(Equal(1))
@@ -92,11 +108,538 @@ var _ = Describe("HostDevice Network Stage rendering tests", func() {
 			checkRenderedNetAttachDef(objs[0], namespace, name, ipam)
 			checkResourceNameAnnotation(objs[0])
 
-			spec.ResourceName = resourceNamePrefix + "test_resource_with_prefix"
-			objs, err = sriovDpState.getManifestObjects(cr)
+			spec.ResourceName = mellanoxv1alpha1.HostDeviceNetworkResourceNamePrefix + "test_resource_with_prefix"
+			objs, err = sriovDpState.getManifestObjects(cr, "")
 
 			Expect(err).NotTo(HaveOccurred())
 			checkResourceNameAnnotation(objs[0])
 		})
 	})
+
+	Context("Namespace quota", func() {
+		const namespace = "tenant"
+		var (
+			scheme  *runtime.Scheme
+			objects []client.Object
+		)
+
+		newOwnedNetAttDef := func(name, ownerKind string) *netattdefv1.NetworkAttachmentDefinition {
+			isController := true
+			return &netattdefv1.NetworkAttachmentDefinition{ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: namespace,
+				Labels:    map[string]string{consts.NetworkOperatorOwnedLabel: "true"},
+				OwnerReferences: []metav1.OwnerReference{{
+					APIVersion: mellanoxv1alpha1.GroupVersion.String(),
+					Kind:       ownerKind,
+					Name:       name,
+					UID:        types.UID("uid-" + ownerKind + "-" + name),
+					Controller: &isController,
+				}},
+			}}
+		}
+		syncWithQuota := func(name string, quota uint) (SyncState, error) {
+			files, err := utils.GetFilesWithSuffix("../../manifests/stage-hostdevice-network", render.ManifestFileSuffix...)
+			Expect(err).NotTo(HaveOccurred())
+			k8sClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build()
+			hostDeviceNetworkState := stateHostDeviceNetwork{
+				stateSkel: stateSkel{
+					name:           "state-host-device-network",
+					description:    "Host Device net-attach-def CR deployed in cluster",
+					clientProvider: NewStaticClientProvider(k8sClient),
+					scheme:         scheme,
+					renderer:       render.NewRenderer(files),
+				},
+				namespaceQuota: quota,
+			}
+			cr := &mellanoxv1alpha1.HostDeviceNetwork{}
+			cr.Name = name
+			cr.UID = types.UID("uid-" + name)
+			cr.Spec.NetworkNamespace = namespace
+			cr.Spec.ResourceName = "hostdev"
+			return hostDeviceNetworkState.Sync(context.Background(), cr, nil)
+		}
+
+		BeforeEach(func() {
+			scheme = runtime.NewScheme()
+			Expect(mellanoxv1alpha1.AddToScheme(scheme)).To(Succeed())
+			Expect(netattdefv1.AddToScheme(scheme)).To(Succeed())
+			objects = []client.Object{
+				newOwnedNetAttDef("first", mellanoxv1alpha1.HostDeviceNetworkCRDName),
+				newOwnedNetAttDef("second", mellanoxv1alpha1.HostDeviceNetworkCRDName),
+				newOwnedNetAttDef("macvlan", mellanoxv1alpha1.MacvlanNetworkCRDName),
+			}
+		})
+
+		It("Should create NetworkAttachmentDefinition within the quota", func() {
+			syncState, err := syncWithQuota("third", 3)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(syncState).To(Equal(SyncState(SyncStateReady)))
+		})
+		It("Should reject NetworkAttachmentDefinition exceeding the quota", func() {
+			syncState, err := syncWithQuota("third", 2)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("HostDeviceNetwork quota exceeded: namespace tenant already has 2 of 2 " +
+				"allowed NetworkAttachmentDefinitions"))
+			Expect(syncState).To(Equal(SyncState(SyncStateError)))
+		})
+		It("Should update existing NetworkAttachmentDefinition when quota is reached", func() {
+			syncState, err := syncWithQuota("second", 1)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(syncState).To(Equal(SyncState(SyncStateReady)))
+		})
+		It("Should not enforce quota when unset", func() {
+			syncState, err := syncWithQuota("third", 0)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(syncState).To(Equal(SyncState(SyncStateReady)))
+		})
+	})
+
+	Context("CNI config validation", func() {
+		syncWithCNIPluginsVersion := func(pluginsVersion string) *stateHostDeviceNetwork {
+			scheme := runtime.NewScheme()
+			Expect(mellanoxv1alpha1.AddToScheme(scheme)).To(Succeed())
+			Expect(netattdefv1.AddToScheme(scheme)).To(Succeed())
+			ncp := &mellanoxv1alpha1.NicClusterPolicy{}
+			ncp.Name = consts.NicClusterPolicyResourceName
+			ncp.Spec.SecondaryNetwork = &mellanoxv1alpha1.SecondaryNetworkSpec{
+				CniPlugins: &mellanoxv1alpha1.ImageSpec{Image: "plugins", Repository: "repo", Version: pluginsVersion},
+			}
+			files, err := utils.GetFilesWithSuffix("../../manifests/stage-hostdevice-network", render.ManifestFileSuffix...)
+			Expect(err).NotTo(HaveOccurred())
+			hostDeviceNetworkState := &stateHostDeviceNetwork{
+				stateSkel: stateSkel{
+					name:           "state-host-device-network",
+					description:    "Host Device net-attach-def CR deployed in cluster",
+					clientProvider: NewStaticClientProvider(fake.NewClientBuilder().WithScheme(scheme).WithObjects(ncp).Build()),
+					scheme:         scheme,
+					renderer:       render.NewRenderer(files),
+				},
+			}
+			cr := &mellanoxv1alpha1.HostDeviceNetwork{}
+			cr.Name = "hostdev-net"
+			cr.Spec.NetworkNamespace = "default"
+			cr.Spec.ResourceName = "hostdev"
+			cr.Spec.IPAM = `{"type":"whereabouts"}`
+			syncState, err := hostDeviceNetworkState.Sync(context.Background(), cr, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(syncState).To(Equal(SyncState(SyncStateReady)))
+			return hostDeviceNetworkState
+		}
+
+		It("Should not report warnings for a supported CNI plugins version", func() {
+			Expect(syncWithCNIPluginsVersion("v0.8.7-amd64").Warnings()).To(BeEmpty())
+		})
+		It("Should report warnings for CNI config keys not supported by an older CNI plugins version", func() {
+			Expect(syncWithCNIPluginsVersion("v0.6.0").Warnings()).To(ContainElement(
+				`CNI config key "ipam" requires CNI plugins 0.7.0 or newer, installed version is v0.6.0`))
+		})
+		It("Should flag a CNI config key not supported by an older CNI plugins version", func() {
+			cniConfig := `{"cniVersion":"0.3.1","name":"net","type":"host-device","runtimeConfig":{}}`
+			Expect(getUnsupportedCNIConfigKeys(cniConfig, "v0.8.5", hostDeviceConfigKeys)).To(Equal([]string{
+				`CNI config key "runtimeConfig" requires CNI plugins 0.8.6 or newer, installed version is v0.8.5`}))
+			Expect(getUnsupportedCNIConfigKeys(cniConfig, "v0.8.6", hostDeviceConfigKeys)).To(BeEmpty())
+		})
+		It("Should flag a CNI config key unknown to the CNI plugin", func() {
+			cniConfig := `{"cniVersion":"0.3.1","name":"net","type":"host-device","vlan":100}`
+			Expect(getUnsupportedCNIConfigKeys(cniConfig, "v0.8.7", hostDeviceConfigKeys)).To(Equal([]string{
+				`CNI config key "vlan" is not supported by CNI plugins v0.8.7`}))
+		})
+		It("Should not validate CNI config if the CNI plugins version can not be parsed", func() {
+			Expect(getUnsupportedCNIConfigKeys(`{"vlan":100}`, "latest", hostDeviceConfigKeys)).To(BeNil())
+		})
+		It("Should flag a CNI type whose binary is not installed by the CNI plugins", func() {
+			Expect(getUnavailableCNITypes(`{"type":"host-device"}`, "v0.8.7")).To(BeEmpty())
+			Expect(getUnavailableCNITypes(`{"type":"sriov"}`, "v0.8.7")).To(Equal([]string{
+				`CNI type "sriov" is not provided by CNI plugins v0.8.7`}))
+			Expect(getUnavailableCNITypes(`{"plugins":[{"type":"host-device"},{"type":"vrf"}]}`, "v0.8.7")).To(Equal(
+				[]string{`CNI type "vrf" requires CNI plugins 0.9.0 or newer, installed version is v0.8.7`}))
+			Expect(getUnavailableCNITypes(`{"type":"sriov"}`, "latest")).To(Equal([]string{
+				`CNI type "sriov" is not provided by CNI plugins latest`}))
+		})
+		It("Should fail the sync on an unavailable CNI type in strict mode", func() {
+			scheme := runtime.NewScheme()
+			Expect(mellanoxv1alpha1.AddToScheme(scheme)).To(Succeed())
+			ncp := &mellanoxv1alpha1.NicClusterPolicy{}
+			ncp.Name = consts.NicClusterPolicyResourceName
+			ncp.Spec.SecondaryNetwork = &mellanoxv1alpha1.SecondaryNetworkSpec{
+				CniPlugins: &mellanoxv1alpha1.ImageSpec{Image: "plugins", Repository: "repo", Version: "v0.6.0"},
+			}
+			c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(ncp).Build()
+			netAttDef := &unstructured.Unstructured{Object: map[string]interface{}{
+				"spec": map[string]interface{}{"config": `{"cniVersion":"0.3.1","name":"net","type":"host-device"}`},
+			}}
+
+			hostDeviceNetworkState := &stateHostDeviceNetwork{}
+			warnings, err := hostDeviceNetworkState.validateCNIConfig(context.Background(), c, netAttDef)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(warnings).To(ContainElement(
+				`CNI type "host-device" requires CNI plugins 0.7.0 or newer, installed version is v0.6.0`))
+
+			hostDeviceNetworkState.cniTypeStrict = true
+			_, err = hostDeviceNetworkState.validateCNIConfig(context.Background(), c, netAttDef)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("Available VFs", func() {
+		var hostDeviceNetworkState *stateHostDeviceNetwork
+
+		syncWithAllocatable := func(allocatable ...string) []string {
+			nodes := make([]*corev1.Node, 0, len(allocatable))
+			for i, quantity := range allocatable {
+				node := &corev1.Node{}
+				node.Name = fmt.Sprintf("node%d", i+1)
+				node.Status.Allocatable = corev1.ResourceList{"nvidia.com/hostdev": resource.MustParse(quantity)}
+				nodes = append(nodes, node)
+			}
+			catalog := NewInfoCatalog()
+			catalog.Add(InfoTypeNodeInfo, nodeinfo.NewProvider(nodes))
+			cr := &mellanoxv1alpha1.HostDeviceNetwork{}
+			cr.Name = "hostdev-net"
+			cr.Spec.NetworkNamespace = "default"
+			cr.Spec.ResourceName = "hostdev"
+			syncState, err := hostDeviceNetworkState.Sync(context.Background(), cr, catalog)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(syncState).To(Equal(SyncState(SyncStateReady)))
+			return hostDeviceNetworkState.Warnings()
+		}
+
+		BeforeEach(func() {
+			scheme := runtime.NewScheme()
+			Expect(mellanoxv1alpha1.AddToScheme(scheme)).To(Succeed())
+			Expect(netattdefv1.AddToScheme(scheme)).To(Succeed())
+			files, err := utils.GetFilesWithSuffix("../../manifests/stage-hostdevice-network", render.ManifestFileSuffix...)
+			Expect(err).NotTo(HaveOccurred())
+			hostDeviceNetworkState = &stateHostDeviceNetwork{
+				stateSkel: stateSkel{
+					name:           "state-host-device-network",
+					description:    "Host Device net-attach-def CR deployed in cluster",
+					clientProvider: NewStaticClientProvider(fake.NewClientBuilder().WithScheme(scheme).Build()),
+					scheme:         scheme,
+					renderer:       render.NewRenderer(files),
+				},
+			}
+		})
+
+		It("Should warn if no node has VFs of the referenced resource", func() {
+			Expect(syncWithAllocatable("0", "0")).To(ConsistOf(
+				"no VFs of resource nvidia.com/hostdev are available on any node"))
+			Expect(syncWithAllocatable()).To(ConsistOf(
+				"no VFs of resource nvidia.com/hostdev are available on any node"))
+		})
+		It("Should not warn if a node has VFs of the referenced resource", func() {
+			Expect(syncWithAllocatable("0", "4")).To(BeEmpty())
+		})
+		It("Should clear the warning once VFs are available", func() {
+			Expect(syncWithAllocatable("0")).NotTo(BeEmpty())
+			Expect(syncWithAllocatable("2")).To(BeEmpty())
+		})
+		It("Should not check the VFs without node information", func() {
+			cr := &mellanoxv1alpha1.HostDeviceNetwork{}
+			cr.Name = "hostdev-net"
+			cr.Spec.NetworkNamespace = "default"
+			cr.Spec.ResourceName = "hostdev"
+			_, err := hostDeviceNetworkState.Sync(context.Background(), cr, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(hostDeviceNetworkState.Warnings()).To(BeEmpty())
+		})
+	})
+
+	Context("CNI config drift", func() {
+		var (
+			k8sClient              client.Client
+			hostDeviceNetworkState *stateHostDeviceNetwork
+			cr                     *mellanoxv1alpha1.HostDeviceNetwork
+			recorder               *record.FakeRecorder
+			ctx                    context.Context
+		)
+
+		getConfig := func() string {
+			netAttDef := &netattdefv1.NetworkAttachmentDefinition{}
+			Expect(k8sClient.Get(context.Background(),
+				types.NamespacedName{Namespace: "default", Name: cr.Name}, netAttDef)).To(Succeed())
+			return netAttDef.Spec.Config
+		}
+		getEvents := func() []string {
+			var events []string
+			for len(recorder.Events) > 0 {
+				events = append(events, <-recorder.Events)
+			}
+			return events
+		}
+		setConfig := func(config string) {
+			netAttDef := &netattdefv1.NetworkAttachmentDefinition{}
+			Expect(k8sClient.Get(context.Background(),
+				types.NamespacedName{Namespace: "default", Name: cr.Name}, netAttDef)).To(Succeed())
+			netAttDef.Spec.Config = config
+			Expect(k8sClient.Update(context.Background(), netAttDef)).To(Succeed())
+		}
+
+		BeforeEach(func() {
+			scheme := runtime.NewScheme()
+			Expect(mellanoxv1alpha1.AddToScheme(scheme)).To(Succeed())
+			Expect(netattdefv1.AddToScheme(scheme)).To(Succeed())
+			k8sClient = fake.NewClientBuilder().WithScheme(scheme).Build()
+			files, err := utils.GetFilesWithSuffix("../../manifests/stage-hostdevice-network", render.ManifestFileSuffix...)
+			Expect(err).NotTo(HaveOccurred())
+			hostDeviceNetworkState = &stateHostDeviceNetwork{
+				stateSkel: stateSkel{
+					name:           "state-host-device-network",
+					description:    "Host Device net-attach-def CR deployed in cluster",
+					clientProvider: NewStaticClientProvider(k8sClient),
+					scheme:         scheme,
+					renderer:       render.NewRenderer(files),
+				},
+			}
+			cr = &mellanoxv1alpha1.HostDeviceNetwork{}
+			cr.Name = "hostdev-net"
+			cr.Spec.NetworkNamespace = "default"
+			cr.Spec.ResourceName = "hostdev"
+			cr.Spec.IPAM = `{"type":"whereabouts"}`
+			recorder = record.NewFakeRecorder(10)
+			ctx = WithEventRecorder(context.Background(), recorder)
+
+			_, err = hostDeviceNetworkState.Sync(ctx, cr, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(getEvents()).To(ConsistOf(ContainSubstring(EventReasonObjectApplied)))
+		})
+
+		It("Should overwrite a drifted CNI config and record a Warning Event", func() {
+			rendered := getConfig()
+			setConfig(strings.Replace(rendered, `"hostdev-net"`, `"edited-net"`, 1))
+
+			_, err := hostDeviceNetworkState.Sync(ctx, cr, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(getConfig()).To(Equal(rendered))
+			Expect(getEvents()).To(ContainElement(And(
+				HavePrefix(corev1.EventTypeWarning), ContainSubstring(EventReasonConfigDriftOverwritten))))
+		})
+		It("Should keep a CNI config which only differs in formatting", func() {
+			var config map[string]interface{}
+			Expect(json.Unmarshal([]byte(getConfig()), &config)).To(Succeed())
+			reformatted, err := json.MarshalIndent(config, "", "    ")
+			Expect(err).NotTo(HaveOccurred())
+			setConfig(string(reformatted))
+
+			_, err = hostDeviceNetworkState.Sync(ctx, cr, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(getConfig()).To(Equal(string(reformatted)))
+			Expect(getEvents()).NotTo(ContainElement(ContainSubstring(EventReasonConfigDriftOverwritten)))
+		})
+	})
+
+	Context("CNI config snapshot", func() {
+		const snapshotNamespace = "nvidia-network-operator"
+		var (
+			k8sClient              client.Client
+			hostDeviceNetworkState *stateHostDeviceNetwork
+		)
+
+		sync := func(name, ipam string) string {
+			cr := &mellanoxv1alpha1.HostDeviceNetwork{}
+			cr.Name = name
+			cr.UID = types.UID("uid-" + name)
+			cr.Spec.NetworkNamespace = "default"
+			cr.Spec.ResourceName = "hostdev"
+			cr.Spec.IPAM = ipam
+			_, err := hostDeviceNetworkState.Sync(context.Background(), cr, nil)
+			Expect(err).NotTo(HaveOccurred())
+			netAttDef := &netattdefv1.NetworkAttachmentDefinition{}
+			Expect(k8sClient.Get(context.Background(),
+				types.NamespacedName{Namespace: "default", Name: name}, netAttDef)).To(Succeed())
+			return netAttDef.Spec.Config
+		}
+		getSnapshot := func() map[string]string {
+			cm := &corev1.ConfigMap{}
+			Expect(k8sClient.Get(context.Background(), types.NamespacedName{
+				Namespace: snapshotNamespace, Name: HostDeviceNetworkConfigSnapshotName}, cm)).To(Succeed())
+			return cm.Data
+		}
+
+		BeforeEach(func() {
+			scheme := runtime.NewScheme()
+			Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+			Expect(mellanoxv1alpha1.AddToScheme(scheme)).To(Succeed())
+			Expect(netattdefv1.AddToScheme(scheme)).To(Succeed())
+			k8sClient = fake.NewClientBuilder().WithScheme(scheme).Build()
+			files, err := utils.GetFilesWithSuffix("../../manifests/stage-hostdevice-network", render.ManifestFileSuffix...)
+			Expect(err).NotTo(HaveOccurred())
+			hostDeviceNetworkState = &stateHostDeviceNetwork{
+				stateSkel: stateSkel{
+					name:           "state-host-device-network",
+					description:    "Host Device net-attach-def CR deployed in cluster",
+					clientProvider: NewStaticClientProvider(k8sClient),
+					scheme:         scheme,
+					renderer:       render.NewRenderer(files),
+				},
+				snapshotNamespace: snapshotNamespace,
+			}
+		})
+
+		It("Should snapshot the last applied CNI config of each HostDeviceNetwork", func() {
+			first := sync("first", `{"type":"whereabouts","range":"192.168.2.0/24"}`)
+			second := sync("second", `{"type":"whereabouts","range":"192.168.3.0/24"}`)
+			Expect(getSnapshot()).To(Equal(map[string]string{"first": first, "second": second}))
+
+			updated := sync("first", `{"type":"whereabouts","range":"192.168.4.0/24"}`)
+			Expect(updated).NotTo(Equal(first))
+			Expect(getSnapshot()).To(Equal(map[string]string{"first": updated, "second": second}))
+		})
+		It("Should not label the snapshot as owned by the operator so it is not pruned", func() {
+			sync("first", `{"type":"whereabouts"}`)
+			cm := &corev1.ConfigMap{}
+			Expect(k8sClient.Get(context.Background(), types.NamespacedName{
+				Namespace: snapshotNamespace, Name: HostDeviceNetworkConfigSnapshotName}, cm)).To(Succeed())
+			Expect(cm.Labels).NotTo(HaveKey(consts.NetworkOperatorOwnedLabel))
+		})
+		It("Should not write the snapshot without a namespace", func() {
+			hostDeviceNetworkState.snapshotNamespace = ""
+			sync("first", `{"type":"whereabouts"}`)
+			cm := &corev1.ConfigMap{}
+			err := k8sClient.Get(context.Background(), types.NamespacedName{
+				Namespace: snapshotNamespace, Name: HostDeviceNetworkConfigSnapshotName}, cm)
+			Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+		})
+	})
+
+	Context("Network policies", func() {
+		const namespace = "tenant"
+		var (
+			k8sClient              client.Client
+			hostDeviceNetworkState *stateHostDeviceNetwork
+		)
+
+		sync := func(name string) {
+			cr := &mellanoxv1alpha1.HostDeviceNetwork{}
+			cr.Name = name
+			cr.UID = types.UID("uid-" + name)
+			cr.Spec.NetworkNamespace = namespace
+			cr.Spec.ResourceName = "hostdev"
+			_, err := hostDeviceNetworkState.Sync(context.Background(), cr, nil)
+			Expect(err).NotTo(HaveOccurred())
+		}
+		getPolicy := func(name string) (*networkingv1.NetworkPolicy, error) {
+			policy := &networkingv1.NetworkPolicy{}
+			err := k8sClient.Get(context.Background(), types.NamespacedName{Namespace: namespace, Name: name}, policy)
+			return policy, err
+		}
+
+		BeforeEach(func() {
+			scheme := runtime.NewScheme()
+			Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+			Expect(mellanoxv1alpha1.AddToScheme(scheme)).To(Succeed())
+			Expect(netattdefv1.AddToScheme(scheme)).To(Succeed())
+			k8sClient = fake.NewClientBuilder().WithScheme(scheme).Build()
+			files, err := utils.GetFilesWithSuffix("../../manifests/stage-hostdevice-network", render.ManifestFileSuffix...)
+			Expect(err).NotTo(HaveOccurred())
+			hostDeviceNetworkState = &stateHostDeviceNetwork{
+				stateSkel: stateSkel{
+					name:           "state-host-device-network",
+					description:    "Host Device net-attach-def CR deployed in cluster",
+					clientProvider: NewStaticClientProvider(k8sClient),
+					scheme:         scheme,
+					renderer:       render.NewRenderer(files),
+				},
+				networkPolicy: getHostDeviceNetworkPolicy(true, []string{"monitoring", ""}),
+			}
+		})
+
+		It("Should apply the network policies in the namespace shared by its HostDeviceNetworks", func() {
+			sync("first")
+			sync("second")
+
+			deny, err := getPolicy("nvidia-network-operator-default-deny")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(deny.Spec.PodSelector).To(Equal(metav1.LabelSelector{}))
+			Expect(deny.Spec.PolicyTypes).To(ConsistOf(networkingv1.PolicyTypeIngress, networkingv1.PolicyTypeEgress))
+			Expect(deny.Spec.Ingress).To(BeEmpty())
+			Expect(deny.Spec.Egress).To(BeEmpty())
+
+			allow, err := getPolicy("nvidia-network-operator-allow")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(allow.Spec.Ingress).To(HaveLen(1))
+			var allowed []string
+			for _, peer := range allow.Spec.Ingress[0].From {
+				allowed = append(allowed, peer.NamespaceSelector.MatchLabels["kubernetes.io/metadata.name"])
+			}
+			Expect(allowed).To(Equal([]string{consts.NetworkOperatorResourceNamespace, "monitoring"}))
+			Expect(allow.Spec.Egress).To(HaveLen(2))
+
+			for _, policy := range []*networkingv1.NetworkPolicy{deny, allow} {
+				Expect(policy.Labels).To(HaveKeyWithValue(consts.NetworkOperatorOwnedLabel, "true"))
+				var owners []string
+				for _, owner := range policy.OwnerReferences {
+					Expect(owner.Controller).To(BeNil())
+					owners = append(owners, owner.Name)
+				}
+				Expect(owners).To(ConsistOf("first", "second"))
+			}
+			Expect(hostDeviceNetworkState.Warnings()).To(BeEmpty())
+		})
+		It("Should skip the namespace of a user managed network policy with the same name", func() {
+			userPolicy := &networkingv1.NetworkPolicy{ObjectMeta: metav1.ObjectMeta{
+				Name: "nvidia-network-operator-allow", Namespace: namespace}}
+			Expect(k8sClient.Create(context.Background(), userPolicy)).To(Succeed())
+
+			sync("first")
+			_, err := getPolicy("nvidia-network-operator-default-deny")
+			Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+			allow, err := getPolicy("nvidia-network-operator-allow")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(allow.Labels).NotTo(HaveKey(consts.NetworkOperatorOwnedLabel))
+			Expect(allow.OwnerReferences).To(BeEmpty())
+			Expect(hostDeviceNetworkState.Warnings()).To(ContainElement(
+				"NetworkPolicy tenant/nvidia-network-operator-allow is not managed by the operator, " +
+					"NetworkPolicies are not applied in namespace tenant"))
+
+			netAttDef := &netattdefv1.NetworkAttachmentDefinition{}
+			Expect(k8sClient.Get(context.Background(),
+				types.NamespacedName{Namespace: namespace, Name: "first"}, netAttDef)).To(Succeed())
+		})
+	})
+
+	Context("Node pools", func() {
+		var k8sClient client.Client
+
+		BeforeEach(func() {
+			scheme := runtime.NewScheme()
+			Expect(mellanoxv1alpha1.AddToScheme(scheme)).To(Succeed())
+			ncp := &mellanoxv1alpha1.NicClusterPolicy{}
+			ncp.Name = consts.NicClusterPolicyResourceName
+			ncp.Spec.SriovDevicePlugin = &mellanoxv1alpha1.DevicePluginSpec{
+				NodePools: []mellanoxv1alpha1.DevicePluginNodePoolSpec{
+					{Name: "a", NodeSelector: map[string]string{"pool": "a"}, ResourceNameSuffix: "_a"},
+				},
+			}
+			k8sClient = fake.NewClientBuilder().WithScheme(scheme).WithObjects(ncp).Build()
+		})
+
+		It("Should append the resource name suffix of the node pool to the resource name", func() {
+			suffix, err := getNodePoolResourceNameSuffix(context.Background(), k8sClient, "a")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(suffix).To(Equal("_a"))
+
+			files, err := utils.GetFilesWithSuffix("../../manifests/stage-hostdevice-network", render.ManifestFileSuffix...)
+			Expect(err).NotTo(HaveOccurred())
+			hostDeviceNetworkState := &stateHostDeviceNetwork{stateSkel: stateSkel{renderer: render.NewRenderer(files)}}
+			cr := &mellanoxv1alpha1.HostDeviceNetwork{}
+			cr.Name = "hostdev-net"
+			cr.Spec.ResourceName = "hostdev"
+			cr.Spec.NodePool = "a"
+			objs, err := hostDeviceNetworkState.getManifestObjects(cr, suffix)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(objs[0].GetAnnotations()).To(HaveKeyWithValue("k8s.v1.cni.cncf.io/resourceName",
+				mellanoxv1alpha1.HostDeviceNetworkResourceNamePrefix+"hostdev_a"))
+		})
+		It("Should not suffix the resource name without a node pool", func() {
+			suffix, err := getNodePoolResourceNameSuffix(context.Background(), k8sClient, "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(suffix).To(BeEmpty())
+		})
+		It("Should fail on an unknown node pool", func() {
+			_, err := getNodePoolResourceNameSuffix(context.Background(), k8sClient, "b")
+			Expect(err).To(HaveOccurred())
+		})
+	})
 })
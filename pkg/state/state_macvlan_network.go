@@ -23,7 +23,6 @@ import (
 	netattdefv1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
 	"github.com/pkg/errors"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -43,7 +42,7 @@ const (
 )
 
 // NewStateMacvlanNetwork creates a new state for MacvlanNetwork CR
-func NewStateMacvlanNetwork(k8sAPIClient client.Client, scheme *runtime.Scheme, manifestDir string) (State, error) {
+func NewStateMacvlanNetwork(clientProvider ClientProvider, scheme *runtime.Scheme, manifestDir string) (State, error) {
 	files, err := utils.GetFilesWithSuffix(manifestDir, render.ManifestFileSuffix...)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to get files from manifest dir")
@@ -52,11 +51,11 @@ func NewStateMacvlanNetwork(k8sAPIClient client.Client, scheme *runtime.Scheme,
 	renderer := render.NewRenderer(files)
 	return &stateMacvlanNetwork{
 		stateSkel: stateSkel{
-			name:        stateMacvlanNetworkName,
-			description: stateMacvlanNetworkDescription,
-			client:      k8sAPIClient,
-			scheme:      scheme,
-			renderer:    renderer,
+			name:           stateMacvlanNetworkName,
+			description:    stateMacvlanNetworkDescription,
+			clientProvider: clientProvider,
+			scheme:         scheme,
+			renderer:       renderer,
 		}}, nil
 }
 
@@ -66,7 +65,8 @@ type stateMacvlanNetwork struct {
 
 // Sync attempt to get the system to match the desired state which State represent.
 // a sync operation must be relatively short and must not block the execution thread.
-func (s *stateMacvlanNetwork) Sync(customResource interface{}, _ InfoCatalog) (SyncState, error) {
+func (s *stateMacvlanNetwork) Sync(
+	ctx context.Context, customResource interface{}, _ InfoCatalog) (SyncState, error) {
 	cr := customResource.(*mellanoxv1alpha1.MacvlanNetwork)
 	log.V(consts.LogLevelInfo).Info(
 		"Sync Custom resource", "State:", s.name, "Name:", cr.Name, "Namespace:", cr.Namespace)
@@ -85,12 +85,21 @@ func (s *stateMacvlanNetwork) Sync(customResource interface{}, _ InfoCatalog) (S
 		return SyncStateError, errors.Wrap(err, "no NetworkAttachmentDefinition object found")
 	}
 
+	k8sClient, err := s.getClient(cr)
+	if err != nil {
+		return SyncStateNotReady, err
+	}
+
+	if err := setNetAttDefVersion(ctx, k8sClient, netAttDef); err != nil {
+		return SyncStateNotReady, err
+	}
+
 	// Delete NetworkAttachmentDefinition if not in desired namespace
-	if err = s.handleNamespaceChange(cr, netAttDef); err != nil {
+	if err = s.handleNamespaceChange(k8sClient, cr, netAttDef); err != nil {
 		return SyncStateError, errors.Wrap(err, "Couldn't delete NetworkAttachmentDefinition CR")
 	}
 
-	err = s.createOrUpdateObjs(func(obj *unstructured.Unstructured) error {
+	err = s.createOrUpdateObjs(ctx, k8sClient, func(obj *unstructured.Unstructured) error {
 		if err := controllerutil.SetControllerReference(cr, obj, s.scheme); err != nil {
 			return errors.Wrap(err, "failed to set controller reference for object")
 		}
@@ -102,17 +111,17 @@ func (s *stateMacvlanNetwork) Sync(customResource interface{}, _ InfoCatalog) (S
 	}
 
 	// Check objects status
-	syncState, err := s.getSyncState(objs)
+	syncState, err := s.getSyncState(ctx, k8sClient, objs)
 	if err != nil {
 		return SyncStateNotReady, errors.Wrap(err, "failed to get sync state")
 	}
 
-	if err := s.updateNetAttDefNamespace(cr, netAttDef); err != nil {
+	if err := s.updateNetAttDefNamespace(k8sClient, cr, netAttDef); err != nil {
 		return SyncStateError, err
 	}
 
 	// Get NetworkAttachmentDefinition SelfLink
-	if err := s.getObj(netAttDef); err != nil {
+	if err := s.getObj(k8sClient, netAttDef); err != nil {
 		return SyncStateError, errors.Wrap(err, "failed to get NetworkAttachmentDefinition")
 	}
 	return syncState, nil
@@ -156,18 +165,17 @@ func (s *stateMacvlanNetwork) getManifestObjects(
 	return objs, nil
 }
 
-func (s *stateMacvlanNetwork) handleNamespaceChange(cr *mellanoxv1alpha1.MacvlanNetwork,
+func (s *stateMacvlanNetwork) handleNamespaceChange(c client.Client, cr *mellanoxv1alpha1.MacvlanNetwork,
 	netAttDef *unstructured.Unstructured) error {
 	// Delete NetworkAttachmentDefinition if not in desired namespace
 	lnns, lnnsExists := cr.GetAnnotations()[lastNetworkNamespaceAnnot]
 	netAttDefChangedNamespace := lnnsExists && netAttDef.GetNamespace() != lnns
 	if netAttDefChangedNamespace {
-		err := s.client.Delete(context.TODO(), &netattdefv1.NetworkAttachmentDefinition{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      cr.GetName(),
-				Namespace: lnns,
-			},
-		})
+		previous := &unstructured.Unstructured{}
+		previous.SetGroupVersionKind(netAttDef.GroupVersionKind())
+		previous.SetName(cr.GetName())
+		previous.SetNamespace(lnns)
+		err := c.Delete(context.TODO(), previous)
 		if err != nil && !k8serrors.IsNotFound(err) {
 			return err
 		}
@@ -176,14 +184,14 @@ func (s *stateMacvlanNetwork) handleNamespaceChange(cr *mellanoxv1alpha1.Macvlan
 	return nil
 }
 
-func (s *stateMacvlanNetwork) updateNetAttDefNamespace(cr *mellanoxv1alpha1.MacvlanNetwork,
+func (s *stateMacvlanNetwork) updateNetAttDefNamespace(c client.Client, cr *mellanoxv1alpha1.MacvlanNetwork,
 	netAttDef *unstructured.Unstructured) error {
 	lnns, lnnsExists := cr.GetAnnotations()[lastNetworkNamespaceAnnot]
 	netAttDefChangedNamespace := lnnsExists && netAttDef.GetNamespace() != lnns
 	if !lnnsExists || netAttDefChangedNamespace {
 		anno := map[string]string{lastNetworkNamespaceAnnot: netAttDef.GetNamespace()}
 		cr.SetAnnotations(anno)
-		if err := s.client.Update(context.Background(), cr); err != nil {
+		if err := c.Update(context.Background(), cr); err != nil {
 			return errors.Wrap(err, "failed to update MacvlanNetwork annotations")
 		}
 	}
@@ -17,36 +17,35 @@ limitations under the License.
 package state //nolint:dupl
 
 import (
+	"context"
+
 	"github.com/pkg/errors"
 	appsv1 "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
-	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	mellanoxv1alpha1 "github.com/Mellanox/network-operator/api/v1alpha1"
 	"github.com/Mellanox/network-operator/pkg/consts"
 	"github.com/Mellanox/network-operator/pkg/render"
-	"github.com/Mellanox/network-operator/pkg/utils"
 )
 
 // NewStateMultusCNI creates a new state for Multus
-func NewStateMultusCNI(k8sAPIClient client.Client, scheme *runtime.Scheme, manifestDir string) (State, error) {
-	files, err := utils.GetFilesWithSuffix(manifestDir, render.ManifestFileSuffix...)
+func NewStateMultusCNI(clientProvider ClientProvider, scheme *runtime.Scheme, manifestDir string) (State, error) {
+	renderer, manifestVersions, err := newManifestRenderers(manifestDir)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to get files from manifest dir")
+		return nil, err
 	}
-
-	renderer := render.NewRenderer(files)
 	return &stateMultusCNI{
 		stateSkel: stateSkel{
-			name:        "state-multus-cni",
-			description: "multus CNI deployed in the cluster",
-			client:      k8sAPIClient,
-			scheme:      scheme,
-			renderer:    renderer,
+			name:             "state-multus-cni",
+			description:      "multus CNI deployed in the cluster",
+			clientProvider:   clientProvider,
+			scheme:           scheme,
+			renderer:         renderer,
+			manifestVersions: manifestVersions,
 		}}, nil
 }
 
@@ -63,7 +62,8 @@ type MultusManifestRenderData struct {
 // Sync attempt to get the system to match the desired state which State represent.
 // a sync operation must be relatively short and must not block the execution thread.
 //nolint:dupl
-func (s *stateMultusCNI) Sync(customResource interface{}, infoCatalog InfoCatalog) (SyncState, error) {
+func (s *stateMultusCNI) Sync(
+	ctx context.Context, customResource interface{}, infoCatalog InfoCatalog) (SyncState, error) {
 	cr := customResource.(*mellanoxv1alpha1.NicClusterPolicy)
 	log.V(consts.LogLevelInfo).Info(
 		"Sync Custom resource", "State:", s.name, "Name:", cr.Name, "Namespace:", cr.Namespace)
@@ -84,8 +84,13 @@ func (s *stateMultusCNI) Sync(customResource interface{}, infoCatalog InfoCatalo
 		return SyncStateNotReady, nil
 	}
 
+	k8sClient, err := s.getClient(cr)
+	if err != nil {
+		return SyncStateNotReady, err
+	}
+
 	// Create objects if they dont exist, Update objects if they do exist
-	err = s.createOrUpdateObjs(func(obj *unstructured.Unstructured) error {
+	err = s.createOrUpdateObjs(ctx, k8sClient, func(obj *unstructured.Unstructured) error {
 		if err := controllerutil.SetControllerReference(cr, obj, s.scheme); err != nil {
 			return errors.Wrap(err, "failed to set controller reference for object")
 		}
@@ -95,7 +100,7 @@ func (s *stateMultusCNI) Sync(customResource interface{}, infoCatalog InfoCatalo
 		return SyncStateNotReady, errors.Wrap(err, "failed to create/update objects")
 	}
 	// Check objects status
-	syncState, err := s.getSyncState(objs)
+	syncState, err := s.getSyncState(ctx, k8sClient, objs)
 	if err != nil {
 		return SyncStateNotReady, errors.Wrap(err, "failed to get sync state")
 	}
@@ -115,13 +120,19 @@ func (s *stateMultusCNI) getManifestObjects(
 		CrSpec:       cr.Spec.SecondaryNetwork.Multus,
 		NodeAffinity: cr.Spec.NodeAffinity,
 		RuntimeSpec: &runtimeSpec{
-			Namespace: consts.NetworkOperatorResourceNamespace,
+			Namespace:    consts.NetworkOperatorResourceNamespace,
+			FeatureGates: cr.Spec.FeatureGates,
+			External:     s.externalRenderData,
 		},
 	}
 
 	// render objects
 	log.V(consts.LogLevelDebug).Info("Rendering objects", "data:", renderData)
-	objs, err := s.renderer.RenderObjects(&render.TemplatingData{Data: renderData})
+	renderer, err := s.getRenderer(cr.Spec.SecondaryNetwork.Multus.ManifestVersion)
+	if err != nil {
+		return nil, err
+	}
+	objs, err := renderer.RenderObjects(&render.TemplatingData{Data: renderData})
 
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to render objects")
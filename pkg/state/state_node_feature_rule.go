@@ -0,0 +1,155 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	mellanoxv1alpha1 "github.com/Mellanox/network-operator/api/v1alpha1"
+	"github.com/Mellanox/network-operator/pkg/consts"
+	"github.com/Mellanox/network-operator/pkg/render"
+	"github.com/Mellanox/network-operator/pkg/utils"
+)
+
+const (
+	// nodeFeatureRuleCRDName is the name of the NFD NodeFeatureRule CRD
+	nodeFeatureRuleCRDName = "nodefeaturerules.nfd.k8s-sigs.io"
+	// mlnxPCIVendorID is the PCI vendor ID of Mellanox devices
+	mlnxPCIVendorID = "15b3"
+)
+
+// NewStateNodeFeatureRule creates a new state which deploys an NFD NodeFeatureRule labeling nodes with Mellanox NICs
+func NewStateNodeFeatureRule(
+	clientProvider ClientProvider, scheme *runtime.Scheme, manifestDir string) (State, error) {
+	files, err := utils.GetFilesWithSuffix(manifestDir, render.ManifestFileSuffix...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get files from manifest dir")
+	}
+
+	renderer := render.NewRenderer(files)
+	return &stateNodeFeatureRule{
+		stateSkel: stateSkel{
+			name:           "state-node-feature-rule",
+			description:    "NFD NodeFeatureRule labeling nodes with Mellanox NICs deployed in the cluster",
+			clientProvider: clientProvider,
+			scheme:         scheme,
+			renderer:       renderer,
+		}}, nil
+}
+
+type stateNodeFeatureRule struct {
+	stateSkel
+}
+
+type nodeFeatureRuleManifestRenderData struct {
+	MlnxVendorID string
+}
+
+// Sync attempt to get the system to match the desired state which State represent.
+// a sync operation must be relatively short and must not block the execution thread.
+func (s *stateNodeFeatureRule) Sync(
+	ctx context.Context, customResource interface{}, _ InfoCatalog) (SyncState, error) {
+	cr := customResource.(*mellanoxv1alpha1.NicClusterPolicy)
+	log.V(consts.LogLevelInfo).Info(
+		"Sync Custom resource", "State:", s.name, "Name:", cr.Name, "Namespace:", cr.Namespace)
+
+	if cr.Spec.NodeFeatureRule == nil || !cr.Spec.NodeFeatureRule.Enabled {
+		log.V(consts.LogLevelInfo).Info("NodeFeatureRule is not enabled, no action required")
+		return SyncStateIgnore, nil
+	}
+
+	k8sClient, err := s.getClient(cr)
+	if err != nil {
+		return SyncStateNotReady, err
+	}
+
+	exists, err := isNodeFeatureRuleAPIPresent(ctx, k8sClient)
+	if err != nil {
+		return SyncStateNotReady, err
+	}
+	if !exists {
+		log.V(consts.LogLevelWarning).Info("NFD NodeFeatureRule API is not present in the cluster, no action required",
+			"CRD:", nodeFeatureRuleCRDName)
+		return SyncStateIgnore, nil
+	}
+
+	objs, err := s.getManifestObjects()
+	if err != nil {
+		return SyncStateNotReady, errors.Wrap(err, "failed to create k8s objects from manifest")
+	}
+
+	// Create objects if they dont exist, Update objects if they do exist
+	err = s.createOrUpdateObjs(ctx, k8sClient, func(obj *unstructured.Unstructured) error {
+		if err := controllerutil.SetControllerReference(cr, obj, s.scheme); err != nil {
+			return errors.Wrap(err, "failed to set controller reference for object")
+		}
+		return nil
+	}, objs)
+	if err != nil {
+		return SyncStateNotReady, errors.Wrap(err, "failed to create/update objects")
+	}
+	// Check objects status
+	syncState, err := s.getSyncState(ctx, k8sClient, objs)
+	if err != nil {
+		return SyncStateNotReady, errors.Wrap(err, "failed to get sync state")
+	}
+	return syncState, nil
+}
+
+// Get a map of source kinds that should be watched for the state keyed by the source kind name.
+// NodeFeatureRule is not watched as the NFD API may not be present in the cluster.
+func (s *stateNodeFeatureRule) GetWatchSources() map[string]*source.Kind {
+	return make(map[string]*source.Kind)
+}
+
+func (s *stateNodeFeatureRule) getManifestObjects() ([]*unstructured.Unstructured, error) {
+	renderData := &nodeFeatureRuleManifestRenderData{
+		MlnxVendorID: mlnxPCIVendorID,
+	}
+	// render objects
+	objs, err := s.renderer.RenderObjects(&render.TemplatingData{Data: renderData})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to render objects")
+	}
+	log.V(consts.LogLevelDebug).Info("Rendered", "objects:", objs)
+	return objs, nil
+}
+
+// isNodeFeatureRuleAPIPresent checks if the NFD NodeFeatureRule CRD exists in the cluster
+func isNodeFeatureRuleAPIPresent(ctx context.Context, c client.Client) (bool, error) {
+	crd := &unstructured.Unstructured{}
+	crd.SetGroupVersionKind(schema.GroupVersionKind{
+		Group: "apiextensions.k8s.io", Version: "v1", Kind: "CustomResourceDefinition"})
+	err := c.Get(ctx, types.NamespacedName{Name: nodeFeatureRuleCRDName}, crd)
+	if k8serrors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Wrap(err, "failed to get NodeFeatureRule CRD")
+	}
+	return true, nil
+}
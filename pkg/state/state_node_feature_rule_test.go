@@ -0,0 +1,104 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	mellanoxv1alpha1 "github.com/Mellanox/network-operator/api/v1alpha1"
+)
+
+var _ = Describe("NodeFeatureRule State tests", func() {
+	var (
+		cr     *mellanoxv1alpha1.NicClusterPolicy
+		scheme *runtime.Scheme
+	)
+
+	newNodeFeatureRuleCRD := func() *unstructured.Unstructured {
+		crd := &unstructured.Unstructured{}
+		crd.SetAPIVersion("apiextensions.k8s.io/v1")
+		crd.SetKind("CustomResourceDefinition")
+		crd.SetName(nodeFeatureRuleCRDName)
+		return crd
+	}
+	getNodeFeatureRule := func(k8sClient client.Client) (*unstructured.Unstructured, error) {
+		rule := &unstructured.Unstructured{}
+		rule.SetAPIVersion("nfd.k8s-sigs.io/v1alpha1")
+		rule.SetKind("NodeFeatureRule")
+		err := k8sClient.Get(context.TODO(), types.NamespacedName{Name: "nvidia-network-operator-mlnx-nic"}, rule)
+		return rule, err
+	}
+	sync := func(k8sClient client.Client) SyncState {
+		nfrState, err := NewStateNodeFeatureRule(
+			NewStaticClientProvider(k8sClient), scheme, "../../manifests/stage-node-feature-rule")
+		Expect(err).NotTo(HaveOccurred())
+		syncState, err := nfrState.Sync(context.Background(), cr, nil)
+		Expect(err).NotTo(HaveOccurred())
+		return syncState
+	}
+
+	BeforeEach(func() {
+		scheme = runtime.NewScheme()
+		Expect(mellanoxv1alpha1.AddToScheme(scheme)).To(Succeed())
+		cr = &mellanoxv1alpha1.NicClusterPolicy{}
+		cr.Name = "nic-cluster-policy"
+		cr.Spec.NodeFeatureRule = &mellanoxv1alpha1.NodeFeatureRuleSpec{Enabled: true}
+	})
+
+	It("Should create NodeFeatureRule labeling Mellanox NICs when NFD CRD exists", func() {
+		k8sClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(newNodeFeatureRuleCRD()).Build()
+		Expect(sync(k8sClient)).To(Equal(SyncState(SyncStateReady)))
+
+		rule, err := getNodeFeatureRule(k8sClient)
+		Expect(err).NotTo(HaveOccurred())
+		rules, found, err := unstructured.NestedSlice(rule.Object, "spec", "rules")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(found).To(BeTrue())
+		Expect(rules).To(HaveLen(1))
+		labels, _, err := unstructured.NestedStringMap(rules[0].(map[string]interface{}), "labels")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(labels).To(Equal(map[string]string{"pci-15b3.present": "true"}))
+		matchFeatures := rules[0].(map[string]interface{})["matchFeatures"].([]interface{})
+		vendor, _, err := unstructured.NestedStringSlice(matchFeatures[0].(map[string]interface{}),
+			"matchExpressions", "vendor", "value")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(vendor).To(Equal([]string{"15b3"}))
+	})
+	It("Should ignore when NFD CRD does not exist", func() {
+		k8sClient := fake.NewClientBuilder().WithScheme(scheme).Build()
+		Expect(sync(k8sClient)).To(Equal(SyncState(SyncStateIgnore)))
+		_, err := getNodeFeatureRule(k8sClient)
+		Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+	})
+	It("Should ignore when disabled", func() {
+		cr.Spec.NodeFeatureRule.Enabled = false
+		k8sClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(newNodeFeatureRuleCRD()).Build()
+		Expect(sync(k8sClient)).To(Equal(SyncState(SyncStateIgnore)))
+		_, err := getNodeFeatureRule(k8sClient)
+		Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+	})
+})
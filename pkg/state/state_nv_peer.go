@@ -1,6 +1,7 @@
 package state
 
 import (
+	"context"
 	"os"
 	"strconv"
 
@@ -9,7 +10,6 @@ import (
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
-	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/source"
 
@@ -17,7 +17,6 @@ import (
 	"github.com/Mellanox/network-operator/pkg/consts"
 	"github.com/Mellanox/network-operator/pkg/nodeinfo"
 	"github.com/Mellanox/network-operator/pkg/render"
-	"github.com/Mellanox/network-operator/pkg/utils"
 )
 
 const stateNVPeerName = "state-NV-Peer"
@@ -29,25 +28,25 @@ const maxCudaVersionMajor = 465
 //TODO: Refine a base struct that implements a driver container as this is pretty much identical to OFED state
 
 // NewStateNVPeer creates a new NVPeer driver state
-func NewStateNVPeer(k8sAPIClient client.Client, scheme *runtime.Scheme, manifestDir string) (State, error) {
-	files, err := utils.GetFilesWithSuffix(manifestDir, render.ManifestFileSuffix...)
+func NewStateNVPeer(clientProvider ClientProvider, scheme *runtime.Scheme, manifestDir string) (State, error) {
+	renderer, manifestVersions, err := newManifestRenderers(manifestDir)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to get files from manifest dir")
+		return nil, err
 	}
-
-	renderer := render.NewRenderer(files)
 	return &stateNVPeer{
 		stateSkel: stateSkel{
-			name:        stateNVPeerName,
-			description: stateNVPeerDescription,
-			client:      k8sAPIClient,
-			scheme:      scheme,
-			renderer:    renderer,
+			name:             stateNVPeerName,
+			description:      stateNVPeerDescription,
+			clientProvider:   clientProvider,
+			scheme:           scheme,
+			renderer:         renderer,
+			manifestVersions: manifestVersions,
 		}}, nil
 }
 
 type stateNVPeer struct {
 	stateSkel
+	stateNoEligibleNodes
 }
 
 type nvPeerRuntimeSpec struct {
@@ -71,10 +70,12 @@ type nvPeerManifestRenderData struct {
 // Sync attempt to get the system to match the desired state which State represent.
 // a sync operation must be relatively short and must not block the execution thread.
 //nolint:dupl
-func (s *stateNVPeer) Sync(customResource interface{}, infoCatalog InfoCatalog) (SyncState, error) {
+func (s *stateNVPeer) Sync(
+	ctx context.Context, customResource interface{}, infoCatalog InfoCatalog) (SyncState, error) {
 	cr := customResource.(*mellanoxv1alpha1.NicClusterPolicy)
 	log.V(consts.LogLevelInfo).Info(
 		"Sync Custom resource", "State:", s.name, "Name:", cr.Name, "Namespace:", cr.Namespace)
+	s.noEligibleNodesFilter = ""
 
 	if cr.Spec.NVPeerDriver == nil {
 		// Either this state was not required to run or an update occurred and we need to remove
@@ -84,9 +85,9 @@ func (s *stateNVPeer) Sync(customResource interface{}, infoCatalog InfoCatalog)
 		return SyncStateIgnore, nil
 	}
 	// Fill ManifestRenderData and render objects
-	nodeInfo := infoCatalog.GetNodeInfoProvider()
-	if nodeInfo == nil {
-		return SyncStateError, errors.New("unexpected state, catalog does not provide node information")
+	nodeInfo, err := s.getNodeInfo(ctx, infoCatalog)
+	if err != nil {
+		return SyncStateError, err
 	}
 
 	objs, err := s.getManifestObjects(cr, nodeInfo)
@@ -100,8 +101,13 @@ func (s *stateNVPeer) Sync(customResource interface{}, infoCatalog InfoCatalog)
 		return SyncStateNotReady, nil
 	}
 
+	k8sClient, err := s.getClient(cr)
+	if err != nil {
+		return SyncStateNotReady, err
+	}
+
 	// Create objects if they dont exist, Update objects if they do exist
-	err = s.createOrUpdateObjs(func(obj *unstructured.Unstructured) error {
+	err = s.createOrUpdateObjs(ctx, k8sClient, func(obj *unstructured.Unstructured) error {
 		if err := controllerutil.SetControllerReference(cr, obj, s.scheme); err != nil {
 			return errors.Wrap(err, "failed to set controller reference for object")
 		}
@@ -121,7 +127,7 @@ func (s *stateNVPeer) Sync(customResource interface{}, infoCatalog InfoCatalog)
 	}
 
 	// Check objects status
-	syncState, err := s.getSyncState(objs)
+	syncState, err := s.getSyncState(ctx, k8sClient, objs)
 	if err != nil {
 		return SyncStateNotReady, errors.Wrap(err, "failed to get sync state")
 	}
@@ -138,19 +144,18 @@ func (s *stateNVPeer) GetWatchSources() map[string]*source.Kind {
 func (s *stateNVPeer) getManifestObjects(
 	cr *mellanoxv1alpha1.NicClusterPolicy,
 	nodeInfo nodeinfo.Provider) ([]*unstructured.Unstructured, error) {
-	attrs := nodeInfo.GetNodesAttributes(
-		nodeinfo.NewNodeLabelFilterBuilder().
-			WithLabel(nodeinfo.NodeLabelMlnxNIC, "true").
-			WithLabel(nodeinfo.NodeLabelNvGPU, "true").
-			Build())
+	attrs := s.getEligibleNodes(nodeInfo, map[string]string{
+		nodeinfo.NodeLabelMlnxNIC: "true",
+		nodeinfo.NodeLabelNvGPU:   "true",
+	})
 	if len(attrs) == 0 {
-		log.V(consts.LogLevelInfo).Info("No nodes with Mellanox NICs and Nvidia GPUs where found in the cluster.")
 		return []*unstructured.Unstructured{}, nil
 	}
 
 	// TODO: Render daemonset multiple times according to CPUXOS matrix (ATM assume all nodes are the same)
-	if err := s.checkAttributesExist(attrs[0],
-		nodeinfo.AttrTypeCPUArch, nodeinfo.AttrTypeOSName, nodeinfo.AttrTypeOSVer); err != nil {
+	nodeAttrs, err := s.getAttributesWithDefaults(attrs[0], cr.Spec.RenderDefaults,
+		nodeinfo.AttrTypeCPUArch, nodeinfo.AttrTypeOSName, nodeinfo.AttrTypeOSVer)
+	if err != nil {
 		return nil, err
 	}
 
@@ -158,10 +163,15 @@ func (s *stateNVPeer) getManifestObjects(
 		CrSpec:       cr.Spec.NVPeerDriver,
 		NodeAffinity: cr.Spec.NodeAffinity,
 		RuntimeSpec: &nvPeerRuntimeSpec{
-			runtimeSpec:    runtimeSpec{consts.NetworkOperatorResourceNamespace},
-			CPUArch:        attrs[0].Attributes[nodeinfo.AttrTypeCPUArch],
-			OSName:         attrs[0].Attributes[nodeinfo.AttrTypeOSName],
-			OSVer:          attrs[0].Attributes[nodeinfo.AttrTypeOSVer],
+			runtimeSpec: runtimeSpec{
+				Namespace:         consts.NetworkOperatorResourceNamespace,
+				FeatureGates:      cr.Spec.FeatureGates,
+				PriorityClassName: getPriorityClassName(cr),
+				External:          s.externalRenderData,
+			},
+			CPUArch:        nodeAttrs.Attributes[nodeinfo.AttrTypeCPUArch],
+			OSName:         nodeAttrs.Attributes[nodeinfo.AttrTypeOSName],
+			OSVer:          nodeAttrs.Attributes[nodeinfo.AttrTypeOSVer],
 			HTTPProxy:      os.Getenv(consts.HTTPProxy),
 			HTTPSProxy:     os.Getenv(consts.HTTPSProxy),
 			NoProxy:        os.Getenv(consts.NoProxy),
@@ -171,7 +181,11 @@ func (s *stateNVPeer) getManifestObjects(
 	}
 	// render objects
 	log.V(consts.LogLevelDebug).Info("Rendering objects", "data:", renderData)
-	objs, err := s.renderer.RenderObjects(&render.TemplatingData{Data: renderData})
+	renderer, err := s.getRenderer(cr.Spec.NVPeerDriver.ManifestVersion)
+	if err != nil {
+		return nil, err
+	}
+	objs, err := renderer.RenderObjects(&render.TemplatingData{Data: renderData})
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to render objects")
 	}
@@ -17,12 +17,18 @@ limitations under the License.
 package state
 
 import (
+	"context"
+	"net"
 	"os"
+	"sort"
 
 	"github.com/pkg/errors"
 	appsv1 "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
@@ -31,33 +37,63 @@ import (
 	mellanoxv1alpha1 "github.com/Mellanox/network-operator/api/v1alpha1"
 	"github.com/Mellanox/network-operator/pkg/consts"
 	"github.com/Mellanox/network-operator/pkg/nodeinfo"
-	"github.com/Mellanox/network-operator/pkg/render"
-	"github.com/Mellanox/network-operator/pkg/utils"
 )
 
 const stateOFEDName = "state-OFED"
 const stateOFEDDescription = "OFED driver deployed in the cluster"
 
+// ofedPerOSDaemonSetsGate is the feature gate rendering a driver per OS distribution of the eligible nodes, all the
+// nodes are deployed with the driver of the OS distribution of the first node if disabled
+const ofedPerOSDaemonSetsGate = "OFEDDriverPerOSDaemonSets"
+
+// ofedDriverLabel labels the OFED driver DaemonSets, the DaemonSets of drivers which are no longer rendered are
+// looked up by it to be deleted
+const ofedDriverLabel = "network.nvidia.com/operator.ofed-driver"
+
 // NewStateOFED creates a new OFED driver state
-func NewStateOFED(k8sAPIClient client.Client, scheme *runtime.Scheme, manifestDir string) (State, error) {
-	files, err := utils.GetFilesWithSuffix(manifestDir, render.ManifestFileSuffix...)
+func NewStateOFED(clientProvider ClientProvider, scheme *runtime.Scheme, manifestDir string) (State, error) {
+	renderer, manifestVersions, err := newManifestRenderers(manifestDir)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to get files from manifest dir")
+		return nil, err
 	}
-
-	renderer := render.NewRenderer(files)
 	return &stateOFED{
 		stateSkel: stateSkel{
-			name:        stateOFEDName,
-			description: stateOFEDDescription,
-			client:      k8sAPIClient,
-			scheme:      scheme,
-			renderer:    renderer,
+			name:             stateOFEDName,
+			description:      stateOFEDDescription,
+			clientProvider:   clientProvider,
+			scheme:           scheme,
+			renderer:         renderer,
+			manifestVersions: manifestVersions,
 		}}, nil
 }
 
 type stateOFED struct {
 	stateSkel
+	stateWarnings
+	stateNoEligibleNodes
+	// nodes without a precompiled driver image for their kernel the driver is not deployed on
+	skippedNodes []string
+	nodeModes    map[string]string
+	osGroups     []OSGroup
+	// renderWorkers is the number of drivers rendered concurrently in the last Sync invocation
+	renderWorkers int
+}
+
+// SkippedNodes returns the nodes skipped by the last Sync invocation
+func (s *stateOFED) SkippedNodes() []string {
+	return s.skippedNodes
+}
+
+// NodeModes returns whether the driver is precompiled or built from source on each node in the last Sync
+// invocation
+func (s *stateOFED) NodeModes() map[string]string {
+	return s.nodeModes
+}
+
+// OSGroups returns the eligible nodes grouped by OS distribution in the last Sync invocation, a driver is rendered
+// for each OS distribution
+func (s *stateOFED) OSGroups() []OSGroup {
+	return s.osGroups
 }
 
 type ofedRuntimeSpec struct {
@@ -71,18 +107,57 @@ type ofedRuntimeSpec struct {
 }
 
 type ofedManifestRenderData struct {
-	CrSpec       *mellanoxv1alpha1.OFEDDriverSpec
-	NodeAffinity *v1.NodeAffinity
-	RuntimeSpec  *ofedRuntimeSpec
+	CrSpec *mellanoxv1alpha1.OFEDDriverSpec
+	// RuntimeSpec holds the attributes of the first OS distribution of the eligible nodes, the drivers hold the OS
+	// distribution they are deployed on
+	RuntimeSpec *ofedRuntimeSpec
+	// OFED driver DaemonSets to render
+	Drivers []ofedDriver
+	// Modprobe configuration files keyed by file name
+	ModprobeConfig map[string]string
+	// MetricsExporter is the metrics exporter sidecar of the drivers, nil if not enabled
+	MetricsExporter *mellanoxv1alpha1.OFEDMetricsExporterSpec
+}
+
+// HasOS checks if one of the drivers is deployed on nodes running the OS distribution osName, e.g to render the
+// objects required by the drivers on OpenShift
+func (d *ofedManifestRenderData) HasOS(osName string) bool {
+	for i := range d.Drivers {
+		if d.Drivers[i].OSName == osName {
+			return true
+		}
+	}
+	return false
+}
+
+// ImagePullSecrets returns the image pull secrets of the driver and of its metrics exporter sidecar
+func (d *ofedManifestRenderData) ImagePullSecrets() []string {
+	if d.MetricsExporter == nil {
+		return d.CrSpec.ImagePullSecrets
+	}
+	secrets := append([]string{}, d.CrSpec.ImagePullSecrets...)
+	for _, secret := range d.MetricsExporter.ImagePullSecrets {
+		if !containsString(secrets, secret) {
+			secrets = append(secrets, secret)
+		}
+	}
+	return secrets
 }
 
 // Sync attempt to get the system to match the desired state which State represent.
 // a sync operation must be relatively short and must not block the execution thread.
 //nolint:dupl
-func (s *stateOFED) Sync(customResource interface{}, infoCatalog InfoCatalog) (SyncState, error) {
+func (s *stateOFED) Sync(
+	ctx context.Context, customResource interface{}, infoCatalog InfoCatalog) (SyncState, error) {
 	cr := customResource.(*mellanoxv1alpha1.NicClusterPolicy)
 	log.V(consts.LogLevelInfo).Info(
 		"Sync Custom resource", "State:", s.name, "Name:", cr.Name, "Namespace:", cr.Namespace)
+	s.warnings = nil
+	s.noEligibleNodesFilter = ""
+	s.skippedNodes = nil
+	s.nodeModes = nil
+	s.osGroups = nil
+	s.renderWorkers = getRenderWorkers(ctx)
 
 	if cr.Spec.OFEDDriver == nil {
 		// Either this state was not required to run or an update occurred and we need to remove
@@ -92,9 +167,9 @@ func (s *stateOFED) Sync(customResource interface{}, infoCatalog InfoCatalog) (S
 		return SyncStateIgnore, nil
 	}
 	// Fill ManifestRenderData and render objects
-	nodeInfo := infoCatalog.GetNodeInfoProvider()
-	if nodeInfo == nil {
-		return SyncStateError, errors.New("unexpected state, catalog does not provide node information")
+	nodeInfo, err := s.getNodeInfo(ctx, infoCatalog)
+	if err != nil {
+		return SyncStateError, err
 	}
 
 	objs, err := s.getManifestObjects(cr, nodeInfo)
@@ -108,8 +183,17 @@ func (s *stateOFED) Sync(customResource interface{}, infoCatalog InfoCatalog) (S
 		return SyncStateNotReady, nil
 	}
 
+	k8sClient, err := s.getClient(cr)
+	if err != nil {
+		return SyncStateNotReady, err
+	}
+	objs, err = skipServiceMonitor(ctx, k8sClient, objs)
+	if err != nil {
+		return SyncStateNotReady, err
+	}
+
 	// Create objects if they dont exist, Update objects if they do exist
-	err = s.createOrUpdateObjs(func(obj *unstructured.Unstructured) error {
+	err = s.createOrUpdateObjs(ctx, k8sClient, func(obj *unstructured.Unstructured) error {
 		if err := controllerutil.SetControllerReference(cr, obj, s.scheme); err != nil {
 			return errors.Wrap(err, "failed to set controller reference for object")
 		}
@@ -118,14 +202,57 @@ func (s *stateOFED) Sync(customResource interface{}, infoCatalog InfoCatalog) (S
 	if err != nil {
 		return SyncStateNotReady, errors.Wrap(err, "failed to create/update objects")
 	}
+	if err := s.deleteStaleDrivers(ctx, k8sClient, cr, objs); err != nil {
+		return SyncStateNotReady, err
+	}
 	// Check objects status
-	syncState, err := s.getSyncState(objs)
+	syncState, err := s.getSyncState(ctx, k8sClient, objs)
 	if err != nil {
 		return SyncStateNotReady, errors.Wrap(err, "failed to get sync state")
 	}
+	if err := annotateNodeReadiness(ctx, k8sClient, ofedReadyAnnotation, labels.Everything(), objs); err != nil {
+		return SyncStateNotReady, err
+	}
 	return syncState, nil
 }
 
+// deleteStaleDrivers deletes the OFED driver DaemonSets of cr which are not rendered anymore, e.g the driver built
+// from source once precompiled drivers are deployed, so the modules of a node are never managed by two drivers
+func (s *stateOFED) deleteStaleDrivers(ctx context.Context, c client.Client,
+	cr *mellanoxv1alpha1.NicClusterPolicy, objs []*unstructured.Unstructured) error {
+	rendered := make(map[string]bool, len(objs))
+	for _, obj := range objs {
+		if obj.GetKind() == "DaemonSet" {
+			rendered[obj.GetName()] = true
+		}
+	}
+	dsList := &appsv1.DaemonSetList{}
+	err := c.List(ctx, dsList, client.InNamespace(consts.NetworkOperatorResourceNamespace),
+		client.MatchingLabels{ofedDriverLabel: "true"})
+	if err != nil {
+		return errors.Wrap(err, "failed to list OFED driver DaemonSets")
+	}
+	for i := range dsList.Items {
+		ds := &dsList.Items[i]
+		owner := metav1.GetControllerOf(ds)
+		if rendered[ds.Name] || owner == nil || owner.UID != cr.UID {
+			continue
+		}
+		log.V(consts.LogLevelInfo).Info("Deleting OFED driver DaemonSet which is no longer rendered",
+			"Namespace:", ds.Namespace, "Name:", ds.Name)
+		err := c.Delete(ctx, ds, client.PropagationPolicy(metav1.DeletePropagationBackground))
+		if k8serrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return errors.Wrapf(err, "failed to delete OFED driver DaemonSet %s", ds.Name)
+		}
+		recordEvent(ctx, ds, v1.EventTypeNormal, EventReasonObjectDeleted, "Deleted by state %s", s.name)
+		countPrunedObject(ctx)
+	}
+	return nil
+}
+
 // Get a map of source kinds that should be watched for the state keyed by the source kind name
 func (s *stateOFED) GetWatchSources() map[string]*source.Kind {
 	wr := make(map[string]*source.Kind)
@@ -136,18 +263,17 @@ func (s *stateOFED) GetWatchSources() map[string]*source.Kind {
 func (s *stateOFED) getManifestObjects(
 	cr *mellanoxv1alpha1.NicClusterPolicy,
 	nodeInfo nodeinfo.Provider) ([]*unstructured.Unstructured, error) {
-	attrs := nodeInfo.GetNodesAttributes(
-		nodeinfo.NewNodeLabelFilterBuilder().WithLabel(nodeinfo.NodeLabelMlnxNIC, "true").Build())
+	attrs := s.getEligibleNodes(nodeInfo, map[string]string{nodeinfo.NodeLabelMlnxNIC: "true"})
 	if len(attrs) == 0 {
-		log.V(consts.LogLevelInfo).Info("No nodes with Mellanox NICs where found in the cluster.")
 		return []*unstructured.Unstructured{}, nil
 	}
 
-	// TODO: Render daemonset multiple times according to CPUXOS matrix (ATM assume all nodes are the same)
-	// Note: it is assumed MOFED driver container is able to handle multiple kernel version e.g by triggering DKMS
-	// if driver was compiled against a missmatching kernel to begin with.
-	if err := s.checkAttributesExist(attrs[0],
-		nodeinfo.AttrTypeCPUArch, nodeinfo.AttrTypeOSName, nodeinfo.AttrTypeOSVer); err != nil {
+	// Note: it is assumed MOFED driver container built from source is able to handle multiple kernel version e.g by
+	// triggering DKMS if driver was compiled against a missmatching kernel to begin with.
+	// TODO: Render daemonset per CPU architecture (ATM assume all nodes of an OS distribution are the same)
+	groups, err := s.groupNodesByOS(attrs, cr.Spec.RenderDefaults,
+		featureGates(cr.Spec.FeatureGates).Enabled(ofedPerOSDaemonSetsGate, true))
+	if err != nil {
 		return nil, err
 	}
 
@@ -172,25 +298,94 @@ func (s *stateOFED) getManifestObjects(
 		}
 	}
 
+	if err := validateDNSConfig(cr.Spec.OFEDDriver.DNSConfig); err != nil {
+		return nil, errors.Wrap(err, "invalid DNS config")
+	}
+
+	s.warnings = getUnschedulableRequests(cr.Spec.OFEDDriver.Resources, attrs)
+	for _, warning := range s.warnings {
+		log.V(consts.LogLevelWarning).Info("OFED driver Pods may not be schedulable", "reason:", warning)
+	}
+
+	drivers := ofedDrivers{nodeModes: make(map[string]string, len(attrs))}
+	for i := range groups {
+		group := &groups[i]
+		groupDrivers := getOFEDDrivers(cr.Spec.OFEDDriver, cr.Spec.NodeAffinity, group.OSName, group.OSVer,
+			group.CPUArch, group.attrs)
+		drivers.drivers = append(drivers.drivers, groupDrivers.drivers...)
+		drivers.skippedNodes = append(drivers.skippedNodes, groupDrivers.skippedNodes...)
+		drivers.warnings = append(drivers.warnings, groupDrivers.warnings...)
+		for node, mode := range groupDrivers.nodeModes {
+			drivers.nodeModes[node] = mode
+		}
+		s.osGroups = append(s.osGroups, group.OSGroup)
+	}
+	sort.Strings(drivers.skippedNodes)
+	for _, warning := range drivers.warnings {
+		log.V(consts.LogLevelWarning).Info("OFED driver is not deployed on some nodes", "reason:", warning)
+	}
+	s.warnings = append(s.warnings, drivers.warnings...)
+	s.skippedNodes = drivers.skippedNodes
+	s.nodeModes = drivers.nodeModes
+
+	modprobeConfig, err := getOFEDModprobeConfig(cr.Spec.OFEDDriver, nodeInfo)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid kernel module parameters")
+	}
+
 	renderData := &ofedManifestRenderData{
 		CrSpec: cr.Spec.OFEDDriver,
 		RuntimeSpec: &ofedRuntimeSpec{
-			runtimeSpec: runtimeSpec{consts.NetworkOperatorResourceNamespace},
-			CPUArch:     attrs[0].Attributes[nodeinfo.AttrTypeCPUArch],
-			OSName:      attrs[0].Attributes[nodeinfo.AttrTypeOSName],
-			OSVer:       attrs[0].Attributes[nodeinfo.AttrTypeOSVer],
-			HTTPProxy:   os.Getenv(consts.HTTPProxy),
-			HTTPSProxy:  os.Getenv(consts.HTTPSProxy),
-			NoProxy:     os.Getenv(consts.NoProxy),
+			runtimeSpec: runtimeSpec{
+				Namespace:         consts.NetworkOperatorResourceNamespace,
+				FeatureGates:      cr.Spec.FeatureGates,
+				PriorityClassName: getPriorityClassName(cr),
+				External:          s.externalRenderData,
+			},
+			CPUArch:    groups[0].CPUArch,
+			OSName:     groups[0].OSName,
+			OSVer:      groups[0].OSVer,
+			HTTPProxy:  os.Getenv(consts.HTTPProxy),
+			HTTPSProxy: os.Getenv(consts.HTTPSProxy),
+			NoProxy:    os.Getenv(consts.NoProxy),
 		},
-		NodeAffinity: cr.Spec.NodeAffinity,
+		Drivers:         drivers.drivers,
+		ModprobeConfig:  modprobeConfig,
+		MetricsExporter: getOFEDMetricsExporter(cr.Spec.OFEDDriver),
 	}
 	// render objects
 	log.V(consts.LogLevelDebug).Info("Rendering objects", "data:", renderData)
-	objs, err := s.renderer.RenderObjects(&render.TemplatingData{Data: renderData})
+	renderer, err := s.getRenderer(cr.Spec.OFEDDriver.ManifestVersion)
+	if err != nil {
+		return nil, err
+	}
+	// each driver is rendered with its own render data, the objects shared by the drivers are kept once
+	groupsData := make([]interface{}, 0, len(drivers.drivers))
+	for i := range drivers.drivers {
+		groupData := *renderData
+		groupData.Drivers = drivers.drivers[i : i+1]
+		groupsData = append(groupsData, &groupData)
+	}
+	if len(groupsData) == 0 {
+		groupsData = append(groupsData, renderData)
+	}
+	objs, err := renderNodeGroups(renderer, groupsData, s.renderWorkers)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to render objects")
 	}
 	log.V(consts.LogLevelDebug).Info("Rendered", "objects:", objs)
 	return objs, nil
 }
+
+// validateDNSConfig checks that Pod DNS config nameservers are IP addresses
+func validateDNSConfig(dnsConfig *v1.PodDNSConfig) error {
+	if dnsConfig == nil {
+		return nil
+	}
+	for _, ns := range dnsConfig.Nameservers {
+		if net.ParseIP(ns) == nil {
+			return errors.Errorf("nameserver %q is not a valid IP address", ns)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,612 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"context"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	mellanoxv1alpha1 "github.com/Mellanox/network-operator/api/v1alpha1"
+	"github.com/Mellanox/network-operator/pkg/consts"
+	"github.com/Mellanox/network-operator/pkg/nodeinfo"
+	"github.com/Mellanox/network-operator/pkg/render"
+	"github.com/Mellanox/network-operator/pkg/testing/mocks"
+	"github.com/Mellanox/network-operator/pkg/utils"
+)
+
+var _ = Describe("OFED State tests", func() {
+	var (
+		ofedState stateOFED
+		cr        *mellanoxv1alpha1.NicClusterPolicy
+		nodeInfo  nodeinfo.Provider
+	)
+
+	newNode := func(name string, extraLabels map[string]string) *corev1.Node {
+		labels := map[string]string{
+			nodeinfo.NodeLabelMlnxNIC:  "true",
+			nodeinfo.NodeLabelHostname: name,
+			nodeinfo.NodeLabelCPUArch:  "amd64",
+			nodeinfo.NodeLabelOSName:   "ubuntu",
+			nodeinfo.NodeLabelOSVer:    "20.04",
+		}
+		for k, v := range extraLabels {
+			labels[k] = v
+		}
+		return &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+	}
+
+	BeforeEach(func() {
+		files, err := utils.GetFilesWithSuffix("../../manifests/stage-ofed-driver", render.ManifestFileSuffix...)
+		Expect(err).NotTo(HaveOccurred())
+		ofedState = stateOFED{
+			stateSkel: stateSkel{
+				name:           "state-OFED",
+				description:    "OFED driver deployed in the cluster",
+				clientProvider: NewStaticClientProvider(&mocks.ControllerRutimeClient{}),
+				scheme:         runtime.NewScheme(),
+				renderer:       render.NewRenderer(files),
+			},
+		}
+		cr = &mellanoxv1alpha1.NicClusterPolicy{}
+		cr.Spec.OFEDDriver = &mellanoxv1alpha1.OFEDDriverSpec{
+			ImageSpec: mellanoxv1alpha1.ImageSpec{
+				Image:      "mofed",
+				Repository: "repository",
+				Version:    "5.5",
+			},
+		}
+		nodeInfo = nodeinfo.NewProvider([]*corev1.Node{
+			newNode("node1", nil),
+			newNode("node2", map[string]string{"example.com/nic-group": "a"}),
+		})
+	})
+
+	getObj := func(objs []*unstructured.Unstructured, kind string) *unstructured.Unstructured {
+		for _, obj := range objs {
+			if obj.GetKind() == kind {
+				return obj
+			}
+		}
+		return nil
+	}
+
+	Context("Kernel module parameters", func() {
+		It("Should not render modprobe configuration by default", func() {
+			objs, err := ofedState.getManifestObjects(cr, nodeInfo)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(getObj(objs, "ConfigMap")).To(BeNil())
+
+			ds := getObj(objs, "DaemonSet")
+			Expect(ds).NotTo(BeNil())
+			_, found, err := unstructured.NestedSlice(ds.Object, "spec", "template", "spec", "initContainers")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(found).To(BeFalse())
+		})
+		It("Should render modprobe configuration with per node group overrides", func() {
+			cr.Spec.OFEDDriver.ModuleParams = []mellanoxv1alpha1.KernelModuleParamsSpec{
+				{Module: "mlx5_core", Params: map[string]string{"prof_sel": "2", "probe_vf": "0"}},
+			}
+			cr.Spec.OFEDDriver.ModuleParamsOverrides = []mellanoxv1alpha1.KernelModuleParamsOverrideSpec{{
+				NodeSelector: map[string]string{"example.com/nic-group": "a"},
+				ModuleParams: []mellanoxv1alpha1.KernelModuleParamsSpec{
+					{Module: "mlx5_core", Params: map[string]string{"probe_vf": "1"}},
+					{Module: "ib_core", Params: map[string]string{"netns_mode": "0"}},
+				},
+			}}
+			objs, err := ofedState.getManifestObjects(cr, nodeInfo)
+			Expect(err).NotTo(HaveOccurred())
+
+			cm := getObj(objs, "ConfigMap")
+			Expect(cm).NotTo(BeNil())
+			Expect(cm.GetName()).To(Equal("ofed-modprobe-config"))
+			data, _, err := unstructured.NestedStringMap(cm.Object, "data")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(data).To(Equal(map[string]string{
+				"default.conf": "options mlx5_core probe_vf=0 prof_sel=2\n",
+				"node2.conf":   "options mlx5_core probe_vf=1 prof_sel=2\noptions ib_core netns_mode=0\n",
+			}))
+
+			ds := getObj(objs, "DaemonSet")
+			initContainers, found, err := unstructured.NestedSlice(
+				ds.Object, "spec", "template", "spec", "initContainers")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(found).To(BeTrue())
+			Expect(initContainers[0].(map[string]interface{})["name"]).To(Equal("modprobe-config"))
+		})
+		It("Should fail on invalid kernel module parameters", func() {
+			cr.Spec.OFEDDriver.ModuleParams = []mellanoxv1alpha1.KernelModuleParamsSpec{
+				{Module: "mlx5_core", Params: map[string]string{"prof_sel": "2\ninstall evil"}},
+			}
+			_, err := ofedState.getManifestObjects(cr, nodeInfo)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("DNS config", func() {
+		It("Should render DNS config when set", func() {
+			cr.Spec.OFEDDriver.DNSConfig = &corev1.PodDNSConfig{
+				Nameservers: []string{"10.0.0.10"},
+				Searches:    []string{"internal.example.com"},
+			}
+			objs, err := ofedState.getManifestObjects(cr, nodeInfo)
+			Expect(err).NotTo(HaveOccurred())
+
+			ds := getObj(objs, "DaemonSet")
+			Expect(ds).NotTo(BeNil())
+			dnsConfig, found, err := unstructured.NestedMap(ds.Object, "spec", "template", "spec", "dnsConfig")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(found).To(BeTrue())
+			Expect(dnsConfig).To(Equal(map[string]interface{}{
+				"nameservers": []interface{}{"10.0.0.10"},
+				"searches":    []interface{}{"internal.example.com"},
+			}))
+		})
+		It("Should not render DNS config by default", func() {
+			objs, err := ofedState.getManifestObjects(cr, nodeInfo)
+			Expect(err).NotTo(HaveOccurred())
+			_, found, err := unstructured.NestedMap(
+				getObj(objs, "DaemonSet").Object, "spec", "template", "spec", "dnsConfig")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(found).To(BeFalse())
+		})
+		It("Should fail on nameserver which is not an IP address", func() {
+			cr.Spec.OFEDDriver.DNSConfig = &corev1.PodDNSConfig{Nameservers: []string{"dns.example.com"}}
+			_, err := ofedState.getManifestObjects(cr, nodeInfo)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("Resource requests", func() {
+		BeforeEach(func() {
+			node1 := newNode("node1", nil)
+			node1.Status.Allocatable = corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("4"),
+				corev1.ResourceMemory: resource.MustParse("8Gi"),
+			}
+			node2 := newNode("node2", nil)
+			node2.Status.Allocatable = corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("8"),
+				corev1.ResourceMemory: resource.MustParse("4Gi"),
+			}
+			nodeInfo = nodeinfo.NewProvider([]*corev1.Node{node1, node2})
+		})
+
+		It("Should render resources when set", func() {
+			cr.Spec.OFEDDriver.Resources = &corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("500m")},
+			}
+			objs, err := ofedState.getManifestObjects(cr, nodeInfo)
+			Expect(err).NotTo(HaveOccurred())
+			containers, found, err := unstructured.NestedSlice(
+				getObj(objs, "DaemonSet").Object, "spec", "template", "spec", "containers")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(found).To(BeTrue())
+			cpu, found, err := unstructured.NestedString(
+				containers[0].(map[string]interface{}), "resources", "requests", "cpu")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(found).To(BeTrue())
+			Expect(cpu).To(Equal("500m"))
+			Expect(ofedState.Warnings()).To(BeEmpty())
+		})
+		It("Should warn when requests exceed the allocatable resources of all nodes", func() {
+			cr.Spec.OFEDDriver.Resources = &corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceCPU:    resource.MustParse("6"),
+					corev1.ResourceMemory: resource.MustParse("16Gi"),
+				},
+			}
+			objs, err := ofedState.getManifestObjects(cr, nodeInfo)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(objs).NotTo(BeEmpty())
+			Expect(ofedState.Warnings()).To(Equal([]string{
+				"requested memory 16Gi exceeds the maximum allocatable 8Gi of eligible nodes",
+			}))
+		})
+		It("Should warn when limits exceed allocatable resources and requests are not set", func() {
+			cr.Spec.OFEDDriver.Resources = &corev1.ResourceRequirements{
+				Limits: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("16")},
+			}
+			_, err := ofedState.getManifestObjects(cr, nodeInfo)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ofedState.Warnings()).To(Equal([]string{
+				"requested cpu 16 exceeds the maximum allocatable 8 of eligible nodes",
+			}))
+		})
+		It("Should warn when requested resource is not allocatable on any node", func() {
+			cr.Spec.OFEDDriver.Resources = &corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{"hugepages-1Gi": resource.MustParse("2Gi")},
+			}
+			_, err := ofedState.getManifestObjects(cr, nodeInfo)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ofedState.Warnings()).To(Equal([]string{
+				"requested hugepages-1Gi 2Gi is not allocatable on any eligible node",
+			}))
+		})
+	})
+
+	Context("Render defaults", func() {
+		getImage := func(objs []*unstructured.Unstructured) string {
+			containers, _, err := unstructured.NestedSlice(
+				getObj(objs, "DaemonSet").Object, "spec", "template", "spec", "containers")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(containers).NotTo(BeEmpty())
+			return containers[0].(map[string]interface{})["image"].(string)
+		}
+
+		It("Should use the render default of an empty node attribute", func() {
+			nodeInfo = nodeinfo.NewProvider([]*corev1.Node{
+				newNode("node1", map[string]string{nodeinfo.NodeLabelOSName: ""}),
+			})
+			cr.Spec.RenderDefaults = &mellanoxv1alpha1.RenderDefaultsSpec{OSName: "rhel", OSVer: "8.6"}
+			objs, err := ofedState.getManifestObjects(cr, nodeInfo)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(getImage(objs)).To(Equal("repository/mofed-5.5:rhel20.04-amd64"))
+		})
+		It("Should fail when a node attribute is neither set nor defaulted", func() {
+			nodeInfo = nodeinfo.NewProvider([]*corev1.Node{
+				newNode("node1", map[string]string{nodeinfo.NodeLabelOSName: ""}),
+			})
+			_, err := ofedState.getManifestObjects(cr, nodeInfo)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("No eligible nodes", func() {
+		It("Should report the node filter when no nodes match it and clear it once a node matches", func() {
+			objs, err := ofedState.getManifestObjects(cr, nodeinfo.NewProvider([]*corev1.Node{}))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(objs).To(BeEmpty())
+			Expect(ofedState.NoEligibleNodesFilter()).To(Equal(nodeinfo.NodeLabelMlnxNIC + "=true"))
+
+			objs, err = ofedState.getManifestObjects(cr, nodeInfo)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(objs).NotTo(BeEmpty())
+			Expect(ofedState.NoEligibleNodesFilter()).To(BeEmpty())
+		})
+	})
+
+	Context("Precompiled driver", func() {
+		const precompiledKernel = "5.4.0-42-generic"
+		const otherKernel = "5.15.0-25-generic"
+
+		getDaemonSets := func(objs []*unstructured.Unstructured) map[string]*unstructured.Unstructured {
+			daemonSets := map[string]*unstructured.Unstructured{}
+			for _, obj := range objs {
+				if obj.GetKind() == "DaemonSet" {
+					daemonSets[obj.GetName()] = obj
+				}
+			}
+			return daemonSets
+		}
+		getImage := func(ds *unstructured.Unstructured) string {
+			containers, _, err := unstructured.NestedSlice(ds.Object, "spec", "template", "spec", "containers")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(containers).To(HaveLen(1))
+			return containers[0].(map[string]interface{})["image"].(string)
+		}
+		getNodeSelector := func(ds *unstructured.Unstructured) map[string]string {
+			nodeSelector, _, err := unstructured.NestedStringMap(
+				ds.Object, "spec", "template", "spec", "nodeSelector")
+			Expect(err).NotTo(HaveOccurred())
+			return nodeSelector
+		}
+
+		BeforeEach(func() {
+			nodeInfo = nodeinfo.NewProvider([]*corev1.Node{
+				newNode("node1", map[string]string{nodeinfo.NodeLabelKernelVerFull: precompiledKernel}),
+				newNode("node2", map[string]string{nodeinfo.NodeLabelKernelVerFull: otherKernel}),
+			})
+		})
+
+		It("Should build the driver from source on all nodes by default", func() {
+			objs, err := ofedState.getManifestObjects(cr, nodeInfo)
+			Expect(err).NotTo(HaveOccurred())
+			daemonSets := getDaemonSets(objs)
+			Expect(daemonSets).To(HaveLen(1))
+			ds := daemonSets["mofed-ubuntu20.04-ds"]
+			Expect(ds).NotTo(BeNil())
+			Expect(getImage(ds)).To(Equal("repository/mofed-5.5:ubuntu20.04-amd64"))
+			Expect(getNodeSelector(ds)).NotTo(HaveKey(nodeinfo.NodeLabelKernelVerFull))
+			Expect(ofedState.NodeModes()).To(Equal(map[string]string{
+				"node1": ofedNodeModeSource, "node2": ofedNodeModeSource}))
+			Expect(ofedState.SkippedNodes()).To(BeEmpty())
+		})
+		It("Should build the driver from source on nodes without a precompiled image when falling back", func() {
+			cr.Spec.OFEDDriver.PrecompiledKernels = []mellanoxv1alpha1.KernelVersion{precompiledKernel}
+			cr.Spec.OFEDDriver.PrecompiledFallbackToSource = true
+			objs, err := ofedState.getManifestObjects(cr, nodeInfo)
+			Expect(err).NotTo(HaveOccurred())
+			daemonSets := getDaemonSets(objs)
+			Expect(daemonSets).To(HaveLen(2))
+
+			precompiled := daemonSets["mofed-ubuntu20.04-5.4.0-42-generic-ds"]
+			Expect(precompiled).NotTo(BeNil())
+			Expect(getImage(precompiled)).To(Equal("repository/mofed-5.5:5.4.0-42-generic-ubuntu20.04-amd64"))
+			Expect(getNodeSelector(precompiled)).To(
+				HaveKeyWithValue(nodeinfo.NodeLabelKernelVerFull, precompiledKernel))
+
+			source := daemonSets["mofed-ubuntu20.04-ds"]
+			Expect(source).NotTo(BeNil())
+			Expect(getImage(source)).To(Equal("repository/mofed-5.5:ubuntu20.04-amd64"))
+			Expect(getNodeSelector(source)).NotTo(HaveKey(nodeinfo.NodeLabelKernelVerFull))
+			terms, found, err := unstructured.NestedSlice(source.Object, "spec", "template", "spec", "affinity",
+				"nodeAffinity", "requiredDuringSchedulingIgnoredDuringExecution", "nodeSelectorTerms")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(found).To(BeTrue())
+			Expect(terms).To(HaveLen(1))
+			Expect(terms[0].(map[string]interface{})["matchExpressions"]).To(Equal([]interface{}{
+				map[string]interface{}{
+					"key":      nodeinfo.NodeLabelKernelVerFull,
+					"operator": "NotIn",
+					"values":   []interface{}{precompiledKernel},
+				},
+			}))
+
+			Expect(ofedState.NodeModes()).To(Equal(map[string]string{
+				"node1": ofedNodeModePrecompiled, "node2": ofedNodeModeSource}))
+			Expect(ofedState.SkippedNodes()).To(BeEmpty())
+			Expect(ofedState.Warnings()).To(BeEmpty())
+		})
+		It("Should skip nodes without a precompiled image when not falling back", func() {
+			cr.Spec.OFEDDriver.PrecompiledKernels = []mellanoxv1alpha1.KernelVersion{precompiledKernel}
+			objs, err := ofedState.getManifestObjects(cr, nodeInfo)
+			Expect(err).NotTo(HaveOccurred())
+			daemonSets := getDaemonSets(objs)
+			Expect(daemonSets).To(HaveLen(1))
+			Expect(daemonSets).To(HaveKey("mofed-ubuntu20.04-5.4.0-42-generic-ds"))
+
+			Expect(ofedState.NodeModes()).To(Equal(map[string]string{"node1": ofedNodeModePrecompiled}))
+			Expect(ofedState.SkippedNodes()).To(Equal([]string{"node2"}))
+			Expect(ofedState.Warnings()).To(HaveLen(1))
+			Expect(ofedState.Warnings()[0]).To(ContainSubstring(otherKernel))
+			Expect(ofedState.Warnings()[0]).To(ContainSubstring("precompiledFallbackToSource"))
+		})
+		It("Should delete the driver built from source when switching to precompiled drivers", func() {
+			scheme := runtime.NewScheme()
+			Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+			Expect(mellanoxv1alpha1.AddToScheme(scheme)).To(Succeed())
+			k8sClient := fake.NewClientBuilder().WithScheme(scheme).Build()
+			ofedState.clientProvider = NewStaticClientProvider(k8sClient)
+			ofedState.scheme = scheme
+			cr.Name = "nic-cluster-policy"
+			cr.UID = "uid-nic-cluster-policy"
+			catalog := NewInfoCatalog()
+			catalog.Add(InfoTypeNodeInfo, nodeInfo)
+			getDaemonSetNames := func() []string {
+				dsList := &appsv1.DaemonSetList{}
+				Expect(k8sClient.List(context.Background(), dsList, client.MatchingLabels{ofedDriverLabel: "true"})).
+					To(Succeed())
+				names := []string{}
+				for _, ds := range dsList.Items {
+					names = append(names, ds.Name)
+				}
+				return names
+			}
+
+			_, err := ofedState.Sync(context.Background(), cr, catalog)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(getDaemonSetNames()).To(ConsistOf("mofed-ubuntu20.04-ds"))
+
+			cr.Spec.OFEDDriver.PrecompiledKernels = []mellanoxv1alpha1.KernelVersion{precompiledKernel}
+			_, err = ofedState.Sync(context.Background(), cr, catalog)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(getDaemonSetNames()).To(ConsistOf("mofed-ubuntu20.04-5.4.0-42-generic-ds"))
+		})
+		It("Should keep driver DaemonSets which are not owned by the policy", func() {
+			scheme := runtime.NewScheme()
+			Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+			Expect(mellanoxv1alpha1.AddToScheme(scheme)).To(Succeed())
+			other := &appsv1.DaemonSet{ObjectMeta: metav1.ObjectMeta{
+				Name:      "mofed-other-ds",
+				Namespace: consts.NetworkOperatorResourceNamespace,
+				Labels:    map[string]string{ofedDriverLabel: "true"},
+			}}
+			k8sClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(other).Build()
+
+			Expect(ofedState.deleteStaleDrivers(context.Background(), k8sClient, cr, nil)).To(Succeed())
+			Expect(k8sClient.Get(context.Background(), client.ObjectKeyFromObject(other), &appsv1.DaemonSet{})).
+				To(Succeed())
+		})
+		It("Should shorten the precompiled driver name exceeding the label value length limit", func() {
+			kernel := "5.4.0-42-generic-" + strings.Repeat("a", 50)
+			name := getOFEDPrecompiledDriverName("mofed-ubuntu20.04", kernel)
+			Expect(len(name)).To(BeNumerically("<=", validation.LabelValueMaxLength))
+			Expect(name).NotTo(Equal(getOFEDPrecompiledDriverName("mofed-ubuntu20.04", kernel+"b")))
+		})
+	})
+
+	Context("Multiple OS distributions", func() {
+		BeforeEach(func() {
+			nodeInfo = nodeinfo.NewProvider([]*corev1.Node{
+				newNode("node1", nil),
+				newNode("node2", map[string]string{nodeinfo.NodeLabelOSName: "rhel", nodeinfo.NodeLabelOSVer: "8.6"}),
+				newNode("node3", nil),
+			})
+		})
+
+		getDaemonSets := func(objs []*unstructured.Unstructured) map[string]*unstructured.Unstructured {
+			daemonSets := map[string]*unstructured.Unstructured{}
+			for _, obj := range objs {
+				if obj.GetKind() == "DaemonSet" {
+					daemonSets[obj.GetName()] = obj
+				}
+			}
+			return daemonSets
+		}
+		getImageAndNodeSelector := func(ds *unstructured.Unstructured) (string, map[string]string) {
+			containers, _, err := unstructured.NestedSlice(ds.Object, "spec", "template", "spec", "containers")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(containers).To(HaveLen(1))
+			nodeSelector, _, err := unstructured.NestedStringMap(
+				ds.Object, "spec", "template", "spec", "nodeSelector")
+			Expect(err).NotTo(HaveOccurred())
+			return containers[0].(map[string]interface{})["image"].(string), nodeSelector
+		}
+
+		It("Should render a driver selecting the nodes of each OS distribution", func() {
+			objs, err := ofedState.getManifestObjects(cr, nodeInfo)
+			Expect(err).NotTo(HaveOccurred())
+			daemonSets := getDaemonSets(objs)
+			Expect(daemonSets).To(HaveLen(2))
+
+			image, nodeSelector := getImageAndNodeSelector(daemonSets["mofed-rhel8.6-ds"])
+			Expect(image).To(Equal("repository/mofed-5.5:rhel8.6-amd64"))
+			Expect(nodeSelector).To(HaveKeyWithValue("feature.node.kubernetes.io/system-os_release.ID", "rhel"))
+			Expect(nodeSelector).To(HaveKeyWithValue("feature.node.kubernetes.io/system-os_release.VERSION_ID", "8.6"))
+
+			image, nodeSelector = getImageAndNodeSelector(daemonSets["mofed-ubuntu20.04-ds"])
+			Expect(image).To(Equal("repository/mofed-5.5:ubuntu20.04-amd64"))
+			Expect(nodeSelector).To(HaveKeyWithValue("feature.node.kubernetes.io/system-os_release.ID", "ubuntu"))
+			Expect(nodeSelector).To(
+				HaveKeyWithValue("feature.node.kubernetes.io/system-os_release.VERSION_ID", "20.04"))
+
+			Expect(ofedState.OSGroups()).To(Equal([]OSGroup{
+				{OSName: "rhel", OSVer: "8.6", Nodes: []string{"node2"}},
+				{OSName: "ubuntu", OSVer: "20.04", Nodes: []string{"node1", "node3"}},
+			}))
+		})
+		It("Should render a single driver when disabled by the feature gate", func() {
+			cr.Spec.FeatureGates = map[string]bool{ofedPerOSDaemonSetsGate: false}
+			objs, err := ofedState.getManifestObjects(cr, nodeInfo)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(getDaemonSets(objs)).To(HaveLen(1))
+			Expect(getDaemonSets(objs)).To(HaveKey("mofed-ubuntu20.04-ds"))
+			Expect(ofedState.OSGroups()).To(Equal([]OSGroup{
+				{OSName: "ubuntu", OSVer: "20.04", Nodes: []string{"node1", "node2", "node3"}},
+			}))
+		})
+		It("Should render the OpenShift objects when one of the OS distributions is RHCOS", func() {
+			nodeInfo = nodeinfo.NewProvider([]*corev1.Node{
+				newNode("node1", nil),
+				newNode("node2", map[string]string{nodeinfo.NodeLabelOSName: "rhcos", nodeinfo.NodeLabelOSVer: "4.10"}),
+			})
+			objs, err := ofedState.getManifestObjects(cr, nodeInfo)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(getObj(objs, "ServiceAccount")).NotTo(BeNil())
+			daemonSets := getDaemonSets(objs)
+			Expect(daemonSets).To(HaveLen(2))
+			Expect(daemonSets["mofed-rhcos4.10-ds"].Object).To(HaveKeyWithValue("spec", HaveKeyWithValue("template",
+				HaveKeyWithValue("spec", HaveKeyWithValue("serviceAccountName", "ofed-driver")))))
+			_, found, err := unstructured.NestedString(daemonSets["mofed-ubuntu20.04-ds"].Object,
+				"spec", "template", "spec", "serviceAccountName")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(found).To(BeFalse())
+		})
+	})
+
+	Context("Metrics exporter", func() {
+		getContainer := func(ds *unstructured.Unstructured, name string) map[string]interface{} {
+			containers, _, err := unstructured.NestedSlice(ds.Object, "spec", "template", "spec", "containers")
+			Expect(err).NotTo(HaveOccurred())
+			for _, c := range containers {
+				if c.(map[string]interface{})["name"] == name {
+					return c.(map[string]interface{})
+				}
+			}
+			return nil
+		}
+
+		BeforeEach(func() {
+			cr.Spec.OFEDDriver.MetricsExporter = &mellanoxv1alpha1.OFEDMetricsExporterSpec{
+				Enabled: true,
+				ImageSpec: mellanoxv1alpha1.ImageSpec{
+					Image:      "rdma-metrics-exporter",
+					Repository: "repository",
+					Version:    "v0.1.0",
+				},
+			}
+		})
+
+		It("Should render the exporter sidecar and its container port when enabled", func() {
+			objs, err := ofedState.getManifestObjects(cr, nodeInfo)
+			Expect(err).NotTo(HaveOccurred())
+
+			exporter := getContainer(getObj(objs, "DaemonSet"), "metrics-exporter")
+			Expect(exporter).NotTo(BeNil())
+			Expect(exporter["image"]).To(Equal("repository/rdma-metrics-exporter:v0.1.0"))
+			ports, _, err := unstructured.NestedSlice(exporter, "ports")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ports).To(ConsistOf(map[string]interface{}{
+				"name":          "metrics",
+				"containerPort": int64(ofedMetricsExporterDefaultPort),
+				"protocol":      "TCP",
+			}))
+
+			service := getObj(objs, "Service")
+			Expect(service).NotTo(BeNil())
+			Expect(service.GetName()).To(Equal("ofed-metrics-exporter"))
+			Expect(getObj(objs, serviceMonitorKind)).To(BeNil())
+		})
+		It("Should render the ServiceMonitor when set", func() {
+			cr.Spec.OFEDDriver.MetricsExporter.Port = 9900
+			cr.Spec.OFEDDriver.MetricsExporter.ServiceMonitor = true
+			objs, err := ofedState.getManifestObjects(cr, nodeInfo)
+			Expect(err).NotTo(HaveOccurred())
+			ports, _, err := unstructured.NestedSlice(
+				getContainer(getObj(objs, "DaemonSet"), "metrics-exporter"), "ports")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ports[0].(map[string]interface{})["containerPort"]).To(Equal(int64(9900)))
+			Expect(getObj(objs, serviceMonitorKind)).NotTo(BeNil())
+		})
+		It("Should not render the exporter when disabled", func() {
+			cr.Spec.OFEDDriver.MetricsExporter.Enabled = false
+			cr.Spec.OFEDDriver.MetricsExporter.ServiceMonitor = true
+			objs, err := ofedState.getManifestObjects(cr, nodeInfo)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(getContainer(getObj(objs, "DaemonSet"), "metrics-exporter")).To(BeNil())
+			Expect(getObj(objs, "Service")).To(BeNil())
+			Expect(getObj(objs, serviceMonitorKind)).To(BeNil())
+		})
+		It("Should skip the ServiceMonitor when its API is not present", func() {
+			cr.Spec.OFEDDriver.MetricsExporter.ServiceMonitor = true
+			objs, err := ofedState.getManifestObjects(cr, nodeInfo)
+			Expect(err).NotTo(HaveOccurred())
+
+			scheme := runtime.NewScheme()
+			Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+			filtered, err := skipServiceMonitor(context.Background(), fake.NewClientBuilder().WithScheme(scheme).Build(),
+				objs)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(filtered).To(HaveLen(len(objs) - 1))
+			Expect(getObj(filtered, serviceMonitorKind)).To(BeNil())
+			Expect(getObj(filtered, "Service")).NotTo(BeNil())
+
+			crd := &unstructured.Unstructured{}
+			crd.SetAPIVersion("apiextensions.k8s.io/v1")
+			crd.SetKind("CustomResourceDefinition")
+			crd.SetName(serviceMonitorCRDName)
+			filtered, err = skipServiceMonitor(context.Background(),
+				fake.NewClientBuilder().WithScheme(scheme).WithObjects(crd).Build(), objs)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(filtered).To(Equal(objs))
+		})
+	})
+})
@@ -0,0 +1,171 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	mellanoxv1alpha1 "github.com/Mellanox/network-operator/api/v1alpha1"
+	"github.com/Mellanox/network-operator/pkg/consts"
+)
+
+const (
+	statePodSecurityAdmissionName        = "state-pod-security-admission"
+	statePodSecurityAdmissionDescription = "Pod Security Admission labels applied on the operator resources namespace"
+	psaLabelPrefix                       = "pod-security.kubernetes.io/"
+	psaDefaultLevel                      = "privileged"
+)
+
+// Pod Security Admission modes labeled on the namespace
+var psaModes = []string{"enforce", "audit", "warn"}
+
+// NewStatePodSecurityAdmission creates a new pod security admission state
+func NewStatePodSecurityAdmission(clientProvider ClientProvider, scheme *runtime.Scheme) (State, error) {
+	return &statePodSecurityAdmission{
+		stateSkel: stateSkel{
+			name:           statePodSecurityAdmissionName,
+			description:    statePodSecurityAdmissionDescription,
+			clientProvider: clientProvider,
+			scheme:         scheme,
+		}}, nil
+}
+
+// statePodSecurityAdmission labels the operator resources namespace with Pod Security Admission labels.
+// The namespace is not rendered from manifests as it is created during the operator deployment, only its labels
+// are reconciled.
+type statePodSecurityAdmission struct {
+	stateSkel
+}
+
+// Sync attempt to get the system to match the desired state which State represent.
+// a sync operation must be relatively short and must not block the execution thread.
+func (s *statePodSecurityAdmission) Sync(
+	ctx context.Context, customResource interface{}, _ InfoCatalog) (SyncState, error) {
+	cr := customResource.(*mellanoxv1alpha1.NicClusterPolicy)
+	log.V(consts.LogLevelInfo).Info(
+		"Sync Custom resource", "State:", s.name, "Name:", cr.Name, "Namespace:", cr.Namespace)
+
+	enabled := cr.Spec.PSA != nil && cr.Spec.PSA.Enabled
+
+	k8sClient, err := s.getClient(cr)
+	if err != nil {
+		return SyncStateNotReady, err
+	}
+
+	ns := &corev1.Namespace{}
+	err = k8sClient.Get(ctx, types.NamespacedName{Name: consts.NetworkOperatorResourceNamespace}, ns)
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			log.V(consts.LogLevelInfo).Info("Namespace does not exist (yet)",
+				"Namespace:", consts.NetworkOperatorResourceNamespace)
+			if !enabled {
+				return SyncStateIgnore, nil
+			}
+			return SyncStateNotReady, nil
+		}
+		return SyncStateNotReady, errors.Wrap(err, "failed to get operator resources namespace")
+	}
+
+	// Only label namespaces that were created for the operator, never relabel a namespace which is shared
+	// with other workloads.
+	if ns.GetLabels()[consts.NetworkOperatorOwnedLabel] != "true" {
+		if enabled {
+			log.V(consts.LogLevelWarning).Info("Namespace is not owned by the operator, skipping. "+
+				"Label the namespace to allow the operator to manage pod security admission labels",
+				"Namespace:", ns.Name, "label", consts.NetworkOperatorOwnedLabel)
+		}
+		return SyncStateIgnore, nil
+	}
+
+	if !enabled {
+		// The namespace is owned by the operator, revert labels which may have been applied while
+		// the feature was enabled.
+		if err := s.patchLabels(k8sClient, ns, nil); err != nil {
+			return SyncStateNotReady, errors.Wrap(err, "failed to remove pod security admission labels")
+		}
+		log.V(consts.LogLevelInfo).Info("pod security admission is not enabled, no action required")
+		return SyncStateIgnore, nil
+	}
+
+	if err := s.patchLabels(k8sClient, ns, getPSALabels(cr.Spec.PSA)); err != nil {
+		return SyncStateNotReady, errors.Wrap(err, "failed to update pod security admission labels")
+	}
+	return SyncStateReady, nil
+}
+
+// patchLabels sets the Pod Security Admission labels of the namespace to desired, any Pod Security Admission
+// label which is not in desired is removed. The namespace is patched only if its labels change.
+func (s *statePodSecurityAdmission) patchLabels(
+	c client.Client, ns *corev1.Namespace, desired map[string]string) error {
+	if !needsLabelsUpdate(ns.GetLabels(), desired) {
+		return nil
+	}
+	patch := client.MergeFrom(ns.DeepCopy())
+	labels := ns.GetLabels()
+	for _, mode := range psaModes {
+		delete(labels, psaLabelPrefix+mode)
+	}
+	for k, v := range desired {
+		labels[k] = v
+	}
+	ns.SetLabels(labels)
+	if err := c.Patch(context.TODO(), ns, patch); err != nil {
+		return err
+	}
+	log.V(consts.LogLevelInfo).Info("Pod security admission labels updated", "Namespace:", ns.Name, "labels", desired)
+	return nil
+}
+
+// Get a map of source kinds that should be watched for the state keyed by the source kind name
+func (s *statePodSecurityAdmission) GetWatchSources() map[string]*source.Kind {
+	// Namespace is not owned by the NicClusterPolicy, nothing to watch.
+	return make(map[string]*source.Kind)
+}
+
+// getPSALabels returns Pod Security Admission labels for all modes according to PSASpec
+func getPSALabels(spec *mellanoxv1alpha1.PSASpec) map[string]string {
+	level := spec.Level
+	if level == "" {
+		level = psaDefaultLevel
+	}
+	labels := make(map[string]string, len(psaModes))
+	for _, mode := range psaModes {
+		labels[psaLabelPrefix+mode] = level
+	}
+	return labels
+}
+
+// needsLabelsUpdate returns true if the Pod Security Admission labels in current differ from desired
+func needsLabelsUpdate(current, desired map[string]string) bool {
+	for _, mode := range psaModes {
+		key := psaLabelPrefix + mode
+		cv, cok := current[key]
+		dv, dok := desired[key]
+		if cok != dok || cv != dv {
+			return true
+		}
+	}
+	return false
+}
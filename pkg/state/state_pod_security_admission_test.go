@@ -0,0 +1,121 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	mellanoxv1alpha1 "github.com/Mellanox/network-operator/api/v1alpha1"
+	"github.com/Mellanox/network-operator/pkg/consts"
+)
+
+var _ = Describe("Pod Security Admission State tests", func() {
+	var (
+		ns *corev1.Namespace
+		cr *mellanoxv1alpha1.NicClusterPolicy
+	)
+
+	BeforeEach(func() {
+		ns = &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   consts.NetworkOperatorResourceNamespace,
+				Labels: map[string]string{consts.NetworkOperatorOwnedLabel: "true"},
+			},
+		}
+		cr = &mellanoxv1alpha1.NicClusterPolicy{}
+		cr.Name = consts.NicClusterPolicyResourceName
+	})
+
+	syncAndGetNamespace := func(expected SyncState) *corev1.Namespace {
+		k8sClient := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(ns).Build()
+		psaState, err := NewStatePodSecurityAdmission(NewStaticClientProvider(k8sClient), scheme.Scheme)
+		Expect(err).NotTo(HaveOccurred())
+
+		syncState, err := psaState.Sync(context.Background(), cr, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(syncState).To(Equal(expected))
+
+		found := &corev1.Namespace{}
+		err = k8sClient.Get(context.TODO(), types.NamespacedName{Name: ns.Name}, found)
+		Expect(err).NotTo(HaveOccurred())
+		return found
+	}
+
+	Context("PSA is enabled", func() {
+		It("Should label the namespace with privileged level", func() {
+			cr.Spec.PSA = &mellanoxv1alpha1.PSASpec{Enabled: true}
+			found := syncAndGetNamespace(SyncStateReady)
+			Expect(found.Labels).To(HaveKeyWithValue("pod-security.kubernetes.io/enforce", "privileged"))
+			Expect(found.Labels).To(HaveKeyWithValue("pod-security.kubernetes.io/audit", "privileged"))
+			Expect(found.Labels).To(HaveKeyWithValue("pod-security.kubernetes.io/warn", "privileged"))
+			Expect(found.Labels).To(HaveKeyWithValue(consts.NetworkOperatorOwnedLabel, "true"))
+		})
+		It("Should label the namespace with the requested level", func() {
+			cr.Spec.PSA = &mellanoxv1alpha1.PSASpec{Enabled: true, Level: "baseline"}
+			found := syncAndGetNamespace(SyncStateReady)
+			Expect(found.Labels).To(HaveKeyWithValue("pod-security.kubernetes.io/enforce", "baseline"))
+		})
+		It("Should not label a namespace which is not owned by the operator", func() {
+			ns.Labels = nil
+			cr.Spec.PSA = &mellanoxv1alpha1.PSASpec{Enabled: true}
+			found := syncAndGetNamespace(SyncStateIgnore)
+			Expect(found.Labels).NotTo(HaveKey("pod-security.kubernetes.io/enforce"))
+		})
+		It("Should keep the namespace labels if they are up to date", func() {
+			ns.Labels["pod-security.kubernetes.io/enforce"] = "privileged"
+			ns.Labels["pod-security.kubernetes.io/audit"] = "privileged"
+			ns.Labels["pod-security.kubernetes.io/warn"] = "privileged"
+			ns.ResourceVersion = "10"
+			cr.Spec.PSA = &mellanoxv1alpha1.PSASpec{Enabled: true}
+			found := syncAndGetNamespace(SyncStateReady)
+			Expect(found.Labels).To(HaveKeyWithValue("pod-security.kubernetes.io/enforce", "privileged"))
+			Expect(found.ResourceVersion).To(Equal("10"))
+		})
+	})
+
+	Context("PSA is disabled", func() {
+		It("Should not label the namespace", func() {
+			found := syncAndGetNamespace(SyncStateIgnore)
+			Expect(found.Labels).NotTo(HaveKey("pod-security.kubernetes.io/enforce"))
+		})
+		It("Should remove previously applied labels", func() {
+			ns.Labels["pod-security.kubernetes.io/enforce"] = "privileged"
+			ns.Labels["pod-security.kubernetes.io/audit"] = "privileged"
+			ns.Labels["pod-security.kubernetes.io/warn"] = "privileged"
+			cr.Spec.PSA = &mellanoxv1alpha1.PSASpec{Enabled: false}
+			found := syncAndGetNamespace(SyncStateIgnore)
+			Expect(found.Labels).NotTo(HaveKey("pod-security.kubernetes.io/enforce"))
+			Expect(found.Labels).NotTo(HaveKey("pod-security.kubernetes.io/audit"))
+			Expect(found.Labels).NotTo(HaveKey("pod-security.kubernetes.io/warn"))
+			Expect(found.Labels).To(HaveKeyWithValue(consts.NetworkOperatorOwnedLabel, "true"))
+		})
+		It("Should not remove labels from a namespace which is not owned by the operator", func() {
+			ns.Labels = map[string]string{"pod-security.kubernetes.io/enforce": "baseline"}
+			found := syncAndGetNamespace(SyncStateIgnore)
+			Expect(found.Labels).To(HaveKeyWithValue("pod-security.kubernetes.io/enforce", "baseline"))
+		})
+	})
+})
@@ -17,11 +17,12 @@ limitations under the License.
 package state //nolint:dupl
 
 import (
+	"context"
+
 	"github.com/pkg/errors"
 	policyv1beta1 "k8s.io/api/policy/v1beta1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
-	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/source"
 
@@ -32,7 +33,8 @@ import (
 )
 
 // NewStatePodSecurityPolicy creates a new pod security policy state
-func NewStatePodSecurityPolicy(k8sAPIClient client.Client, scheme *runtime.Scheme, manifestDir string) (State, error) {
+func NewStatePodSecurityPolicy(
+	clientProvider ClientProvider, scheme *runtime.Scheme, manifestDir string) (State, error) {
 	files, err := utils.GetFilesWithSuffix(manifestDir, render.ManifestFileSuffix...)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to get files from manifest dir")
@@ -41,11 +43,11 @@ func NewStatePodSecurityPolicy(k8sAPIClient client.Client, scheme *runtime.Schem
 	renderer := render.NewRenderer(files)
 	return &statePodSecurityPolicy{
 		stateSkel: stateSkel{
-			name:        "state-pod-security-policy",
-			description: "Privileged pod security policy deployed in the cluster",
-			client:      k8sAPIClient,
-			scheme:      scheme,
-			renderer:    renderer,
+			name:           "state-pod-security-policy",
+			description:    "Privileged pod security policy deployed in the cluster",
+			clientProvider: clientProvider,
+			scheme:         scheme,
+			renderer:       renderer,
 		}}, nil
 }
 
@@ -60,7 +62,8 @@ type podSecurityPolicyManifestRenderData struct {
 // Sync attempt to get the system to match the desired state which State represent.
 // a sync operation must be relatively short and must not block the execution thread.
 //nolint:dupl
-func (s *statePodSecurityPolicy) Sync(customResource interface{}, infoCatalog InfoCatalog) (SyncState, error) {
+func (s *statePodSecurityPolicy) Sync(
+	ctx context.Context, customResource interface{}, infoCatalog InfoCatalog) (SyncState, error) {
 	cr := customResource.(*mellanoxv1alpha1.NicClusterPolicy)
 	log.V(consts.LogLevelInfo).Info(
 		"Sync Custom resource", "State:", s.name, "Name:", cr.Name, "Namespace:", cr.Namespace)
@@ -80,8 +83,13 @@ func (s *statePodSecurityPolicy) Sync(customResource interface{}, infoCatalog In
 		return SyncStateNotReady, nil
 	}
 
+	k8sClient, err := s.getClient(cr)
+	if err != nil {
+		return SyncStateNotReady, err
+	}
+
 	// Create objects if they dont exist, Update objects if they do exist
-	err = s.createOrUpdateObjs(func(obj *unstructured.Unstructured) error {
+	err = s.createOrUpdateObjs(ctx, k8sClient, func(obj *unstructured.Unstructured) error {
 		if err := controllerutil.SetControllerReference(cr, obj, s.scheme); err != nil {
 			return errors.Wrap(err, "failed to set controller reference for object")
 		}
@@ -91,7 +99,7 @@ func (s *statePodSecurityPolicy) Sync(customResource interface{}, infoCatalog In
 		return SyncStateNotReady, errors.Wrap(err, "failed to create/update objects")
 	}
 	// Check objects status
-	syncState, err := s.getSyncState(objs)
+	syncState, err := s.getSyncState(ctx, k8sClient, objs)
 	if err != nil {
 		return SyncStateNotReady, errors.Wrap(err, "failed to get sync state")
 	}
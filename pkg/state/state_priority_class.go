@@ -0,0 +1,136 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	schedulingv1 "k8s.io/api/scheduling/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	mellanoxv1alpha1 "github.com/Mellanox/network-operator/api/v1alpha1"
+	"github.com/Mellanox/network-operator/pkg/consts"
+	"github.com/Mellanox/network-operator/pkg/render"
+	"github.com/Mellanox/network-operator/pkg/utils"
+)
+
+// defaultPriorityClassName is the PriorityClass referenced by the critical Pods if none is set in the NicClusterPolicy
+const defaultPriorityClassName = "system-node-critical"
+
+// NewStatePriorityClass creates a new state which deploys the PriorityClass referenced by the critical Pods
+func NewStatePriorityClass(
+	clientProvider ClientProvider, scheme *runtime.Scheme, manifestDir string) (State, error) {
+	files, err := utils.GetFilesWithSuffix(manifestDir, render.ManifestFileSuffix...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get files from manifest dir")
+	}
+
+	renderer := render.NewRenderer(files)
+	return &statePriorityClass{
+		stateSkel: stateSkel{
+			name:           "state-priority-class",
+			description:    "PriorityClass of the operator critical Pods deployed in the cluster",
+			clientProvider: clientProvider,
+			scheme:         scheme,
+			renderer:       renderer,
+		}}, nil
+}
+
+type statePriorityClass struct {
+	stateSkel
+}
+
+type priorityClassManifestRenderData struct {
+	CrSpec *mellanoxv1alpha1.PriorityClassSpec
+}
+
+// Sync attempt to get the system to match the desired state which State represent.
+// a sync operation must be relatively short and must not block the execution thread.
+func (s *statePriorityClass) Sync(
+	ctx context.Context, customResource interface{}, _ InfoCatalog) (SyncState, error) {
+	cr := customResource.(*mellanoxv1alpha1.NicClusterPolicy)
+	log.V(consts.LogLevelInfo).Info(
+		"Sync Custom resource", "State:", s.name, "Name:", cr.Name, "Namespace:", cr.Namespace)
+
+	if cr.Spec.PriorityClass == nil || cr.Spec.PriorityClass.Existing {
+		// Either this state was not required to run, the PriorityClass is managed by the user or an update
+		// occurred and we need to remove the resources that where created.
+		log.V(consts.LogLevelInfo).Info("PriorityClass is not set or already exists, no action required")
+		return SyncStateIgnore, nil
+	}
+
+	objs, err := s.getManifestObjects(cr)
+	if err != nil {
+		return SyncStateNotReady, errors.Wrap(err, "failed to create k8s objects from manifest")
+	}
+
+	k8sClient, err := s.getClient(cr)
+	if err != nil {
+		return SyncStateNotReady, err
+	}
+
+	// Create objects if they dont exist, Update objects if they do exist
+	err = s.createOrUpdateObjs(ctx, k8sClient, func(obj *unstructured.Unstructured) error {
+		if err := controllerutil.SetControllerReference(cr, obj, s.scheme); err != nil {
+			return errors.Wrap(err, "failed to set controller reference for object")
+		}
+		return nil
+	}, objs)
+	if err != nil {
+		return SyncStateNotReady, errors.Wrap(err, "failed to create/update objects")
+	}
+	// Check objects status
+	syncState, err := s.getSyncState(ctx, k8sClient, objs)
+	if err != nil {
+		return SyncStateNotReady, errors.Wrap(err, "failed to get sync state")
+	}
+	return syncState, nil
+}
+
+// Get a map of source kinds that should be watched for the state keyed by the source kind name
+func (s *statePriorityClass) GetWatchSources() map[string]*source.Kind {
+	wr := make(map[string]*source.Kind)
+	wr["PriorityClass"] = &source.Kind{Type: &schedulingv1.PriorityClass{}}
+	return wr
+}
+
+func (s *statePriorityClass) getManifestObjects(
+	cr *mellanoxv1alpha1.NicClusterPolicy) ([]*unstructured.Unstructured, error) {
+	renderData := &priorityClassManifestRenderData{
+		CrSpec: cr.Spec.PriorityClass,
+	}
+	// render objects
+	log.V(consts.LogLevelDebug).Info("Rendering objects", "data:", renderData)
+	objs, err := s.renderer.RenderObjects(&render.TemplatingData{Data: renderData})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to render objects")
+	}
+	log.V(consts.LogLevelDebug).Info("Rendered", "objects:", objs)
+	return objs, nil
+}
+
+// getPriorityClassName returns the name of the PriorityClass referenced by the critical Pods
+func getPriorityClassName(cr *mellanoxv1alpha1.NicClusterPolicy) string {
+	if cr.Spec.PriorityClass == nil {
+		return defaultPriorityClassName
+	}
+	return cr.Spec.PriorityClass.Name
+}
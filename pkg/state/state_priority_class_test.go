@@ -0,0 +1,156 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	appsv1 "k8s.io/api/apps/v1"
+	schedulingv1 "k8s.io/api/scheduling/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	mellanoxv1alpha1 "github.com/Mellanox/network-operator/api/v1alpha1"
+	"github.com/Mellanox/network-operator/pkg/consts"
+)
+
+// createRecordingClient records the kinds of the created objects in creation order
+type createRecordingClient struct {
+	client.Client
+	created []string
+}
+
+func (c *createRecordingClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	c.created = append(c.created, obj.GetObjectKind().GroupVersionKind().Kind)
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+var _ = Describe("PriorityClass State tests", func() {
+	const priorityClassName = "nvidia-network-critical"
+	var (
+		cr        *mellanoxv1alpha1.NicClusterPolicy
+		k8sClient *createRecordingClient
+		scheme    *runtime.Scheme
+	)
+
+	newPriorityClassState := func() State {
+		priorityClassState, err := NewStatePriorityClass(
+			NewStaticClientProvider(k8sClient), scheme, "../../manifests/stage-priority-class")
+		Expect(err).NotTo(HaveOccurred())
+		return priorityClassState
+	}
+	getPriorityClass := func() (*schedulingv1.PriorityClass, error) {
+		priorityClass := &schedulingv1.PriorityClass{}
+		err := k8sClient.Get(context.TODO(), types.NamespacedName{Name: priorityClassName}, priorityClass)
+		return priorityClass, err
+	}
+
+	BeforeEach(func() {
+		scheme = runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(mellanoxv1alpha1.AddToScheme(scheme)).To(Succeed())
+		k8sClient = &createRecordingClient{Client: fake.NewClientBuilder().WithScheme(scheme).Build()}
+		cr = &mellanoxv1alpha1.NicClusterPolicy{}
+		cr.Name = "nic-cluster-policy"
+		cr.Spec.PriorityClass = &mellanoxv1alpha1.PriorityClassSpec{Name: priorityClassName, Value: 1000000}
+	})
+
+	It("Should create PriorityClass with the configured value", func() {
+		syncState, err := newPriorityClassState().Sync(context.Background(), cr, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(syncState).To(Equal(SyncState(SyncStateReady)))
+
+		priorityClass, err := getPriorityClass()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(priorityClass.Value).To(Equal(int32(1000000)))
+		Expect(priorityClass.GlobalDefault).To(BeFalse())
+		Expect(priorityClass.Labels).To(HaveKeyWithValue(consts.NetworkOperatorOwnedLabel, "true"))
+	})
+	It("Should ignore when the PriorityClass already exists", func() {
+		cr.Spec.PriorityClass.Existing = true
+		syncState, err := newPriorityClassState().Sync(context.Background(), cr, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(syncState).To(Equal(SyncState(SyncStateIgnore)))
+		_, err = getPriorityClass()
+		Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+	})
+	It("Should ignore when not configured", func() {
+		cr.Spec.PriorityClass = nil
+		syncState, err := newPriorityClassState().Sync(context.Background(), cr, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(syncState).To(Equal(SyncState(SyncStateIgnore)))
+		Expect(getPriorityClassName(cr)).To(Equal("system-node-critical"))
+	})
+	It("Should create the PriorityClass before the DaemonSet referencing it", func() {
+		cr.Spec.SriovDevicePlugin = &mellanoxv1alpha1.DevicePluginSpec{
+			ImageSpec: mellanoxv1alpha1.ImageSpec{Image: "image", Repository: "repository", Version: "v0.0"},
+			Config:    "config",
+		}
+		sriovDpState, err := NewStateSriovDp(
+			NewStaticClientProvider(k8sClient), scheme, "../../manifests/stage-sriov-device-plugin")
+		Expect(err).NotTo(HaveOccurred())
+		manager := &stateManager{
+			stateGroups: []Group{
+				NewStateGroup([]State{newPriorityClassState()}),
+				NewStateGroup([]State{sriovDpState}),
+			},
+			clientProvider: NewStaticClientProvider(k8sClient),
+		}
+		catalog := NewInfoCatalog()
+		catalog.Add(InfoTypeNodeInfo, &dummyProvider{})
+		_, err = manager.SyncState(context.Background(), cr, catalog)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(k8sClient.created).To(ContainElements("PriorityClass", "DaemonSet"))
+		Expect(k8sClient.created[0]).To(Equal("PriorityClass"))
+
+		ds := &appsv1.DaemonSet{}
+		Expect(k8sClient.Get(context.TODO(), types.NamespacedName{
+			Namespace: consts.NetworkOperatorResourceNamespace, Name: "sriov-device-plugin"}, ds)).To(Succeed())
+		Expect(ds.Spec.Template.Spec.PriorityClassName).To(Equal(priorityClassName))
+	})
+	It("Should report an existing PriorityClass stuck deleting instead of updating it", func() {
+		now := metav1.Now()
+		terminating := &schedulingv1.PriorityClass{}
+		terminating.Name = priorityClassName
+		terminating.Value = 1000
+		terminating.Labels = map[string]string{consts.NetworkOperatorOwnedLabel: "true"}
+		terminating.DeletionTimestamp = &now
+		terminating.Finalizers = []string{"example.com/blocker"}
+		k8sClient.Client = fake.NewClientBuilder().WithScheme(scheme).WithObjects(terminating).Build()
+
+		syncState, err := newPriorityClassState().Sync(context.Background(), cr, nil)
+		Expect(err).To(HaveOccurred())
+		Expect(IsObjectStuckDeleting(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring(
+			"object PriorityClass nvidia-network-critical is stuck deleting, blocked by finalizers example.com/blocker"))
+		Expect(syncState).To(Equal(SyncState(SyncStateNotReady)))
+		Expect(GetRemediationHint(err)).To(ContainSubstring("Object is Terminating"))
+
+		priorityClass, err := getPriorityClass()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(priorityClass.Value).To(Equal(int32(1000)))
+	})
+})
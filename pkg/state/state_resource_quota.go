@@ -0,0 +1,132 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	mellanoxv1alpha1 "github.com/Mellanox/network-operator/api/v1alpha1"
+	"github.com/Mellanox/network-operator/pkg/consts"
+	"github.com/Mellanox/network-operator/pkg/render"
+	"github.com/Mellanox/network-operator/pkg/utils"
+)
+
+// NewStateResourceQuota creates a new state which deploys a ResourceQuota in the operator resources namespace
+func NewStateResourceQuota(
+	clientProvider ClientProvider, scheme *runtime.Scheme, manifestDir string) (State, error) {
+	files, err := utils.GetFilesWithSuffix(manifestDir, render.ManifestFileSuffix...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get files from manifest dir")
+	}
+
+	renderer := render.NewRenderer(files)
+	return &stateResourceQuota{
+		stateSkel: stateSkel{
+			name:           "state-resource-quota",
+			description:    "ResourceQuota of the operator resources namespace deployed in the cluster",
+			clientProvider: clientProvider,
+			scheme:         scheme,
+			renderer:       renderer,
+		}}, nil
+}
+
+type stateResourceQuota struct {
+	stateSkel
+}
+
+type resourceQuotaManifestRenderData struct {
+	CrSpec      *mellanoxv1alpha1.ResourceQuotaSpec
+	RuntimeSpec *runtimeSpec
+}
+
+// Sync attempt to get the system to match the desired state which State represent.
+// a sync operation must be relatively short and must not block the execution thread.
+func (s *stateResourceQuota) Sync(
+	ctx context.Context, customResource interface{}, _ InfoCatalog) (SyncState, error) {
+	cr := customResource.(*mellanoxv1alpha1.NicClusterPolicy)
+	log.V(consts.LogLevelInfo).Info(
+		"Sync Custom resource", "State:", s.name, "Name:", cr.Name, "Namespace:", cr.Namespace)
+
+	if cr.Spec.ResourceQuota == nil || len(cr.Spec.ResourceQuota.Hard) == 0 {
+		// Either this state was not required to run or an update occurred and we need to remove
+		// the resources that where created.
+		log.V(consts.LogLevelInfo).Info("ResourceQuota spec in CR is not set, no action required")
+		return SyncStateIgnore, nil
+	}
+
+	objs, err := s.getManifestObjects(cr)
+	if err != nil {
+		return SyncStateNotReady, errors.Wrap(err, "failed to create k8s objects from manifest")
+	}
+
+	k8sClient, err := s.getClient(cr)
+	if err != nil {
+		return SyncStateNotReady, err
+	}
+
+	// Create objects if they dont exist, Update objects if they do exist
+	err = s.createOrUpdateObjs(ctx, k8sClient, func(obj *unstructured.Unstructured) error {
+		if err := controllerutil.SetControllerReference(cr, obj, s.scheme); err != nil {
+			return errors.Wrap(err, "failed to set controller reference for object")
+		}
+		return nil
+	}, objs)
+	if err != nil {
+		return SyncStateNotReady, errors.Wrap(err, "failed to create/update objects")
+	}
+	// Check objects status
+	syncState, err := s.getSyncState(ctx, k8sClient, objs)
+	if err != nil {
+		return SyncStateNotReady, errors.Wrap(err, "failed to get sync state")
+	}
+	return syncState, nil
+}
+
+// Get a map of source kinds that should be watched for the state keyed by the source kind name.
+// ResourceQuota is watched so changes made outside of the operator are reverted.
+func (s *stateResourceQuota) GetWatchSources() map[string]*source.Kind {
+	wr := make(map[string]*source.Kind)
+	wr["ResourceQuota"] = &source.Kind{Type: &v1.ResourceQuota{}}
+	return wr
+}
+
+func (s *stateResourceQuota) getManifestObjects(
+	cr *mellanoxv1alpha1.NicClusterPolicy) ([]*unstructured.Unstructured, error) {
+	renderData := &resourceQuotaManifestRenderData{
+		CrSpec: cr.Spec.ResourceQuota,
+		RuntimeSpec: &runtimeSpec{
+			Namespace:    consts.NetworkOperatorResourceNamespace,
+			FeatureGates: cr.Spec.FeatureGates,
+			External:     s.externalRenderData,
+		},
+	}
+	// render objects
+	log.V(consts.LogLevelDebug).Info("Rendering objects", "data:", renderData)
+	objs, err := s.renderer.RenderObjects(&render.TemplatingData{Data: renderData})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to render objects")
+	}
+	log.V(consts.LogLevelDebug).Info("Rendered", "objects:", objs)
+	return objs, nil
+}
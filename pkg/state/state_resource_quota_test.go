@@ -0,0 +1,90 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	mellanoxv1alpha1 "github.com/Mellanox/network-operator/api/v1alpha1"
+	"github.com/Mellanox/network-operator/pkg/consts"
+)
+
+var _ = Describe("ResourceQuota State tests", func() {
+	var (
+		cr        *mellanoxv1alpha1.NicClusterPolicy
+		k8sClient client.Client
+		scheme    *runtime.Scheme
+	)
+
+	getResourceQuota := func() (*corev1.ResourceQuota, error) {
+		quota := &corev1.ResourceQuota{}
+		err := k8sClient.Get(context.TODO(), types.NamespacedName{
+			Name: "nvidia-network-operator-quota", Namespace: consts.NetworkOperatorResourceNamespace}, quota)
+		return quota, err
+	}
+	sync := func() SyncState {
+		quotaState, err := NewStateResourceQuota(
+			NewStaticClientProvider(k8sClient), scheme, "../../manifests/stage-resource-quota")
+		Expect(err).NotTo(HaveOccurred())
+		syncState, err := quotaState.Sync(context.Background(), cr, nil)
+		Expect(err).NotTo(HaveOccurred())
+		return syncState
+	}
+
+	BeforeEach(func() {
+		scheme = runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(mellanoxv1alpha1.AddToScheme(scheme)).To(Succeed())
+		k8sClient = fake.NewClientBuilder().WithScheme(scheme).Build()
+		cr = &mellanoxv1alpha1.NicClusterPolicy{}
+		cr.Name = "nic-cluster-policy"
+	})
+
+	It("Should create ResourceQuota with the configured limits", func() {
+		cr.Spec.ResourceQuota = &mellanoxv1alpha1.ResourceQuotaSpec{
+			Hard: corev1.ResourceList{
+				corev1.ResourceLimitsCPU:    resource.MustParse("16"),
+				corev1.ResourceLimitsMemory: resource.MustParse("32Gi"),
+			},
+		}
+		Expect(sync()).To(Equal(SyncState(SyncStateReady)))
+
+		quota, err := getResourceQuota()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(quota.Spec.Hard).To(HaveLen(2))
+		Expect(quota.Spec.Hard.Name(corev1.ResourceLimitsCPU, resource.DecimalSI).String()).To(Equal("16"))
+		Expect(quota.Spec.Hard.Name(corev1.ResourceLimitsMemory, resource.BinarySI).String()).To(Equal("32Gi"))
+		Expect(quota.Labels).To(HaveKeyWithValue(consts.NetworkOperatorOwnedLabel, "true"))
+	})
+	It("Should ignore when not configured", func() {
+		Expect(sync()).To(Equal(SyncState(SyncStateIgnore)))
+		_, err := getResourceQuota()
+		Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+	})
+})
@@ -0,0 +1,854 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	mellanoxv1alpha1 "github.com/Mellanox/network-operator/api/v1alpha1"
+	"github.com/Mellanox/network-operator/pkg/consts"
+	"github.com/Mellanox/network-operator/pkg/nodeinfo"
+	"github.com/Mellanox/network-operator/pkg/render"
+	"github.com/Mellanox/network-operator/pkg/testing/mocks"
+	"github.com/Mellanox/network-operator/pkg/utils"
+)
+
+var _ = Describe("RDMA Shared Device Plugin State tests", func() {
+	var (
+		sharedDpState stateSharedDp
+		cr            *mellanoxv1alpha1.NicClusterPolicy
+		nodeInfo      nodeinfo.Provider
+	)
+
+	BeforeEach(func() {
+		files, err := utils.GetFilesWithSuffix("../../manifests/stage-rdma-device-plugin",
+			render.ManifestFileSuffix...)
+		Expect(err).NotTo(HaveOccurred())
+		sharedDpState = stateSharedDp{
+			stateSkel: stateSkel{
+				name:           "state-RDMA-device-plugin",
+				description:    "RDMA shared device plugin deployed in the cluster",
+				clientProvider: NewStaticClientProvider(&mocks.ControllerRutimeClient{}),
+				scheme:         runtime.NewScheme(),
+				renderer:       render.NewRenderer(files),
+			},
+		}
+		cr = &mellanoxv1alpha1.NicClusterPolicy{}
+		cr.Spec.RdmaSharedDevicePlugin = &mellanoxv1alpha1.DevicePluginSpec{
+			ImageSpec: mellanoxv1alpha1.ImageSpec{
+				Image:      "image",
+				Repository: "Repository",
+				Version:    "v0.0",
+			},
+			Config: "config",
+		}
+		nodeInfo = nodeinfo.NewProvider([]*corev1.Node{{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "node1",
+				Labels: map[string]string{
+					nodeinfo.NodeLabelMlnxNIC:  "true",
+					nodeinfo.NodeLabelHostname: "node1",
+					nodeinfo.NodeLabelCPUArch:  "amd64",
+					nodeinfo.NodeLabelOSName:   "ubuntu",
+					nodeinfo.NodeLabelOSVer:    "20.04",
+				},
+			},
+		}})
+	})
+
+	getContainer := func(objs []*unstructured.Unstructured) map[string]interface{} {
+		for _, obj := range objs {
+			if obj.GetKind() != "DaemonSet" {
+				continue
+			}
+			containers, _, err := unstructured.NestedSlice(obj.Object, "spec", "template", "spec", "containers")
+			Expect(err).NotTo(HaveOccurred())
+			return containers[0].(map[string]interface{})
+		}
+		Fail("DaemonSet was not rendered")
+		return nil
+	}
+
+	Context("gRPC health check", func() {
+		It("Should render a gRPC readiness probe when enabled", func() {
+			cr.Spec.RdmaSharedDevicePlugin.HealthCheck = &mellanoxv1alpha1.DevicePluginHealthCheckSpec{
+				Enabled:        true,
+				Port:           9500,
+				ReadinessProbe: &mellanoxv1alpha1.PodProbeSpec{InitialDelaySeconds: 5, PeriodSeconds: 15},
+			}
+			objs, err := sharedDpState.getManifestObjects(cr, nodeInfo)
+			Expect(err).NotTo(HaveOccurred())
+
+			container := getContainer(objs)
+			probe := container["readinessProbe"].(map[string]interface{})
+			grpc := probe["grpc"].(map[string]interface{})
+			Expect(grpc["port"]).To(BeEquivalentTo(9500))
+			Expect(grpc).NotTo(HaveKey("service"))
+			Expect(probe["initialDelaySeconds"]).To(BeEquivalentTo(5))
+			Expect(probe["periodSeconds"]).To(BeEquivalentTo(15))
+			Expect(container).NotTo(HaveKey("args"))
+		})
+		It("Should use the default port when not set", func() {
+			cr.Spec.RdmaSharedDevicePlugin.HealthCheck = &mellanoxv1alpha1.DevicePluginHealthCheckSpec{Enabled: true}
+			objs, err := sharedDpState.getManifestObjects(cr, nodeInfo)
+			Expect(err).NotTo(HaveOccurred())
+
+			probe := getContainer(objs)["readinessProbe"].(map[string]interface{})
+			Expect(probe["grpc"].(map[string]interface{})["port"]).To(BeEquivalentTo(sharedDpDefaultHealthPort))
+		})
+		It("Should render the health service port as a named container port", func() {
+			cr.Spec.RdmaSharedDevicePlugin.HealthCheck = &mellanoxv1alpha1.DevicePluginHealthCheckSpec{
+				Enabled:  true,
+				Port:     9500,
+				PortName: "dp-health",
+			}
+			objs, err := sharedDpState.getManifestObjects(cr, nodeInfo)
+			Expect(err).NotTo(HaveOccurred())
+
+			ports := getContainer(objs)["ports"].([]interface{})
+			Expect(ports).To(HaveLen(1))
+			port := ports[0].(map[string]interface{})
+			Expect(port["name"]).To(Equal("dp-health"))
+			Expect(port["containerPort"]).To(BeEquivalentTo(9500))
+			Expect(port["protocol"]).To(Equal("TCP"))
+		})
+		It("Should use the default port name when not set", func() {
+			cr.Spec.RdmaSharedDevicePlugin.HealthCheck = &mellanoxv1alpha1.DevicePluginHealthCheckSpec{Enabled: true}
+			objs, err := sharedDpState.getManifestObjects(cr, nodeInfo)
+			Expect(err).NotTo(HaveOccurred())
+
+			port := getContainer(objs)["ports"].([]interface{})[0].(map[string]interface{})
+			Expect(port["name"]).To(Equal(dpHealthPortDefaultName))
+		})
+		It("Should fail on an invalid port or port name", func() {
+			for _, healthCheck := range []*mellanoxv1alpha1.DevicePluginHealthCheckSpec{
+				{Enabled: true, Port: 70000},
+				{Enabled: true, Port: -1},
+				{Enabled: true, PortName: "Health_Port"},
+				{Enabled: true, PortName: "a-very-long-port-name"},
+			} {
+				cr.Spec.RdmaSharedDevicePlugin.HealthCheck = healthCheck
+				_, err := sharedDpState.getManifestObjects(cr, nodeInfo)
+				Expect(err).To(HaveOccurred())
+			}
+		})
+		It("Should not render a readiness probe by default", func() {
+			objs, err := sharedDpState.getManifestObjects(cr, nodeInfo)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(getContainer(objs)).NotTo(HaveKey("readinessProbe"))
+			Expect(getContainer(objs)).NotTo(HaveKey("ports"))
+		})
+	})
+
+	Context("Kubelet registration check", func() {
+		It("Should render the registration check liveness probe when enabled", func() {
+			cr.Spec.RdmaSharedDevicePlugin.RegistrationCheck = &mellanoxv1alpha1.DevicePluginRegistrationCheckSpec{
+				Enabled:       true,
+				LivenessProbe: &mellanoxv1alpha1.PodProbeSpec{InitialDelaySeconds: 20, PeriodSeconds: 10},
+			}
+			objs, err := sharedDpState.getManifestObjects(cr, nodeInfo)
+			Expect(err).NotTo(HaveOccurred())
+
+			probe := getContainer(objs)["livenessProbe"].(map[string]interface{})
+			command := probe["exec"].(map[string]interface{})["command"]
+			Expect(command).To(Equal([]interface{}{"sh", "-c", dpRegistrationCheckScript}))
+			Expect(probe["initialDelaySeconds"]).To(BeEquivalentTo(20))
+			Expect(probe["periodSeconds"]).To(BeEquivalentTo(10))
+		})
+		It("Should use the default probe settings when not set", func() {
+			cr.Spec.RdmaSharedDevicePlugin.RegistrationCheck = &mellanoxv1alpha1.DevicePluginRegistrationCheckSpec{
+				Enabled: true}
+			objs, err := sharedDpState.getManifestObjects(cr, nodeInfo)
+			Expect(err).NotTo(HaveOccurred())
+
+			probe := getContainer(objs)["livenessProbe"].(map[string]interface{})
+			Expect(probe["initialDelaySeconds"]).To(BeEquivalentTo(dpRegistrationProbeDefaultInitialDelaySeconds))
+			Expect(probe["periodSeconds"]).To(BeEquivalentTo(dpRegistrationProbeDefaultPeriodSeconds))
+		})
+		It("Should not render a liveness probe by default", func() {
+			objs, err := sharedDpState.getManifestObjects(cr, nodeInfo)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(getContainer(objs)).NotTo(HaveKey("livenessProbe"))
+		})
+	})
+
+	Context("CPU configuration", func() {
+		It("Should render GOMAXPROCS and integer CPU requests for static placement", func() {
+			cr.Spec.RdmaSharedDevicePlugin.CPU = &mellanoxv1alpha1.DevicePluginCPUSpec{
+				GOMAXPROCS:      2,
+				StaticPlacement: &mellanoxv1alpha1.DevicePluginStaticCPUPlacementSpec{CPUs: "2", Memory: "128Mi"},
+			}
+			objs, err := sharedDpState.getManifestObjects(cr, nodeInfo)
+			Expect(err).NotTo(HaveOccurred())
+
+			container := getContainer(objs)
+			Expect(container["env"]).To(Equal([]interface{}{
+				map[string]interface{}{"name": "GOMAXPROCS", "value": "2"},
+			}))
+			resources := map[string]interface{}{"cpu": "2", "memory": "128Mi"}
+			Expect(container["resources"]).To(Equal(map[string]interface{}{
+				"requests": resources,
+				"limits":   resources,
+			}))
+		})
+		It("Should render GOMAXPROCS without resources", func() {
+			cr.Spec.RdmaSharedDevicePlugin.CPU = &mellanoxv1alpha1.DevicePluginCPUSpec{GOMAXPROCS: 4}
+			objs, err := sharedDpState.getManifestObjects(cr, nodeInfo)
+			Expect(err).NotTo(HaveOccurred())
+
+			container := getContainer(objs)
+			Expect(container["env"]).To(ConsistOf(map[string]interface{}{"name": "GOMAXPROCS", "value": "4"}))
+			Expect(container).NotTo(HaveKey("resources"))
+		})
+		It("Should not render the CPU configuration by default", func() {
+			objs, err := sharedDpState.getManifestObjects(cr, nodeInfo)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(getContainer(objs)).NotTo(HaveKey("env"))
+			Expect(getContainer(objs)).NotTo(HaveKey("resources"))
+		})
+		It("Should fail on a non integer or invalid CPU placement", func() {
+			for _, placement := range []mellanoxv1alpha1.DevicePluginStaticCPUPlacementSpec{
+				{CPUs: "500m", Memory: "128Mi"},
+				{CPUs: "1.5", Memory: "128Mi"},
+				{CPUs: "0", Memory: "128Mi"},
+				{CPUs: "2", Memory: "128 megabytes"},
+				{CPUs: "2"},
+			} {
+				placement := placement
+				cr.Spec.RdmaSharedDevicePlugin.CPU = &mellanoxv1alpha1.DevicePluginCPUSpec{StaticPlacement: &placement}
+				_, err := sharedDpState.getManifestObjects(cr, nodeInfo)
+				Expect(err).To(HaveOccurred())
+			}
+		})
+	})
+
+	Context("Node listing failure", func() {
+		It("Should report a retryable error distinct from an empty node list", func() {
+			listErr := k8serrors.NewServiceUnavailable("apiserver is shutting down")
+			catalog := NewInfoCatalog()
+			catalog.Add(InfoTypeNodeInfo, nodeinfo.NewFailedProvider(listErr))
+
+			syncState, err := sharedDpState.Sync(context.Background(), cr, catalog)
+			Expect(syncState).To(Equal(SyncState(SyncStateError)))
+			var nodeListErr *nodeinfo.ListError
+			Expect(errors.As(err, &nodeListErr)).To(BeTrue())
+			Expect(IsTransientAPIError(err)).To(BeTrue())
+			Expect(GetRemediationHint(err)).To(ContainSubstring("retries automatically"))
+
+			catalog.Add(InfoTypeNodeInfo, nodeinfo.NewProvider([]*corev1.Node{}))
+			syncState, err = sharedDpState.Sync(context.Background(), cr, catalog)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(syncState).To(Equal(SyncState(SyncStateNotReady)))
+		})
+	})
+
+	Context("Legacy socket migration", func() {
+		getInitContainers := func(objs []*unstructured.Unstructured) []interface{} {
+			for _, obj := range objs {
+				if obj.GetKind() != "DaemonSet" {
+					continue
+				}
+				initContainers, _, err := unstructured.NestedSlice(
+					obj.Object, "spec", "template", "spec", "initContainers")
+				Expect(err).NotTo(HaveOccurred())
+				return initContainers
+			}
+			Fail("DaemonSet was not rendered")
+			return nil
+		}
+
+		BeforeEach(func() {
+			cr.Spec.RdmaSharedDevicePlugin.Version = "v1.3.2"
+		})
+
+		It("Should render the migration init container when enabled", func() {
+			cr.Spec.RdmaSharedDevicePlugin.SocketMigration = &mellanoxv1alpha1.DevicePluginSocketMigrationSpec{
+				Enabled: true,
+			}
+			objs, err := sharedDpState.getManifestObjects(cr, nodeInfo)
+			Expect(err).NotTo(HaveOccurred())
+
+			initContainers := getInitContainers(objs)
+			Expect(initContainers).To(HaveLen(1))
+			initContainer := initContainers[0].(map[string]interface{})
+			Expect(initContainer["name"]).To(Equal("device-plugin-socket-migration"))
+			args := initContainer["args"].([]interface{})
+			Expect(args).To(HaveLen(1))
+			Expect(args[0]).To(ContainSubstring("rdma-hca.sock"))
+			Expect(args[0]).NotTo(ContainSubstring("kubelet.sock"))
+		})
+		It("Should render the migration init container after the OFED driver validation", func() {
+			cr.Spec.OFEDDriver = &mellanoxv1alpha1.OFEDDriverSpec{
+				ImageSpec: mellanoxv1alpha1.ImageSpec{Image: "mofed", Repository: "repository", Version: "5.5"},
+			}
+			cr.Spec.RdmaSharedDevicePlugin.SocketMigration = &mellanoxv1alpha1.DevicePluginSocketMigrationSpec{
+				Enabled: true,
+			}
+			objs, err := sharedDpState.getManifestObjects(cr, nodeInfo)
+			Expect(err).NotTo(HaveOccurred())
+
+			initContainers := getInitContainers(objs)
+			Expect(initContainers).To(HaveLen(2))
+			Expect(initContainers[0].(map[string]interface{})["name"]).To(Equal("ofed-driver-validation"))
+			Expect(initContainers[1].(map[string]interface{})["name"]).To(Equal("device-plugin-socket-migration"))
+		})
+		It("Should not render the migration init container by default", func() {
+			objs, err := sharedDpState.getManifestObjects(cr, nodeInfo)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(getInitContainers(objs)).To(BeEmpty())
+		})
+		It("Should not render the migration init container for versions using the legacy sockets", func() {
+			cr.Spec.RdmaSharedDevicePlugin.Version = "v0.9"
+			cr.Spec.RdmaSharedDevicePlugin.SocketMigration = &mellanoxv1alpha1.DevicePluginSocketMigrationSpec{
+				Enabled: true,
+			}
+			objs, err := sharedDpState.getManifestObjects(cr, nodeInfo)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(getInitContainers(objs)).To(BeEmpty())
+		})
+		It("Should not render the migration init container for versions which can not be parsed", func() {
+			cr.Spec.RdmaSharedDevicePlugin.Version = "latest"
+			cr.Spec.RdmaSharedDevicePlugin.SocketMigration = &mellanoxv1alpha1.DevicePluginSocketMigrationSpec{
+				Enabled: true,
+			}
+			objs, err := sharedDpState.getManifestObjects(cr, nodeInfo)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(getInitContainers(objs)).To(BeEmpty())
+		})
+	})
+
+	newNode := func(name string, annotations map[string]string) *corev1.Node {
+		return &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Annotations: annotations,
+				Labels: map[string]string{
+					nodeinfo.NodeLabelMlnxNIC:  "true",
+					nodeinfo.NodeLabelHostname: name,
+					nodeinfo.NodeLabelCPUArch:  "amd64",
+					nodeinfo.NodeLabelOSName:   "ubuntu",
+					nodeinfo.NodeLabelOSVer:    "20.04",
+				},
+			},
+		}
+	}
+	getDaemonSet := func(objs []*unstructured.Unstructured) *unstructured.Unstructured {
+		for _, obj := range objs {
+			if obj.GetKind() == "DaemonSet" {
+				return obj
+			}
+		}
+		Fail("DaemonSet was not rendered")
+		return nil
+	}
+	// expectSkippedNodesExcluded checks the skipped nodes are excluded by their label rather than by name, so the Pod
+	// template does not depend on the skipped nodes
+	expectSkippedNodesExcluded := func(objs []*unstructured.Unstructured) {
+		terms, _, err := unstructured.NestedSlice(getDaemonSet(objs).Object, "spec", "template", "spec", "affinity",
+			"nodeAffinity", "requiredDuringSchedulingIgnoredDuringExecution", "nodeSelectorTerms")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(terms).To(Equal([]interface{}{
+			map[string]interface{}{
+				"matchExpressions": []interface{}{
+					map[string]interface{}{
+						"key":      sharedDpSkipNodeLabel,
+						"operator": "NotIn",
+						"values":   []interface{}{"true"},
+					},
+				},
+			},
+		}))
+	}
+
+	Context("Nodes managed by another instance", func() {
+		It("Should exclude and report nodes annotated as managed by another instance", func() {
+			nodeInfo = nodeinfo.NewProvider([]*corev1.Node{
+				newNode("node1", nil),
+				newNode("node2", map[string]string{nodeinfo.NodeAnnotationDevicePluginManagedBy: "other"}),
+				newNode("node3", map[string]string{
+					nodeinfo.NodeAnnotationDevicePluginManagedBy: nodeinfo.DevicePluginManagedByNetworkOperator}),
+			})
+			objs, err := sharedDpState.getManifestObjects(cr, nodeInfo)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sharedDpState.SkippedNodes()).To(Equal([]string{"node2"}))
+			expectSkippedNodesExcluded(objs)
+		})
+		It("Should render the same Pod template whatever nodes are skipped", func() {
+			objs, err := sharedDpState.getManifestObjects(cr, nodeInfo)
+			Expect(err).NotTo(HaveOccurred())
+			template, _, err := unstructured.NestedMap(getDaemonSet(objs).Object, "spec", "template")
+			Expect(err).NotTo(HaveOccurred())
+
+			nodeInfo = nodeinfo.NewProvider([]*corev1.Node{
+				newNode("node1", map[string]string{nodeinfo.NodeAnnotationDevicePluginManagedBy: "other"})})
+			objs, err = sharedDpState.getManifestObjects(cr, nodeInfo)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sharedDpState.SkippedNodes()).To(Equal([]string{"node1"}))
+			skippedTemplate, _, err := unstructured.NestedMap(getDaemonSet(objs).Object, "spec", "template")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(skippedTemplate).To(Equal(template))
+		})
+		It("Should not skip nodes by default", func() {
+			_, err := sharedDpState.getManifestObjects(cr, nodeInfo)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sharedDpState.SkippedNodes()).To(BeEmpty())
+		})
+		It("Should label the skipped nodes and unlabel the nodes no longer skipped", func() {
+			scheme := runtime.NewScheme()
+			Expect(corev1.AddToScheme(scheme)).To(Succeed())
+			node1 := newNode("node1", nil)
+			node1.Labels[sharedDpSkipNodeLabel] = "true"
+			c := fake.NewClientBuilder().WithScheme(scheme).
+				WithObjects(node1, newNode("node2", nil), newNode("node3", nil)).Build()
+
+			Expect(labelSkippedNodes(context.Background(), c, sharedDpSkipNodeLabel, []string{"node2"})).To(Succeed())
+			for name, skipped := range map[string]bool{"node1": false, "node2": true, "node3": false} {
+				node := &corev1.Node{}
+				Expect(c.Get(context.Background(), types.NamespacedName{Name: name}, node)).To(Succeed())
+				if skipped {
+					Expect(node.Labels).To(HaveKeyWithValue(sharedDpSkipNodeLabel, "true"))
+				} else {
+					Expect(node.Labels).NotTo(HaveKey(sharedDpSkipNodeLabel))
+				}
+			}
+		})
+	})
+
+	Context("OFED modules verification", func() {
+		BeforeEach(func() {
+			cr.Spec.OFEDDriver = &mellanoxv1alpha1.OFEDDriverSpec{
+				ImageSpec: mellanoxv1alpha1.ImageSpec{Image: "mofed", Repository: "repository", Version: "5.5"},
+			}
+		})
+
+		It("Should keep the device plugin blocked on nodes waiting for OFED", func() {
+			nodeInfo = nodeinfo.NewProvider([]*corev1.Node{
+				newNode("node1", map[string]string{nodeinfo.NodeAnnotationOFEDModulesLoaded: "5.5"}),
+				newNode("node2", nil),
+			})
+			objs, err := sharedDpState.getManifestObjects(cr, nodeInfo)
+			Expect(err).NotTo(HaveOccurred())
+			// nodes are selected by the label set once the OFED modules are verified loaded, not skipped by name
+			Expect(sharedDpState.SkippedNodes()).To(BeEmpty())
+			nodeSelector, _, err := unstructured.NestedStringMap(
+				getDaemonSet(objs).Object, "spec", "template", "spec", "nodeSelector")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(nodeSelector).To(HaveKeyWithValue(nodeinfo.NodeLabelWaitOFED, "false"))
+		})
+		It("Should report nodes managed by another instance once", func() {
+			nodeInfo = nodeinfo.NewProvider([]*corev1.Node{
+				newNode("node1", map[string]string{nodeinfo.NodeAnnotationDevicePluginManagedBy: "other"}),
+			})
+			_, err := sharedDpState.getManifestObjects(cr, nodeInfo)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sharedDpState.SkippedNodes()).To(Equal([]string{"node1"}))
+		})
+	})
+
+	Context("Link layer", func() {
+		newLinkLayerNode := func(name, linkLayer string) *corev1.Node {
+			node := newNode(name, nil)
+			if linkLayer != "" {
+				node.Labels[nodeinfo.NodeLabelLinkLayer] = linkLayer
+			}
+			return node
+		}
+
+		It("Should only deploy the device plugin on nodes of the configured link layer", func() {
+			cr.Spec.RdmaSharedDevicePlugin.LinkLayer = nodeinfo.LinkLayerInfiniBand
+			nodeInfo = nodeinfo.NewProvider([]*corev1.Node{
+				newLinkLayerNode("node1", nodeinfo.LinkLayerInfiniBand),
+				newLinkLayerNode("node2", nodeinfo.LinkLayerEthernet),
+				newLinkLayerNode("node3", ""),
+			})
+			objs, err := sharedDpState.getManifestObjects(cr, nodeInfo)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sharedDpState.SkippedNodes()).To(Equal([]string{"node2", "node3"}))
+			expectSkippedNodesExcluded(objs)
+		})
+		It("Should deploy the device plugin on nodes of any link layer by default", func() {
+			nodeInfo = nodeinfo.NewProvider([]*corev1.Node{
+				newLinkLayerNode("node1", nodeinfo.LinkLayerInfiniBand),
+				newLinkLayerNode("node2", nodeinfo.LinkLayerEthernet),
+			})
+			_, err := sharedDpState.getManifestObjects(cr, nodeInfo)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sharedDpState.SkippedNodes()).To(BeEmpty())
+		})
+	})
+
+	Context("Required kernel features", func() {
+		BeforeEach(func() {
+			cr.Spec.RdmaSharedDevicePlugin.RequiredKernelFeatures = []mellanoxv1alpha1.KernelFeature{
+				"CONFIG_INFINIBAND", "CONFIG_INFINIBAND_USER_ACCESS"}
+		})
+
+		It("Should exclude and report nodes lacking required kernel features", func() {
+			nodeInfo = nodeinfo.NewProvider([]*corev1.Node{
+				newNode("node1", map[string]string{
+					nodeinfo.NodeAnnotationKernelFeatures: "CONFIG_INFINIBAND,CONFIG_INFINIBAND_USER_ACCESS"}),
+				newNode("node2", map[string]string{nodeinfo.NodeAnnotationKernelFeatures: "CONFIG_INFINIBAND"}),
+				newNode("node3", nil),
+			})
+			objs, err := sharedDpState.getManifestObjects(cr, nodeInfo)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sharedDpState.SkippedNodes()).To(Equal([]string{"node2", "node3"}))
+			expectSkippedNodesExcluded(objs)
+			Expect(sharedDpState.Warnings()).To(Equal([]string{
+				"node node2 lacks required kernel features: CONFIG_INFINIBAND_USER_ACCESS",
+				"node node3 does not report its kernel features with the " +
+					nodeinfo.NodeAnnotationKernelFeatures + " annotation",
+			}))
+		})
+		It("Should not check kernel features by default", func() {
+			cr.Spec.RdmaSharedDevicePlugin.RequiredKernelFeatures = nil
+			nodeInfo = nodeinfo.NewProvider([]*corev1.Node{newNode("node1", nil)})
+			_, err := sharedDpState.getManifestObjects(cr, nodeInfo)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sharedDpState.SkippedNodes()).To(BeEmpty())
+			Expect(sharedDpState.Warnings()).To(BeEmpty())
+		})
+	})
+
+	Context("OFED driver compatibility", func() {
+		BeforeEach(func() {
+			cr.Spec.OFEDDriver = &mellanoxv1alpha1.OFEDDriverSpec{
+				ImageSpec: mellanoxv1alpha1.ImageSpec{Image: "mofed", Repository: "repository", Version: "5.5-1.0.3.2"},
+			}
+			cr.Spec.RdmaSharedDevicePlugin.Version = "v1.1.0"
+			// the versions of the matrix of the tests are not actual incompatibilities
+			sharedDpState.ofedCompatibility = []ofedDevicePluginIncompatibility{{
+				DevicePlugin:    compatibilitySharedDevicePlugin,
+				OFEDMin:         "5.5",
+				DevicePluginMax: "1.2.0",
+				Recommendation:  "upgrade the device plugin to v1.2.0",
+				Source:          "https://example.com/release-notes",
+			}}
+		})
+
+		It("Should report a warning for an incompatible OFED driver and device plugin pair", func() {
+			objs, err := sharedDpState.getManifestObjects(cr, nodeInfo)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(objs).NotTo(BeEmpty())
+			Expect(sharedDpState.Warnings()).To(Equal([]string{
+				"OFED driver 5.5-1.0.3.2 is incompatible with rdmaSharedDevicePlugin v1.1.0: upgrade the device " +
+					"plugin to v1.2.0",
+			}))
+		})
+		It("Should not report a warning without compatibility matrix", func() {
+			sharedDpState.ofedCompatibility = nil
+			_, err := sharedDpState.getManifestObjects(cr, nodeInfo)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sharedDpState.Warnings()).To(BeEmpty())
+		})
+		It("Should fail the sync of an incompatible pair in strict mode", func() {
+			sharedDpState.ofedCompatibilityStrict = true
+			_, err := sharedDpState.getManifestObjects(cr, nodeInfo)
+			Expect(err).To(HaveOccurred())
+		})
+		It("Should not report compatible or unparsable versions", func() {
+			for _, versions := range [][]string{
+				{"5.4-3.1.0.0", "v1.1.0"},
+				{"5.5-1.0.3.2", "v1.2.0"},
+				{"5.5-1.0.3.2", "sha256:0123456789abcdef"},
+				{"latest", "v1.1.0"},
+			} {
+				cr.Spec.OFEDDriver.Version = versions[0]
+				cr.Spec.RdmaSharedDevicePlugin.Version = versions[1]
+				_, err := sharedDpState.getManifestObjects(cr, nodeInfo)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(sharedDpState.Warnings()).To(BeEmpty(), "versions: %v", versions)
+			}
+		})
+	})
+
+	Context("GPU tolerations", func() {
+		newGPUNode := func(name string, taints ...corev1.Taint) *corev1.Node {
+			node := newNode(name, nil)
+			node.Labels[nodeinfo.NodeLabelNvGPU] = "true"
+			node.Spec.Taints = taints
+			return node
+		}
+		getTolerations := func(objs []*unstructured.Unstructured) []interface{} {
+			tolerations, _, err := unstructured.NestedSlice(getDaemonSet(objs).Object,
+				"spec", "template", "spec", "tolerations")
+			Expect(err).NotTo(HaveOccurred())
+			return tolerations
+		}
+		staticTolerations := []interface{}{
+			map[string]interface{}{
+				"key": "node-role.kubernetes.io/master", "operator": "Exists", "effect": "NoSchedule"},
+			map[string]interface{}{"key": "nvidia.com/gpu", "operator": "Exists", "effect": "NoSchedule"},
+		}
+
+		BeforeEach(func() {
+			cr.Spec.RdmaSharedDevicePlugin.DeriveGPUTolerations = true
+		})
+
+		It("Should tolerate the taints of the GPU nodes", func() {
+			nodeInfo = nodeinfo.NewProvider([]*corev1.Node{
+				newGPUNode("node1",
+					corev1.Taint{Key: "example.com/gpudirect", Value: "true", Effect: corev1.TaintEffectNoSchedule},
+					corev1.Taint{Key: "example.com/dedicated", Effect: corev1.TaintEffectNoExecute}),
+				newGPUNode("node2",
+					corev1.Taint{Key: "example.com/gpudirect", Value: "true", Effect: corev1.TaintEffectNoSchedule},
+					corev1.Taint{Key: "nvidia.com/gpu", Value: "present", Effect: corev1.TaintEffectNoSchedule},
+					corev1.Taint{Key: "node.kubernetes.io/unschedulable", Effect: corev1.TaintEffectNoSchedule}),
+			})
+			objs, err := sharedDpState.getManifestObjects(cr, nodeInfo)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(getTolerations(objs)).To(Equal(append(staticTolerations,
+				map[string]interface{}{"key": "example.com/dedicated", "operator": "Exists", "effect": "NoExecute"},
+				map[string]interface{}{
+					"key": "example.com/gpudirect", "operator": "Equal", "value": "true", "effect": "NoSchedule"},
+			)))
+			Expect(sharedDpState.Warnings()).To(BeEmpty())
+		})
+		It("Should not tolerate the taints of nodes without GPUs", func() {
+			node := newNode("node1", nil)
+			node.Spec.Taints = []corev1.Taint{{Key: "example.com/dedicated", Effect: corev1.TaintEffectNoSchedule}}
+			objs, err := sharedDpState.getManifestObjects(cr, nodeinfo.NewProvider([]*corev1.Node{node}))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(getTolerations(objs)).To(Equal(staticTolerations))
+		})
+		It("Should report a warning for an invalid taint key", func() {
+			nodeInfo = nodeinfo.NewProvider([]*corev1.Node{
+				newGPUNode("node1", corev1.Taint{Key: "invalid key", Effect: corev1.TaintEffectNoSchedule}),
+			})
+			objs, err := sharedDpState.getManifestObjects(cr, nodeInfo)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(getTolerations(objs)).To(Equal(staticTolerations))
+			Expect(sharedDpState.Warnings()).To(HaveLen(1))
+		})
+		It("Should not derive tolerations by default", func() {
+			cr.Spec.RdmaSharedDevicePlugin.DeriveGPUTolerations = false
+			nodeInfo = nodeinfo.NewProvider([]*corev1.Node{
+				newGPUNode("node1", corev1.Taint{Key: "example.com/gpudirect", Effect: corev1.TaintEffectNoSchedule}),
+			})
+			objs, err := sharedDpState.getManifestObjects(cr, nodeInfo)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(getTolerations(objs)).To(Equal(staticTolerations))
+		})
+	})
+
+	getDaemonSetPodSpec := func(objs []*unstructured.Unstructured) map[string]interface{} {
+		for _, obj := range objs {
+			if obj.GetKind() == "DaemonSet" {
+				podSpec, _, err := unstructured.NestedMap(obj.Object, "spec", "template", "spec")
+				Expect(err).NotTo(HaveOccurred())
+				return podSpec
+			}
+		}
+		Fail("DaemonSet was not rendered")
+		return nil
+	}
+
+	Context("Scratch volume", func() {
+		getScratchVolume := func(podSpec map[string]interface{}) map[string]interface{} {
+			for _, volume := range podSpec["volumes"].([]interface{}) {
+				if volume.(map[string]interface{})["name"] == "scratch" {
+					return volume.(map[string]interface{})
+				}
+			}
+			return nil
+		}
+
+		It("Should render a memory-backed volume with the configured size", func() {
+			cr.Spec.RdmaSharedDevicePlugin.ScratchVolume = &mellanoxv1alpha1.DevicePluginScratchVolumeSpec{
+				MountPath: "/var/run/rdma-scratch",
+				SizeLimit: "64Mi",
+			}
+			objs, err := sharedDpState.getManifestObjects(cr, nodeInfo)
+			Expect(err).NotTo(HaveOccurred())
+			podSpec := getDaemonSetPodSpec(objs)
+			Expect(getScratchVolume(podSpec)).To(Equal(map[string]interface{}{
+				"name": "scratch",
+				"emptyDir": map[string]interface{}{
+					"medium":    "Memory",
+					"sizeLimit": "64Mi",
+				},
+			}))
+			container := podSpec["containers"].([]interface{})[0].(map[string]interface{})
+			Expect(container["volumeMounts"]).To(ContainElement(map[string]interface{}{
+				"name":      "scratch",
+				"mountPath": "/var/run/rdma-scratch",
+			}))
+		})
+		It("Should not render the volume by default", func() {
+			objs, err := sharedDpState.getManifestObjects(cr, nodeInfo)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(getScratchVolume(getDaemonSetPodSpec(objs))).To(BeNil())
+		})
+		It("Should fail on an invalid size limit or mount path", func() {
+			for _, volume := range []mellanoxv1alpha1.DevicePluginScratchVolumeSpec{
+				{MountPath: "/var/run/rdma-scratch", SizeLimit: "64 megabytes"},
+				{MountPath: "/var/run/rdma-scratch", SizeLimit: "0"},
+				{MountPath: "/var/run/rdma-scratch", SizeLimit: "-64Mi"},
+				{MountPath: "var/run/rdma-scratch"},
+			} {
+				volume := volume
+				cr.Spec.RdmaSharedDevicePlugin.ScratchVolume = &volume
+				_, err := sharedDpState.getManifestObjects(cr, nodeInfo)
+				Expect(err).To(HaveOccurred())
+			}
+		})
+	})
+
+	Context("Process namespace sharing", func() {
+		It("Should render shareProcessNamespace only when set", func() {
+			objs, err := sharedDpState.getManifestObjects(cr, nodeInfo)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(getDaemonSetPodSpec(objs)).NotTo(HaveKey("shareProcessNamespace"))
+
+			for _, share := range []bool{true, false} {
+				share := share
+				cr.Spec.RdmaSharedDevicePlugin.ShareProcessNamespace = &share
+				objs, err := sharedDpState.getManifestObjects(cr, nodeInfo)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(getDaemonSetPodSpec(objs)).To(HaveKeyWithValue("shareProcessNamespace", share))
+			}
+		})
+	})
+
+	Context("Eviction protection", func() {
+		getPodAnnotations := func() map[string]string {
+			objs, err := sharedDpState.getManifestObjects(cr, nodeInfo)
+			Expect(err).NotTo(HaveOccurred())
+			annotations, _, err := unstructured.NestedStringMap(
+				getDaemonSet(objs).Object, "spec", "template", "metadata", "annotations")
+			Expect(err).NotTo(HaveOccurred())
+			return annotations
+		}
+
+		It("Should render the eviction protection annotations by default", func() {
+			annotations := getPodAnnotations()
+			Expect(annotations).To(HaveKeyWithValue("cluster-autoscaler.kubernetes.io/safe-to-evict", "false"))
+			Expect(annotations).To(HaveKeyWithValue("descheduler.alpha.kubernetes.io/prefer-no-eviction", "true"))
+		})
+		It("Should not render the eviction protection annotations when disabled", func() {
+			disabled := false
+			cr.Spec.RdmaSharedDevicePlugin.EvictionProtection = &disabled
+			Expect(getPodAnnotations()).To(BeEmpty())
+		})
+	})
+
+	Context("TLS certificate", func() {
+		var (
+			scheme *runtime.Scheme
+			c      client.Client
+			now    time.Time
+		)
+
+		BeforeEach(func() {
+			scheme = runtime.NewScheme()
+			Expect(corev1.AddToScheme(scheme)).To(Succeed())
+			Expect(mellanoxv1alpha1.AddToScheme(scheme)).To(Succeed())
+			c = fake.NewClientBuilder().WithScheme(scheme).Build()
+			cr.Name = "nic-cluster-policy"
+			cr.UID = "uid"
+			cr.Spec.RdmaSharedDevicePlugin.TLS = &mellanoxv1alpha1.DevicePluginTLSSpec{
+				Enabled:        true,
+				Validity:       "240h",
+				RotationWindow: "24h",
+			}
+			now = time.Now()
+		})
+
+		getSecret := func() *corev1.Secret {
+			secret := &corev1.Secret{}
+			Expect(c.Get(context.Background(), types.NamespacedName{
+				Namespace: consts.NetworkOperatorResourceNamespace, Name: sharedDpTLSSecretName}, secret)).To(Succeed())
+			return secret
+		}
+		getCertHash := func(at time.Time) string {
+			tlsCert, _, err := reconcileDevicePluginTLSCert(context.Background(), c, scheme, cr,
+				cr.Spec.RdmaSharedDevicePlugin, sharedDpTLSSecretName, at)
+			Expect(err).NotTo(HaveOccurred())
+			sharedDpState.tlsCert = tlsCert
+			objs, err := sharedDpState.getManifestObjects(cr, nodeInfo)
+			Expect(err).NotTo(HaveOccurred())
+			annotations, _, err := unstructured.NestedStringMap(
+				getDaemonSet(objs).Object, "spec", "template", "metadata", "annotations")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(annotations).To(HaveKeyWithValue("network.nvidia.com/operator.tls-cert-hash", tlsCert.Hash))
+			return tlsCert.Hash
+		}
+
+		It("Should create the certificate Secret and mount it in the device plugin container", func() {
+			tlsCert, resyncAfter, err := reconcileDevicePluginTLSCert(context.Background(), c, scheme, cr,
+				cr.Spec.RdmaSharedDevicePlugin, sharedDpTLSSecretName, now)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resyncAfter).To(Equal(216 * time.Hour))
+
+			secret := getSecret()
+			Expect(secret.Type).To(Equal(corev1.SecretTypeTLS))
+			Expect(secret.Data).To(HaveKey(corev1.TLSCertKey))
+			Expect(secret.Data).To(HaveKey(corev1.TLSPrivateKeyKey))
+			Expect(metav1.IsControlledBy(secret, cr)).To(BeTrue())
+			cert, err := parseCertificate(secret.Data[corev1.TLSCertKey])
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cert.NotAfter).To(BeTemporally("~", now.Add(240*time.Hour), time.Second))
+
+			sharedDpState.tlsCert = tlsCert
+			objs, err := sharedDpState.getManifestObjects(cr, nodeInfo)
+			Expect(err).NotTo(HaveOccurred())
+			podSpec := getDaemonSetPodSpec(objs)
+			Expect(podSpec["volumes"]).To(ContainElement(map[string]interface{}{
+				"name":   "tls",
+				"secret": map[string]interface{}{"secretName": sharedDpTLSSecretName},
+			}))
+			container := podSpec["containers"].([]interface{})[0].(map[string]interface{})
+			Expect(container["volumeMounts"]).To(ContainElement(map[string]interface{}{
+				"name":      "tls",
+				"mountPath": dpTLSDefaultMountPath,
+				"readOnly":  true,
+			}))
+		})
+		It("Should rotate the certificate within the rotation window and roll the device plugin Pods", func() {
+			hash := getCertHash(now)
+			cert := getSecret().Data[corev1.TLSCertKey]
+
+			// the certificate is kept until the rotation window
+			Expect(getCertHash(now.Add(215 * time.Hour))).To(Equal(hash))
+			Expect(getSecret().Data[corev1.TLSCertKey]).To(Equal(cert))
+
+			rotatedHash := getCertHash(now.Add(216 * time.Hour))
+			Expect(rotatedHash).NotTo(Equal(hash))
+			Expect(getSecret().Data[corev1.TLSCertKey]).NotTo(Equal(cert))
+		})
+		It("Should fail on a rotation window not shorter than the validity", func() {
+			cr.Spec.RdmaSharedDevicePlugin.TLS.RotationWindow = "240h"
+			_, _, err := reconcileDevicePluginTLSCert(context.Background(), c, scheme, cr,
+				cr.Spec.RdmaSharedDevicePlugin, sharedDpTLSSecretName, now)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
@@ -18,24 +18,32 @@ package state
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
+	"strings"
 
 	"github.com/pkg/errors"
-	appsv1 "k8s.io/api/apps/v1"
+	"go.opentelemetry.io/otel/attribute"
+	corev1 "k8s.io/api/core/v1"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
+	mellanoxv1alpha1 "github.com/Mellanox/network-operator/api/v1alpha1"
 	"github.com/Mellanox/network-operator/pkg/consts"
 	"github.com/Mellanox/network-operator/pkg/nodeinfo"
 	"github.com/Mellanox/network-operator/pkg/render"
+	"github.com/Mellanox/network-operator/pkg/tracing"
 )
 
 type runtimeSpec struct {
-	Namespace string
+	Namespace    string
+	FeatureGates featureGates
+	// PriorityClassName is the PriorityClass referenced by the critical Pods
+	PriorityClassName string
+	// External is the external render data of NicClusterPolicy, keyed by prefix
+	External ExternalRenderData
 }
 
 // a state skeleton intended to be embedded in structs implementing the State interface
@@ -44,9 +52,19 @@ type stateSkel struct {
 	name        string
 	description string
 
-	client   client.Client
-	scheme   *runtime.Scheme
-	renderer render.Renderer
+	clientProvider ClientProvider
+	scheme         *runtime.Scheme
+	renderer       render.Renderer
+	// manifestVersions holds the renderers of versioned manifest dirs keyed by version, renderer renders the latest
+	manifestVersions map[string]render.Renderer
+	// readinessQuorum of the workload objects of the state, defaults to all pods ready
+	readinessQuorum readinessQuorum
+	// applyOrder selects the objects of the state applied first, objects are applied in manifest order by default
+	applyOrder []applyOrderHint
+	// externalRenderData the manifests of the state are rendered with
+	externalRenderData ExternalRenderData
+	// workloads is the readiness of the workload objects checked by the last getSyncState invocation
+	workloads []WorkloadReadiness
 }
 
 // Name provides the State name
@@ -59,9 +77,34 @@ func (s *stateSkel) Description() string {
 	return s.description
 }
 
-func (s *stateSkel) getObj(obj *unstructured.Unstructured) error {
+// WorkloadReadiness returns the readiness of the workload objects checked by the last Sync invocation
+func (s *stateSkel) WorkloadReadiness() []WorkloadReadiness {
+	return s.workloads
+}
+
+// resetWorkloadReadiness clears the readiness of the workload objects before a Sync invocation, so a Sync which does
+// not check the readiness of its objects reports none
+func (s *stateSkel) resetWorkloadReadiness() {
+	s.workloads = nil
+}
+
+// setExternalRenderData sets the external render data the manifests of the state are rendered with
+func (s *stateSkel) setExternalRenderData(data ExternalRenderData) {
+	s.externalRenderData = data
+}
+
+// getClient returns the kubernetes API client used to reconcile the custom resource
+func (s *stateSkel) getClient(customResource interface{}) (client.Client, error) {
+	c, err := s.clientProvider.GetClient(customResource)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get kubernetes API client")
+	}
+	return c, nil
+}
+
+func (s *stateSkel) getObj(c client.Client, obj *unstructured.Unstructured) error {
 	log.V(consts.LogLevelInfo).Info("Get Object", "Namespace:", obj.GetNamespace(), "Name:", obj.GetName())
-	err := s.client.Get(
+	err := c.Get(
 		context.TODO(), types.NamespacedName{Name: obj.GetName(), Namespace: obj.GetNamespace()}, obj)
 	if k8serrors.IsNotFound(err) {
 		// does not exist (yet)
@@ -70,10 +113,10 @@ func (s *stateSkel) getObj(obj *unstructured.Unstructured) error {
 	return err
 }
 
-func (s *stateSkel) createObj(obj *unstructured.Unstructured) error {
+func (s *stateSkel) createObj(c client.Client, obj *unstructured.Unstructured) error {
 	log.V(consts.LogLevelInfo).Info("Creating Object", "Namespace:", obj.GetNamespace(), "Name:", obj.GetName())
 	toCreate := obj.DeepCopy()
-	if err := s.client.Create(context.TODO(), toCreate); err != nil {
+	if err := c.Create(context.TODO(), toCreate); err != nil {
 		if k8serrors.IsAlreadyExists(err) {
 			log.V(consts.LogLevelInfo).Info("Object Already Exists")
 		}
@@ -83,66 +126,174 @@ func (s *stateSkel) createObj(obj *unstructured.Unstructured) error {
 	return nil
 }
 
-func (s *stateSkel) updateObj(obj *unstructured.Unstructured) error {
+// updateObj updates the object and returns whether it was changed, the API server keeps the resource version of
+// objects which are not changed by an update
+func (s *stateSkel) updateObj(c client.Client, obj *unstructured.Unstructured) (bool, error) {
 	log.V(consts.LogLevelInfo).Info("Updating Object", "Namespace:", obj.GetNamespace(), "Name:", obj.GetName())
 	// Note: Some objects may require update of the resource version
 	// TODO: using Patch preserves runtime attributes. In the future consider using patch if relevant
 	desired := obj.DeepCopy()
-	if err := s.client.Update(context.TODO(), desired); err != nil {
-		return errors.Wrap(err, "failed to update resource")
+	if err := c.Update(context.TODO(), desired); err != nil {
+		return false, errors.Wrap(err, "failed to update resource")
 	}
 	log.V(consts.LogLevelInfo).Info("Object updated successfully")
-	return nil
+	return desired.GetResourceVersion() != obj.GetResourceVersion(), nil
+}
+
+// objectStuckDeletingError is returned when a managed object can not be updated as it is Terminating, e.g. waiting
+// for a finalizer of another controller to be removed
+type objectStuckDeletingError struct {
+	kind       string
+	name       types.NamespacedName
+	finalizers []string
+}
+
+func (e *objectStuckDeletingError) Error() string {
+	name := e.name.Name
+	if e.name.Namespace != "" {
+		name = e.name.String()
+	}
+	if len(e.finalizers) == 0 {
+		return fmt.Sprintf("object %s %s is stuck deleting", e.kind, name)
+	}
+	return fmt.Sprintf("object %s %s is stuck deleting, blocked by finalizers %s", e.kind, name,
+		strings.Join(e.finalizers, ", "))
+}
+
+// IsObjectStuckDeleting checks if err is caused by a managed object which is Terminating and thus can not be updated
+func IsObjectStuckDeleting(err error) bool {
+	_, ok := errors.Cause(err).(*objectStuckDeletingError)
+	return ok
 }
 
 func (s *stateSkel) createOrUpdateObjs(
+	ctx context.Context,
+	c client.Client,
 	setControllerReference func(obj *unstructured.Unstructured) error,
 	objs []*unstructured.Unstructured) error {
-	for _, desiredObj := range objs {
-		log.V(consts.LogLevelInfo).Info("Handling manifest object", "Kind:", desiredObj.GetKind(),
-			"Name", desiredObj.GetName())
-		// Set controller reference for object to allow cleanup on CR deletion
-		if err := setControllerReference(desiredObj); err != nil {
-			return errors.Wrap(err, "failed to set controller reference for object")
-		}
-
-		err := s.createObj(desiredObj)
-		if err == nil {
-			// object created successfully
+	endRenderPhase(ctx)
+	defer startSyncPhase(ctx, SyncPhaseApply)()
+	// no object is applied if any of them is rejected
+	if err := checkResourceLimits(ctx, objs); err != nil {
+		return err
+	}
+	// objects stuck deleting do not prevent applying the other objects, they are reported once all are handled
+	var stuckErr error
+	for _, desiredObj := range orderObjects(objs, s.applyOrder) {
+		err := s.createOrUpdateObj(ctx, c, setControllerReference, desiredObj)
+		if IsObjectStuckDeleting(err) {
+			if stuckErr == nil {
+				stuckErr = err
+			}
 			continue
 		}
-		if !k8serrors.IsAlreadyExists(err) {
-			// Some error occurred
+		if err != nil {
 			return err
 		}
+	}
+	return stuckErr
+}
 
-		// Set resource version
-		// ResourceVersion must be passed unmodified back to the server.
-		// ResourceVersion helps the kubernetes API server to implement optimistic concurrency for PUT operations
-		// when two PUT requests are specifying the resourceVersion, one of the PUTs will fail.
-		currentObj := desiredObj.DeepCopy()
-		if err := s.getObj(currentObj); err != nil {
-			// Some error occurred
-			return err
-		}
-		desiredObj.SetResourceVersion(currentObj.GetResourceVersion())
+func (s *stateSkel) createOrUpdateObj(
+	ctx context.Context,
+	c client.Client,
+	setControllerReference func(obj *unstructured.Unstructured) error,
+	desiredObj *unstructured.Unstructured) (err error) {
+	_, span := tracing.StartSpan(ctx, "ApplyObject",
+		attribute.String("kind", desiredObj.GetKind()),
+		attribute.String("name", desiredObj.GetName()),
+		attribute.String("namespace", desiredObj.GetNamespace()))
+	defer func() { tracing.EndSpan(span, err) }()
 
-		// Object found, Update it
-		if err := s.updateObj(desiredObj); err != nil {
-			return err
+	log.V(consts.LogLevelInfo).Info("Handling manifest object", "Kind:", desiredObj.GetKind(),
+		"Name", desiredObj.GetName())
+	if err := claimObject(ctx, s.name, desiredObj); err != nil {
+		return err
+	}
+	// Label object as owned by the operator to allow pruning it, see Prune
+	labels := desiredObj.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[consts.NetworkOperatorOwnedLabel] = "true"
+	desiredObj.SetLabels(labels)
+	setSourceGeneration(ctx, desiredObj)
+	// Set controller reference for object to allow cleanup on CR deletion
+	if err := setControllerReference(desiredObj); err != nil {
+		return errors.Wrap(err, "failed to set controller reference for object")
+	}
+
+	err = s.createObj(c, desiredObj)
+	if err == nil {
+		// object created successfully
+		recordEvent(ctx, desiredObj, corev1.EventTypeNormal, EventReasonObjectApplied,
+			"Created by state %s", s.name)
+		countAppliedObject(ctx)
+		return nil
+	}
+	if !k8serrors.IsAlreadyExists(err) {
+		// Some error occurred
+		return err
+	}
+
+	// Set resource version
+	// ResourceVersion must be passed unmodified back to the server.
+	// ResourceVersion helps the kubernetes API server to implement optimistic concurrency for PUT operations
+	// when two PUT requests are specifying the resourceVersion, one of the PUTs will fail.
+	currentObj := desiredObj.DeepCopy()
+	if err := s.getObj(c, currentObj); err != nil {
+		// Some error occurred
+		return err
+	}
+	if currentObj.GetDeletionTimestamp() != nil {
+		// an update of a Terminating object can not revert its deletion, wait for it to be gone to recreate it
+		stuckErr := &objectStuckDeletingError{
+			kind:       currentObj.GetKind(),
+			name:       types.NamespacedName{Namespace: currentObj.GetNamespace(), Name: currentObj.GetName()},
+			finalizers: currentObj.GetFinalizers(),
 		}
+		log.V(consts.LogLevelWarning).Info("Object is terminating, skipping update", "Kind:", currentObj.GetKind(),
+			"Name", currentObj.GetName(), "Finalizers", currentObj.GetFinalizers())
+		recordEvent(ctx, currentObj, corev1.EventTypeWarning, EventReasonObjectStuckDeleting, "%s", stuckErr.Error())
+		return stuckErr
+	}
+	if desiredObj.GetKind() == netAttDefKind {
+		reconcileNetAttDefConfig(ctx, currentObj, desiredObj)
+	}
+	desiredObj.SetResourceVersion(currentObj.GetResourceVersion())
+
+	// Object found, Update it
+	changed, err := s.updateObj(c, desiredObj)
+	if err != nil {
+		return err
+	}
+	if changed {
+		recordEvent(ctx, desiredObj, corev1.EventTypeNormal, EventReasonObjectApplied,
+			"Updated by state %s", s.name)
+		countAppliedObject(ctx)
 	}
 	return nil
 }
 
+// getNodeInfo returns the node info provider of infoCatalog, its retrieval is timed as the nodeinfo phase of the Sync
+func (s *stateSkel) getNodeInfo(ctx context.Context, infoCatalog InfoCatalog) (nodeinfo.Provider, error) {
+	defer startSyncPhase(ctx, SyncPhaseNodeInfo)()
+	return getNodeInfo(infoCatalog)
+}
+
 // Iterate over objects and check for their readiness
-func (s *stateSkel) getSyncState(objs []*unstructured.Unstructured) (SyncState, error) {
+func (s *stateSkel) getSyncState(
+	ctx context.Context, c client.Client, objs []*unstructured.Unstructured) (SyncState, error) {
+	endRenderPhase(ctx)
+	defer startSyncPhase(ctx, SyncPhaseStatusCheck)()
 	log.V(consts.LogLevelInfo).Info("Checking related object states")
+	s.workloads = nil
+	var syncState SyncState = SyncStateReady
 	for _, obj := range objs {
 		log.V(consts.LogLevelInfo).Info("Checking object", "Kind:", obj.GetKind(), "Name", obj.GetName())
 		// Check if object exists
 		found := obj.DeepCopy()
-		err := s.getObj(found)
+		err := s.getObj(c, found)
 		if err != nil {
 			if k8serrors.IsNotFound(err) {
 				// does not exist (yet)
@@ -153,54 +304,70 @@ func (s *stateSkel) getSyncState(objs []*unstructured.Unstructured) (SyncState,
 			return SyncStateNotReady, errors.Wrapf(err, "failed to get object")
 		}
 
-		// Object exists, check for Kind specific readiness
-		if found.GetKind() == "DaemonSet" {
-			if ready, err := s.isDaemonSetReady(found); err != nil || !ready {
+		// Object exists, summarize the readiness of workload objects
+		gk := found.GroupVersionKind().GroupKind()
+		if getReadiness, ok := workloadReadinessGetters[gk]; ok {
+			readiness, err := getReadiness(found)
+			if err != nil {
+				return SyncStateNotReady, err
+			}
+			s.workloads = append(s.workloads, readiness)
+		}
+		// check for Kind specific readiness, the remaining workload objects are still summarized if not ready
+		if isReady, ok := readinessEvaluators[gk]; ok {
+			ready, err := isReady(c, found, s.readinessQuorum)
+			if err != nil {
 				log.V(consts.LogLevelInfo).Info("Object is not ready", "Kind:", obj.GetKind(), "Name", obj.GetName())
 				return SyncStateNotReady, err
 			}
+			if !ready {
+				log.V(consts.LogLevelInfo).Info("Object is not ready", "Kind:", obj.GetKind(), "Name", obj.GetName())
+				syncState = SyncStateNotReady
+				continue
+			}
 		}
 		log.V(consts.LogLevelInfo).Info("Object is ready", "Kind:", obj.GetKind(), "Name", obj.GetName())
 	}
-	return SyncStateReady, nil
+	return syncState, nil
 }
 
-// isDaemonSetReady checks if daemonset is ready
-func (s *stateSkel) isDaemonSetReady(uds *unstructured.Unstructured) (bool, error) {
-	buf, err := uds.MarshalJSON()
-	if err != nil {
-		return false, errors.Wrap(err, "failed to marshall unstructured daemonset object")
-	}
-
-	ds := &appsv1.DaemonSet{}
-	if err = json.Unmarshal(buf, ds); err != nil {
-		return false, errors.Wrap(err, "failed to unmarshall to daemonset object")
+// getAttributesWithDefaults returns a copy of NodeAttributes where the provided attrTypes which are missing or empty
+// are set from the render defaults. The node attribute takes precedence over its default, an error is returned if
+// an attribute is neither set on the node nor defaulted.
+func (s *stateSkel) getAttributesWithDefaults(attrs nodeinfo.NodeAttributes,
+	defaults *mellanoxv1alpha1.RenderDefaultsSpec, attrTypes ...nodeinfo.AttributeType) (nodeinfo.NodeAttributes, error) {
+	result := attrs
+	result.Attributes = make(map[nodeinfo.AttributeType]string, len(attrs.Attributes))
+	for t, val := range attrs.Attributes {
+		result.Attributes[t] = val
 	}
-
-	log.V(consts.LogLevelDebug).Info(
-		"Check daemonset state",
-		"DesiredNodes:", ds.Status.DesiredNumberScheduled,
-		"CurrentNodes:", ds.Status.CurrentNumberScheduled,
-		"PodsAvailable:", ds.Status.NumberAvailable,
-		"PodsUnavailable:", ds.Status.NumberUnavailable,
-		"PodsReady:", ds.Status.NumberReady,
-		"Conditions:", ds.Status.Conditions)
-	// Note(adrianc): We check for DesiredNumberScheduled!=0 as we expect to have at least one node that would need
-	// to have DaemonSet Pods deployed onto it. DesiredNumberScheduled == 0 then indicates that this field was not yet
-	// updated by the DaemonSet controller
-	// TODO: Check if we can use another field maybe to indicate it was processed by the DaemonSet controller.
-	if ds.Status.DesiredNumberScheduled != 0 && ds.Status.DesiredNumberScheduled == ds.Status.NumberAvailable {
-		return true, nil
+	for _, t := range attrTypes {
+		if result.Attributes[t] != "" {
+			continue
+		}
+		val := getRenderDefault(defaults, t)
+		if val == "" {
+			return nodeinfo.NodeAttributes{}, fmt.Errorf("mandatory node attribute does not exist for node %s", attrs.Name)
+		}
+		log.V(consts.LogLevelDebug).Info("Using render default for missing node attribute",
+			"node", attrs.Name, "attribute", t, "value", val)
+		result.Attributes[t] = val
 	}
-	return false, nil
+	return result, nil
 }
 
-// Check if provided attrTypes are present in NodeAttributes.Attributes
-func (s *stateSkel) checkAttributesExist(attrs nodeinfo.NodeAttributes, attrTypes ...nodeinfo.AttributeType) error {
-	for _, t := range attrTypes {
-		if _, ok := attrs.Attributes[t]; !ok {
-			return fmt.Errorf("mandatory node attribute does not exist for node %s", attrs.Name)
-		}
+// getRenderDefault returns the render default of the attribute type, or an empty string if not set
+func getRenderDefault(defaults *mellanoxv1alpha1.RenderDefaultsSpec, t nodeinfo.AttributeType) string {
+	if defaults == nil {
+		return ""
 	}
-	return nil
+	switch t {
+	case nodeinfo.AttrTypeCPUArch:
+		return defaults.CPUArch
+	case nodeinfo.AttrTypeOSName:
+		return defaults.OSName
+	case nodeinfo.AttrTypeOSVer:
+		return defaults.OSVer
+	}
+	return ""
 }
@@ -17,64 +17,115 @@ limitations under the License.
 package state //nolint:dupl
 
 import (
+	"context"
+	"time"
+
 	"github.com/pkg/errors"
 	appsv1 "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
-	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	mellanoxv1alpha1 "github.com/Mellanox/network-operator/api/v1alpha1"
+	"github.com/Mellanox/network-operator/pkg/config"
 	"github.com/Mellanox/network-operator/pkg/consts"
 	"github.com/Mellanox/network-operator/pkg/nodeinfo"
 	"github.com/Mellanox/network-operator/pkg/render"
-	"github.com/Mellanox/network-operator/pkg/utils"
 )
 
 // NewStateSriovDp creates a new shared device plugin state
-func NewStateSriovDp(k8sAPIClient client.Client, scheme *runtime.Scheme, manifestDir string) (State, error) {
-	files, err := utils.GetFilesWithSuffix(manifestDir, render.ManifestFileSuffix...)
+func NewStateSriovDp(clientProvider ClientProvider, scheme *runtime.Scheme, manifestDir string) (State, error) {
+	renderer, manifestVersions, err := newManifestRenderers(manifestDir)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to get files from manifest dir")
+		return nil, err
+	}
+	ofedCompatibility, err := getOFEDCompatibilityMatrix()
+	if err != nil {
+		return nil, err
 	}
-
-	renderer := render.NewRenderer(files)
 	return &stateSriovDp{
 		stateSkel: stateSkel{
-			name:        "state-SRIOV-device-plugin",
-			description: "SR-IOV device plugin deployed in the cluster",
-			client:      k8sAPIClient,
-			scheme:      scheme,
-			renderer:    renderer,
-		}}, nil
+			name:             "state-SRIOV-device-plugin",
+			description:      "SR-IOV device plugin deployed in the cluster",
+			clientProvider:   clientProvider,
+			scheme:           scheme,
+			renderer:         renderer,
+			manifestVersions: manifestVersions,
+			// device plugin should be ready on all eligible nodes
+			readinessQuorum: readinessQuorumAll,
+			// device plugin config is read by the device plugin on startup
+			applyOrder: []applyOrderHint{{Kind: "ConfigMap"}},
+		},
+		ofedCompatibility:       ofedCompatibility,
+		ofedCompatibilityStrict: config.FromEnv().State.OFEDCompatibilityStrict,
+	}, nil
 }
 
 type stateSriovDp struct {
 	stateSkel
+	devicePluginSkippedNodes
+	stateWarnings
+	stateResync
+	// nodePools are the node pools of the nodes which are part of a device plugin node pool keyed by node name
+	nodePools map[string]string
+	// tlsCert is the TLS certificate Secret mounted in the device plugin container, nil if TLS is not enabled
+	tlsCert *devicePluginTLSCert
+	// scope confines the device plugin to the nodes and namespace of the scope of the NicClusterPolicy
+	scope devicePluginScope
+	// ofedCompatibility is the OFED driver compatibility matrix the device plugin version is checked against
+	ofedCompatibility []ofedDevicePluginIncompatibility
+	// ofedCompatibilityStrict fails the sync if the OFED driver version is known to be incompatible with the device
+	// plugin version instead of reporting a warning
+	ofedCompatibilityStrict bool
 }
 
 type sriovDpRuntimeSpec struct {
 	runtimeSpec
 	CPUArch string
 	OSName  string
+	// SCCName is the name of the SecurityContextConstraints of the device plugin on OpenShift, unique per scope
+	SCCName string
 }
 
 type sriovDpManifestRenderData struct {
-	CrSpec              *mellanoxv1alpha1.DevicePluginSpec
-	NodeAffinity        *v1.NodeAffinity
-	DeployInitContainer bool
-	RuntimeSpec         *sriovDpRuntimeSpec
+	CrSpec *mellanoxv1alpha1.DevicePluginSpec
+	// NodePools of the device plugin, each rendered with its own config and DaemonSet. The first pool is deployed on
+	// the nodes which are not part of a node pool
+	NodePools   []devicePluginNodePool
+	HealthCheck *mellanoxv1alpha1.DevicePluginHealthCheckSpec
+	// InitContainers of the device plugin Pod in the order they run
+	InitContainers []v1.Container
+	// RegistrationCheck is the liveness probe of the kubelet registration check, not rendered if nil
+	RegistrationCheck *v1.Probe
+	// CPU configuration of the device plugin container, not rendered if nil
+	CPU *devicePluginCPU
+	// ScratchVolume is the memory-backed scratch volume of the device plugin, not rendered if nil
+	ScratchVolume *devicePluginScratchVolume
+	// TLSCert is the TLS certificate Secret mounted in the device plugin container, not rendered if nil
+	TLSCert *devicePluginTLSCert
+	// EvictionProtection renders the annotations protecting the device plugin Pods from eviction
+	EvictionProtection bool
+	// GPUTolerations derived from the taints of the GPU nodes, rendered in addition to the static tolerations
+	GPUTolerations []v1.Toleration
+	RuntimeSpec    *sriovDpRuntimeSpec
 }
 
 //nolint:dupl
 // Sync attempt to get the system to match the desired state which State represent.
 // a sync operation must be relatively short and must not block the execution thread.
-func (s *stateSriovDp) Sync(customResource interface{}, infoCatalog InfoCatalog) (SyncState, error) {
+func (s *stateSriovDp) Sync(
+	ctx context.Context, customResource interface{}, infoCatalog InfoCatalog) (SyncState, error) {
 	cr := customResource.(*mellanoxv1alpha1.NicClusterPolicy)
 	log.V(consts.LogLevelInfo).Info(
 		"Sync Custom resource", "State:", s.name, "Name:", cr.Name, "Namespace:", cr.Namespace)
+	s.skippedNodes = nil
+	s.nodePools = nil
+	s.warnings = nil
+	s.tlsCert = nil
+	s.resyncAfter = 0
+	s.scope = getDevicePluginScope(ctx)
 
 	if cr.Spec.SriovDevicePlugin == nil {
 		// Either this state was not required to run or an update occurred and we need to remove
@@ -83,9 +134,19 @@ func (s *stateSriovDp) Sync(customResource interface{}, infoCatalog InfoCatalog)
 		return SyncStateIgnore, nil
 	}
 	// Fill ManifestRenderData and render objects
-	nodeInfo := infoCatalog.GetNodeInfoProvider()
-	if nodeInfo == nil {
-		return SyncStateError, errors.New("unexpected state, catalog does not provide node information")
+	nodeInfo, err := s.getNodeInfo(ctx, infoCatalog)
+	if err != nil {
+		return SyncStateError, err
+	}
+	nodeInfo = s.scope.getNodeInfo(nodeInfo)
+	k8sClient, err := s.getClient(cr)
+	if err != nil {
+		return SyncStateNotReady, err
+	}
+	s.tlsCert, s.resyncAfter, err = reconcileDevicePluginTLSCert(ctx, k8sClient, s.scheme, cr,
+		cr.Spec.SriovDevicePlugin, sriovDpTLSSecretName, time.Now())
+	if err != nil {
+		return SyncStateNotReady, err
 	}
 	objs, err := s.getManifestObjects(cr, nodeInfo)
 	if err != nil {
@@ -95,8 +156,15 @@ func (s *stateSriovDp) Sync(customResource interface{}, infoCatalog InfoCatalog)
 		return SyncStateNotReady, nil
 	}
 
+	if err := labelSkippedNodes(ctx, k8sClient, sriovDpSkipNodeLabel, s.skippedNodes); err != nil {
+		return SyncStateNotReady, err
+	}
+	if err := labelNodes(ctx, k8sClient, sriovDpNodePoolLabel, s.nodePools); err != nil {
+		return SyncStateNotReady, err
+	}
+
 	// Create objects if they dont exist, Update objects if they do exist
-	err = s.createOrUpdateObjs(func(obj *unstructured.Unstructured) error {
+	err = s.createOrUpdateObjs(ctx, k8sClient, func(obj *unstructured.Unstructured) error {
 		if err := controllerutil.SetControllerReference(cr, obj, s.scheme); err != nil {
 			return errors.Wrap(err, "failed to set controller reference for object")
 		}
@@ -105,11 +173,22 @@ func (s *stateSriovDp) Sync(customResource interface{}, infoCatalog InfoCatalog)
 	if err != nil {
 		return SyncStateNotReady, errors.Wrap(err, "failed to create/update objects")
 	}
+	if err := deleteStaleNodePools(ctx, k8sClient, cr, sriovDpNodePoolLabel, objs); err != nil {
+		return SyncStateNotReady, err
+	}
 	// Check objects status
-	syncState, err := s.getSyncState(objs)
+	syncState, err := s.getSyncState(ctx, k8sClient, objs)
 	if err != nil {
 		return SyncStateNotReady, errors.Wrap(err, "failed to get sync state")
 	}
+	err = annotateNodeReadiness(ctx, k8sClient, sriovDpReadyAnnotation, s.scope.getNodeSelector(), objs)
+	if err != nil {
+		return SyncStateNotReady, err
+	}
+	if syncState == SyncStateReady && len(getNodesWithoutVerifiedOFED(cr, nodeInfo)) != 0 {
+		// the device plugin is not deployed yet on nodes waiting for OFED
+		return SyncStateNotReady, nil
+	}
 	return syncState, nil
 }
 
@@ -130,18 +209,83 @@ func (s *stateSriovDp) getManifestObjects(
 		return []*unstructured.Unstructured{}, nil
 	}
 
+	s.skippedNodes, s.warnings = getDevicePluginSkippedNodes(cr.Spec.SriovDevicePlugin, nodeInfo)
+
+	incompatibilities, err := checkOFEDCompatibility(cr, s.ofedCompatibility, compatibilitySriovDevicePlugin,
+		cr.Spec.SriovDevicePlugin.Version, s.ofedCompatibilityStrict)
+	if err != nil {
+		return nil, err
+	}
+	s.warnings = append(s.warnings, incompatibilities...)
+
+	gpuTolerations, tolerationWarnings := getDevicePluginGPUTolerations(cr.Spec.SriovDevicePlugin, nodeInfo)
+	s.warnings = append(s.warnings, tolerationWarnings...)
+
+	// the OS name is optional for the SR-IOV device plugin, it is only used to render OpenShift specific objects
+	osName := attrs[0].Attributes[nodeinfo.AttrTypeOSName]
+	if osName == "" {
+		osName = getRenderDefault(cr.Spec.RenderDefaults, nodeinfo.AttrTypeOSName)
+	}
+
+	initContainers, err := getDevicePluginInitContainers(cr.Spec.SriovDevicePlugin, cr.Spec.OFEDDriver != nil,
+		getDevicePluginLegacySockets(cr.Spec.SriovDevicePlugin, sriovDpLegacySockets), "devicesock")
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid device plugin init containers")
+	}
+
+	scratchVolume, err := getDevicePluginScratchVolume(cr.Spec.SriovDevicePlugin)
+	if err != nil {
+		return nil, err
+	}
+
+	cpu, err := getDevicePluginCPU(cr.Spec.SriovDevicePlugin)
+	if err != nil {
+		return nil, err
+	}
+	setDevicePluginInitContainersResources(initContainers, cpu)
+
+	healthCheck, err := getDevicePluginHealthCheck(cr.Spec.SriovDevicePlugin, sriovDpDefaultHealthPort)
+	if err != nil {
+		return nil, err
+	}
+
+	nodePools, poolNodes, err := getDevicePluginNodePools(cr.Spec.SriovDevicePlugin,
+		s.scope.getNodeAffinity(excludeSkippedNodesAffinity(cr.Spec.NodeAffinity, sriovDpSkipNodeLabel)), nodeInfo,
+		sriovDpNodePoolLabel, sriovDpResourceListKey)
+	if err != nil {
+		return nil, err
+	}
+	s.nodePools = poolNodes
+
 	renderData := &sriovDpManifestRenderData{
-		CrSpec:              cr.Spec.SriovDevicePlugin,
-		NodeAffinity:        cr.Spec.NodeAffinity,
-		DeployInitContainer: cr.Spec.OFEDDriver != nil,
+		CrSpec:             cr.Spec.SriovDevicePlugin,
+		NodePools:          nodePools,
+		HealthCheck:        healthCheck,
+		RegistrationCheck:  getDevicePluginRegistrationCheck(cr.Spec.SriovDevicePlugin),
+		InitContainers:     initContainers,
+		ScratchVolume:      scratchVolume,
+		TLSCert:            s.tlsCert,
+		EvictionProtection: isDevicePluginEvictionProtected(cr.Spec.SriovDevicePlugin),
+		GPUTolerations:     gpuTolerations,
+		CPU:                cpu,
 		RuntimeSpec: &sriovDpRuntimeSpec{
-			runtimeSpec: runtimeSpec{consts.NetworkOperatorResourceNamespace},
-			OSName:      attrs[0].Attributes[nodeinfo.AttrTypeOSName],
+			runtimeSpec: runtimeSpec{
+				Namespace:         s.scope.getNamespace(),
+				FeatureGates:      cr.Spec.FeatureGates,
+				PriorityClassName: getPriorityClassName(cr),
+				External:          s.externalRenderData,
+			},
+			OSName:  osName,
+			SCCName: s.scope.getClusterObjectName("sriov-device-plugin"),
 		},
 	}
 	// render objects
 	log.V(consts.LogLevelDebug).Info("Rendering objects", "data:", renderData)
-	objs, err := s.renderer.RenderObjects(&render.TemplatingData{Data: renderData})
+	renderer, err := s.getRenderer(cr.Spec.SriovDevicePlugin.ManifestVersion)
+	if err != nil {
+		return nil, err
+	}
+	objs, err := renderer.RenderObjects(&render.TemplatingData{Data: renderData})
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to render objects")
 	}
@@ -24,6 +24,7 @@ import (
 	. "github.com/onsi/gomega"
 
 	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 
@@ -39,6 +40,17 @@ type dummyProvider struct {
 }
 
 func (p *dummyProvider) GetNodesAttributes(filters ...nodeinfo.Filter) []nodeinfo.NodeAttributes {
+	// a Mellanox NIC node without annotations
+	nodes := []*v1.Node{{ObjectMeta: metav1.ObjectMeta{
+		Name:   "test",
+		Labels: map[string]string{nodeinfo.NodeLabelMlnxNIC: "true"},
+	}}}
+	for _, filter := range filters {
+		nodes = filter.Apply(nodes)
+	}
+	if len(nodes) == 0 {
+		return nil
+	}
 	attr := nodeinfo.NodeAttributes{
 		Name:       "test",
 		Attributes: make(map[nodeinfo.AttributeType]string),
@@ -47,6 +59,14 @@ func (p *dummyProvider) GetNodesAttributes(filters ...nodeinfo.Filter) []nodeinf
 	return []nodeinfo.NodeAttributes{attr}
 }
 
+func (p *dummyProvider) Err() error {
+	return nil
+}
+
+func (p *dummyProvider) Fingerprint() string {
+	return ""
+}
+
 func checkRenderedDpCm(obj *unstructured.Unstructured, namespace, config string) {
 	Expect(obj.GetKind()).To(Equal("ConfigMap"))
 	Expect(obj.Object["metadata"].(map[string]interface{})["name"].(string)).To(Equal("sriovdp-config"))
@@ -88,11 +108,11 @@ var _ = Describe("SR-IOV Device Plugin State tests", func() {
 			stateName := "state-SRIOV-device-plugin"
 			sriovDpState := stateSriovDp{
 				stateSkel: stateSkel{
-					name:        stateName,
-					description: "SR-IOV device plugin deployed in the cluster",
-					client:      &client,
-					scheme:      scheme,
-					renderer:    renderer,
+					name:           stateName,
+					description:    "SR-IOV device plugin deployed in the cluster",
+					clientProvider: NewStaticClientProvider(&client),
+					scheme:         scheme,
+					renderer:       renderer,
 				},
 			}
 
@@ -146,7 +166,338 @@ var _ = Describe("SR-IOV Device Plugin State tests", func() {
 
 			checkRenderedDpCm(objs[0], namespace, config)
 			checkRenderedDpSA(objs[1], namespace)
-			checkRenderedDpDs(objs[2], imageSpec, nodeAffinitySpec)
+			// the nodes skipped by the device plugin are excluded in addition
+			expectedNodeAffinity := "{\"requiredDuringSchedulingIgnoredDuringExecution\":{\"nodeSelectorTerms\":" +
+				"[{\"matchExpressions\":[{\"key\":\"node-role.kubernetes.io/master\"," +
+				"\"operator\":\"DoesNotExist\"},{\"key\":\"" + sriovDpSkipNodeLabel + "\"," +
+				"\"operator\":\"NotIn\",\"values\":[\"true\"]}]}]}}"
+			checkRenderedDpDs(objs[2], imageSpec, expectedNodeAffinity)
+		})
+	})
+
+	Context("gRPC health check", func() {
+		var (
+			sriovDpState stateSriovDp
+			cr           *mellanoxv1alpha1.NicClusterPolicy
+		)
+
+		BeforeEach(func() {
+			files, err := utils.GetFilesWithSuffix("../../manifests/stage-sriov-device-plugin",
+				render.ManifestFileSuffix...)
+			Expect(err).NotTo(HaveOccurred())
+			sriovDpState = stateSriovDp{
+				stateSkel: stateSkel{
+					name:           "state-SRIOV-device-plugin",
+					description:    "SR-IOV device plugin deployed in the cluster",
+					clientProvider: NewStaticClientProvider(&mocks.ControllerRutimeClient{}),
+					scheme:         runtime.NewScheme(),
+					renderer:       render.NewRenderer(files),
+				},
+			}
+			cr = &mellanoxv1alpha1.NicClusterPolicy{}
+			cr.Spec.SriovDevicePlugin = &mellanoxv1alpha1.DevicePluginSpec{
+				ImageSpec: mellanoxv1alpha1.ImageSpec{
+					Image:      "image",
+					Repository: "Repository",
+					Version:    "v0.0",
+				},
+				Config: "config",
+			}
+		})
+
+		It("Should render a gRPC readiness probe when enabled", func() {
+			cr.Spec.SriovDevicePlugin.HealthCheck = &mellanoxv1alpha1.DevicePluginHealthCheckSpec{
+				Enabled: true,
+				Service: "device-plugin",
+			}
+			objs, err := sriovDpState.getManifestObjects(cr, &dummyProvider{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(len(objs)).To(Equal(3))
+
+			containers, _, err := unstructured.NestedSlice(objs[2].Object, "spec", "template", "spec", "containers")
+			Expect(err).NotTo(HaveOccurred())
+			container := containers[0].(map[string]interface{})
+			probe := container["readinessProbe"].(map[string]interface{})
+			grpc := probe["grpc"].(map[string]interface{})
+			Expect(grpc["port"]).To(BeEquivalentTo(sriovDpDefaultHealthPort))
+			Expect(grpc["service"]).To(Equal("device-plugin"))
+			Expect(probe["initialDelaySeconds"]).To(BeEquivalentTo(dpHealthProbeDefaultInitialDelaySeconds))
+			Expect(probe["periodSeconds"]).To(BeEquivalentTo(dpHealthProbeDefaultPeriodSeconds))
+			Expect(container["args"]).To(Equal([]interface{}{"--log-dir=sriovdp", "--log-level=10"}))
+		})
+		It("Should not render a readiness probe by default", func() {
+			objs, err := sriovDpState.getManifestObjects(cr, &dummyProvider{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(len(objs)).To(Equal(3))
+
+			containers, _, err := unstructured.NestedSlice(objs[2].Object, "spec", "template", "spec", "containers")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(containers[0]).NotTo(HaveKey("readinessProbe"))
+		})
+	})
+
+	Context("Node pools", func() {
+		var (
+			sriovDpState stateSriovDp
+			cr           *mellanoxv1alpha1.NicClusterPolicy
+			nodeInfo     nodeinfo.Provider
+		)
+
+		newNode := func(name string, labels map[string]string) *v1.Node {
+			node := &v1.Node{ObjectMeta: metav1.ObjectMeta{
+				Name:   name,
+				Labels: map[string]string{nodeinfo.NodeLabelMlnxNIC: "true"},
+			}}
+			for key, value := range labels {
+				node.Labels[key] = value
+			}
+			return node
+		}
+		getObj := func(objs []*unstructured.Unstructured, kind, name string) *unstructured.Unstructured {
+			for _, obj := range objs {
+				if obj.GetKind() == kind && obj.GetName() == name {
+					return obj
+				}
+			}
+			Fail(fmt.Sprintf("%s %s was not rendered", kind, name))
+			return nil
+		}
+		getResourceNames := func(cm *unstructured.Unstructured) []string {
+			data, _, err := unstructured.NestedString(cm.Object, "data", "config.json")
+			Expect(err).NotTo(HaveOccurred())
+			config := struct {
+				ResourceList []struct {
+					ResourceName string `json:"resourceName"`
+				} `json:"resourceList"`
+			}{}
+			Expect(json.Unmarshal([]byte(data), &config)).To(Succeed())
+			var names []string
+			for _, resource := range config.ResourceList {
+				names = append(names, resource.ResourceName)
+			}
+			return names
+		}
+		getPoolExpressions := func(ds *unstructured.Unstructured) []interface{} {
+			terms, _, err := unstructured.NestedSlice(ds.Object, "spec", "template", "spec", "affinity",
+				"nodeAffinity", "requiredDuringSchedulingIgnoredDuringExecution", "nodeSelectorTerms")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(terms).To(HaveLen(1))
+			var expressions []interface{}
+			for _, expression := range terms[0].(map[string]interface{})["matchExpressions"].([]interface{}) {
+				if expression.(map[string]interface{})["key"] == sriovDpNodePoolLabel {
+					expressions = append(expressions, expression)
+				}
+			}
+			return expressions
+		}
+
+		BeforeEach(func() {
+			files, err := utils.GetFilesWithSuffix("../../manifests/stage-sriov-device-plugin",
+				render.ManifestFileSuffix...)
+			Expect(err).NotTo(HaveOccurred())
+			sriovDpState = stateSriovDp{
+				stateSkel: stateSkel{
+					name:           "state-SRIOV-device-plugin",
+					description:    "SR-IOV device plugin deployed in the cluster",
+					clientProvider: NewStaticClientProvider(&mocks.ControllerRutimeClient{}),
+					scheme:         runtime.NewScheme(),
+					renderer:       render.NewRenderer(files),
+				},
+			}
+			cr = &mellanoxv1alpha1.NicClusterPolicy{}
+			cr.Spec.SriovDevicePlugin = &mellanoxv1alpha1.DevicePluginSpec{
+				ImageSpec: mellanoxv1alpha1.ImageSpec{
+					Image:      "image",
+					Repository: "Repository",
+					Version:    "v0.0",
+				},
+				Config: `{"resourceList": [{"resourceName": "rdma", "selectors": {"vendors": ["15b3"]}}]}`,
+				NodePools: []mellanoxv1alpha1.DevicePluginNodePoolSpec{
+					{Name: "a", NodeSelector: map[string]string{"pool": "a"}, ResourceNameSuffix: "_a"},
+					{Name: "b", NodeSelector: map[string]string{"pool": "b"}, ResourceNameSuffix: "_b"},
+				},
+			}
+			nodeInfo = nodeinfo.NewProvider([]*v1.Node{
+				newNode("node1", map[string]string{"pool": "a"}),
+				newNode("node2", map[string]string{"pool": "b"}),
+				newNode("node3", nil),
+			})
+		})
+
+		It("Should render a config and a DaemonSet with distinct resource names per pool", func() {
+			objs, err := sriovDpState.getManifestObjects(cr, nodeInfo)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(getResourceNames(getObj(objs, "ConfigMap", "sriovdp-config-a"))).To(Equal([]string{"rdma_a"}))
+			Expect(getResourceNames(getObj(objs, "ConfigMap", "sriovdp-config-b"))).To(Equal([]string{"rdma_b"}))
+			Expect(getResourceNames(getObj(objs, "ConfigMap", "sriovdp-config"))).To(Equal([]string{"rdma"}))
+
+			for _, pool := range []string{"a", "b"} {
+				ds := getObj(objs, "DaemonSet", "sriov-device-plugin-"+pool)
+				Expect(ds.GetLabels()).To(HaveKeyWithValue(sriovDpNodePoolLabel, pool))
+				volumes, _, err := unstructured.NestedSlice(ds.Object, "spec", "template", "spec", "volumes")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(volumes).To(ContainElement(HaveKeyWithValue("configMap",
+					HaveKeyWithValue("name", "sriovdp-config-"+pool))))
+				Expect(getPoolExpressions(ds)).To(Equal([]interface{}{map[string]interface{}{
+					"key":      sriovDpNodePoolLabel,
+					"operator": "In",
+					"values":   []interface{}{pool},
+				}}))
+			}
+			Expect(getPoolExpressions(getObj(objs, "DaemonSet", "sriov-device-plugin"))).To(Equal(
+				[]interface{}{map[string]interface{}{"key": sriovDpNodePoolLabel, "operator": "DoesNotExist"}}))
+			Expect(sriovDpState.nodePools).To(Equal(map[string]string{"node1": "a", "node2": "b"}))
+		})
+		It("Should keep excluding the skipped nodes from the DaemonSets of the pools", func() {
+			objs, err := sriovDpState.getManifestObjects(cr, nodeInfo)
+			Expect(err).NotTo(HaveOccurred())
+			jsonSpec, err := getObj(objs, "DaemonSet", "sriov-device-plugin-a").MarshalJSON()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(jsonSpec)).To(ContainSubstring(
+				"{\"key\":\"" + sriovDpSkipNodeLabel + "\",\"operator\":\"NotIn\",\"values\":[\"true\"]}"))
+		})
+		It("Should add a node selected by several pools to the first of them", func() {
+			cr.Spec.SriovDevicePlugin.NodePools[1].NodeSelector = map[string]string{nodeinfo.NodeLabelMlnxNIC: "true"}
+			_, err := sriovDpState.getManifestObjects(cr, nodeInfo)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sriovDpState.nodePools).To(Equal(map[string]string{"node1": "a", "node2": "b", "node3": "b"}))
+		})
+		It("Should fail on duplicate pool names or an invalid resource name suffix", func() {
+			cr.Spec.SriovDevicePlugin.NodePools[1].Name = "a"
+			_, err := sriovDpState.getManifestObjects(cr, nodeInfo)
+			Expect(err).To(HaveOccurred())
+
+			cr.Spec.SriovDevicePlugin.NodePools[1].Name = "b"
+			cr.Spec.SriovDevicePlugin.NodePools[1].ResourceNameSuffix = "-b"
+			_, err = sriovDpState.getManifestObjects(cr, nodeInfo)
+			Expect(err).To(HaveOccurred())
+		})
+		It("Should advertise the resource name aliases in the config of every pool", func() {
+			cr.Spec.SriovDevicePlugin.ResourceNameAliases = []mellanoxv1alpha1.DevicePluginResourceNameAlias{
+				{ResourceName: "rdma", Alias: "rdma_legacy"}}
+			objs, err := sriovDpState.getManifestObjects(cr, nodeInfo)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(getResourceNames(getObj(objs, "ConfigMap", "sriovdp-config"))).To(Equal(
+				[]string{"rdma", "rdma_legacy"}))
+			Expect(getResourceNames(getObj(objs, "ConfigMap", "sriovdp-config-a"))).To(Equal(
+				[]string{"rdma_a", "rdma_legacy_a"}))
+		})
+	})
+
+	Context("Host reserved VFs", func() {
+		config := `{"resourceList": [{"resourceName": "hostdev", "selectors": {"vendors": ["15b3"], ` +
+			`"pfNames": ["ens1f0", "ens2f0#2-5"]}}]}`
+
+		getPfNames := func(config string) []string {
+			parsed := struct {
+				ResourceList []struct {
+					Selectors struct {
+						PfNames []string `json:"pfNames"`
+					} `json:"selectors"`
+				} `json:"resourceList"`
+			}{}
+			Expect(json.Unmarshal([]byte(config), &parsed)).To(Succeed())
+			Expect(parsed.ResourceList).To(HaveLen(1))
+			return parsed.ResourceList[0].Selectors.PfNames
+		}
+
+		It("Should exclude the reserved VFs from the rendered selector", func() {
+			files, err := utils.GetFilesWithSuffix("../../manifests/stage-sriov-device-plugin",
+				render.ManifestFileSuffix...)
+			Expect(err).NotTo(HaveOccurred())
+			sriovDpState := stateSriovDp{
+				stateSkel: stateSkel{
+					name:           "state-SRIOV-device-plugin",
+					description:    "SR-IOV device plugin deployed in the cluster",
+					clientProvider: NewStaticClientProvider(&mocks.ControllerRutimeClient{}),
+					scheme:         runtime.NewScheme(),
+					renderer:       render.NewRenderer(files),
+				},
+			}
+			cr := &mellanoxv1alpha1.NicClusterPolicy{}
+			cr.Spec.SriovDevicePlugin = &mellanoxv1alpha1.DevicePluginSpec{
+				ImageSpec: mellanoxv1alpha1.ImageSpec{Image: "image", Repository: "Repository", Version: "v0.0"},
+				Config:    config,
+				HostReservedVFs: &mellanoxv1alpha1.DevicePluginHostReservedVFsSpec{
+					Count: 2, TotalVFs: 8},
+			}
+			node := &v1.Node{ObjectMeta: metav1.ObjectMeta{
+				Name:   "node1",
+				Labels: map[string]string{nodeinfo.NodeLabelMlnxNIC: "true"},
+			}}
+			objs, err := sriovDpState.getManifestObjects(cr, nodeinfo.NewProvider([]*v1.Node{node}))
+			Expect(err).NotTo(HaveOccurred())
+			var rendered string
+			for _, obj := range objs {
+				if obj.GetKind() == "ConfigMap" {
+					rendered, _, err = unstructured.NestedString(obj.Object, "data", "config.json")
+					Expect(err).NotTo(HaveOccurred())
+				}
+			}
+			Expect(getPfNames(rendered)).To(Equal([]string{"ens1f0#2-7", "ens2f0#2-5"}))
+		})
+		It("Should exclude an explicit list of reserved VFs", func() {
+			reserved, err := getHostReservedConfig(config, sriovDpResourceListKey,
+				&mellanoxv1alpha1.DevicePluginHostReservedVFsSpec{VFs: []int{0, 3, 7}, TotalVFs: 8})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(getPfNames(reserved)).To(Equal([]string{"ens1f0#1-2,4-6", "ens2f0#2,4-5"}))
+		})
+		It("Should keep the config as is without reserved VFs", func() {
+			Expect(getHostReservedConfig(config, sriovDpResourceListKey, nil)).To(Equal(config))
+		})
+		It("Should fail on a reservation which exceeds the total VFs", func() {
+			for _, reserved := range []*mellanoxv1alpha1.DevicePluginHostReservedVFsSpec{
+				{Count: 8, TotalVFs: 8},
+				{VFs: []int{8}, TotalVFs: 8},
+				{Count: 2, VFs: []int{3}, TotalVFs: 8},
+				{TotalVFs: 8},
+				{Count: 2},
+				{Count: 2, TotalVFs: 4},
+			} {
+				_, err := getHostReservedConfig(config, sriovDpResourceListKey, reserved)
+				Expect(err).To(HaveOccurred(), "reserved: %+v", *reserved)
+			}
+		})
+		It("Should fail without a pfNames selector", func() {
+			_, err := getHostReservedConfig(`{"resourceList": [{"resourceName": "hostdev", "selectors": {}}]}`,
+				sriovDpResourceListKey, &mellanoxv1alpha1.DevicePluginHostReservedVFsSpec{Count: 1, TotalVFs: 8})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("Resource name aliases", func() {
+		config := `{"resourceList": [{"resourceName": "hostdev", "selectors": {"vendors": ["15b3"]}}]}`
+
+		It("Should map the resource name and its alias to the same selectors", func() {
+			aliased, err := getAliasedConfig(config, sriovDpResourceListKey,
+				[]mellanoxv1alpha1.DevicePluginResourceNameAlias{{ResourceName: "hostdev", Alias: "hostdev_legacy"}})
+			Expect(err).NotTo(HaveOccurred())
+			parsed := struct {
+				ResourceList []struct {
+					ResourceName string                 `json:"resourceName"`
+					Selectors    map[string]interface{} `json:"selectors"`
+				} `json:"resourceList"`
+			}{}
+			Expect(json.Unmarshal([]byte(aliased), &parsed)).To(Succeed())
+			Expect(parsed.ResourceList).To(HaveLen(2))
+			Expect(parsed.ResourceList[0].ResourceName).To(Equal("hostdev"))
+			Expect(parsed.ResourceList[1].ResourceName).To(Equal("hostdev_legacy"))
+			Expect(parsed.ResourceList[1].Selectors).To(Equal(parsed.ResourceList[0].Selectors))
+		})
+		It("Should keep the config as is without aliases", func() {
+			Expect(getAliasedConfig(config, sriovDpResourceListKey, nil)).To(Equal(config))
+		})
+		It("Should fail on an alias of an unknown resource or an alias which is already a resource name", func() {
+			for _, alias := range []mellanoxv1alpha1.DevicePluginResourceNameAlias{
+				{ResourceName: "rdma", Alias: "rdma_legacy"},
+				{ResourceName: "hostdev", Alias: "hostdev"},
+				{ResourceName: "hostdev", Alias: "hostdev-legacy"},
+			} {
+				_, err := getAliasedConfig(config, sriovDpResourceListKey,
+					[]mellanoxv1alpha1.DevicePluginResourceNameAlias{alias})
+				Expect(err).To(HaveOccurred())
+			}
 		})
 	})
 })
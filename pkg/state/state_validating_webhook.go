@@ -0,0 +1,205 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	mellanoxv1alpha1 "github.com/Mellanox/network-operator/api/v1alpha1"
+	"github.com/Mellanox/network-operator/pkg/consts"
+	"github.com/Mellanox/network-operator/pkg/render"
+	"github.com/Mellanox/network-operator/pkg/utils"
+)
+
+const (
+	// webhookCertSecretName is the Secret holding the certificate of the webhook server, it is expected to be mounted
+	// by the webhook server
+	webhookCertSecretName = "nvidia-network-operator-webhook-cert"
+	// defaultWebhookFailurePolicy is the failure policy of the webhooks if none is set in the NicClusterPolicy
+	defaultWebhookFailurePolicy = "Ignore"
+)
+
+// webhookResources are the custom resources validated by the operator webhook server
+var webhookResources = []webhookResource{
+	{Singular: "nicclusterpolicy", Plural: "nicclusterpolicies"},
+	{Singular: "hostdevicenetwork", Plural: "hostdevicenetworks"},
+	{Singular: "macvlannetwork", Plural: "macvlannetworks"},
+}
+
+// defaultedWebhookResources are the custom resources defaulted by the operator webhook server
+var defaultedWebhookResources = []webhookResource{
+	{Singular: "hostdevicenetwork", Plural: "hostdevicenetworks"},
+}
+
+// NewStateValidatingWebhook creates a new state which deploys the ValidatingWebhookConfiguration and the
+// MutatingWebhookConfiguration of the operator webhook server along with the certificate of the webhook server
+func NewStateValidatingWebhook(
+	clientProvider ClientProvider, scheme *runtime.Scheme, manifestDir string) (State, error) {
+	files, err := utils.GetFilesWithSuffix(manifestDir, render.ManifestFileSuffix...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get files from manifest dir")
+	}
+
+	renderer := render.NewRenderer(files)
+	return &stateValidatingWebhook{
+		stateSkel: stateSkel{
+			name:           "state-validating-webhook",
+			description:    "ValidatingWebhookConfiguration of the operator webhook server deployed in the cluster",
+			clientProvider: clientProvider,
+			scheme:         scheme,
+			renderer:       renderer,
+		}}, nil
+}
+
+type stateValidatingWebhook struct {
+	stateSkel
+}
+
+type webhookResource struct {
+	Singular string
+	Plural   string
+}
+
+type validatingWebhookManifestRenderData struct {
+	CrSpec        *mellanoxv1alpha1.ValidatingWebhookSpec
+	FailurePolicy string
+	Resources     []webhookResource
+	// DefaultedResources are the resources of the MutatingWebhookConfiguration
+	DefaultedResources []webhookResource
+	// CABundle is the base64 encoded caBundle of the webhooks
+	CABundle   string
+	SecretName string
+	// SecretData is the base64 encoded data of the webhook server certificate Secret
+	SecretData map[string]string
+}
+
+// Sync attempt to get the system to match the desired state which State represent.
+// a sync operation must be relatively short and must not block the execution thread.
+func (s *stateValidatingWebhook) Sync(
+	ctx context.Context, customResource interface{}, _ InfoCatalog) (SyncState, error) {
+	cr := customResource.(*mellanoxv1alpha1.NicClusterPolicy)
+	log.V(consts.LogLevelInfo).Info(
+		"Sync Custom resource", "State:", s.name, "Name:", cr.Name, "Namespace:", cr.Namespace)
+
+	if cr.Spec.ValidatingWebhook == nil {
+		// Either this state was not required to run or an update occurred and we need to remove
+		// the resources that where created.
+		log.V(consts.LogLevelInfo).Info("ValidatingWebhook spec is empty, no action required")
+		return SyncStateIgnore, nil
+	}
+
+	k8sClient, err := s.getClient(cr)
+	if err != nil {
+		return SyncStateNotReady, err
+	}
+
+	certs, err := s.getCerts(ctx, k8sClient, cr.Spec.ValidatingWebhook)
+	if err != nil {
+		return SyncStateNotReady, err
+	}
+
+	objs, err := s.getManifestObjects(cr, certs)
+	if err != nil {
+		return SyncStateNotReady, errors.Wrap(err, "failed to create k8s objects from manifest")
+	}
+
+	// Create objects if they dont exist, Update objects if they do exist.
+	// The webhook configurations are applied first so their caBundle trusts a rotated CA before the webhook
+	// server loads the certificate issued by it.
+	err = s.createOrUpdateObjs(ctx, k8sClient, func(obj *unstructured.Unstructured) error {
+		if err := controllerutil.SetControllerReference(cr, obj, s.scheme); err != nil {
+			return errors.Wrap(err, "failed to set controller reference for object")
+		}
+		return nil
+	}, objs)
+	if err != nil {
+		return SyncStateNotReady, errors.Wrap(err, "failed to create/update objects")
+	}
+	// Check objects status
+	syncState, err := s.getSyncState(ctx, k8sClient, objs)
+	if err != nil {
+		return SyncStateNotReady, errors.Wrap(err, "failed to get sync state")
+	}
+	return syncState, nil
+}
+
+// Get a map of source kinds that should be watched for the state keyed by the source kind name
+func (s *stateValidatingWebhook) GetWatchSources() map[string]*source.Kind {
+	wr := make(map[string]*source.Kind)
+	wr["ValidatingWebhookConfiguration"] = &source.Kind{Type: &admissionregistrationv1.ValidatingWebhookConfiguration{}}
+	wr["MutatingWebhookConfiguration"] = &source.Kind{Type: &admissionregistrationv1.MutatingWebhookConfiguration{}}
+	wr["Secret"] = &source.Kind{Type: &corev1.Secret{}}
+	return wr
+}
+
+// getCerts returns the certificates of the webhook server, the certificates of the existing Secret are reused
+// unless they need to be rotated
+func (s *stateValidatingWebhook) getCerts(
+	ctx context.Context, c client.Client, spec *mellanoxv1alpha1.ValidatingWebhookSpec) (*webhookCerts, error) {
+	secret := &corev1.Secret{}
+	err := c.Get(ctx, types.NamespacedName{Namespace: spec.ServiceNamespace, Name: webhookCertSecretName}, secret)
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return nil, errors.Wrap(err, "failed to get webhook certificate Secret")
+	}
+	dnsNames := []string{
+		fmt.Sprintf("%s.%s.svc", spec.ServiceName, spec.ServiceNamespace),
+		fmt.Sprintf("%s.%s.svc.cluster.local", spec.ServiceName, spec.ServiceNamespace),
+	}
+	return getWebhookCerts(secret.Data, dnsNames, time.Now())
+}
+
+func (s *stateValidatingWebhook) getManifestObjects(
+	cr *mellanoxv1alpha1.NicClusterPolicy, certs *webhookCerts) ([]*unstructured.Unstructured, error) {
+	secretData := make(map[string]string)
+	for key, value := range certs.secretData() {
+		secretData[key] = base64.StdEncoding.EncodeToString(value)
+	}
+	failurePolicy := cr.Spec.ValidatingWebhook.FailurePolicy
+	if failurePolicy == "" {
+		failurePolicy = defaultWebhookFailurePolicy
+	}
+	renderData := &validatingWebhookManifestRenderData{
+		CrSpec:             cr.Spec.ValidatingWebhook,
+		FailurePolicy:      failurePolicy,
+		Resources:          webhookResources,
+		DefaultedResources: defaultedWebhookResources,
+		CABundle:           base64.StdEncoding.EncodeToString(certs.caBundle()),
+		SecretName:         webhookCertSecretName,
+		SecretData:         secretData,
+	}
+	// render objects, the certificates are not logged
+	log.V(consts.LogLevelDebug).Info("Rendering objects", "spec:", cr.Spec.ValidatingWebhook)
+	objs, err := s.renderer.RenderObjects(&render.TemplatingData{Data: renderData})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to render objects")
+	}
+	return objs, nil
+}
@@ -0,0 +1,146 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"context"
+	"crypto/x509"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	mellanoxv1alpha1 "github.com/Mellanox/network-operator/api/v1alpha1"
+)
+
+var _ = Describe("ValidatingWebhook State tests", func() {
+	var (
+		cr              *mellanoxv1alpha1.NicClusterPolicy
+		k8sClient       client.Client
+		webhookState    State
+		webhookDNSNames = []string{"webhook.nvidia-network-operator.svc"}
+	)
+
+	BeforeEach(func() {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(mellanoxv1alpha1.AddToScheme(scheme)).To(Succeed())
+		k8sClient = fake.NewClientBuilder().WithScheme(scheme).Build()
+		var err error
+		webhookState, err = NewStateValidatingWebhook(
+			NewStaticClientProvider(k8sClient), scheme, "../../manifests/stage-validating-webhook")
+		Expect(err).NotTo(HaveOccurred())
+		cr = &mellanoxv1alpha1.NicClusterPolicy{}
+		cr.Name = "nic-cluster-policy"
+		cr.Spec.ValidatingWebhook = &mellanoxv1alpha1.ValidatingWebhookSpec{
+			ServiceName:      "webhook",
+			ServiceNamespace: "nvidia-network-operator",
+		}
+	})
+
+	getWebhookConfig := func() *admissionregistrationv1.ValidatingWebhookConfiguration {
+		webhookConfig := &admissionregistrationv1.ValidatingWebhookConfiguration{}
+		Expect(k8sClient.Get(context.TODO(), types.NamespacedName{Name: "nvidia-network-operator-validating-webhook"},
+			webhookConfig)).To(Succeed())
+		return webhookConfig
+	}
+	getSecret := func() *corev1.Secret {
+		secret := &corev1.Secret{}
+		Expect(k8sClient.Get(context.TODO(), types.NamespacedName{
+			Namespace: "nvidia-network-operator", Name: webhookCertSecretName}, secret)).To(Succeed())
+		return secret
+	}
+
+	It("Should render the webhook config with a populated caBundle", func() {
+		syncState, err := webhookState.Sync(context.Background(), cr, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(syncState).To(Equal(SyncState(SyncStateReady)))
+
+		webhookConfig := getWebhookConfig()
+		Expect(webhookConfig.Webhooks).To(HaveLen(len(webhookResources)))
+		secret := getSecret()
+		for _, webhook := range webhookConfig.Webhooks {
+			Expect(webhook.ClientConfig.CABundle).To(Equal(secret.Data[webhookCACertKey]))
+			Expect(webhook.ClientConfig.Service.Name).To(Equal("webhook"))
+			Expect(*webhook.FailurePolicy).To(Equal(admissionregistrationv1.Ignore))
+		}
+
+		mutatingConfig := &admissionregistrationv1.MutatingWebhookConfiguration{}
+		Expect(k8sClient.Get(context.TODO(), types.NamespacedName{Name: "nvidia-network-operator-mutating-webhook"},
+			mutatingConfig)).To(Succeed())
+		Expect(mutatingConfig.Webhooks).To(HaveLen(len(defaultedWebhookResources)))
+		for _, webhook := range mutatingConfig.Webhooks {
+			Expect(webhook.ClientConfig.CABundle).To(Equal(secret.Data[webhookCACertKey]))
+			Expect(*webhook.ClientConfig.Service.Path).To(HavePrefix("/mutate-mellanox-com-v1alpha1-"))
+		}
+
+		// the webhook server certificate is issued by the CA of the caBundle
+		roots := x509.NewCertPool()
+		Expect(roots.AppendCertsFromPEM(webhookConfig.Webhooks[0].ClientConfig.CABundle)).To(BeTrue())
+		cert, err := parseCertificate(secret.Data[corev1.TLSCertKey])
+		Expect(err).NotTo(HaveOccurred())
+		_, err = cert.Verify(x509.VerifyOptions{
+			DNSName: "webhook.nvidia-network-operator.svc", Roots: roots,
+			KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}})
+		Expect(err).NotTo(HaveOccurred())
+	})
+	It("Should keep the certificates across syncs", func() {
+		_, err := webhookState.Sync(context.Background(), cr, nil)
+		Expect(err).NotTo(HaveOccurred())
+		secret := getSecret()
+		_, err = webhookState.Sync(context.Background(), cr, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(getSecret().Data).To(Equal(secret.Data))
+	})
+	It("Should ignore when not configured", func() {
+		cr.Spec.ValidatingWebhook = nil
+		syncState, err := webhookState.Sync(context.Background(), cr, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(syncState).To(Equal(SyncState(SyncStateIgnore)))
+	})
+	It("Should trust both CAs when rotating the CA", func() {
+		now := time.Now()
+		certs, err := getWebhookCerts(nil, webhookDNSNames, now)
+		Expect(err).NotTo(HaveOccurred())
+
+		rotated, err := getWebhookCerts(certs.secretData(), webhookDNSNames,
+			now.Add(webhookCertValidity-webhookCertRotationThreshold/2))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rotated.CACert).NotTo(Equal(certs.CACert))
+		Expect(rotated.PreviousCACert).To(Equal(certs.CACert))
+		Expect(rotated.Cert).NotTo(Equal(certs.Cert))
+
+		roots := x509.NewCertPool()
+		Expect(roots.AppendCertsFromPEM(rotated.caBundle())).To(BeTrue())
+		for _, certPEM := range [][]byte{certs.Cert, rotated.Cert} {
+			cert, err := parseCertificate(certPEM)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = cert.Verify(x509.VerifyOptions{DNSName: webhookDNSNames[0], Roots: roots,
+				CurrentTime: now.Add(webhookCertValidity - webhookCertRotationThreshold/2),
+				KeyUsages:   []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}})
+			Expect(err).NotTo(HaveOccurred())
+		}
+	})
+})
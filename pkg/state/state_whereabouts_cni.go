@@ -17,11 +17,21 @@ limitations under the License.
 package state //nolint:dupl
 
 import (
+	"context"
+	"encoding/json"
+	"net"
+	"regexp"
+	"strings"
+
 	"github.com/pkg/errors"
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
 	v1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/source"
@@ -29,41 +39,70 @@ import (
 	mellanoxv1alpha1 "github.com/Mellanox/network-operator/api/v1alpha1"
 	"github.com/Mellanox/network-operator/pkg/consts"
 	"github.com/Mellanox/network-operator/pkg/render"
-	"github.com/Mellanox/network-operator/pkg/utils"
 )
 
 // NewStateWhereaboutsCNI creates a new state for Whereabouts
-func NewStateWhereaboutsCNI(k8sAPIClient client.Client, scheme *runtime.Scheme, manifestDir string) (State, error) {
-	files, err := utils.GetFilesWithSuffix(manifestDir, render.ManifestFileSuffix...)
+func NewStateWhereaboutsCNI(clientProvider ClientProvider, scheme *runtime.Scheme, manifestDir string) (State, error) {
+	renderer, manifestVersions, err := newManifestRenderers(manifestDir)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to get files from manifest dir")
+		return nil, err
 	}
-
-	renderer := render.NewRenderer(files)
 	return &stateWhereaboutsCNI{
 		stateSkel: stateSkel{
-			name:        "state-whereabouts-cni",
-			description: "whereabouts IPAM CNI deployed in the cluster",
-			client:      k8sAPIClient,
-			scheme:      scheme,
-			renderer:    renderer,
+			name:             "state-whereabouts-cni",
+			description:      "whereabouts IPAM CNI deployed in the cluster",
+			clientProvider:   clientProvider,
+			scheme:           scheme,
+			renderer:         renderer,
+			manifestVersions: manifestVersions,
 		}}, nil
 }
 
+const (
+	whereaboutsDefaultReconcilerSchedule = "*/5 * * * *"
+	// whereaboutsReconcilerName is the name of the IP reconciler CronJob
+	whereaboutsReconcilerName = "whereabouts-ip-reconciler"
+)
+
+var (
+	cronPredefinedScheduleRe = regexp.MustCompile(`^@(yearly|annually|monthly|weekly|daily|midnight|hourly)$`)
+	cronFieldRe              = regexp.MustCompile(`^[0-9A-Za-z*?/,-]+$`)
+)
+
 type stateWhereaboutsCNI struct {
 	stateSkel
 }
 
 type WhereaboutsManifestRenderData struct {
-	CrSpec       *mellanoxv1alpha1.ImageSpec
+	CrSpec       *mellanoxv1alpha1.WhereaboutsSpec
 	NodeAffinity *v1.NodeAffinity
 	RuntimeSpec  *runtimeSpec
+	// Cron schedule of the IP reconciler, the IP reconciler is not rendered if empty
+	ReconcilerSchedule string
+	IPPools            []whereaboutsIPPool
+}
+
+// whereaboutsIPPool is the render data of a whereabouts IPPool
+type whereaboutsIPPool struct {
+	// Name of the IPPool, whereabouts looks up the IPPool of a range by its normalized name
+	Name string
+	// Range in canonical CIDR notation
+	Range string
+	// IPAMConfig is the whereabouts IPAM config, as JSON, allocating addresses from the IPPool
+	IPAMConfig string
+}
+
+// whereaboutsIPAMConfig is the whereabouts IPAM config of a NetworkAttachmentDefinition
+type whereaboutsIPAMConfig struct {
+	Type  string `json:"type"`
+	Range string `json:"range"`
 }
 
 // Sync attempt to get the system to match the desired state which State represent.
 // a sync operation must be relatively short and must not block the execution thread.
 //nolint:dupl
-func (s *stateWhereaboutsCNI) Sync(customResource interface{}, infoCatalog InfoCatalog) (SyncState, error) {
+func (s *stateWhereaboutsCNI) Sync(
+	ctx context.Context, customResource interface{}, infoCatalog InfoCatalog) (SyncState, error) {
 	cr := customResource.(*mellanoxv1alpha1.NicClusterPolicy)
 	log.V(consts.LogLevelInfo).Info(
 		"Sync Custom resource", "State:", s.name, "Name:", cr.Name, "Namespace:", cr.Namespace)
@@ -84,46 +123,227 @@ func (s *stateWhereaboutsCNI) Sync(customResource interface{}, infoCatalog InfoC
 		return SyncStateNotReady, nil
 	}
 
-	// Create objects if they dont exist, Update objects if they do exist
-	err = s.createOrUpdateObjs(func(obj *unstructured.Unstructured) error {
+	k8sClient, err := s.getClient(cr)
+	if err != nil {
+		return SyncStateNotReady, err
+	}
+	setControllerReference := func(obj *unstructured.Unstructured) error {
 		if err := controllerutil.SetControllerReference(cr, obj, s.scheme); err != nil {
 			return errors.Wrap(err, "failed to set controller reference for object")
 		}
 		return nil
-	}, objs)
+	}
+	ipPools, otherObjs := splitIPPools(objs)
+	// Create objects if they dont exist, Update objects if they do exist
+	err = s.createOrUpdateObjs(ctx, k8sClient, setControllerReference, otherObjs)
 	if err != nil {
 		return SyncStateNotReady, errors.Wrap(err, "failed to create/update objects")
 	}
+	if err := s.applyIPPools(ctx, k8sClient, setControllerReference, ipPools); err != nil {
+		return SyncStateNotReady, errors.Wrap(err, "failed to create/update IP pools")
+	}
+	if err := s.deleteStaleReconciler(ctx, k8sClient, cr, otherObjs); err != nil {
+		return SyncStateNotReady, err
+	}
 	// Check objects status
-	syncState, err := s.getSyncState(objs)
+	syncState, err := s.getSyncState(ctx, k8sClient, objs)
 	if err != nil {
 		return SyncStateNotReady, errors.Wrap(err, "failed to get sync state")
 	}
 	return syncState, nil
 }
 
+// deleteStaleReconciler deletes the IP reconciler CronJob created by cr if it is no longer rendered,
+// i.e the IP reconciler was disabled by an empty schedule
+func (s *stateWhereaboutsCNI) deleteStaleReconciler(ctx context.Context, c client.Client,
+	cr *mellanoxv1alpha1.NicClusterPolicy, objs []*unstructured.Unstructured) error {
+	for _, obj := range objs {
+		if obj.GetKind() == "CronJob" && obj.GetName() == whereaboutsReconcilerName {
+			return nil
+		}
+	}
+	cronJob := &batchv1beta1.CronJob{}
+	err := c.Get(ctx, types.NamespacedName{
+		Namespace: consts.NetworkOperatorResourceNamespace, Name: whereaboutsReconcilerName}, cronJob)
+	if k8serrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to get IP reconciler CronJob")
+	}
+	if owner := metav1.GetControllerOf(cronJob); owner == nil || owner.UID != cr.UID {
+		return nil
+	}
+	log.V(consts.LogLevelInfo).Info("Deleting IP reconciler CronJob which is no longer rendered",
+		"Namespace:", cronJob.Namespace, "Name:", cronJob.Name)
+	err = c.Delete(ctx, cronJob, client.PropagationPolicy(metav1.DeletePropagationBackground))
+	if k8serrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to delete IP reconciler CronJob")
+	}
+	recordEvent(ctx, cronJob, v1.EventTypeNormal, EventReasonObjectDeleted, "Deleted by state %s", s.name)
+	countPrunedObject(ctx)
+	return nil
+}
+
 // Get a map of source kinds that should be watched for the state keyed by the source kind name
 func (s *stateWhereaboutsCNI) GetWatchSources() map[string]*source.Kind {
 	wr := make(map[string]*source.Kind)
 	wr["DaemonSet"] = &source.Kind{Type: &appsv1.DaemonSet{}}
+	ipPool := &unstructured.Unstructured{}
+	ipPool.SetAPIVersion("whereabouts.cni.cncf.io/v1alpha1")
+	ipPool.SetKind("IPPool")
+	wr["IPPool"] = &source.Kind{Type: ipPool}
 	return wr
 }
 
 func (s *stateWhereaboutsCNI) getManifestObjects(
 	cr *mellanoxv1alpha1.NicClusterPolicy) ([]*unstructured.Unstructured, error) {
+	schedule := whereaboutsDefaultReconcilerSchedule
+	if cr.Spec.SecondaryNetwork.IpamPlugin.ReconcilerSchedule != nil {
+		schedule = *cr.Spec.SecondaryNetwork.IpamPlugin.ReconcilerSchedule
+	}
+	if schedule != "" {
+		if err := validateCronSchedule(schedule); err != nil {
+			return nil, errors.Wrap(err, "invalid IP reconciler schedule")
+		}
+	}
+	ipPools, err := getWhereaboutsIPPools(cr.Spec.SecondaryNetwork.IpamPlugin.IPPools)
+	if err != nil {
+		return nil, err
+	}
 	renderData := &WhereaboutsManifestRenderData{
 		CrSpec:       cr.Spec.SecondaryNetwork.IpamPlugin,
 		NodeAffinity: cr.Spec.NodeAffinity,
 		RuntimeSpec: &runtimeSpec{
-			Namespace: consts.NetworkOperatorResourceNamespace,
+			Namespace:    consts.NetworkOperatorResourceNamespace,
+			FeatureGates: cr.Spec.FeatureGates,
+			External:     s.externalRenderData,
 		},
+		ReconcilerSchedule: schedule,
+		IPPools:            ipPools,
 	}
 	// render objects
 	log.V(consts.LogLevelDebug).Info("Rendering objects", "data:", renderData)
-	objs, err := s.renderer.RenderObjects(&render.TemplatingData{Data: renderData})
+	renderer, err := s.getRenderer(cr.Spec.SecondaryNetwork.IpamPlugin.ManifestVersion)
+	if err != nil {
+		return nil, err
+	}
+	objs, err := renderer.RenderObjects(&render.TemplatingData{Data: renderData})
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to render objects")
 	}
 	log.V(consts.LogLevelDebug).Info("Rendered", "objects:", objs)
 	return objs, nil
 }
+
+// validateCronSchedule checks that schedule is either a predefined schedule (e.g @hourly) or
+// a cron expression with five fields
+func validateCronSchedule(schedule string) error {
+	if cronPredefinedScheduleRe.MatchString(schedule) {
+		return nil
+	}
+	fields := strings.Fields(schedule)
+	if len(fields) != 5 {
+		return errors.Errorf("cron schedule %q must have 5 fields, got %d", schedule, len(fields))
+	}
+	for _, f := range fields {
+		if !cronFieldRe.MatchString(f) {
+			return errors.Errorf("invalid field %q in cron schedule %q", f, schedule)
+		}
+	}
+	return nil
+}
+
+// getWhereaboutsIPPools validates the IP pools of the spec and returns their render data
+func getWhereaboutsIPPools(specs []mellanoxv1alpha1.WhereaboutsIPPoolSpec) ([]whereaboutsIPPool, error) {
+	pools := make([]whereaboutsIPPool, 0, len(specs))
+	names := make(map[string]bool, len(specs))
+	for _, spec := range specs {
+		_, ipNet, err := net.ParseCIDR(spec.Range)
+		if err != nil {
+			return nil, errors.Errorf("invalid IP pool range %q: must be in CIDR notation", spec.Range)
+		}
+		pool := whereaboutsIPPool{Name: whereaboutsIPPoolName(ipNet.String()), Range: ipNet.String()}
+		if names[pool.Name] {
+			return nil, errors.Errorf("duplicate IP pool range %s", pool.Range)
+		}
+		names[pool.Name] = true
+		ipamConfig, err := json.Marshal(&whereaboutsIPAMConfig{Type: "whereabouts", Range: pool.Range})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to encode IPAM config")
+		}
+		pool.IPAMConfig = string(ipamConfig)
+		pools = append(pools, pool)
+	}
+	return pools, nil
+}
+
+// whereaboutsIPPoolName returns the name whereabouts gives to the IPPool of ipRange, e.g 192.168.2.0-24
+func whereaboutsIPPoolName(ipRange string) string {
+	name := strings.ReplaceAll(strings.ReplaceAll(ipRange, ":", "-"), "/", "-")
+	// IPv6 ranges may start with "::"
+	if strings.HasPrefix(name, "-") {
+		name = "0" + name
+	}
+	return name
+}
+
+// splitIPPools splits the IPPools from the other objects
+func splitIPPools(objs []*unstructured.Unstructured) (ipPools, others []*unstructured.Unstructured) {
+	for _, obj := range objs {
+		if obj.GetKind() == "IPPool" {
+			ipPools = append(ipPools, obj)
+			continue
+		}
+		others = append(others, obj)
+	}
+	return ipPools, others
+}
+
+// applyIPPools creates the IPPools which do not exist and patches the range of those which do.
+// The allocations of an IPPool are written by whereabouts, an update would race with it and could drop
+// the allocations made since the IPPool was read, the operator therefore never updates them.
+func (s *stateWhereaboutsCNI) applyIPPools(ctx context.Context, c client.Client,
+	setControllerReference func(obj *unstructured.Unstructured) error, ipPools []*unstructured.Unstructured) error {
+	for _, obj := range ipPools {
+		labels := obj.GetLabels()
+		if labels == nil {
+			labels = make(map[string]string)
+		}
+		labels[consts.NetworkOperatorOwnedLabel] = "true"
+		obj.SetLabels(labels)
+		if err := setControllerReference(obj); err != nil {
+			return err
+		}
+		err := c.Create(ctx, obj)
+		if err == nil {
+			log.V(consts.LogLevelInfo).Info("IPPool created", "Name:", obj.GetName())
+			continue
+		}
+		if !k8serrors.IsAlreadyExists(err) {
+			return errors.Wrapf(err, "failed to create IPPool %s", obj.GetName())
+		}
+		ipRange, _, _ := unstructured.NestedString(obj.Object, "spec", "range")
+		patch, err := json.Marshal(map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"labels":      obj.GetLabels(),
+				"annotations": obj.GetAnnotations(),
+			},
+			"spec": map[string]interface{}{"range": ipRange},
+		})
+		if err != nil {
+			return errors.Wrapf(err, "failed to encode patch of IPPool %s", obj.GetName())
+		}
+		existing := &unstructured.Unstructured{}
+		existing.SetGroupVersionKind(obj.GroupVersionKind())
+		existing.SetNamespace(obj.GetNamespace())
+		existing.SetName(obj.GetName())
+		if err := c.Patch(ctx, existing, client.RawPatch(types.MergePatchType, patch)); err != nil {
+			return errors.Wrapf(err, "failed to patch IPPool %s", obj.GetName())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,238 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	mellanoxv1alpha1 "github.com/Mellanox/network-operator/api/v1alpha1"
+	"github.com/Mellanox/network-operator/pkg/consts"
+	"github.com/Mellanox/network-operator/pkg/render"
+	"github.com/Mellanox/network-operator/pkg/testing/mocks"
+	"github.com/Mellanox/network-operator/pkg/utils"
+)
+
+var _ = Describe("Whereabouts CNI State tests", func() {
+	var (
+		whereaboutsState stateWhereaboutsCNI
+		cr               *mellanoxv1alpha1.NicClusterPolicy
+	)
+
+	BeforeEach(func() {
+		files, err := utils.GetFilesWithSuffix("../../manifests/stage-whereabouts-cni", render.ManifestFileSuffix...)
+		Expect(err).NotTo(HaveOccurred())
+		whereaboutsState = stateWhereaboutsCNI{
+			stateSkel: stateSkel{
+				name:           "state-whereabouts-cni",
+				description:    "whereabouts IPAM CNI deployed in the cluster",
+				clientProvider: NewStaticClientProvider(&mocks.ControllerRutimeClient{}),
+				scheme:         runtime.NewScheme(),
+				renderer:       render.NewRenderer(files),
+			},
+		}
+		cr = &mellanoxv1alpha1.NicClusterPolicy{}
+		cr.Spec.SecondaryNetwork = &mellanoxv1alpha1.SecondaryNetworkSpec{
+			IpamPlugin: &mellanoxv1alpha1.WhereaboutsSpec{
+				ImageSpec: mellanoxv1alpha1.ImageSpec{
+					Image:      "whereabouts",
+					Repository: "repository",
+					Version:    "v0.5.1",
+				},
+			},
+		}
+	})
+
+	getCronJob := func(objs []*unstructured.Unstructured) *unstructured.Unstructured {
+		for _, obj := range objs {
+			if obj.GetKind() == "CronJob" {
+				return obj
+			}
+		}
+		return nil
+	}
+	getSchedule := func(cronJob *unstructured.Unstructured) string {
+		schedule, found, err := unstructured.NestedString(cronJob.Object, "spec", "schedule")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(found).To(BeTrue())
+		return schedule
+	}
+
+	Context("IP reconciler schedule", func() {
+		It("Should render the default schedule", func() {
+			objs, err := whereaboutsState.getManifestObjects(cr)
+			Expect(err).NotTo(HaveOccurred())
+			cronJob := getCronJob(objs)
+			Expect(cronJob).NotTo(BeNil())
+			Expect(getSchedule(cronJob)).To(Equal("*/5 * * * *"))
+		})
+		It("Should render a custom schedule", func() {
+			schedule := "*/1 * * * *"
+			cr.Spec.SecondaryNetwork.IpamPlugin.ReconcilerSchedule = &schedule
+			objs, err := whereaboutsState.getManifestObjects(cr)
+			Expect(err).NotTo(HaveOccurred())
+			cronJob := getCronJob(objs)
+			Expect(cronJob).NotTo(BeNil())
+			Expect(getSchedule(cronJob)).To(Equal(schedule))
+		})
+		It("Should not render the IP reconciler if schedule is empty", func() {
+			schedule := ""
+			cr.Spec.SecondaryNetwork.IpamPlugin.ReconcilerSchedule = &schedule
+			objs, err := whereaboutsState.getManifestObjects(cr)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(objs).NotTo(BeEmpty())
+			Expect(getCronJob(objs)).To(BeNil())
+		})
+		It("Should delete the IP reconciler if schedule is emptied", func() {
+			scheme := runtime.NewScheme()
+			Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+			cr.UID = "cr-uid"
+			isController := true
+			owned := func(name string, uid types.UID) *batchv1beta1.CronJob {
+				return &batchv1beta1.CronJob{ObjectMeta: metav1.ObjectMeta{
+					Namespace: consts.NetworkOperatorResourceNamespace, Name: name,
+					OwnerReferences: []metav1.OwnerReference{{
+						APIVersion: "mellanox.com/v1alpha1", Kind: "NicClusterPolicy", Name: "nic-cluster-policy",
+						UID: uid, Controller: &isController}}}}
+			}
+			schedule := ""
+			cr.Spec.SecondaryNetwork.IpamPlugin.ReconcilerSchedule = &schedule
+			objs, err := whereaboutsState.getManifestObjects(cr)
+			Expect(err).NotTo(HaveOccurred())
+
+			c := fake.NewClientBuilder().WithScheme(scheme).
+				WithObjects(owned(whereaboutsReconcilerName, cr.UID)).Build()
+			Expect(whereaboutsState.deleteStaleReconciler(context.Background(), c, cr, objs)).To(Succeed())
+			err = c.Get(context.Background(), types.NamespacedName{
+				Namespace: consts.NetworkOperatorResourceNamespace, Name: whereaboutsReconcilerName},
+				&batchv1beta1.CronJob{})
+			Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+
+			// a CronJob which is not owned by the policy is kept
+			c = fake.NewClientBuilder().WithScheme(scheme).
+				WithObjects(owned(whereaboutsReconcilerName, "other-uid")).Build()
+			Expect(whereaboutsState.deleteStaleReconciler(context.Background(), c, cr, objs)).To(Succeed())
+			Expect(c.Get(context.Background(), types.NamespacedName{
+				Namespace: consts.NetworkOperatorResourceNamespace, Name: whereaboutsReconcilerName},
+				&batchv1beta1.CronJob{})).To(Succeed())
+		})
+		It("Should fail on invalid schedule", func() {
+			for _, schedule := range []string{"*/5 * * *", "*/5 * * * * *", "* * * * $(reboot)"} {
+				schedule := schedule
+				cr.Spec.SecondaryNetwork.IpamPlugin.ReconcilerSchedule = &schedule
+				_, err := whereaboutsState.getManifestObjects(cr)
+				Expect(err).To(HaveOccurred())
+			}
+		})
+		It("Should accept predefined schedules", func() {
+			Expect(validateCronSchedule("@hourly")).To(Succeed())
+			Expect(validateCronSchedule("0 */2 * * MON-FRI")).To(Succeed())
+		})
+	})
+
+	Context("IP pools", func() {
+		getIPPools := func(objs []*unstructured.Unstructured) []*unstructured.Unstructured {
+			var pools []*unstructured.Unstructured
+			for _, obj := range objs {
+				if obj.GetKind() == "IPPool" {
+					pools = append(pools, obj)
+				}
+			}
+			return pools
+		}
+		It("Should not render IP pools by default", func() {
+			objs, err := whereaboutsState.getManifestObjects(cr)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(getIPPools(objs)).To(BeEmpty())
+		})
+		It("Should render an IP pool from the spec", func() {
+			cr.Spec.SecondaryNetwork.IpamPlugin.IPPools = []mellanoxv1alpha1.WhereaboutsIPPoolSpec{
+				{Range: "192.168.2.0/24"}}
+			objs, err := whereaboutsState.getManifestObjects(cr)
+			Expect(err).NotTo(HaveOccurred())
+			pools := getIPPools(objs)
+			Expect(pools).To(HaveLen(1))
+			Expect(pools[0].GetName()).To(Equal("192.168.2.0-24"))
+			Expect(pools[0].GetNamespace()).To(Equal(consts.NetworkOperatorResourceNamespace))
+			ipRange, _, err := unstructured.NestedString(pools[0].Object, "spec", "range")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ipRange).To(Equal("192.168.2.0/24"))
+			Expect(pools[0].GetAnnotations()).To(HaveKeyWithValue("network.nvidia.com/ipam-config",
+				`{"type":"whereabouts","range":"192.168.2.0/24"}`))
+		})
+		It("Should fail on invalid IP pools", func() {
+			for _, pool := range []mellanoxv1alpha1.WhereaboutsIPPoolSpec{
+				{Range: "192.168.2.0"},
+				{Range: "not-a-cidr/24"},
+			} {
+				cr.Spec.SecondaryNetwork.IpamPlugin.IPPools = []mellanoxv1alpha1.WhereaboutsIPPoolSpec{pool}
+				_, err := whereaboutsState.getManifestObjects(cr)
+				Expect(err).To(HaveOccurred())
+			}
+		})
+		It("Should fail on duplicate IP pool ranges", func() {
+			cr.Spec.SecondaryNetwork.IpamPlugin.IPPools = []mellanoxv1alpha1.WhereaboutsIPPoolSpec{
+				{Range: "192.168.2.0/24"}, {Range: "192.168.2.5/24"}}
+			_, err := whereaboutsState.getManifestObjects(cr)
+			Expect(err).To(HaveOccurred())
+		})
+		It("Should not overwrite the allocations of an existing IP pool", func() {
+			gvk := schema.GroupVersionKind{Group: "whereabouts.cni.cncf.io", Version: "v1alpha1", Kind: "IPPool"}
+			scheme := runtime.NewScheme()
+			scheme.AddKnownTypeWithName(gvk, &unstructured.Unstructured{})
+			scheme.AddKnownTypeWithName(gvk.GroupVersion().WithKind("IPPoolList"), &unstructured.UnstructuredList{})
+			existing := &unstructured.Unstructured{}
+			existing.SetGroupVersionKind(gvk)
+			existing.SetNamespace(consts.NetworkOperatorResourceNamespace)
+			existing.SetName("192.168.2.0-24")
+			Expect(unstructured.SetNestedField(existing.Object, "192.168.2.0/24", "spec", "range")).To(Succeed())
+			Expect(unstructured.SetNestedMap(existing.Object, map[string]interface{}{
+				"10": map[string]interface{}{"id": "pod-a"}}, "spec", "allocations")).To(Succeed())
+			c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(existing).Build()
+
+			cr.Spec.SecondaryNetwork.IpamPlugin.IPPools = []mellanoxv1alpha1.WhereaboutsIPPoolSpec{
+				{Range: "192.168.2.0/24"}}
+			objs, err := whereaboutsState.getManifestObjects(cr)
+			Expect(err).NotTo(HaveOccurred())
+			ipPools, _ := splitIPPools(objs)
+			Expect(whereaboutsState.applyIPPools(context.Background(), c,
+				func(*unstructured.Unstructured) error { return nil }, ipPools)).To(Succeed())
+
+			got := &unstructured.Unstructured{}
+			got.SetGroupVersionKind(gvk)
+			Expect(c.Get(context.Background(), client.ObjectKeyFromObject(existing), got)).To(Succeed())
+			allocations, _, err := unstructured.NestedMap(got.Object, "spec", "allocations")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(allocations).To(HaveKey("10"))
+			Expect(got.GetAnnotations()).To(HaveKey("network.nvidia.com/ipam-config"))
+			Expect(got.GetLabels()).To(HaveKeyWithValue(consts.NetworkOperatorOwnedLabel, "true"))
+		})
+	})
+})
@@ -0,0 +1,154 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/Mellanox/network-operator/pkg/consts"
+)
+
+type syncCacheKey struct{}
+
+// SyncCache caches the last ready Result of each state keyed by a hash of the state inputs: the custom resource
+// spec, the nodes and the objects watched by the states. The Sync of a state whose inputs did not change since its
+// last ready Result is skipped and the Result is reused. The objects watched by the states are part of the inputs as
+// the Sync of the states must restore them once changed.
+type SyncCache struct {
+	mu      sync.Mutex
+	results map[string]syncCacheEntry
+}
+
+// syncCacheEntry is the last ready Result of a state and the hash of the inputs it was synced with
+type syncCacheEntry struct {
+	inputHash string
+	result    Result
+}
+
+// syncCacheContext is the context value of the cache and of the inputs hash of the reconcile
+type syncCacheContext struct {
+	cache *SyncCache
+	// watched is the fingerprint of the objects watched by the states
+	watched   string
+	inputHash string
+}
+
+// NewSyncCache returns an empty SyncCache
+func NewSyncCache() *SyncCache {
+	return &SyncCache{results: make(map[string]syncCacheEntry)}
+}
+
+// get returns the cached Result of stateName if it was synced with inputHash
+func (c *SyncCache) get(stateName, inputHash string) (Result, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.results[stateName]
+	if !ok || entry.inputHash != inputHash {
+		return Result{}, false
+	}
+	return entry.result, true
+}
+
+// set caches the Result of stateName synced with inputHash, only ready Results are cached. Results of States which
+// must be synced again after some time are not cached either, the States are synced on each reconcile.
+func (c *SyncCache) set(stateName, inputHash string, result Result) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if result.Status != SyncStateReady || result.ErrInfo != nil || result.ResyncAfter != 0 {
+		delete(c.results, stateName)
+		return
+	}
+	c.results[stateName] = syncCacheEntry{inputHash: inputHash, result: result}
+}
+
+// WithSyncCache returns a context which skips the Sync of states whose inputs did not change since their last
+// ready Result in cache, watched is the fingerprint of the objects watched by the states. ctx is returned as is if
+// cache is not set.
+func WithSyncCache(ctx context.Context, cache *SyncCache, watched string) context.Context {
+	if cache == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, syncCacheKey{}, syncCacheContext{cache: cache, watched: watched})
+}
+
+// withSyncInputs returns a context recording the inputs hash of the reconcile of customResource, the sync cache
+// is disabled for the reconcile if the inputs can not be hashed, e.g the nodes could not be listed
+func withSyncInputs(ctx context.Context, customResource interface{}, infoCatalog InfoCatalog) context.Context {
+	cacheCtx, ok := ctx.Value(syncCacheKey{}).(syncCacheContext)
+	if !ok {
+		return ctx
+	}
+	inputHash, err := getSyncInputHash(customResource, infoCatalog, cacheCtx.watched)
+	if err != nil {
+		log.V(consts.LogLevelDebug).Info("Sync cache disabled for reconcile, unable to hash inputs", "error", err)
+		return context.WithValue(ctx, syncCacheKey{}, nil)
+	}
+	cacheCtx.inputHash = inputHash
+	return context.WithValue(ctx, syncCacheKey{}, cacheCtx)
+}
+
+// getSyncInputHash returns the hash of the spec of customResource, of the nodes and external render data of
+// infoCatalog and of the fingerprint of the watched objects
+func getSyncInputHash(customResource interface{}, infoCatalog InfoCatalog, watched string) (string, error) {
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(customResource)
+	if err != nil {
+		return "", err
+	}
+	spec, err := json.Marshal(obj["spec"])
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.New()
+	hash.Write(spec)
+	hash.Write([]byte(watched))
+	if infoCatalog != nil {
+		if nodeInfo := infoCatalog.GetNodeInfoProvider(); nodeInfo != nil {
+			if err := nodeInfo.Err(); err != nil {
+				return "", err
+			}
+			hash.Write([]byte(nodeInfo.Fingerprint()))
+		}
+		if err := infoCatalog.GetExternalRenderData().writeTo(hash); err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// getCachedResult returns the cached Result of stateName if its inputs did not change
+func getCachedResult(ctx context.Context, stateName string) (Result, bool) {
+	cacheCtx, ok := ctx.Value(syncCacheKey{}).(syncCacheContext)
+	if !ok || cacheCtx.inputHash == "" {
+		return Result{}, false
+	}
+	return cacheCtx.cache.get(stateName, cacheCtx.inputHash)
+}
+
+// cacheResult caches the Result of a state Sync
+func cacheResult(ctx context.Context, result Result) {
+	cacheCtx, ok := ctx.Value(syncCacheKey{}).(syncCacheContext)
+	if !ok || cacheCtx.inputHash == "" {
+		return
+	}
+	cacheCtx.cache.set(result.StateName, cacheCtx.inputHash, result)
+}
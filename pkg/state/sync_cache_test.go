@@ -0,0 +1,100 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	mellanoxv1alpha1 "github.com/Mellanox/network-operator/api/v1alpha1"
+	"github.com/Mellanox/network-operator/pkg/nodeinfo"
+	"github.com/Mellanox/network-operator/pkg/testing/mocks"
+)
+
+var _ = Describe("Sync cache tests", func() {
+	var (
+		readyState    *fakeState
+		notReadyState *fakeState
+		manager       *stateManager
+		cache         *SyncCache
+		cr            *mellanoxv1alpha1.NicClusterPolicy
+		node          *corev1.Node
+	)
+
+	BeforeEach(func() {
+		readyState = &fakeState{name: "ready", description: "ready state", syncState: SyncStateReady}
+		notReadyState = &fakeState{name: "not-ready", description: "not ready state", syncState: SyncStateNotReady}
+		manager = &stateManager{
+			stateGroups:    []Group{NewStateGroup([]State{readyState, notReadyState})},
+			clientProvider: NewStaticClientProvider(&mocks.ControllerRutimeClient{}),
+		}
+		cache = NewSyncCache()
+		cr = &mellanoxv1alpha1.NicClusterPolicy{}
+		cr.Spec.OFEDDriver = &mellanoxv1alpha1.OFEDDriverSpec{
+			ImageSpec: mellanoxv1alpha1.ImageSpec{Image: "mofed", Repository: "repository", Version: "5.5"},
+		}
+		node = &corev1.Node{ObjectMeta: metav1.ObjectMeta{
+			Name:   "node1",
+			Labels: map[string]string{nodeinfo.NodeLabelMlnxNIC: "true"},
+		}}
+	})
+
+	syncState := func(ctx context.Context) Results {
+		infoCatalog := NewInfoCatalog()
+		infoCatalog.Add(InfoTypeNodeInfo, nodeinfo.NewProvider([]*corev1.Node{node.DeepCopy()}))
+		results, err := manager.SyncState(ctx, cr, infoCatalog)
+		Expect(err).NotTo(HaveOccurred())
+		return results
+	}
+
+	It("Should skip the Sync of ready states when the inputs did not change", func() {
+		ctx := WithSyncCache(context.Background(), cache, "watched")
+		syncState(ctx)
+		results := syncState(ctx)
+		Expect(readyState.syncCount).To(Equal(1))
+		Expect(notReadyState.syncCount).To(Equal(2))
+		Expect(results.StatesStatus).To(ContainElement(Result{StateName: "ready", Status: SyncStateReady}))
+	})
+	It("Should sync the states when the spec changes", func() {
+		ctx := WithSyncCache(context.Background(), cache, "watched")
+		syncState(ctx)
+		cr.Spec.OFEDDriver.Version = "5.6"
+		syncState(ctx)
+		Expect(readyState.syncCount).To(Equal(2))
+	})
+	It("Should sync the states when a node changes", func() {
+		ctx := WithSyncCache(context.Background(), cache, "watched")
+		syncState(ctx)
+		node.Labels[nodeinfo.NodeLabelLinkLayer] = nodeinfo.LinkLayerEthernet
+		syncState(ctx)
+		Expect(readyState.syncCount).To(Equal(2))
+	})
+	It("Should sync the states when a watched object changes", func() {
+		syncState(WithSyncCache(context.Background(), cache, "watched"))
+		syncState(WithSyncCache(context.Background(), cache, "changed"))
+		Expect(readyState.syncCount).To(Equal(2))
+	})
+	It("Should sync the states on every reconcile without cache", func() {
+		syncState(context.Background())
+		syncState(context.Background())
+		Expect(readyState.syncCount).To(Equal(2))
+	})
+})
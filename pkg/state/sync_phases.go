@@ -0,0 +1,95 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"context"
+	"time"
+)
+
+// Phases of a state Sync timed with the SyncPhaseTimer of the context
+const (
+	// SyncPhaseNodeInfo is the retrieval of the node info the objects of the state are rendered with
+	SyncPhaseNodeInfo = "nodeinfo"
+	// SyncPhaseRender is the rendering of the objects of the state
+	SyncPhaseRender = "render"
+	// SyncPhaseApply is the creation or update of the objects of the state
+	SyncPhaseApply = "apply"
+	// SyncPhaseStatusCheck is the readiness check of the objects of the state
+	SyncPhaseStatusCheck = "status-check"
+)
+
+// SyncPhaseTimer observes the duration of a phase of the Sync of a state
+type SyncPhaseTimer func(stateName, phase string, duration time.Duration)
+
+type syncPhaseTimerKey struct{}
+
+type syncPhasesKey struct{}
+
+// syncPhases times the phases of the Sync of a state. The phases are timed by stateSkel: the render phase lasts from
+// the start of the Sync, or the end of the node info retrieval, to the apply or readiness check of the objects.
+type syncPhases struct {
+	timer     SyncPhaseTimer
+	stateName string
+	// renderStart is the start of the render phase
+	renderStart time.Time
+	// rendered is set once the render phase is timed
+	rendered bool
+}
+
+// WithSyncPhaseTimer returns a context timing the phases of the state syncs with timer, phases are not timed if the
+// context does not hold a timer
+func WithSyncPhaseTimer(ctx context.Context, timer SyncPhaseTimer) context.Context {
+	return context.WithValue(ctx, syncPhaseTimerKey{}, timer)
+}
+
+// withSyncPhases returns a context timing the phases of the Sync of stateName, which starts with the render phase
+func withSyncPhases(ctx context.Context, stateName string) context.Context {
+	timer, ok := ctx.Value(syncPhaseTimerKey{}).(SyncPhaseTimer)
+	if !ok || timer == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, syncPhasesKey{},
+		&syncPhases{timer: timer, stateName: stateName, renderStart: time.Now()})
+}
+
+// startSyncPhase starts timing phase of the Sync of the state of the context, the returned function ends it. The
+// render phase restarts once the node info is retrieved.
+func startSyncPhase(ctx context.Context, phase string) func() {
+	phases, ok := ctx.Value(syncPhasesKey{}).(*syncPhases)
+	if !ok {
+		return func() {}
+	}
+	start := time.Now()
+	return func() {
+		end := time.Now()
+		phases.timer(phases.stateName, phase, end.Sub(start))
+		if phase == SyncPhaseNodeInfo {
+			phases.renderStart = end
+		}
+	}
+}
+
+// endRenderPhase times the render phase of the Sync of the state of the context, once
+func endRenderPhase(ctx context.Context) {
+	phases, ok := ctx.Value(syncPhasesKey{}).(*syncPhases)
+	if !ok || phases.rendered {
+		return
+	}
+	phases.rendered = true
+	phases.timer(phases.stateName, SyncPhaseRender, time.Since(phases.renderStart))
+}
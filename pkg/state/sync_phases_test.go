@@ -0,0 +1,81 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	mellanoxv1alpha1 "github.com/Mellanox/network-operator/api/v1alpha1"
+	"github.com/Mellanox/network-operator/pkg/nodeinfo"
+)
+
+var _ = Describe("Sync phases tests", func() {
+	It("Should time each phase of the Sync of a state", func() {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(mellanoxv1alpha1.AddToScheme(scheme)).To(Succeed())
+		k8sClient := fake.NewClientBuilder().WithScheme(scheme).Build()
+		ofedState, err := NewStateOFED(NewStaticClientProvider(k8sClient), scheme, "../../manifests/stage-ofed-driver")
+		Expect(err).NotTo(HaveOccurred())
+
+		cr := &mellanoxv1alpha1.NicClusterPolicy{}
+		cr.Name = "nic-cluster-policy"
+		cr.Spec.OFEDDriver = &mellanoxv1alpha1.OFEDDriverSpec{
+			ImageSpec: mellanoxv1alpha1.ImageSpec{Image: "mofed", Repository: "repository", Version: "5.5"},
+		}
+		catalog := NewInfoCatalog()
+		catalog.Add(InfoTypeNodeInfo, nodeinfo.NewProvider([]*corev1.Node{{ObjectMeta: metav1.ObjectMeta{
+			Name: "node1",
+			Labels: map[string]string{
+				nodeinfo.NodeLabelMlnxNIC:  "true",
+				nodeinfo.NodeLabelHostname: "node1",
+				nodeinfo.NodeLabelCPUArch:  "amd64",
+				nodeinfo.NodeLabelOSName:   "ubuntu",
+				nodeinfo.NodeLabelOSVer:    "20.04",
+			},
+		}}}))
+
+		phases := map[string][]string{}
+		ctx := WithSyncPhaseTimer(context.Background(), func(stateName, phase string, duration time.Duration) {
+			Expect(duration).To(BeNumerically(">=", 0))
+			phases[stateName] = append(phases[stateName], phase)
+		})
+		group := NewStateGroup([]State{ofedState})
+		results := group.Sync(ctx, cr, catalog)
+		Expect(results).To(HaveLen(1))
+		Expect(results[0].ErrInfo).NotTo(HaveOccurred())
+
+		Expect(phases).To(Equal(map[string][]string{
+			stateOFEDName: {SyncPhaseNodeInfo, SyncPhaseRender, SyncPhaseApply, SyncPhaseStatusCheck},
+		}))
+	})
+	It("Should not time phases without a timer", func() {
+		ctx := withSyncPhases(context.Background(), "state")
+		endRenderPhase(ctx)
+		startSyncPhase(ctx, SyncPhaseApply)()
+	})
+})
@@ -0,0 +1,66 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	mellanoxv1alpha1 "github.com/Mellanox/network-operator/api/v1alpha1"
+	"github.com/Mellanox/network-operator/pkg/consts"
+	"github.com/Mellanox/network-operator/pkg/nodeinfo"
+)
+
+// PrepareSync returns the copy of cr and the InfoCatalog the states of cr are synced with, so the reconcile and the
+// diff of cr render the same objects. The image pull secrets referenced through ServiceAccounts are resolved on the
+// copy, they are not stored in the CR spec. externalRenderData, as returned by ResolveExternalRenderData, is added to
+// the catalog if not nil. The nodes with a Mellanox NIC are added to the catalog if cr deploys components which
+// depend on them, a failure to list the nodes is reported by the states which require them.
+func PrepareSync(ctx context.Context, c client.Client, cr *mellanoxv1alpha1.NicClusterPolicy,
+	externalRenderData ExternalRenderData) (*mellanoxv1alpha1.NicClusterPolicy, InfoCatalog, error) {
+	syncCR := cr.DeepCopy()
+	if err := ResolveImagePullSecrets(ctx, c, syncCR); err != nil {
+		return nil, nil, err
+	}
+
+	infoCatalog := NewInfoCatalog()
+	if externalRenderData != nil {
+		infoCatalog.Add(InfoTypeExternalRenderData, externalRenderData)
+	}
+	if cr.Spec.OFEDDriver == nil && cr.Spec.NVPeerDriver == nil &&
+		cr.Spec.RdmaSharedDevicePlugin == nil && cr.Spec.SriovDevicePlugin == nil {
+		return syncCR, infoCatalog, nil
+	}
+	log.V(consts.LogLevelInfo).Info("Creating Node info provider")
+	nodeList := &corev1.NodeList{}
+	if err := c.List(ctx, nodeList, nodeinfo.MellanoxNICListOptions...); err != nil {
+		log.V(consts.LogLevelError).Info("Error occurred on LIST nodes request from API server.", "error:", err)
+		infoCatalog.Add(InfoTypeNodeInfo, nodeinfo.NewFailedProvider(err))
+		return syncCR, infoCatalog, nil
+	}
+	nodes := make([]*corev1.Node, len(nodeList.Items))
+	nodeNames := make([]*string, len(nodeList.Items))
+	for i := range nodeList.Items {
+		nodes[i] = &nodeList.Items[i]
+		nodeNames[i] = &nodeList.Items[i].Name
+	}
+	log.V(consts.LogLevelDebug).Info("Node info provider with", "Nodes:", nodeNames)
+	infoCatalog.Add(InfoTypeNodeInfo, nodeinfo.NewProvider(nodes))
+	return syncCR, infoCatalog, nil
+}
@@ -0,0 +1,89 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	mellanoxv1alpha1 "github.com/Mellanox/network-operator/api/v1alpha1"
+	"github.com/Mellanox/network-operator/pkg/consts"
+	"github.com/Mellanox/network-operator/pkg/nodeinfo"
+)
+
+var _ = Describe("Sync preparation tests", func() {
+	var k8sClient client.Client
+	var cr *mellanoxv1alpha1.NicClusterPolicy
+
+	BeforeEach(func() {
+		k8sClient = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+			&corev1.ServiceAccount{
+				ObjectMeta:       metav1.ObjectMeta{Name: "registry-sa", Namespace: consts.NetworkOperatorResourceNamespace},
+				ImagePullSecrets: []corev1.LocalObjectReference{{Name: "secret-a"}},
+			},
+			&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-a",
+				Labels: map[string]string{nodeinfo.NodeLabelMlnxNIC: "true"}}},
+			&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-b"}},
+		).Build()
+		cr = &mellanoxv1alpha1.NicClusterPolicy{}
+		cr.Spec.OFEDDriver = &mellanoxv1alpha1.OFEDDriverSpec{ImageSpec: mellanoxv1alpha1.ImageSpec{
+			Image: "mofed", ImagePullSecretsFrom: "registry-sa"}}
+	})
+
+	It("Should resolve the image pull secrets on a copy", func() {
+		syncCR, _, err := PrepareSync(context.Background(), k8sClient, cr, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(syncCR.Spec.OFEDDriver.ImagePullSecrets).To(Equal([]string{"secret-a"}))
+		Expect(cr.Spec.OFEDDriver.ImagePullSecrets).To(BeEmpty())
+	})
+	It("Should add the nodes with a Mellanox NIC to the catalog", func() {
+		_, infoCatalog, err := PrepareSync(context.Background(), k8sClient, cr, nil)
+		Expect(err).NotTo(HaveOccurred())
+		nodeInfo := infoCatalog.GetNodeInfoProvider()
+		Expect(nodeInfo).NotTo(BeNil())
+		Expect(nodeInfo.GetNodesAttributes()).To(HaveLen(1))
+	})
+	It("Should not list the nodes if no component depends on them", func() {
+		cr.Spec.OFEDDriver = nil
+		_, infoCatalog, err := PrepareSync(context.Background(), k8sClient, cr, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(infoCatalog.GetNodeInfoProvider()).To(BeNil())
+	})
+	It("Should add the external render data to the catalog", func() {
+		data := ExternalRenderData{"site": map[string]string{"mtu": "9000"}}
+		_, infoCatalog, err := PrepareSync(context.Background(), k8sClient, cr, data)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(infoCatalog.GetExternalRenderData()).To(Equal(data))
+
+		_, infoCatalog, err = PrepareSync(context.Background(), k8sClient, cr, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(infoCatalog.GetExternalRenderData()).To(BeNil())
+	})
+	It("Should fail if the referenced ServiceAccount does not exist", func() {
+		cr.Spec.OFEDDriver.ImagePullSecretsFrom = "missing-sa"
+		_, _, err := PrepareSync(context.Background(), k8sClient, cr, nil)
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,83 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"github.com/pkg/errors"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+)
+
+// IsTransientAPIError checks if err is caused by a transient API server failure, e.g while the control plane is
+// upgraded, which is expected to resolve without user intervention
+func IsTransientAPIError(err error) bool {
+	if err == nil {
+		return false
+	}
+	cause := errors.Cause(err)
+	return k8serrors.IsServerTimeout(cause) || k8serrors.IsTimeout(cause) || k8serrors.IsTooManyRequests(cause) ||
+		k8serrors.IsServiceUnavailable(cause) || k8serrors.IsInternalError(cause) ||
+		utilnet.IsConnectionRefused(cause) || utilnet.IsConnectionReset(cause) || utilnet.IsProbableEOF(cause)
+}
+
+// TolerateTransientErrors returns results in which states that failed with a transient API error keep their
+// previous status, as provided in previous keyed by state name, instead of reporting the error. States without
+// a previous status are not ready. The global status is recomputed from the tolerated states, along with the previous
+// status of the states which were not synced, e.g the states of the groups after a failed group. The tolerated errors
+// are returned, keyed by state name.
+func TolerateTransientErrors(results Results, previous map[string]SyncState) (Results, map[string]error) {
+	tolerated := make(map[string]error)
+	tolerant := Results{
+		Status:       results.Status,
+		StatesStatus: make([]Result, len(results.StatesStatus)),
+	}
+	copy(tolerant.StatesStatus, results.StatesStatus)
+	for i := range tolerant.StatesStatus {
+		result := &tolerant.StatesStatus[i]
+		if !IsTransientAPIError(result.ErrInfo) {
+			continue
+		}
+		tolerated[result.StateName] = result.ErrInfo
+		result.Status = SyncStateNotReady
+		if status, ok := previous[result.StateName]; ok {
+			result.Status = status
+		}
+		result.ErrInfo = nil
+	}
+	if len(tolerated) != 0 {
+		tolerant.Status = getGlobalStatus(tolerant.StatesStatus, previous)
+	}
+	return tolerant, tolerated
+}
+
+// getGlobalStatus returns SyncStateReady if none of the states of results, nor the states of previous missing from
+// results, is not ready or in error, as the stateManager does for the states it syncs
+func getGlobalStatus(results []Result, previous map[string]SyncState) SyncState {
+	synced := make(map[string]bool, len(results))
+	for i := range results {
+		synced[results[i].StateName] = true
+		if results[i].Status == SyncStateNotReady || results[i].Status == SyncStateError {
+			return SyncStateNotReady
+		}
+	}
+	for name, status := range previous {
+		if !synced[name] && (status == SyncStateNotReady || status == SyncStateError) {
+			return SyncStateNotReady
+		}
+	}
+	return SyncStateReady
+}
@@ -0,0 +1,115 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"syscall"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var _ = Describe("Transient API errors tests", func() {
+	unavailable := errors.Wrap(k8serrors.NewServiceUnavailable("apiserver is shutting down"), "failed to get object")
+
+	Context("IsTransientAPIError", func() {
+		It("Should classify transient API errors", func() {
+			Expect(IsTransientAPIError(unavailable)).To(BeTrue())
+			Expect(IsTransientAPIError(k8serrors.NewTooManyRequests("throttled", 1))).To(BeTrue())
+			Expect(IsTransientAPIError(k8serrors.NewTimeoutError("timeout", 1))).To(BeTrue())
+			Expect(IsTransientAPIError(errors.Wrap(syscall.ECONNREFUSED, "dial tcp"))).To(BeTrue())
+		})
+		It("Should not classify other errors as transient", func() {
+			Expect(IsTransientAPIError(nil)).To(BeFalse())
+			Expect(IsTransientAPIError(errors.New("failed to render objects"))).To(BeFalse())
+			Expect(IsTransientAPIError(
+				k8serrors.NewNotFound(schema.GroupResource{Resource: "configmaps"}, "cm"))).To(BeFalse())
+			Expect(IsTransientAPIError(
+				k8serrors.NewForbidden(schema.GroupResource{Resource: "configmaps"}, "cm", nil))).To(BeFalse())
+		})
+	})
+
+	Context("TolerateTransientErrors", func() {
+		It("Should keep the previous status of states failing with a transient error", func() {
+			results := Results{
+				Status: SyncStateNotReady,
+				StatesStatus: []Result{
+					{StateName: "ready-state", Status: SyncStateReady},
+					{StateName: "transient-state", Status: SyncStateError, ErrInfo: unavailable},
+					{StateName: "new-state", Status: SyncStateError, ErrInfo: unavailable},
+				},
+			}
+			previous := map[string]SyncState{"ready-state": SyncStateReady, "transient-state": SyncStateReady}
+
+			tolerant, tolerated := TolerateTransientErrors(results, previous)
+			Expect(tolerant.StatesStatus).To(Equal([]Result{
+				{StateName: "ready-state", Status: SyncStateReady},
+				{StateName: "transient-state", Status: SyncStateReady},
+				{StateName: "new-state", Status: SyncStateNotReady},
+			}))
+			Expect(tolerated).To(HaveLen(2))
+			Expect(tolerated).To(HaveKeyWithValue("transient-state", unavailable))
+			// results are not modified
+			Expect(results.StatesStatus[1].Status).To(Equal(SyncState(SyncStateError)))
+		})
+		It("Should keep the custom resource ready if the failed states were ready", func() {
+			results := Results{
+				Status: SyncStateNotReady,
+				StatesStatus: []Result{
+					{StateName: "ready-state", Status: SyncStateReady},
+					{StateName: "transient-state", Status: SyncStateError, ErrInfo: unavailable},
+				},
+			}
+			// the state of the next group was not synced after the failed group and kept its previous status
+			previous := map[string]SyncState{
+				"ready-state": SyncStateReady, "transient-state": SyncStateReady, "next-state": SyncStateReady}
+
+			tolerant, _ := TolerateTransientErrors(results, previous)
+			Expect(tolerant.Status).To(Equal(SyncState(SyncStateReady)))
+
+			previous["next-state"] = SyncStateNotReady
+			tolerant, _ = TolerateTransientErrors(results, previous)
+			Expect(tolerant.Status).To(Equal(SyncState(SyncStateNotReady)))
+		})
+		It("Should not make the custom resource ready if a state was not ready", func() {
+			results := Results{
+				Status: SyncStateNotReady,
+				StatesStatus: []Result{
+					{StateName: "not-ready-state", Status: SyncStateNotReady},
+					{StateName: "transient-state", Status: SyncStateError, ErrInfo: unavailable},
+				},
+			}
+			tolerant, _ := TolerateTransientErrors(results, map[string]SyncState{"transient-state": SyncStateReady})
+			Expect(tolerant.Status).To(Equal(SyncState(SyncStateNotReady)))
+		})
+		It("Should report other errors", func() {
+			renderErr := errors.New("failed to render objects")
+			results := Results{
+				Status:       SyncStateNotReady,
+				StatesStatus: []Result{{StateName: "state", Status: SyncStateError, ErrInfo: renderErr}},
+			}
+			tolerant, tolerated := TolerateTransientErrors(results, map[string]SyncState{"state": SyncStateReady})
+			Expect(tolerant.StatesStatus[0].Status).To(Equal(SyncState(SyncStateError)))
+			Expect(tolerant.StatesStatus[0].ErrInfo).To(Equal(renderErr))
+			Expect(tolerated).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,80 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	"github.com/Mellanox/network-operator/pkg/consts"
+)
+
+// WatchSourceFilter selects the watch sources of the states which are registered by the controllers. Watching a kind
+// which is not served by the API server, or which the operator is not allowed to watch, fails the start of the
+// controller, such kinds are not watched and the states of the controller still sync.
+type WatchSourceFilter struct {
+	mapper   meta.RESTMapper
+	scheme   *runtime.Scheme
+	disabled map[string]bool
+}
+
+// NewWatchSourceFilter creates a WatchSourceFilter which drops the sources of kinds which are not served by the API
+// server according to mapper, and of disabledKinds. A disabled kind is either a kind name, e.g IPPool, or a kind
+// qualified by its group, e.g IPPool.whereabouts.cni.cncf.io.
+func NewWatchSourceFilter(mapper meta.RESTMapper, scheme *runtime.Scheme, disabledKinds []string) *WatchSourceFilter {
+	disabled := make(map[string]bool, len(disabledKinds))
+	for _, kind := range disabledKinds {
+		if kind != "" {
+			disabled[kind] = true
+		}
+	}
+	return &WatchSourceFilter{mapper: mapper, scheme: scheme, disabled: disabled}
+}
+
+// Filter returns the sources of the enabled kinds served by the API server, all the sources are returned if the
+// filter is nil
+func (f *WatchSourceFilter) Filter(sources []*source.Kind) []*source.Kind {
+	if f == nil {
+		return sources
+	}
+	filtered := make([]*source.Kind, 0, len(sources))
+	for _, src := range sources {
+		gvk, err := apiutil.GVKForObject(src.Type, f.scheme)
+		if err != nil {
+			log.V(consts.LogLevelWarning).Info("Not watching source of unknown kind", "error:", err)
+			continue
+		}
+		if f.disabled[gvk.Kind] || f.disabled[gvk.GroupKind().String()] {
+			log.V(consts.LogLevelInfo).Info("Not watching disabled kind", "kind", gvk.GroupKind().String())
+			continue
+		}
+		if _, err := f.mapper.RESTMapping(gvk.GroupKind(), gvk.Version); err != nil {
+			if meta.IsNoMatchError(err) {
+				log.V(consts.LogLevelWarning).Info("Not watching kind which is not served by the API server",
+					"kind", gvk.GroupKind().String())
+				continue
+			}
+			// the kind may still be served, the watch reports the error if it is not
+			log.V(consts.LogLevelWarning).Info("Failed to check whether kind is served by the API server",
+				"kind", gvk.GroupKind().String(), "error:", err)
+		}
+		filtered = append(filtered, src)
+	}
+	return filtered
+}
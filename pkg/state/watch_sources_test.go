@@ -0,0 +1,90 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	netattdefv1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	mellanoxv1alpha1 "github.com/Mellanox/network-operator/api/v1alpha1"
+)
+
+var _ = Describe("Watch source filter tests", func() {
+	var (
+		scheme  *runtime.Scheme
+		mapper  *meta.DefaultRESTMapper
+		sources []*source.Kind
+	)
+
+	BeforeEach(func() {
+		scheme = runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(mellanoxv1alpha1.AddToScheme(scheme)).To(Succeed())
+		Expect(netattdefv1.AddToScheme(scheme)).To(Succeed())
+		// the NetworkAttachmentDefinition API is not served
+		mapper = meta.NewDefaultRESTMapper(nil)
+		mapper.Add(appsv1.SchemeGroupVersion.WithKind("DaemonSet"), meta.RESTScopeNamespace)
+		mapper.Add(mellanoxv1alpha1.GroupVersion.WithKind("HostDeviceNetwork"), meta.RESTScopeRoot)
+		sources = []*source.Kind{
+			{Type: &appsv1.DaemonSet{}},
+			{Type: &mellanoxv1alpha1.HostDeviceNetwork{}},
+			{Type: &netattdefv1.NetworkAttachmentDefinition{}},
+		}
+	})
+
+	getKinds := func(sources []*source.Kind) []string {
+		kinds := make([]string, 0, len(sources))
+		for _, src := range sources {
+			gvks, _, err := scheme.ObjectKinds(src.Type)
+			Expect(err).NotTo(HaveOccurred())
+			kinds = append(kinds, gvks[0].Kind)
+		}
+		return kinds
+	}
+
+	It("Should not watch kinds which are not served by the API server", func() {
+		filtered := NewWatchSourceFilter(mapper, scheme, nil).Filter(sources)
+		Expect(getKinds(filtered)).To(Equal([]string{"DaemonSet", "HostDeviceNetwork"}))
+	})
+	It("Should not watch disabled kinds", func() {
+		filtered := NewWatchSourceFilter(mapper, scheme, []string{"DaemonSet", ""}).Filter(sources)
+		Expect(getKinds(filtered)).To(Equal([]string{"HostDeviceNetwork"}))
+	})
+	It("Should not watch disabled kinds qualified by their group", func() {
+		filtered := NewWatchSourceFilter(mapper, scheme, []string{"HostDeviceNetwork.mellanox.com", "DaemonSet.other.io"}).
+			Filter(sources)
+		Expect(getKinds(filtered)).To(Equal([]string{"DaemonSet"}))
+	})
+	It("Should not watch kinds which are not registered in the scheme", func() {
+		mapper.Add(schema.GroupVersionKind{Group: "k8s.cni.cncf.io", Version: "v1", Kind: "NetworkAttachmentDefinition"},
+			meta.RESTScopeNamespace)
+		filtered := NewWatchSourceFilter(mapper, runtime.NewScheme(), nil).Filter(sources)
+		Expect(filtered).To(BeEmpty())
+	})
+	It("Should watch all the sources if not set", func() {
+		var filter *WatchSourceFilter
+		Expect(filter.Filter(sources)).To(Equal(sources))
+	})
+})
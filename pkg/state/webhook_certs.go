@@ -0,0 +1,229 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/Mellanox/network-operator/pkg/consts"
+)
+
+const (
+	// webhookCACertKey and webhookCAKeyKey hold the self-signed CA issuing the webhook server certificate
+	webhookCACertKey = "ca.crt"
+	webhookCAKeyKey  = "ca.key"
+	// webhookPreviousCACertKey holds the CA replaced by the last rotation, it is trusted until it expires so the
+	// webhook server can keep serving the certificate issued by it until the rotated certificate is loaded
+	webhookPreviousCACertKey = "ca-previous.crt"
+	// webhookCertValidity is the validity of the generated CA and webhook server certificates
+	webhookCertValidity = 365 * 24 * time.Hour
+	// webhookCertRotationThreshold is the remaining validity below which a certificate is rotated
+	webhookCertRotationThreshold = 30 * 24 * time.Hour
+)
+
+// webhookCerts holds the PEM encoded certificates and keys of the webhook server
+type webhookCerts struct {
+	CACert         []byte
+	CAKey          []byte
+	PreviousCACert []byte
+	Cert           []byte
+	Key            []byte
+}
+
+// secretData returns the certificates as the data of the webhook server certificate Secret
+func (c *webhookCerts) secretData() map[string][]byte {
+	data := map[string][]byte{
+		webhookCACertKey:        c.CACert,
+		webhookCAKeyKey:         c.CAKey,
+		corev1.TLSCertKey:       c.Cert,
+		corev1.TLSPrivateKeyKey: c.Key,
+	}
+	if len(c.PreviousCACert) != 0 {
+		data[webhookPreviousCACertKey] = c.PreviousCACert
+	}
+	return data
+}
+
+// caBundle returns the CA certificates the API server trusts to call the webhook server
+func (c *webhookCerts) caBundle() []byte {
+	bundle := append([]byte{}, c.CACert...)
+	return append(bundle, c.PreviousCACert...)
+}
+
+// getWebhookCerts returns the certificates of the webhook server for dnsNames. The certificates of the existing
+// Secret data are kept unless they are missing, invalid or expire within webhookCertRotationThreshold.
+// When the CA is rotated the previous CA remains in the caBundle until it expires, the API server then trusts the
+// webhook server certificate during the whole rotation.
+func getWebhookCerts(existing map[string][]byte, dnsNames []string, now time.Time) (*webhookCerts, error) {
+	certs := &webhookCerts{}
+	caCert, caKey, err := parseWebhookCA(existing[webhookCACertKey], existing[webhookCAKeyKey])
+	if err != nil || needsRotation(caCert, now) {
+		log.V(consts.LogLevelInfo).Info("Generating webhook CA", "reason", rotationReason(err))
+		if caCert != nil && now.Before(caCert.NotAfter) {
+			certs.PreviousCACert = existing[webhookCACertKey]
+		}
+		if caCert, caKey, err = newWebhookCA(now); err != nil {
+			return nil, errors.Wrap(err, "failed to generate webhook CA")
+		}
+	} else if previous, parseErr := parseCertificate(existing[webhookPreviousCACertKey]); parseErr == nil &&
+		now.Before(previous.NotAfter) {
+		certs.PreviousCACert = existing[webhookPreviousCACertKey]
+	}
+	if certs.CACert, certs.CAKey, err = encodeCertAndKey(caCert, caKey); err != nil {
+		return nil, err
+	}
+
+	cert, err := parseCertificate(existing[corev1.TLSCertKey])
+	if err == nil && !needsRotation(cert, now) && cert.CheckSignatureFrom(caCert) == nil &&
+		matchesDNSNames(cert, dnsNames) && len(existing[corev1.TLSPrivateKeyKey]) != 0 {
+		certs.Cert = existing[corev1.TLSCertKey]
+		certs.Key = existing[corev1.TLSPrivateKeyKey]
+		return certs, nil
+	}
+	log.V(consts.LogLevelInfo).Info("Generating webhook server certificate", "dnsNames", dnsNames)
+	cert, key, err := newWebhookServingCert(caCert, caKey, dnsNames, now)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to generate webhook server certificate")
+	}
+	if certs.Cert, certs.Key, err = encodeCertAndKey(cert, key); err != nil {
+		return nil, err
+	}
+	return certs, nil
+}
+
+func rotationReason(err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return "CA expires soon"
+}
+
+// needsRotation returns true if cert expires within webhookCertRotationThreshold
+func needsRotation(cert *x509.Certificate, now time.Time) bool {
+	return now.Add(webhookCertRotationThreshold).After(cert.NotAfter)
+}
+
+// matchesDNSNames returns true if cert is valid for exactly dnsNames
+func matchesDNSNames(cert *x509.Certificate, dnsNames []string) bool {
+	if len(cert.DNSNames) != len(dnsNames) {
+		return false
+	}
+	for i := range dnsNames {
+		if cert.DNSNames[i] != dnsNames[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// parseCertificate parses a PEM encoded certificate
+func parseCertificate(certPEM []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return nil, errors.New("no PEM encoded certificate")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// parseWebhookCA parses the PEM encoded CA certificate and key
+func parseWebhookCA(certPEM, keyPEM []byte) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	cert, err := parseCertificate(certPEM)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "invalid CA certificate")
+	}
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return cert, nil, errors.New("invalid CA key: no PEM encoded key")
+	}
+	key, err := x509.ParseECPrivateKey(block.Bytes)
+	if err != nil {
+		return cert, nil, errors.Wrap(err, "invalid CA key")
+	}
+	return cert, key, nil
+}
+
+// newWebhookCA generates a self-signed CA
+func newWebhookCA(now time.Time) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	return createCertificate(&x509.Certificate{
+		Subject:               pkix.Name{CommonName: "nvidia-network-operator-webhook-ca"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(webhookCertValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}, nil, nil)
+}
+
+// newWebhookServingCert generates a webhook server certificate for dnsNames issued by the CA
+func newWebhookServingCert(caCert *x509.Certificate, caKey *ecdsa.PrivateKey, dnsNames []string,
+	now time.Time) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	return createCertificate(&x509.Certificate{
+		Subject:     pkix.Name{CommonName: dnsNames[0]},
+		DNSNames:    dnsNames,
+		NotBefore:   now.Add(-time.Hour),
+		NotAfter:    now.Add(webhookCertValidity),
+		KeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, caCert, caKey)
+}
+
+// createCertificate generates a key and a certificate for it from template, the certificate is self-signed if
+// parent is nil
+func createCertificate(template, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (
+	*x509.Certificate, *ecdsa.PrivateKey, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+	template.SerialNumber = serial
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cert, key, nil
+}
+
+// encodeCertAndKey PEM encodes a certificate and its key
+func encodeCertAndKey(cert *x509.Certificate, key *ecdsa.PrivateKey) ([]byte, []byte, error) {
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to encode key")
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), nil
+}
@@ -0,0 +1,74 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package validation
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/runtime"
+
+	mellanoxv1alpha1 "github.com/Mellanox/network-operator/api/v1alpha1"
+)
+
+// EventReasonDeprecatedField is the reason of the Warning Events recorded on a custom resource setting a deprecated
+// field
+const EventReasonDeprecatedField = "DeprecatedField"
+
+// DeprecatedField is a deprecated field of a custom resource, the field is a dot separated path in the resource, e.g
+// spec.psp.enabled. A field is used if it is present with a non zero value.
+type DeprecatedField struct {
+	Path string
+	// Replacement of the field, the field is removed without replacement if empty
+	Replacement string
+}
+
+// deprecatedFields are the deprecated fields of the custom resources keyed by kind
+var deprecatedFields = map[string][]DeprecatedField{
+	mellanoxv1alpha1.NicClusterPolicyCRDName: {
+		// PodSecurityPolicies are removed in Kubernetes 1.25
+		{Path: "spec.psp.enabled", Replacement: "spec.psa.enabled"},
+	},
+	mellanoxv1alpha1.HostDeviceNetworkCRDName: {},
+	mellanoxv1alpha1.MacvlanNetworkCRDName:    {},
+}
+
+// Deprecations returns a warning naming each deprecated field used by obj and its replacement, obj is a custom
+// resource of the given kind. Deprecated fields are still applied, the warnings are reported by the webhook and on
+// reconcile so users migrate before the fields are removed.
+func Deprecations(kind string, obj runtime.Object) ([]string, error) {
+	u, err := toUnstructured(kind, obj)
+	if err != nil {
+		return nil, err
+	}
+	return lintFields(u.Object, deprecatedFields[kind]), nil
+}
+
+func lintFields(content map[string]interface{}, fields []DeprecatedField) []string {
+	var warnings []string
+	for _, f := range fields {
+		if !isSet(content, f.Path) {
+			continue
+		}
+		if f.Replacement == "" {
+			warnings = append(warnings, fmt.Sprintf("%s is deprecated and will be removed", f.Path))
+			continue
+		}
+		warnings = append(warnings, fmt.Sprintf("%s is deprecated and will be removed, use %s instead",
+			f.Path, f.Replacement))
+	}
+	return warnings
+}
@@ -0,0 +1,129 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package validation validates the custom resources of the operator, both by the operator webhook server and on
+// reconcile, so a resource created while the webhook server is not reachable is reported with the same error
+package validation
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	mellanoxv1alpha1 "github.com/Mellanox/network-operator/api/v1alpha1"
+)
+
+// MutuallyExclusiveFields is a group of fields of which at most one may be set, fields are dot separated paths in
+// the resource, e.g spec.psp.enabled. A field is set if it is present with a non zero value.
+type MutuallyExclusiveFields []string
+
+// mutuallyExclusiveFields are the mutually exclusive field groups of the custom resources keyed by kind
+var mutuallyExclusiveFields = map[string][]MutuallyExclusiveFields{
+	mellanoxv1alpha1.NicClusterPolicyCRDName: {
+		// Pod Security Admission replaces the PodSecurityPolicies removed in Kubernetes 1.25
+		{"spec.psp.enabled", "spec.psa.enabled"},
+		// The value of an existing PriorityClass is not managed by the operator
+		{"spec.priorityClass.existing", "spec.priorityClass.value"},
+	},
+	mellanoxv1alpha1.HostDeviceNetworkCRDName: {},
+	mellanoxv1alpha1.MacvlanNetworkCRDName:    {},
+}
+
+// Validate returns an Invalid error listing the fields of obj set together with a field of the same mutually
+// exclusive group, obj is a custom resource of the given kind
+func Validate(kind string, obj runtime.Object) error {
+	u, err := toUnstructured(kind, obj)
+	if err != nil {
+		return err
+	}
+	return validateFields(kind, u.GetName(), u.Object, mutuallyExclusiveFields[kind])
+}
+
+// toUnstructured returns obj, a custom resource of the given kind, as unstructured content
+func toUnstructured(kind string, obj runtime.Object) (*unstructured.Unstructured, error) {
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		return u, nil
+	}
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to convert %s", kind)
+	}
+	return &unstructured.Unstructured{Object: content}, nil
+}
+
+func validateFields(kind, name string, content map[string]interface{}, groups []MutuallyExclusiveFields) error {
+	var errs field.ErrorList
+	for _, group := range groups {
+		var set []string
+		for _, path := range group {
+			if isSet(content, path) {
+				set = append(set, path)
+			}
+		}
+		if len(set) < 2 {
+			continue
+		}
+		// The first set field of the group is kept, the others are reported
+		for _, path := range set[1:] {
+			errs = append(errs, field.Forbidden(field.NewPath(path),
+				fmt.Sprintf("may not be set together with %s", strings.Join(without(set, path), ", "))))
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(
+		schema.GroupKind{Group: mellanoxv1alpha1.GroupVersion.Group, Kind: kind}, name, errs)
+}
+
+// isSet returns true if the field at the dot separated path is present with a non zero value
+func isSet(content map[string]interface{}, path string) bool {
+	value, found, err := unstructured.NestedFieldNoCopy(content, strings.Split(path, ".")...)
+	if err != nil || !found || value == nil {
+		return false
+	}
+	switch v := value.(type) {
+	case bool:
+		return v
+	case string:
+		return v != ""
+	case int64:
+		return v != 0
+	case float64:
+		return v != 0
+	case map[string]interface{}:
+		return len(v) != 0
+	case []interface{}:
+		return len(v) != 0
+	}
+	return true
+}
+
+func without(paths []string, path string) []string {
+	others := make([]string, 0, len(paths))
+	for _, p := range paths {
+		if p != path {
+			others = append(others, p)
+		}
+	}
+	return others
+}
@@ -0,0 +1,212 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package validation
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	admissionv1 "k8s.io/api/admission/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	mellanoxv1alpha1 "github.com/Mellanox/network-operator/api/v1alpha1"
+)
+
+var _ = Describe("Validation tests", func() {
+	var cr *mellanoxv1alpha1.NicClusterPolicy
+
+	BeforeEach(func() {
+		cr = &mellanoxv1alpha1.NicClusterPolicy{ObjectMeta: metav1.ObjectMeta{Name: "nic-cluster-policy"}}
+	})
+
+	// causes returns the fields and messages of the causes of an Invalid error
+	causes := func(err error) map[string]string {
+		ExpectWithOffset(1, apierrors.IsInvalid(err)).To(BeTrue())
+		fields := map[string]string{}
+		for _, cause := range err.(apierrors.APIStatus).Status().Details.Causes {
+			fields[cause.Field] = cause.Message
+		}
+		return fields
+	}
+
+	Context("Mutually exclusive fields", func() {
+		It("Should accept a NicClusterPolicy without conflicting fields", func() {
+			cr.Spec.PSA = &mellanoxv1alpha1.PSASpec{Enabled: true}
+			cr.Spec.PriorityClass = &mellanoxv1alpha1.PriorityClassSpec{Name: "network-operator", Value: 100}
+			Expect(Validate(mellanoxv1alpha1.NicClusterPolicyCRDName, cr)).To(Succeed())
+		})
+		It("Should accept disabled fields of a group", func() {
+			cr.Spec.PSP = &mellanoxv1alpha1.PSPSpec{Enabled: false}
+			cr.Spec.PSA = &mellanoxv1alpha1.PSASpec{Enabled: true}
+			cr.Spec.PriorityClass = &mellanoxv1alpha1.PriorityClassSpec{Name: "network-operator", Existing: true}
+			Expect(Validate(mellanoxv1alpha1.NicClusterPolicyCRDName, cr)).To(Succeed())
+		})
+		It("Should reject PodSecurityPolicies enabled along with Pod Security Admission", func() {
+			cr.Spec.PSP = &mellanoxv1alpha1.PSPSpec{Enabled: true}
+			cr.Spec.PSA = &mellanoxv1alpha1.PSASpec{Enabled: true}
+			err := Validate(mellanoxv1alpha1.NicClusterPolicyCRDName, cr)
+			Expect(causes(err)).To(Equal(map[string]string{
+				"spec.psa.enabled": "Forbidden: may not be set together with spec.psp.enabled",
+			}))
+			Expect(err.Error()).To(ContainSubstring(`NicClusterPolicy.mellanox.com "nic-cluster-policy" is invalid`))
+		})
+		It("Should reject the value of an existing PriorityClass", func() {
+			cr.Spec.PriorityClass = &mellanoxv1alpha1.PriorityClassSpec{
+				Name: "network-operator", Existing: true, Value: 100}
+			Expect(causes(Validate(mellanoxv1alpha1.NicClusterPolicyCRDName, cr))).To(Equal(map[string]string{
+				"spec.priorityClass.value": "Forbidden: may not be set together with spec.priorityClass.existing",
+			}))
+		})
+		It("Should report every conflicting group", func() {
+			cr.Spec.PSP = &mellanoxv1alpha1.PSPSpec{Enabled: true}
+			cr.Spec.PSA = &mellanoxv1alpha1.PSASpec{Enabled: true}
+			cr.Spec.PriorityClass = &mellanoxv1alpha1.PriorityClassSpec{
+				Name: "network-operator", Existing: true, Value: 100}
+			Expect(causes(Validate(mellanoxv1alpha1.NicClusterPolicyCRDName, cr))).To(HaveLen(2))
+		})
+		It("Should report every field set after the first field of a group", func() {
+			content := map[string]interface{}{
+				"metadata": map[string]interface{}{"name": "test"},
+				"spec":     map[string]interface{}{"a": "x", "b": int64(1), "c": []interface{}{"y"}, "d": false},
+			}
+			groups := []MutuallyExclusiveFields{{"spec.a", "spec.b", "spec.c", "spec.d"}}
+			err := validateFields("Test", "test", content, groups)
+			Expect(causes(err)).To(Equal(map[string]string{
+				"spec.b": "Forbidden: may not be set together with spec.a, spec.c",
+				"spec.c": "Forbidden: may not be set together with spec.a, spec.b",
+			}))
+		})
+		It("Should accept a kind without mutually exclusive fields", func() {
+			Expect(Validate(mellanoxv1alpha1.MacvlanNetworkCRDName, &mellanoxv1alpha1.MacvlanNetwork{})).To(Succeed())
+		})
+	})
+
+	Context("Deprecated fields", func() {
+		It("Should warn about a deprecated field naming its replacement", func() {
+			cr.Spec.PSP = &mellanoxv1alpha1.PSPSpec{Enabled: true}
+			Expect(Deprecations(mellanoxv1alpha1.NicClusterPolicyCRDName, cr)).To(Equal([]string{
+				"spec.psp.enabled is deprecated and will be removed, use spec.psa.enabled instead",
+			}))
+		})
+		It("Should not warn about a deprecated field which is not used", func() {
+			cr.Spec.PSP = &mellanoxv1alpha1.PSPSpec{Enabled: false}
+			cr.Spec.PSA = &mellanoxv1alpha1.PSASpec{Enabled: true}
+			Expect(Deprecations(mellanoxv1alpha1.NicClusterPolicyCRDName, cr)).To(BeEmpty())
+		})
+		It("Should warn about a deprecated field without replacement", func() {
+			content := map[string]interface{}{"spec": map[string]interface{}{"a": "x", "b": "y"}}
+			fields := []DeprecatedField{{Path: "spec.a"}, {Path: "spec.b", Replacement: "spec.c"}, {Path: "spec.d"}}
+			Expect(lintFields(content, fields)).To(Equal([]string{
+				"spec.a is deprecated and will be removed",
+				"spec.b is deprecated and will be removed, use spec.c instead",
+			}))
+		})
+	})
+
+	Context("Webhook", func() {
+		handle := func(obj runtime.Object) admission.Response {
+			raw, err := json.Marshal(obj)
+			Expect(err).NotTo(HaveOccurred())
+			v := &validator{kind: mellanoxv1alpha1.NicClusterPolicyCRDName}
+			return v.Handle(context.TODO(), admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+				Operation: admissionv1.Create,
+				Object:    runtime.RawExtension{Raw: raw},
+			}})
+		}
+
+		BeforeEach(func() {
+			// admission requests hold the object with its type meta
+			cr.APIVersion = mellanoxv1alpha1.GroupVersion.String()
+			cr.Kind = mellanoxv1alpha1.NicClusterPolicyCRDName
+		})
+
+		It("Should admit a valid NicClusterPolicy", func() {
+			cr.Spec.PSA = &mellanoxv1alpha1.PSASpec{Enabled: true}
+			resp := handle(cr)
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(resp.Warnings).To(BeEmpty())
+		})
+		It("Should admit a NicClusterPolicy using a deprecated field with a warning", func() {
+			cr.Spec.PSP = &mellanoxv1alpha1.PSPSpec{Enabled: true}
+			resp := handle(cr)
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(resp.Warnings).To(Equal([]string{
+				"spec.psp.enabled is deprecated and will be removed, use spec.psa.enabled instead",
+			}))
+		})
+		It("Should deny an invalid NicClusterPolicy with the error reported on reconcile", func() {
+			cr.Spec.PSP = &mellanoxv1alpha1.PSPSpec{Enabled: true}
+			cr.Spec.PSA = &mellanoxv1alpha1.PSASpec{Enabled: true}
+			resp := handle(cr)
+			Expect(resp.Allowed).To(BeFalse())
+			Expect(resp.Result.Code).To(BeEquivalentTo(http.StatusUnprocessableEntity))
+			Expect(resp.Result.Message).To(Equal(Validate(mellanoxv1alpha1.NicClusterPolicyCRDName, cr).Error()))
+		})
+	})
+
+	Context("Defaulting webhook", func() {
+		var network *mellanoxv1alpha1.HostDeviceNetwork
+
+		// handle returns the patches of the defaulting webhook response keyed by path
+		handle := func(obj runtime.Object) map[string]interface{} {
+			raw, err := json.Marshal(obj)
+			Expect(err).NotTo(HaveOccurred())
+			d := &defaulter{newObject: defaultingWebhooks["/mutate-mellanox-com-v1alpha1-hostdevicenetwork"]}
+			resp := d.Handle(context.TODO(), admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+				Operation: admissionv1.Create,
+				Object:    runtime.RawExtension{Raw: raw},
+			}})
+			Expect(resp.Allowed).To(BeTrue())
+			patches := map[string]interface{}{}
+			for _, patch := range resp.Patches {
+				patches[patch.Path] = patch.Value
+			}
+			return patches
+		}
+
+		BeforeEach(func() {
+			network = &mellanoxv1alpha1.HostDeviceNetwork{ObjectMeta: metav1.ObjectMeta{Name: "hostdev-net"}}
+			network.APIVersion = mellanoxv1alpha1.GroupVersion.String()
+			network.Kind = mellanoxv1alpha1.HostDeviceNetworkCRDName
+		})
+
+		It("Should default an under-specified HostDeviceNetwork", func() {
+			network.Spec.ResourceName = "hostdev"
+			Expect(handle(network)).To(Equal(map[string]interface{}{
+				"/spec/networkNamespace": "default",
+				"/spec/cniVersion":       "0.3.1",
+				"/spec/resourceName":     "nvidia.com/hostdev",
+			}))
+		})
+		It("Should keep the set fields of a HostDeviceNetwork", func() {
+			network.Spec = mellanoxv1alpha1.HostDeviceNetworkSpec{
+				NetworkNamespace: "tenant", ResourceName: "nvidia.com/hostdev", CNIVersion: "0.4.0"}
+			Expect(handle(network)).To(BeEmpty())
+		})
+		It("Should not change a defaulted HostDeviceNetwork", func() {
+			network.Spec.ResourceName = "hostdev"
+			network.Default()
+			Expect(handle(network)).To(BeEmpty())
+		})
+	})
+})
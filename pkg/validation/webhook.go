@@ -0,0 +1,100 @@
+/*
+2022 NVIDIA CORPORATION & AFFILIATES
+
+Licensed under the Apache License, Version 2.0 (the License);
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an AS IS BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package validation
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	mellanoxv1alpha1 "github.com/Mellanox/network-operator/api/v1alpha1"
+)
+
+// webhookPaths are the paths of the operator webhook server validating the custom resources keyed by kind, they
+// match the paths of the ValidatingWebhookConfiguration rendered by the validating webhook state
+var webhookPaths = map[string]string{
+	mellanoxv1alpha1.NicClusterPolicyCRDName:  "/validate-mellanox-com-v1alpha1-nicclusterpolicy",
+	mellanoxv1alpha1.HostDeviceNetworkCRDName: "/validate-mellanox-com-v1alpha1-hostdevicenetwork",
+	mellanoxv1alpha1.MacvlanNetworkCRDName:    "/validate-mellanox-com-v1alpha1-macvlannetwork",
+}
+
+// defaultingWebhooks are the constructors of the custom resources defaulted by the operator webhook server keyed by
+// path, they match the paths of the MutatingWebhookConfiguration rendered by the validating webhook state
+var defaultingWebhooks = map[string]func() admission.Defaulter{
+	"/mutate-mellanox-com-v1alpha1-hostdevicenetwork": func() admission.Defaulter {
+		return &mellanoxv1alpha1.HostDeviceNetwork{}
+	},
+}
+
+// RegisterWebhooks registers the validating and defaulting webhooks of the custom resources in the webhook server
+func RegisterWebhooks(server *webhook.Server) {
+	for kind, path := range webhookPaths {
+		server.Register(path, &webhook.Admission{Handler: &validator{kind: kind}})
+	}
+	for path, newObject := range defaultingWebhooks {
+		server.Register(path, &webhook.Admission{Handler: &defaulter{newObject: newObject}})
+	}
+}
+
+// validator admits the custom resources of a kind passing Validate, with a warning for each deprecated field they use
+type validator struct {
+	kind string
+}
+
+// Handle implements admission.Handler
+func (v *validator) Handle(_ context.Context, req admission.Request) admission.Response {
+	obj := &unstructured.Unstructured{}
+	if err := obj.UnmarshalJSON(req.Object.Raw); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	if err := Validate(v.kind, obj); err != nil {
+		resp := admission.Denied(err.Error())
+		if status, ok := err.(apierrors.APIStatus); ok {
+			result := status.Status()
+			resp.Result = &result
+		}
+		return resp
+	}
+	resp := admission.Allowed("")
+	// the deprecated fields are listed on reconcile as well, a conversion failure is not a reason to deny
+	resp.Warnings, _ = Deprecations(v.kind, obj)
+	return resp
+}
+
+// defaulter admits the custom resources with a patch setting their unset optional fields to their defaults
+type defaulter struct {
+	newObject func() admission.Defaulter
+}
+
+// Handle implements admission.Handler
+func (d *defaulter) Handle(_ context.Context, req admission.Request) admission.Response {
+	obj := d.newObject()
+	if err := json.Unmarshal(req.Object.Raw, obj); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	obj.Default()
+	defaulted, err := json.Marshal(obj)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	return admission.PatchResponseFromRaw(req.Object.Raw, defaulted)
+}